@@ -51,6 +51,9 @@ public class SeaweedWrite {
         String url = response.getUrl();
         String auth = response.getAuth();
         String targetUrl = String.format("http://%s/%s", url, fileId);
+        if (!response.getWriteAck().isEmpty()) {
+            targetUrl += "?ack=" + response.getWriteAck();
+        }
 
         ByteString cipherKeyString = com.google.protobuf.ByteString.EMPTY;
         byte[] cipherKey = null;
@@ -92,6 +95,21 @@ public class SeaweedWrite {
         }
     }
 
+    public static void appendMeta(final FilerGrpcClient filerGrpcClient,
+                                  final String parentDirectory,
+                                  final String entryName,
+                                  final String leaseHolder,
+                                  final List<FilerProto.FileChunk> chunks) throws IOException {
+        filerGrpcClient.getBlockingStub().appendToEntry(
+                FilerProto.AppendToEntryRequest.newBuilder()
+                        .setDirectory(parentDirectory)
+                        .setEntryName(entryName)
+                        .setLeaseHolder(leaseHolder)
+                        .addAllChunks(chunks)
+                        .build()
+        );
+    }
+
     private static String multipartUpload(String targetUrl,
                                           String auth,
                                           final byte[] bytes,
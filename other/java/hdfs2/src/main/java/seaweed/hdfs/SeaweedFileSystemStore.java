@@ -11,6 +11,7 @@ import seaweedfs.client.FilerClient;
 import seaweedfs.client.FilerGrpcClient;
 import seaweedfs.client.FilerProto;
 import seaweedfs.client.SeaweedRead;
+import seaweedfs.client.SeaweedWrite;
 
 import java.io.FileNotFoundException;
 import java.io.IOException;
@@ -19,13 +20,22 @@ import java.io.OutputStream;
 import java.util.ArrayList;
 import java.util.Arrays;
 import java.util.List;
+import java.util.UUID;
+import java.util.concurrent.Executors;
+import java.util.concurrent.ScheduledExecutorService;
+import java.util.concurrent.TimeUnit;
 
 public class SeaweedFileSystemStore {
 
     private static final Logger LOG = LoggerFactory.getLogger(SeaweedFileSystemStore.class);
 
+    // the filer expires the leases not renewed in one minute
+    private static final long LEASE_RENEW_SECONDS = 20;
+
     private FilerGrpcClient filerGrpcClient;
     private FilerClient filerClient;
+    private final String leaseHolder = "hdfs_" + UUID.randomUUID().toString();
+    private ScheduledExecutorService leaseRenewer;
 
     public SeaweedFileSystemStore(String host, int port) {
         int grpcPort = 10000 + port;
@@ -174,10 +184,12 @@ public class SeaweedFileSystemStore {
         UserGroupInformation userGroupInformation = UserGroupInformation.getCurrentUser();
         long now = System.currentTimeMillis() / 1000L;
 
+        FilerProto.Entry existingEntry = overwrite ? null : lookupEntry(path);
+        acquireLease(path, true, false);
+
         FilerProto.Entry.Builder entry = null;
         long writePosition = 0;
         if (!overwrite) {
-            FilerProto.Entry existingEntry = lookupEntry(path);
             LOG.debug("createFile merged entry path:{} existingEntry:{}", path, existingEntry);
             if (existingEntry != null) {
                 entry = FilerProto.Entry.newBuilder();
@@ -201,10 +213,95 @@ public class SeaweedFileSystemStore {
                     .clearGroupName()
                     .addAllGroupName(Arrays.asList(userGroupInformation.getGroupNames()))
                 );
+            // replace the leased file with the new empty file
+            SeaweedWrite.writeMeta(filerGrpcClient, getParentDirectory(path), entry);
+        }
+
+        return new SeaweedOutputStream(filerGrpcClient, path, entry, writePosition, bufferSize, replication, leaseHolder);
+
+    }
+
+    public boolean truncate(final Path path, long newLength) throws IOException {
+
+        LOG.debug("truncate path: {} newLength: {}", path, newLength);
+
+        if (lookupEntry(path) == null) {
+            throw new FileNotFoundException("File does not exist: " + path);
         }
+        FilerProto.TruncateEntryResponse response;
+        try {
+            response = filerGrpcClient.getBlockingStub().truncateEntry(FilerProto.TruncateEntryRequest.newBuilder()
+                .setDirectory(getParentDirectory(path))
+                .setName(path.getName())
+                .setNewLength(newLength)
+                .build());
+        } catch (Exception ex) {
+            throw new IOException(ex);
+        }
+        if (!response.getError().isEmpty()) {
+            throw new IOException(response.getError());
+        }
+        return true;
+    }
 
-        return new SeaweedOutputStream(filerGrpcClient, path, entry, writePosition, bufferSize, replication);
+    /**
+     * Takes over the lease of the file from its writer, and closes the file.
+     * The previous writer can not append to the file any more.
+     */
+    public boolean recoverLease(final Path path) throws IOException {
 
+        LOG.debug("recoverLease path: {}", path);
+
+        acquireLease(path, false, true);
+        try {
+            filerGrpcClient.getBlockingStub().releaseLease(FilerProto.ReleaseLeaseRequest.newBuilder()
+                .setDirectory(getParentDirectory(path))
+                .setName(path.getName())
+                .setHolder(leaseHolder)
+                .build());
+        } catch (Exception ex) {
+            throw new IOException(ex);
+        }
+        return true;
+    }
+
+    private void acquireLease(final Path path, boolean create, boolean recover) throws IOException {
+        FilerProto.AcquireLeaseResponse response;
+        try {
+            response = filerGrpcClient.getBlockingStub().acquireLease(FilerProto.AcquireLeaseRequest.newBuilder()
+                .setDirectory(getParentDirectory(path))
+                .setName(path.getName())
+                .setHolder(leaseHolder)
+                .setCreate(create)
+                .setRecover(recover)
+                .build());
+        } catch (Exception ex) {
+            throw new IOException(ex);
+        }
+        if (!response.getError().isEmpty()) {
+            throw new IOException(response.getError());
+        }
+        startLeaseRenewer();
+    }
+
+    private synchronized void startLeaseRenewer() {
+        if (leaseRenewer != null) {
+            return;
+        }
+        leaseRenewer = Executors.newSingleThreadScheduledExecutor(runnable -> {
+            Thread thread = new Thread(runnable, "seaweedfs lease renewer");
+            thread.setDaemon(true);
+            return thread;
+        });
+        leaseRenewer.scheduleWithFixedDelay(() -> {
+            try {
+                filerGrpcClient.getBlockingStub().renewLease(FilerProto.RenewLeaseRequest.newBuilder()
+                    .setHolder(leaseHolder)
+                    .build());
+            } catch (Exception ex) {
+                LOG.warn("renewLease {}: {}", leaseHolder, ex);
+            }
+        }, LEASE_RENEW_SECONDS, LEASE_RENEW_SECONDS, TimeUnit.SECONDS);
     }
 
     public InputStream openFileForRead(final Path path, FileSystem.Statistics statistics,
@@ -5,6 +5,7 @@ package seaweed.hdfs;
 import com.google.common.base.Preconditions;
 import org.apache.hadoop.fs.FSExceptionMessages;
 import org.apache.hadoop.fs.Path;
+import org.apache.hadoop.fs.Syncable;
 import org.slf4j.Logger;
 import org.slf4j.LoggerFactory;
 import seaweedfs.client.ByteBufferPool;
@@ -16,11 +17,14 @@ import java.io.IOException;
 import java.io.InterruptedIOException;
 import java.io.OutputStream;
 import java.nio.ByteBuffer;
+import java.util.ArrayList;
+import java.util.Comparator;
+import java.util.List;
 import java.util.concurrent.*;
 
 import static seaweed.hdfs.SeaweedFileSystemStore.getParentDirectory;
 
-public class SeaweedOutputStream extends OutputStream {
+public class SeaweedOutputStream extends OutputStream implements Syncable {
 
     private static final Logger LOG = LoggerFactory.getLogger(SeaweedOutputStream.class);
 
@@ -41,11 +45,20 @@ public class SeaweedOutputStream extends OutputStream {
     private ByteBuffer buffer;
     private long outputIndex;
     private String replication = "000";
+    private final String leaseHolder;
+    // the written chunks are appended to the file in the order of their offsets
+    private final List<FilerProto.FileChunk> unappendedChunks = new ArrayList<>();
+    private int seenChunkCount;
+    private long appendedPosition;
 
     public SeaweedOutputStream(FilerGrpcClient filerGrpcClient, final Path path, FilerProto.Entry.Builder entry,
-                               final long position, final int bufferSize, final String replication) {
+                               final long position, final int bufferSize, final String replication,
+                               final String leaseHolder) {
         this.filerGrpcClient = filerGrpcClient;
         this.replication = replication;
+        this.leaseHolder = leaseHolder;
+        this.appendedPosition = position;
+        this.seenChunkCount = entry.getChunksCount();
         this.path = path;
         this.position = position;
         this.closed = false;
@@ -72,13 +85,55 @@ public class SeaweedOutputStream extends OutputStream {
 
     private synchronized void flushWrittenBytesToServiceInternal(final long offset) throws IOException {
         try {
-            SeaweedWrite.writeMeta(filerGrpcClient, getParentDirectory(path), entry);
+            appendWrittenChunks();
         } catch (Exception ex) {
             throw new IOException(ex);
         }
         this.lastFlushOffset = offset;
     }
 
+    /**
+     * Append the written chunks following the end of the file, under the lease of the file.
+     * The appended data is visible to the new readers.
+     */
+    private synchronized void appendWrittenChunks() throws IOException {
+        synchronized (entry) {
+            unappendedChunks.addAll(entry.getChunksList().subList(seenChunkCount, entry.getChunksCount()));
+            seenChunkCount = entry.getChunksCount();
+        }
+        unappendedChunks.sort(Comparator.comparingLong(FilerProto.FileChunk::getOffset));
+
+        int count = 0;
+        long stop = appendedPosition;
+        for (FilerProto.FileChunk chunk : unappendedChunks) {
+            if (chunk.getOffset() != stop) {
+                break;
+            }
+            stop += chunk.getSize();
+            count++;
+        }
+        if (count == 0) {
+            return;
+        }
+
+        List<FilerProto.FileChunk> chunks = unappendedChunks.subList(0, count);
+        SeaweedWrite.appendMeta(filerGrpcClient, getParentDirectory(path), path.getName(), leaseHolder, new ArrayList<>(chunks));
+        chunks.clear();
+        appendedPosition = stop;
+    }
+
+    private void releaseLease() {
+        try {
+            filerGrpcClient.getBlockingStub().releaseLease(FilerProto.ReleaseLeaseRequest.newBuilder()
+                    .setDirectory(getParentDirectory(path))
+                    .setName(path.getName())
+                    .setHolder(leaseHolder)
+                    .build());
+        } catch (Exception ex) {
+            LOG.warn("releaseLease {}: {}", path, ex);
+        }
+    }
+
     @Override
     public void write(final int byteVal) throws IOException {
         write(new byte[]{(byte) (byteVal & 0xFF)});
@@ -133,11 +188,43 @@ public class SeaweedOutputStream extends OutputStream {
         }
     }
 
+    /**
+     * Flush out the data in client's user buffer. After the return of
+     * this call, new readers will see the data.
+     *
+     * @throws IOException if any error occurs
+     */
+    @Override
+    public void hflush() throws IOException {
+        flushInternal();
+    }
+
+    /**
+     * Similar to posix fsync, flush out the data in client's user buffer
+     * all the way to the disk device (but the disk may have it in its cache).
+     *
+     * @throws IOException if error occurs
+     */
+    @Override
+    public void hsync() throws IOException {
+        flushInternal();
+    }
+
+    /**
+     * The deprecated Syncable.sync() of hadoop 2.
+     *
+     * @throws IOException if any error occurs
+     */
+    @Deprecated
+    public void sync() throws IOException {
+        hflush();
+    }
+
     /**
      * Force all data in the output stream to be written to Azure storage.
      * Wait to return until this is complete. Close the access to the stream and
      * shutdown the upload thread pool.
-     * If the blob was created, its lease will be released.
+     * The lease of the file will be released.
      * Any error encountered caught in threads and stored will be rethrown here
      * after cleanup.
      */
@@ -151,6 +238,7 @@ public class SeaweedOutputStream extends OutputStream {
         try {
             flushInternal();
             threadExecutor.shutdown();
+            releaseLease();
         } finally {
             lastError = new IOException(FSExceptionMessages.STREAM_IS_CLOSED);
             ByteBufferPool.release(buffer);
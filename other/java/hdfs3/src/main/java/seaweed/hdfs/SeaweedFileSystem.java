@@ -332,8 +332,25 @@ public class SeaweedFileSystem extends FileSystem {
      */
     @Override
     public boolean truncate(Path f, long newLength) throws IOException {
-        throw new UnsupportedOperationException("Not implemented by the " +
-                getClass().getSimpleName() + " FileSystem implementation");
+
+        LOG.debug("truncate path: {} newLength:{}", f, newLength);
+
+        return seaweedFileSystemStore.truncate(qualify(f), newLength);
+    }
+
+    /**
+     * Start the lease recovery of a file, like DistributedFileSystem.recoverLease().
+     * The lease is recovered at once, and the previous writer can not append to the file any more.
+     *
+     * @param f a file
+     * @return true if the file is already closed
+     * @throws IOException if an error occurs
+     */
+    public boolean recoverLease(Path f) throws IOException {
+
+        LOG.debug("recoverLease path: {}", f);
+
+        return seaweedFileSystemStore.recoverLease(qualify(f));
     }
 
     @Override
@@ -18,6 +18,9 @@ import java.io.IOException;
 import java.io.InterruptedIOException;
 import java.io.OutputStream;
 import java.nio.ByteBuffer;
+import java.util.ArrayList;
+import java.util.Comparator;
+import java.util.List;
 import java.util.Arrays;
 import java.util.Locale;
 import java.util.concurrent.*;
@@ -45,11 +48,20 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
     private ByteBuffer buffer;
     private long outputIndex;
     private String replication = "000";
+    private final String leaseHolder;
+    // the written chunks are appended to the file in the order of their offsets
+    private final List<FilerProto.FileChunk> unappendedChunks = new ArrayList<>();
+    private int seenChunkCount;
+    private long appendedPosition;
 
     public SeaweedOutputStream(FilerGrpcClient filerGrpcClient, final Path path, FilerProto.Entry.Builder entry,
-                               final long position, final int bufferSize, final String replication) {
+                               final long position, final int bufferSize, final String replication,
+                               final String leaseHolder) {
         this.filerGrpcClient = filerGrpcClient;
         this.replication = replication;
+        this.leaseHolder = leaseHolder;
+        this.appendedPosition = position;
+        this.seenChunkCount = entry.getChunksCount();
         this.path = path;
         this.position = position;
         this.closed = false;
@@ -76,13 +88,55 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
 
     private synchronized void flushWrittenBytesToServiceInternal(final long offset) throws IOException {
         try {
-            SeaweedWrite.writeMeta(filerGrpcClient, getParentDirectory(path), entry);
+            appendWrittenChunks();
         } catch (Exception ex) {
             throw new IOException(ex);
         }
         this.lastFlushOffset = offset;
     }
 
+    /**
+     * Append the written chunks following the end of the file, under the lease of the file.
+     * The appended data is visible to the new readers.
+     */
+    private synchronized void appendWrittenChunks() throws IOException {
+        synchronized (entry) {
+            unappendedChunks.addAll(entry.getChunksList().subList(seenChunkCount, entry.getChunksCount()));
+            seenChunkCount = entry.getChunksCount();
+        }
+        unappendedChunks.sort(Comparator.comparingLong(FilerProto.FileChunk::getOffset));
+
+        int count = 0;
+        long stop = appendedPosition;
+        for (FilerProto.FileChunk chunk : unappendedChunks) {
+            if (chunk.getOffset() != stop) {
+                break;
+            }
+            stop += chunk.getSize();
+            count++;
+        }
+        if (count == 0) {
+            return;
+        }
+
+        List<FilerProto.FileChunk> chunks = unappendedChunks.subList(0, count);
+        SeaweedWrite.appendMeta(filerGrpcClient, getParentDirectory(path), path.getName(), leaseHolder, new ArrayList<>(chunks));
+        chunks.clear();
+        appendedPosition = stop;
+    }
+
+    private void releaseLease() {
+        try {
+            filerGrpcClient.getBlockingStub().releaseLease(FilerProto.ReleaseLeaseRequest.newBuilder()
+                    .setDirectory(getParentDirectory(path))
+                    .setName(path.getName())
+                    .setHolder(leaseHolder)
+                    .build());
+        } catch (Exception ex) {
+            LOG.warn("releaseLease {}: {}", path, ex);
+        }
+    }
+
     @Override
     public void write(final int byteVal) throws IOException {
         write(new byte[]{(byte) (byteVal & 0xFF)});
@@ -145,9 +199,7 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
      */
     @Override
     public void hsync() throws IOException {
-        if (supportFlush) {
-            flushInternal();
-        }
+        flushInternal();
     }
 
     /**
@@ -158,9 +210,7 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
      */
     @Override
     public void hflush() throws IOException {
-        if (supportFlush) {
-            flushInternal();
-        }
+        flushInternal();
     }
 
     /**
@@ -174,7 +224,7 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
         switch (capability.toLowerCase(Locale.ENGLISH)) {
             case StreamCapabilities.HSYNC:
             case StreamCapabilities.HFLUSH:
-                return supportFlush;
+                return true;
             default:
                 return false;
         }
@@ -184,7 +234,7 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
      * Force all data in the output stream to be written to Azure storage.
      * Wait to return until this is complete. Close the access to the stream and
      * shutdown the upload thread pool.
-     * If the blob was created, its lease will be released.
+     * The lease of the file will be released.
      * Any error encountered caught in threads and stored will be rethrown here
      * after cleanup.
      */
@@ -198,6 +248,7 @@ public class SeaweedOutputStream extends OutputStream implements Syncable, Strea
         try {
             flushInternal();
             threadExecutor.shutdown();
+            releaseLease();
         } finally {
             lastError = new IOException(FSExceptionMessages.STREAM_IS_CLOSED);
             ByteBufferPool.release(buffer);
@@ -0,0 +1,130 @@
+package alerting
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert is what the notifiers send out, either when a condition fires or when it is resolved
+type Alert struct {
+	Rule     string    `json:"rule"`
+	Subject  string    `json:"subject"`
+	Message  string    `json:"message"`
+	Status   string    `json:"status"`
+	Since    time.Time `json:"since"`
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source,omitempty"`
+	Repeated int       `json:"repeated,omitempty"`
+}
+
+func (a Alert) key() string {
+	return a.Rule + "/" + a.Subject
+}
+
+type activeAlert struct {
+	alert      Alert
+	notifiedAt time.Time
+	seen       bool
+}
+
+// Engine tracks the active alerts. A firing alert is sent again only after the cooldown,
+// and a resolved alert is sent once the condition is gone, which also resets the cooldown.
+type Engine struct {
+	source    string
+	cooldown  time.Duration
+	notifiers []Notifier
+	active    map[string]*activeAlert
+	sync.Mutex
+}
+
+func NewEngine(source string, cooldown time.Duration, notifiers ...Notifier) *Engine {
+	return &Engine{
+		source:    source,
+		cooldown:  cooldown,
+		notifiers: notifiers,
+		active:    make(map[string]*activeAlert),
+	}
+}
+
+// Evaluate compares the current conditions with the active alerts, and returns the alerts sent out
+func (e *Engine) Evaluate(conditions []Condition, now time.Time) (sent []Alert) {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, a := range e.active {
+		a.seen = false
+	}
+
+	for _, c := range conditions {
+		alert := Alert{
+			Rule:    c.Rule,
+			Subject: c.Subject,
+			Message: c.Message,
+			Status:  StatusFiring,
+			Since:   now,
+			Time:    now,
+			Source:  e.source,
+		}
+		key := alert.key()
+		if a, found := e.active[key]; found {
+			a.seen = true
+			a.alert.Message = c.Message
+			if now.Sub(a.notifiedAt) < e.cooldown {
+				continue
+			}
+			a.alert.Repeated++
+			a.alert.Time = now
+			a.notifiedAt = now
+			sent = append(sent, a.alert)
+			continue
+		}
+		e.active[key] = &activeAlert{alert: alert, notifiedAt: now, seen: true}
+		sent = append(sent, alert)
+	}
+
+	for key, a := range e.active {
+		if a.seen {
+			continue
+		}
+		delete(e.active, key)
+		resolved := a.alert
+		resolved.Status = StatusResolved
+		resolved.Time = now
+		sent = append(sent, resolved)
+	}
+
+	sort.Slice(sent, func(i, j int) bool {
+		return sent[i].key() < sent[j].key()
+	})
+
+	for _, n := range e.notifiers {
+		for _, alert := range sent {
+			if err := n.Notify(alert); err != nil {
+				glog.Warningf("%s notify %s %s: %v", n.Name(), alert.key(), alert.Status, err)
+			}
+		}
+	}
+
+	return
+}
+
+// Active returns the alerts currently firing
+func (e *Engine) Active() (alerts []Alert) {
+	e.Lock()
+	defer e.Unlock()
+	for _, a := range e.active {
+		alerts = append(alerts, a.alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].key() < alerts[j].key()
+	})
+	return
+}
@@ -0,0 +1,127 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+)
+
+type recordingNotifier struct {
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Name() string { return "recording" }
+
+func (n *recordingNotifier) Notify(alert Alert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestEngineCooldownAndResolve(t *testing.T) {
+	n := &recordingNotifier{}
+	e := NewEngine("master", 10*time.Minute, n)
+	start := time.Unix(1600000000, 0)
+	disk := []Condition{{Rule: RuleDiskUsage, Subject: "dn1:/data", Message: "disk is 95% used"}}
+
+	steps := []struct {
+		offset     time.Duration
+		conditions []Condition
+		expected   []string
+	}{
+		{0, disk, []string{StatusFiring}},
+		{time.Minute, disk, nil},
+		{11 * time.Minute, disk, []string{StatusFiring}},
+		{12 * time.Minute, nil, []string{StatusResolved}},
+		{13 * time.Minute, disk, []string{StatusFiring}}, // the cooldown is reset once resolved
+		{14 * time.Minute, nil, []string{StatusResolved}},
+		{30 * time.Minute, disk, []string{StatusFiring}},
+	}
+
+	for i, step := range steps {
+		sent := e.Evaluate(step.conditions, start.Add(step.offset))
+		if len(sent) != len(step.expected) {
+			t.Fatalf("step %d: sent %+v, expected %v", i, sent, step.expected)
+		}
+		for j, status := range step.expected {
+			if sent[j].Status != status {
+				t.Errorf("step %d: status %s, expected %s", i, sent[j].Status, status)
+			}
+		}
+	}
+	if len(n.alerts) != 6 {
+		t.Errorf("notified %d alerts, expected 6", len(n.alerts))
+	}
+	if n.alerts[1].Repeated != 1 {
+		t.Errorf("repeated %d, expected 1", n.alerts[1].Repeated)
+	}
+}
+
+func TestCheckerRules(t *testing.T) {
+	c := NewChecker(RuleOptions{
+		DiskUsagePercent: 90,
+		ReadOnlyDuration: 5 * time.Minute,
+		ReplicaLag:       time.Hour,
+		VolumeSizeLimit:  1000,
+	})
+	topo := &master_pb.TopologyInfo{
+		DataCenterInfos: []*master_pb.DataCenterInfo{{
+			RackInfos: []*master_pb.RackInfo{{
+				DataNodeInfos: []*master_pb.DataNodeInfo{
+					{
+						Id: "dn1",
+						VolumeInfos: []*master_pb.VolumeInformationMessage{
+							{Id: 1, ReplicaPlacement: 1, Size: 100, ModifiedAtSecond: 10000},
+							{Id: 2, ReplicaPlacement: 0, Size: 100, ReadOnly: true},
+						},
+						EcShardInfos: []*master_pb.VolumeEcShardInformationMessage{
+							{Id: 3, EcIndexBits: 0x1fff},
+						},
+					},
+					{
+						Id: "dn2",
+						VolumeInfos: []*master_pb.VolumeInformationMessage{
+							{Id: 1, ReplicaPlacement: 1, Size: 100, ModifiedAtSecond: 2000},
+						},
+					},
+				},
+			}},
+		}},
+	}
+	disks := map[string][]*volume_server_pb.DiskStatus{
+		"dn1": {{Dir: "/data", PercentUsed: 95}},
+		"dn2": {{Dir: "/data", PercentUsed: 50}},
+	}
+
+	now := time.Unix(1600000000, 0)
+	rules := func(conditions []Condition) (ret []string) {
+		for _, c := range conditions {
+			ret = append(ret, c.Rule+" "+c.Subject)
+		}
+		return
+	}
+
+	first := rules(c.Check(topo, disks, now))
+	expected := []string{"disk_usage dn1:/data", "replica_lag volume 1", "ec_shard_missing ec volume 3"}
+	if len(first) != len(expected) {
+		t.Fatalf("conditions %v, expected %v", first, expected)
+	}
+	for i := range expected {
+		if first[i] != expected[i] {
+			t.Errorf("condition %d: %s, expected %s", i, first[i], expected[i])
+		}
+	}
+
+	later := rules(c.Check(topo, disks, now.Add(6*time.Minute)))
+	if len(later) != 4 || later[2] != "volume_readonly volume 2" {
+		t.Errorf("conditions %v, expected volume 2 to be read only", later)
+	}
+
+	// a missing replica
+	topo.DataCenterInfos[0].RackInfos[0].DataNodeInfos = topo.DataCenterInfos[0].RackInfos[0].DataNodeInfos[:1]
+	missing := rules(c.Check(topo, disks, now.Add(7*time.Minute)))
+	if len(missing) != 4 || missing[1] != "replica_missing volume 1" {
+		t.Errorf("conditions %v, expected volume 1 to miss a replica", missing)
+	}
+}
@@ -0,0 +1,98 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type Notifier interface {
+	Name() string
+	Notify(alert Alert) error
+}
+
+// WebhookNotifier posts each alert as json to an url
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("post %s: %s", n.url, resp.Status)
+	}
+	return nil
+}
+
+// EmailNotifier sends each alert as a plain text email
+type EmailNotifier struct {
+	address  string
+	from     string
+	to       []string
+	auth     smtp.Auth
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailNotifier uses plain auth if the user name is not empty
+func NewEmailNotifier(address, username, password, from string, to []string) *EmailNotifier {
+	n := &EmailNotifier{
+		address:  address,
+		from:     from,
+		to:       to,
+		sendMail: smtp.SendMail,
+	}
+	if username != "" {
+		host := address
+		if i := strings.LastIndex(address, ":"); i > 0 {
+			host = address[:i]
+		}
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (n *EmailNotifier) Notify(alert Alert) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: [seaweedfs %s] %s %s\r\n", alert.Status, alert.Rule, alert.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%s %s\r\n\r\n", alert.Subject, alert.Message)
+	fmt.Fprintf(&msg, "rule: %s\r\nstatus: %s\r\nsince: %v\r\n", alert.Rule, alert.Status, alert.Since.Format(time.RFC3339))
+	if alert.Source != "" {
+		fmt.Fprintf(&msg, "source: %s\r\n", alert.Source)
+	}
+	return n.sendMail(n.address, n.auth, n.from, n.to, msg.Bytes())
+}
@@ -0,0 +1,205 @@
+package alerting
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+)
+
+const (
+	RuleDiskUsage      = "disk_usage"
+	RuleVolumeReadOnly = "volume_readonly"
+	RuleReplicaMissing = "replica_missing"
+	RuleEcShardMissing = "ec_shard_missing"
+	RuleReplicaLag     = "replica_lag"
+)
+
+// Condition is a problem found in one check of the cluster
+type Condition struct {
+	Rule    string
+	Subject string
+	Message string
+}
+
+type RuleOptions struct {
+	DiskUsagePercent float64       // alert if a disk is used more than this, 0 to disable
+	ReadOnlyDuration time.Duration // alert if a volume that is not full stays read only longer than this, 0 to disable
+	ReplicaLag       time.Duration // alert if replicas of a volume were last modified this far apart, 0 to disable
+	VolumeSizeLimit  uint64
+	DisabledRules    map[string]bool
+}
+
+// Checker evaluates the rules against the cluster state.
+// It remembers since when the volumes are read only.
+type Checker struct {
+	options       RuleOptions
+	readOnlySince map[uint32]time.Time
+}
+
+func NewChecker(options RuleOptions) *Checker {
+	return &Checker{
+		options:       options,
+		readOnlySince: make(map[uint32]time.Time),
+	}
+}
+
+func (c *Checker) isEnabled(rule string) bool {
+	return !c.options.DisabledRules[rule]
+}
+
+// Check returns the conditions found in the topology and the disk statuses of each volume server
+func (c *Checker) Check(topo *master_pb.TopologyInfo, disks map[string][]*volume_server_pb.DiskStatus, now time.Time) (conditions []Condition) {
+
+	if c.isEnabled(RuleDiskUsage) && c.options.DiskUsagePercent > 0 {
+		conditions = append(conditions, c.checkDiskUsage(disks)...)
+	}
+
+	volumeLocations := make(map[uint32][]*master_pb.VolumeInformationMessage)
+	volumeServers := make(map[uint32][]string)
+	ecShards := make(map[uint32]erasure_coding.ShardBits)
+	ecCollections := make(map[uint32]string)
+	for _, dc := range topo.DataCenterInfos {
+		for _, rack := range dc.RackInfos {
+			for _, dn := range rack.DataNodeInfos {
+				for _, v := range dn.VolumeInfos {
+					volumeLocations[v.Id] = append(volumeLocations[v.Id], v)
+					volumeServers[v.Id] = append(volumeServers[v.Id], dn.Id)
+				}
+				for _, ecShardInfo := range dn.EcShardInfos {
+					ecShards[ecShardInfo.Id] = ecShards[ecShardInfo.Id].Plus(erasure_coding.ShardBits(ecShardInfo.EcIndexBits))
+					ecCollections[ecShardInfo.Id] = ecShardInfo.Collection
+				}
+			}
+		}
+	}
+
+	var vids []uint32
+	for vid := range volumeLocations {
+		vids = append(vids, vid)
+	}
+	sort.Slice(vids, func(i, j int) bool { return vids[i] < vids[j] })
+
+	for _, vid := range vids {
+		replicas := volumeLocations[vid]
+		subject := fmt.Sprintf("volume %d", vid)
+
+		if c.isEnabled(RuleReplicaMissing) {
+			if replicaPlacement, err := super_block.NewReplicaPlacementFromByte(byte(replicas[0].ReplicaPlacement)); err == nil {
+				if len(replicas) < replicaPlacement.GetCopyCount() {
+					conditions = append(conditions, Condition{
+						Rule:    RuleReplicaMissing,
+						Subject: subject,
+						Message: fmt.Sprintf("has %d of %d replicas required by %s, on %v", len(replicas), replicaPlacement.GetCopyCount(), replicaPlacement, volumeServers[vid]),
+					})
+				}
+			}
+		}
+
+		if c.isEnabled(RuleVolumeReadOnly) && c.options.ReadOnlyDuration > 0 {
+			if condition, found := c.checkReadOnly(vid, replicas, volumeServers[vid], now); found {
+				conditions = append(conditions, condition)
+			}
+		}
+
+		if c.isEnabled(RuleReplicaLag) && c.options.ReplicaLag > 0 && len(replicas) > 1 {
+			oldest, newest := replicas[0].ModifiedAtSecond, replicas[0].ModifiedAtSecond
+			for _, v := range replicas {
+				if v.ModifiedAtSecond < oldest {
+					oldest = v.ModifiedAtSecond
+				}
+				if v.ModifiedAtSecond > newest {
+					newest = v.ModifiedAtSecond
+				}
+			}
+			if lag := time.Duration(newest-oldest) * time.Second; lag > c.options.ReplicaLag {
+				conditions = append(conditions, Condition{
+					Rule:    RuleReplicaLag,
+					Subject: subject,
+					Message: fmt.Sprintf("replicas on %v were last modified %v apart", volumeServers[vid], lag),
+				})
+			}
+		}
+	}
+
+	// forget the volumes that are gone or writable again
+	for vid := range c.readOnlySince {
+		if _, found := volumeLocations[vid]; !found {
+			delete(c.readOnlySince, vid)
+		}
+	}
+
+	if c.isEnabled(RuleEcShardMissing) {
+		var ecVids []uint32
+		for vid := range ecShards {
+			ecVids = append(ecVids, vid)
+		}
+		sort.Slice(ecVids, func(i, j int) bool { return ecVids[i] < ecVids[j] })
+		for _, vid := range ecVids {
+			if count := ecShards[vid].ShardIdCount(); count < erasure_coding.TotalShardsCount {
+				conditions = append(conditions, Condition{
+					Rule:    RuleEcShardMissing,
+					Subject: fmt.Sprintf("ec volume %d", vid),
+					Message: fmt.Sprintf("collection %q has %d of %d shards: %v", ecCollections[vid], count, erasure_coding.TotalShardsCount, ecShards[vid].ShardIds()),
+				})
+			}
+		}
+	}
+
+	return
+}
+
+func (c *Checker) checkDiskUsage(disks map[string][]*volume_server_pb.DiskStatus) (conditions []Condition) {
+	var servers []string
+	for server := range disks {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		for _, disk := range disks[server] {
+			if float64(disk.PercentUsed) > c.options.DiskUsagePercent {
+				conditions = append(conditions, Condition{
+					Rule:    RuleDiskUsage,
+					Subject: fmt.Sprintf("%s:%s", server, disk.Dir),
+					Message: fmt.Sprintf("disk is %.1f%% used, %d bytes free", disk.PercentUsed, disk.Free),
+				})
+			}
+		}
+	}
+	return
+}
+
+func (c *Checker) checkReadOnly(vid uint32, replicas []*master_pb.VolumeInformationMessage, servers []string, now time.Time) (Condition, bool) {
+	var readOnlyServers []string
+	isFull := false
+	for i, v := range replicas {
+		if v.ReadOnly {
+			readOnlyServers = append(readOnlyServers, servers[i])
+		}
+		if c.options.VolumeSizeLimit > 0 && v.Size >= c.options.VolumeSizeLimit {
+			isFull = true
+		}
+	}
+	if len(readOnlyServers) == 0 || isFull {
+		delete(c.readOnlySince, vid)
+		return Condition{}, false
+	}
+
+	since, found := c.readOnlySince[vid]
+	if !found {
+		c.readOnlySince[vid] = now
+		return Condition{}, false
+	}
+	if now.Sub(since) < c.options.ReadOnlyDuration {
+		return Condition{}, false
+	}
+	return Condition{
+		Rule:    RuleVolumeReadOnly,
+		Subject: fmt.Sprintf("volume %d", vid),
+		Message: fmt.Sprintf("is read only on %v for %v, but not full", readOnlyServers, now.Sub(since).Round(time.Second)),
+	}, true
+}
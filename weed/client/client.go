@@ -0,0 +1,160 @@
+// Package client is the Go client to read and write files on SeaweedFS volume servers.
+//
+// It keeps connected to the masters for the volume locations, uploads small files in one piece,
+// uploads large files in chunks in parallel with a chunk manifest, and retries failed uploads on newly assigned volumes.
+// Files are read from any of their replicas, and the chunked files are streamed by the volume servers.
+//
+//	c := client.New(&client.Option{Masters: []string{"localhost:9333"}})
+//	result, err := c.Put(ctx, "hello.txt", strings.NewReader("hello"))
+//	reader, err := c.Get(ctx, result.FileId)
+//	err = c.Delete(ctx, result.FileId)
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
+)
+
+type Option struct {
+	Masters        []string
+	GrpcDialOption grpc.DialOption // defaults to grpc.WithInsecure()
+	Collection     string
+	Replication    string
+	Ttl            string
+	DataCenter     string
+	ChunkSizeMB    int // files larger than this are uploaded in chunks, defaults to 8
+	Concurrency    int // chunks uploaded at the same time, defaults to 4
+	Retries        int // attempts of each upload, defaults to 3
+}
+
+type Client struct {
+	option       Option
+	masterClient *wdclient.MasterClient
+}
+
+// New starts keeping connected to the masters. The client is meant to be shared for the lifetime of the process.
+func New(option *Option) *Client {
+	c := &Client{option: *option}
+	if c.option.GrpcDialOption == nil {
+		c.option.GrpcDialOption = grpc.WithInsecure()
+	}
+	if c.option.ChunkSizeMB <= 0 {
+		c.option.ChunkSizeMB = 8
+	}
+	if c.option.Concurrency <= 0 {
+		c.option.Concurrency = 4
+	}
+	if c.option.Retries <= 0 {
+		c.option.Retries = 3
+	}
+	c.masterClient = wdclient.NewMasterClient(c.option.GrpcDialOption, "client", "", 0, c.option.Masters)
+	go c.masterClient.KeepConnectedToMaster()
+	return c
+}
+
+// WaitUntilConnected waits for the connection to the leader master, or until the ctx is done
+func (c *Client) WaitUntilConnected(ctx context.Context) error {
+	for c.masterClient.GetMaster() == "" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+type assignment struct {
+	fileId string
+	url    string
+	auth   string
+}
+
+func (c *Client) assign(ctx context.Context) (*assignment, error) {
+	if err := c.WaitUntilConnected(ctx); err != nil {
+		return nil, err
+	}
+	var ret *assignment
+	err := c.masterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err := client.Assign(ctx, &master_pb.AssignRequest{
+			Count:       1,
+			Replication: c.option.Replication,
+			Collection:  c.option.Collection,
+			Ttl:         c.option.Ttl,
+			DataCenter:  c.option.DataCenter,
+		})
+		if err != nil {
+			return err
+		}
+		if resp.Error != "" {
+			return fmt.Errorf("assign: %s", resp.Error)
+		}
+		ret = &assignment{fileId: resp.Fid, url: resp.Url, auth: resp.Auth}
+		return nil
+	})
+	return ret, err
+}
+
+// lookup returns the urls of all the replicas of the file
+func (c *Client) lookup(ctx context.Context, fileId string) ([]string, error) {
+	commaIndex := strings.Index(fileId, ",")
+	if commaIndex <= 0 {
+		return nil, fmt.Errorf("invalid file id %s", fileId)
+	}
+	vid, err := strconv.ParseUint(fileId[:commaIndex], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file id %s: %v", fileId, err)
+	}
+	if err = c.WaitUntilConnected(ctx); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	if locations, found := c.masterClient.GetLocations(uint32(vid)); found {
+		for _, loc := range locations {
+			urls = append(urls, "http://"+loc.Url+"/"+fileId)
+		}
+	}
+	if len(urls) > 0 {
+		return urls, nil
+	}
+
+	// the volume may be just created
+	err = c.masterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err := master_pb.LookupVolumes(ctx, client, &master_pb.LookupVolumeRequest{VolumeIds: []string{fileId[:commaIndex]}})
+		if err != nil {
+			return err
+		}
+		for _, vl := range resp.VolumeIdLocations {
+			if vl.Error != "" {
+				return fmt.Errorf("lookup %s: %s", fileId, vl.Error)
+			}
+			for _, loc := range vl.Locations {
+				urls = append(urls, "http://"+loc.Url+"/"+fileId)
+			}
+		}
+		return nil
+	})
+	if err == nil && len(urls) == 0 {
+		err = fmt.Errorf("volume of %s not found", fileId)
+	}
+	return urls, err
+}
+
+// sleep waits before the next attempt, longer after each failure
+func sleep(ctx context.Context, attempt int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(attempt*attempt) * 100 * time.Millisecond):
+		return nil
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// testMaster assigns the file ids of one volume, which is on all the volume servers
+type testMaster struct {
+	master_pb.UnimplementedSeaweedServer
+	volumeId   uint32
+	volumeUrls []string
+
+	sync.Mutex
+	fileKey     uint64
+	failAssigns int
+}
+
+func (m *testMaster) KeepConnected(stream master_pb.Seaweed_KeepConnectedServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return nil
+		}
+	}
+}
+
+func (m *testMaster) Assign(ctx context.Context, req *master_pb.AssignRequest) (*master_pb.AssignResponse, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.failAssigns > 0 {
+		m.failAssigns--
+		return &master_pb.AssignResponse{Error: "no writable volumes"}, nil
+	}
+	m.fileKey++
+	return &master_pb.AssignResponse{
+		Fid:   fmt.Sprintf("%d,%x%08x", m.volumeId, m.fileKey, 0x12345678),
+		Url:   m.volumeUrls[0],
+		Count: 1,
+	}, nil
+}
+
+func (m *testMaster) LookupVolume(ctx context.Context, req *master_pb.LookupVolumeRequest) (*master_pb.LookupVolumeResponse, error) {
+	resp := &master_pb.LookupVolumeResponse{}
+	for _, vid := range req.VolumeIds {
+		vl := &master_pb.LookupVolumeResponse_VolumeIdLocation{VolumeId: vid}
+		for _, url := range m.volumeUrls {
+			vl.Locations = append(vl.Locations, &master_pb.Location{Url: url, PublicUrl: url})
+		}
+		resp.VolumeIdLocations = append(resp.VolumeIdLocations, vl)
+	}
+	return resp, nil
+}
+
+// serveGrpc listens on a random port, and returns the http address of the server, which is 10000 below the grpc port
+func serveGrpc(t *testing.T, register func(*grpc.Server)) (*grpc.Server, string) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if port <= 10000 {
+		listener.Close()
+		t.Skipf("grpc port %d is too low to derive the http port", port)
+	}
+	grpcServer := grpc.NewServer()
+	register(grpcServer)
+	go grpcServer.Serve(listener)
+	return grpcServer, fmt.Sprintf("localhost:%d", port-10000)
+}
+
+type testFile struct {
+	data       []byte
+	isManifest bool
+}
+
+// testVolumeServer keeps the uploaded files in memory,
+// and reads a chunked file with its chunk manifest, as the volume server does
+type testVolumeServer struct {
+	sync.Mutex
+	files         map[string]*testFile
+	failUploads   int
+	failManifests bool
+	failReads     bool
+}
+
+func newTestVolumeServer() (*testVolumeServer, *httptest.Server) {
+	vs := &testVolumeServer{files: make(map[string]*testFile)}
+	return vs, httptest.NewServer(vs)
+}
+
+func (vs *testVolumeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fileId := strings.TrimPrefix(r.URL.Path, "/")
+	vs.Lock()
+	defer vs.Unlock()
+	switch r.Method {
+	case "POST":
+		isManifest := r.URL.Query().Get("cm") == "true"
+		if vs.failUploads > 0 || isManifest && vs.failManifests {
+			if vs.failUploads > 0 {
+				vs.failUploads--
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		part, err := readUploadedPart(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		vs.files[fileId] = &testFile{data: part, isManifest: isManifest}
+		json.NewEncoder(w).Encode(&operation.UploadResult{Size: uint32(len(part)), ETag: fmt.Sprintf("%x", len(part))})
+	case "GET":
+		if vs.failReads {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		file, found := vs.files[fileId]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !file.isManifest {
+			w.Write(file.data)
+			return
+		}
+		cm, err := operation.LoadChunkManifest(file.data, false)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sort.Slice(cm.Chunks, func(i, j int) bool { return cm.Chunks[i].Offset < cm.Chunks[j].Offset })
+		for _, chunk := range cm.Chunks {
+			w.Write(vs.files[chunk.Fid].data)
+		}
+	case "DELETE":
+		delete(vs.files, fileId)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func readUploadedPart(r *http.Request) ([]byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil {
+		return nil, err
+	}
+	if part.Header.Get("Content-Encoding") == "gzip" {
+		return util.DecompressData(data)
+	}
+	return data, nil
+}
+
+// newTestClient starts a master with the volume servers, and a client connected to it
+func newTestClient(t *testing.T, option *Option, volumeServers ...*httptest.Server) (*Client, *testMaster, func()) {
+	master := &testMaster{volumeId: 3}
+	for _, server := range volumeServers {
+		master.volumeUrls = append(master.volumeUrls, strings.TrimPrefix(server.URL, "http://"))
+	}
+	grpcServer, masterUrl := serveGrpc(t, func(s *grpc.Server) { master_pb.RegisterSeaweedServer(s, master) })
+	option.Masters = []string{masterUrl}
+	return New(option), master, grpcServer.Stop
+}
@@ -0,0 +1,377 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+// EcWriter writes write-once archival files into a local volume, and erasure codes the volume
+// to the servers of its ec shards when it is full or flushed, instead of uploading the files
+// to replicated volumes and encoding them later with ec.encode.
+// The files can be read after the volume is flushed.
+type EcWriter struct {
+	c               *Client
+	dir             string
+	volumeSizeLimit int64
+
+	sync.Mutex
+	volume    *localEcVolume   // the volume being written
+	unflushed []*localEcVolume // the full volumes failed to flush, sent again by Flush
+}
+
+// localEcVolume is a volume written in the local dir, until it is erasure coded to the volume servers
+type localEcVolume struct {
+	volumeId       needle.VolumeId
+	collection     string
+	shardLocations []*master_pb.Location
+	baseFileName   string
+	datFile        backend.BackendStorageFile
+	idxFile        *os.File
+	nextKey        uint64
+	fileIds        []string
+	isEncoded      bool
+}
+
+// EcFlushError lists the files of the local volumes failed to be erasure coded to the volume servers.
+// These files are not readable. The local volumes are kept, and sent again by the next Flush.
+type EcFlushError struct {
+	FileIds []string
+	Errors  []error
+}
+
+func (e *EcFlushError) Error() string {
+	var messages []string
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d files not flushed: %s", len(e.FileIds), strings.Join(messages, "; "))
+}
+
+// NewEcWriter writes the local volumes in the dir, with at most volumeSizeLimitMB each
+func (c *Client) NewEcWriter(dir string, volumeSizeLimitMB int) *EcWriter {
+	return &EcWriter{
+		c:               c,
+		dir:             dir,
+		volumeSizeLimit: int64(volumeSizeLimitMB) * 1024 * 1024,
+	}
+}
+
+// Write adds the file to the local volume. If the file does not fit, the volume is flushed first,
+// and kept for the next Flush if that fails.
+func (w *EcWriter) Write(ctx context.Context, filename string, data []byte) (*PutResult, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	filename = path.Base(filename)
+	n := &needle.Needle{
+		Cookie:       types.Cookie(rand.Uint32()),
+		Data:         data,
+		LastModified: uint64(time.Now().Unix()),
+		AppendAtNs:   uint64(time.Now().UnixNano()),
+	}
+	n.SetHasLastModifiedDate()
+	if len(filename) < 256 {
+		n.Name = []byte(filename)
+		n.SetHasName()
+	}
+	if mtype := mime.TypeByExtension(path.Ext(filename)); mtype != "" && len(mtype) < 256 {
+		n.Mime = []byte(mtype)
+		n.SetHasMime()
+	}
+	n.Checksum = needle.NewCRC(data)
+
+	if v := w.volume; v != nil {
+		datSize, _, _ := v.datFile.GetStat()
+		if datSize+needle.GetActualSize(uint32(len(data)), needle.CurrentVersion)+int64(len(n.Name)+len(n.Mime)) > w.volumeSizeLimit {
+			w.volume = nil
+			if err := w.flushVolume(ctx, v); err != nil {
+				glog.Warningf("%v, the local volume is kept to flush again", err)
+				w.unflushed = append(w.unflushed, v)
+			}
+		}
+	}
+	if w.volume == nil {
+		v, err := w.createVolume(ctx)
+		if err != nil {
+			return nil, err
+		}
+		w.volume = v
+	}
+
+	v := w.volume
+	v.nextKey++
+	n.Id = types.Uint64ToNeedleId(v.nextKey)
+	offset, _, _, err := n.Append(v.datFile, needle.CurrentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("write %s to %s.dat: %v", filename, v.baseFileName, err)
+	}
+	if _, err = v.idxFile.Write(needle_map.ToBytes(n.Id, types.ToOffset(int64(offset)), n.Size)); err != nil {
+		return nil, fmt.Errorf("write %s to %s.idx: %v", filename, v.baseFileName, err)
+	}
+
+	fileId := needle.NewFileId(v.volumeId, v.nextKey, uint32(n.Cookie)).String()
+	v.fileIds = append(v.fileIds, fileId)
+	return &PutResult{
+		FileId: fileId,
+		Size:   int64(len(data)),
+		ETag:   n.Etag(),
+	}, nil
+}
+
+// Flush erasure codes the local volumes to the servers of the ec shards, and removes the local volumes.
+// If some volumes fail, the error is an *EcFlushError with all the files in these volumes.
+func (w *EcWriter) Flush(ctx context.Context) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.volume != nil {
+		w.unflushed = append(w.unflushed, w.volume)
+		w.volume = nil
+	}
+	var failed []*localEcVolume
+	flushErr := &EcFlushError{}
+	for _, v := range w.unflushed {
+		if err := w.flushVolume(ctx, v); err != nil {
+			failed = append(failed, v)
+			flushErr.FileIds = append(flushErr.FileIds, v.fileIds...)
+			flushErr.Errors = append(flushErr.Errors, err)
+		}
+	}
+	w.unflushed = failed
+	if len(failed) > 0 {
+		return flushErr
+	}
+	return nil
+}
+
+func (w *EcWriter) createVolume(ctx context.Context) (*localEcVolume, error) {
+	if err := w.c.WaitUntilConnected(ctx); err != nil {
+		return nil, err
+	}
+	var resp *master_pb.AssignEcVolumeResponse
+	err := w.c.masterClient.WithClient(func(client master_pb.SeaweedClient) (err error) {
+		resp, err = client.AssignEcVolume(ctx, &master_pb.AssignEcVolumeRequest{
+			Collection: w.c.option.Collection,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("assign ec volume: %v", err)
+	}
+	if len(resp.ShardLocations) != erasure_coding.TotalShardsCount {
+		return nil, fmt.Errorf("assigned %d ec shard locations", len(resp.ShardLocations))
+	}
+
+	v := &localEcVolume{
+		volumeId:       needle.VolumeId(resp.VolumeId),
+		collection:     w.c.option.Collection,
+		shardLocations: resp.ShardLocations,
+	}
+	v.baseFileName = storage.VolumeFileName(w.dir, v.collection, int(v.volumeId))
+	datFile, err := os.OpenFile(v.baseFileName+".dat", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	superBlock := super_block.SuperBlock{
+		Version:          needle.CurrentVersion,
+		ReplicaPlacement: &super_block.ReplicaPlacement{},
+		Ttl:              needle.EMPTY_TTL,
+	}
+	if _, err = datFile.Write(superBlock.Bytes()); err != nil {
+		datFile.Close()
+		return nil, err
+	}
+	if v.idxFile, err = os.OpenFile(v.baseFileName+".idx", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		datFile.Close()
+		return nil, err
+	}
+	v.datFile = backend.NewDiskFile(datFile)
+	return v, nil
+}
+
+// flushVolume encodes the volume once, and sends the ec shards to the servers.
+// On failures, the shards already sent are deleted from the servers, so the local volume can be flushed again.
+func (w *EcWriter) flushVolume(ctx context.Context, v *localEcVolume) error {
+	if err := v.encode(); err != nil {
+		return err
+	}
+
+	serverShardIds := make(map[string][]uint32)
+	for shardId, location := range v.shardLocations {
+		serverShardIds[location.Url] = append(serverShardIds[location.Url], uint32(shardId))
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var sendErr error
+	var receivedServers []string
+	for server, shardIds := range serverShardIds {
+		wg.Add(1)
+		go func(server string, shardIds []uint32) {
+			defer wg.Done()
+			err := w.sendShards(ctx, v, server, shardIds)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				sendErr = fmt.Errorf("send ec volume %d shards %v to %s: %v", v.volumeId, shardIds, server, err)
+			} else {
+				receivedServers = append(receivedServers, server)
+			}
+		}(server, shardIds)
+	}
+	wg.Wait()
+	if sendErr != nil {
+		// the servers failed to receive have removed the partial files themselves
+		for _, server := range receivedServers {
+			w.deleteShards(v, server, serverShardIds[server], false)
+		}
+		return sendErr
+	}
+
+	for server, shardIds := range serverShardIds {
+		err := operation.WithVolumeServerClient(server, w.c.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			_, err := client.VolumeEcShardsMount(ctx, &volume_server_pb.VolumeEcShardsMountRequest{
+				VolumeId:   uint32(v.volumeId),
+				Collection: v.collection,
+				ShardIds:   shardIds,
+			})
+			return err
+		})
+		if err != nil {
+			for server, shardIds := range serverShardIds {
+				w.deleteShards(v, server, shardIds, true)
+			}
+			return fmt.Errorf("mount ec volume %d shards %v on %s: %v", v.volumeId, shardIds, server, err)
+		}
+	}
+	glog.V(1).Infof("flushed ec volume %d to %d servers", v.volumeId, len(serverShardIds))
+	v.remove()
+	return nil
+}
+
+// encode generates the .ecx, .vif and the ec shards locally, keeping the .dat and .idx files
+func (v *localEcVolume) encode() error {
+	if v.isEncoded {
+		return nil
+	}
+	if v.datFile != nil {
+		v.datFile.Close()
+		v.idxFile.Close()
+		v.datFile, v.idxFile = nil, nil
+	}
+	if err := erasure_coding.WriteEcFiles(v.baseFileName, nil); err != nil {
+		return fmt.Errorf("generate ec shards of %s: %v", v.baseFileName, err)
+	}
+	if err := erasure_coding.WriteSortedFileFromIdx(v.baseFileName, ".ecx"); err != nil {
+		return fmt.Errorf("generate %s.ecx: %v", v.baseFileName, err)
+	}
+	if err := pb.SaveVolumeInfo(v.baseFileName+".vif", &volume_server_pb.VolumeInfo{Version: uint32(needle.CurrentVersion)}); err != nil {
+		return fmt.Errorf("save %s.vif: %v", v.baseFileName, err)
+	}
+	v.isEncoded = true
+	return nil
+}
+
+// sendShards sends the .ecx and .vif files, and then the shards to the server
+func (w *EcWriter) sendShards(ctx context.Context, v *localEcVolume, server string, shardIds []uint32) error {
+	exts := []string{".ecx", ".vif"}
+	for _, shardId := range shardIds {
+		exts = append(exts, erasure_coding.ToExt(int(shardId)))
+	}
+	return operation.WithVolumeServerClient(server, w.c.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+		stream, err := client.VolumeEcShardsReceive(ctx)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, 1024*1024)
+		for _, ext := range exts {
+			if err = v.sendFile(stream, ext, buf); err == io.EOF {
+				// the server has stopped receiving, and the reason is in the response
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	})
+}
+
+func (v *localEcVolume) sendFile(stream volume_server_pb.VolumeServer_VolumeEcShardsReceiveClient, ext string, buf []byte) error {
+	f, err := os.Open(v.baseFileName + ext)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for sent := false; ; sent = true {
+		n, readErr := f.Read(buf)
+		if n > 0 || !sent {
+			if err = stream.Send(&volume_server_pb.VolumeEcShardsReceiveRequest{
+				VolumeId:    uint32(v.volumeId),
+				Collection:  v.collection,
+				Ext:         ext,
+				FileContent: buf[:n],
+			}); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func (w *EcWriter) deleteShards(v *localEcVolume, server string, shardIds []uint32, isMounted bool) {
+	err := operation.WithVolumeServerClient(server, w.c.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+		if isMounted {
+			// the shards not mounted yet fail to unmount, and are deleted anyway
+			client.VolumeEcShardsUnmount(context.Background(), &volume_server_pb.VolumeEcShardsUnmountRequest{
+				VolumeId: uint32(v.volumeId),
+				ShardIds: shardIds,
+			})
+		}
+		_, err := client.VolumeEcShardsDelete(context.Background(), &volume_server_pb.VolumeEcShardsDeleteRequest{
+			VolumeId:   uint32(v.volumeId),
+			Collection: v.collection,
+			ShardIds:   shardIds,
+		})
+		return err
+	})
+	if err != nil {
+		glog.V(0).Infof("delete ec volume %d shards %v on %s: %v", v.volumeId, shardIds, server, err)
+	}
+}
+
+func (v *localEcVolume) remove() {
+	for _, ext := range []string{".dat", ".idx", ".ecx", ".vif"} {
+		os.Remove(v.baseFileName + ext)
+	}
+	for i := 0; i < erasure_coding.TotalShardsCount; i++ {
+		os.Remove(v.baseFileName + erasure_coding.ToExt(i))
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// Get streams the content of the file. The replicas are tried in turn until one of them starts to respond.
+// The caller should close the reader.
+func (c *Client) Get(ctx context.Context, fileId string) (io.ReadCloser, error) {
+	urls, err := c.lookup(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileUrl := range urls {
+		var req *http.Request
+		if req, err = http.NewRequest("GET", fileUrl, nil); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept-Encoding", "identity")
+		var resp *http.Response
+		if resp, err = util.Do(req.WithContext(ctx)); err != nil {
+			continue
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return resp.Body, nil
+		case resp.StatusCode == http.StatusNotFound:
+			util.CloseResponse(resp)
+			return nil, fmt.Errorf("%s not found", fileId)
+		default:
+			util.CloseResponse(resp)
+			err = fmt.Errorf("read %s: %s", fileUrl, resp.Status)
+		}
+	}
+	return nil, err
+}
+
+// Delete deletes the files. The chunks of a chunked file are deleted by the volume server with the chunk manifest.
+func (c *Client) Delete(ctx context.Context, fileIds ...string) error {
+	var lastErr error
+	for _, fileId := range fileIds {
+		if err := c.delete(ctx, fileId); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) delete(ctx context.Context, fileId string) error {
+	urls, err := c.lookup(ctx, fileId)
+	if err != nil {
+		return err
+	}
+	jwt := operation.LookupJwt(c.masterClient.GetMaster(), fileId)
+	// the volume server deletes the file from the other replicas
+	for _, fileUrl := range urls {
+		var req *http.Request
+		if req, err = http.NewRequest("DELETE", fileUrl, nil); err != nil {
+			return err
+		}
+		if jwt != "" {
+			req.Header.Set("Authorization", "BEARER "+string(jwt))
+		}
+		var resp *http.Response
+		if resp, err = util.Do(req.WithContext(ctx)); err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		util.CloseResponse(resp)
+		switch resp.StatusCode {
+		case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+			return nil
+		}
+		err = fmt.Errorf("delete %s: %s %s", fileUrl, resp.Status, body)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetFromReplicas(t *testing.T) {
+	failing, failingServer := newTestVolumeServer()
+	defer failingServer.Close()
+	vs, volumeServer := newTestVolumeServer()
+	defer volumeServer.Close()
+	_, stoppedServer := newTestVolumeServer()
+	stoppedServer.Close()
+	c, _, stop := newTestClient(t, &Option{}, stoppedServer, failingServer, volumeServer)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// the replica not responding, and the one failing to read, are skipped
+	failing.failReads = true
+	fileId := "3,0112345678"
+	vs.files[fileId] = &testFile{data: []byte("hello")}
+	reader, err := c.Get(ctx, fileId)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "hello" {
+		t.Errorf("get %q: %v", data, err)
+	}
+
+	// a replica without the file means it is deleted
+	failing.failReads = false
+	if _, err = c.Get(ctx, fileId); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("get from a replica without the file: %v", err)
+	}
+
+	failing.failReads = true
+	delete(vs.files, fileId)
+	vs.failReads = true
+	if _, err = c.Get(ctx, fileId); err == nil {
+		t.Errorf("get with all the replicas failing")
+	}
+}
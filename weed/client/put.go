@@ -0,0 +1,156 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/security"
+)
+
+type PutResult struct {
+	FileId string
+	Size   int64
+	ETag   string // not set for chunked files
+}
+
+// Put uploads the content of the reader as one file.
+// If it is larger than the chunk size, the chunks are uploaded in parallel, and then the chunk manifest as the file.
+func (c *Client) Put(ctx context.Context, filename string, reader io.Reader) (*PutResult, error) {
+	chunkSize := int64(c.option.ChunkSizeMB) * 1024 * 1024
+	filename = path.Base(filename)
+
+	first, err := readChunk(reader, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(first)) < chunkSize {
+		fileId, uploadResult, err := c.upload(ctx, filename, first, false)
+		if err != nil {
+			return nil, err
+		}
+		return &PutResult{FileId: fileId, Size: int64(len(first)), ETag: uploadResult.ETag}, nil
+	}
+
+	cm := &operation.ChunkManifest{Name: filename}
+	err = c.uploadChunks(ctx, filename, first, reader, chunkSize, cm)
+	if err == nil {
+		var data []byte
+		if data, err = cm.Marshal(); err == nil {
+			var fileId string
+			if fileId, _, err = c.upload(ctx, filename, data, true); err == nil {
+				return &PutResult{FileId: fileId, Size: cm.Size}, nil
+			}
+		}
+	}
+
+	// delete the uploaded chunks
+	var fileIds []string
+	for _, chunk := range cm.Chunks {
+		fileIds = append(fileIds, chunk.Fid)
+	}
+	if deleteErr := c.Delete(context.Background(), fileIds...); deleteErr != nil {
+		glog.V(0).Infof("delete chunks of failed upload %s: %v", filename, deleteErr)
+	}
+	return nil, err
+}
+
+// uploadChunks reads the chunks one by one, and uploads at most Concurrency chunks at the same time
+func (c *Client) uploadChunks(ctx context.Context, filename string, first []byte, reader io.Reader, chunkSize int64, cm *operation.ChunkManifest) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var uploadErr error
+	limiter := make(chan struct{}, c.option.Concurrency)
+
+	data, offset := first, int64(0)
+	for len(data) > 0 {
+		limiter <- struct{}{}
+		lock.Lock()
+		failed := uploadErr != nil
+		lock.Unlock()
+		if failed {
+			break
+		}
+
+		wg.Add(1)
+		go func(offset int64, data []byte) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			part := fmt.Sprintf("%s-%d", filename, offset/chunkSize+1)
+			fileId, _, err := c.upload(ctx, part, data, false)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				if uploadErr == nil {
+					uploadErr = err
+					cancel()
+				}
+				return
+			}
+			cm.Chunks = append(cm.Chunks, &operation.ChunkInfo{Fid: fileId, Offset: offset, Size: int64(len(data))})
+			cm.Size += int64(len(data))
+		}(offset, data)
+
+		if int64(len(data)) < chunkSize {
+			break
+		}
+		offset += int64(len(data))
+		next, err := readChunk(reader, chunkSize)
+		if err != nil {
+			lock.Lock()
+			if uploadErr == nil {
+				uploadErr = err
+			}
+			lock.Unlock()
+			break
+		}
+		data = next
+	}
+	wg.Wait()
+	return uploadErr
+}
+
+// upload assigns a file id and uploads the data, and tries again with another file id after failures
+func (c *Client) upload(ctx context.Context, filename string, data []byte, isManifest bool) (fileId string, uploadResult *operation.UploadResult, err error) {
+	for attempt := 1; attempt <= c.option.Retries; attempt++ {
+		if attempt > 1 {
+			if sleepErr := sleep(ctx, attempt-1); sleepErr != nil {
+				return "", nil, err
+			}
+		}
+		var assigned *assignment
+		if assigned, err = c.assign(ctx); err != nil {
+			glog.V(1).Infof("assign %s attempt %d: %v", filename, attempt, err)
+			continue
+		}
+		uploadUrl, mtype := "http://"+assigned.url+"/"+assigned.fileId, ""
+		if isManifest {
+			uploadUrl, mtype = uploadUrl+"?cm=true", "application/json"
+		}
+		uploadResult, err = operation.UploadDataWithContext(ctx, uploadUrl, filename, false, data, false, mtype, nil, security.EncodedJwt(assigned.auth))
+		if err == nil {
+			return assigned.fileId, uploadResult, nil
+		}
+		glog.V(1).Infof("upload %s to %s attempt %d: %v", filename, uploadUrl, attempt, err)
+	}
+	return "", nil, err
+}
+
+// readChunk reads up to chunkSize bytes, and a short chunk means the end of the reader
+func readChunk(reader io.Reader, chunkSize int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, reader, chunkSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
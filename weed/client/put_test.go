@@ -0,0 +1,121 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+)
+
+func TestReadChunk(t *testing.T) {
+	reader := bytes.NewReader(make([]byte, 25))
+	var sizes []int
+	for {
+		data, err := readChunk(reader, 10)
+		if err != nil {
+			t.Fatalf("read chunk: %v", err)
+		}
+		sizes = append(sizes, len(data))
+		if len(data) < 10 {
+			break
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 10 || sizes[1] != 10 || sizes[2] != 5 {
+		t.Fatalf("chunk sizes: %v", sizes)
+	}
+
+	// the chunk after the exact multiple of the chunk size is empty
+	data, err := readChunk(bytes.NewReader(nil), 10)
+	if err != nil || len(data) != 0 {
+		t.Fatalf("read empty chunk: %d %v", len(data), err)
+	}
+}
+
+func TestPutRetry(t *testing.T) {
+	vs, volumeServer := newTestVolumeServer()
+	defer volumeServer.Close()
+	c, master, stop := newTestClient(t, &Option{Retries: 3}, volumeServer)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// the first attempt fails to assign, and the second one to upload
+	master.failAssigns, vs.failUploads = 1, 1
+	result, err := c.Put(ctx, "hello.txt", bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if len(vs.files) != 1 || string(vs.files[result.FileId].data) != "hello" || result.Size != 5 {
+		t.Errorf("put %+v, files %v", result, vs.files)
+	}
+	if master.fileKey != 2 {
+		t.Errorf("assigned %d file ids, expected a new one after the failed upload", master.fileKey)
+	}
+
+	// all the attempts fail
+	vs.failUploads = 3
+	if _, err = c.Put(ctx, "hello.txt", bytes.NewReader([]byte("hello"))); err == nil {
+		t.Errorf("put with all the uploads failed")
+	}
+}
+
+func TestPutChunked(t *testing.T) {
+	vs, volumeServer := newTestVolumeServer()
+	defer volumeServer.Close()
+	c, _, stop := newTestClient(t, &Option{ChunkSizeMB: 1, Concurrency: 2}, volumeServer)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	content := make([]byte, 5*1024*1024/2)
+	rand.Read(content)
+	result, err := c.Put(ctx, "large.bin", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if result.Size != int64(len(content)) || len(vs.files) != 4 {
+		t.Fatalf("put %+v, %d files", result, len(vs.files))
+	}
+
+	manifest := vs.files[result.FileId]
+	if !manifest.isManifest {
+		t.Fatalf("%s is not uploaded as a chunk manifest", result.FileId)
+	}
+	cm, err := operation.LoadChunkManifest(manifest.data, false)
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if cm.Name != "large.bin" || cm.Size != int64(len(content)) || len(cm.Chunks) != 3 {
+		t.Fatalf("manifest %+v", cm)
+	}
+	for _, chunk := range cm.Chunks {
+		data := vs.files[chunk.Fid].data
+		if int64(len(data)) != chunk.Size || !bytes.Equal(data, content[chunk.Offset:chunk.Offset+chunk.Size]) {
+			t.Errorf("chunk %s at %d: %d bytes, expected %d", chunk.Fid, chunk.Offset, len(data), chunk.Size)
+		}
+	}
+
+	reader, err := c.Get(ctx, result.FileId)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("get %d bytes, expected %d: %v", len(data), len(content), err)
+	}
+
+	// the uploaded chunks are deleted if the manifest can not be uploaded
+	vs.files = make(map[string]*testFile)
+	vs.failManifests = true
+	if _, err = c.Put(ctx, "large.bin", bytes.NewReader(content)); err == nil {
+		t.Fatalf("put with the manifest upload failed")
+	}
+	if len(vs.files) != 0 {
+		t.Errorf("%d chunks left after the failed put", len(vs.files))
+	}
+}
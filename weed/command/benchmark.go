@@ -2,16 +2,18 @@ package command
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"math"
+	"math/bits"
 	"math/rand"
 	"os"
 	"runtime"
 	"runtime/pprof"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
@@ -28,11 +30,16 @@ type BenchmarkOptions struct {
 	concurrency      *int
 	numberOfFiles    *int
 	fileSize         *int
+	sizes            *string
 	idListFile       *string
 	write            *bool
 	deletePercentage *int
 	read             *bool
 	sequentialRead   *bool
+	readPercentage   *int
+	duration         *time.Duration
+	rampUp           *time.Duration
+	histogram        *string
 	collection       *string
 	replication      *string
 	cpuprofile       *string
@@ -40,6 +47,12 @@ type BenchmarkOptions struct {
 	grpcDialOption   grpc.DialOption
 	masterClient     *wdclient.MasterClient
 	fsync            *bool
+	s3Endpoint       *string
+	s3Bucket         *string
+	s3AccessKey      *string
+	s3SecretKey      *string
+	sizeDistribution *sizeDistribution
+	target           benchTarget
 }
 
 var (
@@ -54,17 +67,26 @@ func init() {
 	b.masters = cmdBenchmark.Flag.String("master", "localhost:9333", "SeaweedFS master location")
 	b.concurrency = cmdBenchmark.Flag.Int("c", 16, "number of concurrent write or read processes")
 	b.fileSize = cmdBenchmark.Flag.Int("size", 1024, "simulated file size in bytes, with random(0~63) bytes padding")
+	b.sizes = cmdBenchmark.Flag.String("sizes", "", "file size distribution instead of -size, e.g. \"4k:70,64k-1m:25,16m:5\" for 70% of 4KB, 25% between 64KB and 1MB, and 5% of 16MB")
 	b.numberOfFiles = cmdBenchmark.Flag.Int("n", 1024*1024, "number of files to write for each thread")
 	b.idListFile = cmdBenchmark.Flag.String("list", os.TempDir()+"/benchmark_list.txt", "list of uploaded file ids")
 	b.write = cmdBenchmark.Flag.Bool("write", true, "enable write")
 	b.deletePercentage = cmdBenchmark.Flag.Int("deletePercent", 0, "the percent of writes that are deletes")
 	b.read = cmdBenchmark.Flag.Bool("read", true, "enable read")
 	b.sequentialRead = cmdBenchmark.Flag.Bool("readSequentially", false, "randomly read by ids from \"-list\" specified file")
+	b.readPercentage = cmdBenchmark.Flag.Int("readPercent", -1, "run one mixed benchmark with this percent of reads and the rest writes, instead of writing and then reading")
+	b.duration = cmdBenchmark.Flag.Duration("duration", 0, "with -readPercent, measure for this long instead of -n requests")
+	b.rampUp = cmdBenchmark.Flag.Duration("rampUp", 0, "with -readPercent, start the processes gradually during this time, which is not measured")
+	b.histogram = cmdBenchmark.Flag.String("histogram", "", "save the latency distributions in HdrHistogram .hgrm format to <this prefix>-write.hgrm and <this prefix>-read.hgrm")
 	b.collection = cmdBenchmark.Flag.String("collection", "benchmark", "write data to this collection")
 	b.replication = cmdBenchmark.Flag.String("replication", "000", "replication type")
 	b.cpuprofile = cmdBenchmark.Flag.String("cpuprofile", "", "cpu profile output file")
 	b.maxCpu = cmdBenchmark.Flag.Int("maxCpu", 0, "maximum number of CPUs. 0 means all available CPUs")
 	b.fsync = cmdBenchmark.Flag.Bool("fsync", false, "flush data to disk after write")
+	b.s3Endpoint = cmdBenchmark.Flag.String("s3", "", "benchmark the S3 gateway at this address, e.g. localhost:8333, instead of the volume servers")
+	b.s3Bucket = cmdBenchmark.Flag.String("s3.bucket", "benchmark", "the S3 bucket to write to, created if not exists")
+	b.s3AccessKey = cmdBenchmark.Flag.String("s3.accessKey", "", "S3 access key, empty for anonymous requests")
+	b.s3SecretKey = cmdBenchmark.Flag.String("s3.secretKey", "", "S3 secret key")
 	sharedBytes = make([]byte, 1024)
 }
 
@@ -87,6 +109,15 @@ var cmdBenchmark = &Command{
   The numbers are used to get a sense of the system.
   Usually your network or the hard drive is the real bottleneck.
 
+  To simulate a real workload, "-readPercent" runs reads and writes at the same time,
+  reading the files in "-list" and the newly written files, with the file sizes from "-sizes":
+    weed benchmark -readPercent=80 -sizes=4k:70,64k-1m:25,16m:5 -rampUp=30s -duration=5m
+  The processes are started gradually during the ramp-up, and only the steady state is measured.
+  The latency percentiles can be saved with "-histogram" and plotted by the HdrHistogram plotter.
+
+  With "-s3=localhost:8333", the files are written to and read from the S3 gateway,
+  so the numbers include the filer and the S3 API overhead.
+
   Another thing to watch is whether the volumes are evenly distributed
   to each volume server. Because the 7 more benchmark volumes are randomly distributed
   to servers with free slots, it's highly possible some servers have uneven amount of
@@ -125,9 +156,28 @@ func runBenchmark(cmd *Command, args []string) bool {
 		defer pprof.StopCPUProfile()
 	}
 
-	b.masterClient = wdclient.NewMasterClient(b.grpcDialOption, "client", "", 0, strings.Split(*b.masters, ","))
-	go b.masterClient.KeepConnectedToMaster()
-	b.masterClient.WaitUntilConnected()
+	var err error
+	if b.sizeDistribution, err = parseSizeDistribution(*b.sizes, int64(*b.fileSize)); err != nil {
+		fmt.Printf("invalid -sizes %s: %v\n", *b.sizes, err)
+		return false
+	}
+
+	if *b.s3Endpoint != "" {
+		if b.target, err = newS3Target(*b.s3Endpoint, *b.s3Bucket, *b.s3AccessKey, *b.s3SecretKey); err != nil {
+			fmt.Printf("connect to s3 %s: %v\n", *b.s3Endpoint, err)
+			return false
+		}
+	} else {
+		b.masterClient = wdclient.NewMasterClient(b.grpcDialOption, "client", "", 0, strings.Split(*b.masters, ","))
+		go b.masterClient.KeepConnectedToMaster()
+		b.masterClient.WaitUntilConnected()
+		b.target = &volumeTarget{}
+	}
+
+	if *b.readPercentage >= 0 {
+		benchMixed()
+		return true
+	}
 
 	if *b.write {
 		benchWrite()
@@ -145,14 +195,14 @@ func benchWrite() {
 	finishChan := make(chan bool)
 	writeStats = newStats(*b.concurrency)
 	idChan := make(chan int)
-	go writeFileIds(*b.idListFile, fileIdLineChan, finishChan)
+	go writeFileIds(*b.idListFile, false, fileIdLineChan, finishChan)
 	for i := 0; i < *b.concurrency; i++ {
 		wait.Add(1)
 		go writeFiles(idChan, fileIdLineChan, &writeStats.localStats[i])
 	}
 	writeStats.start = time.Now()
 	writeStats.total = *b.numberOfFiles
-	go writeStats.checkProgress("Writing Benchmark", finishChan)
+	go checkProgress("Writing Benchmark", finishChan, writeStats)
 	for i := 0; i < *b.numberOfFiles; i++ {
 		idChan <- i
 	}
@@ -165,6 +215,7 @@ func benchWrite() {
 	wait.Wait()
 	close(finishChan)
 	writeStats.printStats()
+	writeStats.saveHistogram("write")
 }
 
 func benchRead() {
@@ -174,7 +225,7 @@ func benchRead() {
 	go readFileIds(*b.idListFile, fileIdLineChan)
 	readStats.start = time.Now()
 	readStats.total = *b.numberOfFiles
-	go readStats.checkProgress("Randomly Reading Benchmark", finishChan)
+	go checkProgress("Randomly Reading Benchmark", finishChan, readStats)
 	for i := 0; i < *b.concurrency; i++ {
 		wait.Add(1)
 		go readFiles(fileIdLineChan, &readStats.localStats[i])
@@ -186,11 +237,117 @@ func benchRead() {
 	close(finishChan)
 	readStats.end = time.Now()
 	readStats.printStats()
+	readStats.saveHistogram("read")
+}
+
+// benchMixed reads and writes at the same time. Only the requests after the ramp-up are measured,
+// until the duration is over, or -n requests are done.
+func benchMixed() {
+	pool := loadFileIdPool(*b.idListFile)
+	fileIdLineChan := make(chan string)
+	finishChan := make(chan bool)
+	writeStats = newStats(*b.concurrency)
+	readStats = newStats(*b.concurrency)
+	go writeFileIds(*b.idListFile, true, fileIdLineChan, finishChan)
+
+	steadyStart := time.Now().Add(*b.rampUp)
+	var deadline time.Time
+	remaining := int64(*b.numberOfFiles)
+	if *b.duration > 0 {
+		deadline = steadyStart.Add(*b.duration)
+	} else {
+		writeStats.total = *b.numberOfFiles
+	}
+	if *b.rampUp > 0 {
+		fmt.Printf("Ramping up %d processes in %v\n", *b.concurrency, *b.rampUp)
+	}
+
+	var nextId int64
+	for i := 0; i < *b.concurrency; i++ {
+		wait.Add(1)
+		go func(i int) {
+			time.Sleep(*b.rampUp * time.Duration(i) / time.Duration(*b.concurrency))
+			mixFiles(pool, &nextId, &remaining, steadyStart, deadline, fileIdLineChan, &writeStats.localStats[i], &readStats.localStats[i])
+		}(i)
+	}
+
+	time.Sleep(time.Until(steadyStart))
+	writeStats.start, readStats.start = steadyStart, steadyStart
+	go checkProgress(fmt.Sprintf("Mixed Benchmark with %d%% Reads", *b.readPercentage), finishChan, writeStats, readStats)
+	wait.Wait()
+	writeStats.end, readStats.end = time.Now(), time.Now()
+	wait.Add(2)
+	finishChan <- true
+	finishChan <- true
+	wait.Wait()
+	close(finishChan)
+
+	fmt.Printf("\n------------ Writes ----------\n")
+	writeStats.printStats()
+	writeStats.saveHistogram("write")
+	fmt.Printf("\n------------ Reads ----------\n")
+	readStats.printStats()
+	readStats.saveHistogram("read")
+}
+
+func mixFiles(pool *fileIdPool, nextId, remaining *int64, steadyStart, deadline time.Time, fileIdLineChan chan string, ws, rs *stat) {
+	defer wait.Done()
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		now := time.Now()
+		measured := !now.Before(steadyStart)
+		if measured {
+			if !deadline.IsZero() && !now.Before(deadline) {
+				return
+			}
+			if deadline.IsZero() && atomic.AddInt64(remaining, -1) < 0 {
+				return
+			}
+		}
+
+		if random.Intn(100) < *b.readPercentage {
+			if fid, found := pool.random(random); found {
+				bytesRead, err := b.target.read(fid)
+				if !measured {
+					continue
+				}
+				if err == nil {
+					rs.completed++
+					rs.transferred += int64(bytesRead)
+					readStats.addSample(time.Now().Sub(now))
+				} else {
+					rs.failed++
+					fmt.Printf("Failed to read %s error:%v\n", fid, err)
+				}
+				continue
+			}
+		}
+
+		fileSize := b.sizeDistribution.next(random)
+		fid, err := b.target.write(uint64(atomic.AddInt64(nextId, 1)), fileSize, random)
+		if err == nil {
+			pool.add(fid)
+			fileIdLineChan <- fid
+		}
+		if !measured {
+			continue
+		}
+		if err == nil {
+			ws.completed++
+			ws.transferred += fileSize
+			writeStats.addSample(time.Now().Sub(now))
+		} else {
+			ws.failed++
+			fmt.Printf("Failed to write with error:%v\n", err)
+		}
+	}
 }
 
 type delayedFile struct {
 	enterTime time.Time
-	fp        *operation.FilePart
+	fid       string
 }
 
 func writeFiles(idChan chan int, fileIdLineChan chan string, s *stat) {
@@ -206,11 +363,7 @@ func writeFiles(idChan chan int, fileIdLineChan chan string, s *stat) {
 				if df.enterTime.After(time.Now()) {
 					time.Sleep(df.enterTime.Sub(time.Now()))
 				}
-				var jwtAuthorization security.EncodedJwt
-				if isSecure {
-					jwtAuthorization = operation.LookupJwt(b.masterClient.GetMaster(), df.fp.Fid)
-				}
-				if e := util.Delete(fmt.Sprintf("http://%s/%s", df.fp.Server, df.fp.Fid), string(jwtAuthorization)); e == nil {
+				if e := b.target.delete(df.fid); e == nil {
 					s.completed++
 				} else {
 					s.failed++
@@ -223,43 +376,23 @@ func writeFiles(idChan chan int, fileIdLineChan chan string, s *stat) {
 
 	for id := range idChan {
 		start := time.Now()
-		fileSize := int64(*b.fileSize + random.Intn(64))
-		fp := &operation.FilePart{
-			Reader:   &FakeReader{id: uint64(id), size: fileSize, random: random},
-			FileSize: fileSize,
-			MimeType: "image/bench", // prevent gzip benchmark content
-			Fsync:    *b.fsync,
-		}
-		ar := &operation.VolumeAssignRequest{
-			Count:       1,
-			Collection:  *b.collection,
-			Replication: *b.replication,
-		}
-		if assignResult, err := operation.Assign(b.masterClient.GetMaster(), b.grpcDialOption, ar); err == nil {
-			fp.Server, fp.Fid, fp.Collection = assignResult.Url, assignResult.Fid, *b.collection
-			if !isSecure && assignResult.Auth != "" {
-				isSecure = true
-			}
-			if _, err := fp.Upload(0, b.masterClient.GetMaster(), false, assignResult.Auth, b.grpcDialOption); err == nil {
-				if random.Intn(100) < *b.deletePercentage {
-					s.total++
-					delayedDeleteChan <- &delayedFile{time.Now().Add(time.Second), fp}
-				} else {
-					fileIdLineChan <- fp.Fid
-				}
-				s.completed++
-				s.transferred += fileSize
+		fileSize := b.sizeDistribution.next(random)
+		if fid, err := b.target.write(uint64(id), fileSize, random); err == nil {
+			if random.Intn(100) < *b.deletePercentage {
+				s.total++
+				delayedDeleteChan <- &delayedFile{time.Now().Add(time.Second), fid}
 			} else {
-				s.failed++
-				fmt.Printf("Failed to write with error:%v\n", err)
+				fileIdLineChan <- fid
 			}
+			s.completed++
+			s.transferred += fileSize
 			writeStats.addSample(time.Now().Sub(start))
 			if *cmdBenchmark.IsDebug {
-				fmt.Printf("writing %d file %s\n", id, fp.Fid)
+				fmt.Printf("writing %d file %s\n", id, fid)
 			}
 		} else {
 			s.failed++
-			println("writing file error:", err.Error())
+			fmt.Printf("Failed to write with error:%v\n", err)
 		}
 	}
 	close(delayedDeleteChan)
@@ -280,17 +413,7 @@ func readFiles(fileIdLineChan chan string, s *stat) {
 			fmt.Printf("reading file %s\n", fid)
 		}
 		start := time.Now()
-		var bytesRead int
-		var err error
-		url, err := b.masterClient.LookupFileId(fid)
-		if err != nil {
-			s.failed++
-			println("!!!! ", fid, " location not found!!!!!")
-			continue
-		}
-		var bytes []byte
-		bytes, err = util.Get(url)
-		bytesRead = len(bytes)
+		bytesRead, err := b.target.read(fid)
 		if err == nil {
 			s.completed++
 			s.transferred += int64(bytesRead)
@@ -302,8 +425,12 @@ func readFiles(fileIdLineChan chan string, s *stat) {
 	}
 }
 
-func writeFileIds(fileName string, fileIdLineChan chan string, finishChan chan bool) {
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+func writeFileIds(fileName string, appendToFile bool, fileIdLineChan chan string, finishChan chan bool) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendToFile {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(fileName, flag, 0644)
 	if err != nil {
 		glog.Fatalf("File to create file %s: %s\n", fileName, err)
 	}
@@ -358,15 +485,52 @@ func readFileIds(fileName string, fileIdLineChan chan string) {
 	close(fileIdLineChan)
 }
 
-const (
-	benchResolution = 10000 // 0.1 microsecond
-	benchBucket     = 1000000000 / benchResolution
-)
+// fileIdPool is the files to read in the mixed benchmark
+type fileIdPool struct {
+	sync.RWMutex
+	fileIds []string
+}
+
+// loadFileIdPool starts with the file ids in the list file, if it exists
+func loadFileIdPool(fileName string) *fileIdPool {
+	pool := &fileIdPool{}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return pool
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		line, err := Readln(r)
+		if err != nil {
+			break
+		}
+		if len(line) > 0 && line[0] != '#' {
+			pool.fileIds = append(pool.fileIds, string(line))
+		}
+	}
+	fmt.Printf("Loaded %d file ids from %s\n", len(pool.fileIds), fileName)
+	return pool
+}
+
+func (pool *fileIdPool) add(fid string) {
+	pool.Lock()
+	pool.fileIds = append(pool.fileIds, fid)
+	pool.Unlock()
+}
+
+func (pool *fileIdPool) random(random *rand.Rand) (string, bool) {
+	pool.RLock()
+	defer pool.RUnlock()
+	if len(pool.fileIds) == 0 {
+		return "", false
+	}
+	return pool.fileIds[random.Intn(len(pool.fileIds))], true
+}
 
 // An efficient statics collecting and rendering
 type stats struct {
-	data       []int
-	overflow   []int
+	latencies  *histogram
 	localStats []stat
 	start      time.Time
 	end        time.Time
@@ -379,28 +543,24 @@ type stat struct {
 	transferred int64
 }
 
-var percentages = []int{50, 66, 75, 80, 90, 95, 98, 99, 100}
+var percentages = []float64{50, 66, 75, 80, 90, 95, 98, 99, 99.9, 99.99, 100}
 
 func newStats(n int) *stats {
 	return &stats{
-		data:       make([]int, benchResolution),
-		overflow:   make([]int, 0),
+		latencies:  &histogram{},
 		localStats: make([]stat, n),
 	}
 }
 
 func (s *stats) addSample(d time.Duration) {
-	index := int(d / benchBucket)
-	if index < 0 {
-		fmt.Printf("This request takes %3.1f seconds, skipping!\n", float64(index)/10000)
-	} else if index < len(s.data) {
-		s.data[int(d/benchBucket)]++
-	} else {
-		s.overflow = append(s.overflow, index)
+	if d < 0 {
+		fmt.Printf("This request takes %3.1f seconds, skipping!\n", d.Seconds())
+		return
 	}
+	s.latencies.record(d)
 }
 
-func (s *stats) checkProgress(testName string, finishChan chan bool) {
+func checkProgress(testName string, finishChan chan bool, statsList ...*stats) {
 	fmt.Printf("\n------------ %s ----------\n", testName)
 	ticker := time.Tick(time.Second)
 	lastCompleted, lastTransferred, lastTime := 0, int64(0), time.Now()
@@ -410,17 +570,23 @@ func (s *stats) checkProgress(testName string, finishChan chan bool) {
 			wait.Done()
 			return
 		case t := <-ticker:
-			completed, transferred, taken, total := 0, int64(0), t.Sub(lastTime), s.total
-			for _, localStat := range s.localStats {
-				completed += localStat.completed
-				transferred += localStat.transferred
-				total += localStat.total
+			completed, transferred, taken, total := 0, int64(0), t.Sub(lastTime), 0
+			for _, s := range statsList {
+				total += s.total
+				for _, localStat := range s.localStats {
+					completed += localStat.completed
+					transferred += localStat.transferred
+					total += localStat.total
+				}
+			}
+			rate := float64(completed-lastCompleted) * float64(int64(time.Second)) / float64(int64(taken))
+			transferRate := float64(transferred-lastTransferred) * float64(int64(time.Second)) / float64(int64(taken)) / float64(1024*1024)
+			if total > 0 {
+				fmt.Printf("Completed %d of %d requests, %3.1f%% %3.1f/s %3.1fMB/s\n",
+					completed, total, float64(completed)*100/float64(total), rate, transferRate)
+			} else {
+				fmt.Printf("Completed %d requests, %3.1f/s %3.1fMB/s\n", completed, rate, transferRate)
 			}
-			fmt.Printf("Completed %d of %d requests, %3.1f%% %3.1f/s %3.1fMB/s\n",
-				completed, total, float64(completed)*100/float64(total),
-				float64(completed-lastCompleted)*float64(int64(time.Second))/float64(int64(taken)),
-				float64(transferred-lastTransferred)*float64(int64(time.Second))/float64(int64(taken))/float64(1024*1024),
-			)
 			lastCompleted, lastTransferred, lastTime = completed, transferred, t
 		}
 	}
@@ -442,76 +608,289 @@ func (s *stats) printStats() {
 	fmt.Printf("Total transferred:      %d bytes\n", transferred)
 	fmt.Printf("Requests per second:    %.2f [#/sec]\n", float64(completed)/timeTaken)
 	fmt.Printf("Transfer rate:          %.2f [Kbytes/sec]\n", float64(transferred)/1024/timeTaken)
-	n, sum := 0, 0
-	min, max := 10000000, 0
-	for i := 0; i < len(s.data); i++ {
-		n += s.data[i]
-		sum += s.data[i] * i
-		if s.data[i] > 0 {
-			if min > i {
-				min = i
-			}
-			if max < i {
-				max = i
-			}
+	h := s.latencies
+	if h.count() == 0 {
+		return
+	}
+	min, max := h.valueAtPercentile(0), h.valueAtPercentile(100)
+	avg, std := h.meanAndStdDeviation()
+	fmt.Printf("\nConnection Times (ms)\n")
+	fmt.Printf("              min      avg        max      std\n")
+	fmt.Printf("Total:        %2.1f      %3.1f       %3.1f      %3.1f\n", float64(min)/1000, avg/1000, float64(max)/1000, std/1000)
+	// printing percentiles
+	fmt.Printf("\nPercentage of the requests served within a certain time (ms)\n")
+	for _, percentage := range percentages {
+		fmt.Printf("  %6s%%    %5.1f ms\n", fmt.Sprintf("%g", percentage), float64(h.valueAtPercentile(percentage))/1000)
+	}
+}
+
+// saveHistogram saves the latency distribution to <-histogram>-<name>.hgrm
+func (s *stats) saveHistogram(name string) {
+	if *b.histogram == "" || s.latencies.count() == 0 {
+		return
+	}
+	fileName := fmt.Sprintf("%s-%s.hgrm", *b.histogram, name)
+	f, err := os.Create(fileName)
+	if err != nil {
+		fmt.Printf("save histogram %s: %v\n", fileName, err)
+		return
+	}
+	defer f.Close()
+	if err = s.latencies.writePercentiles(f); err != nil {
+		fmt.Printf("save histogram %s: %v\n", fileName, err)
+		return
+	}
+	fmt.Printf("\nSaved the latency distribution to %s\n", fileName)
+}
+
+// histogram counts the latencies in microseconds, in buckets less than 1% wide like HdrHistogram,
+// so the high percentiles are accurate without keeping all the samples
+type histogram struct {
+	counts [histogramBuckets]int64
+	total  int64
+}
+
+const (
+	histogramSubBucketBits = 8
+	histogramHalfBucket    = 1 << (histogramSubBucketBits - 1)
+	histogramBuckets       = (64-histogramSubBucketBits)*histogramHalfBucket + 2*histogramHalfBucket
+)
+
+// histogramBucket keeps values below 256 exactly, and the 8 highest bits of larger values
+func histogramBucket(v int64) int {
+	shift := bits.Len64(uint64(v)) - histogramSubBucketBits
+	if shift <= 0 {
+		return int(v)
+	}
+	return shift*histogramHalfBucket + int(v>>uint(shift))
+}
+
+// histogramBucketMax is the largest value in the bucket
+func histogramBucketMax(bucket int) int64 {
+	next := bucket + 1
+	if next < 2*histogramHalfBucket {
+		return int64(bucket)
+	}
+	shift := next/histogramHalfBucket - 1
+	return int64(next-shift*histogramHalfBucket)<<uint(shift) - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	atomic.AddInt64(&h.counts[histogramBucket(int64(d/time.Microsecond))], 1)
+	atomic.AddInt64(&h.total, 1)
+}
+
+func (h *histogram) count() int64 {
+	return atomic.LoadInt64(&h.total)
+}
+
+// valueAtPercentile is the latency in microseconds that the percentage of requests are within
+func (h *histogram) valueAtPercentile(percentage float64) int64 {
+	total := h.count()
+	target := int64(math.Ceil(percentage * float64(total) / 100))
+	if target < 1 {
+		target = 1
+	}
+	var sum int64
+	for bucket := range h.counts {
+		sum += atomic.LoadInt64(&h.counts[bucket])
+		if sum >= target {
+			return histogramBucketMax(bucket)
 		}
 	}
-	n += len(s.overflow)
-	for i := 0; i < len(s.overflow); i++ {
-		sum += s.overflow[i]
-		if min > s.overflow[i] {
-			min = s.overflow[i]
+	return 0
+}
+
+func (h *histogram) meanAndStdDeviation() (mean, std float64) {
+	var n, sum float64
+	for bucket := range h.counts {
+		if count := atomic.LoadInt64(&h.counts[bucket]); count > 0 {
+			n += float64(count)
+			sum += float64(count) * float64(histogramBucketMax(bucket))
 		}
-		if max < s.overflow[i] {
-			max = s.overflow[i]
+	}
+	mean = sum / n
+	var varianceSum float64
+	for bucket := range h.counts {
+		if count := atomic.LoadInt64(&h.counts[bucket]); count > 0 {
+			d := float64(histogramBucketMax(bucket)) - mean
+			varianceSum += d * d * float64(count)
 		}
 	}
-	avg := float64(sum) / float64(n)
-	varianceSum := 0.0
-	for i := 0; i < len(s.data); i++ {
-		if s.data[i] > 0 {
-			d := float64(i) - avg
-			varianceSum += d * d * float64(s.data[i])
+	std = math.Sqrt(varianceSum / n)
+	return
+}
+
+// writePercentiles writes the percentile distribution in milliseconds, in the format of HdrHistogram
+func (h *histogram) writePercentiles(w io.Writer) error {
+	total := h.count()
+	if _, err := fmt.Fprintf(w, "%12s %14s %10s %14s\n\n", "Value", "Percentile", "TotalCount", "1/(1-Percentile)"); err != nil {
+		return err
+	}
+	var sum int64
+	var max int64
+	for bucket := range h.counts {
+		count := atomic.LoadInt64(&h.counts[bucket])
+		if count == 0 {
+			continue
+		}
+		sum += count
+		max = histogramBucketMax(bucket)
+		percentile := float64(sum) / float64(total)
+		var err error
+		if sum < total {
+			_, err = fmt.Fprintf(w, "%12.3f %2.12f %10d %14.2f\n", float64(max)/1000, percentile, sum, 1/(1-percentile))
+		} else {
+			_, err = fmt.Fprintf(w, "%12.3f %2.12f %10d\n", float64(max)/1000, percentile, sum)
+		}
+		if err != nil {
+			return err
 		}
 	}
-	for i := 0; i < len(s.overflow); i++ {
-		d := float64(s.overflow[i]) - avg
-		varianceSum += d * d
+	mean, std := h.meanAndStdDeviation()
+	_, err := fmt.Fprintf(w, "#[Mean    = %12.3f, StdDeviation   = %12.3f]\n#[Max     = %12.3f, Total count    = %12d]\n",
+		mean/1000, std/1000, float64(max)/1000, total)
+	return err
+}
+
+// sizeDistribution chooses the file sizes by weight
+type sizeDistribution struct {
+	ranges      []sizeRange
+	totalWeight int
+}
+
+type sizeRange struct {
+	min, max int64
+	weight   int
+}
+
+// parseSizeDistribution parses "size[-maxSize][:weight],...", e.g. "4k:70,64k-1m:25,16m:5".
+// Without the distribution, the size is fileSize with random(0~63) bytes padding.
+func parseSizeDistribution(spec string, fileSize int64) (*sizeDistribution, error) {
+	d := &sizeDistribution{}
+	if spec == "" {
+		d.ranges = []sizeRange{{min: fileSize, max: fileSize + 63, weight: 1}}
+		d.totalWeight = 1
+		return d, nil
 	}
-	std := math.Sqrt(varianceSum / float64(n))
-	fmt.Printf("\nConnection Times (ms)\n")
-	fmt.Printf("              min      avg        max      std\n")
-	fmt.Printf("Total:        %2.1f      %3.1f       %3.1f      %3.1f\n", float32(min)/10, float32(avg)/10, float32(max)/10, std/10)
-	// printing percentiles
-	fmt.Printf("\nPercentage of the requests served within a certain time (ms)\n")
-	percentiles := make([]int, len(percentages))
-	for i := 0; i < len(percentages); i++ {
-		percentiles[i] = n * percentages[i] / 100
-	}
-	percentiles[len(percentiles)-1] = n
-	percentileIndex := 0
-	currentSum := 0
-	for i := 0; i < len(s.data); i++ {
-		currentSum += s.data[i]
-		if s.data[i] > 0 && percentileIndex < len(percentiles) && currentSum >= percentiles[percentileIndex] {
-			fmt.Printf("  %3d%%    %5.1f ms\n", percentages[percentileIndex], float32(i)/10.0)
-			percentileIndex++
-			for percentileIndex < len(percentiles) && currentSum >= percentiles[percentileIndex] {
-				percentileIndex++
+	for _, part := range strings.Split(spec, ",") {
+		r := sizeRange{weight: 1}
+		sizes := part
+		if colon := strings.Index(part, ":"); colon >= 0 {
+			sizes = part[:colon]
+			if _, err := fmt.Sscanf(part[colon+1:], "%d", &r.weight); err != nil || r.weight <= 0 {
+				return nil, fmt.Errorf("invalid weight in %s", part)
 			}
 		}
+		minSize, maxSize := sizes, sizes
+		if dash := strings.Index(sizes, "-"); dash >= 0 {
+			minSize, maxSize = sizes[:dash], sizes[dash+1:]
+		}
+		var err error
+		if r.min, err = parseBytes(minSize); err != nil {
+			return nil, err
+		}
+		if r.max, err = parseBytes(maxSize); err != nil {
+			return nil, err
+		}
+		if r.max < r.min {
+			return nil, fmt.Errorf("invalid size range %s", sizes)
+		}
+		d.ranges = append(d.ranges, r)
+		d.totalWeight += r.weight
 	}
-	sort.Ints(s.overflow)
-	for i := 0; i < len(s.overflow); i++ {
-		currentSum++
-		if percentileIndex < len(percentiles) && currentSum >= percentiles[percentileIndex] {
-			fmt.Printf("  %3d%%    %5.1f ms\n", percentages[percentileIndex], float32(s.overflow[i])/10.0)
-			percentileIndex++
-			for percentileIndex < len(percentiles) && currentSum >= percentiles[percentileIndex] {
-				percentileIndex++
-			}
+	return d, nil
+}
+
+func (d *sizeDistribution) next(random *rand.Rand) int64 {
+	w := random.Intn(d.totalWeight)
+	for _, r := range d.ranges {
+		if w < r.weight {
+			return r.min + random.Int63n(r.max-r.min+1)
 		}
+		w -= r.weight
+	}
+	return d.ranges[len(d.ranges)-1].max
+}
+
+// parseBytes parses sizes like 100, 4k, 64KB, 1m, 2g
+func parseBytes(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "b"), "i")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier = 1024
+	case strings.HasSuffix(s, "m"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(s, "g"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	var n int64
+	if _, err := fmt.Sscanf(s, "%d", &n); err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// benchTarget is where the files are written to and read from
+type benchTarget interface {
+	write(id uint64, size int64, random *rand.Rand) (fid string, err error)
+	read(fid string) (bytesRead int, err error)
+	delete(fid string) error
+}
+
+// volumeTarget writes to the volume servers assigned by the master
+type volumeTarget struct{}
+
+func (t *volumeTarget) write(id uint64, size int64, random *rand.Rand) (string, error) {
+	fp := &operation.FilePart{
+		Reader:   &FakeReader{id: id, size: size, random: random},
+		FileSize: size,
+		MimeType: "image/bench", // prevent gzip benchmark content
+		Fsync:    *b.fsync,
+	}
+	ar := &operation.VolumeAssignRequest{
+		Count:       1,
+		Collection:  *b.collection,
+		Replication: *b.replication,
+	}
+	assignResult, err := operation.Assign(context.Background(), b.masterClient.GetMaster(), b.grpcDialOption, ar)
+	if err != nil {
+		return "", fmt.Errorf("assign: %v", err)
+	}
+	fp.Server, fp.Fid, fp.Collection = assignResult.Url, assignResult.Fid, *b.collection
+	if !isSecure && assignResult.Auth != "" {
+		isSecure = true
+	}
+	if _, err := fp.Upload(0, b.masterClient.GetMaster(), false, assignResult.Auth, b.grpcDialOption); err != nil {
+		return "", err
+	}
+	return fp.Fid, nil
+}
+
+func (t *volumeTarget) read(fid string) (int, error) {
+	url, err := b.masterClient.LookupFileId(fid)
+	if err != nil {
+		return 0, fmt.Errorf("location not found: %v", err)
+	}
+	bytes, err := util.Get(url)
+	return len(bytes), err
+}
+
+func (t *volumeTarget) delete(fid string) error {
+	url, err := b.masterClient.LookupFileId(fid)
+	if err != nil {
+		return err
+	}
+	var jwtAuthorization security.EncodedJwt
+	if isSecure {
+		jwtAuthorization = operation.LookupJwt(b.masterClient.GetMaster(), fid)
 	}
+	return util.Delete(url, string(jwtAuthorization))
 }
 
 // a fake reader to generate content to upload
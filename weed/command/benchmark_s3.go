@@ -0,0 +1,80 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Target writes the files as objects to the S3 gateway, with the object keys as the file ids
+type s3Target struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3Target(endpoint, bucket, accessKey, secretKey string) (*s3Target, error) {
+	config := &aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(!strings.HasPrefix(endpoint, "https://")),
+		Credentials:      credentials.AnonymousCredentials,
+	}
+	if accessKey != "" && secretKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	t := &s3Target{client: s3.New(sess), bucket: bucket}
+
+	if _, err = t.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		if _, err = t.client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			return nil, fmt.Errorf("create bucket %s: %v", bucket, err)
+		}
+	}
+	return t, nil
+}
+
+func (t *s3Target) write(id uint64, size int64, random *rand.Rand) (string, error) {
+	key := fmt.Sprintf("%x%08x", id, random.Uint32())
+	data := make([]byte, size)
+	(&FakeReader{id: id, size: size, random: random}).Read(data)
+	_, err := t.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("image/bench"), // prevent gzip benchmark content
+	})
+	return key, err
+}
+
+func (t *s3Target) read(key string) (int, error) {
+	resp, err := t.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	return int(n), err
+}
+
+func (t *s3Target) delete(key string) error {
+	_, err := t.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
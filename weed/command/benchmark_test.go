@@ -0,0 +1,70 @@
+package command
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, v := range []int64{0, 1, 255, 256, 257, 1000, 123456, 1 << 40, 1<<62 + 12345} {
+		bucket := histogramBucket(v)
+		if bucket >= histogramBuckets {
+			t.Fatalf("value %d bucket %d out of range", v, bucket)
+		}
+		max := histogramBucketMax(bucket)
+		if max < v {
+			t.Errorf("value %d above bucket %d max %d", v, bucket, max)
+		}
+		if bucket > 0 && histogramBucketMax(bucket-1) >= v {
+			t.Errorf("value %d below bucket %d", v, bucket)
+		}
+		if float64(max-v) > float64(v)/100 {
+			t.Errorf("value %d bucket max %d is more than 1%% off", v, max)
+		}
+	}
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := &histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	for _, c := range []struct {
+		percentage float64
+		expected   int64
+	}{{0, 1000}, {50, 500000}, {99, 990000}, {99.9, 999000}, {100, 1000000}} {
+		actual := h.valueAtPercentile(c.percentage)
+		if actual < c.expected || float64(actual-c.expected) > float64(c.expected)/100 {
+			t.Errorf("percentile %v is %d, expected about %d", c.percentage, actual, c.expected)
+		}
+	}
+}
+
+func TestSizeDistribution(t *testing.T) {
+	d, err := parseSizeDistribution("4k:70,64k-1m:25,16MB:5", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := rand.New(rand.NewSource(1))
+	small, medium, large := 0, 0, 0
+	for i := 0; i < 10000; i++ {
+		switch size := d.next(random); {
+		case size == 4096:
+			small++
+		case size >= 64*1024 && size <= 1024*1024:
+			medium++
+		case size == 16*1024*1024:
+			large++
+		default:
+			t.Fatalf("unexpected size %d", size)
+		}
+	}
+	if small < 6500 || medium < 2200 || large < 300 {
+		t.Errorf("unexpected distribution %d %d %d", small, medium, large)
+	}
+
+	if _, err = parseSizeDistribution("1m-4k", 1024); err == nil {
+		t.Errorf("expected an error for the reversed range")
+	}
+}
@@ -0,0 +1,111 @@
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	weed_server "github.com/chrislusf/seaweedfs/weed/server"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
+)
+
+var (
+	cacheOptions CacheOptions
+)
+
+type CacheOptions struct {
+	masters            *string
+	filer              *string
+	ip                 *string
+	port               *int
+	peers              *string
+	cacheDir           *string
+	cacheSizeMB        *int64
+	memoryCacheEntries *int64
+	maxObjectSizeKB    *int64
+	whiteList          *string
+	volumeClient       VolumeClientOptions
+}
+
+func init() {
+	cmdCache.Run = runCache // break init cycle
+	cacheOptions.masters = cmdCache.Flag.String("master", "localhost:9333", "comma-separated master servers")
+	cacheOptions.filer = cmdCache.Flag.String("filer", "", "optional filer address, to invalidate the chunks of the deleted or updated files")
+	cacheOptions.ip = cmdCache.Flag.String("ip", util.DetectedHostAddress(), "cache node address, used in the peers")
+	cacheOptions.port = cmdCache.Flag.Int("port", 8070, "cache http listen port")
+	cacheOptions.peers = cmdCache.Flag.String("peers", "", "all cache nodes in comma separated ip:port list, example: 127.0.0.1:8070,127.0.0.1:8071")
+	cacheOptions.cacheDir = cmdCache.Flag.String("cacheDir", os.TempDir(), "directory for the cached objects, preferably on a SSD")
+	cacheOptions.cacheSizeMB = cmdCache.Flag.Int64("cacheCapacityMB", 10000, "disk cache capacity in MB")
+	cacheOptions.memoryCacheEntries = cmdCache.Flag.Int64("memoryCacheEntries", 10000, "objects cached in memory, in addition to the disk cache")
+	cacheOptions.maxObjectSizeKB = cmdCache.Flag.Int64("maxObjectSizeKB", 1024, "larger objects are read from the volume servers without caching")
+	cacheOptions.whiteList = cmdCache.Flag.String("whiteList", "", "comma separated Ip addresses having delete permission. No limit if empty.")
+	cacheOptions.volumeClient.bindFlags(&cmdCache.Flag, "")
+}
+
+var cmdCache = &Command{
+	UsageLine: "cache -port=8070 -master=<ip:port> -peers=<ip:port>,<ip:port>",
+	Short:     "start a read-through cache node in front of the volume servers",
+	Long: `start a read-through cache node in front of the volume servers.
+
+	The cache node serves the same read urls as the volume servers, e.g. http://cache:8070/3,01637037d6,
+	and keeps the small objects in memory and on the local disk.
+	With several cache nodes listed in -peers, each file id is cached on one node picked by consistent hashing,
+	and the other nodes forward the reads to it, so it does not matter which node a client reads from.
+
+	The cached objects are invalidated when they are deleted through any cache node,
+	or, with -filer, when the filer deletes or updates the files using them.
+	Reads with query parameters or an Authorization header go to the volume servers directly.
+
+`,
+}
+
+func runCache(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	if err := util.TestFolderWritable(util.ResolvePath(*cacheOptions.cacheDir)); err != nil {
+		glog.Fatalf("Check Cache Folder (-cacheDir) Writable %s : %s", *cacheOptions.cacheDir, err)
+	}
+
+	cacheOptions.volumeClient.configure(false)
+
+	var peers, whiteList []string
+	if *cacheOptions.peers != "" {
+		peers = strings.Split(*cacheOptions.peers, ",")
+	}
+	if *cacheOptions.whiteList != "" {
+		whiteList = strings.Split(*cacheOptions.whiteList, ",")
+	}
+
+	mux := http.NewServeMux()
+	cacheServer := weed_server.NewCacheServer(mux, &weed_server.CacheServerOption{
+		Masters:            strings.Split(*cacheOptions.masters, ","),
+		Filer:              *cacheOptions.filer,
+		Self:               fmt.Sprintf("%s:%d", *cacheOptions.ip, *cacheOptions.port),
+		Peers:              peers,
+		CacheDir:           util.ResolvePath(*cacheOptions.cacheDir),
+		CacheSizeMB:        *cacheOptions.cacheSizeMB,
+		MemoryCacheEntries: *cacheOptions.memoryCacheEntries,
+		MaxObjectSizeBytes: *cacheOptions.maxObjectSizeKB * 1024,
+		GrpcDialOption:     security.LoadClientTLS(util.GetViper(), "grpc.client"),
+	}, whiteList)
+	grace.OnInterrupt(cacheServer.Shutdown)
+
+	listenAddress := fmt.Sprintf(":%d", *cacheOptions.port)
+	listener, err := util.NewListener(listenAddress, time.Duration(10)*time.Second)
+	if err != nil {
+		glog.Fatalf("Cache listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed Cache %s at http %s", util.Version(), listenAddress)
+	if err = http.Serve(listener, mux); err != nil {
+		glog.Fatalf("Cache Fail to serve: %v", err)
+	}
+
+	return true
+}
@@ -10,20 +10,28 @@ import (
 var Commands = []*Command{
 	cmdBenchmark,
 	cmdBackup,
+	cmdCache,
 	cmdCompact,
 	cmdCopy,
+	cmdDoctor,
 	cmdDownload,
 	cmdExport,
 	cmdFiler,
+	cmdFilerFetch,
 	cmdFilerReplicate,
 	cmdFix,
+	cmdFtp,
 	cmdMaster,
 	cmdMount,
 	cmdS3,
 	cmdMsgBroker,
+	cmdNbd,
+	cmdNfs,
 	cmdScaffold,
 	cmdServer,
 	cmdShell,
+	cmdSftp,
+	cmdSmb,
 	cmdWatch,
 	cmdUpload,
 	cmdVersion,
@@ -0,0 +1,365 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	doctorOptions DoctorOptions
+)
+
+type DoctorOptions struct {
+	masters          *string
+	diskUsagePercent *float64
+	maxClockSkew     *time.Duration
+	timeout          *time.Duration
+}
+
+func init() {
+	cmdDoctor.Run = runDoctor // break init cycle
+	doctorOptions.masters = cmdDoctor.Flag.String("master", "localhost:9333", "comma-separated master servers")
+	doctorOptions.diskUsagePercent = cmdDoctor.Flag.Float64("diskUsagePercent", 90, "report disks used above this percentage")
+	doctorOptions.maxClockSkew = cmdDoctor.Flag.Duration("maxClockSkew", 2*time.Second, "report servers whose clock differs from this machine by more than this")
+	doctorOptions.timeout = cmdDoctor.Flag.Duration("timeout", 5*time.Second, "time to wait for each server to respond")
+}
+
+var cmdDoctor = &Command{
+	UsageLine: "doctor -master=localhost:9333",
+	Short:     "check the cluster for common misconfigurations",
+	Long: `Check the cluster for common misconfigurations and print actionable findings.
+
+	The following checks are performed:
+	  * masters and volume servers that can not be reached
+	  * servers running a different version than this binary, or than each other
+	  * clocks skewed from this machine by more than -maxClockSkew
+	  * volumes with fewer replicas than their replica placement requires
+	  * volume servers without free volume slots, and disks used above -diskUsagePercent
+	  * erasure coded volumes missing shards, or with shards on too few racks
+	    to survive losing one rack
+
+  `,
+}
+
+type doctorFinding struct {
+	severity string
+	subject  string
+	problem  string
+	advice   string
+}
+
+const (
+	doctorError   = "ERROR"
+	doctorWarning = "WARN"
+)
+
+func (f doctorFinding) String() string {
+	return fmt.Sprintf("[%s] %s: %s\n\t=> %s", f.severity, f.subject, f.problem, f.advice)
+}
+
+func runDoctor(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	masters := strings.Split(*doctorOptions.masters, ",")
+
+	var findings []doctorFinding
+	versions := make(map[string][]string)
+
+	masterFindings, topo := checkMasters(masters, grpcDialOption, versions)
+	findings = append(findings, masterFindings...)
+
+	if topo != nil {
+		findings = append(findings, checkVolumeServers(topo, grpcDialOption, versions)...)
+		findings = append(findings, checkVolumeReplication(topo)...)
+		findings = append(findings, checkVolumeSlots(topo)...)
+		findings = append(findings, checkEcShardPlacement(topo)...)
+	}
+	findings = append(findings, checkVersions(versions)...)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].severity < findings[j].severity
+	})
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	if len(findings) == 0 {
+		fmt.Println("no problems found")
+	} else {
+		fmt.Printf("%d problems found\n", len(findings))
+	}
+
+	return true
+}
+
+func checkMasters(masters []string, grpcDialOption grpc.DialOption, versions map[string][]string) (findings []doctorFinding, topo *master_pb.TopologyInfo) {
+
+	for _, master := range masters {
+		err := operation.WithMasterServerClient(master, grpcDialOption, func(client master_pb.SeaweedClient) error {
+			ctx, cancel := context.WithTimeout(context.Background(), *doctorOptions.timeout)
+			defer cancel()
+			start := time.Now()
+			resp, err := client.GetMasterConfiguration(ctx, &master_pb.GetMasterConfigurationRequest{})
+			if err != nil {
+				return err
+			}
+			versions[resp.Version] = append(versions[resp.Version], "master "+master)
+			if f, skewed := checkClockSkew("master "+master, start, time.Now(), resp.TsNs); skewed {
+				findings = append(findings, f)
+			}
+			if topo == nil {
+				if volumeListResp, listErr := master_pb.ReadVolumeList(ctx, client); listErr == nil {
+					topo = volumeListResp.TopologyInfo
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			findings = append(findings, doctorFinding{
+				severity: doctorError,
+				subject:  "master " + master,
+				problem:  fmt.Sprintf("unreachable: %v", err),
+				advice:   "check that the master is running and its grpc port is open to this machine",
+			})
+		}
+	}
+
+	if topo == nil {
+		findings = append(findings, doctorFinding{
+			severity: doctorError,
+			subject:  "masters " + strings.Join(masters, ","),
+			problem:  "failed to read the volume topology from any master",
+			advice:   "check that the masters have elected a leader",
+		})
+	}
+
+	return
+}
+
+func checkVolumeServers(topo *master_pb.TopologyInfo, grpcDialOption grpc.DialOption, versions map[string][]string) (findings []doctorFinding) {
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	eachDoctorDataNode(topo, func(dc, rack string, dn *master_pb.DataNodeInfo) {
+		wg.Add(1)
+		go func(dn *master_pb.DataNodeInfo) {
+			defer wg.Done()
+			subject := "volume server " + dn.Id
+			var found []doctorFinding
+			err := operation.WithVolumeServerClient(dn.Id, grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+				ctx, cancel := context.WithTimeout(context.Background(), *doctorOptions.timeout)
+				defer cancel()
+				start := time.Now()
+				resp, err := client.VolumeServerStatus(ctx, &volume_server_pb.VolumeServerStatusRequest{})
+				if err != nil {
+					return err
+				}
+				lock.Lock()
+				versions[resp.Version] = append(versions[resp.Version], subject)
+				lock.Unlock()
+				if f, skewed := checkClockSkew(subject, start, time.Now(), resp.TsNs); skewed {
+					found = append(found, f)
+				}
+				for _, disk := range resp.DiskStatuses {
+					if float64(disk.PercentUsed) > *doctorOptions.diskUsagePercent {
+						found = append(found, doctorFinding{
+							severity: doctorWarning,
+							subject:  subject,
+							problem:  fmt.Sprintf("disk %s is %.1f%% used, %d bytes free", disk.Dir, disk.PercentUsed, disk.Free),
+							advice:   "add disk capacity, lower -max for this directory, or move volumes away with volume.balance",
+						})
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				found = append(found, doctorFinding{
+					severity: doctorError,
+					subject:  subject,
+					problem:  fmt.Sprintf("registered in %s/%s but unreachable: %v", dc, rack, err),
+					advice:   "check that the volume server is running, and that its grpc port (http port + 10000) is open",
+				})
+			}
+			lock.Lock()
+			findings = append(findings, found...)
+			lock.Unlock()
+		}(dn)
+	})
+	wg.Wait()
+
+	return
+}
+
+func checkClockSkew(subject string, start, stop time.Time, remoteTsNs int64) (finding doctorFinding, skewed bool) {
+	if remoteTsNs == 0 {
+		// older servers do not report their clock
+		return
+	}
+	localTsNs := start.UnixNano() + stop.Sub(start).Nanoseconds()/2
+	skew := time.Duration(remoteTsNs - localTsNs)
+	if skew < -*doctorOptions.maxClockSkew || skew > *doctorOptions.maxClockSkew {
+		return doctorFinding{
+			severity: doctorWarning,
+			subject:  subject,
+			problem:  fmt.Sprintf("clock is skewed by %v from this machine", skew),
+			advice:   "run ntpd or chronyd on all servers, since TTL, vacuum and metadata sync depend on the clock",
+		}, true
+	}
+	return
+}
+
+func checkVersions(versions map[string][]string) (findings []doctorFinding) {
+	local := util.Version()
+	for version, servers := range versions {
+		if version == local {
+			continue
+		}
+		if version == "" {
+			version = "an unknown older version"
+		}
+		sort.Strings(servers)
+		findings = append(findings, doctorFinding{
+			severity: doctorWarning,
+			subject:  strings.Join(servers, ", "),
+			problem:  fmt.Sprintf("running %s, while this binary is %s", version, local),
+			advice:   "upgrade all masters, volume servers and filers to the same version",
+		})
+	}
+	return
+}
+
+func checkVolumeReplication(topo *master_pb.TopologyInfo) (findings []doctorFinding) {
+
+	volumeLocations := make(map[uint32][]string)
+	volumeInfos := make(map[uint32]*master_pb.VolumeInformationMessage)
+	eachDoctorDataNode(topo, func(dc, rack string, dn *master_pb.DataNodeInfo) {
+		for _, v := range dn.VolumeInfos {
+			volumeLocations[v.Id] = append(volumeLocations[v.Id], dn.Id)
+			volumeInfos[v.Id] = v
+		}
+	})
+
+	var vids []uint32
+	for vid := range volumeLocations {
+		vids = append(vids, vid)
+	}
+	sort.Slice(vids, func(i, j int) bool { return vids[i] < vids[j] })
+
+	for _, vid := range vids {
+		locations := volumeLocations[vid]
+		replicaPlacement, err := super_block.NewReplicaPlacementFromByte(byte(volumeInfos[vid].ReplicaPlacement))
+		if err != nil {
+			continue
+		}
+		if replicaPlacement.GetCopyCount() > len(locations) {
+			findings = append(findings, doctorFinding{
+				severity: doctorError,
+				subject:  fmt.Sprintf("volume %d", vid),
+				problem:  fmt.Sprintf("has %d of %d replicas required by %s, on %v", len(locations), replicaPlacement.GetCopyCount(), replicaPlacement, locations),
+				advice:   "run volume.fix.replication in weed shell",
+			})
+		}
+	}
+	return
+}
+
+func checkVolumeSlots(topo *master_pb.TopologyInfo) (findings []doctorFinding) {
+	eachDoctorDataNode(topo, func(dc, rack string, dn *master_pb.DataNodeInfo) {
+		if dn.MaxVolumeCount > 0 && dn.FreeVolumeCount == 0 {
+			findings = append(findings, doctorFinding{
+				severity: doctorWarning,
+				subject:  "volume server " + dn.Id,
+				problem:  fmt.Sprintf("has no free volume slots, %d/%d used", dn.VolumeCount, dn.MaxVolumeCount),
+				advice:   "increase -max on this volume server if the disk has space, or add volume servers",
+			})
+		}
+	})
+	return
+}
+
+func checkEcShardPlacement(topo *master_pb.TopologyInfo) (findings []doctorFinding) {
+
+	// volume id => rack => shard count
+	rackShardCounts := make(map[uint32]map[string]int)
+	shardBits := make(map[uint32]erasure_coding.ShardBits)
+	eachDoctorDataNode(topo, func(dc, rack string, dn *master_pb.DataNodeInfo) {
+		for _, ecShardInfo := range dn.EcShardInfos {
+			bits := erasure_coding.ShardBits(ecShardInfo.EcIndexBits)
+			if _, found := rackShardCounts[ecShardInfo.Id]; !found {
+				rackShardCounts[ecShardInfo.Id] = make(map[string]int)
+			}
+			rackShardCounts[ecShardInfo.Id][dc+" "+rack] += bits.ShardIdCount()
+			shardBits[ecShardInfo.Id] = shardBits[ecShardInfo.Id].Plus(bits)
+		}
+	})
+
+	var vids []uint32
+	for vid := range rackShardCounts {
+		vids = append(vids, vid)
+	}
+	sort.Slice(vids, func(i, j int) bool { return vids[i] < vids[j] })
+
+	for _, vid := range vids {
+		subject := fmt.Sprintf("ec volume %d", vid)
+		shardCount := shardBits[vid].ShardIdCount()
+		if shardCount < erasure_coding.DataShardsCount {
+			findings = append(findings, doctorFinding{
+				severity: doctorError,
+				subject:  subject,
+				problem:  fmt.Sprintf("has only %d shards, at least %d are needed to read it", shardCount, erasure_coding.DataShardsCount),
+				advice:   "bring back the volume servers holding the missing shards",
+			})
+			continue
+		}
+		if shardCount < erasure_coding.TotalShardsCount {
+			findings = append(findings, doctorFinding{
+				severity: doctorWarning,
+				subject:  subject,
+				problem:  fmt.Sprintf("has %d of %d shards", shardCount, erasure_coding.TotalShardsCount),
+				advice:   "run ec.rebuild in weed shell",
+			})
+		}
+		var racks []string
+		for rack := range rackShardCounts[vid] {
+			racks = append(racks, rack)
+		}
+		sort.Strings(racks)
+		for _, rack := range racks {
+			count := rackShardCounts[vid][rack]
+			if shardCount-count < erasure_coding.DataShardsCount {
+				findings = append(findings, doctorFinding{
+					severity: doctorWarning,
+					subject:  subject,
+					problem:  fmt.Sprintf("has %d shards on rack %s, and losing this rack would lose the volume", count, rack),
+					advice:   "add racks if there are fewer than 4, then run ec.balance in weed shell",
+				})
+			}
+		}
+	}
+	return
+}
+
+func eachDoctorDataNode(topo *master_pb.TopologyInfo, fn func(dc, rack string, dn *master_pb.DataNodeInfo)) {
+	for _, dc := range topo.DataCenterInfos {
+		for _, rack := range dc.RackInfos {
+			for _, dn := range rack.DataNodeInfos {
+				fn(dc.Id, rack.Id, dn)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func TestDoctorEcShardPlacement(t *testing.T) {
+
+	topo := &master_pb.TopologyInfo{
+		DataCenterInfos: []*master_pb.DataCenterInfo{{
+			Id: "dc1",
+			RackInfos: []*master_pb.RackInfo{
+				{Id: "rack1", DataNodeInfos: []*master_pb.DataNodeInfo{{
+					Id: "dn1",
+					EcShardInfos: []*master_pb.VolumeEcShardInformationMessage{
+						{Id: 1, EcIndexBits: 0x3ff}, // shards 0~9
+						{Id: 2, EcIndexBits: 0x0f},  // shards 0~3
+						{Id: 3, EcIndexBits: 0x1ff}, // shards 0~8
+					},
+				}}},
+				{Id: "rack2", DataNodeInfos: []*master_pb.DataNodeInfo{{
+					Id: "dn2",
+					EcShardInfos: []*master_pb.VolumeEcShardInformationMessage{
+						{Id: 1, EcIndexBits: 0x3c00}, // shards 10~13
+						{Id: 2, EcIndexBits: 0xf0},   // shards 4~7
+					},
+				}}},
+				{Id: "rack3", DataNodeInfos: []*master_pb.DataNodeInfo{{
+					Id: "dn3",
+					EcShardInfos: []*master_pb.VolumeEcShardInformationMessage{
+						{Id: 2, EcIndexBits: 0xf00}, // shards 8~11
+					},
+				}}},
+				{Id: "rack4", DataNodeInfos: []*master_pb.DataNodeInfo{{
+					Id: "dn4",
+					EcShardInfos: []*master_pb.VolumeEcShardInformationMessage{
+						{Id: 2, EcIndexBits: 0x3000}, // shards 12~13
+					},
+				}}},
+			},
+		}},
+	}
+
+	findings := checkEcShardPlacement(topo)
+
+	// volume 1: rack1 holds 10 of 14 shards
+	// volume 2: well placed
+	// volume 3: only 9 shards
+	if len(findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d: %+v", len(findings), findings)
+	}
+	if findings[0].subject != "ec volume 1" || findings[0].severity != doctorWarning {
+		t.Errorf("unexpected finding %v", findings[0])
+	}
+	if findings[1].subject != "ec volume 3" || findings[1].severity != doctorError {
+		t.Errorf("unexpected finding %v", findings[1])
+	}
+
+}
+
+func TestDoctorVolumeReplication(t *testing.T) {
+
+	topo := &master_pb.TopologyInfo{
+		DataCenterInfos: []*master_pb.DataCenterInfo{{
+			Id: "dc1",
+			RackInfos: []*master_pb.RackInfo{{
+				Id: "rack1",
+				DataNodeInfos: []*master_pb.DataNodeInfo{
+					{Id: "dn1", VolumeInfos: []*master_pb.VolumeInformationMessage{
+						{Id: 1, ReplicaPlacement: 1},
+						{Id: 2, ReplicaPlacement: 1},
+						{Id: 3, ReplicaPlacement: 0},
+					}},
+					{Id: "dn2", VolumeInfos: []*master_pb.VolumeInformationMessage{
+						{Id: 1, ReplicaPlacement: 1},
+					}},
+				},
+			}},
+		}},
+	}
+
+	findings := checkVolumeReplication(topo)
+
+	if len(findings) != 1 || findings[0].subject != "volume 2" {
+		t.Fatalf("expected volume 2 to be under replicated, got %+v", findings)
+	}
+
+}
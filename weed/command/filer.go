@@ -1,6 +1,7 @@
 package command
 
 import (
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/server"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var (
@@ -36,6 +38,14 @@ type FilerOptions struct {
 	disableHttp             *bool
 	cipher                  *bool
 	peers                   *string
+	contentAddressable      *bool
+	h2c                     *bool
+	h2cClient               *bool
+	volumeClient            VolumeClientOptions
+	chunkUploadConcurrency  *int
+	chunkUploadBufferMB     *int
+	readHedgeDelayMs        *int
+	chunkMaxSizeMB          *int
 
 	// default leveldb directory, used in "weed server" mode
 	defaultLevelDbDirectory *string
@@ -52,11 +62,19 @@ func init() {
 	f.defaultReplicaPlacement = cmdFiler.Flag.String("defaultReplicaPlacement", "000", "default replication type if not specified")
 	f.disableDirListing = cmdFiler.Flag.Bool("disableDirListing", false, "turn off directory listing")
 	f.maxMB = cmdFiler.Flag.Int("maxMB", 32, "split files larger than the limit")
+	f.chunkMaxSizeMB = cmdFiler.Flag.Int("chunk.maxSizeMB", 128, "the chunks of large files grow from maxMB to this size")
 	f.dirListingLimit = cmdFiler.Flag.Int("dirListLimit", 100000, "limit sub dir listing size")
 	f.dataCenter = cmdFiler.Flag.String("dataCenter", "", "prefer to write to volumes in this data center")
 	f.disableHttp = cmdFiler.Flag.Bool("disableHttp", false, "disable http request, only gRpc operations are allowed")
 	f.cipher = cmdFiler.Flag.Bool("encryptVolumeData", false, "encrypt data on volume servers")
 	f.peers = cmdFiler.Flag.String("peers", "", "all filers sharing the same filer store in comma separated ip:port list")
+	f.contentAddressable = cmdFiler.Flag.Bool("cas", false, "index uploaded files by sha256, and serve them at /cas/<sha256>")
+	f.h2c = cmdFiler.Flag.Bool("h2c", false, "also accept HTTP/2 without TLS, i.e., h2c")
+	f.h2cClient = cmdFiler.Flag.Bool("h2c.client", false, "read from and write to volume servers with h2c, which requires all volume servers running with -h2c")
+	f.volumeClient.bindFlags(&cmdFiler.Flag, "")
+	f.chunkUploadConcurrency = cmdFiler.Flag.Int("chunk.uploadConcurrency", 4, "chunks of one file uploaded to volume servers at the same time")
+	f.chunkUploadBufferMB = cmdFiler.Flag.Int("chunk.uploadBufferMB", 512, "memory limit of the chunks being uploaded, 0 means no limit")
+	f.readHedgeDelayMs = cmdFiler.Flag.Int("read.hedgeDelayMs", 0, "also read from another replica if a replica does not respond within this time, 0 disables the hedged reads")
 }
 
 var cmdFiler = &Command{
@@ -72,11 +90,16 @@ var cmdFiler = &Command{
 	POST /path/to/
 	//return a json format subdirectory and files listing
 	GET /path/to/
+	//get the file content by its sha256, with "-cas" enabled
+	GET /cas/<sha256>
 
 	The configuration file "filer.toml" is read from ".", "$HOME/.seaweedfs/", or "/etc/seaweedfs/", in that order.
 
 	The example filer.toml configuration file can be generated by "weed scaffold -config=filer"
 
+	HTTP/2 is served over TLS, with the certificate in the [https.filer] section of "security.toml",
+	and over cleartext with "-h2c".
+
 `,
 }
 
@@ -108,25 +131,38 @@ func (fo *FilerOptions) startFiler() {
 		peers = strings.Split(*fo.peers, ",")
 	}
 
+	fo.volumeClient.configure(*fo.h2cClient)
+	util.SetHedgedReadDelay(time.Duration(*fo.readHedgeDelayMs) * time.Millisecond)
+
 	fs, nfs_err := weed_server.NewFilerServer(defaultMux, publicVolumeMux, &weed_server.FilerOption{
-		Masters:            strings.Split(*fo.masters, ","),
-		Collection:         *fo.collection,
-		DefaultReplication: *fo.defaultReplicaPlacement,
-		DisableDirListing:  *fo.disableDirListing,
-		MaxMB:              *fo.maxMB,
-		DirListingLimit:    *fo.dirListingLimit,
-		DataCenter:         *fo.dataCenter,
-		DefaultLevelDbDir:  defaultLevelDbDirectory,
-		DisableHttp:        *fo.disableHttp,
-		Host:               *fo.ip,
-		Port:               uint32(*fo.port),
-		Cipher:             *fo.cipher,
-		Filers:             peers,
+		Masters:                strings.Split(*fo.masters, ","),
+		Collection:             *fo.collection,
+		DefaultReplication:     *fo.defaultReplicaPlacement,
+		DisableDirListing:      *fo.disableDirListing,
+		MaxMB:                  *fo.maxMB,
+		DirListingLimit:        *fo.dirListingLimit,
+		DataCenter:             *fo.dataCenter,
+		DefaultLevelDbDir:      defaultLevelDbDirectory,
+		DisableHttp:            *fo.disableHttp,
+		Host:                   *fo.ip,
+		Port:                   uint32(*fo.port),
+		Cipher:                 *fo.cipher,
+		Filers:                 peers,
+		ContentAddressable:     *fo.contentAddressable,
+		ChunkUploadConcurrency: *fo.chunkUploadConcurrency,
+		ChunkUploadBufferMB:    *fo.chunkUploadBufferMB,
+		ChunkMaxMB:             *fo.chunkMaxSizeMB,
 	})
 	if nfs_err != nil {
 		glog.Fatalf("Filer startup error: %v", nfs_err)
 	}
 
+	var defaultHandler, publicHandler http.Handler = request_id.Middleware(defaultMux), request_id.Middleware(publicVolumeMux)
+	if *fo.h2c {
+		defaultHandler, publicHandler = util.NewH2cHandler(defaultHandler), util.NewH2cHandler(publicHandler)
+	}
+	certFile, keyFile := util.GetViper().GetString("https.filer.cert"), util.GetViper().GetString("https.filer.key")
+
 	if *fo.publicPort != 0 {
 		publicListeningAddress := *fo.bindIp + ":" + strconv.Itoa(*fo.publicPort)
 		glog.V(0).Infoln("Start Seaweed filer server", util.Version(), "public at", publicListeningAddress)
@@ -135,7 +171,7 @@ func (fo *FilerOptions) startFiler() {
 			glog.Fatalf("Filer server public listener error on port %d:%v", *fo.publicPort, e)
 		}
 		go func() {
-			if e := http.Serve(publicListener, publicVolumeMux); e != nil {
+			if e := serveHttp(&http.Server{Handler: publicHandler}, publicListener, certFile, keyFile); e != nil {
 				glog.Fatalf("Volume server fail to serve public: %v", e)
 			}
 		}()
@@ -161,9 +197,17 @@ func (fo *FilerOptions) startFiler() {
 	reflection.Register(grpcS)
 	go grpcS.Serve(grpcL)
 
-	httpS := &http.Server{Handler: defaultMux}
-	if err := httpS.Serve(filerListener); err != nil {
+	httpS := &http.Server{Handler: defaultHandler}
+	if err := serveHttp(httpS, filerListener, certFile, keyFile); err != nil {
 		glog.Fatalf("Filer Fail to serve: %v", e)
 	}
 
 }
+
+// serveHttp serves HTTPS if the certificate is configured, where HTTP/2 is negotiated by ALPN
+func serveHttp(httpS *http.Server, listener net.Listener, certFile, keyFile string) error {
+	if keyFile != "" {
+		return httpS.ServeTLS(listener, certFile, keyFile)
+	}
+	return httpS.Serve(listener)
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/util/delta"
+)
+
+func init() {
+	cmdFilerFetch.Run = runFilerFetch // break init cycle
+}
+
+var cmdFilerFetch = &Command{
+	UsageLine: "filer.fetch [-o=local/file] [-blockSize=1048576] http://localhost:8888/path/to/file",
+	Short:     "download a file from filer, transferring only the blocks changed from the local copy",
+	Long: `Download a file from filer, and update the local copy in place.
+
+  The filer returns the checksums of the file blocks. The blocks also found in the existing local file,
+  even at different offsets, are reused, and only the other blocks are downloaded.
+  This saves most of the transfer for large files that change a little between versions.
+
+  `,
+}
+
+var (
+	fetchOutput    = cmdFilerFetch.Flag.String("o", "", "the local file, default to the file name in the current directory")
+	fetchBlockSize = cmdFilerFetch.Flag.Int64("blockSize", delta.DefaultBlockSize, "the block size, smaller blocks find more unchanged data, but with a larger manifest")
+)
+
+func runFilerFetch(cmd *Command, args []string) bool {
+	if len(args) != 1 {
+		return false
+	}
+	fileUrl := args[0]
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		fmt.Printf("parse %s: %v\n", fileUrl, err)
+		return false
+	}
+	localPath := *fetchOutput
+	if localPath == "" {
+		localPath = filepath.Base(u.Path)
+	}
+
+	start := time.Now()
+	fetched, err := delta.Fetch(fileUrl, localPath, *fetchBlockSize)
+	if err != nil {
+		fmt.Printf("fetch %s: %v\n", fileUrl, err)
+		return true
+	}
+	fmt.Printf("fetched %s to %s, downloaded %d bytes in %v\n", fileUrl, localPath, fetched, time.Since(start))
+	return true
+}
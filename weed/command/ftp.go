@@ -0,0 +1,183 @@
+package command
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/ftpd"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/security/users"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	ftpOptions FtpOptions
+)
+
+type FtpOptions struct {
+	filer              *string
+	port               *int
+	collection         *string
+	replication        *string
+	dataCenter         *string
+	chunkSizeMB        *int
+	userFile           *string
+	passiveIp          *string
+	passivePortStart   *int
+	passivePortEnd     *int
+	tlsCertificateFile *string
+	tlsPrivateKeyFile  *string
+	tlsRequired        *bool
+	idleTimeout        *time.Duration
+	cacheDir           *string
+	cacheSizeMB        *int64
+}
+
+func init() {
+	cmdFtp.Run = runFtp // break init cycle
+	ftpOptions.filer = cmdFtp.Flag.String("filer", "localhost:8888", "filer server address")
+	ftpOptions.port = cmdFtp.Flag.Int("port", 2121, "ftp server listen port")
+	ftpOptions.collection = cmdFtp.Flag.String("collection", "", "collection to create the files")
+	ftpOptions.replication = cmdFtp.Flag.String("replication", "", "replication to create the files")
+	ftpOptions.dataCenter = cmdFtp.Flag.String("dataCenter", "", "prefer to write to the data center")
+	ftpOptions.chunkSizeMB = cmdFtp.Flag.Int("chunkSizeLimitMB", 4, "split uploaded files into chunks of this size")
+	ftpOptions.userFile = cmdFtp.Flag.String("userStoreFile", "", "path to the json file of the ftp users")
+	ftpOptions.passiveIp = cmdFtp.Flag.String("passiveIp", "", "the ip address sent to the clients in passive mode, default to the address the clients connected to")
+	ftpOptions.passivePortStart = cmdFtp.Flag.Int("passivePortStart", 0, "the first port of the passive mode data connections, 0 to use any free port")
+	ftpOptions.passivePortEnd = cmdFtp.Flag.Int("passivePortEnd", 0, "the last port of the passive mode data connections")
+	ftpOptions.tlsCertificateFile = cmdFtp.Flag.String("cert.file", "", "path to the TLS certificate file, to support AUTH TLS")
+	ftpOptions.tlsPrivateKeyFile = cmdFtp.Flag.String("key.file", "", "path to the TLS private key file")
+	ftpOptions.tlsRequired = cmdFtp.Flag.Bool("tlsRequired", false, "reject the logins and the data connections without TLS")
+	ftpOptions.idleTimeout = cmdFtp.Flag.Duration("idleTimeout", 5*time.Minute, "close the idle connections after this time")
+	ftpOptions.cacheDir = cmdFtp.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
+	ftpOptions.cacheSizeMB = cmdFtp.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+}
+
+var cmdFtp = &Command{
+	UsageLine: "ftp -port=2121 -filer=<ip:port> -userStoreFile=users.json",
+	Short:     "start an ftp server that is backed by a filer",
+	Long: `start an ftp server that is backed by a filer.
+
+	Only the passive mode is supported. If -cert.file and -key.file are set, the clients can use explicit FTPS with AUTH TLS.
+	Each virtual user can only access its home directory on the filer, and can optionally have a quota.
+	The password can be either a bcrypt hash or plain text.
+	The user store file looks like:
+
+	{
+	  "users": [
+	    {
+	      "username": "scanner",
+	      "password": "$2a$10$...",
+	      "homeDir": "/ftp/scanner",
+	      "uid": 1001,
+	      "gid": 1001,
+	      "readOnly": false,
+	      "quotaMB": 10240
+	    }
+	  ]
+	}
+
+`,
+}
+
+func runFtp(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	return ftpOptions.startFtpServer()
+
+}
+
+func (fo *FtpOptions) startFtpServer() bool {
+
+	if *fo.userFile == "" {
+		glog.Fatalf("ftp server requires -userStoreFile")
+		return false
+	}
+	userStore, err := users.LoadUserStore(*fo.userFile)
+	if err != nil {
+		glog.Fatalf("load ftp users: %v", err)
+		return false
+	}
+
+	var tlsConfig *tls.Config
+	if *fo.tlsCertificateFile != "" {
+		certificate, err := tls.LoadX509KeyPair(*fo.tlsCertificateFile, *fo.tlsPrivateKeyFile)
+		if err != nil {
+			glog.Fatalf("load ftp tls certificate: %v", err)
+			return false
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	} else if *fo.tlsRequired {
+		glog.Fatalf("ftp server requires -cert.file and -key.file for -tlsRequired")
+		return false
+	}
+
+	// parse filer grpc address
+	filerGrpcAddress, err := pb.ParseFilerGrpcAddress(*fo.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	var cipher bool
+	// connect to filer
+	for {
+		err = pb.WithGrpcFilerClient(filerGrpcAddress, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+			if err != nil {
+				return fmt.Errorf("get filer %s configuration: %v", filerGrpcAddress, err)
+			}
+			cipher = resp.Cipher
+			return nil
+		})
+		if err != nil {
+			glog.V(0).Infof("wait to connect to filer %s grpc address %s", *fo.filer, filerGrpcAddress)
+			time.Sleep(time.Second)
+		} else {
+			glog.V(0).Infof("connected to filer %s grpc address %s", *fo.filer, filerGrpcAddress)
+			break
+		}
+	}
+
+	ftpServer := ftpd.NewFtpServer(&ftpd.FtpServerOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   grpcDialOption,
+		Collection:       *fo.collection,
+		Replication:      *fo.replication,
+		DataCenter:       *fo.dataCenter,
+		Cipher:           cipher,
+		ChunkSizeMB:      *fo.chunkSizeMB,
+		CacheDir:         util.ResolvePath(*fo.cacheDir),
+		CacheSizeMB:      *fo.cacheSizeMB,
+		Users:            userStore,
+		PassiveIp:        *fo.passiveIp,
+		PassivePortStart: *fo.passivePortStart,
+		PassivePortEnd:   *fo.passivePortEnd,
+		TlsConfig:        tlsConfig,
+		TlsRequired:      *fo.tlsRequired,
+		IdleTimeout:      *fo.idleTimeout,
+	})
+
+	listenAddress := fmt.Sprintf(":%d", *fo.port)
+	ftpListener, err := util.NewListener(listenAddress, 0)
+	if err != nil {
+		glog.Fatalf("Ftp Server listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed Ftp Server %s at port %d", util.Version(), *fo.port)
+	if err = ftpServer.Serve(ftpListener); err != nil {
+		glog.Fatalf("Ftp Server Fail to serve: %v", err)
+	}
+
+	return true
+
+}
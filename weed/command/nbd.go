@@ -0,0 +1,143 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/nbd"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	nbdOptions NbdOptions
+)
+
+type NbdOptions struct {
+	filer            *string
+	port             *int
+	dir              *string
+	collection       *string
+	replication      *string
+	dataCenter       *string
+	blockSizeMB      *int
+	writeCacheSizeMB *int64
+	newExportSizeMB  *int64
+	readOnly         *bool
+	cacheDir         *string
+	cacheSizeMB      *int64
+}
+
+func init() {
+	cmdNbd.Run = runNbd // break init cycle
+	nbdOptions.filer = cmdNbd.Flag.String("filer", "localhost:8888", "filer server address")
+	nbdOptions.port = cmdNbd.Flag.Int("port", 10809, "nbd server listen port")
+	nbdOptions.dir = cmdNbd.Flag.String("dir", "/nbd", "the filer directory of the exports, one file for each export")
+	nbdOptions.collection = cmdNbd.Flag.String("collection", "", "collection to create the exports")
+	nbdOptions.replication = cmdNbd.Flag.String("replication", "", "replication to create the exports")
+	nbdOptions.dataCenter = cmdNbd.Flag.String("dataCenter", "", "prefer to write to the data center")
+	nbdOptions.blockSizeMB = cmdNbd.Flag.Int("blockSizeMB", 4, "the exports are stored in chunks of this size")
+	nbdOptions.writeCacheSizeMB = cmdNbd.Flag.Int64("writeCacheSizeMB", 64, "the written blocks of each export kept in memory before uploading")
+	nbdOptions.newExportSizeMB = cmdNbd.Flag.Int64("newExportSizeMB", 0, "create the missing exports with this size on connection, 0 to serve only the existing exports")
+	nbdOptions.readOnly = cmdNbd.Flag.Bool("readOnly", false, "serve the exports read only")
+	nbdOptions.cacheDir = cmdNbd.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
+	nbdOptions.cacheSizeMB = cmdNbd.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+}
+
+var cmdNbd = &Command{
+	UsageLine: "nbd -port=10809 -filer=<ip:port> -dir=/nbd",
+	Short:     "start a network block device server that is backed by a filer",
+	Long: `start a network block device server that is backed by a filer.
+
+	Each export is a file in the -dir folder on the filer, with a fixed size.
+	The exports are created on the first connection with -newExportSizeMB, e.g.
+
+	  weed nbd -filer=localhost:8888 -newExportSizeMB=10240
+	  nbd-client -N vm1 localhost 10809 /dev/nbd0
+
+	The written blocks are cached in memory, and uploaded on flush, on FUA writes, or when the cache is full.
+	Connections to the same export share the same cache. Since the cache is local to this server,
+	an export should only be served by one nbd server at a time.
+
+`,
+}
+
+func runNbd(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	return nbdOptions.startNbdServer()
+
+}
+
+func (no *NbdOptions) startNbdServer() bool {
+
+	if *no.blockSizeMB <= 0 {
+		glog.Fatalf("invalid -blockSizeMB %d", *no.blockSizeMB)
+		return false
+	}
+
+	// parse filer grpc address
+	filerGrpcAddress, err := pb.ParseFilerGrpcAddress(*no.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	var cipher bool
+	// connect to filer
+	for {
+		err = pb.WithGrpcFilerClient(filerGrpcAddress, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+			if err != nil {
+				return fmt.Errorf("get filer %s configuration: %v", filerGrpcAddress, err)
+			}
+			cipher = resp.Cipher
+			return nil
+		})
+		if err != nil {
+			glog.V(0).Infof("wait to connect to filer %s grpc address %s", *no.filer, filerGrpcAddress)
+			time.Sleep(time.Second)
+		} else {
+			glog.V(0).Infof("connected to filer %s grpc address %s", *no.filer, filerGrpcAddress)
+			break
+		}
+	}
+
+	nbdServer := nbd.NewNbdServer(&nbd.NbdServerOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   grpcDialOption,
+		Directory:        *no.dir,
+		Collection:       *no.collection,
+		Replication:      *no.replication,
+		DataCenter:       *no.dataCenter,
+		Cipher:           cipher,
+		BlockSizeMB:      *no.blockSizeMB,
+		WriteCacheSizeMB: *no.writeCacheSizeMB,
+		CacheDir:         util.ResolvePath(*no.cacheDir),
+		CacheSizeMB:      *no.cacheSizeMB,
+		NewExportSizeMB:  *no.newExportSizeMB,
+		ReadOnly:         *no.readOnly,
+	})
+
+	listenAddress := fmt.Sprintf(":%d", *no.port)
+	nbdListener, err := util.NewListener(listenAddress, 0)
+	if err != nil {
+		glog.Fatalf("Nbd Server listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed Nbd Server %s at port %d", util.Version(), *no.port)
+	if err = nbdServer.Serve(nbdListener); err != nil {
+		glog.Fatalf("Nbd Server Fail to serve: %v", err)
+	}
+
+	return true
+
+}
@@ -0,0 +1,133 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/nfs"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	nfsOptions NfsOptions
+)
+
+type NfsOptions struct {
+	filer        *string
+	filerPath    *string
+	port         *int
+	collection   *string
+	replication  *string
+	dataCenter   *string
+	chunkSizeMB  *int
+	readOnly     *bool
+	attrCacheTTL *time.Duration
+	cacheDir     *string
+	cacheSizeMB  *int64
+}
+
+func init() {
+	cmdNfs.Run = runNfs // break init cycle
+	nfsOptions.filer = cmdNfs.Flag.String("filer", "localhost:8888", "filer server address")
+	nfsOptions.filerPath = cmdNfs.Flag.String("filer.path", "/", "the filer folder to export")
+	nfsOptions.port = cmdNfs.Flag.Int("port", 2049, "nfs server listen port, for both the nfs and the mount protocol")
+	nfsOptions.collection = cmdNfs.Flag.String("collection", "", "collection to create the files")
+	nfsOptions.replication = cmdNfs.Flag.String("replication", "", "replication to create the files")
+	nfsOptions.dataCenter = cmdNfs.Flag.String("dataCenter", "", "prefer to write to the data center")
+	nfsOptions.chunkSizeMB = cmdNfs.Flag.Int("chunkSizeLimitMB", 4, "split written files into chunks of this size")
+	nfsOptions.readOnly = cmdNfs.Flag.Bool("readOnly", false, "export the folder as read only")
+	nfsOptions.attrCacheTTL = cmdNfs.Flag.Duration("attrCacheTTL", time.Second, "how long to cache the file attributes, 0 to disable")
+	nfsOptions.cacheDir = cmdNfs.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
+	nfsOptions.cacheSizeMB = cmdNfs.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+}
+
+var cmdNfs = &Command{
+	UsageLine: "nfs -port=2049 -filer=<ip:port> -filer.path=/",
+	Short:     "start an NFSv3 server that is backed by a filer",
+	Long: `start an NFSv3 server that is backed by a filer.
+
+	This is for the clients that can not run "weed mount", e.g., appliances with only an nfs client.
+	The nfs and the mount protocols are both served on the same port, and there is no portmapper. To mount:
+
+		mount -t nfs -o vers=3,tcp,port=2049,mountport=2049,nolock <nfs_server>:/ /mnt/seaweedfs
+
+	There is no authentication other than the uid and gid sent by the clients.
+	The written data is uploaded when the clients commit or close the files.
+
+`,
+}
+
+func runNfs(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	return nfsOptions.startNfsServer()
+
+}
+
+func (no *NfsOptions) startNfsServer() bool {
+
+	// parse filer grpc address
+	filerGrpcAddress, err := pb.ParseFilerGrpcAddress(*no.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	var cipher bool
+	// connect to filer
+	for {
+		err = pb.WithGrpcFilerClient(filerGrpcAddress, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+			if err != nil {
+				return fmt.Errorf("get filer %s configuration: %v", filerGrpcAddress, err)
+			}
+			cipher = resp.Cipher
+			return nil
+		})
+		if err != nil {
+			glog.V(0).Infof("wait to connect to filer %s grpc address %s", *no.filer, filerGrpcAddress)
+			time.Sleep(time.Second)
+		} else {
+			glog.V(0).Infof("connected to filer %s grpc address %s", *no.filer, filerGrpcAddress)
+			break
+		}
+	}
+
+	nfsServer := nfs.NewNfsServer(&nfs.NfsServerOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   grpcDialOption,
+		ExportPath:       *no.filerPath,
+		Collection:       *no.collection,
+		Replication:      *no.replication,
+		DataCenter:       *no.dataCenter,
+		Cipher:           cipher,
+		ChunkSizeMB:      *no.chunkSizeMB,
+		CacheDir:         util.ResolvePath(*no.cacheDir),
+		CacheSizeMB:      *no.cacheSizeMB,
+		AttrCacheTTL:     *no.attrCacheTTL,
+		ReadOnly:         *no.readOnly,
+	})
+
+	listenAddress := fmt.Sprintf(":%d", *no.port)
+	nfsListener, err := util.NewListener(listenAddress, 0)
+	if err != nil {
+		glog.Fatalf("Nfs Server listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed Nfs Server %s at port %d, exporting %s", util.Version(), *no.port, *no.filerPath)
+	if err = nfsServer.Serve(nfsListener); err != nil {
+		glog.Fatalf("Nfs Server Fail to serve: %v", err)
+	}
+
+	return true
+
+}
@@ -81,6 +81,14 @@ buckets_fsync = [          # a list of buckets with all write requests fsync=tru
 	"should_always_fsync",
 ]
 
+# when the writes of a collection are acknowledged by the volume servers:
+# "one" after the first copy, "quorum" after a majority of the copies, or "all" after all copies, the default.
+# The remaining copies are written in the background. The level is also passed on to mount,
+# webdav and the other clients assigning file ids through the filer.
+[filer.options.collections_write_ack]
+# important_bucket = "all"
+# logs = "one"
+
 ####################################################
 # The following are filer store options
 ####################################################
@@ -348,6 +356,10 @@ enabled = true
 [https.volume]
 cert = ""
 key  = ""
+# filer server https options, where HTTP/2 is also negotiated
+[https.filer]
+cert = ""
+key  = ""
 
 
 `
@@ -375,6 +387,26 @@ sleep_minutes = 17          # sleep minutes between each script execution
 [master.filer]
 default = "localhost:8888"    # used by maintenance scripts if the scripts needs to use fs related commands
 
+[master.alerting]
+# the leader periodically checks the cluster, and notifies when a condition fires, repeats after the cooldown, or is resolved
+enabled = false
+interval_seconds = 60
+cooldown_minutes = 30
+disk_usage_percent = 90        # a disk is used more than this percentage
+readonly_minutes = 30          # a volume that is not full stays read only longer than this
+replication_lag_minutes = 60   # replicas of a volume were last modified this far apart
+disabled_rules = []            # disk_usage, volume_readonly, replica_missing, ec_shard_missing, replica_lag
+
+[master.alerting.webhook]
+url = ""                       # the alerts are posted as json here
+
+[master.alerting.email]
+smtp_address = ""              # example: "smtp.example.com:587"
+username = ""
+password = ""
+from = "seaweedfs@example.com"
+to = [ "ops@example.com" ]
+
 
 [master.sequencer]
 type = "memory"     # Choose [memory|etcd] type for storing the file id sequence
@@ -79,6 +79,7 @@ func init() {
 	masterOptions.garbageThreshold = cmdServer.Flag.Float64("garbageThreshold", 0.3, "threshold to vacuum and reclaim spaces")
 	masterOptions.metricsAddress = cmdServer.Flag.String("metrics.address", "", "Prometheus gateway address")
 	masterOptions.metricsIntervalSec = cmdServer.Flag.Int("metrics.intervalSeconds", 15, "Prometheus push interval in seconds")
+	masterOptions.eventLogFile = cmdServer.Flag.String("master.eventLog", "", "append topology events to this file")
 
 	filerOptions.collection = cmdServer.Flag.String("filer.collection", "", "all data will be stored in this collection")
 	filerOptions.port = cmdServer.Flag.Int("filer.port", 8888, "filer server http listen port")
@@ -89,6 +90,14 @@ func init() {
 	filerOptions.dirListingLimit = cmdServer.Flag.Int("filer.dirListLimit", 1000, "limit sub dir listing size")
 	filerOptions.cipher = cmdServer.Flag.Bool("filer.encryptVolumeData", false, "encrypt data on volume servers")
 	filerOptions.peers = cmdServer.Flag.String("filer.peers", "", "all filers sharing the same filer store in comma separated ip:port list")
+	filerOptions.contentAddressable = cmdServer.Flag.Bool("filer.cas", false, "index uploaded files by sha256, and serve them at /cas/<sha256>")
+	filerOptions.h2c = cmdServer.Flag.Bool("filer.h2c", false, "also accept HTTP/2 without TLS, i.e., h2c")
+	filerOptions.h2cClient = cmdServer.Flag.Bool("filer.h2c.client", false, "read from and write to volume servers with h2c, which requires -volume.h2c")
+	filerOptions.volumeClient.bindFlags(&cmdServer.Flag, "filer.")
+	filerOptions.chunkMaxSizeMB = cmdServer.Flag.Int("filer.chunk.maxSizeMB", 128, "the chunks of large files grow from filer.maxMB to this size")
+	filerOptions.chunkUploadConcurrency = cmdServer.Flag.Int("filer.chunk.uploadConcurrency", 4, "chunks of one file uploaded to volume servers at the same time")
+	filerOptions.chunkUploadBufferMB = cmdServer.Flag.Int("filer.chunk.uploadBufferMB", 512, "memory limit of the chunks being uploaded, 0 means no limit")
+	filerOptions.readHedgeDelayMs = cmdServer.Flag.Int("filer.read.hedgeDelayMs", 0, "also read from another replica if a replica does not respond within this time, 0 disables the hedged reads")
 
 	serverOptions.v.port = cmdServer.Flag.Int("volume.port", 8080, "volume server http listen port")
 	serverOptions.v.publicPort = cmdServer.Flag.Int("volume.port.public", 0, "volume server public port")
@@ -97,8 +106,12 @@ func init() {
 	serverOptions.v.readRedirect = cmdServer.Flag.Bool("volume.read.redirect", true, "Redirect moved or non-local volumes.")
 	serverOptions.v.compactionMBPerSecond = cmdServer.Flag.Int("volume.compactionMBps", 0, "limit compaction speed in mega bytes per second")
 	serverOptions.v.fileSizeLimitMB = cmdServer.Flag.Int("volume.fileSizeLimitMB", 256, "limit file size to avoid out of memory")
+	serverOptions.v.sendFileMinKB = cmdServer.Flag.Int("volume.sendfile.minKB", 0, "send uncompressed files of at least this size directly from the volume file by sendfile(2), without checking their crc. 0 disables it")
+	serverOptions.v.loadConcurrency = cmdServer.Flag.Int("volume.loadConcurrency", 0, "number of volumes to load in parallel at startup, 0 for 10 per directory")
+	serverOptions.v.lazyLoadIndex = cmdServer.Flag.Bool("volume.index.lazyLoad", false, "load the volume indexes on first access or in the background, to start serving sooner")
 	serverOptions.v.publicUrl = cmdServer.Flag.String("volume.publicUrl", "", "publicly accessible address")
 	serverOptions.v.pprof = &False
+	serverOptions.v.h2c = cmdServer.Flag.Bool("volume.h2c", false, "also accept HTTP/2 without TLS, i.e., h2c")
 
 	s3Options.port = cmdServer.Flag.Int("s3.port", 8333, "s3 server http listen port")
 	s3Options.domainName = cmdServer.Flag.String("s3.domainName", "", "suffix of the host name, {bucket}.{domainName}")
@@ -0,0 +1,153 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/sftpd"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	sftpOptions SftpOptions
+)
+
+type SftpOptions struct {
+	filer       *string
+	port        *int
+	collection  *string
+	replication *string
+	dataCenter  *string
+	chunkSizeMB *int
+	hostKeyFile *string
+	userFile    *string
+	cacheDir    *string
+	cacheSizeMB *int64
+}
+
+func init() {
+	cmdSftp.Run = runSftp // break init cycle
+	sftpOptions.filer = cmdSftp.Flag.String("filer", "localhost:8888", "filer server address")
+	sftpOptions.port = cmdSftp.Flag.Int("port", 2022, "sftp server listen port")
+	sftpOptions.collection = cmdSftp.Flag.String("collection", "", "collection to create the files")
+	sftpOptions.replication = cmdSftp.Flag.String("replication", "", "replication to create the files")
+	sftpOptions.dataCenter = cmdSftp.Flag.String("dataCenter", "", "prefer to write to the data center")
+	sftpOptions.chunkSizeMB = cmdSftp.Flag.Int("chunkSizeLimitMB", 4, "split uploaded files into chunks of this size")
+	sftpOptions.hostKeyFile = cmdSftp.Flag.String("sshPrivateKey", "", "path to the ssh host private key file, a new key is generated on each start if empty")
+	sftpOptions.userFile = cmdSftp.Flag.String("userStoreFile", "", "path to the json file of the sftp users")
+	sftpOptions.cacheDir = cmdSftp.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
+	sftpOptions.cacheSizeMB = cmdSftp.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+}
+
+var cmdSftp = &Command{
+	UsageLine: "sftp -port=2022 -filer=<ip:port> -userStoreFile=users.json",
+	Short:     "start an sftp server that is backed by a filer",
+	Long: `start an sftp server that is backed by a filer.
+
+	Each user logs in with a password or a public key, and can only access its home directory on the filer.
+	The password can be either a bcrypt hash or plain text.
+	The user store file looks like:
+
+	{
+	  "users": [
+	    {
+	      "username": "partner1",
+	      "password": "$2a$10$...",
+	      "publicKeys": ["ssh-ed25519 AAAA... partner1@example.com"],
+	      "homeDir": "/partners/partner1",
+	      "uid": 1001,
+	      "gid": 1001,
+	      "readOnly": false
+	    }
+	  ]
+	}
+
+`,
+}
+
+func runSftp(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	return sftpOptions.startSftpServer()
+
+}
+
+func (so *SftpOptions) startSftpServer() bool {
+
+	if *so.userFile == "" {
+		glog.Fatalf("sftp server requires -userStoreFile")
+		return false
+	}
+	users, err := sftpd.LoadUserStore(*so.userFile)
+	if err != nil {
+		glog.Fatalf("load sftp users: %v", err)
+		return false
+	}
+
+	// parse filer grpc address
+	filerGrpcAddress, err := pb.ParseFilerGrpcAddress(*so.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	var cipher bool
+	// connect to filer
+	for {
+		err = pb.WithGrpcFilerClient(filerGrpcAddress, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+			if err != nil {
+				return fmt.Errorf("get filer %s configuration: %v", filerGrpcAddress, err)
+			}
+			cipher = resp.Cipher
+			return nil
+		})
+		if err != nil {
+			glog.V(0).Infof("wait to connect to filer %s grpc address %s", *so.filer, filerGrpcAddress)
+			time.Sleep(time.Second)
+		} else {
+			glog.V(0).Infof("connected to filer %s grpc address %s", *so.filer, filerGrpcAddress)
+			break
+		}
+	}
+
+	sftpServer, err := sftpd.NewSftpServer(&sftpd.SftpServerOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   grpcDialOption,
+		Collection:       *so.collection,
+		Replication:      *so.replication,
+		DataCenter:       *so.dataCenter,
+		Cipher:           cipher,
+		ChunkSizeMB:      *so.chunkSizeMB,
+		CacheDir:         util.ResolvePath(*so.cacheDir),
+		CacheSizeMB:      *so.cacheSizeMB,
+		HostKeyFile:      *so.hostKeyFile,
+		Users:            users,
+	})
+	if err != nil {
+		glog.Fatalf("Sftp Server startup error: %v", err)
+	}
+
+	listenAddress := fmt.Sprintf(":%d", *so.port)
+	sftpListener, err := util.NewListener(listenAddress, 0)
+	if err != nil {
+		glog.Fatalf("Sftp Server listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed Sftp Server %s at port %d", util.Version(), *so.port)
+	if err = sftpServer.Serve(sftpListener); err != nil {
+		glog.Fatalf("Sftp Server Fail to serve: %v", err)
+	}
+
+	return true
+
+}
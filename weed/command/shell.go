@@ -2,6 +2,7 @@ package command
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/shell"
@@ -11,19 +12,40 @@ import (
 var (
 	shellOptions      shell.ShellOptions
 	shellInitialFiler *string
+	shellScripting    *bool
 )
 
 func init() {
 	cmdShell.Run = runShell // break init cycle
 	shellOptions.Masters = cmdShell.Flag.String("master", "localhost:9333", "comma-separated master servers")
 	shellInitialFiler = cmdShell.Flag.String("filer", "localhost:8888", "filer host and port")
+	shellScripting = cmdShell.Flag.Bool("scripting", false, "use the scripting syntax of the script files in the interactive shell")
 }
 
 var cmdShell = &Command{
-	UsageLine: "shell",
+	UsageLine: "shell [script_file [args]...]",
 	Short:     "run interactive administrative commands",
 	Long: `run interactive administrative commands.
 
+  If a script file is given, the commands in it are executed non-interactively.
+  The script can use variables, for loops, if conditions, and command output capture. The args are available as $1, $2, ...
+
+	lock
+	for vid in 3 5 7
+	  volume.configure.replication -volumeId=$vid -replication=$1
+	end
+	volume.balance -collection=$2 -force
+	if $status != 0
+	  echo "balance failed: $error"
+	  unlock
+	  exit 1
+	end
+	unlock
+
+  With -scripting, the interactive shell also uses this syntax. Otherwise it parses the commands as before.
+  Add --json to any command to print it as a json object, with the structured result of the listing commands,
+  or the text output lines of the other commands, and the error.
+
   `,
 }
 
@@ -39,6 +61,21 @@ func runShell(command *Command, args []string) bool {
 		return false
 	}
 	shellOptions.Directory = "/"
+	shellOptions.Scripting = *shellScripting
+
+	if len(args) > 0 {
+		script, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("failed to open script %s: %v\n", args[0], err)
+			return false
+		}
+		defer script.Close()
+		if err = shell.RunShellScript(shellOptions, script, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		return true
+	}
 
 	shell.RunShell(shellOptions)
 
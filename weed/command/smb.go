@@ -0,0 +1,189 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/jcmturner/gokrb5.v7/keytab"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/smb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+var (
+	smbOptions SmbOptions
+)
+
+type SmbOptions struct {
+	filer           *string
+	port            *int
+	shares          *string
+	userFile        *string
+	keytab          *string
+	serverName      *string
+	domain          *string
+	caseInsensitive *bool
+	requireSigning  *bool
+	collection      *string
+	replication     *string
+	dataCenter      *string
+	chunkSizeMB     *int
+	dirCacheTTL     *time.Duration
+	cacheDir        *string
+	cacheSizeMB     *int64
+}
+
+func init() {
+	cmdSmb.Run = runSmb // break init cycle
+	smbOptions.filer = cmdSmb.Flag.String("filer", "localhost:8888", "filer server address")
+	smbOptions.port = cmdSmb.Flag.Int("port", 445, "smb server listen port")
+	smbOptions.shares = cmdSmb.Flag.String("shares", "", "comma separated shares as name:/filer/dir, or name:/filer/dir:ro for read only")
+	smbOptions.userFile = cmdSmb.Flag.String("userStoreFile", "", "path to the json file of the smb users")
+	smbOptions.keytab = cmdSmb.Flag.String("keytab", "", "kerberos keytab of the cifs/<host> service principal, to accept kerberos besides NTLM")
+	smbOptions.serverName = cmdSmb.Flag.String("serverName", "", "NetBIOS name of the server, default to the host name")
+	smbOptions.domain = cmdSmb.Flag.String("domain", "WORKGROUP", "NetBIOS domain name of the server")
+	smbOptions.caseInsensitive = cmdSmb.Flag.Bool("caseInsensitive", true, "resolve the file names case insensitively, as Windows clients expect")
+	smbOptions.requireSigning = cmdSmb.Flag.Bool("requireSigning", false, "require all sessions to sign the messages")
+	smbOptions.collection = cmdSmb.Flag.String("collection", "", "collection to create the files")
+	smbOptions.replication = cmdSmb.Flag.String("replication", "", "replication to create the files")
+	smbOptions.dataCenter = cmdSmb.Flag.String("dataCenter", "", "prefer to write to the data center")
+	smbOptions.chunkSizeMB = cmdSmb.Flag.Int("chunkSizeLimitMB", 4, "split written files into chunks of this size")
+	smbOptions.dirCacheTTL = cmdSmb.Flag.Duration("dirCacheTTL", 2*time.Second, "how long to cache the directory listings, 0 to disable")
+	smbOptions.cacheDir = cmdSmb.Flag.String("cacheDir", os.TempDir(), "local cache directory for file chunks")
+	smbOptions.cacheSizeMB = cmdSmb.Flag.Int64("cacheCapacityMB", 1000, "local cache capacity in MB")
+}
+
+var cmdSmb = &Command{
+	UsageLine: "smb -port=445 -filer=<ip:port> -shares=data:/buckets/data -userStoreFile=users.json",
+	Short:     "start an SMB2/3 server that is backed by a filer",
+	Long: `start an SMB2/3 server that is backed by a filer, for Windows desktops to map the shares as network drives:
+
+		net use Z: \\<smb_server>\data /user:alice
+
+	The users authenticate with NTLMv2, or with Kerberos if -keytab is given.
+	NTLM needs the plain password or the NT hash of each user, which is md4 of the utf-16le password.
+	Kerberos principals are mapped to the users by "principals", or by the user name.
+	The share "home" is the "homeDir" of each user. Example of the user store file:
+
+	{
+	  "users": [
+	    {
+	      "username": "alice",
+	      "ntHash": "8846f7eaee8fb117ad06bdd830b7586c",
+	      "principals": ["alice@EXAMPLE.COM"],
+	      "homeDir": "/home/alice",
+	      "uid": 1001,
+	      "gid": 1001,
+	      "readOnly": false
+	    }
+	  ]
+	}
+
+	There are no oplocks, change notifications, named pipes or share enumeration.
+	Byte range locks are accepted but not enforced. Files can only be truncated to 0.
+	The written data is uploaded when the clients flush or close the files.
+
+`,
+}
+
+func runSmb(cmd *Command, args []string) bool {
+
+	util.LoadConfiguration("security", false)
+
+	return smbOptions.startSmbServer()
+
+}
+
+func (so *SmbOptions) startSmbServer() bool {
+
+	if *so.userFile == "" {
+		glog.Fatalf("smb server requires -userStoreFile")
+		return false
+	}
+	users, err := smb.LoadUserStore(*so.userFile)
+	if err != nil {
+		glog.Fatalf("load smb users: %v", err)
+		return false
+	}
+	shares, err := smb.ParseShares(*so.shares)
+	if err != nil {
+		glog.Fatalf("smb shares: %v", err)
+		return false
+	}
+	var kt *keytab.Keytab
+	if *so.keytab != "" {
+		if kt, err = keytab.Load(*so.keytab); err != nil {
+			glog.Fatalf("load keytab %s: %v", *so.keytab, err)
+			return false
+		}
+	}
+
+	// parse filer grpc address
+	filerGrpcAddress, err := pb.ParseFilerGrpcAddress(*so.filer)
+	if err != nil {
+		glog.Fatal(err)
+		return false
+	}
+
+	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
+
+	var cipher bool
+	// connect to filer
+	for {
+		err = pb.WithGrpcFilerClient(filerGrpcAddress, grpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			resp, err := client.GetFilerConfiguration(context.Background(), &filer_pb.GetFilerConfigurationRequest{})
+			if err != nil {
+				return fmt.Errorf("get filer %s configuration: %v", filerGrpcAddress, err)
+			}
+			cipher = resp.Cipher
+			return nil
+		})
+		if err != nil {
+			glog.V(0).Infof("wait to connect to filer %s grpc address %s", *so.filer, filerGrpcAddress)
+			time.Sleep(time.Second)
+		} else {
+			glog.V(0).Infof("connected to filer %s grpc address %s", *so.filer, filerGrpcAddress)
+			break
+		}
+	}
+
+	smbServer := smb.NewSmbServer(&smb.SmbServerOption{
+		FilerGrpcAddress: filerGrpcAddress,
+		GrpcDialOption:   grpcDialOption,
+		Collection:       *so.collection,
+		Replication:      *so.replication,
+		DataCenter:       *so.dataCenter,
+		Cipher:           cipher,
+		ChunkSizeMB:      *so.chunkSizeMB,
+		CacheDir:         util.ResolvePath(*so.cacheDir),
+		CacheSizeMB:      *so.cacheSizeMB,
+		Shares:           shares,
+		Users:            users,
+		Keytab:           kt,
+		ServerName:       *so.serverName,
+		Domain:           *so.domain,
+		CaseInsensitive:  *so.caseInsensitive,
+		RequireSigning:   *so.requireSigning,
+		DirCacheTTL:      *so.dirCacheTTL,
+	})
+
+	listenAddress := fmt.Sprintf(":%d", *so.port)
+	smbListener, err := util.NewListener(listenAddress, 0)
+	if err != nil {
+		glog.Fatalf("Smb Server listener on %s error: %v", listenAddress, err)
+	}
+
+	glog.V(0).Infof("Start Seaweed Smb Server %s at port %d, sharing %s", util.Version(), *so.port, *so.shares)
+	if err = smbServer.Serve(smbListener); err != nil {
+		glog.Fatalf("Smb Server Fail to serve: %v", err)
+	}
+
+	return true
+
+}
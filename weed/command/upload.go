@@ -1,14 +1,19 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/chrislusf/seaweedfs/weed/client"
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -25,6 +30,9 @@ type UploadOptions struct {
 	ttl          *string
 	maxMB        *int
 	usePublicUrl *bool
+	ec           *bool
+	ecDir        *string
+	ecVolumeMB   *int
 }
 
 func init() {
@@ -39,6 +47,9 @@ func init() {
 	upload.ttl = cmdUpload.Flag.String("ttl", "", "time to live, e.g.: 1m, 1h, 1d, 1M, 1y")
 	upload.maxMB = cmdUpload.Flag.Int("maxMB", 32, "split files larger than the limit")
 	upload.usePublicUrl = cmdUpload.Flag.Bool("usePublicUrl", false, "upload to public url from volume server")
+	upload.ec = cmdUpload.Flag.Bool("ec", false, "erasure code the files locally and write the ec shards to the volume servers directly")
+	upload.ecDir = cmdUpload.Flag.String("ec.dir", os.TempDir(), "directory to store the local volume before it is erasure coded")
+	upload.ecVolumeMB = cmdUpload.Flag.Int("ec.volumeSizeMB", 1024, "erasure code the local volume when it reaches this size")
 }
 
 var cmdUpload = &Command{
@@ -57,6 +68,10 @@ var cmdUpload = &Command{
   If "maxMB" is set to a positive number, files larger than it would be split into chunks and uploaded separately.
   The list of file ids of those chunks would be stored in an additional chunk, and this additional chunk's file id would be returned.
 
+  If "ec" is set, the files are written into a local volume, which is erasure coded and sent to the
+  volume servers of its ec shards directly, for write-once archival collections.
+  The files can be read after all the files are uploaded. "replication", "ttl" and "maxMB" are ignored.
+
   `,
 }
 
@@ -65,6 +80,10 @@ func runUpload(cmd *Command, args []string) bool {
 	util.LoadConfiguration("security", false)
 	grpcDialOption := security.LoadClientTLS(util.GetViper(), "grpc.client")
 
+	if *upload.ec {
+		return runUploadEc(grpcDialOption, args)
+	}
+
 	if len(args) == 0 {
 		if *upload.dir == "" {
 			return false
@@ -104,3 +123,78 @@ func runUpload(cmd *Command, args []string) bool {
 	}
 	return true
 }
+
+func runUploadEc(grpcDialOption grpc.DialOption, args []string) bool {
+	var files []string
+	if len(args) == 0 {
+		if *upload.dir == "" {
+			return false
+		}
+		filepath.Walk(util.ResolvePath(*upload.dir), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+			if !info.IsDir() {
+				if *upload.include != "" {
+					if ok, _ := filepath.Match(*upload.include, filepath.Base(path)); !ok {
+						return nil
+					}
+				}
+				files = append(files, path)
+			}
+			return nil
+		})
+	} else {
+		files = args
+	}
+
+	c := client.New(&client.Option{
+		Masters:        []string{*upload.master},
+		GrpcDialOption: grpcDialOption,
+		Collection:     *upload.collection,
+	})
+	writer := c.NewEcWriter(util.ResolvePath(*upload.ecDir), *upload.ecVolumeMB)
+	ctx := context.Background()
+
+	var results []operation.SubmitResult
+	for _, file := range files {
+		result := operation.SubmitResult{FileName: file}
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			var putResult *client.PutResult
+			if putResult, err = writer.Write(ctx, file, data); err == nil {
+				result.Fid, result.Size = putResult.FileId, uint32(putResult.Size)
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	err := writer.Flush(ctx)
+	for retry := 1; err != nil && retry < 3; retry++ {
+		fmt.Fprintf(os.Stderr, "flush ec volumes: %v, retrying\n", err)
+		time.Sleep(time.Duration(retry) * time.Second)
+		err = writer.Flush(ctx)
+	}
+	if err != nil {
+		// the files in the failed volumes were written locally, but are not readable
+		failedFileIds := make(map[string]bool)
+		if flushErr, ok := err.(*client.EcFlushError); ok {
+			for _, fileId := range flushErr.FileIds {
+				failedFileIds[fileId] = true
+			}
+		}
+		for i := range results {
+			if results[i].Error == "" && (len(failedFileIds) == 0 || failedFileIds[results[i].Fid]) {
+				results[i].Error = err.Error()
+				results[i].Fid = ""
+			}
+		}
+	}
+
+	bytes, _ := json.Marshal(results)
+	fmt.Println(string(bytes))
+	return true
+}
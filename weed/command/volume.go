@@ -27,6 +27,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/server"
 	"github.com/chrislusf/seaweedfs/weed/storage"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var (
@@ -53,8 +54,12 @@ type VolumeServerOptions struct {
 	memProfile            *string
 	compactionMBPerSecond *int
 	fileSizeLimitMB       *int
+	sendFileMinKB         *int
+	loadConcurrency       *int
+	lazyLoadIndex         *bool
 	minFreeSpacePercents  []float32
 	pprof                 *bool
+	h2c                   *bool
 	// pulseSeconds          *int
 }
 
@@ -77,7 +82,11 @@ func init() {
 	v.memProfile = cmdVolume.Flag.String("memprofile", "", "memory profile output file")
 	v.compactionMBPerSecond = cmdVolume.Flag.Int("compactionMBps", 0, "limit background compaction or copying speed in mega bytes per second")
 	v.fileSizeLimitMB = cmdVolume.Flag.Int("fileSizeLimitMB", 256, "limit file size to avoid out of memory")
+	v.sendFileMinKB = cmdVolume.Flag.Int("sendfile.minKB", 0, "send uncompressed files of at least this size directly from the volume file by sendfile(2), without checking their crc. 0 disables it")
+	v.loadConcurrency = cmdVolume.Flag.Int("loadConcurrency", 0, "number of volumes to load in parallel at startup, 0 for 10 per directory")
+	v.lazyLoadIndex = cmdVolume.Flag.Bool("index.lazyLoad", false, "load the volume indexes on first access or in the background, to start serving sooner")
 	v.pprof = cmdVolume.Flag.Bool("pprof", false, "enable pprof http handlers. precludes --memprofile and --cpuprofile")
+	v.h2c = cmdVolume.Flag.Bool("h2c", false, "also accept HTTP/2 without TLS, i.e., h2c")
 }
 
 var cmdVolume = &Command{
@@ -85,6 +94,9 @@ var cmdVolume = &Command{
 	Short:     "start a volume server",
 	Long: `start a volume server to provide storage spaces
 
+	HTTP/2 is served over TLS on "-port", with the certificate in the [https.volume] section of "security.toml",
+	and over cleartext with "-h2c".
+
   `,
 }
 
@@ -205,6 +217,9 @@ func (v VolumeServerOptions) startVolumeServer(volumeFolders, maxVolumeCounts, v
 		*v.fixJpgOrientation, *v.readRedirect,
 		*v.compactionMBPerSecond,
 		*v.fileSizeLimitMB,
+		*v.sendFileMinKB,
+		*v.loadConcurrency,
+		*v.lazyLoadIndex,
 	)
 
 	// starting grpc server
@@ -295,6 +310,10 @@ func (v VolumeServerOptions) startPublicHttpService(handler http.Handler) httpdo
 		glog.Fatalf("Volume server listener error:%v", e)
 	}
 
+	handler = request_id.Middleware(handler)
+	if *v.h2c {
+		handler = util.NewH2cHandler(handler)
+	}
 	pubHttp := httpdown.HTTP{StopTimeout: 5 * time.Minute, KillTimeout: 5 * time.Minute}
 	publicHttpDown := pubHttp.Serve(&http.Server{Handler: handler}, publicListener)
 	go func() {
@@ -322,6 +341,10 @@ func (v VolumeServerOptions) startClusterHttpService(handler http.Handler) httpd
 		glog.Fatalf("Volume server listener error:%v", e)
 	}
 
+	handler = request_id.Middleware(handler)
+	if *v.h2c {
+		handler = util.NewH2cHandler(handler)
+	}
 	httpDown := httpdown.HTTP{
 		KillTimeout: 5 * time.Minute,
 		StopTimeout: 5 * time.Minute,
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
+)
+
+// VolumeClientOptions tunes the connections from the filer or the mount to the volume servers
+type VolumeClientOptions struct {
+	maxIdlePerHost   *int
+	maxPerHost       *int
+	idleTimeout      *int
+	keepAlive        *int
+	grpcConnsPerHost *int
+	breakerFailures  *int
+	breakerSeconds   *int
+}
+
+func (o *VolumeClientOptions) bindFlags(flags *flag.FlagSet, prefix string) {
+	o.maxIdlePerHost = flags.Int(prefix+"volumeClient.maxIdlePerHost", 1024, "max idle http connections kept to each volume server")
+	o.maxPerHost = flags.Int(prefix+"volumeClient.maxPerHost", 0, "max http connections to each volume server, 0 means no limit")
+	o.idleTimeout = flags.Int(prefix+"volumeClient.idleTimeout", 90, "seconds to close an idle http connection to a volume server")
+	o.keepAlive = flags.Int(prefix+"volumeClient.keepAlive", 30, "seconds between tcp keep-alive probes to a volume server")
+	o.grpcConnsPerHost = flags.Int(prefix+"volumeClient.grpcConnsPerHost", 1, "gRPC connections to each volume server")
+	o.breakerFailures = flags.Int(prefix+"volumeClient.breakerFailures", 5, "skip a volume server after this many failures in a row, 0 to disable")
+	o.breakerSeconds = flags.Int(prefix+"volumeClient.breakerSeconds", 10, "seconds to skip a failed volume server")
+}
+
+// configure lets both the reads and the uploads to the volume servers use the pool
+func (o *VolumeClientOptions) configure(h2c bool) {
+	pool := wdclient.ConfigureVolumeServerPool(wdclient.PoolOption{
+		MaxIdleConnsPerHost: *o.maxIdlePerHost,
+		MaxConnsPerHost:     *o.maxPerHost,
+		IdleConnTimeout:     time.Duration(*o.idleTimeout) * time.Second,
+		KeepAlive:           time.Duration(*o.keepAlive) * time.Second,
+		GrpcConnsPerHost:    *o.grpcConnsPerHost,
+		BreakerFailures:     *o.breakerFailures,
+		BreakerDuration:     time.Duration(*o.breakerSeconds) * time.Second,
+		H2c:                 h2c,
+	})
+	operation.HttpClient = &http.Client{Transport: pool}
+}
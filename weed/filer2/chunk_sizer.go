@@ -0,0 +1,70 @@
+package filer2
+
+import (
+	"sync"
+	"time"
+)
+
+// a chunk upload slower than this stops the chunks from growing
+const slowChunkUpload = 10 * time.Second
+
+// ChunkSizer chooses the sizes of the chunks of one file.
+// The chunks start small, and double in size up to the max size as more data is written,
+// so small files are not in large chunks, and multi-GB streams are not split into too many chunks.
+// Once a chunk is uploaded slowly, the chunks stop growing, so retrying a failed chunk stays cheap.
+type ChunkSizer struct {
+	sync.Mutex
+	next    int64
+	maxSize int64
+}
+
+// NewChunkSizer starts with minSize, or about 1/16 of the total size if it is known
+func NewChunkSizer(minSize, maxSize, totalSize int64) *ChunkSizer {
+	if maxSize < minSize {
+		maxSize = minSize
+	}
+	next := minSize
+	if totalSize/16 > next {
+		next = totalSize / 16
+	}
+	if next > maxSize {
+		next = maxSize
+	}
+	return &ChunkSizer{
+		next:    next,
+		maxSize: maxSize,
+	}
+}
+
+// Size is the size of the next chunk
+func (s *ChunkSizer) Size() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.next
+}
+
+// Next takes the size of the next chunk, and the chunk after it can be larger
+func (s *ChunkSizer) Next() int64 {
+	s.Lock()
+	defer s.Unlock()
+	size := s.next
+	if s.next = size * 2; s.next > s.maxSize {
+		s.next = s.maxSize
+	}
+	return size
+}
+
+// Observe sees how long a chunk takes to upload
+func (s *ChunkSizer) Observe(size int64, elapsed time.Duration) {
+	if elapsed < slowChunkUpload {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if size < s.maxSize {
+		s.maxSize = size
+	}
+	if s.next > s.maxSize {
+		s.next = s.maxSize
+	}
+}
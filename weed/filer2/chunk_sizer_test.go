@@ -0,0 +1,36 @@
+package filer2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChunkSizer(t *testing.T) {
+	s := NewChunkSizer(4, 32, 0)
+	var sizes []int64
+	for i := 0; i < 6; i++ {
+		sizes = append(sizes, s.Next())
+	}
+	expected := []int64{4, 8, 16, 32, 32, 32}
+	for i := range expected {
+		if sizes[i] != expected[i] {
+			t.Fatalf("sizes %v, expected %v", sizes, expected)
+		}
+	}
+
+	// a known total size starts with larger chunks
+	if size := NewChunkSizer(4, 32, 16*10).Size(); size != 10 {
+		t.Errorf("start size %d", size)
+	}
+	if size := NewChunkSizer(4, 32, 16*100).Size(); size != 32 {
+		t.Errorf("start size %d", size)
+	}
+
+	// slow uploads stop the growth
+	s = NewChunkSizer(4, 32, 0)
+	s.Observe(s.Next(), time.Millisecond)
+	s.Observe(s.Next(), slowChunkUpload)
+	if size := s.Next(); size != 8 {
+		t.Errorf("size %d after slow upload", size)
+	}
+}
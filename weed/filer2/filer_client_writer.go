@@ -0,0 +1,217 @@
+package filer2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+type ClientUploadOption struct {
+	Collection  string
+	Replication string
+	TtlSec      int32
+	DataCenter  string
+	Cipher      bool
+}
+
+// SaveDataAsChunkFromClient assigns a file id from the filer, and uploads the data to the volume server
+func SaveDataAsChunkFromClient(filerClient filer_pb.FilerClient, dir string, option *ClientUploadOption) SaveDataAsChunkFunctionType {
+
+	return func(reader io.Reader, filename string, offset int64) (chunk *filer_pb.FileChunk, collection, replication string, err error) {
+		var fileId, fileUrl string
+		var auth security.EncodedJwt
+
+		if err := filerClient.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+
+			request := &filer_pb.AssignVolumeRequest{
+				Count:       1,
+				Replication: option.Replication,
+				Collection:  option.Collection,
+				TtlSec:      option.TtlSec,
+				DataCenter:  option.DataCenter,
+				ParentPath:  dir,
+			}
+
+			resp, err := client.AssignVolume(context.Background(), request)
+			if err != nil {
+				glog.V(0).Infof("assign volume failure %v: %v", request, err)
+				return err
+			}
+			if resp.Error != "" {
+				return fmt.Errorf("assign volume failure %v: %v", request, resp.Error)
+			}
+
+			fileId, auth = resp.FileId, security.EncodedJwt(resp.Auth)
+			fileUrl = resp.UploadUrl(filerClient.AdjustedUrl(resp.Url))
+			collection, replication = resp.Collection, resp.Replication
+
+			return nil
+		}); err != nil {
+			return nil, "", "", fmt.Errorf("filer assign volume: %v", err)
+		}
+
+		uploadResult, err, _ := operation.Upload(fileUrl, filename, option.Cipher, reader, false, "", nil, auth)
+		if err != nil {
+			glog.V(0).Infof("upload data %v to %s: %v", filename, fileUrl, err)
+			return nil, "", "", fmt.Errorf("upload data: %v", err)
+		}
+		if uploadResult.Error != "" {
+			glog.V(0).Infof("upload failure %v to %s: %v", filename, fileUrl, err)
+			return nil, "", "", fmt.Errorf("upload result: %v", uploadResult.Error)
+		}
+
+		return uploadResult.ToPbFileChunk(fileId, offset), collection, replication, nil
+	}
+}
+
+// ClientFileWriter is an io.WriterAt for the gateways that write files through a filer client.
+// Consecutive writes are buffered and uploaded in chunks of chunkSize.
+// The entry with all the chunks is saved to the filer on Flush() and Close().
+type ClientFileWriter struct {
+	filerClient filer_pb.FilerClient
+	fullpath    util.FullPath
+	entry       *filer_pb.Entry
+	chunkSize   int
+	saveFn      SaveDataAsChunkFunctionType
+	buf         []byte
+	bufOffset   int64
+	dirty       bool
+	sync.Mutex
+}
+
+// NewClientFileWriter writes to the entry, which should be already in the filer or be a new entry
+func NewClientFileWriter(filerClient filer_pb.FilerClient, fullpath util.FullPath, entry *filer_pb.Entry, chunkSize int, option *ClientUploadOption) *ClientFileWriter {
+	dir, _ := fullpath.DirAndName()
+	return &ClientFileWriter{
+		filerClient: filerClient,
+		fullpath:    fullpath,
+		entry:       entry,
+		chunkSize:   chunkSize,
+		saveFn:      SaveDataAsChunkFromClient(filerClient, dir, option),
+	}
+}
+
+func (w *ClientFileWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.buf) > 0 && off != w.bufOffset+int64(len(w.buf)) {
+		if err = w.uploadBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	if len(w.buf) == 0 {
+		w.bufOffset = off
+	}
+	w.buf = append(w.buf, p...)
+	w.dirty = true
+	for len(w.buf) >= w.chunkSize {
+		if err = w.uploadData(w.buf[:w.chunkSize], w.bufOffset); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[w.chunkSize:]...)
+		w.bufOffset += int64(w.chunkSize)
+	}
+	return len(p), nil
+}
+
+// Truncate only supports truncating to 0 length
+func (w *ClientFileWriter) Truncate(size int64) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if size != 0 {
+		return fmt.Errorf("truncate %s to %d: only truncating to 0 is supported", w.fullpath, size)
+	}
+	w.buf = w.buf[:0]
+	w.entry.Chunks = nil
+	w.dirty = true
+	return nil
+}
+
+func (w *ClientFileWriter) Flush() error {
+	w.Lock()
+	defer w.Unlock()
+	return w.flush()
+}
+
+func (w *ClientFileWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	err := w.flush()
+	w.buf = nil
+	return err
+}
+
+func (w *ClientFileWriter) flush() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.uploadBuffer(); err != nil {
+		return err
+	}
+
+	chunks, err := MaybeManifestize(w.saveFn, w.entry.Chunks)
+	if err != nil {
+		return fmt.Errorf("manifestize %s: %v", w.fullpath, err)
+	}
+	w.entry.Chunks = chunks
+	if w.entry.Attributes == nil {
+		w.entry.Attributes = &filer_pb.FuseAttributes{}
+	}
+	w.entry.Attributes.Mtime = time.Now().Unix()
+	if w.entry.Attributes.Crtime == 0 {
+		w.entry.Attributes.Crtime = w.entry.Attributes.Mtime
+	}
+
+	dir, _ := w.fullpath.DirAndName()
+	err = w.filerClient.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+			Directory: dir,
+			Entry:     w.entry,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("save %s: %v", w.fullpath, err)
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *ClientFileWriter) uploadBuffer() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if err := w.uploadData(w.buf, w.bufOffset); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *ClientFileWriter) uploadData(data []byte, offset int64) error {
+	chunk, collection, replication, err := w.saveFn(bytes.NewReader(data), w.fullpath.Name(), offset)
+	if err != nil {
+		return fmt.Errorf("upload %s [%d,%d): %v", w.fullpath, offset, offset+int64(len(data)), err)
+	}
+	w.entry.Chunks = append(w.entry.Chunks, chunk)
+	if w.entry.Attributes == nil {
+		w.entry.Attributes = &filer_pb.FuseAttributes{}
+	}
+	if collection != "" {
+		w.entry.Attributes.Collection = collection
+	}
+	if replication != "" {
+		w.entry.Attributes.Replication = replication
+	}
+	return nil
+}
@@ -12,8 +12,12 @@ import (
 func LookupByMasterClientFn(masterClient *wdclient.MasterClient) func(vids []string) (map[string]operation.LookupResult, error) {
 	return func(vids []string) (map[string]operation.LookupResult, error) {
 		m := make(map[string]operation.LookupResult)
+		vid2Locations, err := masterClient.LookupVolumeIds(vids)
+		if err != nil {
+			glog.V(0).Infof("lookup volumes %v: %v", vids, err)
+		}
 		for _, vid := range vids {
-			locs, _ := masterClient.GetVidLocations(vid)
+			locs := vid2Locations[vid]
 			var locations []operation.Location
 			for _, loc := range locs {
 				locations = append(locations, operation.Location{
@@ -54,7 +54,7 @@ func (f *Filer) assignAndUpload(data []byte) (*operation.AssignResult, *operatio
 		Replication:         f.metaLogReplication,
 		WritableVolumeCount: 1,
 	}
-	assignResult, err := operation.Assign(f.GetMaster(), f.GrpcDialOption, assignRequest)
+	assignResult, err := operation.Assign(context.Background(), f.GetMaster(), f.GrpcDialOption, assignRequest)
 	if err != nil {
 		return nil, nil, fmt.Errorf("AssignVolume: %v", err)
 	}
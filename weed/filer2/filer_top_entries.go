@@ -0,0 +1,157 @@
+package filer2
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// a smaller page, since one page is kept in memory for each level of the walk
+const topEntriesPageSize = 1024
+
+type SizedEntry struct {
+	FullPath  util.FullPath
+	Size      uint64
+	FileCount uint64
+	Mtime     time.Time
+}
+
+// TopEntries are the largest files and directories under a directory.
+// The size of a directory includes all its sub directories.
+type TopEntries struct {
+	Files          []SizedEntry
+	Directories    []SizedEntry
+	TotalSize      uint64
+	FileCount      uint64
+	DirectoryCount uint64
+	Truncated      bool // the walk stopped before visiting all entries
+	ComputedAt     time.Time
+}
+
+// CollectTopEntries walks the directory tree and keeps the largest limit files and directories.
+// If maxEntries > 0, the walk stops after visiting that many entries, so the result is only a sample.
+func (f *Filer) CollectTopEntries(ctx context.Context, p util.FullPath, limit int, maxEntries uint64) (*TopEntries, error) {
+	c := &topEntriesCollector{
+		filer:      f,
+		limit:      limit,
+		maxEntries: maxEntries,
+	}
+	size, fileCount, err := c.walk(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &TopEntries{
+		Files:          c.files.sorted(),
+		Directories:    c.directories.sorted(),
+		TotalSize:      size,
+		FileCount:      fileCount,
+		DirectoryCount: c.directoryCount,
+		Truncated:      c.truncated,
+		ComputedAt:     time.Now(),
+	}, nil
+}
+
+type topEntriesCollector struct {
+	filer          *Filer
+	limit          int
+	maxEntries     uint64
+	visited        uint64
+	directoryCount uint64
+	truncated      bool
+	files          sizedEntryHeap
+	directories    sizedEntryHeap
+}
+
+func (c *topEntriesCollector) walk(ctx context.Context, dir util.FullPath) (size, fileCount uint64, err error) {
+
+	var lastModified time.Time
+	lastFileName := ""
+	for !c.truncated {
+		entries, listErr := c.filer.ListDirectoryEntries(ctx, dir, lastFileName, false, topEntriesPageSize)
+		if listErr != nil {
+			return 0, 0, listErr
+		}
+		for _, entry := range entries {
+			lastFileName = entry.FullPath.Name()
+			if c.maxEntries > 0 && c.visited >= c.maxEntries {
+				c.truncated = true
+				break
+			}
+			c.visited++
+			if entry.Mtime.After(lastModified) {
+				lastModified = entry.Mtime
+			}
+			if entry.IsDirectory() {
+				subSize, subCount, walkErr := c.walk(ctx, entry.FullPath)
+				if walkErr != nil {
+					return 0, 0, walkErr
+				}
+				size += subSize
+				fileCount += subCount
+				continue
+			}
+			entrySize := entry.Size()
+			size += entrySize
+			fileCount++
+			c.files.offer(c.limit, SizedEntry{
+				FullPath:  entry.FullPath,
+				Size:      entrySize,
+				FileCount: 1,
+				Mtime:     entry.Mtime,
+			})
+		}
+		if len(entries) < topEntriesPageSize {
+			break
+		}
+	}
+
+	c.directoryCount++
+	c.directories.offer(c.limit, SizedEntry{
+		FullPath:  dir,
+		Size:      size,
+		FileCount: fileCount,
+		Mtime:     lastModified,
+	})
+
+	return size, fileCount, nil
+}
+
+// sizedEntryHeap is a min heap, so the smallest of the kept entries is dropped first
+type sizedEntryHeap []SizedEntry
+
+func (h sizedEntryHeap) Len() int            { return len(h) }
+func (h sizedEntryHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h sizedEntryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sizedEntryHeap) Push(x interface{}) { *h = append(*h, x.(SizedEntry)) }
+func (h *sizedEntryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+func (h *sizedEntryHeap) offer(limit int, e SizedEntry) {
+	if limit <= 0 {
+		return
+	}
+	if h.Len() < limit {
+		heap.Push(h, e)
+		return
+	}
+	if (*h)[0].Size < e.Size {
+		(*h)[0] = e
+		heap.Fix(h, 0)
+	}
+}
+
+func (h sizedEntryHeap) sorted() []SizedEntry {
+	ret := append([]SizedEntry{}, h...)
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Size > ret[j].Size
+	})
+	return ret
+}
@@ -0,0 +1,21 @@
+package filer2
+
+import (
+	"testing"
+)
+
+func TestSizedEntryHeapKeepsLargest(t *testing.T) {
+	var h sizedEntryHeap
+	for _, size := range []uint64{5, 1, 9, 3, 7, 2, 8} {
+		h.offer(3, SizedEntry{Size: size})
+	}
+	sorted := h.sorted()
+	if len(sorted) != 3 {
+		t.Fatalf("kept %d entries, expected 3", len(sorted))
+	}
+	for i, size := range []uint64{9, 8, 7} {
+		if sorted[i].Size != size {
+			t.Errorf("entry %d: size %d, expected %d", i, sorted[i].Size, size)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"sync"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -64,6 +65,12 @@ func NewChunkReaderAtFromClient(filerClient filer_pb.FilerClient, chunkViews []*
 	}
 }
 
+// NewChunkReaderAtForEntry reads the whole content of the entry
+func NewChunkReaderAtForEntry(filerClient filer_pb.FilerClient, entry *filer_pb.Entry, chunkCache *chunk_cache.ChunkCache) *ChunkReadAt {
+	chunkViews := ViewFromChunks(LookupFn(filerClient), entry.Chunks, 0, math.MaxInt64)
+	return NewChunkReaderAtFromClient(filerClient, chunkViews, chunkCache)
+}
+
 func (c *ChunkReadAt) ReadAt(p []byte, offset int64) (n int, err error) {
 
 	c.readerLock.Lock()
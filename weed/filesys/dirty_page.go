@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chrislusf/seaweedfs/weed/filer2"
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 )
@@ -16,12 +17,14 @@ type ContinuousDirtyPages struct {
 	lock        sync.Mutex
 	collection  string
 	replication string
+	chunkSizer  *filer2.ChunkSizer
 }
 
 func newDirtyPages(file *File) *ContinuousDirtyPages {
 	return &ContinuousDirtyPages{
-		intervals: &ContinuousIntervals{},
-		f:         file,
+		intervals:  &ContinuousIntervals{},
+		f:          file,
+		chunkSizer: filer2.NewChunkSizer(file.wfs.option.ChunkSizeLimit, file.wfs.option.ChunkSizeMax, 0),
 	}
 }
 
@@ -37,7 +40,8 @@ func (pages *ContinuousDirtyPages) AddPage(offset int64, data []byte) (chunks []
 
 	glog.V(3).Infof("%s AddPage [%d,%d)", pages.f.fullpath(), offset, offset+int64(len(data)))
 
-	if len(data) > int(pages.f.wfs.option.ChunkSizeLimit) {
+	chunkSize := pages.chunkSizer.Size()
+	if int64(len(data)) > chunkSize {
 		// this is more than what buffer can hold.
 		return pages.flushAndSave(offset, data)
 	}
@@ -47,7 +51,7 @@ func (pages *ContinuousDirtyPages) AddPage(offset int64, data []byte) (chunks []
 	var chunk *filer_pb.FileChunk
 	var hasSavedData bool
 
-	if pages.intervals.TotalSize() > pages.f.wfs.option.ChunkSizeLimit {
+	if pages.intervals.TotalSize() > chunkSize {
 		chunk, hasSavedData, err = pages.saveExistingLargestPageToStorage()
 		if hasSavedData {
 			chunks = append(chunks, chunk)
@@ -139,12 +143,17 @@ func (pages *ContinuousDirtyPages) saveToStorage(reader io.Reader, offset int64,
 
 	dir, _ := pages.f.fullpath().DirAndName()
 
+	start := time.Now()
 	chunk, collection, replication, err := pages.f.wfs.saveDataAsChunk(dir)(reader, pages.f.Name, offset)
 	if err != nil {
 		return nil, err
 	}
 	pages.collection, pages.replication = collection, replication
 
+	// the later chunks can be larger
+	pages.chunkSizer.Next()
+	pages.chunkSizer.Observe(size, time.Since(start))
+
 	return chunk, nil
 
 }
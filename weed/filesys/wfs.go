@@ -31,6 +31,7 @@ type Option struct {
 	Replication        string
 	TtlSec             int32
 	ChunkSizeLimit     int64
+	ChunkSizeMax       int64 // the chunks grow from ChunkSizeLimit to ChunkSizeMax, if larger
 	CacheDir           string
 	CacheSizeMB        int64
 	DataCenter         string
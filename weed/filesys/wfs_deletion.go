@@ -41,7 +41,7 @@ func (wfs *WFS) deleteFileIds(grpcDialOption grpc.DialOption, client filer_pb.Se
 		glog.V(4).Infof("remove file lookup volume id locations: %v", vids)
 		resp, err := client.LookupVolume(context.Background(), &filer_pb.LookupVolumeRequest{
 			VolumeIds: vids,
-		})
+		}, filer_pb.CompressedCall)
 		if err != nil {
 			return m, err
 		}
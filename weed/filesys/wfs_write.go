@@ -15,7 +15,7 @@ import (
 func (wfs *WFS) saveDataAsChunk(dir string) filer2.SaveDataAsChunkFunctionType {
 
 	return func(reader io.Reader, filename string, offset int64) (chunk *filer_pb.FileChunk, collection, replication string, err error) {
-		var fileId, host string
+		var fileId, fileUrl string
 		var auth security.EncodedJwt
 
 		if err := wfs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
@@ -38,8 +38,8 @@ func (wfs *WFS) saveDataAsChunk(dir string) filer2.SaveDataAsChunkFunctionType {
 				return fmt.Errorf("assign volume failure %v: %v", request, resp.Error)
 			}
 
-			fileId, host, auth = resp.FileId, resp.Url, security.EncodedJwt(resp.Auth)
-			host = wfs.AdjustedUrl(host)
+			fileId, auth = resp.FileId, security.EncodedJwt(resp.Auth)
+			fileUrl = resp.UploadUrl(wfs.AdjustedUrl(resp.Url))
 			collection, replication = resp.Collection, resp.Replication
 
 			return nil
@@ -47,7 +47,6 @@ func (wfs *WFS) saveDataAsChunk(dir string) filer2.SaveDataAsChunkFunctionType {
 			return nil, "", "", fmt.Errorf("filerGrpcAddress assign volume: %v", err)
 		}
 
-		fileUrl := fmt.Sprintf("http://%s/%s", host, fileId)
 		uploadResult, err, data := operation.Upload(fileUrl, filename, wfs.option.Cipher, reader, false, "", nil, auth)
 		if err != nil {
 			glog.V(0).Infof("upload data %v to %s: %v", filename, fileUrl, err)
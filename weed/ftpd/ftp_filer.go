@@ -0,0 +1,277 @@
+package ftpd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// listTarget skips the "ls" options, e.g., "LIST -al"
+func listTarget(arg string) string {
+	for _, field := range strings.Fields(arg) {
+		if !strings.HasPrefix(field, "-") {
+			return field
+		}
+	}
+	return ""
+}
+
+// listEntries returns the children of a directory, or the entry itself if it is a file
+func (c *ftpSession) listEntries(arg string) ([]*filer_pb.Entry, error) {
+	_, filerPath := c.resolve(listTarget(arg))
+	entry, err := c.lookup(filerPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	if !entry.IsDirectory {
+		entry.Name = filerPath.Name()
+		return []*filer_pb.Entry{entry}, nil
+	}
+	var entries []*filer_pb.Entry
+	err = filer_pb.ReadDirAllEntries(c.server, filerPath, "", func(entry *filer_pb.Entry, isLast bool) error {
+		if entry.Attributes == nil {
+			entry.Attributes = &filer_pb.FuseAttributes{}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+func (c *ftpSession) cmdList(arg string) {
+	c.list(arg, formatListLine)
+}
+
+func (c *ftpSession) cmdNlst(arg string) {
+	c.list(arg, func(entry *filer_pb.Entry) string {
+		return entry.Name
+	})
+}
+
+func (c *ftpSession) cmdMlsd(arg string) {
+	c.list(arg, func(entry *filer_pb.Entry) string {
+		return formatFacts(entry) + " " + entry.Name
+	})
+}
+
+func (c *ftpSession) list(arg string, format func(entry *filer_pb.Entry) string) {
+	entries, err := c.listEntries(arg)
+	if err != nil {
+		c.reply(550, "%s: No such file or directory", listTarget(arg))
+		return
+	}
+	c.transfer(func(dataConn net.Conn) (int, string) {
+		w := bufio.NewWriter(dataConn)
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\r\n", format(entry))
+		}
+		if err := w.Flush(); err != nil {
+			return 426, "Connection closed, transfer aborted"
+		}
+		return 226, "Transfer complete"
+	})
+}
+
+func (c *ftpSession) cmdMlst(arg string) {
+	p, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil {
+		c.reply(550, "%s: No such file or directory", arg)
+		return
+	}
+	c.replyLines(250, "Listing "+p, []string{formatFacts(entry) + " " + p}, "End")
+}
+
+func formatListLine(entry *filer_pb.Entry) string {
+	mode := os.FileMode(entry.Attributes.FileMode)
+	if entry.IsDirectory {
+		mode |= os.ModeDir
+	}
+	size := filer2.TotalSize(entry.Chunks)
+	mtime := time.Unix(entry.Attributes.Mtime, 0)
+	timeFormat := "Jan _2 15:04"
+	if time.Since(mtime) > 180*24*time.Hour {
+		timeFormat = "Jan _2  2006"
+	}
+	return fmt.Sprintf("%s 1 %d %d %12d %s %s", mode.String(), entry.Attributes.Uid, entry.Attributes.Gid, size, mtime.Format(timeFormat), entry.Name)
+}
+
+func formatFacts(entry *filer_pb.Entry) string {
+	fileType := "file"
+	if entry.IsDirectory {
+		fileType = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s;", fileType, filer2.TotalSize(entry.Chunks),
+		time.Unix(entry.Attributes.Mtime, 0).UTC().Format("20060102150405"))
+}
+
+func (c *ftpSession) cmdRetr(arg string) {
+	_, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil || entry.IsDirectory {
+		c.reply(550, "%s: No such file", arg)
+		return
+	}
+	size := int64(filer2.TotalSize(entry.Chunks))
+	offset := c.restOffset
+	if offset > size {
+		c.reply(554, "Restart offset %d is beyond the file size %d", offset, size)
+		return
+	}
+	c.transfer(func(dataConn net.Conn) (int, string) {
+		reader := filer2.NewChunkReaderAtForEntry(c.server, entry, c.server.chunkCache)
+		if _, err := io.Copy(dataConn, io.NewSectionReader(reader, offset, size-offset)); err != nil {
+			glog.V(0).Infof("ftp %s read %s: %v", c.username, filerPath, err)
+			return 426, "Connection closed, transfer aborted"
+		}
+		return 226, "Transfer complete"
+	})
+}
+
+func (c *ftpSession) cmdStor(arg string) {
+	c.store(arg, false)
+}
+
+func (c *ftpSession) cmdAppe(arg string) {
+	c.store(arg, true)
+}
+
+// store writes the file from the offset of REST, or appends to the end of the file.
+// The received data is kept even if the transfer is interrupted, so the client can resume it later.
+func (c *ftpSession) store(arg string, isAppend bool) {
+	if !c.checkWritable() {
+		return
+	}
+	_, filerPath := c.resolve(arg)
+	existing, err := c.lookup(filerPath)
+	if err != nil {
+		glog.Errorf("ftp %s lookup %s: %v", c.username, filerPath, err)
+		c.reply(451, "Lookup %s failed", arg)
+		return
+	}
+	if existing != nil && existing.IsDirectory {
+		c.reply(550, "%s is a directory", arg)
+		return
+	}
+
+	var existingSize int64
+	if existing != nil {
+		existingSize = int64(filer2.TotalSize(existing.Chunks))
+	}
+	offset := c.restOffset
+	if isAppend {
+		offset = existingSize
+	}
+	if offset > existingSize {
+		c.reply(554, "Restart offset %d is beyond the file size %d", offset, existingSize)
+		return
+	}
+
+	var usage *quotaUsage
+	if c.user.QuotaMB > 0 {
+		if usage, err = c.server.getQuotaUsage(c.user); err != nil {
+			glog.Errorf("ftp %s: %v", c.username, err)
+			c.reply(451, "Quota is not available")
+			return
+		}
+	}
+
+	entry := existing
+	var released int64
+	if entry == nil || offset == 0 {
+		now := time.Now().Unix()
+		entry = &filer_pb.Entry{
+			Name: filerPath.Name(),
+			Attributes: &filer_pb.FuseAttributes{
+				Mtime:       now,
+				Crtime:      now,
+				FileMode:    0644,
+				Uid:         c.user.Uid,
+				Gid:         c.user.Gid,
+				Collection:  c.server.option.Collection,
+				Replication: c.server.option.Replication,
+			},
+		}
+		if usage != nil {
+			usage.reserve(c.user, -existingSize)
+		}
+		released, existingSize = existingSize, 0
+	}
+
+	c.transfer(func(dataConn net.Conn) (int, string) {
+		code, message, written := c.receive(dataConn, filerPath, entry, offset, existingSize, released, usage)
+		glog.V(1).Infof("ftp %s wrote %d bytes to %s", c.username, written, filerPath)
+		return code, message
+	})
+}
+
+// receive writes the data to the file of the size, starting at the offset.
+// The growth of the file is reserved from the quota while receiving, and corrected to the size saved after the transfer,
+// or given back if the file is not saved. released is the size of the overwritten file, already given back.
+func (c *ftpSession) receive(dataConn net.Conn, filerPath util.FullPath, entry *filer_pb.Entry, offset, size, released int64, usage *quotaUsage) (code int, message string, written int64) {
+	writer := filer2.NewClientFileWriter(c.server, filerPath, entry, c.server.option.ChunkSizeMB*1024*1024, c.server.uploadOption())
+	if offset == 0 && size == 0 {
+		// create the file even if it is empty
+		writer.Truncate(0)
+	}
+
+	initialSize, reserved := size, int64(0)
+	code, message = 226, "Transfer complete"
+	buf := make([]byte, 64*1024)
+	for {
+		n, readErr := dataConn.Read(buf)
+		if n > 0 {
+			growth := offset + int64(n) - size
+			if usage != nil && growth > 0 && !usage.reserve(c.user, growth) {
+				code, message = 552, "Quota exceeded, transfer aborted"
+				break
+			}
+			if growth > 0 {
+				if usage != nil {
+					reserved += growth
+				}
+				size += growth
+			}
+			if _, err := writer.WriteAt(buf[:n], offset); err != nil {
+				glog.Errorf("ftp %s write %s: %v", c.username, filerPath, err)
+				code, message = 451, "Write failed, transfer aborted"
+				break
+			}
+			offset += int64(n)
+			written += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			glog.V(0).Infof("ftp %s receive %s: %v", c.username, filerPath, readErr)
+			code, message = 426, "Connection closed, transfer aborted"
+			break
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		glog.Errorf("ftp %s save %s: %v", c.username, filerPath, err)
+		if usage != nil {
+			// the file keeps its previous content
+			usage.adjust(released - reserved)
+		}
+		return 451, "Save failed", written
+	}
+	if usage != nil {
+		usage.adjust(int64(filer2.TotalSize(entry.Chunks)) - initialSize - reserved)
+	}
+	return
+}
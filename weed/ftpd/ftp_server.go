@@ -0,0 +1,191 @@
+package ftpd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security/users"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+type FtpServerOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	Collection       string
+	Replication      string
+	DataCenter       string
+	Cipher           bool
+	ChunkSizeMB      int
+	CacheDir         string
+	CacheSizeMB      int64
+	Users            *users.UserStore
+	// the ip address in the PASV replies, default to the address the client connected to
+	PassiveIp        string
+	PassivePortStart int
+	PassivePortEnd   int
+	TlsConfig        *tls.Config
+	// reject USER before AUTH TLS
+	TlsRequired bool
+	IdleTimeout time.Duration
+}
+
+type FtpServer struct {
+	option     *FtpServerOption
+	chunkCache *chunk_cache.ChunkCache
+
+	quotas     map[string]*quotaUsage
+	quotasLock sync.Mutex
+
+	nextPassivePort int
+	passiveLock     sync.Mutex
+}
+
+// quotaUsage is the total file size under the home dir of one user.
+// It is counted when the quota is first checked, and then adjusted by the uploads and deletions on this server.
+type quotaUsage struct {
+	used int64
+	sync.Mutex
+}
+
+var _ = filer_pb.FilerClient(&FtpServer{})
+
+func NewFtpServer(option *FtpServerOption) *FtpServer {
+	return &FtpServer{
+		option:          option,
+		chunkCache:      chunk_cache.NewChunkCache(256, option.CacheDir, option.CacheSizeMB),
+		quotas:          make(map[string]*quotaUsage),
+		nextPassivePort: option.PassivePortStart,
+	}
+}
+
+func (s *FtpServer) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, s.option.FilerGrpcAddress, s.option.GrpcDialOption)
+
+}
+
+func (s *FtpServer) AdjustedUrl(hostAndPort string) string {
+	return hostAndPort
+}
+
+func (s *FtpServer) uploadOption() *filer2.ClientUploadOption {
+	return &filer2.ClientUploadOption{
+		Collection:  s.option.Collection,
+		Replication: s.option.Replication,
+		DataCenter:  s.option.DataCenter,
+		Cipher:      s.option.Cipher,
+	}
+}
+
+func (s *FtpServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go newFtpSession(s, conn).serve()
+	}
+}
+
+// listenPassive listens on the next free port of the passive port range, or any free port without a range
+func (s *FtpServer) listenPassive(ip string) (net.Listener, error) {
+	if s.option.PassivePortStart <= 0 || s.option.PassivePortEnd < s.option.PassivePortStart {
+		return net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	}
+	s.passiveLock.Lock()
+	defer s.passiveLock.Unlock()
+	count := s.option.PassivePortEnd - s.option.PassivePortStart + 1
+	for i := 0; i < count; i++ {
+		port := s.nextPassivePort
+		s.nextPassivePort++
+		if s.nextPassivePort > s.option.PassivePortEnd {
+			s.nextPassivePort = s.option.PassivePortStart
+		}
+		if listener, err := net.Listen("tcp", net.JoinHostPort(ip, fmt.Sprintf("%d", port))); err == nil {
+			return listener, nil
+		}
+	}
+	return nil, fmt.Errorf("no free passive port in %d-%d", s.option.PassivePortStart, s.option.PassivePortEnd)
+}
+
+func (s *FtpServer) ensureHomeDir(user *users.User) error {
+	entry, err := filer_pb.GetEntry(s, util.FullPath(user.HomeDir))
+	if err != nil {
+		return fmt.Errorf("lookup home dir %s: %v", user.HomeDir, err)
+	}
+	if entry != nil {
+		return nil
+	}
+	dir, name := util.FullPath(user.HomeDir).DirAndName()
+	return filer_pb.Mkdir(s, dir, name, func(entry *filer_pb.Entry) {
+		entry.Attributes.Uid = user.Uid
+		entry.Attributes.Gid = user.Gid
+	})
+}
+
+func (s *FtpServer) getQuotaUsage(user *users.User) (*quotaUsage, error) {
+	s.quotasLock.Lock()
+	usage, found := s.quotas[user.Username]
+	if !found {
+		usage = &quotaUsage{used: -1}
+		s.quotas[user.Username] = usage
+	}
+	s.quotasLock.Unlock()
+
+	usage.Lock()
+	defer usage.Unlock()
+	if usage.used >= 0 {
+		return usage, nil
+	}
+	used, err := s.countUsage(util.FullPath(user.HomeDir))
+	if err != nil {
+		return nil, fmt.Errorf("count usage of %s: %v", user.HomeDir, err)
+	}
+	glog.V(1).Infof("ftp %s uses %d bytes", user.Username, used)
+	usage.used = used
+	return usage, nil
+}
+
+func (s *FtpServer) countUsage(dir util.FullPath) (used int64, err error) {
+	err = filer_pb.ReadDirAllEntries(s, dir, "", func(entry *filer_pb.Entry, isLast bool) error {
+		if entry.IsDirectory {
+			dirUsed, err := s.countUsage(dir.Child(entry.Name))
+			used += dirUsed
+			return err
+		}
+		used += int64(filer2.TotalSize(entry.Chunks))
+		return nil
+	})
+	return
+}
+
+// reserve adds the delta to the usage, and returns false if the quota is exceeded
+func (usage *quotaUsage) reserve(user *users.User, delta int64) bool {
+	usage.Lock()
+	defer usage.Unlock()
+	if delta > 0 && user.QuotaMB > 0 && usage.used+delta > user.QuotaMB*1024*1024 {
+		return false
+	}
+	usage.used += delta
+	return true
+}
+
+// adjust corrects the usage by the delta, regardless of the quota
+func (usage *quotaUsage) adjust(delta int64) {
+	usage.Lock()
+	defer usage.Unlock()
+	usage.used += delta
+}
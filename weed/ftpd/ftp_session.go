@@ -0,0 +1,586 @@
+package ftpd
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security/users"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// the ftp commands of RFC 959, with the extensions of RFC 2228 (AUTH TLS), RFC 2428 (EPSV), and RFC 3659 (SIZE, MDTM, REST, MLSD)
+
+type ftpSession struct {
+	server      *FtpServer
+	conn        net.Conn
+	reader      *bufio.Reader
+	username    string
+	user        *users.User
+	cwd         string
+	restOffset  int64
+	renameFrom  string
+	passive     net.Listener
+	isTls       bool
+	protectData bool
+}
+
+type ftpCommand struct {
+	fn            func(c *ftpSession, arg string)
+	requiresLogin bool
+}
+
+var ftpCommands map[string]*ftpCommand
+
+func init() {
+	ftpCommands = map[string]*ftpCommand{
+		"USER": {(*ftpSession).cmdUser, false},
+		"PASS": {(*ftpSession).cmdPass, false},
+		"AUTH": {(*ftpSession).cmdAuth, false},
+		"PBSZ": {(*ftpSession).cmdPbsz, false},
+		"PROT": {(*ftpSession).cmdProt, false},
+		"FEAT": {(*ftpSession).cmdFeat, false},
+		"SYST": {(*ftpSession).cmdSyst, false},
+		"OPTS": {(*ftpSession).cmdOpts, false},
+		"NOOP": {(*ftpSession).cmdNoop, false},
+		"PWD":  {(*ftpSession).cmdPwd, true},
+		"XPWD": {(*ftpSession).cmdPwd, true},
+		"CWD":  {(*ftpSession).cmdCwd, true},
+		"XCWD": {(*ftpSession).cmdCwd, true},
+		"CDUP": {(*ftpSession).cmdCdup, true},
+		"TYPE": {(*ftpSession).cmdType, true},
+		"MODE": {(*ftpSession).cmdMode, true},
+		"STRU": {(*ftpSession).cmdStru, true},
+		"PASV": {(*ftpSession).cmdPasv, true},
+		"EPSV": {(*ftpSession).cmdEpsv, true},
+		"PORT": {(*ftpSession).cmdPort, true},
+		"EPRT": {(*ftpSession).cmdPort, true},
+		"LIST": {(*ftpSession).cmdList, true},
+		"NLST": {(*ftpSession).cmdNlst, true},
+		"MLSD": {(*ftpSession).cmdMlsd, true},
+		"MLST": {(*ftpSession).cmdMlst, true},
+		"RETR": {(*ftpSession).cmdRetr, true},
+		"STOR": {(*ftpSession).cmdStor, true},
+		"APPE": {(*ftpSession).cmdAppe, true},
+		"REST": {(*ftpSession).cmdRest, true},
+		"ALLO": {(*ftpSession).cmdAllo, true},
+		"DELE": {(*ftpSession).cmdDele, true},
+		"MKD":  {(*ftpSession).cmdMkd, true},
+		"XMKD": {(*ftpSession).cmdMkd, true},
+		"RMD":  {(*ftpSession).cmdRmd, true},
+		"XRMD": {(*ftpSession).cmdRmd, true},
+		"RNFR": {(*ftpSession).cmdRnfr, true},
+		"RNTO": {(*ftpSession).cmdRnto, true},
+		"SIZE": {(*ftpSession).cmdSize, true},
+		"MDTM": {(*ftpSession).cmdMdtm, true},
+		"ABOR": {(*ftpSession).cmdAbor, true},
+	}
+}
+
+func newFtpSession(server *FtpServer, conn net.Conn) *ftpSession {
+	return &ftpSession{
+		server: server,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		cwd:    "/",
+	}
+}
+
+func (c *ftpSession) serve() {
+	defer func() {
+		c.closePassive()
+		c.conn.Close()
+	}()
+
+	c.reply(220, "SeaweedFS FTP Server ready")
+	for {
+		if c.server.option.IdleTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.server.option.IdleTimeout))
+		}
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			glog.V(1).Infof("ftp %s from %s: %v", c.username, c.conn.RemoteAddr(), err)
+			return
+		}
+		name, arg := parseFtpCommand(line)
+		if name == "QUIT" {
+			c.reply(221, "Goodbye")
+			return
+		}
+		glog.V(2).Infof("ftp %s: %s", c.username, name)
+		command, found := ftpCommands[name]
+		switch {
+		case !found:
+			c.reply(502, "Command not implemented")
+		case command.requiresLogin && c.user == nil:
+			c.reply(530, "Please login with USER and PASS")
+		default:
+			command.fn(c, arg)
+		}
+		if name != "REST" {
+			c.restOffset = 0
+		}
+	}
+}
+
+func parseFtpCommand(line string) (name, arg string) {
+	line = strings.TrimRight(line, "\r\n")
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return strings.ToUpper(line[:i]), line[i+1:]
+	}
+	return strings.ToUpper(line), ""
+}
+
+func (c *ftpSession) reply(code int, format string, args ...interface{}) {
+	fmt.Fprintf(c.conn, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+}
+
+func (c *ftpSession) replyLines(code int, first string, lines []string, last string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d-%s\r\n", code, first)
+	for _, line := range lines {
+		fmt.Fprintf(&b, " %s\r\n", line)
+	}
+	fmt.Fprintf(&b, "%d %s\r\n", code, last)
+	c.conn.Write([]byte(b.String()))
+}
+
+// resolve returns the absolute path seen by the user, and the path on the filer
+func (c *ftpSession) resolve(arg string) (string, util.FullPath) {
+	p := arg
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(c.cwd, p)
+	}
+	p = path.Clean(p)
+	return p, util.FullPath(c.user.ToFilerPath(p))
+}
+
+// lookup returns nil if the entry is not found
+func (c *ftpSession) lookup(p util.FullPath) (*filer_pb.Entry, error) {
+	if p == "/" {
+		return &filer_pb.Entry{
+			Name:        "/",
+			IsDirectory: true,
+			Attributes:  &filer_pb.FuseAttributes{FileMode: uint32(os.ModeDir | 0755), Mtime: time.Now().Unix()},
+		}, nil
+	}
+	entry, err := filer_pb.GetEntry(c.server, p)
+	if entry != nil && entry.Attributes == nil {
+		entry.Attributes = &filer_pb.FuseAttributes{}
+	}
+	return entry, err
+}
+
+func (c *ftpSession) checkWritable() bool {
+	if c.user.ReadOnly {
+		c.reply(550, "Permission denied")
+		return false
+	}
+	return true
+}
+
+func (c *ftpSession) cmdUser(arg string) {
+	if c.server.option.TlsRequired && !c.isTls {
+		c.reply(530, "TLS is required, use AUTH TLS first")
+		return
+	}
+	c.user, c.username = nil, arg
+	c.reply(331, "Password required for %s", arg)
+}
+
+func (c *ftpSession) cmdPass(arg string) {
+	if c.username == "" {
+		c.reply(503, "Login with USER first")
+		return
+	}
+	user, err := c.server.option.Users.CheckPassword(c.username, arg)
+	if err != nil {
+		glog.V(0).Infof("ftp %s from %s: %v", c.username, c.conn.RemoteAddr(), err)
+		// slow down the password guessing
+		time.Sleep(time.Second)
+		c.reply(530, "Login incorrect")
+		return
+	}
+	if err = c.server.ensureHomeDir(user); err != nil {
+		glog.Errorf("ftp %s: %v", user.Username, err)
+		c.reply(421, "Home directory is not available")
+		return
+	}
+	glog.V(0).Infof("ftp %s logged in from %s", user.Username, c.conn.RemoteAddr())
+	c.user, c.cwd = user, "/"
+	c.reply(230, "User %s logged in", user.Username)
+}
+
+func (c *ftpSession) cmdAuth(arg string) {
+	if c.server.option.TlsConfig == nil {
+		c.reply(502, "TLS is not configured")
+		return
+	}
+	if mechanism := strings.ToUpper(arg); mechanism != "TLS" && mechanism != "SSL" {
+		c.reply(504, "Unsupported mechanism %s", arg)
+		return
+	}
+	if c.isTls {
+		c.reply(503, "Already using TLS")
+		return
+	}
+	c.reply(234, "Proceeding with TLS negotiation")
+	tlsConn := tls.Server(c.conn, c.server.option.TlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		glog.V(0).Infof("ftp tls handshake with %s: %v", c.conn.RemoteAddr(), err)
+		c.conn.Close()
+		return
+	}
+	c.conn, c.reader, c.isTls = tlsConn, bufio.NewReader(tlsConn), true
+}
+
+func (c *ftpSession) cmdPbsz(arg string) {
+	if !c.isTls {
+		c.reply(503, "Use AUTH TLS first")
+		return
+	}
+	c.reply(200, "PBSZ=0")
+}
+
+func (c *ftpSession) cmdProt(arg string) {
+	switch strings.ToUpper(arg) {
+	case "P":
+		if !c.isTls {
+			c.reply(503, "Use AUTH TLS first")
+			return
+		}
+		c.protectData = true
+		c.reply(200, "Data channel is protected")
+	case "C":
+		if c.server.option.TlsRequired {
+			c.reply(534, "Data channel must be protected")
+			return
+		}
+		c.protectData = false
+		c.reply(200, "Data channel is clear")
+	default:
+		c.reply(504, "Unsupported protection level %s", arg)
+	}
+}
+
+func (c *ftpSession) cmdFeat(arg string) {
+	features := []string{"EPSV", "PASV", "SIZE", "MDTM", "REST STREAM", "MLST type*;size*;modify*;", "UTF8"}
+	if c.server.option.TlsConfig != nil {
+		features = append(features, "AUTH TLS", "PBSZ", "PROT")
+	}
+	c.replyLines(211, "Features:", features, "End")
+}
+
+func (c *ftpSession) cmdSyst(arg string) {
+	c.reply(215, "UNIX Type: L8")
+}
+
+func (c *ftpSession) cmdOpts(arg string) {
+	option := strings.ToUpper(arg)
+	if strings.HasPrefix(option, "UTF8") || strings.HasPrefix(option, "MLST") {
+		c.reply(200, "OK")
+		return
+	}
+	c.reply(501, "Unsupported option %s", arg)
+}
+
+func (c *ftpSession) cmdNoop(arg string) {
+	c.reply(200, "OK")
+}
+
+func (c *ftpSession) cmdPwd(arg string) {
+	c.reply(257, "\"%s\" is the current directory", strings.Replace(c.cwd, "\"", "\"\"", -1))
+}
+
+func (c *ftpSession) cmdCwd(arg string) {
+	p, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil || !entry.IsDirectory {
+		c.reply(550, "%s: No such directory", arg)
+		return
+	}
+	c.cwd = p
+	c.reply(250, "Directory changed to %s", p)
+}
+
+func (c *ftpSession) cmdCdup(arg string) {
+	c.cmdCwd("..")
+}
+
+func (c *ftpSession) cmdType(arg string) {
+	// the data is always transferred as is
+	switch strings.ToUpper(arg) {
+	case "A", "A N", "I", "L 8":
+		c.reply(200, "Type set to %s", arg)
+	default:
+		c.reply(504, "Unsupported type %s", arg)
+	}
+}
+
+func (c *ftpSession) cmdMode(arg string) {
+	if strings.ToUpper(arg) != "S" {
+		c.reply(504, "Only stream mode is supported")
+		return
+	}
+	c.reply(200, "Mode set to S")
+}
+
+func (c *ftpSession) cmdStru(arg string) {
+	if strings.ToUpper(arg) != "F" {
+		c.reply(504, "Only file structure is supported")
+		return
+	}
+	c.reply(200, "Structure set to F")
+}
+
+func (c *ftpSession) cmdPasv(arg string) {
+	ip := net.ParseIP(c.server.option.PassiveIp)
+	if ip == nil {
+		ip = c.conn.LocalAddr().(*net.TCPAddr).IP
+	}
+	if ip = ip.To4(); ip == nil {
+		c.reply(425, "Use EPSV for IPv6")
+		return
+	}
+	port, err := c.openPassive()
+	if err != nil {
+		glog.Errorf("ftp passive listen: %v", err)
+		c.reply(425, "Can not open data connection")
+		return
+	}
+	c.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+}
+
+func (c *ftpSession) cmdEpsv(arg string) {
+	if strings.ToUpper(arg) == "ALL" {
+		c.reply(200, "EPSV ALL accepted")
+		return
+	}
+	port, err := c.openPassive()
+	if err != nil {
+		glog.Errorf("ftp passive listen: %v", err)
+		c.reply(425, "Can not open data connection")
+		return
+	}
+	c.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+}
+
+func (c *ftpSession) cmdPort(arg string) {
+	c.reply(502, "Active mode is not supported, use PASV or EPSV")
+}
+
+func (c *ftpSession) openPassive() (int, error) {
+	c.closePassive()
+	listener, err := c.server.listenPassive("")
+	if err != nil {
+		return 0, err
+	}
+	c.passive = listener
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (c *ftpSession) closePassive() {
+	if c.passive != nil {
+		c.passive.Close()
+		c.passive = nil
+	}
+}
+
+// openDataConn accepts the data connection of the last PASV or EPSV
+func (c *ftpSession) openDataConn() (net.Conn, error) {
+	if c.passive == nil {
+		return nil, fmt.Errorf("use PASV or EPSV first")
+	}
+	listener := c.passive
+	c.passive = nil
+	defer listener.Close()
+
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(30 * time.Second))
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	// only the client on the control connection can connect
+	if !conn.RemoteAddr().(*net.TCPAddr).IP.Equal(c.conn.RemoteAddr().(*net.TCPAddr).IP) {
+		conn.Close()
+		return nil, fmt.Errorf("data connection from %s", conn.RemoteAddr())
+	}
+	if c.protectData {
+		tlsConn := tls.Server(conn, c.server.option.TlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("data connection tls handshake: %v", err)
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// transfer runs the fn with the data connection, and replies the result on the control connection
+func (c *ftpSession) transfer(fn func(dataConn net.Conn) (code int, message string)) {
+	c.reply(150, "Opening data connection")
+	dataConn, err := c.openDataConn()
+	if err != nil {
+		glog.V(0).Infof("ftp %s: %v", c.username, err)
+		c.reply(425, "Can not open data connection")
+		return
+	}
+	code, message := fn(dataConn)
+	dataConn.Close()
+	c.reply(code, message)
+}
+
+func (c *ftpSession) cmdRest(arg string) {
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 {
+		c.reply(501, "Invalid offset %s", arg)
+		return
+	}
+	c.restOffset = offset
+	c.reply(350, "Restarting at %d", offset)
+}
+
+func (c *ftpSession) cmdAllo(arg string) {
+	c.reply(202, "No storage allocation necessary")
+}
+
+func (c *ftpSession) cmdAbor(arg string) {
+	// the transfers are done before reading the next command
+	c.reply(226, "No transfer to abort")
+}
+
+func (c *ftpSession) cmdDele(arg string) {
+	if !c.checkWritable() {
+		return
+	}
+	_, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil || entry.IsDirectory {
+		c.reply(550, "%s: No such file", arg)
+		return
+	}
+	dir, name := filerPath.DirAndName()
+	if err = filer_pb.Remove(c.server, dir, name, true, false, false, false); err != nil {
+		glog.Errorf("ftp %s delete %s: %v", c.username, filerPath, err)
+		c.reply(550, "Delete %s failed", arg)
+		return
+	}
+	if c.user.QuotaMB > 0 {
+		if usage, err := c.server.getQuotaUsage(c.user); err == nil {
+			usage.reserve(c.user, -int64(filer2.TotalSize(entry.Chunks)))
+		}
+	}
+	c.reply(250, "Deleted %s", arg)
+}
+
+func (c *ftpSession) cmdMkd(arg string) {
+	if !c.checkWritable() {
+		return
+	}
+	p, filerPath := c.resolve(arg)
+	if entry, err := c.lookup(filerPath); err != nil || entry != nil {
+		c.reply(550, "%s: Already exists", arg)
+		return
+	}
+	dir, name := filerPath.DirAndName()
+	err := filer_pb.Mkdir(c.server, dir, name, func(entry *filer_pb.Entry) {
+		entry.Attributes.FileMode = uint32(os.ModeDir | 0755)
+		entry.Attributes.Uid = c.user.Uid
+		entry.Attributes.Gid = c.user.Gid
+	})
+	if err != nil {
+		glog.Errorf("ftp %s mkdir %s: %v", c.username, filerPath, err)
+		c.reply(550, "Create %s failed", arg)
+		return
+	}
+	c.reply(257, "\"%s\" created", strings.Replace(p, "\"", "\"\"", -1))
+}
+
+func (c *ftpSession) cmdRmd(arg string) {
+	if !c.checkWritable() {
+		return
+	}
+	p, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil || !entry.IsDirectory || p == "/" {
+		c.reply(550, "%s: No such directory", arg)
+		return
+	}
+	dir, name := filerPath.DirAndName()
+	if err = filer_pb.Remove(c.server, dir, name, true, false, false, false); err != nil {
+		glog.V(0).Infof("ftp %s rmdir %s: %v", c.username, filerPath, err)
+		c.reply(550, "Remove %s failed: %v", arg, err)
+		return
+	}
+	c.reply(250, "Removed %s", arg)
+}
+
+func (c *ftpSession) cmdRnfr(arg string) {
+	if !c.checkWritable() {
+		return
+	}
+	p, filerPath := c.resolve(arg)
+	if entry, err := c.lookup(filerPath); err != nil || entry == nil || p == "/" {
+		c.reply(550, "%s: No such file or directory", arg)
+		return
+	}
+	c.renameFrom = p
+	c.reply(350, "Ready for RNTO")
+}
+
+func (c *ftpSession) cmdRnto(arg string) {
+	if c.renameFrom == "" {
+		c.reply(503, "Use RNFR first")
+		return
+	}
+	_, oldPath := c.resolve(c.renameFrom)
+	_, newPath := c.resolve(arg)
+	c.renameFrom = ""
+	oldDir, oldName := oldPath.DirAndName()
+	newDir, newName := newPath.DirAndName()
+	err := c.server.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.AtomicRenameEntry(context.Background(), &filer_pb.AtomicRenameEntryRequest{
+			OldDirectory: oldDir,
+			OldName:      oldName,
+			NewDirectory: newDir,
+			NewName:      newName,
+		})
+		return err
+	})
+	if err != nil {
+		glog.V(0).Infof("ftp %s rename %s => %s: %v", c.username, oldPath, newPath, err)
+		c.reply(550, "Rename failed")
+		return
+	}
+	c.reply(250, "Renamed")
+}
+
+func (c *ftpSession) cmdSize(arg string) {
+	_, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil || entry.IsDirectory {
+		c.reply(550, "%s: No such file", arg)
+		return
+	}
+	c.reply(213, "%d", filer2.TotalSize(entry.Chunks))
+}
+
+func (c *ftpSession) cmdMdtm(arg string) {
+	_, filerPath := c.resolve(arg)
+	entry, err := c.lookup(filerPath)
+	if err != nil || entry == nil {
+		c.reply(550, "%s: No such file", arg)
+		return
+	}
+	c.reply(213, "%s", time.Unix(entry.Attributes.Mtime, 0).UTC().Format("20060102150405"))
+}
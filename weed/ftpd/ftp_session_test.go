@@ -0,0 +1,18 @@
+package ftpd
+
+import (
+	"testing"
+)
+
+func TestListTarget(t *testing.T) {
+	for arg, expected := range map[string]string{
+		"":         "",
+		"-al":      "",
+		"-la dir1": "dir1",
+		"dir1":     "dir1",
+	} {
+		if actual := listTarget(arg); actual != expected {
+			t.Errorf("listTarget(%q) = %q, expected %q", arg, actual, expected)
+		}
+	}
+}
@@ -49,6 +49,7 @@ func (broker *MessageBroker) appendToFile(targetFile string, topicConfig *messag
 func (broker *MessageBroker) assignAndUpload(topicConfig *messaging_pb.TopicConfiguration, data []byte) (*operation.AssignResult, *operation.UploadResult, error) {
 
 	var assignResult = &operation.AssignResult{}
+	var targetUrl string
 
 	// assign a volume location
 	if err := broker.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
@@ -73,6 +74,7 @@ func (broker *MessageBroker) assignAndUpload(topicConfig *messaging_pb.TopicConf
 		assignResult.Url = resp.Url
 		assignResult.PublicUrl = resp.PublicUrl
 		assignResult.Count = uint64(resp.Count)
+		targetUrl = resp.UploadUrl(resp.Url)
 
 		return nil
 	}); err != nil {
@@ -80,7 +82,6 @@ func (broker *MessageBroker) assignAndUpload(topicConfig *messaging_pb.TopicConf
 	}
 
 	// upload data
-	targetUrl := fmt.Sprintf("http://%s/%s", assignResult.Url, assignResult.Fid)
 	uploadResult, err := operation.UploadData(targetUrl, "", broker.option.Cipher, data, false, "", nil, assignResult.Auth)
 	if err != nil {
 		return nil, nil, fmt.Errorf("upload data %s: %v", targetUrl, err)
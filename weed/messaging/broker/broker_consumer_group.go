@@ -0,0 +1,172 @@
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+/*
+Consumer groups:
+
+A consumer group commits the offset of each partition, which is the timestamp of the last message
+that it has acked, and all messages before it are also acked.
+The offsets are kept in the filer, as /topics/<namespace>/<topic>/.groups/<group>.partNN
+
+When a subscriber of a group connects, it resumes from the committed offset.
+The messages that are sent but not acked yet are sent again after reconnecting, so the delivery is at least once.
+
+Only one subscriber of a group can consume a partition at a time.
+*/
+
+const (
+	consumerGroupsDir     = ".groups"
+	consumerGroupOffset   = "offset"
+	maxUnackedMessages    = 1024
+	consumerGroupFmt      = "%s.part%02d"
+	consumerGroupLockName = "%s@%s"
+)
+
+func genConsumerGroupDir(tp *TopicPartition) string {
+	return fmt.Sprintf("%s/%s", genTopicDir(tp.Namespace, tp.Topic), consumerGroupsDir)
+}
+
+func (broker *MessageBroker) readConsumerGroupOffset(tp *TopicPartition, group string) (offset int64, found bool, err error) {
+	name := fmt.Sprintf(consumerGroupFmt, group, tp.Partition)
+	entry, err := filer_pb.GetEntry(broker, util.NewFullPath(genConsumerGroupDir(tp), name))
+	if err != nil {
+		return 0, false, fmt.Errorf("read offset of group %s on %s: %v", group, tp.String(), err)
+	}
+	if entry == nil || entry.Extended == nil || len(entry.Extended[consumerGroupOffset]) == 0 {
+		return 0, false, nil
+	}
+	offset, err = strconv.ParseInt(string(entry.Extended[consumerGroupOffset]), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse offset of group %s on %s: %v", group, tp.String(), err)
+	}
+	return offset, true, nil
+}
+
+func (broker *MessageBroker) commitConsumerGroupOffset(tp *TopicPartition, group string, offset int64) error {
+	name := fmt.Sprintf(consumerGroupFmt, group, tp.Partition)
+	return broker.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+			Directory: genConsumerGroupDir(tp),
+			Entry: &filer_pb.Entry{
+				Name: name,
+				Attributes: &filer_pb.FuseAttributes{
+					FileMode: 0644,
+				},
+				Extended: map[string][]byte{
+					consumerGroupOffset: []byte(strconv.FormatInt(offset, 10)),
+				},
+			},
+		})
+	})
+}
+
+// JoinConsumerGroup registers the subscriber as the only consumer of the partition in the group on this broker
+func (tm *TopicManager) JoinConsumerGroup(tp TopicPartition, group, subscriberId string) error {
+	tm.Lock()
+	defer tm.Unlock()
+
+	key := fmt.Sprintf(consumerGroupLockName, group, tp.String())
+	if existing, found := tm.consumerGroups[key]; found {
+		return fmt.Errorf("%s is consumed by %s of group %s", tp.String(), existing, group)
+	}
+	tm.consumerGroups[key] = subscriberId
+	return nil
+}
+
+func (tm *TopicManager) LeaveConsumerGroup(tp TopicPartition, group string) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	delete(tm.consumerGroups, fmt.Sprintf(consumerGroupLockName, group, tp.String()))
+}
+
+// ackTracker follows the messages sent to one subscriber of a consumer group.
+// The committed offset only moves forward to a message when all the messages before it are acked.
+type ackTracker struct {
+	sync.Mutex
+	cond        *sync.Cond
+	pending     []int64
+	acked       map[int64]bool
+	committed   int64
+	saved       int64
+	maxInFlight int
+	isClosed    bool
+}
+
+func newAckTracker(committed int64, maxInFlight int) *ackTracker {
+	t := &ackTracker{
+		acked:       make(map[int64]bool),
+		committed:   committed,
+		saved:       committed,
+		maxInFlight: maxInFlight,
+	}
+	t.cond = sync.NewCond(&t.Mutex)
+	return t
+}
+
+// sent records a message before sending it, and waits if too many messages are not acked yet.
+// It returns false if the tracker is closed.
+func (t *ackTracker) sent(messageId int64) bool {
+	t.Lock()
+	defer t.Unlock()
+	for !t.isClosed && len(t.pending) >= t.maxInFlight {
+		t.cond.Wait()
+	}
+	if t.isClosed {
+		return false
+	}
+	t.pending = append(t.pending, messageId)
+	t.acked[messageId] = false
+	return true
+}
+
+func (t *ackTracker) ack(messageId int64) {
+	t.Lock()
+	defer t.Unlock()
+	if _, found := t.acked[messageId]; !found {
+		return
+	}
+	t.acked[messageId] = true
+	for len(t.pending) > 0 && t.acked[t.pending[0]] {
+		t.committed = t.pending[0]
+		delete(t.acked, t.pending[0])
+		t.pending = t.pending[1:]
+	}
+	t.cond.Broadcast()
+}
+
+// toCommit returns the committed offset if it is not saved yet
+func (t *ackTracker) toCommit() (offset int64, changed bool) {
+	t.Lock()
+	defer t.Unlock()
+	return t.committed, t.committed != t.saved
+}
+
+func (t *ackTracker) markSaved(offset int64) {
+	t.Lock()
+	defer t.Unlock()
+	if offset > t.saved {
+		t.saved = offset
+	}
+}
+
+func (t *ackTracker) close() {
+	t.Lock()
+	defer t.Unlock()
+	t.isClosed = true
+	t.cond.Broadcast()
+}
+
+func (t *ackTracker) closed() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.isClosed
+}
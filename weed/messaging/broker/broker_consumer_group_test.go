@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"testing"
+)
+
+func TestAckTrackerCommitsContiguousAcks(t *testing.T) {
+
+	tracker := newAckTracker(10, 100)
+	for _, id := range []int64{11, 12, 13, 14} {
+		tracker.sent(id)
+	}
+
+	tracker.ack(12)
+	if offset, changed := tracker.toCommit(); changed {
+		t.Errorf("committed %d before 11 is acked", offset)
+	}
+
+	tracker.ack(11)
+	if offset, changed := tracker.toCommit(); !changed || offset != 12 {
+		t.Errorf("expected offset 12, got %d changed:%v", offset, changed)
+	}
+	tracker.markSaved(12)
+
+	tracker.ack(14)
+	tracker.ack(99) // unknown message
+	if offset, changed := tracker.toCommit(); changed {
+		t.Errorf("committed %d before 13 is acked", offset)
+	}
+
+	tracker.ack(13)
+	if offset, _ := tracker.toCommit(); offset != 14 {
+		t.Errorf("expected offset 14, got %d", offset)
+	}
+
+}
+
+func TestAckTrackerClose(t *testing.T) {
+
+	tracker := newAckTracker(0, 1)
+	if !tracker.sent(1) {
+		t.Fatalf("sent failed")
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- tracker.sent(2)
+	}()
+	tracker.close()
+	if <-done {
+		t.Errorf("sent after close")
+	}
+
+}
+
+func TestOversizedSegments(t *testing.T) {
+
+	segments := []*topicSegment{
+		{name: "00-00.part00", size: 40},
+		{name: "00-01.part00", size: 40},
+		{name: "00-02.part00", size: 40},
+	}
+
+	if removed := oversizedSegments(segments, 100); len(removed) != 1 || removed[0].name != "00-00.part00" {
+		t.Errorf("unexpected removed %+v", removed)
+	}
+	if removed := oversizedSegments(segments, 10); len(removed) != 2 {
+		t.Errorf("the latest segment should be kept: %+v", removed)
+	}
+	if removed := oversizedSegments(segments, 200); len(removed) != 0 {
+		t.Errorf("unexpected removed %+v", removed)
+	}
+
+}
@@ -4,13 +4,31 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/golang/protobuf/proto"
+
 	"github.com/chrislusf/seaweedfs/weed/filer2"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/messaging_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	topicConfigurationKey = "mq.topic.conf"
+	DefaultPartitionCount = 4
 )
 
 func (broker *MessageBroker) ConfigureTopic(c context.Context, request *messaging_pb.ConfigureTopicRequest) (*messaging_pb.ConfigureTopicResponse, error) {
-	panic("implement me")
+	resp := &messaging_pb.ConfigureTopicResponse{}
+	if request.Configuration == nil {
+		return nil, fmt.Errorf("missing topic configuration")
+	}
+	if request.Configuration.PartitionCount <= 0 {
+		request.Configuration.PartitionCount = DefaultPartitionCount
+	}
+	if err := broker.saveTopicConfiguration(request.Namespace, request.Topic, request.Configuration); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (broker *MessageBroker) DeleteTopic(c context.Context, request *messaging_pb.DeleteTopicRequest) (*messaging_pb.DeleteTopicResponse, error) {
@@ -25,7 +43,65 @@ func (broker *MessageBroker) DeleteTopic(c context.Context, request *messaging_p
 }
 
 func (broker *MessageBroker) GetTopicConfiguration(c context.Context, request *messaging_pb.GetTopicConfigurationRequest) (*messaging_pb.GetTopicConfigurationResponse, error) {
-	panic("implement me")
+	topicConfig, err := broker.readTopicConfiguration(request.Namespace, request.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &messaging_pb.GetTopicConfigurationResponse{
+		Configuration: topicConfig,
+	}, nil
+}
+
+// readTopicConfiguration reads the configuration kept in the topic directory,
+// or the default configuration if the topic is not configured yet.
+func (broker *MessageBroker) readTopicConfiguration(namespace, topic string) (*messaging_pb.TopicConfiguration, error) {
+	topicConfig := &messaging_pb.TopicConfiguration{
+		PartitionCount: DefaultPartitionCount,
+	}
+	entry, err := filer_pb.GetEntry(broker, util.FullPath(genTopicDir(namespace, topic)))
+	if err != nil {
+		return nil, fmt.Errorf("read topic %s/%s: %v", namespace, topic, err)
+	}
+	if entry == nil || entry.Extended == nil || len(entry.Extended[topicConfigurationKey]) == 0 {
+		return topicConfig, nil
+	}
+	if err = proto.Unmarshal(entry.Extended[topicConfigurationKey], topicConfig); err != nil {
+		return nil, fmt.Errorf("unmarshal topic %s/%s configuration: %v", namespace, topic, err)
+	}
+	if topicConfig.PartitionCount <= 0 {
+		topicConfig.PartitionCount = DefaultPartitionCount
+	}
+	return topicConfig, nil
+}
+
+func (broker *MessageBroker) saveTopicConfiguration(namespace, topic string, topicConfig *messaging_pb.TopicConfiguration) error {
+	data, err := proto.Marshal(topicConfig)
+	if err != nil {
+		return err
+	}
+	dir, name := genTopicDirEntry(namespace, topic)
+	entry, err := filer_pb.GetEntry(broker, util.FullPath(genTopicDir(namespace, topic)))
+	if err != nil {
+		return fmt.Errorf("read topic %s/%s: %v", namespace, topic, err)
+	}
+	if entry == nil {
+		return filer_pb.Mkdir(broker, dir, name, func(entry *filer_pb.Entry) {
+			entry.Extended = map[string][]byte{
+				topicConfigurationKey: data,
+			}
+		})
+	}
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[topicConfigurationKey] = data
+	return broker.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		})
+		return err
+	})
 }
 
 func genTopicDir(namespace, topic string) string {
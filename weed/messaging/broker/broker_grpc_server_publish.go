@@ -24,9 +24,9 @@ func (broker *MessageBroker) Publish(stream messaging_pb.SeaweedMessaging_Publis
 		return err
 	}
 
-	// TODO look it up
-	topicConfig := &messaging_pb.TopicConfiguration{
-		// IsTransient: true,
+	topicConfig, err := broker.readTopicConfiguration(in.Init.Namespace, in.Init.Topic)
+	if err != nil {
+		return err
 	}
 
 	// send init response
@@ -48,6 +48,9 @@ func (broker *MessageBroker) Publish(stream messaging_pb.SeaweedMessaging_Publis
 		Topic:     in.Init.Topic,
 		Partition: in.Init.Partition,
 	}
+	if tp.Partition < 0 || tp.Partition >= topicConfig.PartitionCount {
+		return fmt.Errorf("%s has only %d partitions", tp.String(), topicConfig.PartitionCount)
+	}
 
 	tpDir := fmt.Sprintf("%s/%s/%s", filer2.TopicsDir, tp.Namespace, tp.Topic)
 	md5File := fmt.Sprintf("p%02d.md5", tp.Partition)
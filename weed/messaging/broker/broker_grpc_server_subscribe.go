@@ -29,9 +29,9 @@ func (broker *MessageBroker) Subscribe(stream messaging_pb.SeaweedMessaging_Subs
 	var messageCount int64
 	subscriberId := in.Init.SubscriberId
 
-	// TODO look it up
-	topicConfig := &messaging_pb.TopicConfiguration{
-		// IsTransient: true,
+	topicConfig, err := broker.readTopicConfiguration(in.Init.Namespace, in.Init.Topic)
+	if err != nil {
+		return err
 	}
 
 	// get lock
@@ -40,6 +40,9 @@ func (broker *MessageBroker) Subscribe(stream messaging_pb.SeaweedMessaging_Subs
 		Topic:     in.Init.Topic,
 		Partition: in.Init.Partition,
 	}
+	if tp.Partition < 0 || tp.Partition >= topicConfig.PartitionCount {
+		return fmt.Errorf("%s has only %d partitions", tp.String(), topicConfig.PartitionCount)
+	}
 	fmt.Printf("+ subscriber %s for %s\n", subscriberId, tp.String())
 	defer func() {
 		fmt.Printf("- subscriber %s for %s %d messages last %v\n", subscriberId, tp.String(), messageCount, time.Unix(0, processedTsNs))
@@ -48,31 +51,80 @@ func (broker *MessageBroker) Subscribe(stream messaging_pb.SeaweedMessaging_Subs
 	lock := broker.topicManager.RequestLock(tp, topicConfig, false)
 	defer broker.topicManager.ReleaseLock(tp, false)
 
+	lastReadTime := time.Now()
+	switch in.Init.StartPosition {
+	case messaging_pb.SubscriberMessage_InitMessage_TIMESTAMP:
+		lastReadTime = time.Unix(0, in.Init.TimestampNs)
+	case messaging_pb.SubscriberMessage_InitMessage_LATEST:
+	case messaging_pb.SubscriberMessage_InitMessage_EARLIEST:
+		lastReadTime = time.Unix(0, 0)
+	}
+
+	// a consumer group resumes from its committed offset
+	var tracker *ackTracker
+	if group := in.Init.ConsumerGroup; group != "" {
+		if err = broker.topicManager.JoinConsumerGroup(tp, group, subscriberId); err != nil {
+			return err
+		}
+		defer broker.topicManager.LeaveConsumerGroup(tp, group)
+
+		offset, found, err := broker.readConsumerGroupOffset(&tp, group)
+		if err != nil {
+			return err
+		}
+		if found {
+			lastReadTime = time.Unix(0, offset)
+		} else {
+			offset = lastReadTime.UnixNano()
+		}
+		tracker = newAckTracker(offset, maxUnackedMessages)
+		commitFn := func() {
+			if offset, changed := tracker.toCommit(); changed {
+				if err := broker.commitConsumerGroupOffset(&tp, group, offset); err != nil {
+					glog.V(0).Infof("group %s commit %s offset %d: %v", group, tp.String(), offset, err)
+					return
+				}
+				tracker.markSaved(offset)
+			}
+		}
+		defer commitFn()
+		defer tracker.close()
+		go func() {
+			for !tracker.closed() {
+				time.Sleep(time.Second)
+				commitFn()
+			}
+		}()
+	}
+
 	isConnected := true
 	go func() {
 		for isConnected {
-			if _, err := stream.Recv(); err != nil {
+			in, err := stream.Recv()
+			if err != nil {
 				// println("disconnecting connection to", subscriberId, tp.String())
 				isConnected = false
+				if tracker != nil {
+					tracker.close()
+				}
 				lock.cond.Signal()
+				return
+			}
+			if in.Ack != nil && tracker != nil {
+				tracker.ack(in.Ack.MessageId)
 			}
 		}
 	}()
 
-	lastReadTime := time.Now()
-	switch in.Init.StartPosition {
-	case messaging_pb.SubscriberMessage_InitMessage_TIMESTAMP:
-		lastReadTime = time.Unix(0, in.Init.TimestampNs)
-	case messaging_pb.SubscriberMessage_InitMessage_LATEST:
-	case messaging_pb.SubscriberMessage_InitMessage_EARLIEST:
-		lastReadTime = time.Unix(0, 0)
-	}
-
 	// how to process each message
 	// an error returned will end the subscription
-	eachMessageFn := func(m *messaging_pb.Message) error {
+	eachMessageFn := func(m *messaging_pb.Message, messageId int64) error {
+		if tracker != nil && !tracker.sent(messageId) {
+			return io.EOF
+		}
 		err := stream.Send(&messaging_pb.BrokerMessage{
-			Data: m,
+			Data:      m,
+			MessageId: messageId,
 		})
 		if err != nil {
 			glog.V(0).Infof("=> subscriber %v: %+v", subscriberId, err)
@@ -87,7 +139,7 @@ func (broker *MessageBroker) Subscribe(stream messaging_pb.SeaweedMessaging_Subs
 			return err
 		}
 		// fmt.Printf("sending : %d bytes ts %d\n", len(m.Value), logEntry.TsNs)
-		if err = eachMessageFn(m); err != nil {
+		if err = eachMessageFn(m, logEntry.TsNs); err != nil {
 			glog.Errorf("sending %d bytes to %s: %s", len(m.Value), subscriberId, err)
 			return err
 		}
@@ -135,6 +187,9 @@ func (broker *MessageBroker) readPersistedLogBuffer(tp *TopicPartition, startTim
 	partitionSuffix := fmt.Sprintf(".part%02d", tp.Partition)
 
 	return filer_pb.List(broker, topicDir, "", func(dayEntry *filer_pb.Entry, isLast bool) error {
+		if !dayEntry.IsDirectory {
+			return nil
+		}
 		dayDir := fmt.Sprintf("%s/%s", topicDir, dayEntry.Name)
 		return filer_pb.List(broker, dayDir, "", func(hourMinuteEntry *filer_pb.Entry, isLast bool) error {
 			if dayEntry.Name == startDate {
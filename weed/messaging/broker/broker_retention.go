@@ -0,0 +1,154 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/messaging_pb"
+)
+
+/*
+Retention:
+
+The messages are kept as segment files /topics/<namespace>/<topic>/YYYY-MM-DD/HH-MM.partNN.
+Every broker checks the configured topics periodically, and removes
+  * the segments older than retention_seconds, and
+  * the oldest segments of a partition when the partition is larger than retention_mb.
+The latest segment of a partition is always kept, since it may still be appended to.
+Removing is idempotent, so it is fine that several brokers check the same topic.
+*/
+
+const retentionCheckInterval = 10 * time.Minute
+
+type topicSegment struct {
+	dayDir string
+	name   string
+	size   int64
+}
+
+func (broker *MessageBroker) loopEnforceRetention() {
+	for {
+		time.Sleep(retentionCheckInterval)
+		if err := broker.enforceRetention(); err != nil {
+			glog.V(0).Infof("enforce topic retention: %v", err)
+		}
+	}
+}
+
+func (broker *MessageBroker) enforceRetention() error {
+	return filer_pb.List(broker, filer2.TopicsDir, "", func(namespaceEntry *filer_pb.Entry, isLast bool) error {
+		if !namespaceEntry.IsDirectory || strings.HasPrefix(namespaceEntry.Name, ".") {
+			return nil
+		}
+		namespaceDir := fmt.Sprintf("%s/%s", filer2.TopicsDir, namespaceEntry.Name)
+		return filer_pb.List(broker, namespaceDir, "", func(topicEntry *filer_pb.Entry, isLast bool) error {
+			if !topicEntry.IsDirectory || topicEntry.Extended == nil || len(topicEntry.Extended[topicConfigurationKey]) == 0 {
+				return nil
+			}
+			topicConfig := &messaging_pb.TopicConfiguration{}
+			if err := proto.Unmarshal(topicEntry.Extended[topicConfigurationKey], topicConfig); err != nil {
+				glog.V(0).Infof("unmarshal topic %s/%s configuration: %v", namespaceEntry.Name, topicEntry.Name, err)
+				return nil
+			}
+			if topicConfig.RetentionSeconds <= 0 && topicConfig.RetentionMb <= 0 {
+				return nil
+			}
+			if err := broker.enforceTopicRetention(namespaceEntry.Name, topicEntry.Name, topicConfig, time.Now()); err != nil {
+				glog.V(0).Infof("enforce retention of topic %s/%s: %v", namespaceEntry.Name, topicEntry.Name, err)
+			}
+			return nil
+		}, "", false, 1024*1024)
+	}, "", false, 1024*1024)
+}
+
+func (broker *MessageBroker) enforceTopicRetention(namespace, topic string, topicConfig *messaging_pb.TopicConfiguration, now time.Time) error {
+	topicDir := genTopicDir(namespace, topic)
+
+	var cutoffDay, cutoffHourMinute string
+	if topicConfig.RetentionSeconds > 0 {
+		cutoff := now.Add(-time.Duration(topicConfig.RetentionSeconds) * time.Second)
+		cutoffDay = fmt.Sprintf("%04d-%02d-%02d", cutoff.Year(), cutoff.Month(), cutoff.Day())
+		cutoffHourMinute = fmt.Sprintf("%02d-%02d", cutoff.Hour(), cutoff.Minute())
+	}
+
+	var dayDirs []string
+	if err := filer_pb.List(broker, topicDir, "", func(dayEntry *filer_pb.Entry, isLast bool) error {
+		if dayEntry.IsDirectory && !strings.HasPrefix(dayEntry.Name, ".") {
+			dayDirs = append(dayDirs, dayEntry.Name)
+		}
+		return nil
+	}, "", false, 1024*1024); err != nil {
+		return err
+	}
+
+	partitions := make(map[string][]*topicSegment)
+	for _, day := range dayDirs {
+		dayDir := fmt.Sprintf("%s/%s", topicDir, day)
+		if cutoffDay != "" && day < cutoffDay {
+			glog.V(1).Infof("retention removes %s", dayDir)
+			if err := filer_pb.Remove(broker, topicDir, day, true, true, true, false); err != nil {
+				return err
+			}
+			continue
+		}
+		var expired []string
+		if err := filer_pb.List(broker, dayDir, "", func(segmentEntry *filer_pb.Entry, isLast bool) error {
+			partIndex := strings.Index(segmentEntry.Name, ".part")
+			if segmentEntry.IsDirectory || partIndex < 0 {
+				return nil
+			}
+			if day == cutoffDay && segmentEntry.Name[:partIndex] < cutoffHourMinute {
+				expired = append(expired, segmentEntry.Name)
+				return nil
+			}
+			partition := segmentEntry.Name[partIndex:]
+			partitions[partition] = append(partitions[partition], &topicSegment{
+				dayDir: dayDir,
+				name:   segmentEntry.Name,
+				size:   int64(filer2.TotalSize(segmentEntry.Chunks)),
+			})
+			return nil
+		}, "", false, 24*60*1024); err != nil {
+			return err
+		}
+		for _, name := range expired {
+			glog.V(1).Infof("retention removes %s/%s", dayDir, name)
+			if err := filer_pb.Remove(broker, dayDir, name, true, false, false, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	if topicConfig.RetentionMb <= 0 {
+		return nil
+	}
+	for _, segments := range partitions {
+		for _, segment := range oversizedSegments(segments, topicConfig.RetentionMb*1024*1024) {
+			glog.V(1).Infof("retention removes %s/%s", segment.dayDir, segment.name)
+			if err := filer_pb.Remove(broker, segment.dayDir, segment.name, true, false, false, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// oversizedSegments returns the oldest segments to remove, so that the rest fit in the limit.
+// The segments are sorted from the oldest to the latest, and the latest one is always kept.
+func oversizedSegments(segments []*topicSegment, limit int64) (removed []*topicSegment) {
+	var total int64
+	for _, segment := range segments {
+		total += segment.size
+	}
+	for i := 0; i < len(segments)-1 && total > limit; i++ {
+		removed = append(removed, segments[i])
+		total -= segments[i].size
+	}
+	return
+}
@@ -40,6 +40,8 @@ func NewMessageBroker(option *MessageBrokerOption, grpcDialOption grpc.DialOptio
 
 	go messageBroker.keepConnectedToOneFiler()
 
+	go messageBroker.loopEnforceRetention()
+
 	return messageBroker, nil
 }
 
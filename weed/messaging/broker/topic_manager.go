@@ -35,14 +35,16 @@ type TopicControl struct {
 
 type TopicManager struct {
 	sync.Mutex
-	topicControls map[TopicPartition]*TopicControl
-	broker        *MessageBroker
+	topicControls  map[TopicPartition]*TopicControl
+	consumerGroups map[string]string
+	broker         *MessageBroker
 }
 
 func NewTopicManager(messageBroker *MessageBroker) *TopicManager {
 	return &TopicManager{
-		topicControls: make(map[TopicPartition]*TopicControl),
-		broker:        messageBroker,
+		topicControls:  make(map[TopicPartition]*TopicControl),
+		consumerGroups: make(map[string]string),
+		broker:         messageBroker,
 	}
 }
 
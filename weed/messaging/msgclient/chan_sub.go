@@ -30,7 +30,7 @@ func (mc *MessagingClient) NewSubChannel(subscriberId, chanName string) (*SubCha
 		return nil, err
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	sc, err := setupSubscriberClient(ctx, grpcConnection, tp, subscriberId, time.Unix(0, 0))
+	sc, err := setupSubscriberClient(ctx, grpcConnection, tp, "", subscriberId, time.Unix(0, 0))
 	if err != nil {
 		return nil, err
 	}
@@ -4,31 +4,42 @@ import (
 	"context"
 	"log"
 
-	"github.com/chrislusf/seaweedfs/weed/messaging/broker"
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/messaging_pb"
 )
 
-func (mc *MessagingClient) configureTopic(tp broker.TopicPartition) error {
+func (mc *MessagingClient) ConfigureTopic(namespace, topic string, topicConfiguration *messaging_pb.TopicConfiguration) error {
 
 	return mc.withAnyBroker(func(client messaging_pb.SeaweedMessagingClient) error {
 		_, err := client.ConfigureTopic(context.Background(),
 			&messaging_pb.ConfigureTopicRequest{
-				Namespace: tp.Namespace,
-				Topic:     tp.Topic,
-				Configuration: &messaging_pb.TopicConfiguration{
-					PartitionCount: 0,
-					Collection:     "",
-					Replication:    "",
-					IsTransient:    false,
-					Partitoning:    0,
-				},
+				Namespace:     namespace,
+				Topic:         topic,
+				Configuration: topicConfiguration,
 			})
 		return err
 	})
 
 }
 
+func (mc *MessagingClient) GetTopicConfiguration(namespace, topic string) (topicConfiguration *messaging_pb.TopicConfiguration, err error) {
+
+	err = mc.withAnyBroker(func(client messaging_pb.SeaweedMessagingClient) error {
+		resp, err := client.GetTopicConfiguration(context.Background(),
+			&messaging_pb.GetTopicConfigurationRequest{
+				Namespace: namespace,
+				Topic:     topic,
+			})
+		if err != nil {
+			return err
+		}
+		topicConfiguration = resp.Configuration
+		return nil
+	})
+	return
+
+}
+
 func (mc *MessagingClient) DeleteTopic(namespace, topic string) error {
 
 	return mc.withAnyBroker(func(client messaging_pb.SeaweedMessagingClient) error {
@@ -15,12 +15,20 @@ type Subscriber struct {
 	subscriberClients []messaging_pb.SeaweedMessaging_SubscribeClient
 	subscriberCancels []context.CancelFunc
 	subscriberId      string
+	consumerGroup     string
 }
 
 func (mc *MessagingClient) NewSubscriber(subscriberId, namespace, topic string, partitionId int, startTime time.Time) (*Subscriber, error) {
+	return mc.NewGroupSubscriber("", subscriberId, namespace, topic, partitionId, startTime)
+}
+
+// NewGroupSubscriber resumes from the committed offsets of the consumer group, or from the startTime if no offset is committed yet.
+// Each message is acked after it is processed, and the message may be processed again if the subscriber fails before the ack.
+func (mc *MessagingClient) NewGroupSubscriber(consumerGroup, subscriberId, namespace, topic string, partitionId int, startTime time.Time) (*Subscriber, error) {
 	// read topic configuration
-	topicConfiguration := &messaging_pb.TopicConfiguration{
-		PartitionCount: 4,
+	topicConfiguration, err := mc.GetTopicConfiguration(namespace, topic)
+	if err != nil {
+		return nil, err
 	}
 	subscriberClients := make([]messaging_pb.SeaweedMessaging_SubscribeClient, topicConfiguration.PartitionCount)
 	subscriberCancels := make([]context.CancelFunc, topicConfiguration.PartitionCount)
@@ -39,8 +47,9 @@ func (mc *MessagingClient) NewSubscriber(subscriberId, namespace, topic string,
 			return nil, err
 		}
 		ctx, cancel := context.WithCancel(context.Background())
-		client, err := setupSubscriberClient(ctx, grpcClientConn, tp, subscriberId, startTime)
+		client, err := setupSubscriberClient(ctx, grpcClientConn, tp, consumerGroup, subscriberId, startTime)
 		if err != nil {
+			cancel()
 			return nil, err
 		}
 		subscriberClients[i] = client
@@ -51,10 +60,11 @@ func (mc *MessagingClient) NewSubscriber(subscriberId, namespace, topic string,
 		subscriberClients: subscriberClients,
 		subscriberCancels: subscriberCancels,
 		subscriberId:      subscriberId,
+		consumerGroup:     consumerGroup,
 	}, nil
 }
 
-func setupSubscriberClient(ctx context.Context, grpcConnection *grpc.ClientConn, tp broker.TopicPartition, subscriberId string, startTime time.Time) (stream messaging_pb.SeaweedMessaging_SubscribeClient, err error) {
+func setupSubscriberClient(ctx context.Context, grpcConnection *grpc.ClientConn, tp broker.TopicPartition, consumerGroup, subscriberId string, startTime time.Time) (stream messaging_pb.SeaweedMessaging_SubscribeClient, err error) {
 	stream, err = messaging_pb.NewSeaweedMessagingClient(grpcConnection).Subscribe(ctx)
 	if err != nil {
 		return
@@ -69,6 +79,7 @@ func setupSubscriberClient(ctx context.Context, grpcConnection *grpc.ClientConn,
 			StartPosition: messaging_pb.SubscriberMessage_InitMessage_TIMESTAMP,
 			TimestampNs:   startTime.UnixNano(),
 			SubscriberId:  subscriberId,
+			ConsumerGroup: consumerGroup,
 		},
 	})
 	if err != nil {
@@ -78,7 +89,7 @@ func setupSubscriberClient(ctx context.Context, grpcConnection *grpc.ClientConn,
 	return stream, nil
 }
 
-func doSubscribe(subscriberClient messaging_pb.SeaweedMessaging_SubscribeClient, processFn func(m *messaging_pb.Message)) error {
+func doSubscribe(subscriberClient messaging_pb.SeaweedMessaging_SubscribeClient, isAcking bool, processFn func(m *messaging_pb.Message)) error {
 	for {
 		resp, listenErr := subscriberClient.Recv()
 		if listenErr == io.EOF {
@@ -93,6 +104,15 @@ func doSubscribe(subscriberClient messaging_pb.SeaweedMessaging_SubscribeClient,
 			continue
 		}
 		processFn(resp.Data)
+		if isAcking {
+			if err := subscriberClient.Send(&messaging_pb.SubscriberMessage{
+				Ack: &messaging_pb.SubscriberMessage_AckMessage{
+					MessageId: resp.MessageId,
+				},
+			}); err != nil {
+				return err
+			}
+		}
 	}
 }
 
@@ -104,7 +124,7 @@ func (s *Subscriber) Subscribe(processFn func(m *messaging_pb.Message)) {
 			wg.Add(1)
 			go func(subscriberClient messaging_pb.SeaweedMessaging_SubscribeClient) {
 				defer wg.Done()
-				doSubscribe(subscriberClient, processFn)
+				doSubscribe(subscriberClient, s.consumerGroup != "", processFn)
 			}(s.subscriberClients[i])
 		}
 	}
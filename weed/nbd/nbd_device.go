@@ -0,0 +1,225 @@
+package nbd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const exportSizeKey = "nbd.size"
+
+// blockDevice is what an export serves
+type blockDevice interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() int64
+	// Flush persists all the completed writes
+	Flush() error
+	Close() error
+}
+
+// filerDevice is a fixed-size block device backed by a file on the filer.
+// The device is divided into blocks, and each written block is uploaded as one chunk at the block offset,
+// so a block is either a hole of zeros or covered by its latest chunk.
+// The written blocks are kept in the write cache until a flush, or until the cache is full.
+type filerDevice struct {
+	server         *NbdServer
+	fullpath       util.FullPath
+	entry          *filer_pb.Entry
+	size           int64
+	blockSize      int64
+	maxDirtyBlocks int
+	saveFn         filer2.SaveDataAsChunkFunctionType
+	lookupFn       filer2.LookupFileIdFunctionType
+	visibles       []filer2.VisibleInterval
+	dirty          map[int64][]byte
+	sync.Mutex
+}
+
+func newFilerDevice(server *NbdServer, fullpath util.FullPath, entry *filer_pb.Entry) (*filerDevice, error) {
+	size, err := strconv.ParseInt(string(entry.Extended[exportSizeKey]), 10, 64)
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("%s is not an nbd export: invalid %s %q", fullpath, exportSizeKey, entry.Extended[exportSizeKey])
+	}
+
+	lookupFn := filer2.LookupFn(server)
+	// keep the data chunks, since the filer may have saved them in chunk manifests
+	dataChunks, _, err := filer2.ResolveChunkManifest(lookupFn, entry.Chunks)
+	if err != nil {
+		return nil, fmt.Errorf("resolve chunk manifest of %s: %v", fullpath, err)
+	}
+	entry.Chunks = dataChunks
+
+	dir, _ := fullpath.DirAndName()
+	blockSize := int64(server.option.BlockSizeMB) * 1024 * 1024
+	d := &filerDevice{
+		server:         server,
+		fullpath:       fullpath,
+		entry:          entry,
+		size:           size,
+		blockSize:      blockSize,
+		maxDirtyBlocks: int(server.option.WriteCacheSizeMB * 1024 * 1024 / blockSize),
+		saveFn:         filer2.SaveDataAsChunkFromClient(server, dir, server.uploadOption()),
+		lookupFn:       lookupFn,
+		dirty:          make(map[int64][]byte),
+	}
+	if d.maxDirtyBlocks < 1 {
+		d.maxDirtyBlocks = 1
+	}
+	d.visibles, _ = filer2.NonOverlappingVisibleIntervals(lookupFn, entry.Chunks)
+	return d, nil
+}
+
+func (d *filerDevice) Size() int64 {
+	return d.size
+}
+
+func (d *filerDevice) ReadAt(p []byte, off int64) (n int, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if off < 0 || off+int64(len(p)) > d.size {
+		return 0, fmt.Errorf("read [%d,%d) is out of the device size %d", off, off+int64(len(p)), d.size)
+	}
+	for n < len(p) {
+		pos := off + int64(n)
+		blockIndex := pos / d.blockSize
+		blockStart := blockIndex * d.blockSize
+		stop := n + int(min(int64(len(p)-n), blockStart+d.blockSize-pos))
+		if block, found := d.dirty[blockIndex]; found {
+			copy(p[n:stop], block[pos-blockStart:])
+		} else if err = d.readFromFiler(p[n:stop], pos); err != nil {
+			return n, err
+		}
+		n = stop
+	}
+	return n, nil
+}
+
+// readFromFiler reads the range within one block
+func (d *filerDevice) readFromFiler(p []byte, off int64) error {
+	for i := range p {
+		p[i] = 0
+	}
+	chunkViews := filer2.ViewFromVisibleIntervals(d.visibles, off, int64(len(p)))
+	if len(chunkViews) == 0 {
+		return nil
+	}
+	reader := filer2.NewChunkReaderAtFromClient(d.server, chunkViews, d.server.chunkCache)
+	for _, chunkView := range chunkViews {
+		start := chunkView.LogicOffset - off
+		if _, err := reader.ReadAt(p[start:start+int64(chunkView.Size)], chunkView.LogicOffset); err != nil && err != io.EOF {
+			return fmt.Errorf("read %s [%d,%d): %v", d.fullpath, chunkView.LogicOffset, chunkView.LogicOffset+int64(chunkView.Size), err)
+		}
+	}
+	return nil
+}
+
+func (d *filerDevice) WriteAt(p []byte, off int64) (n int, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if off < 0 || off+int64(len(p)) > d.size {
+		return 0, fmt.Errorf("write [%d,%d) is out of the device size %d", off, off+int64(len(p)), d.size)
+	}
+	for n < len(p) {
+		pos := off + int64(n)
+		blockIndex := pos / d.blockSize
+		blockStart := blockIndex * d.blockSize
+		stop := n + int(min(int64(len(p)-n), blockStart+d.blockSize-pos))
+		block, found := d.dirty[blockIndex]
+		if !found {
+			if len(d.dirty) >= d.maxDirtyBlocks {
+				if err = d.flush(); err != nil {
+					return n, err
+				}
+			}
+			// read the rest of the block, unless the whole block is overwritten
+			block = make([]byte, min(d.blockSize, d.size-blockStart))
+			if pos != blockStart || stop-n != len(block) {
+				if err = d.readFromFiler(block, blockStart); err != nil {
+					return n, err
+				}
+			}
+			d.dirty[blockIndex] = block
+		}
+		copy(block[pos-blockStart:], p[n:stop])
+		n = stop
+	}
+	return n, nil
+}
+
+func (d *filerDevice) Flush() error {
+	d.Lock()
+	defer d.Unlock()
+	return d.flush()
+}
+
+func (d *filerDevice) Close() error {
+	d.Lock()
+	defer d.Unlock()
+	return d.flush()
+}
+
+// flush uploads the dirty blocks, and saves the entry with the new chunks.
+// The filer removes the chunks covered by the new ones.
+func (d *filerDevice) flush() error {
+	if len(d.dirty) == 0 {
+		return nil
+	}
+
+	var blockIndexes []int64
+	for blockIndex := range d.dirty {
+		blockIndexes = append(blockIndexes, blockIndex)
+	}
+	sort.Slice(blockIndexes, func(i, j int) bool {
+		return blockIndexes[i] < blockIndexes[j]
+	})
+	for _, blockIndex := range blockIndexes {
+		chunk, _, _, err := d.saveFn(bytes.NewReader(d.dirty[blockIndex]), d.fullpath.Name(), blockIndex*d.blockSize)
+		if err != nil {
+			// read the uploaded blocks from their new chunks
+			d.visibles, _ = filer2.NonOverlappingVisibleIntervals(d.lookupFn, d.entry.Chunks)
+			return fmt.Errorf("upload block %d of %s: %v", blockIndex, d.fullpath, err)
+		}
+		// the uploaded chunks are saved in the entry by this or the next flush
+		d.entry.Chunks = append(d.entry.Chunks, chunk)
+		delete(d.dirty, blockIndex)
+	}
+
+	d.entry.Attributes.Mtime = time.Now().Unix()
+	dir, _ := d.fullpath.DirAndName()
+	err := d.server.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     d.entry,
+		})
+		return err
+	})
+	if err != nil {
+		d.visibles, _ = filer2.NonOverlappingVisibleIntervals(d.lookupFn, d.entry.Chunks)
+		return fmt.Errorf("save %s: %v", d.fullpath, err)
+	}
+
+	d.entry.Chunks, _ = filer2.CompactFileChunks(d.lookupFn, d.entry.Chunks)
+	d.visibles, _ = filer2.NonOverlappingVisibleIntervals(d.lookupFn, d.entry.Chunks)
+	glog.V(3).Infof("flushed %d blocks to %s", len(blockIndexes), d.fullpath)
+	return nil
+}
+
+func min(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
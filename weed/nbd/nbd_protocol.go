@@ -0,0 +1,122 @@
+package nbd
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// the fixed newstyle negotiation and the transmission phase of
+// https://github.com/NetworkBlockDevice/nbd/blob/master/doc/proto.md
+
+const (
+	nbdMagic         = 0x4e42444d41474943 // "NBDMAGIC"
+	nbdOptionMagic   = 0x49484156454F5054 // "IHAVEOPT"
+	nbdReplyMagic    = 0x3e889045565a9
+	nbdRequestMagic  = 0x25609513
+	nbdResponseMagic = 0x67446698
+
+	// handshake flags
+	nbdFlagFixedNewstyle = 1 << 0
+	nbdFlagNoZeroes      = 1 << 1
+
+	// client flags
+	nbdFlagClientFixedNewstyle = 1 << 0
+	nbdFlagClientNoZeroes      = 1 << 1
+
+	// options
+	nbdOptExportName = 1
+	nbdOptAbort      = 2
+	nbdOptList       = 3
+	nbdOptInfo       = 6
+	nbdOptGo         = 7
+
+	// option replies
+	nbdRepAck         = 1
+	nbdRepServer      = 2
+	nbdRepInfo        = 3
+	nbdRepErrUnsup    = 0x80000001
+	nbdRepErrPolicy   = 0x80000002
+	nbdRepErrInvalid  = 0x80000003
+	nbdRepErrUnknown  = 0x80000006
+	nbdRepErrTooBig   = 0x80000009
+	nbdInfoExport     = 0
+	nbdInfoBlockSize  = 3
+	maxOptionDataSize = 64 * 1024
+
+	// transmission flags
+	nbdFlagHasFlags        = 1 << 0
+	nbdFlagReadOnly        = 1 << 1
+	nbdFlagSendFlush       = 1 << 2
+	nbdFlagSendFua         = 1 << 3
+	nbdFlagSendWriteZeroes = 1 << 6
+
+	// commands
+	nbdCmdRead        = 0
+	nbdCmdWrite       = 1
+	nbdCmdDisc        = 2
+	nbdCmdFlush       = 3
+	nbdCmdTrim        = 4
+	nbdCmdWriteZeroes = 6
+
+	// command flags
+	nbdCmdFlagFua = 1 << 0
+
+	// errors
+	nbdEperm  = 1
+	nbdEio    = 5
+	nbdEinval = 22
+	nbdEnospc = 28
+
+	maxRequestSize = 32 * 1024 * 1024
+)
+
+type nbdRequest struct {
+	flags  uint16
+	typ    uint16
+	handle uint64
+	offset uint64
+	length uint32
+}
+
+func readRequest(r io.Reader) (*nbdRequest, error) {
+	var buf [28]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(buf[0:4]) != nbdRequestMagic {
+		return nil, errBadMagic
+	}
+	return &nbdRequest{
+		flags:  binary.BigEndian.Uint16(buf[4:6]),
+		typ:    binary.BigEndian.Uint16(buf[6:8]),
+		handle: binary.BigEndian.Uint64(buf[8:16]),
+		offset: binary.BigEndian.Uint64(buf[16:24]),
+		length: binary.BigEndian.Uint32(buf[24:28]),
+	}, nil
+}
+
+func writeSimpleReply(w io.Writer, handle uint64, errno uint32, data []byte) error {
+	var buf [16]byte
+	binary.BigEndian.PutUint32(buf[0:4], nbdResponseMagic)
+	binary.BigEndian.PutUint32(buf[4:8], errno)
+	binary.BigEndian.PutUint64(buf[8:16], handle)
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		_, err := w.Write(data)
+		return err
+	}
+	return nil
+}
+
+func writeOptionReply(w io.Writer, option, replyType uint32, data []byte) error {
+	buf := make([]byte, 20+len(data))
+	binary.BigEndian.PutUint64(buf[0:8], nbdReplyMagic)
+	binary.BigEndian.PutUint32(buf[8:12], option)
+	binary.BigEndian.PutUint32(buf[12:16], replyType)
+	binary.BigEndian.PutUint32(buf[16:20], uint32(len(data)))
+	copy(buf[20:], data)
+	_, err := w.Write(buf)
+	return err
+}
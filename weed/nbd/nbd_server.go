@@ -0,0 +1,207 @@
+package nbd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+var errBadMagic = errors.New("bad magic")
+
+type NbdServerOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	// the exports are the files in this directory
+	Directory   string
+	Collection  string
+	Replication string
+	DataCenter  string
+	Cipher      bool
+	BlockSizeMB int
+	// the dirty blocks kept before uploading
+	WriteCacheSizeMB int64
+	CacheDir         string
+	CacheSizeMB      int64
+	// create the missing exports with this size, 0 to serve only the existing exports
+	NewExportSizeMB int64
+	ReadOnly        bool
+}
+
+type NbdServer struct {
+	option     *NbdServerOption
+	chunkCache *chunk_cache.ChunkCache
+
+	// the connections to the same export share the device, and the write cache
+	devices     map[string]*sharedDevice
+	devicesLock sync.Mutex
+	newDevice   func(name string) (blockDevice, error)
+}
+
+type sharedDevice struct {
+	blockDevice
+	refs int
+}
+
+var _ = filer_pb.FilerClient(&NbdServer{})
+
+func NewNbdServer(option *NbdServerOption) *NbdServer {
+	s := &NbdServer{
+		option:     option,
+		chunkCache: chunk_cache.NewChunkCache(256, option.CacheDir, option.CacheSizeMB),
+		devices:    make(map[string]*sharedDevice),
+	}
+	s.newDevice = s.newExportDevice
+	return s
+}
+
+func (s *NbdServer) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, s.option.FilerGrpcAddress, s.option.GrpcDialOption)
+
+}
+
+func (s *NbdServer) AdjustedUrl(hostAndPort string) string {
+	return hostAndPort
+}
+
+func (s *NbdServer) uploadOption() *filer2.ClientUploadOption {
+	return &filer2.ClientUploadOption{
+		Collection:  s.option.Collection,
+		Replication: s.option.Replication,
+		DataCenter:  s.option.DataCenter,
+		Cipher:      s.option.Cipher,
+	}
+}
+
+func (s *NbdServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go newNbdSession(s, conn).serve()
+	}
+}
+
+// openDevice returns the shared device of the export, which should be released after use
+func (s *NbdServer) openDevice(name string) (blockDevice, error) {
+	s.devicesLock.Lock()
+	defer s.devicesLock.Unlock()
+
+	if device, found := s.devices[name]; found {
+		device.refs++
+		return device.blockDevice, nil
+	}
+	device, err := s.newDevice(name)
+	if err != nil {
+		return nil, err
+	}
+	s.devices[name] = &sharedDevice{blockDevice: device, refs: 1}
+	return device, nil
+}
+
+// releaseDevice closes the device after the last connection to the export is gone
+func (s *NbdServer) releaseDevice(name string) {
+	s.devicesLock.Lock()
+	defer s.devicesLock.Unlock()
+
+	device, found := s.devices[name]
+	if !found {
+		return
+	}
+	device.refs--
+	if device.refs > 0 {
+		return
+	}
+	delete(s.devices, name)
+	if err := device.Close(); err != nil {
+		glog.Errorf("nbd close export %s: %v", name, err)
+	}
+}
+
+func (s *NbdServer) exportPath(name string) (util.FullPath, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return "", fmt.Errorf("invalid export name %q", name)
+	}
+	return util.FullPath(s.option.Directory).Child(name), nil
+}
+
+func (s *NbdServer) newExportDevice(name string) (blockDevice, error) {
+	fullpath, err := s.exportPath(name)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := filer_pb.GetEntry(s, fullpath)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %v", fullpath, err)
+	}
+	if entry == nil {
+		if s.option.NewExportSizeMB <= 0 || s.option.ReadOnly {
+			return nil, fmt.Errorf("export %s: %v", name, filer_pb.ErrNotFound)
+		}
+		if entry, err = s.createExport(fullpath); err != nil {
+			return nil, err
+		}
+	}
+	if entry.IsDirectory {
+		return nil, fmt.Errorf("export %s is a directory", fullpath)
+	}
+	return newFilerDevice(s, fullpath, entry)
+}
+
+func (s *NbdServer) createExport(fullpath util.FullPath) (*filer_pb.Entry, error) {
+	now := time.Now().Unix()
+	entry := &filer_pb.Entry{
+		Name: fullpath.Name(),
+		Attributes: &filer_pb.FuseAttributes{
+			Mtime:       now,
+			Crtime:      now,
+			FileMode:    0660,
+			Collection:  s.option.Collection,
+			Replication: s.option.Replication,
+		},
+		Extended: map[string][]byte{
+			exportSizeKey: []byte(strconv.FormatInt(s.option.NewExportSizeMB*1024*1024, 10)),
+		},
+	}
+	dir, _ := fullpath.DirAndName()
+	err := s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+			OExcl:     true,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create export %s: %v", fullpath, err)
+	}
+	glog.V(0).Infof("nbd created export %s of %d MB", fullpath, s.option.NewExportSizeMB)
+	return entry, nil
+}
+
+// listExports returns the names of the files that are nbd exports
+func (s *NbdServer) listExports() (names []string, err error) {
+	err = filer_pb.ReadDirAllEntries(s, util.FullPath(s.option.Directory), "", func(entry *filer_pb.Entry, isLast bool) error {
+		if !entry.IsDirectory && len(entry.Extended[exportSizeKey]) > 0 {
+			names = append(names, entry.Name)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,299 @@
+package nbd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+type nbdSession struct {
+	server *NbdServer
+	conn   net.Conn
+	reader *bufio.Reader
+	// the export name and its device in the transmission phase
+	exportName string
+	device     blockDevice
+}
+
+func newNbdSession(server *NbdServer, conn net.Conn) *nbdSession {
+	return &nbdSession{
+		server: server,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *nbdSession) serve() {
+	defer c.conn.Close()
+
+	if err := c.negotiate(); err != nil {
+		glog.V(0).Infof("nbd negotiate with %s: %v", c.conn.RemoteAddr(), err)
+		return
+	}
+	if c.device == nil {
+		return
+	}
+	defer c.server.releaseDevice(c.exportName)
+
+	glog.V(1).Infof("nbd %s connected to export %s", c.conn.RemoteAddr(), c.exportName)
+	if err := c.transmit(); err != nil && err != io.EOF {
+		glog.V(0).Infof("nbd %s export %s: %v", c.conn.RemoteAddr(), c.exportName, err)
+	}
+	glog.V(1).Infof("nbd %s disconnected from export %s", c.conn.RemoteAddr(), c.exportName)
+}
+
+func (c *nbdSession) transmissionFlags() uint16 {
+	flags := uint16(nbdFlagHasFlags | nbdFlagSendFlush | nbdFlagSendFua | nbdFlagSendWriteZeroes)
+	if c.server.option.ReadOnly {
+		flags |= nbdFlagReadOnly
+	}
+	return flags
+}
+
+// negotiate runs the fixed newstyle handshake, until the client selects an export or aborts
+func (c *nbdSession) negotiate() error {
+	var buf [18]byte
+	binary.BigEndian.PutUint64(buf[0:8], nbdMagic)
+	binary.BigEndian.PutUint64(buf[8:16], nbdOptionMagic)
+	binary.BigEndian.PutUint16(buf[16:18], nbdFlagFixedNewstyle|nbdFlagNoZeroes)
+	if _, err := c.conn.Write(buf[:]); err != nil {
+		return err
+	}
+
+	var clientFlags uint32
+	if err := binary.Read(c.reader, binary.BigEndian, &clientFlags); err != nil {
+		return err
+	}
+	noZeroes := clientFlags&nbdFlagClientNoZeroes != 0
+
+	for {
+		var header [16]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(header[0:8]) != nbdOptionMagic {
+			return errBadMagic
+		}
+		option := binary.BigEndian.Uint32(header[8:12])
+		length := binary.BigEndian.Uint32(header[12:16])
+		if length > maxOptionDataSize {
+			return fmt.Errorf("option %d data size %d is too large", option, length)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return err
+		}
+
+		switch option {
+		case nbdOptExportName:
+			// no way to report the error but closing the connection
+			if err := c.selectExport(string(data)); err != nil {
+				return err
+			}
+			reply := make([]byte, 10, 10+124)
+			binary.BigEndian.PutUint64(reply[0:8], uint64(c.device.Size()))
+			binary.BigEndian.PutUint16(reply[8:10], c.transmissionFlags())
+			if !noZeroes {
+				reply = reply[:10+124]
+			}
+			_, err := c.conn.Write(reply)
+			return err
+		case nbdOptAbort:
+			writeOptionReply(c.conn, option, nbdRepAck, nil)
+			return nil
+		case nbdOptList:
+			if err := c.replyList(option, length); err != nil {
+				return err
+			}
+		case nbdOptInfo, nbdOptGo:
+			selected, err := c.replyInfo(option, data)
+			if err != nil {
+				return err
+			}
+			if selected {
+				return nil
+			}
+		default:
+			if err := writeOptionReply(c.conn, option, nbdRepErrUnsup, []byte("unsupported option")); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *nbdSession) selectExport(name string) (err error) {
+	if c.device, err = c.server.openDevice(name); err != nil {
+		return err
+	}
+	c.exportName = name
+	return nil
+}
+
+func (c *nbdSession) replyList(option, length uint32) error {
+	if length != 0 {
+		return writeOptionReply(c.conn, option, nbdRepErrInvalid, []byte("unexpected data"))
+	}
+	names, err := c.server.listExports()
+	if err != nil {
+		glog.Errorf("nbd list exports: %v", err)
+		return writeOptionReply(c.conn, option, nbdRepErrPolicy, []byte("failed to list exports"))
+	}
+	for _, name := range names {
+		data := make([]byte, 4+len(name))
+		binary.BigEndian.PutUint32(data[0:4], uint32(len(name)))
+		copy(data[4:], name)
+		if err = writeOptionReply(c.conn, option, nbdRepServer, data); err != nil {
+			return err
+		}
+	}
+	return writeOptionReply(c.conn, option, nbdRepAck, nil)
+}
+
+// replyInfo replies NBD_OPT_INFO and NBD_OPT_GO, and returns true if the export is selected by NBD_OPT_GO
+func (c *nbdSession) replyInfo(option uint32, data []byte) (selected bool, err error) {
+	if len(data) < 6 {
+		return false, writeOptionReply(c.conn, option, nbdRepErrInvalid, []byte("short data"))
+	}
+	nameLength := binary.BigEndian.Uint32(data[0:4])
+	if uint32(len(data)) < 4+nameLength+2 {
+		return false, writeOptionReply(c.conn, option, nbdRepErrInvalid, []byte("short data"))
+	}
+	name := string(data[4 : 4+nameLength])
+	infoCount := int(binary.BigEndian.Uint16(data[4+nameLength : 4+nameLength+2]))
+	infos := data[4+nameLength+2:]
+	if len(infos) != 2*infoCount {
+		return false, writeOptionReply(c.conn, option, nbdRepErrInvalid, []byte("invalid information requests"))
+	}
+	wantBlockSize := false
+	for i := 0; i < infoCount; i++ {
+		if binary.BigEndian.Uint16(infos[2*i:]) == nbdInfoBlockSize {
+			wantBlockSize = true
+		}
+	}
+
+	device, err := c.server.openDevice(name)
+	if err != nil {
+		glog.V(0).Infof("nbd %s open export %q: %v", c.conn.RemoteAddr(), name, err)
+		return false, writeOptionReply(c.conn, option, nbdRepErrUnknown, []byte("unknown export"))
+	}
+	if option == nbdOptGo {
+		c.device, c.exportName = device, name
+	} else {
+		defer c.server.releaseDevice(name)
+	}
+
+	export := make([]byte, 12)
+	binary.BigEndian.PutUint16(export[0:2], nbdInfoExport)
+	binary.BigEndian.PutUint64(export[2:10], uint64(device.Size()))
+	binary.BigEndian.PutUint16(export[10:12], c.transmissionFlags())
+	if err = writeOptionReply(c.conn, option, nbdRepInfo, export); err != nil {
+		return false, err
+	}
+	if wantBlockSize {
+		blockSize := make([]byte, 14)
+		binary.BigEndian.PutUint16(blockSize[0:2], nbdInfoBlockSize)
+		binary.BigEndian.PutUint32(blockSize[2:6], 1)
+		binary.BigEndian.PutUint32(blockSize[6:10], 4096)
+		binary.BigEndian.PutUint32(blockSize[10:14], maxRequestSize)
+		if err = writeOptionReply(c.conn, option, nbdRepInfo, blockSize); err != nil {
+			return false, err
+		}
+	}
+	return option == nbdOptGo, writeOptionReply(c.conn, option, nbdRepAck, nil)
+}
+
+// transmit serves the requests one by one, so a flush covers all the writes replied before it
+func (c *nbdSession) transmit() error {
+	size := uint64(c.device.Size())
+	for {
+		request, err := readRequest(c.reader)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		if request.typ == nbdCmdWrite {
+			if request.length > maxRequestSize {
+				return fmt.Errorf("write request size %d is too large", request.length)
+			}
+			data = make([]byte, request.length)
+			if _, err = io.ReadFull(c.reader, data); err != nil {
+				return err
+			}
+		}
+
+		if request.typ == nbdCmdDisc {
+			return c.device.Flush()
+		}
+
+		reply, errno := c.process(request, data, size)
+		if err = writeSimpleReply(c.conn, request.handle, errno, reply); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *nbdSession) process(request *nbdRequest, data []byte, size uint64) (reply []byte, errno uint32) {
+	if request.offset+uint64(request.length) > size || request.offset+uint64(request.length) < request.offset {
+		if request.typ == nbdCmdWrite || request.typ == nbdCmdWriteZeroes {
+			return nil, nbdEnospc
+		}
+		return nil, nbdEinval
+	}
+
+	var err error
+	switch request.typ {
+	case nbdCmdRead:
+		if request.length > maxRequestSize {
+			return nil, nbdEinval
+		}
+		reply = make([]byte, request.length)
+		if _, err = c.device.ReadAt(reply, int64(request.offset)); err != nil {
+			glog.Errorf("nbd export %s read [%d,%d): %v", c.exportName, request.offset, request.offset+uint64(request.length), err)
+			return nil, nbdEio
+		}
+		return reply, 0
+	case nbdCmdWrite, nbdCmdWriteZeroes:
+		if c.server.option.ReadOnly {
+			return nil, nbdEperm
+		}
+		if request.typ == nbdCmdWrite {
+			_, err = c.device.WriteAt(data, int64(request.offset))
+		} else {
+			err = writeZeroes(c.device, int64(request.offset), int64(request.length))
+		}
+		if err == nil && request.flags&nbdCmdFlagFua != 0 {
+			err = c.device.Flush()
+		}
+	case nbdCmdFlush:
+		err = c.device.Flush()
+	case nbdCmdTrim:
+		// the trimmed range may keep the old content
+		return nil, 0
+	default:
+		return nil, nbdEinval
+	}
+
+	if err != nil {
+		glog.Errorf("nbd export %s command %d [%d,%d): %v", c.exportName, request.typ, request.offset, request.offset+uint64(request.length), err)
+		return nil, nbdEio
+	}
+	return nil, 0
+}
+
+func writeZeroes(device blockDevice, offset, length int64) error {
+	zeroes := make([]byte, min(length, maxRequestSize))
+	for length > 0 {
+		n := min(length, int64(len(zeroes)))
+		if _, err := device.WriteAt(zeroes[:n], offset); err != nil {
+			return err
+		}
+		offset += n
+		length -= n
+	}
+	return nil
+}
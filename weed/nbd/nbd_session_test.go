@@ -0,0 +1,196 @@
+package nbd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+type memoryDevice struct {
+	data    []byte
+	flushes int
+}
+
+func (d *memoryDevice) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, d.data[off:]), nil
+}
+
+func (d *memoryDevice) WriteAt(p []byte, off int64) (int, error) {
+	return copy(d.data[off:], p), nil
+}
+
+func (d *memoryDevice) Size() int64 {
+	return int64(len(d.data))
+}
+
+func (d *memoryDevice) Flush() error {
+	d.flushes++
+	return nil
+}
+
+func (d *memoryDevice) Close() error {
+	return nil
+}
+
+func newTestSession(t *testing.T, device *memoryDevice) (net.Conn, chan bool) {
+	server := &NbdServer{
+		option:  &NbdServerOption{},
+		devices: make(map[string]*sharedDevice),
+		newDevice: func(name string) (blockDevice, error) {
+			if name != "disk" {
+				return nil, fmt.Errorf("unknown export %s", name)
+			}
+			return device, nil
+		},
+	}
+	serverConn, clientConn := net.Pipe()
+	done := make(chan bool)
+	go func() {
+		newNbdSession(server, serverConn).serve()
+		close(done)
+	}()
+
+	var greeting [18]byte
+	if _, err := io.ReadFull(clientConn, greeting[:]); err != nil {
+		t.Fatalf("read greeting: %v", err)
+	}
+	if binary.BigEndian.Uint64(greeting[0:8]) != nbdMagic || binary.BigEndian.Uint64(greeting[8:16]) != nbdOptionMagic {
+		t.Fatalf("unexpected greeting %x", greeting)
+	}
+	binary.Write(clientConn, binary.BigEndian, uint32(nbdFlagClientFixedNewstyle|nbdFlagClientNoZeroes))
+	return clientConn, done
+}
+
+func sendOption(conn net.Conn, option uint32, data []byte) {
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint64(header[0:8], nbdOptionMagic)
+	binary.BigEndian.PutUint32(header[8:12], option)
+	binary.BigEndian.PutUint32(header[12:16], uint32(len(data)))
+	conn.Write(append(header, data...))
+}
+
+func readOptionReply(t *testing.T, conn net.Conn) (replyType uint32, data []byte) {
+	var header [20]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		t.Fatalf("read option reply: %v", err)
+	}
+	if binary.BigEndian.Uint64(header[0:8]) != nbdReplyMagic {
+		t.Fatalf("unexpected option reply %x", header)
+	}
+	data = make([]byte, binary.BigEndian.Uint32(header[16:20]))
+	io.ReadFull(conn, data)
+	return binary.BigEndian.Uint32(header[12:16]), data
+}
+
+func goOption(name string) []byte {
+	data := make([]byte, 4+len(name)+2)
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(name)))
+	copy(data[4:], name)
+	return data
+}
+
+func sendRequest(conn net.Conn, typ uint16, flags uint16, handle, offset uint64, length uint32, data []byte) {
+	request := make([]byte, 28)
+	binary.BigEndian.PutUint32(request[0:4], nbdRequestMagic)
+	binary.BigEndian.PutUint16(request[4:6], flags)
+	binary.BigEndian.PutUint16(request[6:8], typ)
+	binary.BigEndian.PutUint64(request[8:16], handle)
+	binary.BigEndian.PutUint64(request[16:24], offset)
+	binary.BigEndian.PutUint32(request[24:28], length)
+	conn.Write(append(request, data...))
+}
+
+func readReply(t *testing.T, conn net.Conn, handle uint64, dataSize int) (errno uint32, data []byte) {
+	var reply [16]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	if binary.BigEndian.Uint32(reply[0:4]) != nbdResponseMagic || binary.BigEndian.Uint64(reply[8:16]) != handle {
+		t.Fatalf("unexpected reply %x", reply)
+	}
+	errno = binary.BigEndian.Uint32(reply[4:8])
+	if errno == 0 && dataSize > 0 {
+		data = make([]byte, dataSize)
+		io.ReadFull(conn, data)
+	}
+	return
+}
+
+func TestNbdGoAndTransmission(t *testing.T) {
+
+	device := &memoryDevice{data: make([]byte, 1024*1024)}
+	conn, done := newTestSession(t, device)
+	defer conn.Close()
+
+	sendOption(conn, nbdOptGo, goOption("missing"))
+	if replyType, _ := readOptionReply(t, conn); replyType != nbdRepErrUnknown {
+		t.Fatalf("expected unknown export, got %x", replyType)
+	}
+
+	sendOption(conn, nbdOptGo, goOption("disk"))
+	replyType, info := readOptionReply(t, conn)
+	if replyType != nbdRepInfo || binary.BigEndian.Uint64(info[2:10]) != uint64(len(device.data)) {
+		t.Fatalf("unexpected info %x %x", replyType, info)
+	}
+	if flags := binary.BigEndian.Uint16(info[10:12]); flags&nbdFlagSendFlush == 0 || flags&nbdFlagReadOnly != 0 {
+		t.Errorf("unexpected transmission flags %x", flags)
+	}
+	if replyType, _ = readOptionReply(t, conn); replyType != nbdRepAck {
+		t.Fatalf("expected ack, got %x", replyType)
+	}
+
+	sendRequest(conn, nbdCmdWrite, nbdCmdFlagFua, 1, 4096, 5, []byte("hello"))
+	if errno, _ := readReply(t, conn, 1, 0); errno != 0 || device.flushes != 1 {
+		t.Fatalf("write errno %d, flushes %d", errno, device.flushes)
+	}
+
+	sendRequest(conn, nbdCmdRead, 0, 2, 4094, 9, nil)
+	if errno, data := readReply(t, conn, 2, 9); errno != 0 || !bytes.Equal(data, []byte("\x00\x00hello\x00\x00")) {
+		t.Fatalf("read errno %d, data %q", errno, data)
+	}
+
+	sendRequest(conn, nbdCmdWriteZeroes, 0, 3, 4096, 2, nil)
+	if errno, _ := readReply(t, conn, 3, 0); errno != 0 || string(device.data[4096:4101]) != "\x00\x00llo" {
+		t.Fatalf("write zeroes errno %d, data %q", errno, device.data[4096:4101])
+	}
+
+	sendRequest(conn, nbdCmdRead, 0, 4, uint64(len(device.data))-1, 2, nil)
+	if errno, _ := readReply(t, conn, 4, 2); errno != nbdEinval {
+		t.Fatalf("expected EINVAL reading beyond the device, got %d", errno)
+	}
+
+	sendRequest(conn, nbdCmdFlush, 0, 5, 0, 0, nil)
+	if errno, _ := readReply(t, conn, 5, 0); errno != 0 || device.flushes != 2 {
+		t.Fatalf("flush errno %d, flushes %d", errno, device.flushes)
+	}
+
+	sendRequest(conn, nbdCmdDisc, 0, 6, 0, 0, nil)
+	<-done
+	if device.flushes != 3 {
+		t.Errorf("expected flush on disconnect, flushes %d", device.flushes)
+	}
+
+}
+
+func TestNbdExportName(t *testing.T) {
+
+	device := &memoryDevice{data: make([]byte, 4096)}
+	conn, done := newTestSession(t, device)
+	defer conn.Close()
+
+	sendOption(conn, nbdOptExportName, []byte("disk"))
+	var reply [10]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		t.Fatalf("read export reply: %v", err)
+	}
+	if binary.BigEndian.Uint64(reply[0:8]) != 4096 {
+		t.Fatalf("unexpected export size %d", binary.BigEndian.Uint64(reply[0:8]))
+	}
+
+	sendRequest(conn, nbdCmdDisc, 0, 1, 0, 0, nil)
+	<-done
+
+}
@@ -0,0 +1,80 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// A file handle is at most 64 bytes in NFSv3.
+// Short paths are put into the handle directly, so these handles are still valid after a restart.
+// Longer paths are hashed, and the hash is kept in the handle table.
+
+const (
+	maxHandleSize     = 64
+	handleInlinePath  = 1
+	handleHashedPath  = 2
+	defaultMaxHandles = 1000000
+)
+
+type handleTable struct {
+	paths      map[uint64]util.FullPath
+	maxHandles int
+	sync.RWMutex
+}
+
+func newHandleTable(maxHandles int) *handleTable {
+	if maxHandles <= 0 {
+		maxHandles = defaultMaxHandles
+	}
+	return &handleTable{
+		paths:      make(map[uint64]util.FullPath),
+		maxHandles: maxHandles,
+	}
+}
+
+func (t *handleTable) toHandle(p util.FullPath) []byte {
+	if len(p)+1 <= maxHandleSize {
+		return append([]byte{handleInlinePath}, p...)
+	}
+
+	inode := p.AsInode()
+	t.Lock()
+	if len(t.paths) >= t.maxHandles {
+		// drop some handles, and the clients will see stale handles for them
+		for k := range t.paths {
+			delete(t.paths, k)
+			if len(t.paths) < t.maxHandles*9/10 {
+				break
+			}
+		}
+	}
+	t.paths[inode] = p
+	t.Unlock()
+
+	handle := make([]byte, 9)
+	handle[0] = handleHashedPath
+	binary.BigEndian.PutUint64(handle[1:], inode)
+	return handle
+}
+
+// fromHandle returns false if the handle is not valid or not known any more
+func (t *handleTable) fromHandle(handle []byte) (util.FullPath, bool) {
+	if len(handle) < 2 {
+		return "", false
+	}
+	switch handle[0] {
+	case handleInlinePath:
+		return util.FullPath(handle[1:]), handle[1] == '/'
+	case handleHashedPath:
+		if len(handle) != 9 {
+			return "", false
+		}
+		t.RLock()
+		p, found := t.paths[binary.BigEndian.Uint64(handle[1:])]
+		t.RUnlock()
+		return p, found
+	}
+	return "", false
+}
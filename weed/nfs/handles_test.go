@@ -0,0 +1,82 @@
+package nfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestHandleRoundTrip(t *testing.T) {
+	table := newHandleTable(0)
+
+	for _, p := range []util.FullPath{
+		"/",
+		"/a/b.txt",
+		util.FullPath("/" + strings.Repeat("x", 100) + "/long.txt"),
+	} {
+		handle := table.toHandle(p)
+		if len(handle) > maxHandleSize {
+			t.Errorf("handle of %s has %d bytes", p, len(handle))
+		}
+		back, ok := table.fromHandle(handle)
+		if !ok || back != p {
+			t.Errorf("handle of %s resolved to %s, %v", p, back, ok)
+		}
+	}
+
+	if _, ok := newHandleTable(0).fromHandle(table.toHandle(util.FullPath("/" + strings.Repeat("y", 100)))); ok {
+		t.Errorf("hashed handle should be unknown to a new table")
+	}
+	if _, ok := table.fromHandle([]byte{handleInlinePath, 'a'}); ok {
+		t.Errorf("relative path should not be a valid handle")
+	}
+}
+
+func TestXdrRoundTrip(t *testing.T) {
+	w := &xdrWriter{}
+	w.uint32(7)
+	w.uint64(1 << 40)
+	w.bool(true)
+	w.string("hello")
+	w.opaque([]byte{1, 2, 3, 4, 5})
+	if len(w.Bytes())%4 != 0 {
+		t.Fatalf("xdr is not aligned: %d bytes", len(w.Bytes()))
+	}
+
+	r := newXdrReader(bytes.NewReader(w.Bytes()))
+	if v, _ := r.uint32(); v != 7 {
+		t.Errorf("uint32: %d", v)
+	}
+	if v, _ := r.uint64(); v != 1<<40 {
+		t.Errorf("uint64: %d", v)
+	}
+	if v, _ := r.bool(); !v {
+		t.Errorf("bool: %v", v)
+	}
+	if v, _ := r.string(); v != "hello" {
+		t.Errorf("string: %s", v)
+	}
+	if v, _ := r.opaque(); !bytes.Equal(v, []byte{1, 2, 3, 4, 5}) {
+		t.Errorf("opaque: %v", v)
+	}
+	if _, err := r.uint32(); err == nil {
+		t.Errorf("expected the end of data")
+	}
+}
+
+func TestIsExported(t *testing.T) {
+	s := &NfsServer{exportPath: "/exports/a"}
+	for p, expected := range map[util.FullPath]bool{
+		"/exports/a":     true,
+		"/exports/a/b":   true,
+		"/exports/ab":    false,
+		"/exports":       false,
+		"/other/a/b.txt": false,
+	} {
+		if s.isExported(p) != expected {
+			t.Errorf("isExported(%s) = %v", p, !expected)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package nfs
+
+import (
+	"os"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// MOUNT version 3, RFC 1813 Appendix I
+
+const (
+	mountProgram = 100005
+	mountVersion = 3
+
+	mountProcNull    = 0
+	mountProcMnt     = 1
+	mountProcDump    = 2
+	mountProcUmnt    = 3
+	mountProcUmntAll = 4
+	mountProcExport  = 5
+
+	mountOk        = 0
+	mountErrNoEnt  = 2
+	mountErrAccess = 13
+	mountErrNotDir = 20
+)
+
+func (s *NfsServer) mountProgram() *rpcProgram {
+	return &rpcProgram{
+		Program: mountProgram,
+		Version: mountVersion,
+		Procedures: map[uint32]rpcProcedure{
+			mountProcNull:    rpcNull,
+			mountProcMnt:     s.mountMnt,
+			mountProcDump:    s.mountDump,
+			mountProcUmnt:    s.mountUmnt,
+			mountProcUmntAll: rpcNull,
+			mountProcExport:  s.mountExport,
+		},
+	}
+}
+
+func rpcNull(req *rpcRequest, reply *xdrWriter) uint32 {
+	return rpcSuccess
+}
+
+func (s *NfsServer) mountMnt(req *rpcRequest, reply *xdrWriter) uint32 {
+	dirPath, err := req.Args.string()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	p := util.FullPath(dirPath)
+	if dirPath == "" || dirPath[0] != '/' || !s.isExported(p) {
+		glog.V(0).Infof("nfs mount %s: not under export %s", dirPath, s.exportPath)
+		reply.uint32(mountErrAccess)
+		return rpcSuccess
+	}
+	if len(dirPath) > 1 && dirPath[len(dirPath)-1] == '/' {
+		p = util.FullPath(dirPath[:len(dirPath)-1])
+	}
+
+	entry, err := s.lookupEntry(p)
+	if err == os.ErrNotExist {
+		reply.uint32(mountErrNoEnt)
+		return rpcSuccess
+	}
+	if err != nil {
+		glog.Errorf("nfs mount %s: %v", p, err)
+		reply.uint32(mountErrAccess)
+		return rpcSuccess
+	}
+	if !entry.IsDirectory {
+		reply.uint32(mountErrNotDir)
+		return rpcSuccess
+	}
+
+	glog.V(0).Infof("nfs mount %s", p)
+	reply.uint32(mountOk)
+	reply.opaque(s.toHandle(p))
+	reply.uint32(1)
+	reply.uint32(authSys)
+	return rpcSuccess
+}
+
+// mountDump does not track the mounted clients
+func (s *NfsServer) mountDump(req *rpcRequest, reply *xdrWriter) uint32 {
+	reply.bool(false)
+	return rpcSuccess
+}
+
+func (s *NfsServer) mountUmnt(req *rpcRequest, reply *xdrWriter) uint32 {
+	if _, err := req.Args.string(); err != nil {
+		return rpcGarbageArgs
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) mountExport(req *rpcRequest, reply *xdrWriter) uint32 {
+	reply.bool(true)
+	reply.string(string(s.exportPath))
+	reply.bool(false) // no groups
+	reply.bool(false)
+	return rpcSuccess
+}
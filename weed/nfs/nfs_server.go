@@ -0,0 +1,335 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+type NfsServerOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	ExportPath       string
+	Collection       string
+	Replication      string
+	DataCenter       string
+	Cipher           bool
+	ChunkSizeMB      int
+	CacheDir         string
+	CacheSizeMB      int64
+	AttrCacheTTL     time.Duration
+	ReadOnly         bool
+}
+
+type NfsServer struct {
+	option        *NfsServerOption
+	exportPath    util.FullPath
+	handles       *handleTable
+	chunkCache    *chunk_cache.ChunkCache
+	writeVerifier []byte
+
+	attrCache     map[util.FullPath]*cachedEntry
+	dirCache      map[util.FullPath]*cachedListing
+	attrCacheLock sync.Mutex
+
+	writers     map[util.FullPath]*pendingWriter
+	writersLock sync.Mutex
+}
+
+type cachedEntry struct {
+	entry   *filer_pb.Entry
+	expires time.Time
+}
+
+type cachedListing struct {
+	entries []*filer_pb.Entry
+	expires time.Time
+}
+
+// pendingWriter keeps the unstable writes of a file until COMMIT, or until the file is idle for a while
+type pendingWriter struct {
+	writer    *filer2.ClientFileWriter
+	size      uint64
+	lastWrite time.Time
+	closed    bool
+	sync.Mutex
+}
+
+const pendingWriterIdleFlush = 5 * time.Second
+
+var _ = filer_pb.FilerClient(&NfsServer{})
+
+func NewNfsServer(option *NfsServerOption) *NfsServer {
+	exportPath := util.FullPath(strings.TrimSuffix(option.ExportPath, "/"))
+	if exportPath == "" {
+		exportPath = "/"
+	}
+	writeVerifier := make([]byte, 8)
+	binary.BigEndian.PutUint64(writeVerifier, uint64(time.Now().UnixNano()))
+
+	s := &NfsServer{
+		option:        option,
+		exportPath:    exportPath,
+		handles:       newHandleTable(defaultMaxHandles),
+		chunkCache:    chunk_cache.NewChunkCache(256, option.CacheDir, option.CacheSizeMB),
+		writeVerifier: writeVerifier,
+		attrCache:     make(map[util.FullPath]*cachedEntry),
+		dirCache:      make(map[util.FullPath]*cachedListing),
+		writers:       make(map[util.FullPath]*pendingWriter),
+	}
+	go s.loopFlushIdleWriters()
+	return s
+}
+
+func (s *NfsServer) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, s.option.FilerGrpcAddress, s.option.GrpcDialOption)
+
+}
+
+func (s *NfsServer) AdjustedUrl(hostAndPort string) string {
+	return hostAndPort
+}
+
+func (s *NfsServer) Serve(listener net.Listener) error {
+	return newRpcServer(s.mountProgram(), s.nfsProgram()).Serve(listener)
+}
+
+func (s *NfsServer) uploadOption() *filer2.ClientUploadOption {
+	return &filer2.ClientUploadOption{
+		Collection:  s.option.Collection,
+		Replication: s.option.Replication,
+		DataCenter:  s.option.DataCenter,
+		Cipher:      s.option.Cipher,
+	}
+}
+
+func (s *NfsServer) isExported(p util.FullPath) bool {
+	return s.exportPath == "/" || p == s.exportPath || strings.HasPrefix(string(p), string(s.exportPath)+"/")
+}
+
+func (s *NfsServer) toHandle(p util.FullPath) []byte {
+	return s.handles.toHandle(p)
+}
+
+func (s *NfsServer) fromHandle(handle []byte) (util.FullPath, bool) {
+	p, ok := s.handles.fromHandle(handle)
+	if !ok || !s.isExported(p) {
+		return "", false
+	}
+	return p, true
+}
+
+// lookupEntry returns os.ErrNotExist if the entry is not found
+func (s *NfsServer) lookupEntry(p util.FullPath) (*filer_pb.Entry, error) {
+	if p == "/" {
+		return &filer_pb.Entry{
+			Name:        "/",
+			IsDirectory: true,
+			Attributes: &filer_pb.FuseAttributes{
+				FileMode: uint32(os.ModeDir | 0777),
+				Mtime:    time.Now().Unix(),
+			},
+		}, nil
+	}
+
+	now := time.Now()
+	s.attrCacheLock.Lock()
+	cached, found := s.attrCache[p]
+	s.attrCacheLock.Unlock()
+	if found && now.Before(cached.expires) {
+		return cached.entry, nil
+	}
+
+	entry, err := filer_pb.GetEntry(s, p)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	if entry.Attributes == nil {
+		entry.Attributes = &filer_pb.FuseAttributes{}
+	}
+
+	if s.option.AttrCacheTTL > 0 {
+		s.attrCacheLock.Lock()
+		s.attrCache[p] = &cachedEntry{entry: entry, expires: now.Add(s.option.AttrCacheTTL)}
+		s.attrCacheLock.Unlock()
+	}
+	return entry, nil
+}
+
+func (s *NfsServer) listEntries(dir util.FullPath) ([]*filer_pb.Entry, error) {
+	now := time.Now()
+	s.attrCacheLock.Lock()
+	cached, found := s.dirCache[dir]
+	s.attrCacheLock.Unlock()
+	if found && now.Before(cached.expires) {
+		return cached.entries, nil
+	}
+
+	var entries []*filer_pb.Entry
+	err := filer_pb.ReadDirAllEntries(s, dir, "", func(entry *filer_pb.Entry, isLast bool) error {
+		if entry.Attributes == nil {
+			entry.Attributes = &filer_pb.FuseAttributes{}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the listing is kept a bit longer, since large directories are read in several READDIR calls
+	s.attrCacheLock.Lock()
+	s.dirCache[dir] = &cachedListing{entries: entries, expires: now.Add(s.option.AttrCacheTTL + 10*time.Second)}
+	for _, entry := range entries {
+		if s.option.AttrCacheTTL > 0 {
+			s.attrCache[dir.Child(entry.Name)] = &cachedEntry{entry: entry, expires: now.Add(s.option.AttrCacheTTL)}
+		}
+	}
+	s.attrCacheLock.Unlock()
+
+	return entries, nil
+}
+
+// invalidate forgets the cached attributes of the entry, and the cached listing of its parent directory
+func (s *NfsServer) invalidate(p util.FullPath) {
+	dir, _ := p.DirAndName()
+	s.attrCacheLock.Lock()
+	delete(s.attrCache, p)
+	delete(s.dirCache, p)
+	delete(s.dirCache, util.FullPath(dir))
+	if len(s.attrCache) > 100000 {
+		s.attrCache = make(map[util.FullPath]*cachedEntry)
+	}
+	s.attrCacheLock.Unlock()
+}
+
+func (s *NfsServer) getWriter(p util.FullPath) (*pendingWriter, error) {
+	s.writersLock.Lock()
+	defer s.writersLock.Unlock()
+	if w, found := s.writers[p]; found && !w.closed {
+		return w, nil
+	}
+	entry, err := s.lookupEntry(p)
+	if err != nil {
+		return nil, err
+	}
+	// the writer changes the chunks, so it should not share the entry with the attribute cache
+	entry = proto.Clone(entry).(*filer_pb.Entry)
+	w := &pendingWriter{
+		writer: filer2.NewClientFileWriter(s, p, entry, s.option.ChunkSizeMB*1024*1024, s.uploadOption()),
+		size:   filer2.TotalSize(entry.Chunks),
+	}
+	s.writers[p] = w
+	return w, nil
+}
+
+func (s *NfsServer) findWriter(p util.FullPath) *pendingWriter {
+	s.writersLock.Lock()
+	defer s.writersLock.Unlock()
+	return s.writers[p]
+}
+
+func (s *NfsServer) pendingSize(p util.FullPath) (uint64, bool) {
+	w := s.findWriter(p)
+	if w == nil {
+		return 0, false
+	}
+	w.Lock()
+	defer w.Unlock()
+	return w.size, !w.closed
+}
+
+// flushWriter saves the pending writes of the file to the filer
+func (s *NfsServer) flushWriter(p util.FullPath) error {
+	w := s.findWriter(p)
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return nil
+	}
+	err := w.writer.Flush()
+	s.invalidate(p)
+	return err
+}
+
+// closeWriter saves the pending writes, and forgets the writer
+func (s *NfsServer) closeWriter(p util.FullPath) error {
+	w := s.findWriter(p)
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	var err error
+	if !w.closed {
+		err = w.writer.Close()
+		w.closed = true
+		s.invalidate(p)
+	}
+	w.Unlock()
+	s.forgetWriter(p, w)
+	return err
+}
+
+// dropWriter discards the pending writes of a removed file
+func (s *NfsServer) dropWriter(p util.FullPath) {
+	w := s.findWriter(p)
+	if w == nil {
+		return
+	}
+	w.Lock()
+	w.closed = true
+	w.Unlock()
+	s.forgetWriter(p, w)
+}
+
+func (s *NfsServer) forgetWriter(p util.FullPath, w *pendingWriter) {
+	s.writersLock.Lock()
+	if s.writers[p] == w {
+		delete(s.writers, p)
+	}
+	s.writersLock.Unlock()
+}
+
+func (s *NfsServer) loopFlushIdleWriters() {
+	for range time.Tick(time.Second) {
+		var idle []util.FullPath
+		now := time.Now()
+		s.writersLock.Lock()
+		for p, w := range s.writers {
+			w.Lock()
+			if now.Sub(w.lastWrite) > pendingWriterIdleFlush {
+				idle = append(idle, p)
+			}
+			w.Unlock()
+		}
+		s.writersLock.Unlock()
+		for _, p := range idle {
+			if err := s.closeWriter(p); err != nil {
+				glog.Errorf("nfs flush %s: %v", p, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,1169 @@
+package nfs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// NFS version 3, RFC 1813
+
+const (
+	nfsProgram = 100003
+	nfsVersion = 3
+
+	nfsProcNull        = 0
+	nfsProcGetAttr     = 1
+	nfsProcSetAttr     = 2
+	nfsProcLookup      = 3
+	nfsProcAccess      = 4
+	nfsProcReadLink    = 5
+	nfsProcRead        = 6
+	nfsProcWrite       = 7
+	nfsProcCreate      = 8
+	nfsProcMkdir       = 9
+	nfsProcSymlink     = 10
+	nfsProcMknod       = 11
+	nfsProcRemove      = 12
+	nfsProcRmdir       = 13
+	nfsProcRename      = 14
+	nfsProcLink        = 15
+	nfsProcReadDir     = 16
+	nfsProcReadDirPlus = 17
+	nfsProcFsStat      = 18
+	nfsProcFsInfo      = 19
+	nfsProcPathConf    = 20
+	nfsProcCommit      = 21
+
+	nfs3Ok             = 0
+	nfs3ErrPerm        = 1
+	nfs3ErrNoEnt       = 2
+	nfs3ErrIO          = 5
+	nfs3ErrAccess      = 13
+	nfs3ErrExist       = 17
+	nfs3ErrNotDir      = 20
+	nfs3ErrIsDir       = 21
+	nfs3ErrInval       = 22
+	nfs3ErrRoFs        = 30
+	nfs3ErrNameTooLong = 63
+	nfs3ErrNotEmpty    = 66
+	nfs3ErrStale       = 70
+	nfs3ErrBadHandle   = 10001
+	nfs3ErrNotSupp     = 10004
+	nfs3ErrTooSmall    = 10005
+	nfs3ErrServerFault = 10006
+
+	nf3Reg = 1
+	nf3Dir = 2
+	nf3Lnk = 5
+
+	access3Read    = 0x01
+	access3Lookup  = 0x02
+	access3Modify  = 0x04
+	access3Extend  = 0x08
+	access3Delete  = 0x10
+	access3Execute = 0x20
+
+	unstable = 0
+	fileSync = 2
+
+	createUnchecked = 0
+	createGuarded   = 1
+	createExclusive = 2
+
+	timeDontChange   = 0
+	timeSetToServer  = 1
+	timeSetToClient  = 2
+	nfsMaxTransfer   = 1024 * 1024
+	nfsMaxNameLength = 255
+
+	// the verifier of exclusive CREATE is kept in the extended attributes
+	extendedCreateVerifier = "nfs.create.verifier"
+)
+
+func (s *NfsServer) nfsProgram() *rpcProgram {
+	return &rpcProgram{
+		Program: nfsProgram,
+		Version: nfsVersion,
+		Procedures: map[uint32]rpcProcedure{
+			nfsProcNull:        rpcNull,
+			nfsProcGetAttr:     s.nfsGetAttr,
+			nfsProcSetAttr:     s.nfsSetAttr,
+			nfsProcLookup:      s.nfsLookup,
+			nfsProcAccess:      s.nfsAccess,
+			nfsProcReadLink:    s.nfsReadLink,
+			nfsProcRead:        s.nfsRead,
+			nfsProcWrite:       s.nfsWrite,
+			nfsProcCreate:      s.nfsCreate,
+			nfsProcMkdir:       s.nfsMkdir,
+			nfsProcSymlink:     s.nfsSymlink,
+			nfsProcMknod:       s.nfsNotSupportedOnDir,
+			nfsProcRemove:      s.nfsRemove,
+			nfsProcRmdir:       s.nfsRmdir,
+			nfsProcRename:      s.nfsRename,
+			nfsProcLink:        s.nfsLink,
+			nfsProcReadDir:     s.nfsReadDir,
+			nfsProcReadDirPlus: s.nfsReadDirPlus,
+			nfsProcFsStat:      s.nfsFsStat,
+			nfsProcFsInfo:      s.nfsFsInfo,
+			nfsProcPathConf:    s.nfsPathConf,
+			nfsProcCommit:      s.nfsCommit,
+		},
+	}
+}
+
+type setAttributes struct {
+	mode      *uint32
+	uid       *uint32
+	gid       *uint32
+	size      *uint64
+	atimeHow  uint32
+	mtimeHow  uint32
+	mtime     int64
+	hasChange bool
+}
+
+func readHandle(x *xdrReader) ([]byte, error) {
+	handle, err := x.opaque()
+	if err == nil && len(handle) > maxHandleSize {
+		err = errXdrTooLarge
+	}
+	return handle, err
+}
+
+func readSetAttributes(x *xdrReader) (*setAttributes, error) {
+	attr := &setAttributes{}
+	readOptional := func() (*uint32, error) {
+		set, err := x.bool()
+		if err != nil || !set {
+			return nil, err
+		}
+		v, err := x.uint32()
+		return &v, err
+	}
+	var err error
+	if attr.mode, err = readOptional(); err != nil {
+		return nil, err
+	}
+	if attr.uid, err = readOptional(); err != nil {
+		return nil, err
+	}
+	if attr.gid, err = readOptional(); err != nil {
+		return nil, err
+	}
+	setSize, err := x.bool()
+	if err != nil {
+		return nil, err
+	}
+	if setSize {
+		size, err := x.uint64()
+		if err != nil {
+			return nil, err
+		}
+		attr.size = &size
+	}
+	for _, how := range []*uint32{&attr.atimeHow, &attr.mtimeHow} {
+		if *how, err = x.uint32(); err != nil {
+			return nil, err
+		}
+		if *how == timeSetToClient {
+			seconds, err := x.uint32()
+			if err != nil {
+				return nil, err
+			}
+			if _, err = x.uint32(); err != nil {
+				return nil, err
+			}
+			if how == &attr.mtimeHow {
+				attr.mtime = int64(seconds)
+			}
+		}
+	}
+	attr.hasChange = attr.mode != nil || attr.uid != nil || attr.gid != nil || attr.size != nil || attr.mtimeHow != timeDontChange
+	return attr, nil
+}
+
+func toNfsStatus(err error) uint32 {
+	switch {
+	case err == nil:
+		return nfs3Ok
+	case err == os.ErrNotExist:
+		return nfs3ErrNoEnt
+	}
+	return nfs3ErrIO
+}
+
+func checkName(name string) uint32 {
+	switch {
+	case name == "" || name == "." || name == ".." || strings.Contains(name, "/"):
+		return nfs3ErrInval
+	case len(name) > nfsMaxNameLength:
+		return nfs3ErrNameTooLong
+	}
+	return nfs3Ok
+}
+
+func (s *NfsServer) writeAttributes(reply *xdrWriter, p util.FullPath, entry *filer_pb.Entry) {
+	attr := entry.Attributes
+	fileType, nlink := uint32(nf3Reg), uint32(1)
+	size := filer2.TotalSize(entry.Chunks)
+	if pendingSize, found := s.pendingSize(p); found {
+		size = pendingSize
+	}
+	switch {
+	case entry.IsDirectory:
+		fileType, nlink, size = nf3Dir, 2, 4096
+	case attr.SymlinkTarget != "":
+		fileType, size = nf3Lnk, uint64(len(attr.SymlinkTarget))
+	}
+	reply.uint32(fileType)
+	reply.uint32(uint32(os.FileMode(attr.FileMode).Perm()))
+	reply.uint32(nlink)
+	reply.uint32(attr.Uid)
+	reply.uint32(attr.Gid)
+	reply.uint64(size)
+	reply.uint64(size)
+	reply.uint32(0) // rdev
+	reply.uint32(0)
+	reply.uint64(s.exportPath.AsInode()) // fsid
+	reply.uint64(p.AsInode())
+	for i := 0; i < 3; i++ {
+		// the filer only keeps the modification time
+		reply.uint32(uint32(attr.Mtime))
+		reply.uint32(0)
+	}
+}
+
+func (s *NfsServer) writePostOpAttributes(reply *xdrWriter, p util.FullPath) {
+	if p == "" {
+		reply.bool(false)
+		return
+	}
+	entry, err := s.lookupEntry(p)
+	if err != nil {
+		reply.bool(false)
+		return
+	}
+	reply.bool(true)
+	s.writeAttributes(reply, p, entry)
+}
+
+// writeWccData does not keep the attributes before the operation
+func (s *NfsServer) writeWccData(reply *xdrWriter, p util.FullPath) {
+	reply.bool(false)
+	s.writePostOpAttributes(reply, p)
+}
+
+func (s *NfsServer) writeNewObject(reply *xdrWriter, p util.FullPath) {
+	reply.bool(true)
+	reply.opaque(s.toHandle(p))
+	s.writePostOpAttributes(reply, p)
+}
+
+// readTarget reads the handle and returns the path, or the status if the handle is not valid
+func (s *NfsServer) readTarget(x *xdrReader) (util.FullPath, uint32, error) {
+	handle, err := readHandle(x)
+	if err != nil {
+		return "", nfs3Ok, err
+	}
+	p, ok := s.fromHandle(handle)
+	if !ok {
+		if len(handle) == 0 || (handle[0] != handleInlinePath && handle[0] != handleHashedPath) {
+			return "", nfs3ErrBadHandle, nil
+		}
+		return "", nfs3ErrStale, nil
+	}
+	return p, nfs3Ok, nil
+}
+
+// readDirTarget reads the diropargs3 and returns the directory and the child path
+func (s *NfsServer) readDirTarget(x *xdrReader) (dir util.FullPath, child util.FullPath, name string, status uint32, err error) {
+	if dir, status, err = s.readTarget(x); err != nil {
+		return
+	}
+	if name, err = x.string(); err != nil || status != nfs3Ok {
+		return
+	}
+	child = dir.Child(name)
+	return
+}
+
+func (s *NfsServer) checkWritable(dir util.FullPath, name string) uint32 {
+	if s.option.ReadOnly {
+		return nfs3ErrRoFs
+	}
+	if status := checkName(name); status != nfs3Ok {
+		return status
+	}
+	entry, err := s.lookupEntry(dir)
+	if err != nil {
+		return toNfsStatus(err)
+	}
+	if !entry.IsDirectory {
+		return nfs3ErrNotDir
+	}
+	return nfs3Ok
+}
+
+func (s *NfsServer) nfsGetAttr(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	var entry *filer_pb.Entry
+	if status == nfs3Ok {
+		entry, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	reply.uint32(status)
+	if status == nfs3Ok {
+		s.writeAttributes(reply, p, entry)
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsSetAttr(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	attr, err := readSetAttributes(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if status == nfs3Ok {
+		status = s.setAttributes(p, attr)
+	}
+	reply.uint32(status)
+	s.writeWccData(reply, p)
+	return rpcSuccess
+}
+
+func (s *NfsServer) setAttributes(p util.FullPath, attr *setAttributes) uint32 {
+	if s.option.ReadOnly {
+		return nfs3ErrRoFs
+	}
+	if !attr.hasChange {
+		return nfs3Ok
+	}
+	if err := s.closeWriter(p); err != nil {
+		glog.Errorf("nfs setattr %s: %v", p, err)
+		return nfs3ErrIO
+	}
+	s.invalidate(p)
+	entry, err := s.lookupEntry(p)
+	if err != nil {
+		return toNfsStatus(err)
+	}
+
+	if attr.size != nil && *attr.size != filer2.TotalSize(entry.Chunks) {
+		if entry.IsDirectory {
+			return nfs3ErrIsDir
+		}
+		// chunks can not be cut in the middle
+		if *attr.size != 0 {
+			return nfs3ErrNotSupp
+		}
+		entry.Chunks = nil
+	}
+	if attr.mode != nil {
+		entry.Attributes.FileMode = uint32(os.FileMode(entry.Attributes.FileMode)&^os.ModePerm) | (*attr.mode & uint32(os.ModePerm))
+	}
+	if attr.uid != nil {
+		entry.Attributes.Uid = *attr.uid
+	}
+	if attr.gid != nil {
+		entry.Attributes.Gid = *attr.gid
+	}
+	switch attr.mtimeHow {
+	case timeSetToServer:
+		entry.Attributes.Mtime = time.Now().Unix()
+	case timeSetToClient:
+		entry.Attributes.Mtime = attr.mtime
+	}
+
+	dir, _ := p.DirAndName()
+	err = s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		})
+		return err
+	})
+	s.invalidate(p)
+	if err != nil {
+		glog.Errorf("nfs setattr %s: %v", p, err)
+		return nfs3ErrIO
+	}
+	return nfs3Ok
+}
+
+func (s *NfsServer) nfsLookup(req *rpcRequest, reply *xdrWriter) uint32 {
+	dir, p, name, status, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if status == nfs3Ok {
+		switch name {
+		case ".":
+			p = dir
+		case "..":
+			p = dir
+			if dir != s.exportPath {
+				parent, _ := dir.DirAndName()
+				p = util.FullPath(parent)
+			}
+		default:
+			status = checkName(name)
+		}
+	}
+	var entry *filer_pb.Entry
+	if status == nfs3Ok {
+		entry, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	reply.uint32(status)
+	if status == nfs3Ok {
+		reply.opaque(s.toHandle(p))
+		reply.bool(true)
+		s.writeAttributes(reply, p, entry)
+	}
+	s.writePostOpAttributes(reply, dir)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsAccess(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	access, err := req.Args.uint32()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if status == nfs3Ok {
+		_, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status == nfs3Ok {
+		// the permissions are checked by the clients
+		if s.option.ReadOnly {
+			access &^= access3Modify | access3Extend | access3Delete
+		}
+		reply.uint32(access & (access3Read | access3Lookup | access3Modify | access3Extend | access3Delete | access3Execute))
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsReadLink(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	var entry *filer_pb.Entry
+	if status == nfs3Ok {
+		entry, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	if status == nfs3Ok && entry.Attributes.SymlinkTarget == "" {
+		status = nfs3ErrInval
+	}
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status == nfs3Ok {
+		reply.string(entry.Attributes.SymlinkTarget)
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsRead(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	offset, err := req.Args.uint64()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	count, err := req.Args.uint32()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+
+	var entry *filer_pb.Entry
+	if status == nfs3Ok {
+		if err = s.flushWriter(p); err != nil {
+			glog.Errorf("nfs read %s: %v", p, err)
+			status = nfs3ErrIO
+		}
+	}
+	if status == nfs3Ok {
+		entry, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	if status == nfs3Ok && entry.IsDirectory {
+		status = nfs3ErrIsDir
+	}
+
+	var data []byte
+	var eof bool
+	if status == nfs3Ok {
+		if count > nfsMaxTransfer {
+			count = nfsMaxTransfer
+		}
+		size := filer2.TotalSize(entry.Chunks)
+		if offset < size {
+			if uint64(count) > size-offset {
+				count = uint32(size - offset)
+			}
+			data = make([]byte, count)
+			reader := filer2.NewChunkReaderAtForEntry(s, entry, s.chunkCache)
+			n, err := reader.ReadAt(data, int64(offset))
+			if err != nil && n < len(data) {
+				glog.Errorf("nfs read %s [%d,%d): %v", p, offset, offset+uint64(count), err)
+				status = nfs3ErrIO
+			}
+			data = data[:n]
+		}
+		eof = offset+uint64(len(data)) >= size
+	}
+
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status == nfs3Ok {
+		reply.uint32(uint32(len(data)))
+		reply.bool(eof)
+		reply.opaque(data)
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsWrite(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	offset, err := req.Args.uint64()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if _, err = req.Args.uint32(); err != nil {
+		return rpcGarbageArgs
+	}
+	stable, err := req.Args.uint32()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	data, err := req.Args.opaque()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+
+	if status == nfs3Ok && s.option.ReadOnly {
+		status = nfs3ErrRoFs
+	}
+	if status == nfs3Ok {
+		status = s.write(p, data, offset)
+	}
+	committed := uint32(unstable)
+	if status == nfs3Ok && stable != unstable {
+		if err = s.flushWriter(p); err != nil {
+			glog.Errorf("nfs write %s: %v", p, err)
+			status = nfs3ErrIO
+		}
+		committed = fileSync
+	}
+
+	reply.uint32(status)
+	s.writeWccData(reply, p)
+	if status == nfs3Ok {
+		reply.uint32(uint32(len(data)))
+		reply.uint32(committed)
+		reply.fixedOpaque(s.writeVerifier)
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) write(p util.FullPath, data []byte, offset uint64) uint32 {
+	entry, err := s.lookupEntry(p)
+	if err != nil {
+		return toNfsStatus(err)
+	}
+	if entry.IsDirectory {
+		return nfs3ErrIsDir
+	}
+	for {
+		w, err := s.getWriter(p)
+		if err != nil {
+			return toNfsStatus(err)
+		}
+		w.Lock()
+		if w.closed {
+			// the writer was just closed by someone else
+			w.Unlock()
+			continue
+		}
+		_, err = w.writer.WriteAt(data, int64(offset))
+		if end := offset + uint64(len(data)); end > w.size {
+			w.size = end
+		}
+		w.lastWrite = time.Now()
+		w.Unlock()
+		if err != nil {
+			glog.Errorf("nfs write %s: %v", p, err)
+			return nfs3ErrIO
+		}
+		return nfs3Ok
+	}
+}
+
+func (s *NfsServer) nfsCreate(req *rpcRequest, reply *xdrWriter) uint32 {
+	dir, p, name, status, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	how, err := req.Args.uint32()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	attr := &setAttributes{}
+	var verifier []byte
+	switch how {
+	case createUnchecked, createGuarded:
+		if attr, err = readSetAttributes(req.Args); err != nil {
+			return rpcGarbageArgs
+		}
+	case createExclusive:
+		if verifier, err = req.Args.fixedOpaque(8); err != nil {
+			return rpcGarbageArgs
+		}
+	default:
+		return rpcGarbageArgs
+	}
+
+	if status == nfs3Ok {
+		status = s.checkWritable(dir, name)
+	}
+	if status == nfs3Ok {
+		status = s.create(req, p, how, attr, verifier)
+	}
+
+	reply.uint32(status)
+	if status == nfs3Ok {
+		s.writeNewObject(reply, p)
+	}
+	s.writeWccData(reply, dir)
+	return rpcSuccess
+}
+
+func (s *NfsServer) create(req *rpcRequest, p util.FullPath, how uint32, attr *setAttributes, verifier []byte) uint32 {
+	s.invalidate(p)
+	existing, err := s.lookupEntry(p)
+	if err != nil && err != os.ErrNotExist {
+		return toNfsStatus(err)
+	}
+	if existing != nil {
+		switch {
+		case how == createGuarded:
+			return nfs3ErrExist
+		case how == createExclusive:
+			// a retransmitted exclusive create is still successful
+			if bytes.Equal(existing.Extended[extendedCreateVerifier], verifier) {
+				return nfs3Ok
+			}
+			return nfs3ErrExist
+		case existing.IsDirectory:
+			return nfs3ErrIsDir
+		}
+		return s.setAttributes(p, attr)
+	}
+
+	now := time.Now().Unix()
+	entry := &filer_pb.Entry{
+		Name: p.Name(),
+		Attributes: &filer_pb.FuseAttributes{
+			Mtime:       now,
+			Crtime:      now,
+			FileMode:    0644,
+			Uid:         req.Credential.Uid,
+			Gid:         req.Credential.Gid,
+			Collection:  s.option.Collection,
+			Replication: s.option.Replication,
+		},
+	}
+	applyNewAttributes(entry, attr)
+	if verifier != nil {
+		entry.Extended = map[string][]byte{extendedCreateVerifier: verifier}
+	}
+	return s.createEntry(p, entry)
+}
+
+func applyNewAttributes(entry *filer_pb.Entry, attr *setAttributes) {
+	if attr.mode != nil {
+		entry.Attributes.FileMode = uint32(os.FileMode(entry.Attributes.FileMode)&^os.ModePerm) | (*attr.mode & uint32(os.ModePerm))
+	}
+	if attr.uid != nil {
+		entry.Attributes.Uid = *attr.uid
+	}
+	if attr.gid != nil {
+		entry.Attributes.Gid = *attr.gid
+	}
+	if attr.mtimeHow == timeSetToClient {
+		entry.Attributes.Mtime = attr.mtime
+	}
+}
+
+func (s *NfsServer) createEntry(p util.FullPath, entry *filer_pb.Entry) uint32 {
+	dir, _ := p.DirAndName()
+	err := s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		})
+	})
+	s.invalidate(p)
+	if err != nil {
+		glog.Errorf("nfs create %s: %v", p, err)
+		return nfs3ErrIO
+	}
+	return nfs3Ok
+}
+
+func (s *NfsServer) nfsMkdir(req *rpcRequest, reply *xdrWriter) uint32 {
+	dir, p, name, status, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	attr, err := readSetAttributes(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+
+	if status == nfs3Ok {
+		status = s.checkWritable(dir, name)
+	}
+	if status == nfs3Ok {
+		s.invalidate(p)
+		if _, err = s.lookupEntry(p); err == nil {
+			status = nfs3ErrExist
+		} else if err != os.ErrNotExist {
+			status = toNfsStatus(err)
+		}
+	}
+	if status == nfs3Ok {
+		now := time.Now().Unix()
+		entry := &filer_pb.Entry{
+			Name:        name,
+			IsDirectory: true,
+			Attributes: &filer_pb.FuseAttributes{
+				Mtime:    now,
+				Crtime:   now,
+				FileMode: uint32(os.ModeDir | 0755),
+				Uid:      req.Credential.Uid,
+				Gid:      req.Credential.Gid,
+			},
+		}
+		applyNewAttributes(entry, attr)
+		status = s.createEntry(p, entry)
+	}
+
+	reply.uint32(status)
+	if status == nfs3Ok {
+		s.writeNewObject(reply, p)
+	}
+	s.writeWccData(reply, dir)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsSymlink(req *rpcRequest, reply *xdrWriter) uint32 {
+	dir, p, name, status, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	attr, err := readSetAttributes(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	target, err := req.Args.string()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+
+	if status == nfs3Ok {
+		status = s.checkWritable(dir, name)
+	}
+	if status == nfs3Ok {
+		s.invalidate(p)
+		if _, err = s.lookupEntry(p); err == nil {
+			status = nfs3ErrExist
+		} else if err != os.ErrNotExist {
+			status = toNfsStatus(err)
+		}
+	}
+	if status == nfs3Ok {
+		now := time.Now().Unix()
+		entry := &filer_pb.Entry{
+			Name: name,
+			Attributes: &filer_pb.FuseAttributes{
+				Mtime:         now,
+				Crtime:        now,
+				FileMode:      uint32(os.ModeSymlink | 0777),
+				Uid:           req.Credential.Uid,
+				Gid:           req.Credential.Gid,
+				SymlinkTarget: target,
+			},
+		}
+		applyNewAttributes(entry, attr)
+		status = s.createEntry(p, entry)
+	}
+
+	reply.uint32(status)
+	if status == nfs3Ok {
+		s.writeNewObject(reply, p)
+	}
+	s.writeWccData(reply, dir)
+	return rpcSuccess
+}
+
+// nfsNotSupportedOnDir rejects MKNOD, which only returns the directory wcc_data on failures
+func (s *NfsServer) nfsNotSupportedOnDir(req *rpcRequest, reply *xdrWriter) uint32 {
+	reply.uint32(nfs3ErrNotSupp)
+	reply.bool(false)
+	reply.bool(false)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsLink(req *rpcRequest, reply *xdrWriter) uint32 {
+	reply.uint32(nfs3ErrNotSupp)
+	reply.bool(false)
+	reply.bool(false)
+	reply.bool(false)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsRemove(req *rpcRequest, reply *xdrWriter) uint32 {
+	return s.remove(req, reply, false)
+}
+
+func (s *NfsServer) nfsRmdir(req *rpcRequest, reply *xdrWriter) uint32 {
+	return s.remove(req, reply, true)
+}
+
+func (s *NfsServer) remove(req *rpcRequest, reply *xdrWriter, isDirectory bool) uint32 {
+	dir, p, name, status, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if status == nfs3Ok {
+		status = s.checkWritable(dir, name)
+	}
+	var entry *filer_pb.Entry
+	if status == nfs3Ok {
+		s.invalidate(p)
+		entry, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	if status == nfs3Ok {
+		switch {
+		case isDirectory && !entry.IsDirectory:
+			status = nfs3ErrNotDir
+		case !isDirectory && entry.IsDirectory:
+			status = nfs3ErrIsDir
+		}
+	}
+	if status == nfs3Ok {
+		s.dropWriter(p)
+		err = filer_pb.Remove(s, string(dir), name, true, false, false, false)
+		s.invalidate(p)
+		if err != nil {
+			if strings.Contains(err.Error(), "non-empty") {
+				status = nfs3ErrNotEmpty
+			} else {
+				glog.Errorf("nfs remove %s: %v", p, err)
+				status = nfs3ErrIO
+			}
+		}
+	}
+	reply.uint32(status)
+	s.writeWccData(reply, dir)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsRename(req *rpcRequest, reply *xdrWriter) uint32 {
+	oldDir, oldPath, oldName, status, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	newDir, newPath, newName, newStatus, err := s.readDirTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if status == nfs3Ok {
+		status = newStatus
+	}
+	if status == nfs3Ok {
+		status = s.checkWritable(oldDir, oldName)
+	}
+	if status == nfs3Ok {
+		status = s.checkWritable(newDir, newName)
+	}
+	if status == nfs3Ok {
+		if err = s.closeWriter(oldPath); err != nil {
+			glog.Errorf("nfs rename %s: %v", oldPath, err)
+			status = nfs3ErrIO
+		}
+		s.dropWriter(newPath)
+	}
+	if status == nfs3Ok {
+		err = s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+			_, err := client.AtomicRenameEntry(context.Background(), &filer_pb.AtomicRenameEntryRequest{
+				OldDirectory: string(oldDir),
+				OldName:      oldName,
+				NewDirectory: string(newDir),
+				NewName:      newName,
+			})
+			return err
+		})
+		s.invalidate(oldPath)
+		s.invalidate(newPath)
+		if err != nil {
+			glog.Errorf("nfs rename %s => %s: %v", oldPath, newPath, err)
+			status = nfs3ErrIO
+		}
+	}
+	reply.uint32(status)
+	s.writeWccData(reply, oldDir)
+	s.writeWccData(reply, newDir)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsReadDir(req *rpcRequest, reply *xdrWriter) uint32 {
+	return s.readDir(req, reply, false)
+}
+
+func (s *NfsServer) nfsReadDirPlus(req *rpcRequest, reply *xdrWriter) uint32 {
+	return s.readDir(req, reply, true)
+}
+
+// readDir lists the directory as ".", "..", and the filer entries.
+// The cookie of each item is its position in the listing plus one.
+func (s *NfsServer) readDir(req *rpcRequest, reply *xdrWriter, plus bool) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	cookie, err := req.Args.uint64()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if _, err = req.Args.fixedOpaque(8); err != nil {
+		return rpcGarbageArgs
+	}
+	if plus {
+		// dircount, the maxcount is the limit of the whole reply
+		if _, err = req.Args.uint32(); err != nil {
+			return rpcGarbageArgs
+		}
+	}
+	maxCount, err := req.Args.uint32()
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if maxCount > nfsMaxTransfer {
+		maxCount = nfsMaxTransfer
+	}
+
+	var dirEntry *filer_pb.Entry
+	var entries []*filer_pb.Entry
+	if status == nfs3Ok {
+		dirEntry, err = s.lookupEntry(p)
+		status = toNfsStatus(err)
+	}
+	if status == nfs3Ok && !dirEntry.IsDirectory {
+		status = nfs3ErrNotDir
+	}
+	if status == nfs3Ok {
+		if cookie == 0 {
+			s.invalidate(p)
+		}
+		if entries, err = s.listEntries(p); err != nil {
+			glog.Errorf("nfs readdir %s: %v", p, err)
+			status = toNfsStatus(err)
+		}
+	}
+
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status != nfs3Ok {
+		return rpcSuccess
+	}
+	reply.fixedOpaque(make([]byte, 8))
+
+	parent := p
+	if p != s.exportPath {
+		dir, _ := p.DirAndName()
+		parent = util.FullPath(dir)
+	}
+	itemCount := uint64(len(entries)) + 2
+	list := &xdrWriter{}
+	// leave some room for the reply header and the directory attributes
+	limit := int(maxCount) - len(reply.Bytes()) - 128
+	eof := true
+	for i := cookie; i < itemCount; i++ {
+		var name string
+		var child util.FullPath
+		var entry *filer_pb.Entry
+		switch i {
+		case 0:
+			name, child = ".", p
+		case 1:
+			name, child = "..", parent
+		default:
+			entry = entries[i-2]
+			name, child = entry.Name, p.Child(entry.Name)
+		}
+		item := &xdrWriter{}
+		item.bool(true)
+		item.uint64(child.AsInode())
+		item.string(name)
+		item.uint64(i + 1)
+		if plus {
+			if entry == nil {
+				s.writePostOpAttributes(item, child)
+			} else {
+				item.bool(true)
+				s.writeAttributes(item, child, entry)
+			}
+			item.bool(true)
+			item.opaque(s.toHandle(child))
+		}
+		if len(list.buf)+len(item.buf) > limit {
+			eof = false
+			break
+		}
+		list.buf = append(list.buf, item.buf...)
+	}
+	if len(list.buf) == 0 && !eof {
+		reply.buf = reply.buf[:0]
+		reply.uint32(nfs3ErrTooSmall)
+		s.writePostOpAttributes(reply, p)
+		return rpcSuccess
+	}
+	reply.buf = append(reply.buf, list.buf...)
+	reply.bool(false)
+	reply.bool(eof)
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsFsStat(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	var stats *filer_pb.StatisticsResponse
+	if status == nfs3Ok {
+		err = s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+			stats, err = client.Statistics(context.Background(), &filer_pb.StatisticsRequest{
+				Collection:  s.option.Collection,
+				Replication: s.option.Replication,
+			})
+			return err
+		})
+		if err != nil {
+			glog.Errorf("nfs fsstat: %v", err)
+			status = nfs3ErrIO
+		}
+	}
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status == nfs3Ok {
+		free := uint64(0)
+		if stats.TotalSize > stats.UsedSize {
+			free = stats.TotalSize - stats.UsedSize
+		}
+		reply.uint64(stats.TotalSize)
+		reply.uint64(free)
+		reply.uint64(free)
+		// the filer does not limit the number of files
+		reply.uint64(stats.FileCount + 1<<30)
+		reply.uint64(1 << 30)
+		reply.uint64(1 << 30)
+		reply.uint32(0) // invarsec
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsFsInfo(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status == nfs3Ok {
+		reply.uint32(nfsMaxTransfer) // rtmax
+		reply.uint32(nfsMaxTransfer) // rtpref
+		reply.uint32(4096)           // rtmult
+		reply.uint32(nfsMaxTransfer) // wtmax
+		reply.uint32(nfsMaxTransfer) // wtpref
+		reply.uint32(4096)           // wtmult
+		reply.uint32(64 * 1024)      // dtpref
+		reply.uint64(1 << 62)        // maxfilesize
+		reply.uint32(1)              // time_delta
+		reply.uint32(0)
+		reply.uint32(0x08 | 0x10 | 0x02) // FSF3_HOMOGENEOUS | FSF3_CANSETTIME | FSF3_SYMLINK
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsPathConf(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	reply.uint32(status)
+	s.writePostOpAttributes(reply, p)
+	if status == nfs3Ok {
+		reply.uint32(1)                // linkmax
+		reply.uint32(nfsMaxNameLength) // name_max
+		reply.bool(true)               // no_trunc
+		reply.bool(true)               // chown_restricted
+		reply.bool(false)              // case_insensitive
+		reply.bool(true)               // case_preserving
+	}
+	return rpcSuccess
+}
+
+func (s *NfsServer) nfsCommit(req *rpcRequest, reply *xdrWriter) uint32 {
+	p, status, err := s.readTarget(req.Args)
+	if err != nil {
+		return rpcGarbageArgs
+	}
+	if _, err = req.Args.uint64(); err != nil {
+		return rpcGarbageArgs
+	}
+	if _, err = req.Args.uint32(); err != nil {
+		return rpcGarbageArgs
+	}
+	if status == nfs3Ok {
+		if err = s.flushWriter(p); err != nil {
+			glog.Errorf("nfs commit %s: %v", p, err)
+			status = nfs3ErrIO
+		}
+	}
+	reply.uint32(status)
+	s.writeWccData(reply, p)
+	if status == nfs3Ok {
+		reply.fixedOpaque(s.writeVerifier)
+	}
+	return rpcSuccess
+}
@@ -0,0 +1,242 @@
+package nfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+// ONC RPC version 2 over tcp with record marking, RFC 5531
+
+const (
+	rpcCall  = 0
+	rpcReply = 1
+
+	rpcMsgAccepted = 0
+
+	rpcSuccess      = 0
+	rpcProgUnavail  = 1
+	rpcProgMismatch = 2
+	rpcProcUnavail  = 3
+	rpcGarbageArgs  = 4
+	rpcSystemErr    = 5
+
+	authNone = 0
+	authSys  = 1
+
+	rpcMaxRecordSize = 16 * 1024 * 1024
+	rpcMaxInFlight   = 16
+)
+
+// rpcCredential is the AUTH_SYS credential of the caller, or zero for AUTH_NONE
+type rpcCredential struct {
+	Uid uint32
+	Gid uint32
+}
+
+type rpcRequest struct {
+	Xid        uint32
+	Program    uint32
+	Version    uint32
+	Procedure  uint32
+	Credential rpcCredential
+	Args       *xdrReader
+}
+
+// rpcProcedure writes the results into the reply and returns rpcSuccess,
+// or returns one of the other accept_stat of RFC 5531
+type rpcProcedure func(req *rpcRequest, reply *xdrWriter) uint32
+
+type rpcProgram struct {
+	Program    uint32
+	Version    uint32
+	Procedures map[uint32]rpcProcedure
+}
+
+type rpcServer struct {
+	programs map[uint32]*rpcProgram
+}
+
+func newRpcServer(programs ...*rpcProgram) *rpcServer {
+	s := &rpcServer{
+		programs: make(map[uint32]*rpcProgram),
+	}
+	for _, p := range programs {
+		s.programs[p.Program] = p
+	}
+	return s
+}
+
+func (s *rpcServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *rpcServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	glog.V(1).Infof("nfs client %s connected", conn.RemoteAddr())
+
+	// the clients send multiple requests without waiting for the replies
+	var writeLock sync.Mutex
+	inFlight := make(chan struct{}, rpcMaxInFlight)
+
+	reader := bufio.NewReaderSize(conn, 1024*1024)
+	for {
+		record, err := readRecord(reader)
+		if err != nil {
+			if err != io.EOF {
+				glog.V(0).Infof("nfs client %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		inFlight <- struct{}{}
+		go func() {
+			defer func() { <-inFlight }()
+			reply, err := s.handleRecord(record)
+			if err != nil {
+				glog.V(0).Infof("nfs client %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			if err = writeRecord(conn, reply); err != nil {
+				glog.V(1).Infof("nfs client %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+			}
+		}()
+	}
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	var record []byte
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(header[:])
+		size := int(h & 0x7fffffff)
+		if len(record)+size > rpcMaxRecordSize {
+			return nil, fmt.Errorf("rpc record larger than %d", rpcMaxRecordSize)
+		}
+		fragment := make([]byte, size)
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, err
+		}
+		record = append(record, fragment...)
+		if h&0x80000000 != 0 {
+			return record, nil
+		}
+	}
+}
+
+func writeRecord(w io.Writer, data []byte) error {
+	record := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data))|0x80000000)
+	copy(record[4:], data)
+	_, err := w.Write(record)
+	return err
+}
+
+func (s *rpcServer) handleRecord(record []byte) ([]byte, error) {
+	x := newXdrReader(bytes.NewReader(record))
+
+	req := &rpcRequest{Args: x}
+	var msgType, rpcVersion uint32
+	var err error
+	if req.Xid, err = x.uint32(); err != nil {
+		return nil, err
+	}
+	if msgType, err = x.uint32(); err != nil || msgType != rpcCall {
+		return nil, fmt.Errorf("expected rpc call, got message type %d: %v", msgType, err)
+	}
+	if rpcVersion, err = x.uint32(); err != nil || rpcVersion != 2 {
+		return nil, fmt.Errorf("unsupported rpc version %d: %v", rpcVersion, err)
+	}
+	if req.Program, err = x.uint32(); err != nil {
+		return nil, err
+	}
+	if req.Version, err = x.uint32(); err != nil {
+		return nil, err
+	}
+	if req.Procedure, err = x.uint32(); err != nil {
+		return nil, err
+	}
+	if req.Credential, err = readCredential(x); err != nil {
+		return nil, err
+	}
+	// verifier
+	if _, err = x.uint32(); err != nil {
+		return nil, err
+	}
+	if _, err = x.opaque(); err != nil {
+		return nil, err
+	}
+
+	results := &xdrWriter{}
+	status := uint32(rpcSuccess)
+	program, found := s.programs[req.Program]
+	var procedure rpcProcedure
+	switch {
+	case !found:
+		status = rpcProgUnavail
+	case program.Version != req.Version:
+		status = rpcProgMismatch
+		results.uint32(program.Version)
+		results.uint32(program.Version)
+	default:
+		if procedure, found = program.Procedures[req.Procedure]; !found {
+			status = rpcProcUnavail
+		}
+	}
+	if procedure != nil {
+		status = procedure(req, results)
+	}
+
+	reply := &xdrWriter{}
+	reply.uint32(req.Xid)
+	reply.uint32(rpcReply)
+	reply.uint32(rpcMsgAccepted)
+	reply.uint32(authNone)
+	reply.uint32(0)
+	reply.uint32(status)
+	if status == rpcSuccess || status == rpcProgMismatch {
+		reply.buf = append(reply.buf, results.Bytes()...)
+	}
+	return reply.Bytes(), nil
+}
+
+func readCredential(x *xdrReader) (cred rpcCredential, err error) {
+	flavor, err := x.uint32()
+	if err != nil {
+		return
+	}
+	body, err := x.opaque()
+	if err != nil || flavor != authSys {
+		return
+	}
+	b := newXdrReader(bytes.NewReader(body))
+	if _, err = b.uint32(); err != nil { // stamp
+		return
+	}
+	if _, err = b.string(); err != nil { // machine name
+		return
+	}
+	if cred.Uid, err = b.uint32(); err != nil {
+		return
+	}
+	cred.Gid, err = b.uint32()
+	return
+}
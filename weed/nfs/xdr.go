@@ -0,0 +1,106 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// minimal XDR encoding, RFC 4506
+
+var errXdrTooLarge = errors.New("xdr: item too large")
+
+const xdrMaxItemSize = 8 * 1024 * 1024
+
+type xdrReader struct {
+	r   io.Reader
+	buf [8]byte
+}
+
+func newXdrReader(r io.Reader) *xdrReader {
+	return &xdrReader{r: r}
+}
+
+func (x *xdrReader) uint32() (uint32, error) {
+	if _, err := io.ReadFull(x.r, x.buf[:4]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(x.buf[:4]), nil
+}
+
+func (x *xdrReader) uint64() (uint64, error) {
+	if _, err := io.ReadFull(x.r, x.buf[:8]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(x.buf[:8]), nil
+}
+
+func (x *xdrReader) bool() (bool, error) {
+	v, err := x.uint32()
+	return v != 0, err
+}
+
+func (x *xdrReader) fixedOpaque(n int) ([]byte, error) {
+	data := make([]byte, n+(4-n%4)%4)
+	if _, err := io.ReadFull(x.r, data); err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (x *xdrReader) opaque() ([]byte, error) {
+	n, err := x.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if n > xdrMaxItemSize {
+		return nil, errXdrTooLarge
+	}
+	return x.fixedOpaque(int(n))
+}
+
+func (x *xdrReader) string() (string, error) {
+	data, err := x.opaque()
+	return string(data), err
+}
+
+type xdrWriter struct {
+	buf []byte
+}
+
+func (x *xdrWriter) uint32(v uint32) {
+	x.buf = append(x.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (x *xdrWriter) uint64(v uint64) {
+	x.uint32(uint32(v >> 32))
+	x.uint32(uint32(v))
+}
+
+func (x *xdrWriter) bool(v bool) {
+	if v {
+		x.uint32(1)
+	} else {
+		x.uint32(0)
+	}
+}
+
+func (x *xdrWriter) fixedOpaque(data []byte) {
+	x.buf = append(x.buf, data...)
+	for i := len(data) % 4; i > 0 && i < 4; i++ {
+		x.buf = append(x.buf, 0)
+	}
+}
+
+func (x *xdrWriter) opaque(data []byte) {
+	x.uint32(uint32(len(data)))
+	x.fixedOpaque(data)
+}
+
+func (x *xdrWriter) string(s string) {
+	x.opaque([]byte(s))
+}
+
+func (x *xdrWriter) Bytes() []byte {
+	return x.buf
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
 )
 
 func WithVolumeServerClient(volumeServer string, grpcDialOption grpc.DialOption, fn func(volume_server_pb.VolumeServerClient) error) error {
@@ -21,10 +22,10 @@ func WithVolumeServerClient(volumeServer string, grpcDialOption grpc.DialOption,
 		return fmt.Errorf("failed to parse volume server %v: %v", volumeServer, err)
 	}
 
-	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+	return wdclient.WithVolumeServerGrpcClient(grpcAddress, grpcDialOption, func(grpcConnection *grpc.ClientConn) error {
 		client := volume_server_pb.NewVolumeServerClient(grpcConnection)
 		return fn(client)
-	}, grpcAddress, grpcDialOption)
+	})
 
 }
 
@@ -104,7 +104,7 @@ func LookupVolumeIds(server string, grpcDialOption grpc.DialOption, vids []strin
 		req := &master_pb.LookupVolumeRequest{
 			VolumeIds: unknown_vids,
 		}
-		resp, grpcErr := masterClient.LookupVolume(context.Background(), req)
+		resp, grpcErr := master_pb.LookupVolumes(context.Background(), masterClient, req)
 		if grpcErr != nil {
 			return grpcErr
 		}
@@ -118,7 +118,7 @@ func LookupVolumeIds(server string, grpcDialOption grpc.DialOption, vids []strin
 					PublicUrl: loc.PublicUrl,
 				})
 			}
-			if vidLocations.Error != "" {
+			if vidLocations.Error == "" {
 				vc.Set(vidLocations.VolumeId, locations, 10*time.Minute)
 			}
 			ret[vidLocations.VolumeId] = LookupResult{
@@ -1,6 +1,7 @@
 package operation
 
 import (
+	"context"
 	"io"
 	"mime"
 	"net/url"
@@ -50,7 +51,7 @@ func SubmitFiles(master string, grpcDialOption grpc.DialOption, files []FilePart
 		DataCenter:  dataCenter,
 		Ttl:         ttl,
 	}
-	ret, err := Assign(master, grpcDialOption, ar)
+	ret, err := Assign(context.Background(), master, grpcDialOption, ar)
 	if err != nil {
 		for index := range files {
 			results[index].Error = err.Error()
@@ -143,7 +144,7 @@ func (fi FilePart) Upload(maxMB int, master string, usePublicUrl bool, jwt secur
 				Collection:  fi.Collection,
 				Ttl:         fi.Ttl,
 			}
-			ret, err = Assign(master, grpcDialOption, ar)
+			ret, err = Assign(context.Background(), master, grpcDialOption, ar)
 			if err != nil {
 				return
 			}
@@ -156,7 +157,7 @@ func (fi FilePart) Upload(maxMB int, master string, usePublicUrl bool, jwt secur
 					Collection:  fi.Collection,
 					Ttl:         fi.Ttl,
 				}
-				ret, err = Assign(master, grpcDialOption, ar)
+				ret, err = Assign(context.Background(), master, grpcDialOption, ar)
 				if err != nil {
 					// delete all uploaded chunks
 					cm.DeleteChunks(master, usePublicUrl, grpcDialOption)
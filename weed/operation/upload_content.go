@@ -2,6 +2,7 @@ package operation
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/json"
 	"errors"
@@ -64,7 +65,12 @@ var fileNameEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
 
 // Upload sends a POST request to a volume server to upload the content with adjustable compression level
 func UploadData(uploadUrl string, filename string, cipher bool, data []byte, isInputCompressed bool, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (uploadResult *UploadResult, err error) {
-	uploadResult, err = doUploadData(uploadUrl, filename, cipher, data, isInputCompressed, mtype, pairMap, jwt)
+	return UploadDataWithContext(context.Background(), uploadUrl, filename, cipher, data, isInputCompressed, mtype, pairMap, jwt)
+}
+
+// UploadDataWithContext is UploadData, but the upload is canceled once the ctx is done
+func UploadDataWithContext(ctx context.Context, uploadUrl string, filename string, cipher bool, data []byte, isInputCompressed bool, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (uploadResult *UploadResult, err error) {
+	uploadResult, err = doUploadData(ctx, uploadUrl, filename, cipher, data, isInputCompressed, mtype, pairMap, jwt)
 	if uploadResult != nil {
 		uploadResult.Md5 = util.Md5(data)
 	}
@@ -88,11 +94,11 @@ func doUpload(uploadUrl string, filename string, cipher bool, reader io.Reader,
 		err = fmt.Errorf("read input: %v", err)
 		return
 	}
-	uploadResult, uploadErr := doUploadData(uploadUrl, filename, cipher, data, isInputCompressed, mtype, pairMap, jwt)
+	uploadResult, uploadErr := doUploadData(context.Background(), uploadUrl, filename, cipher, data, isInputCompressed, mtype, pairMap, jwt)
 	return uploadResult, uploadErr, data
 }
 
-func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, isInputCompressed bool, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (uploadResult *UploadResult, err error) {
+func doUploadData(ctx context.Context, uploadUrl string, filename string, cipher bool, data []byte, isInputCompressed bool, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (uploadResult *UploadResult, err error) {
 	contentIsGzipped := isInputCompressed
 	shouldGzipNow := false
 	if !isInputCompressed {
@@ -106,9 +112,7 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 		if shouldBeCompressed, iAmSure := util.IsCompressableFileType(filepath.Base(filename), mtype); iAmSure && shouldBeCompressed {
 			shouldGzipNow = true
 		} else if !iAmSure && mtype == "" && len(data) > 128 {
-			var compressed []byte
-			compressed, err = util.GzipData(data[0:128])
-			shouldGzipNow = len(compressed)*10 < 128*9 // can not compress to less than 90%
+			shouldGzipNow = util.IsCompressibleData(data)
 		}
 	}
 
@@ -144,7 +148,7 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 		}
 
 		// upload data
-		uploadResult, err = upload_content(uploadUrl, func(w io.Writer) (err error) {
+		uploadResult, err = upload_content(ctx, uploadUrl, func(w io.Writer) (err error) {
 			_, err = w.Write(encryptedData)
 			return
 		}, "", false, len(encryptedData), "", nil, jwt)
@@ -155,7 +159,7 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 		}
 	} else {
 		// upload data
-		uploadResult, err = upload_content(uploadUrl, func(w io.Writer) (err error) {
+		uploadResult, err = upload_content(ctx, uploadUrl, func(w io.Writer) (err error) {
 			_, err = w.Write(data)
 			return
 		}, filename, contentIsGzipped, 0, mtype, pairMap, jwt)
@@ -173,7 +177,7 @@ func doUploadData(uploadUrl string, filename string, cipher bool, data []byte, i
 	return uploadResult, err
 }
 
-func upload_content(uploadUrl string, fillBufferFunction func(w io.Writer) error, filename string, isGzipped bool, originalDataSize int, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (*UploadResult, error) {
+func upload_content(ctx context.Context, uploadUrl string, fillBufferFunction func(w io.Writer) error, filename string, isGzipped bool, originalDataSize int, mtype string, pairMap map[string]string, jwt security.EncodedJwt) (*UploadResult, error) {
 	body_buf := bytes.NewBufferString("")
 	body_writer := multipart.NewWriter(body_buf)
 	h := make(textproto.MIMEHeader)
@@ -208,6 +212,7 @@ func upload_content(uploadUrl string, fillBufferFunction func(w io.Writer) error
 		glog.V(1).Infof("failing to upload to %s: %v", uploadUrl, postErr)
 		return nil, fmt.Errorf("failing to upload to %s: %v", uploadUrl, postErr)
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", content_type)
 	for k, v := range pairMap {
 		req.Header.Set(k, v)
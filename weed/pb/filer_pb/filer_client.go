@@ -9,6 +9,9 @@ import (
 	"os"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
@@ -18,6 +21,9 @@ var (
 	OS_GID = uint32(os.Getgid())
 )
 
+// CompressedCall asks the filer to gzip its responses, for listings and batched lookups
+var CompressedCall = grpc.UseCompressor(gzip.Name)
+
 type FilerClient interface {
 	WithFilerClient(fn func(SeaweedFilerClient) error) error
 	AdjustedUrl(hostAndPort string) string
@@ -84,7 +90,7 @@ func doList(filerClient FilerClient, fullDirPath util.FullPath, prefix string, f
 
 		glog.V(3).Infof("read directory: %v", request)
 		ctx, cancel := context.WithCancel(context.Background())
-		stream, err := client.ListEntries(ctx, request)
+		stream, err := client.ListEntries(ctx, request, CompressedCall)
 		if err != nil {
 			return fmt.Errorf("list %s: %v", fullDirPath, err)
 		}
@@ -235,3 +241,83 @@ func Remove(filerClient FilerClient, parentDirectoryPath, name string, isDeleteD
 
 	})
 }
+
+// ReadFile streams the file content in the range to the writer, and a size of 0 means reading to the end of the file
+func ReadFile(filerClient FilerClient, fullFilePath util.FullPath, offset, size int64, w io.Writer) (entry *Entry, err error) {
+	dir, name := fullFilePath.DirAndName()
+	err = filerClient.WithFilerClient(func(client SeaweedFilerClient) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.ReadFile(ctx, &ReadFileRequest{
+			Directory: dir,
+			Name:      name,
+			Offset:    offset,
+			Size:      size,
+		})
+		if err != nil {
+			return err
+		}
+		for {
+			resp, recvErr := stream.Recv()
+			if recvErr == io.EOF {
+				return nil
+			}
+			if recvErr != nil {
+				return recvErr
+			}
+			if resp.Entry != nil {
+				entry = resp.Entry
+			}
+			if len(resp.Data) > 0 {
+				if _, err := w.Write(resp.Data); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %v", fullFilePath, err)
+	}
+	return entry, nil
+}
+
+// WriteFile streams the content of the reader to the filer, which splits it into chunks
+func WriteFile(filerClient FilerClient, init *WriteFileRequest_InitMessage, r io.Reader) (entry *Entry, err error) {
+	err = filerClient.WithFilerClient(func(client SeaweedFilerClient) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.WriteFile(ctx)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(&WriteFileRequest{Init: init}); err != nil {
+			return err
+		}
+		buf := make([]byte, 1024*1024)
+		for {
+			n, readErr := r.Read(buf)
+			if n > 0 {
+				if err = stream.Send(&WriteFileRequest{Data: buf[:n]}); err != nil {
+					break
+				}
+			}
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+		}
+		// the error of Send is only meaningful after receiving the response
+		resp, err := stream.CloseAndRecv()
+		if err != nil {
+			return err
+		}
+		entry = resp.Entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("write file %s/%s: %v", init.Directory, init.Name, err)
+	}
+	return entry, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -103,3 +104,13 @@ func LookupEntry(client SeaweedFilerClient, request *LookupDirectoryEntryRequest
 }
 
 var ErrNotFound = errors.New("filer: no entry is found in filer store")
+
+// UploadUrl is the url to upload the content of the assigned file id to the volume server at host,
+// with the write acknowledgment level of the collection
+func (resp *AssignVolumeResponse) UploadUrl(host string) string {
+	fileUrl := fmt.Sprintf("http://%s/%s", host, resp.FileId)
+	if resp.WriteAck != "" {
+		fileUrl += "?ack=" + url.QueryEscape(resp.WriteAck)
+	}
+	return fileUrl
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // the servers answer gzipped requests with gzipped responses
 	"google.golang.org/grpc/keepalive"
 
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
@@ -44,6 +45,8 @@ func NewGrpcServer(opts ...grpc.ServerOption) *grpc.Server {
 		}),
 		grpc.MaxRecvMsgSize(Max_Message_Size),
 		grpc.MaxSendMsgSize(Max_Message_Size),
+		grpc.UnaryInterceptor(requestIdUnaryServerInterceptor),
+		grpc.StreamInterceptor(requestIdStreamServerInterceptor),
 	)
 	for _, opt := range opts {
 		if opt != nil {
@@ -67,7 +70,10 @@ func GrpcDial(ctx context.Context, address string, opts ...grpc.DialOption) (*gr
 			Time:                30 * time.Second, // client ping server if no activity for this long
 			Timeout:             20 * time.Second,
 			PermitWithoutStream: false,
-		}))
+		}),
+		grpc.WithUnaryInterceptor(requestIdUnaryClientInterceptor),
+		grpc.WithStreamInterceptor(requestIdStreamClientInterceptor),
+	)
 	for _, opt := range opts {
 		if opt != nil {
 			options = append(options, opt)
@@ -0,0 +1,68 @@
+package pb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
+)
+
+// the request id is carried in the grpc metadata, and put into the context of the handlers
+
+func requestIdFromIncomingContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(request_id.MetadataKey); len(ids) > 0 && ids[0] != "" {
+			return request_id.Set(ctx, ids[0])
+		}
+	}
+	return request_id.Set(ctx, request_id.New())
+}
+
+func requestIdToOutgoingContext(ctx context.Context) context.Context {
+	id := request_id.Get(ctx)
+	if id == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(request_id.MetadataKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, request_id.MetadataKey, id)
+}
+
+func requestIdUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = requestIdFromIncomingContext(ctx)
+	resp, err := handler(ctx, req)
+	if err != nil {
+		glog.V(1).Infof("%s request %s: %v", info.FullMethod, request_id.Get(ctx), err)
+	}
+	return resp, err
+}
+
+type requestIdServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIdServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func requestIdStreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := requestIdFromIncomingContext(ss.Context())
+	err := handler(srv, &requestIdServerStream{ServerStream: ss, ctx: ctx})
+	if err != nil {
+		glog.V(1).Infof("%s request %s: %v", info.FullMethod, request_id.Get(ctx), err)
+	}
+	return err
+}
+
+func requestIdUnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(requestIdToOutgoingContext(ctx), method, req, reply, cc, opts...)
+}
+
+func requestIdStreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(requestIdToOutgoingContext(ctx), desc, cc, method, opts...)
+}
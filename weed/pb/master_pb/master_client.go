@@ -0,0 +1,108 @@
+package master_pb
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+)
+
+// CompressedCall asks the server to gzip its responses, for calls returning lots of metadata
+var CompressedCall = grpc.UseCompressor(gzip.Name)
+
+// isUnimplemented tells whether the server is older, without the streaming rpc
+func isUnimplemented(err error) bool {
+	return status.Code(err) == codes.Unimplemented
+}
+
+// ReadVolumeList receives the streamed volume list and merges the data nodes into one topology.
+// It falls back to the unary VolumeList for the masters without VolumeListStream.
+func ReadVolumeList(ctx context.Context, client SeaweedClient) (*VolumeListResponse, error) {
+	stream, err := client.VolumeListStream(ctx, &VolumeListRequest{}, CompressedCall)
+	if isUnimplemented(err) {
+		return client.VolumeList(ctx, &VolumeListRequest{}, CompressedCall)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *VolumeListResponse
+	dataCenters := make(map[string]*DataCenterInfo)
+	racks := make(map[string]*RackInfo)
+	for {
+		part, recvErr := stream.Recv()
+		if recvErr == io.EOF {
+			break
+		}
+		if resp == nil && isUnimplemented(recvErr) {
+			return client.VolumeList(ctx, &VolumeListRequest{}, CompressedCall)
+		}
+		if recvErr != nil {
+			return nil, recvErr
+		}
+		if resp == nil {
+			resp = &VolumeListResponse{}
+		}
+		if resp.TopologyInfo == nil {
+			resp.TopologyInfo = part.TopologyInfo
+			resp.VolumeSizeLimitMb = part.VolumeSizeLimitMb
+			continue
+		}
+		for _, dc := range part.TopologyInfo.GetDataCenterInfos() {
+			dataCenter, found := dataCenters[dc.Id]
+			if !found {
+				dataCenter = dc
+				dataCenters[dc.Id] = dc
+				resp.TopologyInfo.DataCenterInfos = append(resp.TopologyInfo.DataCenterInfos, dc)
+				for _, r := range dc.RackInfos {
+					racks[dc.Id+"/"+r.Id] = r
+				}
+				continue
+			}
+			for _, r := range dc.RackInfos {
+				rack, found := racks[dc.Id+"/"+r.Id]
+				if !found {
+					racks[dc.Id+"/"+r.Id] = r
+					dataCenter.RackInfos = append(dataCenter.RackInfos, r)
+					continue
+				}
+				rack.DataNodeInfos = append(rack.DataNodeInfos, r.DataNodeInfos...)
+			}
+		}
+	}
+	if resp == nil {
+		resp = &VolumeListResponse{}
+	}
+	return resp, nil
+}
+
+// LookupVolumes receives the streamed volume locations of the lookup.
+// It falls back to the unary LookupVolume for the masters without LookupVolumeStream.
+func LookupVolumes(ctx context.Context, client SeaweedClient, req *LookupVolumeRequest) (*LookupVolumeResponse, error) {
+	stream, err := client.LookupVolumeStream(ctx, req, CompressedCall)
+	if isUnimplemented(err) {
+		return client.LookupVolume(ctx, req, CompressedCall)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &LookupVolumeResponse{}
+	for received := false; ; received = true {
+		part, recvErr := stream.Recv()
+		if recvErr == io.EOF {
+			break
+		}
+		if !received && isUnimplemented(recvErr) {
+			return client.LookupVolume(ctx, req, CompressedCall)
+		}
+		if recvErr != nil {
+			return nil, recvErr
+		}
+		resp.VolumeIdLocations = append(resp.VolumeIdLocations, part.VolumeIdLocations...)
+	}
+	return resp, nil
+}
@@ -0,0 +1,45 @@
+package master_pb
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// unaryOnlyClient is a client of an older master, without the streaming rpcs
+type unaryOnlyClient struct {
+	SeaweedClient
+}
+
+func (c *unaryOnlyClient) VolumeListStream(ctx context.Context, in *VolumeListRequest, opts ...grpc.CallOption) (Seaweed_VolumeListStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "unknown method VolumeListStream")
+}
+
+func (c *unaryOnlyClient) VolumeList(ctx context.Context, in *VolumeListRequest, opts ...grpc.CallOption) (*VolumeListResponse, error) {
+	return &VolumeListResponse{VolumeSizeLimitMb: 30000}, nil
+}
+
+func (c *unaryOnlyClient) LookupVolumeStream(ctx context.Context, in *LookupVolumeRequest, opts ...grpc.CallOption) (Seaweed_LookupVolumeStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "unknown method LookupVolumeStream")
+}
+
+func (c *unaryOnlyClient) LookupVolume(ctx context.Context, in *LookupVolumeRequest, opts ...grpc.CallOption) (*LookupVolumeResponse, error) {
+	return &LookupVolumeResponse{VolumeIdLocations: []*LookupVolumeResponse_VolumeIdLocation{{VolumeId: in.VolumeIds[0]}}}, nil
+}
+
+func TestFallbackToUnary(t *testing.T) {
+	client := &unaryOnlyClient{}
+
+	volumeList, err := ReadVolumeList(context.Background(), client)
+	if err != nil || volumeList.VolumeSizeLimitMb != 30000 {
+		t.Errorf("read volume list from an older master: %v %v", volumeList, err)
+	}
+
+	lookup, err := LookupVolumes(context.Background(), client, &LookupVolumeRequest{VolumeIds: []string{"3"}})
+	if err != nil || len(lookup.VolumeIdLocations) != 1 || lookup.VolumeIdLocations[0].VolumeId != "3" {
+		t.Errorf("lookup volumes from an older master: %v %v", lookup, err)
+	}
+}
@@ -65,7 +65,7 @@ func (fs *FilerSink) fetchAndWrite(sourceChunk *filer_pb.FileChunk, dir string)
 	}
 	defer readCloser.Close()
 
-	var host string
+	var fileUrl string
 	var auth security.EncodedJwt
 
 	if err := fs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
@@ -88,15 +88,13 @@ func (fs *FilerSink) fetchAndWrite(sourceChunk *filer_pb.FileChunk, dir string)
 			return fmt.Errorf("assign volume failure %v: %v", request, resp.Error)
 		}
 
-		fileId, host, auth = resp.FileId, resp.Url, security.EncodedJwt(resp.Auth)
+		fileId, fileUrl, auth = resp.FileId, resp.UploadUrl(resp.Url), security.EncodedJwt(resp.Auth)
 
 		return nil
 	}); err != nil {
 		return "", fmt.Errorf("filerGrpcAddress assign volume: %v", err)
 	}
 
-	fileUrl := fmt.Sprintf("http://%s/%s", host, fileId)
-
 	glog.V(4).Infof("replicating %s to %s header:%+v", filename, fileUrl, header)
 
 	// fetch data as is, regardless whether it is encrypted or not
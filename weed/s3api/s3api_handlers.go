@@ -15,6 +15,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 type mimeType string
@@ -26,10 +27,18 @@ const (
 )
 
 func setCommonHeaders(w http.ResponseWriter) {
-	w.Header().Set("x-amz-request-id", fmt.Sprintf("%d", time.Now().UnixNano()))
+	w.Header().Set(request_id.AmzHeader, getRequestId(w))
 	w.Header().Set("Accept-Ranges", "bytes")
 }
 
+// getRequestId returns the request id set by the request_id middleware
+func getRequestId(w http.ResponseWriter) string {
+	if id := w.Header().Get(request_id.Header); id != "" {
+		return id
+	}
+	return fmt.Sprintf("%d", time.Now().UnixNano())
+}
+
 // Encodes the response headers into XML format.
 func encodeResponse(response interface{}) []byte {
 	var bytesBuffer bytes.Buffer
@@ -61,17 +70,17 @@ func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 
 func writeErrorResponse(w http.ResponseWriter, errorCode ErrorCode, reqURL *url.URL) {
 	apiError := getAPIError(errorCode)
-	errorResponse := getRESTErrorResponse(apiError, reqURL.Path)
+	errorResponse := getRESTErrorResponse(apiError, reqURL.Path, getRequestId(w))
 	encodedErrorResponse := encodeResponse(errorResponse)
 	writeResponse(w, apiError.HTTPStatusCode, encodedErrorResponse, mimeXML)
 }
 
-func getRESTErrorResponse(err APIError, resource string) RESTErrorResponse {
+func getRESTErrorResponse(err APIError, resource string, requestId string) RESTErrorResponse {
 	return RESTErrorResponse{
 		Code:      err.Code,
 		Message:   err.Description,
 		Resource:  resource,
-		RequestID: fmt.Sprintf("%d", time.Now().UnixNano()),
+		RequestID: requestId,
 	}
 }
 
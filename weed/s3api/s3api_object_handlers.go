@@ -180,7 +180,7 @@ func (s3a *S3ApiServer) DeleteMultipleObjectsHandler(w http.ResponseWriter, r *h
 			}
 			parentDirectoryPath = fmt.Sprintf("%s/%s%s", s3a.option.BucketsPath, bucket, parentDirectoryPath)
 
-			err := doDeleteEntry(client, parentDirectoryPath, entryName, isDeleteData, isRecursive)
+			err := doDeleteEntry(r.Context(), client, parentDirectoryPath, entryName, isDeleteData, isRecursive)
 			if err == nil {
 				deletedObjects = append(deletedObjects, object)
 			} else {
@@ -0,0 +1,102 @@
+package users
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is one virtual user of the ftp and sftp gateways, which is mapped to a home directory on the filer.
+// The home directory is the root directory of the user.
+type User struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password,omitempty"`   // bcrypt hash, or plain text
+	PublicKeys []string `json:"publicKeys,omitempty"` // authorized keys for sftp
+	HomeDir    string   `json:"homeDir"`
+	Uid        uint32   `json:"uid"`
+	Gid        uint32   `json:"gid"`
+	ReadOnly   bool     `json:"readOnly,omitempty"`
+	QuotaMB    int64    `json:"quotaMB,omitempty"` // 0 means no quota, only enforced by ftp
+}
+
+type UserStore struct {
+	Users []*User `json:"users"`
+	users map[string]*User
+}
+
+// LoadUserStore reads the users from a json file, e.g.
+//
+//	{
+//	  "users": [
+//	    {
+//	      "username": "partner1",
+//	      "password": "$2a$10$...",
+//	      "publicKeys": ["ssh-ed25519 AAAA... partner1@example.com"],
+//	      "homeDir": "/partners/partner1",
+//	      "uid": 1001,
+//	      "gid": 1001,
+//	      "quotaMB": 10240
+//	    }
+//	  ]
+//	}
+func LoadUserStore(fileName string) (*UserStore, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %v", fileName, err)
+	}
+	return ParseUserStore(data)
+}
+
+func ParseUserStore(data []byte) (*UserStore, error) {
+	store := &UserStore{}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("parse users: %v", err)
+	}
+	store.users = make(map[string]*User)
+	for _, user := range store.Users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("user without username")
+		}
+		if _, found := store.users[user.Username]; found {
+			return nil, fmt.Errorf("duplicated user %s", user.Username)
+		}
+		if user.HomeDir == "" || !strings.HasPrefix(user.HomeDir, "/") {
+			return nil, fmt.Errorf("user %s: homeDir should be an absolute path", user.Username)
+		}
+		user.HomeDir = path.Clean(user.HomeDir)
+		store.users[user.Username] = user
+	}
+	return store, nil
+}
+
+func (store *UserStore) GetUser(username string) (*User, bool) {
+	user, found := store.users[username]
+	return user, found
+}
+
+func (store *UserStore) CheckPassword(username string, password string) (*User, error) {
+	user, found := store.users[username]
+	if !found || user.Password == "" {
+		return nil, fmt.Errorf("password rejected for %s", username)
+	}
+	if strings.HasPrefix(user.Password, "$2") {
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+			return nil, fmt.Errorf("password rejected for %s", username)
+		}
+		return user, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return nil, fmt.Errorf("password rejected for %s", username)
+	}
+	return user, nil
+}
+
+// ToFilerPath maps the path seen by the user to the path on the filer, and the user can not go above the home dir
+func (user *User) ToFilerPath(p string) string {
+	return path.Join(user.HomeDir, path.Clean("/"+p))
+}
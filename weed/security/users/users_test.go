@@ -0,0 +1,54 @@
+package users
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserStore(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	store, err := ParseUserStore([]byte(`{"users":[
+		{"username":"plain","password":"pass","homeDir":"/home/plain/","quotaMB":10},
+		{"username":"hashed","password":"` + string(hash) + `","homeDir":"/home/hashed"}
+	]}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if _, err := store.CheckPassword("plain", "pass"); err != nil {
+		t.Errorf("plain password: %v", err)
+	}
+	if _, err := store.CheckPassword("hashed", "secret"); err != nil {
+		t.Errorf("hashed password: %v", err)
+	}
+	if _, err := store.CheckPassword("hashed", "pass"); err == nil {
+		t.Errorf("wrong password accepted")
+	}
+	if _, err := store.CheckPassword("unknown", "pass"); err == nil {
+		t.Errorf("unknown user accepted")
+	}
+
+	user, _ := store.GetUser("plain")
+	if user.QuotaMB != 10 {
+		t.Errorf("quota %d, expected 10", user.QuotaMB)
+	}
+	for input, expected := range map[string]string{
+		"/":             "/home/plain",
+		"a/b.txt":       "/home/plain/a/b.txt",
+		"/../../etc":    "/home/plain/etc",
+		"/a/../../b":    "/home/plain/b",
+		"/a/./b/../c/d": "/home/plain/a/c/d",
+	} {
+		if actual := user.ToFilerPath(input); actual != expected {
+			t.Errorf("%s: %s, expected %s", input, actual, expected)
+		}
+	}
+
+	if _, err := ParseUserStore([]byte(`{"users":[{"username":"a","homeDir":"relative"}]}`)); err == nil {
+		t.Errorf("relative home dir accepted")
+	}
+	if _, err := ParseUserStore([]byte(`{"users":[{"username":"a","homeDir":"/a"},{"username":"a","homeDir":"/b"}]}`)); err == nil {
+		t.Errorf("duplicated user accepted")
+	}
+}
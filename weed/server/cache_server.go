@@ -0,0 +1,242 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/buraksezer/consistent"
+	"github.com/cespare/xxhash"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+	"github.com/chrislusf/seaweedfs/weed/wdclient"
+)
+
+type CacheServerOption struct {
+	Masters            []string
+	Filer              string   // optional, to invalidate the chunks of the deleted or updated files
+	Self               string   // ip:port of this cache node
+	Peers              []string // ip:port of all the cache nodes
+	CacheDir           string
+	MemoryCacheEntries int64
+	CacheSizeMB        int64
+	MaxObjectSizeBytes int64
+	GrpcDialOption     grpc.DialOption
+}
+
+// CacheServer is a read-through cache in front of the volume servers.
+// Each file id is cached on the cache node picked by consistent hashing, so the cache nodes
+// share the hot objects without duplicating them. The other cache nodes forward the reads to it.
+type CacheServer struct {
+	option       *CacheServerOption
+	masterClient *wdclient.MasterClient
+	chunkCache   *chunk_cache.ChunkCache
+	peers        *consistent.Consistent
+	guard        *security.Guard
+	lookupFileId func(fileId string) (fileUrl string, err error)
+	volumeClient operation.HTTPClient
+	peerClient   *http.Client
+	filerTsNs    int64 // the time of the last filer change processed
+}
+
+func NewCacheServer(mux *http.ServeMux, option *CacheServerOption, whiteList []string) *CacheServer {
+	cs := &CacheServer{
+		option:       option,
+		chunkCache:   chunk_cache.NewChunkCache(option.MemoryCacheEntries, option.CacheDir, option.CacheSizeMB),
+		peers:        newCachePeers(option.Self, option.Peers),
+		guard:        security.NewGuard(whiteList, "", 0, "", 0),
+		volumeClient: operation.HttpClient,
+		peerClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+	cs.masterClient = wdclient.NewMasterClient(option.GrpcDialOption, "cache", option.Self, 0, option.Masters)
+	cs.lookupFileId = func(fileId string) (string, error) {
+		fileUrls, err := cs.masterClient.LookupFileIds([]string{fileId})
+		if err != nil {
+			return "", err
+		}
+		return fileUrls[fileId], nil
+	}
+	go cs.masterClient.KeepConnectedToMaster()
+
+	if option.Filer != "" {
+		cs.filerTsNs = cs.loadFilerOffset()
+		go cs.subscribeFilerChanges()
+	}
+
+	mux.HandleFunc("/status", cs.statusHandler)
+	mux.HandleFunc("/", cs.cacheHandler)
+	return cs
+}
+
+func (cs *CacheServer) Shutdown() {
+	if cs.option.Filer != "" {
+		cs.saveFilerOffset(atomic.LoadInt64(&cs.filerTsNs))
+	}
+	cs.chunkCache.Shutdown()
+}
+
+type cachePeer string
+
+func (p cachePeer) String() string {
+	return string(p)
+}
+
+type cachePeerHasher struct{}
+
+func (h cachePeerHasher) Sum64(data []byte) uint64 {
+	return xxhash.Sum64(data)
+}
+
+func newCachePeers(self string, peers []string) *consistent.Consistent {
+	var members []consistent.Member
+	hasSelf := false
+	for _, peer := range peers {
+		members = append(members, cachePeer(peer))
+		hasSelf = hasSelf || peer == self
+	}
+	if !hasSelf {
+		members = append(members, cachePeer(self))
+	}
+	return consistent.New(members, consistent.Config{
+		PartitionCount:    271,
+		ReplicationFactor: 20,
+		Load:              1.25,
+		Hasher:            cachePeerHasher{},
+	})
+}
+
+// owner is the cache node of the file id
+func (cs *CacheServer) owner(fileId string) string {
+	return cs.peers.LocateKey([]byte(fileId)).String()
+}
+
+// the time of the last filer change processed is saved with the disk cache,
+// so the changes during a restart still invalidate the chunks cached on disk
+const (
+	cacheFilerOffsetFile         = "filer.offset"
+	cacheFilerOffsetSaveInterval = 3 * time.Second
+)
+
+func (cs *CacheServer) filerOffsetFile() string {
+	if cs.option.CacheDir == "" || cs.option.CacheSizeMB <= 0 {
+		return ""
+	}
+	return filepath.Join(cs.option.CacheDir, cacheFilerOffsetFile)
+}
+
+// loadFilerOffset returns the saved time of the last filer change processed,
+// or now if nothing is cached on disk, or the time is not saved
+func (cs *CacheServer) loadFilerOffset() int64 {
+	if fileName := cs.filerOffsetFile(); fileName != "" {
+		data, err := ioutil.ReadFile(fileName)
+		if err == nil {
+			if tsNs, parseErr := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); parseErr == nil {
+				glog.V(0).Infof("invalidate the cache by the filer changes since %v", time.Unix(0, tsNs))
+				return tsNs
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			glog.Warningf("read %s: %v", fileName, err)
+		}
+	}
+	return time.Now().UnixNano()
+}
+
+func (cs *CacheServer) saveFilerOffset(tsNs int64) {
+	fileName := cs.filerOffsetFile()
+	if fileName == "" {
+		return
+	}
+	tmpName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpName, []byte(strconv.FormatInt(tsNs, 10)), 0644); err != nil {
+		glog.Warningf("save %s: %v", tmpName, err)
+		return
+	}
+	if err := os.Rename(tmpName, fileName); err != nil {
+		glog.Warningf("save %s: %v", fileName, err)
+	}
+}
+
+// subscribeFilerChanges invalidates the chunks no longer used by the deleted or updated files
+func (cs *CacheServer) subscribeFilerChanges() {
+	lastTsNs := atomic.LoadInt64(&cs.filerTsNs)
+	lastSaved := time.Now()
+	for {
+		err := pb.WithFilerClient(cs.option.Filer, cs.option.GrpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+			stream, err := client.SubscribeMetadata(context.Background(), &filer_pb.SubscribeMetadataRequest{
+				ClientName: "cache",
+				PathPrefix: "/",
+				SinceNs:    lastTsNs,
+			})
+			if err != nil {
+				return fmt.Errorf("subscribe: %v", err)
+			}
+
+			for {
+				resp, listenErr := stream.Recv()
+				if listenErr == io.EOF {
+					return nil
+				}
+				if listenErr != nil {
+					return listenErr
+				}
+				for _, fileId := range removedFileIds(cs.lookupFileId, resp.EventNotification) {
+					glog.V(3).Infof("invalidate %s of %s/%s", fileId, resp.Directory, resp.EventNotification.OldEntry.Name)
+					cs.chunkCache.DeleteChunk(fileId)
+				}
+				lastTsNs = resp.TsNs
+				atomic.StoreInt64(&cs.filerTsNs, lastTsNs)
+				if time.Since(lastSaved) > cacheFilerOffsetSaveInterval {
+					cs.saveFilerOffset(lastTsNs)
+					lastSaved = time.Now()
+				}
+			}
+		})
+		if err != nil {
+			glog.Errorf("subscribing filer %s meta change: %v", cs.option.Filer, err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// removedFileIds returns the chunks of the old entry which are not in the new entry
+func removedFileIds(lookupFileId filer2.LookupFileIdFunctionType, message *filer_pb.EventNotification) (fileIds []string) {
+	if message.OldEntry == nil {
+		return nil
+	}
+	keptFileIds := make(map[string]bool)
+	if message.NewEntry != nil {
+		for _, chunk := range message.NewEntry.Chunks {
+			keptFileIds[chunk.GetFileIdString()] = true
+		}
+	}
+	chunks := message.OldEntry.Chunks
+	if filer2.HasChunkManifest(chunks) {
+		// the manifest chunks may be deleted already, then only the manifest chunks are invalidated
+		dataChunks, manifestChunks, err := filer2.ResolveChunkManifest(lookupFileId, chunks)
+		if err == nil {
+			chunks = append(dataChunks, manifestChunks...)
+		}
+	}
+	for _, chunk := range chunks {
+		if fileId := chunk.GetFileIdString(); !keptFileIds[fileId] {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	return
+}
@@ -0,0 +1,281 @@
+package weed_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// cacheForwardedHeader marks the requests from another cache node, which are not forwarded again
+const cacheForwardedHeader = "Seaweed-Cache-Forwarded"
+
+// cachedHeaders are the volume server response headers kept with the cached content
+var cachedHeaders = []string{"Content-Type", "Content-Disposition", "Etag", "Last-Modified"}
+
+// cachedObject is a volume server response kept in the chunk cache,
+// stored as the size of the json encoded headers, the headers, and the content
+type cachedObject struct {
+	FileId string            `json:"fileId"`
+	Header map[string]string `json:"header"`
+	data   []byte
+}
+
+func newCachedObject(fileId string, header http.Header, data []byte) *cachedObject {
+	o := &cachedObject{FileId: fileId, Header: make(map[string]string), data: data}
+	for name, values := range header {
+		if strings.HasPrefix(name, "Seaweed-") && name != cacheForwardedHeader {
+			o.Header[name] = values[0]
+		}
+	}
+	for _, name := range cachedHeaders {
+		if value := header.Get(name); value != "" {
+			o.Header[name] = value
+		}
+	}
+	return o
+}
+
+func (o *cachedObject) toBytes() []byte {
+	header, _ := json.Marshal(o)
+	b := make([]byte, 4, 4+len(header)+len(o.data))
+	util.Uint32toBytes(b, uint32(len(header)))
+	b = append(b, header...)
+	return append(b, o.data...)
+}
+
+func cachedObjectFromBytes(b []byte) (*cachedObject, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("cached object of %d bytes", len(b))
+	}
+	headerSize := int(util.BytesToUint32(b[0:4]))
+	if len(b) < 4+headerSize {
+		return nil, fmt.Errorf("cached object of %d bytes with %d bytes header", len(b), headerSize)
+	}
+	o := &cachedObject{}
+	if err := json.Unmarshal(b[4:4+headerSize], o); err != nil {
+		return nil, err
+	}
+	o.data = b[4+headerSize:]
+	return o, nil
+}
+
+// serve supports the range and conditional requests as the volume server does
+func (o *cachedObject) serve(w http.ResponseWriter, r *http.Request) {
+	for name, value := range o.Header {
+		w.Header().Set(name, value)
+	}
+	modTime, _ := time.Parse(http.TimeFormat, o.Header["Last-Modified"])
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(o.data))
+}
+
+func (cs *CacheServer) cacheHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		cs.readHandler(w, r)
+	case "DELETE":
+		cs.guard.WhiteList(cs.deleteHandler)(w, r)
+	default:
+		writeJsonError(w, r, http.StatusMethodNotAllowed, fmt.Errorf("the cache only serves reads and deletes"))
+	}
+}
+
+func (cs *CacheServer) statusHandler(w http.ResponseWriter, r *http.Request) {
+	m := make(map[string]interface{})
+	m["Version"] = util.Version()
+	var peers []string
+	for _, peer := range cs.peers.GetMembers() {
+		peers = append(peers, peer.String())
+	}
+	m["Self"] = cs.option.Self
+	m["Peers"] = peers
+	writeJsonQuiet(w, r, http.StatusOK, m)
+}
+
+func fileIdFromPath(path string) (string, error) {
+	vid, fid, _, _, isVolumeIdOnly := parseURLPath(path)
+	if isVolumeIdOnly {
+		return "", fmt.Errorf("no file id in %s", path)
+	}
+	fileId := vid + "," + fid
+	if _, err := needle.ParseFileIdFromString(fileId); err != nil {
+		return "", err
+	}
+	return fileId, nil
+}
+
+func (cs *CacheServer) readHandler(w http.ResponseWriter, r *http.Request) {
+	fileId, err := fileIdFromPath(r.URL.Path)
+	if err != nil {
+		writeJsonError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// the resized images, the deleted files and the signed reads are not cached
+	if r.URL.RawQuery != "" || r.Header.Get("Authorization") != "" {
+		cs.proxyToVolumeServer(w, r, fileId)
+		return
+	}
+
+	if owner := cs.owner(fileId); owner != cs.option.Self && r.Header.Get(cacheForwardedHeader) == "" {
+		err := cs.proxy(w, r, cs.peerClient, "http://"+owner+r.URL.Path)
+		if err == nil {
+			return
+		}
+		glog.V(1).Infof("forward %s to cache node %s: %v", fileId, owner, err)
+	}
+
+	if data := cs.chunkCache.GetChunk(fileId, 1); data != nil {
+		// the disk cache is keyed by the needle id only, so the cookie is checked here
+		if o, err := cachedObjectFromBytes(data); err == nil && o.FileId == fileId {
+			w.Header().Set("X-Cache", "HIT")
+			o.serve(w, r)
+			return
+		}
+	}
+
+	fileUrl, err := cs.lookupFileId(fileId)
+	if err != nil {
+		writeJsonError(w, r, http.StatusNotFound, err)
+		return
+	}
+	req, _ := http.NewRequest("GET", fileUrl, nil)
+	resp, err := cs.volumeClient.Do(req)
+	if err != nil {
+		writeJsonError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		copyResponse(w, resp)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, cs.option.MaxObjectSizeBytes+1))
+	if err != nil {
+		writeJsonError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	if int64(len(data)) > cs.option.MaxObjectSizeBytes {
+		// too large to cache, and the client may only want a range of it
+		resp.Body.Close()
+		cs.proxyToVolumeServer(w, r, fileId)
+		return
+	}
+
+	o := newCachedObject(fileId, resp.Header, data)
+	cs.chunkCache.SetChunk(fileId, o.toBytes())
+	w.Header().Set("X-Cache", "MISS")
+	o.serve(w, r)
+}
+
+func (cs *CacheServer) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	fileId, err := fileIdFromPath(r.URL.Path)
+	if err != nil {
+		writeJsonError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if r.Header.Get(cacheForwardedHeader) != "" {
+		// another cache node has deleted the file
+		cs.chunkCache.DeleteChunk(fileId)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	fileUrl, err := cs.lookupFileId(fileId)
+	if err != nil {
+		writeJsonError(w, r, http.StatusNotFound, err)
+		return
+	}
+	resp, err := cs.forward(r, cs.volumeClient, fileUrl)
+	if err != nil {
+		writeJsonError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// invalidate after the file is deleted, so a concurrent read does not cache it again
+	cs.chunkCache.DeleteChunk(fileId)
+	cs.invalidatePeers(fileId)
+
+	copyResponse(w, resp)
+}
+
+// invalidatePeers deletes the file id from all the other cache nodes,
+// since a node may cache a file it does not own when the owner is unreachable
+func (cs *CacheServer) invalidatePeers(fileId string) {
+	var wg sync.WaitGroup
+	for _, peer := range cs.peers.GetMembers() {
+		if peer.String() == cs.option.Self {
+			continue
+		}
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			req, _ := http.NewRequest("DELETE", "http://"+peer+"/"+fileId, nil)
+			req.Header.Set(cacheForwardedHeader, cs.option.Self)
+			resp, err := cs.peerClient.Do(req)
+			if err != nil {
+				glog.V(0).Infof("invalidate %s on cache node %s: %v", fileId, peer, err)
+				return
+			}
+			util.CloseResponse(resp)
+		}(peer.String())
+	}
+	wg.Wait()
+}
+
+func (cs *CacheServer) proxyToVolumeServer(w http.ResponseWriter, r *http.Request, fileId string) {
+	fileUrl, err := cs.lookupFileId(fileId)
+	if err != nil {
+		writeJsonError(w, r, http.StatusNotFound, err)
+		return
+	}
+	if r.URL.RawQuery != "" {
+		fileUrl += "?" + r.URL.RawQuery
+	}
+	if err = cs.proxy(w, r, cs.volumeClient, fileUrl); err != nil {
+		writeJsonError(w, r, http.StatusBadGateway, err)
+	}
+}
+
+func (cs *CacheServer) proxy(w http.ResponseWriter, r *http.Request, client operation.HTTPClient, targetUrl string) error {
+	resp, err := cs.forward(r, client, targetUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	copyResponse(w, resp)
+	return nil
+}
+
+// forward sends the request with its headers to the target, marked as forwarded by this cache node
+func (cs *CacheServer) forward(r *http.Request, client operation.HTTPClient, targetUrl string) (*http.Response, error) {
+	req, err := http.NewRequest(r.Method, targetUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set(cacheForwardedHeader, cs.option.Self)
+	return client.Do(req)
+}
+
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,157 @@
+package weed_server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+func TestCacheServerReadThrough(t *testing.T) {
+
+	tmpDir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(tmpDir)
+
+	var volumeReads int32
+	content := "hello cache"
+	volumeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			content = ""
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		atomic.AddInt32(&volumeReads, 1)
+		if content == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Etag", `"abc"`)
+		w.Write([]byte(content))
+	}))
+	defer volumeServer.Close()
+
+	cs := &CacheServer{
+		option:       &CacheServerOption{Self: "localhost:8070", MaxObjectSizeBytes: 1024},
+		chunkCache:   chunk_cache.NewChunkCache(100, tmpDir, 32),
+		peers:        newCachePeers("localhost:8070", nil),
+		guard:        security.NewGuard(nil, "", 0, "", 0),
+		volumeClient: http.DefaultClient,
+		peerClient:   http.DefaultClient,
+	}
+	defer cs.Shutdown()
+	cs.lookupFileId = func(fileId string) (string, error) {
+		return volumeServer.URL + "/" + fileId, nil
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cs.cacheHandler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	for i, expected := range []string{"MISS", "HIT"} {
+		w := get("/3,01637037d6")
+		if w.Code != http.StatusOK || w.Body.String() != content || w.Header().Get("X-Cache") != expected {
+			t.Errorf("read %d: %d %q %s", i, w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+		}
+		if w.Header().Get("Content-Type") != "text/plain" || w.Header().Get("Etag") != `"abc"` {
+			t.Errorf("read %d headers: %v", i, w.Header())
+		}
+	}
+	if volumeReads != 1 {
+		t.Errorf("%d reads from the volume server, expected 1", volumeReads)
+	}
+
+	// the cached content is not served for another cookie of the same needle
+	if w := get("/3,01637037d7"); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("read with another cookie: %s", w.Header().Get("X-Cache"))
+	}
+
+	// the reads with query parameters bypass the cache
+	if w := get("/3,01637037d6?width=10"); w.Header().Get("X-Cache") != "" || volumeReads != 3 {
+		t.Errorf("read with query: %s after %d reads", w.Header().Get("X-Cache"), volumeReads)
+	}
+
+	w := httptest.NewRecorder()
+	cs.cacheHandler(w, httptest.NewRequest("DELETE", "/3,01637037d6", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("delete: %d", w.Code)
+	}
+	if w := get("/3,01637037d6"); w.Code != http.StatusNotFound {
+		t.Errorf("read after delete: %d %q", w.Code, w.Body.String())
+	}
+
+	// too large to cache
+	content = strings.Repeat("x", 2048)
+	for i := 0; i < 2; i++ {
+		if w := get("/4,01637037d6"); w.Body.String() != content || w.Header().Get("X-Cache") != "" {
+			t.Errorf("read large object %d: %d bytes %s", i, w.Body.Len(), w.Header().Get("X-Cache"))
+		}
+	}
+
+	w = httptest.NewRecorder()
+	cs.cacheHandler(w, httptest.NewRequest("POST", "/3,01637037d6", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("write to the cache: %d", w.Code)
+	}
+
+}
+
+func TestCacheOwner(t *testing.T) {
+	peers := []string{"a:8070", "b:8070", "c:8070"}
+	owners := make(map[string]int)
+	for _, self := range peers {
+		cs := &CacheServer{option: &CacheServerOption{Self: self}, peers: newCachePeers(self, peers)}
+		owners[cs.owner("3,01637037d6")]++
+	}
+	if len(owners) != 1 {
+		t.Errorf("cache nodes disagree on the owner: %v", owners)
+	}
+}
+
+func TestRemovedFileIds(t *testing.T) {
+	message := &filer_pb.EventNotification{
+		OldEntry: &filer_pb.Entry{Chunks: []*filer_pb.FileChunk{{FileId: "3,01"}, {FileId: "3,02"}}},
+		NewEntry: &filer_pb.Entry{Chunks: []*filer_pb.FileChunk{{FileId: "3,02"}, {FileId: "3,03"}}},
+	}
+	if fileIds := removedFileIds(nil, message); len(fileIds) != 1 || fileIds[0] != "3,01" {
+		t.Errorf("removed file ids of an update: %v", fileIds)
+	}
+	message.NewEntry = nil
+	if fileIds := removedFileIds(nil, message); len(fileIds) != 2 {
+		t.Errorf("removed file ids of a delete: %v", fileIds)
+	}
+	if fileIds := removedFileIds(nil, &filer_pb.EventNotification{NewEntry: message.OldEntry}); len(fileIds) != 0 {
+		t.Errorf("removed file ids of a create: %v", fileIds)
+	}
+}
+
+func TestFilerOffset(t *testing.T) {
+
+	tmpDir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(tmpDir)
+
+	cs := &CacheServer{option: &CacheServerOption{CacheDir: tmpDir, CacheSizeMB: 10}}
+	if tsNs := cs.loadFilerOffset(); tsNs < time.Now().Add(-time.Minute).UnixNano() {
+		t.Errorf("offset without a saved one: %v", time.Unix(0, tsNs))
+	}
+	cs.saveFilerOffset(12345)
+	if tsNs := cs.loadFilerOffset(); tsNs != 12345 {
+		t.Errorf("saved offset 12345, loaded %d", tsNs)
+	}
+
+	// nothing survives a restart if nothing is cached on disk
+	cs.option.CacheSizeMB = 0
+	if tsNs := cs.loadFilerOffset(); tsNs == 12345 {
+		t.Errorf("loaded the saved offset without the disk cache")
+	}
+}
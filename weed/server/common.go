@@ -19,6 +19,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 
 	"github.com/gorilla/mux"
 	statik "github.com/rakyll/statik/fs"
@@ -48,8 +49,8 @@ func writeJson(w http.ResponseWriter, r *http.Request, httpStatus int, obj inter
 	}
 
 	if httpStatus >= 400 {
-		glog.V(0).Infof("response method:%s URL:%s with httpStatus:%d and JSON:%s",
-			r.Method, r.URL.String(), httpStatus, string(bytes))
+		glog.V(0).Infof("response method:%s URL:%s request:%s with httpStatus:%d and JSON:%s",
+			r.Method, r.URL.String(), request_id.Get(r.Context()), httpStatus, string(bytes))
 	}
 
 	callback := r.FormValue("callback")
@@ -91,6 +92,9 @@ func writeJsonQuiet(w http.ResponseWriter, r *http.Request, httpStatus int, obj
 func writeJsonError(w http.ResponseWriter, r *http.Request, httpStatus int, err error) {
 	m := make(map[string]interface{})
 	m["error"] = err.Error()
+	if id := request_id.Get(r.Context()); id != "" {
+		m["requestId"] = id
+	}
 	writeJsonQuiet(w, r, httpStatus, m)
 }
 
@@ -129,7 +133,7 @@ func submitForClientHandler(w http.ResponseWriter, r *http.Request, masterUrl st
 		Collection:  r.FormValue("collection"),
 		Ttl:         r.FormValue("ttl"),
 	}
-	assignResult, ae := operation.Assign(masterUrl, grpcDialOption, ar)
+	assignResult, ae := operation.Assign(r.Context(), masterUrl, grpcDialOption, ar)
 	if ae != nil {
 		writeJsonError(w, r, http.StatusInternalServerError, ae)
 		return
@@ -321,3 +325,13 @@ func processRangeRequest(r *http.Request, w http.ResponseWriter, totalSize int64
 		return
 	}
 }
+
+// profileStreamWriter sends everything written to it as grpc stream messages
+type profileStreamWriter func(data []byte) error
+
+func (fn profileStreamWriter) Write(p []byte) (n int, err error) {
+	if err = fn(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -1,6 +1,7 @@
 package weed_server
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
 )
 
 func (fs *FilerServer) LookupDirectoryEntry(ctx context.Context, req *filer_pb.LookupDirectoryEntryRequest) (*filer_pb.LookupDirectoryEntryResponse, error) {
@@ -114,13 +116,21 @@ func (fs *FilerServer) LookupVolume(ctx context.Context, req *filer_pb.LookupVol
 	}
 
 	for _, vidString := range req.VolumeIds {
-		vid, err := strconv.Atoi(vidString)
-		if err != nil {
-			glog.V(1).Infof("Unknown volume id %d", vid)
+		if _, err := strconv.ParseUint(vidString, 10, 32); err != nil {
+			glog.V(1).Infof("Unknown volume id %s", vidString)
 			return nil, err
 		}
+	}
+
+	vid2Locations, err := fs.filer.MasterClient.LookupVolumeIds(req.VolumeIds)
+	if err != nil {
+		// still return the known volumes
+		glog.V(1).Infof("LookupVolumeIds %v: %v", req.VolumeIds, err)
+	}
+
+	for _, vidString := range req.VolumeIds {
 		var locs []*filer_pb.Location
-		locations, found := fs.filer.MasterClient.GetLocations(uint32(vid))
+		locations, found := vid2Locations[vidString]
 		if !found {
 			continue
 		}
@@ -156,7 +166,7 @@ func (fs *FilerServer) CreateEntry(ctx context.Context, req *filer_pb.CreateEntr
 
 	resp = &filer_pb.CreateEntryResponse{}
 
-	chunks, garbage, err2 := fs.cleanupChunks(nil, req.Entry)
+	chunks, garbage, err2 := fs.cleanupChunks(ctx, nil, req.Entry)
 	if err2 != nil {
 		return &filer_pb.CreateEntryResponse{}, fmt.Errorf("CreateEntry cleanupChunks %s %s: %v", req.Directory, req.Entry.Name, err2)
 	}
@@ -171,6 +181,7 @@ func (fs *FilerServer) CreateEntry(ctx context.Context, req *filer_pb.CreateEntr
 		FullPath: util.JoinPath(req.Directory, req.Entry.Name),
 		Attr:     filer2.PbToEntryAttribute(req.Entry.Attributes),
 		Chunks:   chunks,
+		Extended: req.Entry.Extended,
 	}, req.OExcl, req.IsFromOtherCluster)
 
 	if createErr == nil {
@@ -193,7 +204,7 @@ func (fs *FilerServer) UpdateEntry(ctx context.Context, req *filer_pb.UpdateEntr
 		return &filer_pb.UpdateEntryResponse{}, fmt.Errorf("not found %s: %v", fullpath, err)
 	}
 
-	chunks, garbage, err2 := fs.cleanupChunks(entry, req.Entry)
+	chunks, garbage, err2 := fs.cleanupChunks(ctx, entry, req.Entry)
 	if err2 != nil {
 		return &filer_pb.UpdateEntryResponse{}, fmt.Errorf("UpdateEntry cleanupChunks %s: %v", fullpath, err2)
 	}
@@ -204,6 +215,9 @@ func (fs *FilerServer) UpdateEntry(ctx context.Context, req *filer_pb.UpdateEntr
 		Extended: req.Entry.Extended,
 		Chunks:   chunks,
 	}
+	if !bytes.Equal(chunksIdentity(entry.Chunks), chunksIdentity(chunks)) {
+		newEntry.Extended = dropContentHash(newEntry.Extended)
+	}
 
 	glog.V(3).Infof("updating %s: %+v, chunks %d: %v => %+v, chunks %d: %v, extended: %v => %v",
 		fullpath, entry.Attr, len(entry.Chunks), entry.Chunks,
@@ -240,7 +254,7 @@ func (fs *FilerServer) UpdateEntry(ctx context.Context, req *filer_pb.UpdateEntr
 	return &filer_pb.UpdateEntryResponse{}, err
 }
 
-func (fs *FilerServer) cleanupChunks(existingEntry *filer2.Entry, newEntry *filer_pb.Entry) (chunks, garbage []*filer_pb.FileChunk, err error) {
+func (fs *FilerServer) cleanupChunks(ctx context.Context, existingEntry *filer2.Entry, newEntry *filer_pb.Entry) (chunks, garbage []*filer_pb.FileChunk, err error) {
 	chunks = newEntry.Chunks
 
 	// remove old chunks if not included in the new ones
@@ -258,7 +272,7 @@ func (fs *FilerServer) cleanupChunks(existingEntry *filer2.Entry, newEntry *file
 		garbage = append(garbage, coveredChunks...)
 	}
 
-	chunks, err = filer2.MaybeManifestize(fs.saveAsChunk(
+	chunks, err = filer2.MaybeManifestize(fs.saveAsChunk(ctx,
 		newEntry.Attributes.Replication,
 		newEntry.Attributes.Collection,
 		"",
@@ -276,6 +290,10 @@ func (fs *FilerServer) AppendToEntry(ctx context.Context, req *filer_pb.AppendTo
 	glog.V(4).Infof("AppendToEntry %v", req)
 
 	fullpath := util.NewFullPath(req.Directory, req.EntryName)
+	if err := fs.checkLease(fullpath, req.LeaseHolder); err != nil {
+		return &filer_pb.AppendToEntryResponse{}, err
+	}
+
 	var offset int64 = 0
 	entry, err := fs.filer.FindEntry(ctx, util.FullPath(fullpath))
 	if err == filer_pb.ErrNotFound {
@@ -291,6 +309,7 @@ func (fs *FilerServer) AppendToEntry(ctx context.Context, req *filer_pb.AppendTo
 		}
 	} else {
 		offset = int64(filer2.TotalSize(entry.Chunks))
+		entry.Mtime = time.Now()
 	}
 
 	for _, chunk := range req.Chunks {
@@ -299,8 +318,9 @@ func (fs *FilerServer) AppendToEntry(ctx context.Context, req *filer_pb.AppendTo
 	}
 
 	entry.Chunks = append(entry.Chunks, req.Chunks...)
+	entry.Extended = dropContentHash(entry.Extended)
 
-	entry.Chunks, err = filer2.MaybeManifestize(fs.saveAsChunk(
+	entry.Chunks, err = filer2.MaybeManifestize(fs.saveAsChunk(ctx,
 		entry.Replication,
 		entry.Collection,
 		"",
@@ -359,7 +379,7 @@ func (fs *FilerServer) AssignVolume(ctx context.Context, req *filer_pb.AssignVol
 			DataCenter:  "",
 		}
 	}
-	assignResult, err := operation.Assign(fs.filer.GetMaster(), fs.grpcDialOption, assignRequest, altRequest)
+	assignResult, err := operation.Assign(ctx, fs.filer.GetMaster(), fs.grpcDialOption, assignRequest, altRequest)
 	if err != nil {
 		glog.V(3).Infof("AssignVolume: %v", err)
 		return &filer_pb.AssignVolumeResponse{Error: fmt.Sprintf("assign volume: %v", err)}, nil
@@ -377,6 +397,7 @@ func (fs *FilerServer) AssignVolume(ctx context.Context, req *filer_pb.AssignVol
 		Auth:        string(assignResult.Auth),
 		Collection:  collection,
 		Replication: replication,
+		WriteAck:    fs.option.collectionWriteAcks[collection],
 	}, nil
 }
 
@@ -510,3 +531,13 @@ func (fs *FilerServer) LocateBroker(ctx context.Context, req *filer_pb.LocateBro
 	return resp, nil
 
 }
+
+func (fs *FilerServer) Profile(req *filer_pb.ProfileRequest, stream filer_pb.SeaweedFiler_ProfileServer) error {
+
+	glog.V(0).Infof("collecting %s profile for %d seconds", req.ProfileName, req.Seconds)
+
+	return grace.WriteProfile(stream.Context(), profileStreamWriter(func(data []byte) error {
+		return stream.Send(&filer_pb.ProfileResponse{Data: data})
+	}), req.ProfileName, int(req.Seconds))
+
+}
@@ -0,0 +1,287 @@
+package weed_server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// The leases work like the leases of the hdfs name node: one holder appends to or truncates a file,
+// and renews its leases periodically. A lease not renewed within leaseSoftLimit can be taken by another holder.
+// Once a lease is taken over, the previous holder can not change the file for leaseFenceLimit,
+// so a writer thought to be dead can not corrupt the file after its lease is recovered.
+// The leases are only kept in memory, so the hdfs clients of a file should use the same filer.
+// After the filer restarts, an appending holder takes its lease again with the next append.
+
+const (
+	leaseSoftLimit  = time.Minute
+	leaseFenceLimit = time.Hour
+)
+
+type fileLease struct {
+	holder      string
+	expiresAt   time.Time
+	fenced      string // the holder whose lease was taken over
+	fencedUntil time.Time
+}
+
+func (l *fileLease) isHeld(now time.Time) bool {
+	return l.holder != "" && now.Before(l.expiresAt)
+}
+
+func (l *fileLease) isUseless(now time.Time) bool {
+	return (l.holder == "" || now.After(l.expiresAt.Add(leaseFenceLimit))) && !now.Before(l.fencedUntil)
+}
+
+func (fs *FilerServer) AcquireLease(ctx context.Context, req *filer_pb.AcquireLeaseRequest) (*filer_pb.AcquireLeaseResponse, error) {
+
+	glog.V(4).Infof("AcquireLease %v", req)
+
+	resp := &filer_pb.AcquireLeaseResponse{}
+	if req.Holder == "" {
+		resp.Error = "missing lease holder"
+		return resp, nil
+	}
+
+	fullpath := util.JoinPath(req.Directory, req.Name)
+	entry, err := fs.filer.FindEntry(ctx, fullpath)
+	if err != nil && !(err == filer_pb.ErrNotFound && req.Create) {
+		resp.Error = fmt.Sprintf("find %s: %v", fullpath, err)
+		return resp, nil
+	}
+	if entry != nil && entry.IsDirectory() {
+		resp.Error = fmt.Sprintf("%s is a directory", fullpath)
+		return resp, nil
+	}
+
+	fs.pruneLeases(time.Now())
+	expiresAt, err := fs.takeLease(fullpath, req.Holder, req.Recover, time.Now())
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, nil
+	}
+
+	if entry == nil {
+		entry = &filer2.Entry{
+			FullPath: fullpath,
+			Attr: filer2.Attr{
+				Crtime: time.Now(),
+				Mtime:  time.Now(),
+				Mode:   os.FileMode(0644),
+				Uid:    OS_UID,
+				Gid:    OS_GID,
+			},
+		}
+		if err = fs.filer.CreateEntry(ctx, entry, false, false); err != nil {
+			fs.releaseLease(fullpath, req.Holder)
+			resp.Error = fmt.Sprintf("create %s: %v", fullpath, err)
+			return resp, nil
+		}
+	}
+
+	resp.Entry = entry.ToProtoEntry()
+	resp.ExpiresAtNs = expiresAt.UnixNano()
+	return resp, nil
+}
+
+func (fs *FilerServer) RenewLease(ctx context.Context, req *filer_pb.RenewLeaseRequest) (*filer_pb.RenewLeaseResponse, error) {
+
+	glog.V(4).Infof("RenewLease %v", req)
+
+	resp := &filer_pb.RenewLeaseResponse{}
+	now := time.Now()
+	fs.leasesLock.Lock()
+	for _, lease := range fs.leases {
+		if lease.holder == req.Holder && req.Holder != "" {
+			lease.expiresAt = now.Add(leaseSoftLimit)
+			resp.LeaseCount++
+		}
+	}
+	fs.leasesLock.Unlock()
+	return resp, nil
+}
+
+func (fs *FilerServer) ReleaseLease(ctx context.Context, req *filer_pb.ReleaseLeaseRequest) (*filer_pb.ReleaseLeaseResponse, error) {
+
+	glog.V(4).Infof("ReleaseLease %v", req)
+
+	resp := &filer_pb.ReleaseLeaseResponse{}
+	fullpath := util.JoinPath(req.Directory, req.Name)
+	if !fs.releaseLease(fullpath, req.Holder) {
+		resp.Error = fmt.Sprintf("%s is not leased by %s", fullpath, req.Holder)
+	}
+	return resp, nil
+}
+
+func (fs *FilerServer) TruncateEntry(ctx context.Context, req *filer_pb.TruncateEntryRequest) (*filer_pb.TruncateEntryResponse, error) {
+
+	glog.V(4).Infof("TruncateEntry %v", req)
+
+	resp := &filer_pb.TruncateEntryResponse{}
+	fullpath := util.JoinPath(req.Directory, req.Name)
+	if err := fs.checkLease(fullpath, req.LeaseHolder); err != nil {
+		resp.Error = err.Error()
+		return resp, nil
+	}
+
+	entry, err := fs.filer.FindEntry(ctx, fullpath)
+	if err != nil {
+		resp.Error = fmt.Sprintf("find %s: %v", fullpath, err)
+		return resp, nil
+	}
+	if entry.IsDirectory() {
+		resp.Error = fmt.Sprintf("%s is a directory", fullpath)
+		return resp, nil
+	}
+	size := int64(filer2.TotalSize(entry.Chunks))
+	if req.NewLength < 0 || req.NewLength > size {
+		resp.Error = fmt.Sprintf("can not truncate %s of %d bytes to %d bytes", fullpath, size, req.NewLength)
+		return resp, nil
+	}
+
+	if req.NewLength < size {
+		chunks, garbage, err := fs.truncateChunks(ctx, entry, req.NewLength)
+		if err != nil {
+			resp.Error = fmt.Sprintf("truncate %s: %v", fullpath, err)
+			return resp, nil
+		}
+		truncated := &filer2.Entry{
+			FullPath: entry.FullPath,
+			Attr:     entry.Attr,
+			Extended: dropContentHash(entry.Extended),
+			Chunks:   chunks,
+		}
+		truncated.Mtime = time.Now()
+		truncated.Md5 = nil
+		if err = fs.filer.UpdateEntry(ctx, entry, truncated); err != nil {
+			resp.Error = fmt.Sprintf("truncate %s: %v", fullpath, err)
+			return resp, nil
+		}
+		fs.filer.DeleteChunks(garbage)
+		fs.filer.NotifyUpdateEvent(ctx, entry, truncated, true, false)
+		entry = truncated
+	}
+
+	resp.Entry = entry.ToProtoEntry()
+	return resp, nil
+}
+
+// truncateChunks keeps the chunks before the new length.
+// The data before the new length of the chunks across it is copied to a new chunk,
+// since compressed or encrypted chunks can only be read in full.
+// The manifests are built again, so the old manifest chunks are garbage with the removed data chunks.
+func (fs *FilerServer) truncateChunks(ctx context.Context, entry *filer2.Entry, length int64) (chunks, garbage []*filer_pb.FileChunk, err error) {
+
+	dataChunks, manifestChunks, err := filer2.ResolveChunkManifest(fs.lookupFileId, entry.Chunks)
+	if err != nil {
+		return nil, nil, err
+	}
+	garbage = manifestChunks
+
+	copyFrom := length
+	for _, chunk := range dataChunks {
+		stop := chunk.Offset + int64(chunk.Size)
+		if stop <= length {
+			chunks = append(chunks, chunk)
+			continue
+		}
+		if chunk.Offset < copyFrom {
+			copyFrom = chunk.Offset
+		}
+		garbage = append(garbage, chunk)
+	}
+
+	saveFunc := fs.saveAsChunk(ctx, entry.Replication, entry.Collection, "", needle.SecondsToTTL(entry.TtlSec), false)
+	if copyFrom < length {
+		var buf bytes.Buffer
+		if err = filer2.StreamContent(fs.filer.MasterClient, &buf, dataChunks, copyFrom, length-copyFrom); err != nil {
+			return nil, nil, fmt.Errorf("read [%d,%d): %v", copyFrom, length, err)
+		}
+		// the new chunk is the latest, and covers the older chunks with the same data
+		chunk, _, _, err := saveFunc(&buf, entry.Name(), copyFrom)
+		if err != nil {
+			return nil, nil, fmt.Errorf("save [%d,%d): %v", copyFrom, length, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	chunks, err = filer2.MaybeManifestize(saveFunc, chunks)
+	if err != nil {
+		// not good, but should be ok
+		glog.V(0).Infof("MaybeManifestize: %v", err)
+	}
+	return chunks, garbage, nil
+}
+
+// takeLease gives the lease of the file to the holder, unless another holder has a valid lease
+func (fs *FilerServer) takeLease(fullpath util.FullPath, holder string, recover bool, now time.Time) (expiresAt time.Time, err error) {
+	fs.leasesLock.Lock()
+	defer fs.leasesLock.Unlock()
+
+	lease, found := fs.leases[fullpath]
+	if !found {
+		lease = &fileLease{}
+		fs.leases[fullpath] = lease
+	}
+	if lease.fenced == holder && now.Before(lease.fencedUntil) {
+		if !recover {
+			return time.Time{}, fmt.Errorf("the lease of %s by %s has been recovered", fullpath, holder)
+		}
+		lease.fenced = ""
+	}
+	if lease.holder != "" && lease.holder != holder {
+		if lease.isHeld(now) && !recover {
+			return time.Time{}, fmt.Errorf("%s is leased by %s", fullpath, lease.holder)
+		}
+		lease.fenced, lease.fencedUntil = lease.holder, now.Add(leaseFenceLimit)
+	}
+	lease.holder = holder
+	lease.expiresAt = now.Add(leaseSoftLimit)
+	return lease.expiresAt, nil
+}
+
+// checkLease takes the lease for the holder, or fails if the file is leased and there is no holder
+func (fs *FilerServer) checkLease(fullpath util.FullPath, holder string) error {
+	if holder != "" {
+		_, err := fs.takeLease(fullpath, holder, false, time.Now())
+		return err
+	}
+	fs.leasesLock.Lock()
+	defer fs.leasesLock.Unlock()
+	if lease, found := fs.leases[fullpath]; found && lease.isHeld(time.Now()) {
+		return fmt.Errorf("%s is leased by %s", fullpath, lease.holder)
+	}
+	return nil
+}
+
+func (fs *FilerServer) releaseLease(fullpath util.FullPath, holder string) bool {
+	fs.leasesLock.Lock()
+	defer fs.leasesLock.Unlock()
+	lease, found := fs.leases[fullpath]
+	if !found || lease.holder != holder {
+		return false
+	}
+	lease.holder = ""
+	if lease.isUseless(time.Now()) {
+		delete(fs.leases, fullpath)
+	}
+	return true
+}
+
+func (fs *FilerServer) pruneLeases(now time.Time) {
+	fs.leasesLock.Lock()
+	defer fs.leasesLock.Unlock()
+	for fullpath, lease := range fs.leases {
+		if lease.isUseless(now) {
+			delete(fs.leases, fullpath)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package weed_server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestTakeLease(t *testing.T) {
+	fs := &FilerServer{leases: make(map[util.FullPath]*fileLease)}
+	p := util.FullPath("/a/wal")
+	now := time.Now()
+
+	if _, err := fs.takeLease(p, "a", false, now); err != nil {
+		t.Fatalf("take free lease: %v", err)
+	}
+	if _, err := fs.takeLease(p, "a", false, now.Add(time.Second)); err != nil {
+		t.Fatalf("take own lease again: %v", err)
+	}
+	if _, err := fs.takeLease(p, "b", false, now.Add(2*time.Second)); err == nil {
+		t.Fatalf("took the valid lease of another holder")
+	}
+	if err := fs.checkLease(p, ""); err == nil {
+		t.Fatalf("changed a leased file without the lease")
+	}
+
+	// the lease expires without renewal, and the previous holder is fenced after it is taken over
+	if _, err := fs.takeLease(p, "b", false, now.Add(2*leaseSoftLimit)); err != nil {
+		t.Fatalf("take expired lease: %v", err)
+	}
+	if _, err := fs.takeLease(p, "a", false, now.Add(2*leaseSoftLimit)); err == nil {
+		t.Fatalf("fenced holder took the lease")
+	}
+
+	// recovering revokes the valid lease
+	if _, err := fs.takeLease(p, "c", true, now.Add(2*leaseSoftLimit)); err != nil {
+		t.Fatalf("recover lease: %v", err)
+	}
+	if !fs.releaseLease(p, "c") {
+		t.Fatalf("release own lease")
+	}
+	if fs.releaseLease(p, "c") {
+		t.Fatalf("released a lease twice")
+	}
+	if _, err := fs.takeLease(p, "b", false, now.Add(3*leaseSoftLimit)); err == nil {
+		t.Fatalf("fenced holder took the released lease")
+	}
+
+	fs.pruneLeases(now.Add(2 * leaseFenceLimit))
+	if len(fs.leases) != 0 {
+		t.Fatalf("leases not pruned: %d", len(fs.leases))
+	}
+}
@@ -0,0 +1,223 @@
+package weed_server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	readFileFrameSize       = 1024 * 1024
+	writeFileMaxChunkSizeMB = 256
+)
+
+func (fs *FilerServer) ReadFile(req *filer_pb.ReadFileRequest, stream filer_pb.SeaweedFiler_ReadFileServer) error {
+
+	fullPath := util.JoinPath(req.Directory, req.Name)
+	glog.V(4).Infof("ReadFile %s offset %d size %d", fullPath, req.Offset, req.Size)
+
+	entry, err := fs.filer.FindEntry(stream.Context(), fullPath)
+	if err != nil {
+		return err
+	}
+	if entry.IsDirectory() {
+		return fmt.Errorf("%s is a directory", fullPath)
+	}
+
+	totalSize := int64(entry.Size())
+	offset, size := req.Offset, req.Size
+	if offset < 0 || offset > totalSize {
+		return fmt.Errorf("offset %d is out of the file size %d", offset, totalSize)
+	}
+	if size <= 0 || offset+size > totalSize {
+		size = totalSize - offset
+	}
+
+	if err = stream.Send(&filer_pb.ReadFileResponse{
+		Entry: entry.ToProtoEntry(),
+	}); err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+
+	writer := &readFileStreamWriter{stream: stream}
+	if err = filer2.StreamContent(fs.filer.MasterClient, writer, entry.Chunks, offset, size); err != nil {
+		return err
+	}
+	return writer.err
+}
+
+// readFileStreamWriter sends the data as frames of at most readFileFrameSize bytes
+type readFileStreamWriter struct {
+	stream filer_pb.SeaweedFiler_ReadFileServer
+	err    error
+}
+
+func (w *readFileStreamWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for len(p) > 0 {
+		frame := p
+		if len(frame) > readFileFrameSize {
+			frame = frame[:readFileFrameSize]
+		}
+		if w.err = w.stream.Send(&filer_pb.ReadFileResponse{Data: frame}); w.err != nil {
+			return n, w.err
+		}
+		n += len(frame)
+		p = p[len(frame):]
+	}
+	return n, nil
+}
+
+func (fs *FilerServer) WriteFile(stream filer_pb.SeaweedFiler_WriteFileServer) error {
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if req.Init == nil {
+		return fmt.Errorf("missing the init message")
+	}
+	init := req.Init
+	fullPath := util.JoinPath(init.Directory, init.Name)
+	glog.V(4).Infof("WriteFile %s append:%v", fullPath, init.IsAppend)
+
+	ttl, err := needle.ReadTTL(init.Ttl)
+	if err != nil {
+		return fmt.Errorf("parse ttl %s: %v", init.Ttl, err)
+	}
+	collection, replication, fsync := fs.detectCollection(string(fullPath), init.Collection, init.Replication)
+	dataCenter := init.DataCenter
+	if dataCenter == "" {
+		dataCenter = fs.option.DataCenter
+	}
+	chunkSizeMB := int(init.ChunkSizeMb)
+	if chunkSizeMB <= 0 {
+		chunkSizeMB = fs.option.MaxMB
+	}
+	if chunkSizeMB <= 0 || chunkSizeMB > writeFileMaxChunkSizeMB {
+		return fmt.Errorf("invalid chunk size %d MB", chunkSizeMB)
+	}
+	chunkSize := chunkSizeMB * 1024 * 1024
+
+	var existing *filer2.Entry
+	var offset int64
+	if init.IsAppend {
+		existing, err = fs.filer.FindEntry(stream.Context(), fullPath)
+		if err != nil && err != filer_pb.ErrNotFound {
+			return err
+		}
+		if existing != nil {
+			if existing.IsDirectory() {
+				return fmt.Errorf("%s is a directory", fullPath)
+			}
+			offset = int64(existing.Size())
+		}
+	}
+
+	// split the received data into chunks
+	saveFn := fs.saveAsChunk(stream.Context(), replication, collection, dataCenter, init.Ttl, fsync)
+	md5Hash := md5.New()
+	contentHash := fs.newContentHash()
+	var chunks []*filer_pb.FileChunk
+	var buf bytes.Buffer
+	saveChunk := func(data []byte) error {
+		chunk, _, _, err := saveFn(bytes.NewReader(data), init.Name, offset)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, chunk)
+		offset += int64(len(data))
+		return nil
+	}
+	for {
+		if len(req.Data) > 0 {
+			md5Hash.Write(req.Data)
+			if contentHash != nil {
+				contentHash.Write(req.Data)
+			}
+			buf.Write(req.Data)
+			for buf.Len() >= chunkSize {
+				if err = saveChunk(buf.Next(chunkSize)); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		if req, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	if err == io.EOF && buf.Len() > 0 {
+		err = saveChunk(buf.Bytes())
+	}
+	if err != io.EOF && err != nil {
+		fs.filer.DeleteChunks(chunks)
+		glog.V(0).Infof("WriteFile %s: %v", fullPath, err)
+		return err
+	}
+
+	now := time.Now()
+	entry := existing
+	if entry == nil {
+		fileMode := os.FileMode(init.FileMode)
+		if fileMode == 0 {
+			fileMode = 0660
+		}
+		entry = &filer2.Entry{
+			FullPath: fullPath,
+			Attr: filer2.Attr{
+				Crtime:      now,
+				Mode:        fileMode,
+				Uid:         OS_UID,
+				Gid:         OS_GID,
+				Replication: replication,
+				Collection:  collection,
+				TtlSec:      int32(ttl.Minutes()) * 60,
+				Mime:        init.Mime,
+				Md5:         md5Hash.Sum(nil),
+			},
+		}
+		if contentHash != nil {
+			setContentHash(entry, contentHash.Sum(nil))
+		}
+	} else {
+		// the md5 and sha256 of the whole file are unknown after appending
+		entry.Md5 = nil
+		delete(entry.Extended, casSha256Key)
+	}
+	entry.Mtime = now
+
+	allChunks, err := filer2.MaybeManifestize(saveFn, append(entry.Chunks, chunks...))
+	if err != nil {
+		fs.filer.DeleteChunks(chunks)
+		return fmt.Errorf("manifestize %s: %v", fullPath, err)
+	}
+	entry.Chunks = allChunks
+
+	if err = fs.filer.CreateEntry(stream.Context(), entry, false, false); err != nil {
+		fs.filer.DeleteChunks(chunks)
+		glog.V(0).Infof("WriteFile %s: %v", fullPath, err)
+		return err
+	}
+	fs.indexContent(stream.Context(), entry)
+
+	return stream.SendAndClose(&filer_pb.WriteFileResponse{
+		Entry: entry.ToProtoEntry(),
+	})
+}
@@ -0,0 +1,40 @@
+package weed_server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+type fakeReadFileServer struct {
+	filer_pb.SeaweedFiler_ReadFileServer
+	frames [][]byte
+}
+
+func (s *fakeReadFileServer) Send(resp *filer_pb.ReadFileResponse) error {
+	s.frames = append(s.frames, append([]byte(nil), resp.Data...))
+	return nil
+}
+
+func TestReadFileStreamWriterSplitsFrames(t *testing.T) {
+
+	stream := &fakeReadFileServer{}
+	writer := &readFileStreamWriter{stream: stream}
+
+	data := bytes.Repeat([]byte("x"), 2*readFileFrameSize+7)
+	if n, err := writer.Write(data); err != nil || n != len(data) {
+		t.Fatalf("write %d: %v", n, err)
+	}
+
+	if len(stream.frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(stream.frames))
+	}
+	if len(stream.frames[0]) != readFileFrameSize || len(stream.frames[2]) != 7 {
+		t.Errorf("unexpected frame sizes %d %d", len(stream.frames[0]), len(stream.frames[2]))
+	}
+	if !bytes.Equal(bytes.Join(stream.frames, nil), data) {
+		t.Errorf("data mismatch")
+	}
+
+}
@@ -0,0 +1,70 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func (fs *FilerServer) TopEntries(ctx context.Context, req *filer_pb.TopEntriesRequest) (*filer_pb.TopEntriesResponse, error) {
+
+	dir := util.FullPath(req.Directory)
+	if dir == "" {
+		dir = "/"
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 10
+	}
+	key := fmt.Sprintf("%s %d %d", dir, limit, req.MaxEntries)
+
+	fs.topEntriesLock.Lock()
+	top, found := fs.topEntries[key]
+	fs.topEntriesLock.Unlock()
+
+	if !found || time.Since(top.ComputedAt) > time.Duration(req.MaxAgeSeconds)*time.Second {
+		var err error
+		startTime := time.Now()
+		top, err = fs.filer.CollectTopEntries(ctx, dir, limit, req.MaxEntries)
+		if err != nil {
+			return nil, fmt.Errorf("collect top entries under %s: %v", dir, err)
+		}
+		glog.V(1).Infof("collected top %d entries under %s from %d files in %v", limit, dir, top.FileCount, time.Since(startTime))
+
+		fs.topEntriesLock.Lock()
+		for k, v := range fs.topEntries {
+			if time.Since(v.ComputedAt) > time.Hour {
+				delete(fs.topEntries, k)
+			}
+		}
+		fs.topEntries[key] = top
+		fs.topEntriesLock.Unlock()
+	}
+
+	return &filer_pb.TopEntriesResponse{
+		Files:          toProtoSizedEntries(top.Files),
+		Directories:    toProtoSizedEntries(top.Directories),
+		TotalSize:      top.TotalSize,
+		FileCount:      top.FileCount,
+		DirectoryCount: top.DirectoryCount,
+		Truncated:      top.Truncated,
+		ComputedAtNs:   top.ComputedAt.UnixNano(),
+	}, nil
+}
+
+func toProtoSizedEntries(entries []filer2.SizedEntry) (ret []*filer_pb.TopEntriesResponse_SizedEntry) {
+	for _, e := range entries {
+		ret = append(ret, &filer_pb.TopEntriesResponse_SizedEntry{
+			FullPath:  string(e.FullPath),
+			Size:      e.Size,
+			FileCount: e.FileCount,
+			Mtime:     e.Mtime.Unix(),
+		})
+	}
+	return
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/topology"
 	"github.com/chrislusf/seaweedfs/weed/util"
 
 	"github.com/chrislusf/seaweedfs/weed/filer2"
@@ -53,6 +54,13 @@ type FilerOption struct {
 	recursiveDelete    bool
 	Cipher             bool
 	Filers             []string
+	ContentAddressable bool
+	// uploading the chunks of large files
+	ChunkUploadConcurrency int
+	ChunkUploadBufferMB    int
+	ChunkMaxMB             int
+	// collection to the write ack level of the volume servers
+	collectionWriteAcks map[string]string
 }
 
 type FilerServer struct {
@@ -67,6 +75,24 @@ type FilerServer struct {
 
 	brokers     map[string]map[string]bool
 	brokersLock sync.Mutex
+
+	// recently computed largest files and directories
+	topEntries     map[string]*filer2.TopEntries
+	topEntriesLock sync.Mutex
+
+	// tus and blob uploads being written
+	uploadLocks     map[string]bool
+	uploadLocksLock sync.Mutex
+
+	// updating the content address index
+	casLock sync.Mutex
+
+	// the hdfs leases of the files being appended
+	leases     map[util.FullPath]*fileLease
+	leasesLock sync.Mutex
+
+	// the memory of the chunks being uploaded
+	chunkUploadBuffer *uploadBuffer
 }
 
 func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption) (fs *FilerServer, err error) {
@@ -75,7 +101,11 @@ func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption)
 		option:         option,
 		grpcDialOption: security.LoadClientTLS(util.GetViper(), "grpc.filer"),
 		brokers:        make(map[string]map[string]bool),
+		topEntries:     make(map[string]*filer2.TopEntries),
+		uploadLocks:    make(map[string]bool),
+		leases:         make(map[util.FullPath]*fileLease),
 	}
+	fs.chunkUploadBuffer = newUploadBuffer(int64(option.ChunkUploadBufferMB) * 1024 * 1024)
 	fs.listenersCond = sync.NewCond(&fs.listenersLock)
 
 	if len(option.Masters) == 0 {
@@ -107,6 +137,12 @@ func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption)
 	v.SetDefault("filer.options.buckets_folder", "/buckets")
 	fs.filer.DirBucketsPath = v.GetString("filer.options.buckets_folder")
 	fs.filer.FsyncBuckets = v.GetStringSlice("filer.options.buckets_fsync")
+	fs.option.collectionWriteAcks = v.GetStringMapString("filer.options.collections_write_ack")
+	for collection, writeAck := range fs.option.collectionWriteAcks {
+		if err := topology.ValidateWriteAck(writeAck); err != nil {
+			glog.Fatalf("filer.options.collections_write_ack %s: %v", collection, err)
+		}
+	}
 	fs.filer.LoadConfiguration(v)
 
 	notification.LoadConfiguration(v, "notification.")
@@ -114,9 +150,22 @@ func NewFilerServer(defaultMux, readonlyMux *http.ServeMux, option *FilerOption)
 	handleStaticResources(defaultMux)
 	if !option.DisableHttp {
 		defaultMux.HandleFunc("/", fs.filerHandler)
+		defaultMux.HandleFunc(tusUrlPrefix+"/", fs.tusHandler)
+		go fs.loopCleanUploads(tusUploadsFolder, tusExpiration)
+		defaultMux.HandleFunc(blobUrlPrefix+"/", fs.blobHandler)
+		go fs.loopCleanUploads(blobUploadsFolder, blobExpiration)
+		go fs.loopCleanUploads(deltaFolder, deltaExpiration)
+		defaultMux.HandleFunc(eventsUrlPrefix, fs.eventsHandler)
+		if option.ContentAddressable {
+			defaultMux.HandleFunc(casUrlPrefix+"/", fs.casHandler)
+		}
 	}
 	if defaultMux != readonlyMux {
 		readonlyMux.HandleFunc("/", fs.readonlyFilerHandler)
+		readonlyMux.HandleFunc(blobUrlPrefix+"/", fs.readonlyBlobHandler)
+		if option.ContentAddressable {
+			readonlyMux.HandleFunc(casUrlPrefix+"/", fs.casHandler)
+		}
 	}
 
 	fs.filer.AggregateFromPeers(fmt.Sprintf("%s:%d", option.Host, option.Port), option.Filers)
@@ -1,6 +1,7 @@
 package weed_server
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -35,6 +36,7 @@ func (fs *FilerServer) filerHandler(w http.ResponseWriter, r *http.Request) {
 
 func (fs *FilerServer) readonlyFilerHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	r = r.WithContext(context.WithValue(r.Context(), readonlyRequestKey{}, true))
 	switch r.Method {
 	case "GET":
 		stats.FilerRequestCounter.WithLabelValues("get").Inc()
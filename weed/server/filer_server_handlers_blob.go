@@ -0,0 +1,484 @@
+package weed_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// Blob upload sessions and digest addressed blobs, for the storage of container registries.
+// The api follows the blob upload of the OCI distribution spec:
+//
+//	POST   /.blobs/uploads/                      start an upload, optionally with ?digest=sha256:<hex> and the whole blob
+//	PATCH  /.blobs/uploads/<id>                  append the body, with an optional "Content-Range: <start>-<end>"
+//	GET    /.blobs/uploads/<id>                  the received range
+//	PUT    /.blobs/uploads/<id>?digest=sha256:.. append the optional body, verify the digest, and commit the blob
+//	DELETE /.blobs/uploads/<id>                  cancel the upload
+//	GET    /.blobs/sha256/<hex>                  read the blob, also with "Range"
+//	DELETE /.blobs/sha256/<hex>                  delete the blob
+//
+// The data of an upload is kept as the chunks of /.blobs/uploads/<id>, together with the sha256 state of the received data.
+// A committed blob is moved to /.blobs/sha256/<first 2 hex>/<hex>.
+
+const (
+	blobUrlPrefix       = "/.blobs"
+	blobUploadUrlPrefix = "/.blobs/uploads/"
+	blobDigestUrlPrefix = "/.blobs/sha256/"
+	blobUploadsFolder   = "/.blobs/uploads"
+	blobsFolder         = "/.blobs/sha256"
+	blobExpiration      = 24 * time.Hour
+	blobDigestAlgorithm = "sha256:"
+
+	blobExtendedSha256State = "blob.sha256"
+)
+
+type blobUpload struct {
+	id     string
+	entry  *filer2.Entry
+	offset int64
+	hash   hash.Hash
+}
+
+func (fs *FilerServer) blobHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	stats.FilerRequestCounter.WithLabelValues("blob").Inc()
+	defer func() { stats.FilerRequestHistogram.WithLabelValues("blob").Observe(time.Since(start).Seconds()) }()
+
+	switch {
+	case r.URL.Path == blobUploadUrlPrefix:
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fs.blobCreate(w, r)
+	case strings.HasPrefix(r.URL.Path, blobUploadUrlPrefix):
+		id := strings.TrimPrefix(r.URL.Path, blobUploadUrlPrefix)
+		switch r.Method {
+		case "GET", "HEAD":
+			fs.blobStatus(w, r, id)
+		case "PATCH":
+			fs.blobPatch(w, r, id)
+		case "PUT":
+			fs.blobCommit(w, r, id)
+		case "DELETE":
+			fs.blobCancel(w, r, id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case strings.HasPrefix(r.URL.Path, blobDigestUrlPrefix):
+		switch r.Method {
+		case "GET", "HEAD":
+			fs.blobRead(w, r)
+		case "DELETE":
+			fs.blobDelete(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// readonlyBlobHandler only serves the committed blobs
+func (fs *FilerServer) readonlyBlobHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, blobDigestUrlPrefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	fs.blobRead(w, r)
+}
+
+func (fs *FilerServer) blobCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, err := newUploadId()
+	if err != nil {
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	query := r.URL.Query()
+	collection, replication, _ := fs.detectCollection(blobsFolder, query.Get("collection"), query.Get("replication"))
+	now := time.Now()
+	upload := &blobUpload{
+		id: id,
+		entry: &filer2.Entry{
+			FullPath: util.FullPath(blobUploadsFolder).Child(id),
+			Attr: filer2.Attr{
+				Mtime:       now,
+				Crtime:      now,
+				Mode:        0660,
+				Uid:         OS_UID,
+				Gid:         OS_GID,
+				Replication: replication,
+				Collection:  collection,
+			},
+		},
+		hash: sha256.New(),
+	}
+	if err = fs.saveBlobUpload(ctx, upload, true); err != nil {
+		glog.Errorf("blob create upload %s: %v", id, err)
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	glog.V(1).Infof("blob upload %s started", id)
+
+	// monolithic upload
+	if digest := query.Get("digest"); digest != "" {
+		if !fs.lockUpload(id) {
+			w.WriteHeader(http.StatusLocked)
+			return
+		}
+		defer fs.unlockUpload(id)
+		fs.doBlobCommit(ctx, w, r, upload, digest)
+		return
+	}
+
+	setBlobUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (fs *FilerServer) blobStatus(w http.ResponseWriter, r *http.Request, id string) {
+	upload, err := fs.loadBlobUpload(context.Background(), id)
+	if err != nil {
+		fs.writeBlobLoadError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	setBlobUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fs *FilerServer) blobPatch(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := context.Background()
+
+	if !fs.lockUpload(id) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	defer fs.unlockUpload(id)
+
+	upload, err := fs.loadBlobUpload(ctx, id)
+	if err != nil {
+		fs.writeBlobLoadError(w, r, err)
+		return
+	}
+
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		start, end, err := parseBlobContentRange(contentRange)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if start != upload.offset || r.ContentLength >= 0 && end-start+1 != r.ContentLength {
+			setBlobUploadHeaders(w, upload)
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	if status, err := fs.blobAppend(ctx, r, upload); err != nil {
+		setBlobUploadHeaders(w, upload)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	setBlobUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (fs *FilerServer) blobCommit(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := context.Background()
+
+	if !fs.lockUpload(id) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	defer fs.unlockUpload(id)
+
+	upload, err := fs.loadBlobUpload(ctx, id)
+	if err != nil {
+		fs.writeBlobLoadError(w, r, err)
+		return
+	}
+	fs.doBlobCommit(ctx, w, r, upload, r.URL.Query().Get("digest"))
+}
+
+// doBlobCommit appends the request body, and moves the upload to the blob if the digest matches
+func (fs *FilerServer) doBlobCommit(ctx context.Context, w http.ResponseWriter, r *http.Request, upload *blobUpload, digest string) {
+	if !strings.HasPrefix(digest, blobDigestAlgorithm) || !isValidContentHash(digest[len(blobDigestAlgorithm):]) {
+		http.Error(w, "unsupported digest "+digest, http.StatusBadRequest)
+		return
+	}
+	expected := digest[len(blobDigestAlgorithm):]
+
+	if status, err := fs.blobAppend(ctx, r, upload); err != nil {
+		setBlobUploadHeaders(w, upload)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	actual := hex.EncodeToString(upload.hash.Sum(nil))
+	if actual != expected {
+		setBlobUploadHeaders(w, upload)
+		http.Error(w, fmt.Sprintf("digest mismatch, received sha256:%s", actual), http.StatusBadRequest)
+		return
+	}
+
+	blobPath := genBlobPath(expected)
+	if _, err := fs.filer.FindEntry(ctx, blobPath); err == nil {
+		// the same blob is already committed
+		if err = fs.filer.DeleteEntryMetaAndData(ctx, upload.entry.FullPath, false, false, true, false); err != nil {
+			glog.Errorf("blob delete duplicated upload %s: %v", upload.id, err)
+		}
+	} else if err != filer_pb.ErrNotFound {
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	} else if err = fs.blobFinish(ctx, upload, blobPath, expected); err != nil {
+		glog.Errorf("blob commit %s: %v", upload.id, err)
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	glog.V(1).Infof("blob upload %s committed as %s", upload.id, digest)
+
+	w.Header().Set("Location", blobDigestUrlPrefix+expected)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// blobAppend saves the request body to the upload.
+// The data received before an interrupted request is still kept, and the client can resume from the received range.
+func (fs *FilerServer) blobAppend(ctx context.Context, r *http.Request, upload *blobUpload) (int, error) {
+	_, _, fsync := fs.detectCollection(blobsFolder, "", "")
+	chunkSize := tusDefaultChunkSize
+	if fs.option.MaxMB > 0 {
+		chunkSize = fs.option.MaxMB * 1024 * 1024
+	}
+	saveFn := fs.saveAsChunk(ctx, upload.entry.Replication, upload.entry.Collection, fs.option.DataCenter, "", fsync)
+
+	var chunks []*filer_pb.FileChunk
+	var received int64
+	var readErr error
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r.Body, buf)
+		if n > 0 {
+			chunk, _, _, uploadErr := saveFn(bytes.NewReader(buf[:n]), upload.id, upload.offset+received)
+			if uploadErr != nil {
+				readErr = fmt.Errorf("upload data: %v", uploadErr)
+				break
+			}
+			upload.hash.Write(buf[:n])
+			chunks = append(chunks, chunk)
+			received += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = fmt.Errorf("read body: %v", err)
+			break
+		}
+	}
+
+	if len(chunks) > 0 {
+		upload.entry.Chunks = append(upload.entry.Chunks, chunks...)
+		if err := fs.saveBlobUpload(ctx, upload, false); err != nil {
+			fs.filer.DeleteChunks(chunks)
+			glog.Errorf("blob save upload %s: %v", upload.id, err)
+			return http.StatusInternalServerError, err
+		}
+		upload.offset += received
+	}
+	if readErr != nil {
+		glog.V(0).Infof("blob upload %s interrupted at %d: %v", upload.id, upload.offset, readErr)
+		return http.StatusBadRequest, readErr
+	}
+	return http.StatusAccepted, nil
+}
+
+// blobFinish moves the chunks of the upload to the blob
+func (fs *FilerServer) blobFinish(ctx context.Context, upload *blobUpload, blobPath util.FullPath, contentHash string) error {
+	_, _, fsync := fs.detectCollection(blobsFolder, "", "")
+	chunks, err := filer2.MaybeManifestize(fs.saveAsChunk(ctx, upload.entry.Replication, upload.entry.Collection, fs.option.DataCenter, "", fsync), upload.entry.Chunks)
+	if err != nil {
+		return fmt.Errorf("manifestize %s: %v", blobPath, err)
+	}
+
+	now := time.Now()
+	entry := &filer2.Entry{
+		FullPath: blobPath,
+		Attr: filer2.Attr{
+			Mtime:       now,
+			Crtime:      now,
+			Mode:        0660,
+			Uid:         OS_UID,
+			Gid:         OS_GID,
+			Replication: upload.entry.Replication,
+			Collection:  upload.entry.Collection,
+			Mime:        "application/octet-stream",
+		},
+		Extended: map[string][]byte{
+			casSha256Key: []byte(contentHash),
+		},
+		Chunks: chunks,
+	}
+	if err = fs.filer.CreateEntry(ctx, entry, false, false); err != nil {
+		return fmt.Errorf("create %s: %v", blobPath, err)
+	}
+	if fs.option.ContentAddressable {
+		fs.indexContent(ctx, entry)
+	}
+	if err = fs.filer.DeleteEntryMetaAndData(ctx, upload.entry.FullPath, false, false, false, false); err != nil {
+		glog.Errorf("blob delete committed upload %s: %v", upload.entry.FullPath, err)
+	}
+	return nil
+}
+
+func (fs *FilerServer) blobCancel(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := context.Background()
+	if !fs.lockUpload(id) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	defer fs.unlockUpload(id)
+
+	upload, err := fs.loadBlobUpload(ctx, id)
+	if err != nil {
+		fs.writeBlobLoadError(w, r, err)
+		return
+	}
+	if err = fs.filer.DeleteEntryMetaAndData(ctx, upload.entry.FullPath, false, false, true, false); err != nil {
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fs *FilerServer) blobRead(w http.ResponseWriter, r *http.Request) {
+	contentHash := strings.TrimPrefix(r.URL.Path, blobDigestUrlPrefix)
+	if !isValidContentHash(contentHash) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	entry, err := fs.filer.FindEntry(context.Background(), genBlobPath(contentHash))
+	if err != nil {
+		fs.writeBlobLoadError(w, r, err)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", blobDigestAlgorithm+contentHash)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	fs.writeEntryContent(w, r, entry)
+}
+
+func (fs *FilerServer) blobDelete(w http.ResponseWriter, r *http.Request) {
+	contentHash := strings.TrimPrefix(r.URL.Path, blobDigestUrlPrefix)
+	if !isValidContentHash(contentHash) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	err := fs.filer.DeleteEntryMetaAndData(context.Background(), genBlobPath(contentHash), false, false, true, false)
+	if err != nil {
+		fs.writeBlobLoadError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (fs *FilerServer) loadBlobUpload(ctx context.Context, id string) (*blobUpload, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, filer_pb.ErrNotFound
+	}
+	entry, err := fs.filer.FindEntry(ctx, util.FullPath(blobUploadsFolder).Child(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry.Crtime.Add(blobExpiration).Before(time.Now()) {
+		fs.filer.DeleteEntryMetaAndData(ctx, entry.FullPath, false, false, true, false)
+		return nil, filer_pb.ErrNotFound
+	}
+	h := sha256.New()
+	if err = h.(encoding.BinaryUnmarshaler).UnmarshalBinary(entry.Extended[blobExtendedSha256State]); err != nil {
+		return nil, fmt.Errorf("upload %s: invalid sha256 state: %v", id, err)
+	}
+	return &blobUpload{
+		id:     id,
+		entry:  entry,
+		offset: int64(filer2.TotalSize(entry.Chunks)),
+		hash:   h,
+	}, nil
+}
+
+// saveBlobUpload keeps the chunks and the sha256 state of the received data
+func (fs *FilerServer) saveBlobUpload(ctx context.Context, upload *blobUpload, isNew bool) error {
+	state, err := upload.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if upload.entry.Extended == nil {
+		upload.entry.Extended = make(map[string][]byte)
+	}
+	upload.entry.Extended[blobExtendedSha256State] = state
+	upload.entry.Mtime = time.Now()
+	return fs.filer.CreateEntry(ctx, upload.entry, isNew, false)
+}
+
+func (fs *FilerServer) writeBlobLoadError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == filer_pb.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJsonError(w, r, http.StatusInternalServerError, err)
+}
+
+func setBlobUploadHeaders(w http.ResponseWriter, upload *blobUpload) {
+	end := upload.offset - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Location", blobUploadUrlPrefix+upload.id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+	w.Header().Set("Docker-Upload-UUID", upload.id)
+}
+
+func genBlobPath(contentHash string) util.FullPath {
+	return util.FullPath(fmt.Sprintf("%s/%s/%s", blobsFolder, contentHash[:2], contentHash))
+}
+
+// parseBlobContentRange parses the "Content-Range: <start>-<end>" of a PATCH, both inclusive
+func parseBlobContentRange(contentRange string) (start, end int64, err error) {
+	contentRange = strings.TrimPrefix(contentRange, "bytes ")
+	if t := strings.Index(contentRange, "/"); t >= 0 {
+		contentRange = contentRange[:t]
+	}
+	parts := strings.SplitN(contentRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %s", contentRange)
+	}
+	if start, err = strconv.ParseInt(parts[0], 10, 64); err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %s", contentRange)
+	}
+	if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid Content-Range %s", contentRange)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,104 @@
+package weed_server
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/filer2/leveldb2"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestParseBlobContentRange(t *testing.T) {
+
+	cases := []struct {
+		header     string
+		start, end int64
+		valid      bool
+	}{
+		{"0-99", 0, 99, true},
+		{"100-199", 100, 199, true},
+		{"bytes 100-199/1000", 100, 199, true},
+		{"5-4", 0, 0, false},
+		{"-4", 0, 0, false},
+		{"abc", 0, 0, false},
+	}
+	for _, c := range cases {
+		start, end, err := parseBlobContentRange(c.header)
+		if (err == nil) != c.valid {
+			t.Errorf("%s: unexpected error %v", c.header, err)
+			continue
+		}
+		if c.valid && (start != c.start || end != c.end) {
+			t.Errorf("%s: expected %d-%d, got %d-%d", c.header, c.start, c.end, start, end)
+		}
+	}
+
+}
+
+func TestBlobUploadResume(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "blob_upload")
+	defer os.RemoveAll(dir)
+	store := &leveldb.LevelDB2Store{}
+	config := viper.New()
+	config.Set("dir", dir)
+	if err := store.Initialize(config, ""); err != nil {
+		t.Fatal(err)
+	}
+	fs := &FilerServer{option: &FilerOption{}, filer: filer2.NewFiler(nil, grpc.WithInsecure(), "", 0, "", "", nil)}
+	fs.filer.SetStore(store)
+	fs.filer.DisableDirectoryCache()
+	ctx := context.Background()
+
+	// the first request hashes a part of the blob, and a later one resumes from the saved state
+	id := "0123456789abcdef"
+	now := time.Now()
+	upload := &blobUpload{
+		id: id,
+		entry: &filer2.Entry{
+			FullPath: util.FullPath(blobUploadsFolder).Child(id),
+			Attr:     filer2.Attr{Mtime: now, Crtime: now, Mode: 0660},
+		},
+		hash: sha256.New(),
+	}
+	upload.hash.Write([]byte("hello "))
+	if err := fs.saveBlobUpload(ctx, upload, true); err != nil {
+		t.Fatalf("save upload: %v", err)
+	}
+
+	resumed, err := fs.loadBlobUpload(ctx, id)
+	if err != nil {
+		t.Fatalf("load upload: %v", err)
+	}
+	resumed.hash.Write([]byte("world"))
+	expected := sha256.Sum256([]byte("hello world"))
+	if string(resumed.hash.Sum(nil)) != string(expected[:]) {
+		t.Errorf("resumed hash mismatch")
+	}
+
+	if _, err = fs.loadBlobUpload(ctx, "not-hex"); err != filer_pb.ErrNotFound {
+		t.Errorf("load upload with an invalid id: %v", err)
+	}
+
+	// an expired upload is removed when loaded
+	upload.entry.Crtime = now.Add(-blobExpiration - time.Minute)
+	if err = fs.saveBlobUpload(ctx, upload, false); err != nil {
+		t.Fatalf("save upload: %v", err)
+	}
+	if _, err = fs.loadBlobUpload(ctx, id); err != filer_pb.ErrNotFound {
+		t.Errorf("load expired upload: %v", err)
+	}
+	if _, err = fs.filer.FindEntry(ctx, upload.entry.FullPath); err != filer_pb.ErrNotFound {
+		t.Errorf("expired upload is kept: %v", err)
+	}
+
+}
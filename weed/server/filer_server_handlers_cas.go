@@ -0,0 +1,237 @@
+package weed_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+/*
+Content address index:
+
+With "weed filer -cas", the sha256 of each uploaded file is returned in the upload result,
+and kept in the file entry as the extended attribute "sha256".
+
+The index entry /.cas/<first 2 hex>/<sha256> lists all the files with this content,
+as extended attributes "path:/path/to/file", valued by the identity of the file chunks when indexed.
+
+	GET /cas/<sha256>
+
+serves any one of the files that still has this content, with a long cache lifetime,
+since the content behind this url never changes.
+Stale paths, i.e., the files that are deleted, overwritten, or changed in any other way, are removed from
+the index when they are found. The kept hash is not trusted alone, since only some of the write paths drop it.
+*/
+
+const (
+	casUrlPrefix     = "/cas"
+	casIndexDir      = "/.cas"
+	casSha256Key     = "sha256"
+	casPathKeyPrefix = "path:"
+)
+
+// newContentHash returns nil if the content address index is disabled
+func (fs *FilerServer) newContentHash() hash.Hash {
+	if !fs.option.ContentAddressable {
+		return nil
+	}
+	return sha256.New()
+}
+
+func isMultipartUpload(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// isRawUpload checks whether the request body is the file content
+func isRawUpload(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return !strings.HasPrefix(contentType, "multipart/form-data") && !strings.HasPrefix(contentType, "application/x-www-form-urlencoded")
+}
+
+func genCasIndexPath(contentHash string) util.FullPath {
+	return util.FullPath(fmt.Sprintf("%s/%s/%s", casIndexDir, contentHash[:2], contentHash))
+}
+
+func isValidContentHash(contentHash string) bool {
+	if len(contentHash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(contentHash)
+	return err == nil && strings.ToLower(contentHash) == contentHash
+}
+
+// setContentHash keeps the hash in the entry, and returns the hash in hex
+func setContentHash(entry *filer2.Entry, sha256value []byte) string {
+	if sha256value == nil {
+		return ""
+	}
+	contentHash := hex.EncodeToString(sha256value)
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+	entry.Extended[casSha256Key] = []byte(contentHash)
+	return contentHash
+}
+
+// dropContentHash removes the hash from the entry whose chunks are changed
+func dropContentHash(extended map[string][]byte) map[string][]byte {
+	if _, found := extended[casSha256Key]; !found {
+		return extended
+	}
+	kept := make(map[string][]byte, len(extended))
+	for key, value := range extended {
+		if key != casSha256Key {
+			kept[key] = value
+		}
+	}
+	return kept
+}
+
+// chunksIdentity changes whenever any chunk of the file is added, removed or replaced
+func chunksIdentity(chunks []*filer_pb.FileChunk) []byte {
+	h := sha256.New()
+	for _, chunk := range chunks {
+		fmt.Fprintf(h, "%s@%d+%d;", chunk.GetFileIdString(), chunk.Offset, chunk.Size)
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil)))
+}
+
+// indexContent adds the saved entry to the content address index
+func (fs *FilerServer) indexContent(ctx context.Context, entry *filer2.Entry) {
+	contentHash := string(entry.Extended[casSha256Key])
+	if contentHash == "" || strings.HasPrefix(string(entry.FullPath), casIndexDir+"/") {
+		return
+	}
+
+	fs.casLock.Lock()
+	defer fs.casLock.Unlock()
+
+	indexPath := genCasIndexPath(contentHash)
+	pathKey := casPathKeyPrefix + string(entry.FullPath)
+	identity := chunksIdentity(entry.Chunks)
+	index, err := fs.filer.FindEntry(ctx, indexPath)
+	if err != nil && err != filer_pb.ErrNotFound {
+		glog.Errorf("cas read index %s: %v", indexPath, err)
+		return
+	}
+	if index == nil {
+		now := time.Now()
+		index = &filer2.Entry{
+			FullPath: indexPath,
+			Attr: filer2.Attr{
+				Mtime:  now,
+				Crtime: now,
+				Mode:   0660,
+				Uid:    OS_UID,
+				Gid:    OS_GID,
+			},
+			Extended: make(map[string][]byte),
+		}
+	} else if bytes.Equal(index.Extended[pathKey], identity) {
+		return
+	}
+	if index.Extended == nil {
+		index.Extended = make(map[string][]byte)
+	}
+	index.Extended[pathKey] = identity
+	if err = fs.filer.CreateEntry(ctx, index, false, false); err != nil {
+		glog.Errorf("cas index %s as %s: %v", entry.FullPath, contentHash, err)
+	}
+}
+
+// resolveContentHash returns one file with the content, and removes the stale paths from the index
+func (fs *FilerServer) resolveContentHash(ctx context.Context, contentHash string) (*filer2.Entry, error) {
+	indexPath := genCasIndexPath(contentHash)
+	index, err := fs.filer.FindEntry(ctx, indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *filer2.Entry
+	var stalePathKeys []string
+	for key, identity := range index.Extended {
+		if !strings.HasPrefix(key, casPathKeyPrefix) {
+			continue
+		}
+		entry, err := fs.filer.FindEntry(ctx, util.FullPath(key[len(casPathKeyPrefix):]))
+		if err == filer_pb.ErrNotFound || err == nil && !bytes.Equal(chunksIdentity(entry.Chunks), identity) {
+			stalePathKeys = append(stalePathKeys, key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = entry
+		break
+	}
+
+	if len(stalePathKeys) > 0 {
+		fs.removeStaleContentPaths(ctx, indexPath, stalePathKeys)
+	}
+
+	if found == nil {
+		return nil, filer_pb.ErrNotFound
+	}
+	return found, nil
+}
+
+func (fs *FilerServer) removeStaleContentPaths(ctx context.Context, indexPath util.FullPath, stalePathKeys []string) {
+	fs.casLock.Lock()
+	defer fs.casLock.Unlock()
+
+	index, err := fs.filer.FindEntry(ctx, indexPath)
+	if err != nil {
+		return
+	}
+	for _, key := range stalePathKeys {
+		delete(index.Extended, key)
+	}
+	if len(index.Extended) == 0 {
+		err = fs.filer.DeleteEntryMetaAndData(ctx, indexPath, false, false, false, false)
+	} else {
+		err = fs.filer.CreateEntry(ctx, index, false, false)
+	}
+	if err != nil {
+		glog.Errorf("cas clean index %s: %v", indexPath, err)
+	}
+}
+
+func (fs *FilerServer) casHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	contentHash := strings.TrimPrefix(r.URL.Path, casUrlPrefix+"/")
+	if !fs.option.ContentAddressable || !isValidContentHash(contentHash) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	stats.FilerRequestCounter.WithLabelValues("cas").Inc()
+	entry, err := fs.resolveContentHash(context.Background(), contentHash)
+	if err == filer_pb.ErrNotFound {
+		glog.V(1).Infof("cas not found %s", contentHash)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		glog.V(0).Infof("cas resolve %s: %v", contentHash, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	fs.writeEntryContent(w, r, entry)
+}
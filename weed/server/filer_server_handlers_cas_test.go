@@ -0,0 +1,65 @@
+package weed_server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestContentHash(t *testing.T) {
+
+	sum := sha256.Sum256([]byte("hello\n"))
+	entry := &filer2.Entry{}
+	contentHash := setContentHash(entry, sum[:])
+	if contentHash != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+		t.Errorf("unexpected hash %s", contentHash)
+	}
+	if string(entry.Extended[casSha256Key]) != contentHash {
+		t.Errorf("hash is not kept in the entry")
+	}
+	if string(genCasIndexPath(contentHash)) != "/.cas/58/"+contentHash {
+		t.Errorf("unexpected index path %s", genCasIndexPath(contentHash))
+	}
+
+	if setContentHash(&filer2.Entry{}, nil) != "" {
+		t.Errorf("expected no hash")
+	}
+
+	for hash, valid := range map[string]bool{
+		contentHash: true,
+		"5891B5B522D5DF086D0FF0B110FBD9D21BB4FC7163AF34D08286A2E846F6BE03": false,
+		"5891b5":           false,
+		"../../etc/passwd": false,
+		"zz91b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03": false,
+	} {
+		if isValidContentHash(hash) != valid {
+			t.Errorf("%s valid should be %v", hash, valid)
+		}
+	}
+
+}
+
+func TestChunksIdentity(t *testing.T) {
+	chunks := []*filer_pb.FileChunk{{FileId: "3,01637037d6", Offset: 0, Size: 5}, {FileId: "3,02637037d6", Offset: 5, Size: 5}}
+	identity := chunksIdentity(chunks)
+
+	appended := append(chunks[:2:2], &filer_pb.FileChunk{FileId: "4,01637037d6", Offset: 10, Size: 5})
+	truncated := []*filer_pb.FileChunk{chunks[0], {FileId: "3,02637037d6", Offset: 5, Size: 3}}
+	replaced := []*filer_pb.FileChunk{chunks[0], {FileId: "5,01637037d6", Offset: 5, Size: 5}}
+	for name, changed := range map[string][]*filer_pb.FileChunk{"appended": appended, "truncated": truncated, "replaced": replaced} {
+		if bytes.Equal(chunksIdentity(changed), identity) {
+			t.Errorf("identity of %s chunks is unchanged", name)
+		}
+	}
+	if !bytes.Equal(chunksIdentity([]*filer_pb.FileChunk{{FileId: "3,01637037d6", Size: 5}, {FileId: "3,02637037d6", Offset: 5, Size: 5}}), identity) {
+		t.Errorf("identity of the same chunks changed")
+	}
+
+	extended := map[string][]byte{casSha256Key: []byte("5891b5"), "user": []byte("x")}
+	if kept := dropContentHash(extended); len(kept) != 1 || kept["user"] == nil || extended[casSha256Key] == nil {
+		t.Errorf("drop content hash: %v from %v", kept, extended)
+	}
+}
@@ -0,0 +1,148 @@
+package weed_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/delta"
+)
+
+// The delta manifest of a file, for the clients to download only the changed blocks:
+//
+//	GET /path/to/file?delta=manifest&blockSize=1048576
+//
+// returns the size and the block checksums of the file as json, see util/delta.
+// The manifest is computed by reading the whole file once, and kept in /.delta/<key> for a while,
+// where the key is derived from the file chunks and the block size,
+// so a changed file gets a new manifest.
+// On the readonly port, the saved manifest is served, or the manifest is computed without being saved.
+
+const (
+	deltaFolder     = "/.delta"
+	deltaExpiration = 7 * 24 * time.Hour
+)
+
+func isDeltaManifestRequest(r *http.Request) bool {
+	return r.URL.Query().Get("delta") == "manifest"
+}
+
+// readonlyRequestKey marks the requests received on the readonly port
+type readonlyRequestKey struct{}
+
+func isReadonlyRequest(r *http.Request) bool {
+	readonly, _ := r.Context().Value(readonlyRequestKey{}).(bool)
+	return readonly
+}
+
+func (fs *FilerServer) deltaManifestHandler(w http.ResponseWriter, r *http.Request, entry *filer2.Entry) {
+	stats.FilerRequestCounter.WithLabelValues("deltaManifest").Inc()
+
+	blockSize := int64(delta.DefaultBlockSize)
+	if value := r.URL.Query().Get("blockSize"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < delta.MinBlockSize || parsed > delta.MaxBlockSize {
+			writeJsonError(w, r, http.StatusBadRequest, fmt.Errorf("blockSize should be between %d and %d", delta.MinBlockSize, delta.MaxBlockSize))
+			return
+		}
+		blockSize = parsed
+	}
+
+	data, err := fs.loadDeltaManifest(context.Background(), entry, blockSize, !isReadonlyRequest(r))
+	if err != nil {
+		glog.Errorf("delta manifest of %s: %v", entry.FullPath, err)
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method != "HEAD" {
+		w.Write(data)
+	}
+}
+
+// loadDeltaManifest reads the saved manifest, or computes it, and saves it if asked to
+func (fs *FilerServer) loadDeltaManifest(ctx context.Context, entry *filer2.Entry, blockSize int64, save bool) ([]byte, error) {
+	manifestPath := util.FullPath(deltaFolder).Child(deltaManifestKey(entry.Chunks, blockSize))
+	if manifestEntry, err := fs.filer.FindEntry(ctx, manifestPath); err == nil {
+		var buf bytes.Buffer
+		if err = filer2.StreamContent(fs.filer.MasterClient, &buf, manifestEntry.Chunks, 0, int64(manifestEntry.Size())); err == nil {
+			return buf.Bytes(), nil
+		}
+		glog.V(0).Infof("read delta manifest %s: %v", manifestPath, err)
+	} else if err != filer_pb.ErrNotFound {
+		return nil, err
+	}
+
+	mw := delta.NewManifestWriter(blockSize)
+	if err := filer2.StreamContent(fs.filer.MasterClient, mw, entry.Chunks, 0, int64(entry.Size())); err != nil {
+		return nil, fmt.Errorf("read %s: %v", entry.FullPath, err)
+	}
+	manifest := mw.Manifest()
+	if manifest.Size != int64(entry.Size()) {
+		return nil, fmt.Errorf("read %s: %d of %d bytes", entry.FullPath, manifest.Size, entry.Size())
+	}
+	manifest.Etag = filer2.ETagEntry(entry)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if !save {
+		return data, nil
+	}
+	if err = fs.saveDeltaManifest(ctx, manifestPath, data); err != nil {
+		glog.Errorf("save delta manifest %s of %s: %v", manifestPath, entry.FullPath, err)
+	}
+	return data, nil
+}
+
+func (fs *FilerServer) saveDeltaManifest(ctx context.Context, manifestPath util.FullPath, data []byte) error {
+	_, _, fsync := fs.detectCollection(deltaFolder, "", "")
+	chunk, _, _, err := fs.saveAsChunk(ctx, "", "", fs.option.DataCenter, "", fsync)(bytes.NewReader(data), manifestPath.Name(), 0)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return fs.filer.CreateEntry(ctx, &filer2.Entry{
+		FullPath: manifestPath,
+		Attr: filer2.Attr{
+			Mtime:  now,
+			Crtime: now,
+			Mode:   0660,
+			Uid:    OS_UID,
+			Gid:    OS_GID,
+			Mime:   "application/json",
+		},
+		Chunks: []*filer_pb.FileChunk{chunk},
+	}, false, false)
+}
+
+// deltaManifestKey identifies the content by the chunks, since a chunk file id is never reused
+func deltaManifestKey(chunks []*filer_pb.FileChunk, blockSize int64) string {
+	h := sha256.New()
+	var buf [8]byte
+	for _, chunk := range chunks {
+		h.Write([]byte(chunk.GetFileIdString()))
+		binary.BigEndian.PutUint64(buf[:], uint64(chunk.Offset))
+		h.Write(buf[:])
+		binary.BigEndian.PutUint64(buf[:], chunk.Size)
+		h.Write(buf[:])
+	}
+	binary.BigEndian.PutUint64(buf[:], uint64(blockSize))
+	h.Write(buf[:])
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,246 @@
+package weed_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/websocket"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+/*
+Change notifications for the clients that do not speak gRPC, e.g., browser dashboards.
+
+	GET /.events?pathPrefix=/some/dir&sinceNs=1600000000000000000
+
+streams the same metadata events as the gRPC SubscribeMetadata, one JSON object per event:
+
+	{"tsNs":1600000000000000000,"type":"rename","directory":"/some/dir","path":"/some/dir/a.txt","newPath":"/some/dir/b.txt","oldEntry":{...},"newEntry":{...}}
+
+It is a WebSocket if the request asks to upgrade, and Server-Sent Events otherwise.
+The id of each Server-Sent Event is the tsNs, so a reconnecting EventSource continues after the "Last-Event-ID".
+*/
+
+const eventsUrlPrefix = "/.events"
+
+type filerEvent struct {
+	TsNs      int64           `json:"tsNs"`
+	Type      string          `json:"type"`
+	Directory string          `json:"directory"`
+	Path      string          `json:"path"`
+	NewPath   string          `json:"newPath,omitempty"`
+	OldEntry  json.RawMessage `json:"oldEntry,omitempty"`
+	NewEntry  json.RawMessage `json:"newEntry,omitempty"`
+}
+
+func (fs *FilerServer) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := parseEventsRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats.FilerRequestCounter.WithLabelValues("events").Inc()
+
+	if r.Header.Get("Upgrade") == "websocket" {
+		websocket.Handler(func(conn *websocket.Conn) {
+			fs.streamEventsToWebSocket(conn, req)
+		}).ServeHTTP(w, r)
+		return
+	}
+	fs.streamEventsToSse(w, r, req)
+}
+
+func parseEventsRequest(r *http.Request) (*filer_pb.SubscribeMetadataRequest, error) {
+	req := &filer_pb.SubscribeMetadataRequest{
+		ClientName: r.FormValue("clientName"),
+		PathPrefix: r.FormValue("pathPrefix"),
+	}
+	if req.ClientName == "" {
+		req.ClientName = "events"
+	}
+	if req.PathPrefix == "" {
+		req.PathPrefix = "/"
+	}
+
+	since := r.FormValue("sinceNs")
+	if lastEventId := r.Header.Get("Last-Event-ID"); lastEventId != "" {
+		since = lastEventId
+	}
+	if since == "" {
+		req.SinceNs = time.Now().UnixNano()
+		return req, nil
+	}
+	sinceNs, err := strconv.ParseInt(since, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinceNs %s", since)
+	}
+	if r.Header.Get("Last-Event-ID") != "" {
+		// continue after the last received event
+		sinceNs++
+	}
+	req.SinceNs = sinceNs
+	return req, nil
+}
+
+func (fs *FilerServer) streamEventsToSse(w http.ResponseWriter, r *http.Request, req *filer_pb.SubscribeMetadataRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err := fs.subscribeEvents(r.Context(), req, r.RemoteAddr, func(event *filerEvent, data []byte) error {
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.TsNs, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		glog.V(1).Infof("events to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+func (fs *FilerServer) streamEventsToWebSocket(conn *websocket.Conn, req *filer_pb.SubscribeMetadataRequest) {
+	defer conn.Close()
+
+	// a hijacked connection is not canceled by the http server, so watch for the client to close it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		var ignored string
+		for {
+			if err := websocket.Message.Receive(conn, &ignored); err != nil {
+				return
+			}
+		}
+	}()
+
+	err := fs.subscribeEvents(ctx, req, conn.Request().RemoteAddr, func(event *filerEvent, data []byte) error {
+		return websocket.Message.Send(conn, string(data))
+	})
+	if err != nil {
+		glog.V(1).Infof("events to %s: %v", conn.Request().RemoteAddr, err)
+	}
+}
+
+// subscribeEvents reads the metadata events like SubscribeMetadata, until the context is done or sendFn fails
+func (fs *FilerServer) subscribeEvents(ctx context.Context, req *filer_pb.SubscribeMetadataRequest, peerAddress string, sendFn func(event *filerEvent, data []byte) error) error {
+
+	clientName := fs.addClient(req.ClientName, peerAddress)
+
+	defer fs.deleteClient(clientName)
+
+	lastReadTime := time.Unix(0, req.SinceNs)
+	glog.V(0).Infof(" %v starts to watch events %s from %+v", clientName, req.PathPrefix, lastReadTime)
+
+	eachEventNotificationFn := eachEventNotificationFn(req, func(message *filer_pb.SubscribeMetadataResponse) error {
+		event, err := toFilerEvent(message)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return sendFn(event, data)
+	}, clientName)
+
+	eachLogEntryFn := eachLogEntryFn(eachEventNotificationFn)
+
+	processedTsNs, err := fs.filer.ReadPersistedLogBuffer(lastReadTime, eachLogEntryFn)
+	if err != nil {
+		return fmt.Errorf("reading from persisted logs: %v", err)
+	}
+
+	if processedTsNs != 0 {
+		lastReadTime = time.Unix(0, processedTsNs)
+	}
+
+	// wake up the waiting loop below when the client is gone
+	go func() {
+		<-ctx.Done()
+		fs.filer.MetaAggregator.ListenersLock.Lock()
+		fs.filer.MetaAggregator.ListenersCond.Broadcast()
+		fs.filer.MetaAggregator.ListenersLock.Unlock()
+	}()
+
+	return fs.filer.MetaAggregator.MetaLogBuffer.LoopProcessLogData(lastReadTime, func() bool {
+		fs.filer.MetaAggregator.ListenersLock.Lock()
+		if ctx.Err() == nil {
+			fs.filer.MetaAggregator.ListenersCond.Wait()
+		}
+		fs.filer.MetaAggregator.ListenersLock.Unlock()
+		return ctx.Err() == nil
+	}, eachLogEntryFn)
+
+}
+
+func toFilerEvent(message *filer_pb.SubscribeMetadataResponse) (event *filerEvent, err error) {
+	notification := message.EventNotification
+	event = &filerEvent{
+		TsNs:      message.TsNs,
+		Directory: message.Directory,
+	}
+
+	m := jsonpb.Marshaler{}
+	if notification.OldEntry != nil {
+		event.Path = string(util.NewFullPath(message.Directory, notification.OldEntry.Name))
+		if event.OldEntry, err = marshalEventEntry(m, notification.OldEntry); err != nil {
+			return nil, err
+		}
+	}
+	if notification.NewEntry != nil {
+		newPath := string(util.NewFullPath(message.Directory, notification.NewEntry.Name))
+		if notification.NewParentPath != "" {
+			newPath = string(util.NewFullPath(notification.NewParentPath, notification.NewEntry.Name))
+		}
+		if event.Path == "" {
+			event.Path = newPath
+		} else if newPath != event.Path {
+			event.NewPath = newPath
+		}
+		if event.NewEntry, err = marshalEventEntry(m, notification.NewEntry); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case notification.OldEntry == nil:
+		event.Type = "create"
+	case notification.NewEntry == nil:
+		event.Type = "delete"
+	case event.NewPath != "":
+		event.Type = "rename"
+	default:
+		event.Type = "update"
+	}
+	return event, nil
+}
+
+func marshalEventEntry(m jsonpb.Marshaler, entry *filer_pb.Entry) (json.RawMessage, error) {
+	s, err := m.MarshalToString(entry)
+	if err != nil {
+		return nil, fmt.Errorf("marshal entry %s: %v", entry.Name, err)
+	}
+	return json.RawMessage(s), nil
+}
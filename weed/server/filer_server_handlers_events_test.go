@@ -0,0 +1,37 @@
+package weed_server
+
+import (
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestToFilerEvent(t *testing.T) {
+
+	cases := []struct {
+		notification *filer_pb.EventNotification
+		eventType    string
+		path         string
+		newPath      string
+	}{
+		{&filer_pb.EventNotification{NewEntry: &filer_pb.Entry{Name: "a"}}, "create", "/dir/a", ""},
+		{&filer_pb.EventNotification{OldEntry: &filer_pb.Entry{Name: "a"}}, "delete", "/dir/a", ""},
+		{&filer_pb.EventNotification{OldEntry: &filer_pb.Entry{Name: "a"}, NewEntry: &filer_pb.Entry{Name: "a"}}, "update", "/dir/a", ""},
+		{&filer_pb.EventNotification{OldEntry: &filer_pb.Entry{Name: "a"}, NewEntry: &filer_pb.Entry{Name: "a"}, NewParentPath: "/dir"}, "update", "/dir/a", ""},
+		{&filer_pb.EventNotification{OldEntry: &filer_pb.Entry{Name: "a"}, NewEntry: &filer_pb.Entry{Name: "b"}, NewParentPath: "/other"}, "rename", "/dir/a", "/other/b"},
+	}
+	for _, c := range cases {
+		event, err := toFilerEvent(&filer_pb.SubscribeMetadataResponse{
+			Directory:         "/dir",
+			EventNotification: c.notification,
+			TsNs:              1,
+		})
+		if err != nil {
+			t.Fatalf("convert %+v: %v", c.notification, err)
+		}
+		if event.Type != c.eventType || event.Path != c.path || event.NewPath != c.newPath {
+			t.Errorf("expected %s %s %s, got %s %s %s", c.eventType, c.path, c.newPath, event.Type, event.Path, event.NewPath)
+		}
+	}
+
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request, isGetMethod bool) {
@@ -38,7 +39,7 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request,
 			stats.FilerRequestCounter.WithLabelValues("read.notfound").Inc()
 			w.WriteHeader(http.StatusNotFound)
 		} else {
-			glog.V(0).Infof("Internal %s: %v", path, err)
+			glog.V(0).Infof("Internal %s request %s: %v", path, request_id.Get(r.Context()), err)
 			stats.FilerRequestCounter.WithLabelValues("read.internalerror").Inc()
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -59,6 +60,18 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if isDeltaManifestRequest(r) {
+		fs.deltaManifestHandler(w, r, entry)
+		return
+	}
+
+	fs.writeEntryContent(w, r, entry)
+}
+
+func (fs *FilerServer) writeEntryContent(w http.ResponseWriter, r *http.Request, entry *filer2.Entry) {
+
+	path := string(entry.FullPath)
+
 	if len(entry.Chunks) == 0 {
 		glog.V(1).Infof("no file chunks for %s, attr=%+v", path, entry.Attr)
 		stats.FilerRequestCounter.WithLabelValues("read.nocontent").Inc()
@@ -117,7 +130,7 @@ func (fs *FilerServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request,
 		if shouldResize {
 			data, err := filer2.ReadAll(fs.filer.MasterClient, entry.Chunks)
 			if err != nil {
-				glog.Errorf("failed to read %s: %v", path, err)
+				glog.Errorf("failed to read %s request %s: %v", path, request_id.Get(r.Context()), err)
 				w.WriteHeader(http.StatusNotModified)
 				return
 			}
@@ -0,0 +1,523 @@
+package weed_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// The tus resumable upload protocol 1.0.0, https://tus.io/protocols/resumable-upload.html
+//
+// POST /.tus/path/to/file creates an upload to /path/to/file, and returns the upload url /.tus/.uploads/<id>.
+// The uploaded data is kept as the chunks of the /.tus/<id> entry, which becomes /path/to/file after the last PATCH.
+
+const (
+	tusResumable         = "1.0.0"
+	tusUrlPrefix         = "/.tus"
+	tusUploadUrlPrefix   = "/.tus/.uploads/"
+	tusUploadsFolder     = "/.tus"
+	tusOffsetContentType = "application/offset+octet-stream"
+	tusExpiration        = 24 * time.Hour
+	tusDefaultChunkSize  = 4 * 1024 * 1024
+	tusChecksumMismatch  = 460
+
+	tusExtendedLength   = "tus.length"
+	tusExtendedTarget   = "tus.target"
+	tusExtendedMetadata = "tus.metadata"
+)
+
+type tusUpload struct {
+	id       string
+	entry    *filer2.Entry
+	length   int64
+	offset   int64
+	target   string
+	metadata map[string]string
+}
+
+func (fs *FilerServer) tusHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	stats.FilerRequestCounter.WithLabelValues("tus").Inc()
+	defer func() { stats.FilerRequestHistogram.WithLabelValues("tus").Observe(time.Since(start).Seconds()) }()
+
+	w.Header().Set("Tus-Resumable", tusResumable)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Checksum-Algorithm, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires")
+
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Tus-Version", tusResumable)
+		w.Header().Set("Tus-Extension", "creation,creation-with-upload,termination,checksum,expiration")
+		w.Header().Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset, Upload-Checksum, X-HTTP-Method-Override")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusResumable {
+		w.Header().Set("Tus-Version", tusResumable)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" {
+		method = override
+	}
+
+	if !strings.HasPrefix(r.URL.Path, tusUploadUrlPrefix) {
+		if method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fs.tusCreate(w, r)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, tusUploadUrlPrefix)
+	switch method {
+	case "HEAD":
+		fs.tusHead(w, r, id)
+	case "PATCH":
+		fs.tusPatch(w, r, id)
+	case "DELETE":
+		fs.tusDelete(w, r, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (fs *FilerServer) tusCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target := strings.TrimPrefix(r.URL.Path, tusUrlPrefix)
+	if strings.HasSuffix(target, "/") && metadata["filename"] != "" {
+		target += path.Base(metadata["filename"])
+	}
+	if target == "" || strings.HasSuffix(target, "/") || strings.HasPrefix(target, tusUploadsFolder+"/") {
+		http.Error(w, "invalid target file "+target, http.StatusBadRequest)
+		return
+	}
+
+	id, err := newUploadId()
+	if err != nil {
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	query := r.URL.Query()
+	collection, replication, _ := fs.detectCollection(target, query.Get("collection"), query.Get("replication"))
+	now := time.Now()
+	entry := &filer2.Entry{
+		FullPath: util.FullPath(tusUploadsFolder).Child(id),
+		Attr: filer2.Attr{
+			Mtime:       now,
+			Crtime:      now,
+			Mode:        0660,
+			Uid:         OS_UID,
+			Gid:         OS_GID,
+			Replication: replication,
+			Collection:  collection,
+			Mime:        tusContentType(metadata),
+		},
+		Extended: map[string][]byte{
+			tusExtendedLength:   []byte(strconv.FormatInt(length, 10)),
+			tusExtendedTarget:   []byte(target),
+			tusExtendedMetadata: []byte(r.Header.Get("Upload-Metadata")),
+		},
+	}
+	if err = fs.filer.CreateEntry(ctx, entry, true, false); err != nil {
+		glog.Errorf("tus create %s: %v", target, err)
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	glog.V(1).Infof("tus upload %s to %s, %d bytes", id, target, length)
+
+	upload := &tusUpload{id: id, entry: entry, length: length, target: target, metadata: metadata}
+	w.Header().Set("Location", tusUploadUrlPrefix+id)
+	w.Header().Set("Upload-Expires", now.Add(tusExpiration).UTC().Format(http.TimeFormat))
+
+	// creation-with-upload
+	if r.Header.Get("Content-Type") == tusOffsetContentType {
+		if !fs.lockUpload(id) {
+			w.WriteHeader(http.StatusLocked)
+			return
+		}
+		defer fs.unlockUpload(id)
+		if status, err := fs.tusAppend(ctx, r, upload); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+	} else if length == 0 {
+		if err = fs.tusFinish(ctx, upload); err != nil {
+			writeJsonError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (fs *FilerServer) tusHead(w http.ResponseWriter, r *http.Request, id string) {
+	upload, err := fs.loadTusUpload(context.Background(), id)
+	if err != nil {
+		fs.writeTusLoadError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.length, 10))
+	w.Header().Set("Upload-Expires", upload.entry.Crtime.Add(tusExpiration).UTC().Format(http.TimeFormat))
+	if metadata := upload.entry.Extended[tusExtendedMetadata]; len(metadata) > 0 {
+		w.Header().Set("Upload-Metadata", string(metadata))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (fs *FilerServer) tusPatch(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := context.Background()
+
+	if r.Header.Get("Content-Type") != tusOffsetContentType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	if !fs.lockUpload(id) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	defer fs.unlockUpload(id)
+
+	upload, err := fs.loadTusUpload(ctx, id)
+	if err != nil {
+		fs.writeTusLoadError(w, r, err)
+		return
+	}
+	if offset != upload.offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if status, err := fs.tusAppend(ctx, r, upload); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+	w.Header().Set("Upload-Expires", upload.entry.Crtime.Add(tusExpiration).UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fs *FilerServer) tusDelete(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := context.Background()
+	if !fs.lockUpload(id) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	defer fs.unlockUpload(id)
+
+	upload, err := fs.loadTusUpload(ctx, id)
+	if err != nil {
+		fs.writeTusLoadError(w, r, err)
+		return
+	}
+	if err = fs.filer.DeleteEntryMetaAndData(ctx, upload.entry.FullPath, false, false, true, false); err != nil {
+		writeJsonError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusAppend saves the request body to the upload, and finishes the upload if all data is received.
+// Without a checksum, the data received before an interrupted request is still kept.
+func (fs *FilerServer) tusAppend(ctx context.Context, r *http.Request, upload *tusUpload) (int, error) {
+	checksum, expected, err := parseTusChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	target := upload.target
+	_, _, fsync := fs.detectCollection(target, "", "")
+	dataCenter := fs.option.DataCenter
+	chunkSize := tusDefaultChunkSize
+	if fs.option.MaxMB > 0 {
+		chunkSize = fs.option.MaxMB * 1024 * 1024
+	}
+	saveFn := fs.saveAsChunk(ctx, upload.entry.Replication, upload.entry.Collection, dataCenter, "", fsync)
+
+	var chunks []*filer_pb.FileChunk
+	var received int64
+	var readErr error
+	buf := make([]byte, chunkSize)
+	for upload.offset+received < upload.length {
+		size := int64(chunkSize)
+		if remaining := upload.length - upload.offset - received; remaining < size {
+			size = remaining
+		}
+		n, err := io.ReadFull(r.Body, buf[:size])
+		if n > 0 {
+			if checksum != nil {
+				checksum.Write(buf[:n])
+			}
+			chunk, _, _, uploadErr := saveFn(bytes.NewReader(buf[:n]), path.Base(target), upload.offset+received)
+			if uploadErr != nil {
+				fs.filer.DeleteChunks(chunks)
+				glog.Errorf("tus upload %s: %v", upload.id, uploadErr)
+				return http.StatusInternalServerError, fmt.Errorf("upload data: %v", uploadErr)
+			}
+			chunks = append(chunks, chunk)
+			received += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	if checksum != nil && (readErr != nil || !bytes.Equal(checksum.Sum(nil), expected)) {
+		fs.filer.DeleteChunks(chunks)
+		if readErr != nil {
+			return http.StatusBadRequest, fmt.Errorf("read body: %v", readErr)
+		}
+		return tusChecksumMismatch, fmt.Errorf("checksum mismatch")
+	}
+
+	if len(chunks) > 0 {
+		upload.entry.Chunks = append(upload.entry.Chunks, chunks...)
+		upload.entry.Mtime = time.Now()
+		if err := fs.filer.CreateEntry(ctx, upload.entry, false, false); err != nil {
+			fs.filer.DeleteChunks(chunks)
+			glog.Errorf("tus save %s: %v", upload.id, err)
+			return http.StatusInternalServerError, err
+		}
+		upload.offset += received
+	}
+	if readErr != nil {
+		glog.V(0).Infof("tus upload %s interrupted at %d: %v", upload.id, upload.offset, readErr)
+		return http.StatusBadRequest, fmt.Errorf("read body: %v", readErr)
+	}
+
+	if upload.offset == upload.length {
+		if err := fs.tusFinish(ctx, upload); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusNoContent, nil
+}
+
+// tusFinish moves the chunks of the upload to the target file
+func (fs *FilerServer) tusFinish(ctx context.Context, upload *tusUpload) error {
+	_, _, fsync := fs.detectCollection(upload.target, "", "")
+	chunks, err := filer2.MaybeManifestize(fs.saveAsChunk(ctx, upload.entry.Replication, upload.entry.Collection, fs.option.DataCenter, "", fsync), upload.entry.Chunks)
+	if err != nil {
+		return fmt.Errorf("manifestize %s: %v", upload.target, err)
+	}
+
+	now := time.Now()
+	entry := &filer2.Entry{
+		FullPath: util.FullPath(upload.target),
+		Attr: filer2.Attr{
+			Mtime:       now,
+			Crtime:      now,
+			Mode:        0660,
+			Uid:         OS_UID,
+			Gid:         OS_GID,
+			Replication: upload.entry.Replication,
+			Collection:  upload.entry.Collection,
+			Mime:        upload.entry.Mime,
+		},
+		Chunks: chunks,
+	}
+	if err = fs.filer.CreateEntry(ctx, entry, false, false); err != nil {
+		return fmt.Errorf("create %s: %v", upload.target, err)
+	}
+	if err = fs.filer.DeleteEntryMetaAndData(ctx, upload.entry.FullPath, false, false, false, false); err != nil {
+		glog.Errorf("tus delete finished upload %s: %v", upload.entry.FullPath, err)
+	}
+	glog.V(1).Infof("tus upload %s finished as %s", upload.id, upload.target)
+	return nil
+}
+
+func (fs *FilerServer) loadTusUpload(ctx context.Context, id string) (*tusUpload, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, filer_pb.ErrNotFound
+	}
+	entry, err := fs.filer.FindEntry(ctx, util.FullPath(tusUploadsFolder).Child(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry.Crtime.Add(tusExpiration).Before(time.Now()) {
+		fs.filer.DeleteEntryMetaAndData(ctx, entry.FullPath, false, false, true, false)
+		return nil, filer_pb.ErrNotFound
+	}
+	length, err := strconv.ParseInt(string(entry.Extended[tusExtendedLength]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("upload %s: invalid length: %v", id, err)
+	}
+	metadata, _ := parseTusMetadata(string(entry.Extended[tusExtendedMetadata]))
+	return &tusUpload{
+		id:       id,
+		entry:    entry,
+		length:   length,
+		offset:   int64(filer2.TotalSize(entry.Chunks)),
+		target:   string(entry.Extended[tusExtendedTarget]),
+		metadata: metadata,
+	}, nil
+}
+
+func (fs *FilerServer) writeTusLoadError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == filer_pb.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJsonError(w, r, http.StatusInternalServerError, err)
+}
+
+// lockUpload returns false if the upload is being changed by another request
+func (fs *FilerServer) lockUpload(id string) bool {
+	fs.uploadLocksLock.Lock()
+	defer fs.uploadLocksLock.Unlock()
+	if fs.uploadLocks[id] {
+		return false
+	}
+	fs.uploadLocks[id] = true
+	return true
+}
+
+func (fs *FilerServer) unlockUpload(id string) {
+	fs.uploadLocksLock.Lock()
+	delete(fs.uploadLocks, id)
+	fs.uploadLocksLock.Unlock()
+}
+
+// loopCleanUploads deletes the expired uploads, or other temporary files, in the folder and their data
+func (fs *FilerServer) loopCleanUploads(folder util.FullPath, expiration time.Duration) {
+	for range time.Tick(time.Hour) {
+		ctx := context.Background()
+		var expired []util.FullPath
+		lastFileName := ""
+		for {
+			entries, err := fs.filer.ListDirectoryEntries(ctx, folder, lastFileName, false, 1024)
+			if err != nil {
+				glog.V(1).Infof("list uploads in %s: %v", folder, err)
+				break
+			}
+			for _, entry := range entries {
+				if entry.Crtime.Add(expiration).Before(time.Now()) {
+					expired = append(expired, entry.FullPath)
+				}
+				lastFileName = entry.Name()
+			}
+			if len(entries) < 1024 {
+				break
+			}
+		}
+		for _, p := range expired {
+			glog.V(0).Infof("delete expired upload %s", p)
+			if err := fs.filer.DeleteEntryMetaAndData(ctx, p, false, false, true, false); err != nil {
+				glog.Errorf("delete expired upload %s: %v", p, err)
+			}
+		}
+	}
+}
+
+func newUploadId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate upload id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseTusMetadata parses the Upload-Metadata header, e.g. "filename d29ybGQudHh0,is_confidential"
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		if len(parts) == 1 {
+			metadata[parts[0]] = ""
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata %s: %v", parts[0], err)
+		}
+		metadata[parts[0]] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseTusChecksum parses the Upload-Checksum header, e.g. "sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0="
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum %s", header)
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Upload-Checksum %s: %v", header, err)
+	}
+	switch parts[0] {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported checksum algorithm %s", parts[0])
+}
+
+func tusContentType(metadata map[string]string) string {
+	if contentType := metadata["filetype"]; contentType != "" {
+		return contentType
+	}
+	return metadata["content-type"]
+}
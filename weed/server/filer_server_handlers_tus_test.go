@@ -0,0 +1,245 @@
+package weed_server
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/filer2/leveldb2"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	metadata, err := parseTusMetadata("filename d29ybGQudHh0, filetype dGV4dC9wbGFpbg==,is_confidential")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if metadata["filename"] != "world.txt" || tusContentType(metadata) != "text/plain" {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	if _, found := metadata["is_confidential"]; !found {
+		t.Errorf("key without value is missing")
+	}
+	if _, err = parseTusMetadata("filename !!!"); err == nil {
+		t.Errorf("invalid base64 accepted")
+	}
+}
+
+func TestParseTusChecksum(t *testing.T) {
+	h, expected, err := parseTusChecksum("sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0=")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	h.Write([]byte("hello world"))
+	if string(h.Sum(nil)) != string(expected) {
+		t.Errorf("sha1 of hello world does not match")
+	}
+	if h, _, err = parseTusChecksum(""); h != nil || err != nil {
+		t.Errorf("empty checksum header: %v %v", h, err)
+	}
+	if _, _, err = parseTusChecksum("crc32 AAAA"); err == nil {
+		t.Errorf("unsupported algorithm accepted")
+	}
+}
+
+// tusTestMaster assigns the file ids on one volume server
+type tusTestMaster struct {
+	master_pb.UnimplementedSeaweedServer
+	volumeUrl string
+	fileKey   uint64
+}
+
+func (m *tusTestMaster) KeepConnected(stream master_pb.Seaweed_KeepConnectedServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return nil
+		}
+	}
+}
+
+func (m *tusTestMaster) Assign(ctx context.Context, req *master_pb.AssignRequest) (*master_pb.AssignResponse, error) {
+	return &master_pb.AssignResponse{
+		Fid:   fmt.Sprintf("3,%x12345678", atomic.AddUint64(&m.fileKey, 1)),
+		Url:   m.volumeUrl,
+		Count: 1,
+	}, nil
+}
+
+// newTusTestServer starts a filer with a leveldb2 store, a master, and a volume server counting the uploaded chunks
+func newTusTestServer(t *testing.T) (fs *FilerServer, uploads *int32, stop func()) {
+	dir, _ := ioutil.TempDir("", "tus_upload")
+	store := &leveldb.LevelDB2Store{}
+	config := viper.New()
+	config.Set("dir", dir)
+	if err := store.Initialize(config, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	uploads = new(int32)
+	volumeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(uploads, 1)
+		r.ParseMultipartForm(1024 * 1024)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		json.NewEncoder(w).Encode(&operation.UploadResult{Size: uint32(len(data))})
+	}))
+	master := &tusTestMaster{volumeUrl: strings.TrimPrefix(volumeServer.URL, "http://")}
+	masterGrpcServer, masterUrl := serveGrpc(t, func(s *grpc.Server) { master_pb.RegisterSeaweedServer(s, master) })
+
+	fs = &FilerServer{
+		option:         &FilerOption{},
+		grpcDialOption: grpc.WithInsecure(),
+		filer:          filer2.NewFiler([]string{masterUrl}, grpc.WithInsecure(), "", 0, "", "", nil),
+		uploadLocks:    make(map[string]bool),
+	}
+	fs.filer.SetStore(store)
+	fs.filer.DisableDirectoryCache()
+	fs.filer.DirBucketsPath = "/buckets"
+	go fs.filer.MasterClient.KeepConnectedToMaster()
+	for i := 0; fs.filer.GetMaster() == "" && i < 100; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fs, uploads, func() {
+		masterGrpcServer.Stop()
+		volumeServer.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func tusRequest(fs *FilerServer, method, path string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Tus-Resumable", tusResumable)
+	for k, v := range headers {
+		if v == "" {
+			r.Header.Del(k)
+		} else {
+			r.Header.Set(k, v)
+		}
+	}
+	w := httptest.NewRecorder()
+	fs.tusHandler(w, r)
+	return w
+}
+
+func TestTusResumableHeader(t *testing.T) {
+	fs := &FilerServer{option: &FilerOption{}}
+	for _, version := range []string{"", "0.2.2"} {
+		w := tusRequest(fs, "POST", "/.tus/docs/a.txt", map[string]string{"Tus-Resumable": version, "Upload-Length": "5"}, "")
+		if w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != tusResumable {
+			t.Errorf("Tus-Resumable %q: %d, Tus-Version %q", version, w.Code, w.Header().Get("Tus-Version"))
+		}
+	}
+	if w := tusRequest(fs, "OPTIONS", "/.tus/docs/a.txt", map[string]string{"Tus-Resumable": ""}, ""); w.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS without Tus-Resumable: %d", w.Code)
+	}
+}
+
+func TestTusPatch(t *testing.T) {
+	fs, uploads, stop := newTusTestServer(t)
+	defer stop()
+	if fs.filer.GetMaster() == "" {
+		t.Fatalf("not connected to the master")
+	}
+	patch := func(location string, offset int, body, checksum string) *httptest.ResponseRecorder {
+		return tusRequest(fs, "PATCH", location, map[string]string{
+			"Content-Type":    tusOffsetContentType,
+			"Upload-Offset":   fmt.Sprint(offset),
+			"Upload-Checksum": checksum,
+		}, body)
+	}
+
+	w := tusRequest(fs, "POST", "/.tus/docs/hello.txt", map[string]string{"Upload-Length": "11"}, "")
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusCreated || !strings.HasPrefix(location, tusUploadUrlPrefix) {
+		t.Fatalf("create: %d %q", w.Code, location)
+	}
+	id := strings.TrimPrefix(location, tusUploadUrlPrefix)
+
+	if w = patch(location, 0, "hello ", ""); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "6" {
+		t.Fatalf("patch: %d offset %q %s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+
+	// the offset is resumed from the saved chunks
+	upload, err := fs.loadTusUpload(context.Background(), id)
+	if err != nil || upload.offset != 6 || upload.length != 11 || upload.target != "/docs/hello.txt" {
+		t.Fatalf("load upload: %+v %v", upload, err)
+	}
+
+	// the client retries the same data
+	if w = patch(location, 0, "hello ", ""); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "6" {
+		t.Errorf("patch at a wrong offset: %d offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// the received data is dropped if the checksum does not match
+	sum := sha1.Sum([]byte("world"))
+	checksum := "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+	uploadsBefore := atomic.LoadInt32(uploads)
+	if w = patch(location, 6, "w0rld", checksum); w.Code != tusChecksumMismatch {
+		t.Errorf("patch with a checksum mismatch: %d", w.Code)
+	}
+	if atomic.LoadInt32(uploads) == uploadsBefore {
+		t.Errorf("the data is not uploaded before the checksum is verified")
+	}
+	if upload, err = fs.loadTusUpload(context.Background(), id); err != nil || upload.offset != 6 || len(upload.entry.Chunks) != 1 {
+		t.Errorf("upload after a checksum mismatch: %+v %v", upload, err)
+	}
+
+	if w = patch(location, 6, "world", checksum); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("patch the rest: %d offset %q %s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+	entry, err := fs.filer.FindEntry(context.Background(), util.FullPath("/docs/hello.txt"))
+	if err != nil || entry.Size() != 11 || len(entry.Chunks) != 2 {
+		t.Errorf("finished file: %+v %v", entry, err)
+	}
+	if _, err = fs.loadTusUpload(context.Background(), id); err != filer_pb.ErrNotFound {
+		t.Errorf("finished upload is kept: %v", err)
+	}
+}
+
+func TestTusUploadExpired(t *testing.T) {
+	fs, _, stop := newTusTestServer(t)
+	defer stop()
+
+	w := tusRequest(fs, "POST", "/.tus/docs/old.txt", map[string]string{"Upload-Length": "5"}, "")
+	id := strings.TrimPrefix(w.Header().Get("Location"), tusUploadUrlPrefix)
+	upload, err := fs.loadTusUpload(context.Background(), id)
+	if err != nil {
+		t.Fatalf("load upload: %v", err)
+	}
+	upload.entry.Crtime = time.Now().Add(-tusExpiration - time.Minute)
+	if err = fs.filer.CreateEntry(context.Background(), upload.entry, false, false); err != nil {
+		t.Fatalf("update upload: %v", err)
+	}
+
+	if _, err = fs.loadTusUpload(context.Background(), id); err != filer_pb.ErrNotFound {
+		t.Errorf("load expired upload: %v", err)
+	}
+	if _, err = fs.filer.FindEntry(context.Background(), upload.entry.FullPath); err != filer_pb.ErrNotFound {
+		t.Errorf("expired upload is kept: %v", err)
+	}
+	if w = tusRequest(fs, "HEAD", tusUploadUrlPrefix+id, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD expired upload: %d", w.Code)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var (
@@ -33,14 +34,15 @@ var (
 )
 
 type FilerPostResult struct {
-	Name  string `json:"name,omitempty"`
-	Size  int64  `json:"size,omitempty"`
-	Error string `json:"error,omitempty"`
-	Fid   string `json:"fid,omitempty"`
-	Url   string `json:"url,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Fid    string `json:"fid,omitempty"`
+	Url    string `json:"url,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
 }
 
-func (fs *FilerServer) assignNewFileInfo(replication, collection, dataCenter, ttlString string, fsync bool) (fileId, urlLocation string, auth security.EncodedJwt, err error) {
+func (fs *FilerServer) assignNewFileInfo(ctx context.Context, replication, collection, dataCenter, ttlString string, fsync bool) (fileId, urlLocation string, auth security.EncodedJwt, err error) {
 
 	stats.FilerRequestCounter.WithLabelValues("assign").Inc()
 	start := time.Now()
@@ -64,16 +66,23 @@ func (fs *FilerServer) assignNewFileInfo(replication, collection, dataCenter, tt
 		}
 	}
 
-	assignResult, ae := operation.Assign(fs.filer.GetMaster(), fs.grpcDialOption, ar, altRequest)
+	assignResult, ae := operation.Assign(ctx, fs.filer.GetMaster(), fs.grpcDialOption, ar, altRequest)
 	if ae != nil {
-		glog.Errorf("failing to assign a file id: %v", ae)
+		glog.Errorf("failing to assign a file id for request %s: %v", request_id.Get(ctx), ae)
 		err = ae
 		return
 	}
 	fileId = assignResult.Fid
 	urlLocation = "http://" + assignResult.Url + "/" + assignResult.Fid
+	q := url.Values{}
 	if fsync {
-		urlLocation += "?fsync=true"
+		q.Set("fsync", "true")
+	}
+	if writeAck, found := fs.option.collectionWriteAcks[collection]; found {
+		q.Set("ack", writeAck)
+	}
+	if len(q) > 0 {
+		urlLocation += "?" + q.Encode()
 	}
 	auth = assignResult.Auth
 	return
@@ -113,10 +122,10 @@ func (fs *FilerServer) PostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileId, urlLocation, auth, err := fs.assignNewFileInfo(replication, collection, dataCenter, ttlString, fsync)
+	fileId, urlLocation, auth, err := fs.assignNewFileInfo(r.Context(), replication, collection, dataCenter, ttlString, fsync)
 
 	if err != nil || fileId == "" || urlLocation == "" {
-		glog.V(0).Infof("fail to allocate volume for %s, collection:%s, datacenter:%s", r.URL.Path, collection, dataCenter)
+		glog.V(0).Infof("fail to allocate volume for %s request %s, collection:%s, datacenter:%s", r.URL.Path, request_id.Get(r.Context()), collection, dataCenter)
 		writeJsonError(w, r, http.StatusInternalServerError, fmt.Errorf("fail to allocate volume for %s, collection:%s, datacenter:%s", r.URL.Path, collection, dataCenter))
 		return
 	}
@@ -124,22 +133,24 @@ func (fs *FilerServer) PostHandler(w http.ResponseWriter, r *http.Request) {
 	glog.V(4).Infof("write %s to %v", r.URL.Path, urlLocation)
 
 	u, _ := url.Parse(urlLocation)
-	ret, md5value, err := fs.uploadToVolumeServer(r, u, auth, w, fileId)
+	ret, md5value, sha256value, err := fs.uploadToVolumeServer(r, u, auth, w, fileId)
 	if err != nil {
 		return
 	}
 
-	if err = fs.updateFilerStore(ctx, r, w, replication, collection, ret, md5value, fileId, ttlSeconds); err != nil {
+	contentHash, err := fs.updateFilerStore(ctx, r, w, replication, collection, ret, md5value, sha256value, fileId, ttlSeconds)
+	if err != nil {
 		return
 	}
 
 	// send back post result
 	reply := FilerPostResult{
-		Name:  ret.Name,
-		Size:  int64(ret.Size),
-		Error: ret.Error,
-		Fid:   fileId,
-		Url:   urlLocation,
+		Name:   ret.Name,
+		Size:   int64(ret.Size),
+		Error:  ret.Error,
+		Fid:    fileId,
+		Url:    urlLocation,
+		Sha256: contentHash,
 	}
 	setEtag(w, ret.ETag)
 	writeJsonQuiet(w, r, http.StatusCreated, reply)
@@ -147,7 +158,7 @@ func (fs *FilerServer) PostHandler(w http.ResponseWriter, r *http.Request) {
 
 // update metadata in filer store
 func (fs *FilerServer) updateFilerStore(ctx context.Context, r *http.Request, w http.ResponseWriter, replication string,
-	collection string, ret *operation.UploadResult, md5value []byte, fileId string, ttlSeconds int32) (err error) {
+	collection string, ret *operation.UploadResult, md5value []byte, sha256value []byte, fileId string, ttlSeconds int32) (contentHash string, err error) {
 
 	stats.FilerRequestCounter.WithLabelValues("postStoreWrite").Inc()
 	start := time.Now()
@@ -202,20 +213,22 @@ func (fs *FilerServer) updateFilerStore(ctx context.Context, r *http.Request, w
 			entry.Attr.Mime = mime.TypeByExtension(ext)
 		}
 	}
+	contentHash = setContentHash(entry, sha256value)
 	// glog.V(4).Infof("saving %s => %+v", path, entry)
 	if dbErr := fs.filer.CreateEntry(ctx, entry, false, false); dbErr != nil {
 		fs.filer.DeleteChunks(entry.Chunks)
-		glog.V(0).Infof("failing to write %s to filer server : %v", path, dbErr)
+		glog.V(0).Infof("failing to write %s request %s to filer server : %v", path, request_id.Get(r.Context()), dbErr)
 		writeJsonError(w, r, http.StatusInternalServerError, dbErr)
 		err = dbErr
 		return
 	}
+	fs.indexContent(ctx, entry)
 
-	return nil
+	return contentHash, nil
 }
 
 // send request to volume server
-func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth security.EncodedJwt, w http.ResponseWriter, fileId string) (ret *operation.UploadResult, md5value []byte, err error) {
+func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth security.EncodedJwt, w http.ResponseWriter, fileId string) (ret *operation.UploadResult, md5value []byte, sha256value []byte, err error) {
 
 	stats.FilerRequestCounter.WithLabelValues("postUpload").Inc()
 	start := time.Now()
@@ -229,6 +242,13 @@ func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth se
 		// only PUT or large chunked files has Md5 in attributes
 		body = ioutil.NopCloser(io.TeeReader(r.Body, md5Hash))
 	}
+	// the content hash of a multipart upload is computed in autoChunk()
+	contentHash := fs.newContentHash()
+	if contentHash != nil && isRawUpload(r) {
+		body = ioutil.NopCloser(io.TeeReader(body, contentHash))
+	} else {
+		contentHash = nil
+	}
 
 	request := &http.Request{
 		Method:        r.Method,
@@ -247,7 +267,7 @@ func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth se
 	}
 	resp, doErr := util.Do(request)
 	if doErr != nil {
-		glog.Errorf("failing to connect to volume server %s: %v, %+v", r.RequestURI, doErr, r.Method)
+		glog.Errorf("failing to connect to volume server %s request %s: %v, %+v", r.RequestURI, request_id.Get(r.Context()), doErr, r.Method)
 		writeJsonError(w, r, http.StatusInternalServerError, doErr)
 		err = doErr
 		return
@@ -259,7 +279,7 @@ func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth se
 
 	respBody, raErr := ioutil.ReadAll(resp.Body)
 	if raErr != nil {
-		glog.V(0).Infoln("failing to upload to volume server", r.RequestURI, raErr.Error())
+		glog.V(0).Infoln("failing to upload to volume server", r.RequestURI, "request", request_id.Get(r.Context()), raErr.Error())
 		writeJsonError(w, r, http.StatusInternalServerError, raErr)
 		err = raErr
 		return
@@ -268,14 +288,14 @@ func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth se
 	glog.V(4).Infoln("post result", string(respBody))
 	unmarshalErr := json.Unmarshal(respBody, &ret)
 	if unmarshalErr != nil {
-		glog.V(0).Infoln("failing to read upload resonse", r.RequestURI, string(respBody))
+		glog.V(0).Infoln("failing to read upload resonse", r.RequestURI, "request", request_id.Get(r.Context()), string(respBody))
 		writeJsonError(w, r, http.StatusInternalServerError, unmarshalErr)
 		err = unmarshalErr
 		return
 	}
 	if ret.Error != "" {
 		err = errors.New(ret.Error)
-		glog.V(0).Infoln("failing to post to volume server", r.RequestURI, ret.Error)
+		glog.V(0).Infoln("failing to post to volume server", r.RequestURI, "request", request_id.Get(r.Context()), ret.Error)
 		writeJsonError(w, r, http.StatusInternalServerError, err)
 		return
 	}
@@ -296,6 +316,9 @@ func (fs *FilerServer) uploadToVolumeServer(r *http.Request, u *url.URL, auth se
 	if r.Method == "PUT" {
 		md5value = md5Hash.Sum(nil)
 	}
+	if contentHash != nil {
+		sha256value = contentHash.Sum(nil)
+	}
 	ret.ETag = getEtag(resp)
 	return
 }
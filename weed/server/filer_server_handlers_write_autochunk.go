@@ -1,14 +1,18 @@
 package weed_server
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/filer2"
@@ -18,11 +22,12 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 func (fs *FilerServer) autoChunk(ctx context.Context, w http.ResponseWriter, r *http.Request,
 	replication string, collection string, dataCenter string, ttlSec int32, ttlString string, fsync bool) bool {
-	if r.Method != "POST" {
+	if r.Method != "POST" && r.Method != "PUT" {
 		glog.V(4).Infoln("AutoChunking not supported for method", r.Method)
 		return false
 	}
@@ -46,7 +51,8 @@ func (fs *FilerServer) autoChunk(ctx context.Context, w http.ResponseWriter, r *
 	contentLength := int64(0)
 	if contentLengthHeader := r.Header["Content-Length"]; len(contentLengthHeader) == 1 {
 		contentLength, _ = strconv.ParseInt(contentLengthHeader[0], 10, 64)
-		if contentLength <= int64(chunkSize) {
+		// small multipart uploads are also parsed here to compute the content hash
+		if contentLength <= int64(chunkSize) && !(fs.option.ContentAddressable && isMultipartUpload(r)) {
 			glog.V(4).Infoln("Content-Length of", contentLength, "is less than the chunk size of", chunkSize, "so autoChunking will be skipped.")
 			return false
 		}
@@ -75,64 +81,50 @@ func (fs *FilerServer) doAutoChunk(ctx context.Context, w http.ResponseWriter, r
 		stats.FilerRequestHistogram.WithLabelValues("postAutoChunk").Observe(time.Since(start).Seconds())
 	}()
 
-	multipartReader, multipartReaderErr := r.MultipartReader()
-	if multipartReaderErr != nil {
-		return nil, multipartReaderErr
-	}
-
-	part1, part1Err := multipartReader.NextPart()
-	if part1Err != nil {
-		return nil, part1Err
-	}
-
-	fileName := part1.FileName()
-	if fileName != "" {
-		fileName = path.Base(fileName)
-	}
-	contentType := part1.Header.Get("Content-Type")
-
-	var fileChunks []*filer_pb.FileChunk
-
-	md5Hash := md5.New()
-	var partReader = ioutil.NopCloser(io.TeeReader(part1, md5Hash))
-
-	chunkOffset := int64(0)
-
-	for chunkOffset < contentLength {
-		limitedReader := io.LimitReader(partReader, int64(chunkSize))
-
-		// assign one file id for one chunk
-		fileId, urlLocation, auth, assignErr := fs.assignNewFileInfo(replication, collection, dataCenter, ttlString, fsync)
-		if assignErr != nil {
-			return nil, assignErr
+	var fileName, contentType string
+	var dataReader io.Reader
+	if isRawUpload(r) {
+		// the file name is in the path
+		if strings.HasSuffix(r.URL.Path, "/") {
+			return nil, fmt.Errorf("can not to write to folder %s without a file name", r.URL.Path)
 		}
-
-		// upload the chunk to the volume server
-		uploadResult, uploadErr := fs.doUpload(urlLocation, w, r, limitedReader, fileName, contentType, nil, auth)
-		if uploadErr != nil {
-			return nil, uploadErr
+		dataReader, contentType = r.Body, r.Header.Get("Content-Type")
+	} else {
+		multipartReader, multipartReaderErr := r.MultipartReader()
+		if multipartReaderErr != nil {
+			return nil, multipartReaderErr
 		}
 
-		// if last chunk exhausted the reader exactly at the border
-		if uploadResult.Size == 0 {
-			break
+		part1, part1Err := multipartReader.NextPart()
+		if part1Err != nil {
+			return nil, part1Err
 		}
 
-		// Save to chunk manifest structure
-		fileChunks = append(fileChunks, uploadResult.ToPbFileChunk(fileId, chunkOffset))
+		fileName = part1.FileName()
+		if fileName != "" {
+			fileName = path.Base(fileName)
+		}
+		contentType = part1.Header.Get("Content-Type")
+		dataReader = part1
+	}
 
-		glog.V(4).Infof("uploaded %s chunk %d to %s [%d,%d) of %d", fileName, len(fileChunks), fileId, chunkOffset, chunkOffset+int64(uploadResult.Size), contentLength)
+	md5Hash := md5.New()
+	var partReader = ioutil.NopCloser(io.TeeReader(dataReader, md5Hash))
+	contentHash := fs.newContentHash()
+	if contentHash != nil {
+		partReader = ioutil.NopCloser(io.TeeReader(partReader, contentHash))
+	}
 
-		// reset variables for the next chunk
-		chunkOffset = chunkOffset + int64(uploadResult.Size)
+	// the chunks grow from the chunk size
+	maxChunkSize := int64(fs.option.ChunkMaxMB) * 1024 * 1024
+	sizer := filer2.NewChunkSizer(int64(chunkSize), maxChunkSize, contentLength)
 
-		// if last chunk was not at full chunk size, but already exhausted the reader
-		if int64(uploadResult.Size) < int64(chunkSize) {
-			break
-		}
+	fileChunks, chunkOffset, uploadErr := fs.uploadChunks(w, r, partReader, contentLength, sizer, fileName, contentType, replication, collection, dataCenter, ttlString, fsync)
+	if uploadErr != nil {
+		return nil, uploadErr
 	}
 
-	fileChunks, replyerr = filer2.MaybeManifestize(fs.saveAsChunk(replication, collection, dataCenter, ttlString, fsync), fileChunks)
+	fileChunks, replyerr = filer2.MaybeManifestize(fs.saveAsChunk(ctx, replication, collection, dataCenter, ttlString, fsync), fileChunks)
 	if replyerr != nil {
 		glog.V(0).Infof("manifestize %s: %v", r.RequestURI, replyerr)
 		return
@@ -167,6 +159,9 @@ func (fs *FilerServer) doAutoChunk(ctx context.Context, w http.ResponseWriter, r
 		Name: fileName,
 		Size: chunkOffset,
 	}
+	if contentHash != nil {
+		filerResult.Sha256 = setContentHash(entry, contentHash.Sum(nil))
+	}
 
 	if dbErr := fs.filer.CreateEntry(ctx, entry, false, false); dbErr != nil {
 		fs.filer.DeleteChunks(entry.Chunks)
@@ -175,10 +170,111 @@ func (fs *FilerServer) doAutoChunk(ctx context.Context, w http.ResponseWriter, r
 		glog.V(0).Infof("failing to write %s to filer server : %v", path, dbErr)
 		return
 	}
+	fs.indexContent(ctx, entry)
 
 	return
 }
 
+// uploadChunks reads the chunks one by one in the sizes by the sizer, and uploads them to the volume servers in parallel.
+// At most ChunkUploadConcurrency chunks of one request are being uploaded,
+// and the chunks being uploaded of all requests take at most ChunkUploadBufferMB memory.
+func (fs *FilerServer) uploadChunks(w http.ResponseWriter, r *http.Request, reader io.Reader, contentLength int64, sizer *filer2.ChunkSizer,
+	fileName string, contentType string, replication string, collection string, dataCenter string, ttlString string, fsync bool) (fileChunks []*filer_pb.FileChunk, chunkOffset int64, err error) {
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var uploadErr error
+	concurrency := fs.option.ChunkUploadConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	limiter := make(chan struct{}, concurrency)
+
+	for chunkOffset < contentLength {
+		limiter <- struct{}{}
+		chunkSize := sizer.Next()
+		// the last chunk only takes the memory of the remaining content
+		if remaining := contentLength - chunkOffset; chunkSize > remaining {
+			chunkSize = remaining
+		}
+		fs.chunkUploadBuffer.acquire(chunkSize)
+		buf := make([]byte, chunkSize)
+		n, readErr := io.ReadFull(reader, buf)
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			readErr = nil
+		}
+		lock.Lock()
+		if uploadErr == nil {
+			uploadErr = readErr
+		}
+		failed := uploadErr != nil
+		lock.Unlock()
+		// if last chunk exhausted the reader exactly at the border
+		if failed || n == 0 {
+			fs.chunkUploadBuffer.release(chunkSize)
+			<-limiter
+			break
+		}
+
+		wg.Add(1)
+		go func(offset int64, data []byte) {
+			defer func() {
+				fs.chunkUploadBuffer.release(chunkSize)
+				<-limiter
+				wg.Done()
+			}()
+			start := time.Now()
+			chunk, err := fs.uploadChunk(w, r, data, offset, fileName, contentType, replication, collection, dataCenter, ttlString, fsync)
+			sizer.Observe(int64(len(data)), time.Since(start))
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				if uploadErr == nil {
+					uploadErr = err
+				}
+				return
+			}
+			fileChunks = append(fileChunks, chunk)
+			glog.V(4).Infof("uploaded %s chunk %d to %s [%d,%d) of %d", fileName, len(fileChunks), chunk.FileId, offset, offset+int64(chunk.Size), contentLength)
+		}(chunkOffset, buf[:n])
+
+		chunkOffset += int64(n)
+
+		// if last chunk was not at full chunk size, but already exhausted the reader
+		if int64(n) < chunkSize {
+			break
+		}
+	}
+	wg.Wait()
+
+	if uploadErr != nil {
+		fs.filer.DeleteChunks(fileChunks)
+		return nil, 0, uploadErr
+	}
+	sort.Slice(fileChunks, func(i, j int) bool {
+		return fileChunks[i].Offset < fileChunks[j].Offset
+	})
+	return fileChunks, chunkOffset, nil
+}
+
+func (fs *FilerServer) uploadChunk(w http.ResponseWriter, r *http.Request, data []byte, offset int64,
+	fileName string, contentType string, replication string, collection string, dataCenter string, ttlString string, fsync bool) (*filer_pb.FileChunk, error) {
+
+	// assign one file id for one chunk
+	fileId, urlLocation, auth, assignErr := fs.assignNewFileInfo(r.Context(), replication, collection, dataCenter, ttlString, fsync)
+	if assignErr != nil {
+		return nil, assignErr
+	}
+
+	// upload the chunk to the volume server
+	uploadResult, uploadErr := fs.doUpload(urlLocation, w, r, bytes.NewReader(data), fileName, contentType, nil, auth)
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	return uploadResult.ToPbFileChunk(fileId, offset), nil
+}
+
 func (fs *FilerServer) doUpload(urlLocation string, w http.ResponseWriter, r *http.Request, limitedReader io.Reader, fileName string, contentType string, pairMap map[string]string, auth security.EncodedJwt) (*operation.UploadResult, error) {
 
 	stats.FilerRequestCounter.WithLabelValues("postAutoChunkUpload").Inc()
@@ -187,15 +283,22 @@ func (fs *FilerServer) doUpload(urlLocation string, w http.ResponseWriter, r *ht
 		stats.FilerRequestHistogram.WithLabelValues("postAutoChunkUpload").Observe(time.Since(start).Seconds())
 	}()
 
+	if id := request_id.Get(r.Context()); id != "" {
+		if pairMap == nil {
+			pairMap = make(map[string]string)
+		}
+		pairMap[request_id.Header] = id
+	}
+
 	uploadResult, err, _ := operation.Upload(urlLocation, fileName, fs.option.Cipher, limitedReader, false, contentType, pairMap, auth)
 	return uploadResult, err
 }
 
-func (fs *FilerServer) saveAsChunk(replication string, collection string, dataCenter string, ttlString string, fsync bool) filer2.SaveDataAsChunkFunctionType {
+func (fs *FilerServer) saveAsChunk(ctx context.Context, replication string, collection string, dataCenter string, ttlString string, fsync bool) filer2.SaveDataAsChunkFunctionType {
 
 	return func(reader io.Reader, name string, offset int64) (*filer_pb.FileChunk, string, string, error) {
 		// assign one file id for one chunk
-		fileId, urlLocation, auth, assignErr := fs.assignNewFileInfo(replication, collection, dataCenter, ttlString, fsync)
+		fileId, urlLocation, auth, assignErr := fs.assignNewFileInfo(ctx, replication, collection, dataCenter, ttlString, fsync)
 		if assignErr != nil {
 			return nil, "", "", assignErr
 		}
@@ -210,3 +313,40 @@ func (fs *FilerServer) saveAsChunk(replication string, collection string, dataCe
 	}
 }
 
+// uploadBuffer limits the memory of the chunks being uploaded
+type uploadBuffer struct {
+	limit int64
+	used  int64
+	cond  *sync.Cond
+}
+
+// newUploadBuffer creates a buffer of limit bytes, or an unlimited buffer if limit is not positive
+func newUploadBuffer(limit int64) *uploadBuffer {
+	return &uploadBuffer{
+		limit: limit,
+		cond:  sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+// acquire waits until there is enough memory, but one chunk can always be uploaded
+func (b *uploadBuffer) acquire(size int64) {
+	if b.limit <= 0 {
+		return
+	}
+	b.cond.L.Lock()
+	for b.used > 0 && b.used+size > b.limit {
+		b.cond.Wait()
+	}
+	b.used += size
+	b.cond.L.Unlock()
+}
+
+func (b *uploadBuffer) release(size int64) {
+	if b.limit <= 0 {
+		return
+	}
+	b.cond.L.Lock()
+	b.used -= size
+	b.cond.L.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,34 @@
+package weed_server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUploadBuffer(t *testing.T) {
+	b := newUploadBuffer(10)
+	b.acquire(6)
+
+	acquired := make(chan bool)
+	go func() {
+		b.acquire(6)
+		acquired <- true
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("acquired over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.release(6)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("not acquired after release")
+	}
+
+	// one chunk larger than the limit can still be uploaded
+	b.release(6)
+	b.acquire(20)
+	b.release(20)
+}
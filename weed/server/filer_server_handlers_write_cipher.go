@@ -19,7 +19,7 @@ import (
 func (fs *FilerServer) encrypt(ctx context.Context, w http.ResponseWriter, r *http.Request,
 	replication string, collection string, dataCenter string, ttlSeconds int32, ttlString string, fsync bool) (filerResult *FilerPostResult, err error) {
 
-	fileId, urlLocation, auth, err := fs.assignNewFileInfo(replication, collection, dataCenter, ttlString, fsync)
+	fileId, urlLocation, auth, err := fs.assignNewFileInfo(ctx, replication, collection, dataCenter, ttlString, fsync)
 
 	if err != nil || fileId == "" || urlLocation == "" {
 		return nil, fmt.Errorf("fail to allocate volume for %s, collection:%s, datacenter:%s", r.URL.Path, collection, dataCenter)
@@ -78,6 +78,10 @@ func (fs *FilerServer) encrypt(ctx context.Context, w http.ResponseWriter, r *ht
 		Name: pu.FileName,
 		Size: int64(pu.OriginalDataSize),
 	}
+	if contentHash := fs.newContentHash(); contentHash != nil {
+		contentHash.Write(uncompressedData)
+		filerResult.Sha256 = setContentHash(entry, contentHash.Sum(nil))
+	}
 
 	if dbErr := fs.filer.CreateEntry(ctx, entry, false, false); dbErr != nil {
 		fs.filer.DeleteChunks(entry.Chunks)
@@ -85,6 +89,7 @@ func (fs *FilerServer) encrypt(ctx context.Context, w http.ResponseWriter, r *ht
 		filerResult.Error = dbErr.Error()
 		return
 	}
+	fs.indexContent(ctx, entry)
 
 	return
 }
@@ -72,6 +72,7 @@ func (ms *MasterServer) SendHeartbeat(stream master_pb.Seaweed_SendHeartbeatServ
 				int(heartbeat.Port), heartbeat.PublicUrl,
 				int64(heartbeat.MaxVolumeCount))
 			glog.V(0).Infof("added volume server %v:%d", heartbeat.GetIp(), heartbeat.GetPort())
+			t.Events.Add(topology.EventServerJoined, dn.Url(), 0, "", fmt.Sprintf("dc %s rack %s", dcName, rackName))
 			if err := stream.Send(&master_pb.HeartbeatResponse{
 				VolumeSizeLimit:        uint64(ms.option.VolumeSizeLimitMB) * 1024 * 1024,
 				MetricsAddress:         ms.option.MetricsAddress,
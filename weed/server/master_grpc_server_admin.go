@@ -7,7 +7,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
 )
 
 /*
@@ -136,3 +138,13 @@ func (ms *MasterServer) ReleaseAdminToken(ctx context.Context, req *master_pb.Re
 	}
 	return resp, nil
 }
+
+func (ms *MasterServer) Profile(req *master_pb.ProfileRequest, stream master_pb.Seaweed_ProfileServer) error {
+
+	glog.V(0).Infof("collecting %s profile for %d seconds", req.ProfileName, req.Seconds)
+
+	return grace.WriteProfile(stream.Context(), profileStreamWriter(func(data []byte) error {
+		return stream.Send(&master_pb.ProfileResponse{Data: data})
+	}), req.ProfileName, int(req.Seconds))
+
+}
@@ -0,0 +1,44 @@
+package weed_server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/topology"
+)
+
+// TopologyEvents returns the topology changes recorded by this master.
+// It is not limited to the leader, since each master keeps its own history.
+func (ms *MasterServer) TopologyEvents(ctx context.Context, req *master_pb.TopologyEventsRequest) (*master_pb.TopologyEventsResponse, error) {
+
+	events := ms.Topo.Events.Query(req.SinceNs, req.UntilNs, func(event *topology.TopologyEvent) bool {
+		if req.Type != "" && !strings.HasPrefix(event.Type, req.Type) {
+			return false
+		}
+		if req.DataNode != "" && event.DataNode != req.DataNode {
+			return false
+		}
+		if req.VolumeId != 0 && event.VolumeId != req.VolumeId {
+			return false
+		}
+		if req.Collection != "" && event.Collection != req.Collection {
+			return false
+		}
+		return true
+	}, int(req.Limit))
+
+	resp := &master_pb.TopologyEventsResponse{}
+	for _, event := range events {
+		resp.Events = append(resp.Events, &master_pb.TopologyEventsResponse_Event{
+			TsNs:       event.TsNs,
+			Type:       event.Type,
+			DataNode:   event.DataNode,
+			VolumeId:   event.VolumeId,
+			Collection: event.Collection,
+			Detail:     event.Detail,
+		})
+	}
+
+	return resp, nil
+}
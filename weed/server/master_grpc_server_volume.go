@@ -3,24 +3,53 @@ package weed_server
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/chrislusf/raft"
 
+	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 	"github.com/chrislusf/seaweedfs/weed/topology"
+	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
+// the volume locations are sent in batches of this many volume ids
+const lookupVolumeBatchSize = 1000
+
 func (ms *MasterServer) LookupVolume(ctx context.Context, req *master_pb.LookupVolumeRequest) (*master_pb.LookupVolumeResponse, error) {
 
 	if !ms.Topo.IsLeader() {
 		return nil, raft.NotLeaderError
 	}
 
+	return ms.lookupVolumeLocations(req.VolumeIds, req.Collection), nil
+}
+
+func (ms *MasterServer) LookupVolumeStream(req *master_pb.LookupVolumeRequest, stream master_pb.Seaweed_LookupVolumeStreamServer) error {
+
+	if !ms.Topo.IsLeader() {
+		return raft.NotLeaderError
+	}
+
+	for start := 0; start < len(req.VolumeIds); start += lookupVolumeBatchSize {
+		stop := start + lookupVolumeBatchSize
+		if stop > len(req.VolumeIds) {
+			stop = len(req.VolumeIds)
+		}
+		if err := stream.Send(ms.lookupVolumeLocations(req.VolumeIds[start:stop], req.Collection)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ms *MasterServer) lookupVolumeLocations(vids []string, collection string) *master_pb.LookupVolumeResponse {
 	resp := &master_pb.LookupVolumeResponse{}
-	volumeLocations := ms.lookupVolumeId(req.VolumeIds, req.Collection)
+	volumeLocations := ms.lookupVolumeId(vids, collection)
 
 	for _, result := range volumeLocations {
 		var locations []*master_pb.Location
@@ -37,7 +66,7 @@ func (ms *MasterServer) LookupVolume(ctx context.Context, req *master_pb.LookupV
 		})
 	}
 
-	return resp, nil
+	return resp
 }
 
 func (ms *MasterServer) Assign(ctx context.Context, req *master_pb.AssignRequest) (*master_pb.AssignResponse, error) {
@@ -146,6 +175,49 @@ func (ms *MasterServer) VolumeList(ctx context.Context, req *master_pb.VolumeLis
 	return resp, nil
 }
 
+func (ms *MasterServer) VolumeListStream(req *master_pb.VolumeListRequest, stream master_pb.Seaweed_VolumeListStreamServer) error {
+
+	if !ms.Topo.IsLeader() {
+		return raft.NotLeaderError
+	}
+
+	return ms.Topo.StreamTopologyInfo(func(topologyInfo *master_pb.TopologyInfo) error {
+		return stream.Send(&master_pb.VolumeListResponse{
+			TopologyInfo:      topologyInfo,
+			VolumeSizeLimitMb: uint64(ms.option.VolumeSizeLimitMB),
+		})
+	})
+}
+
+func (ms *MasterServer) AssignEcVolume(ctx context.Context, req *master_pb.AssignEcVolumeRequest) (*master_pb.AssignEcVolumeResponse, error) {
+
+	if !ms.Topo.IsLeader() {
+		return nil, raft.NotLeaderError
+	}
+
+	dataNodes, err := ms.Topo.PickForEcShards()
+	if err != nil {
+		return nil, err
+	}
+	vid, err := ms.Topo.NextVolumeId()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &master_pb.AssignEcVolumeResponse{
+		VolumeId: uint32(vid),
+	}
+	for _, dn := range dataNodes {
+		resp.ShardLocations = append(resp.ShardLocations, &master_pb.Location{
+			Url:       dn.Url(),
+			PublicUrl: dn.PublicUrl,
+		})
+	}
+	glog.V(0).Infof("assign ec volume %d of collection %s to %v", vid, req.Collection, resp.ShardLocations)
+
+	return resp, nil
+}
+
 func (ms *MasterServer) LookupEcVolume(ctx context.Context, req *master_pb.LookupEcVolumeRequest) (*master_pb.LookupEcVolumeResponse, error) {
 
 	if !ms.Topo.IsLeader() {
@@ -184,6 +256,8 @@ func (ms *MasterServer) GetMasterConfiguration(ctx context.Context, req *master_
 	resp := &master_pb.GetMasterConfigurationResponse{
 		MetricsAddress:         ms.option.MetricsAddress,
 		MetricsIntervalSeconds: uint32(ms.option.MetricsIntervalSec),
+		Version:                util.Version(),
+		TsNs:                   time.Now().UnixNano(),
 	}
 
 	return resp, nil
@@ -44,6 +44,7 @@ type MasterOption struct {
 	DisableHttp             bool
 	MetricsAddress          string
 	MetricsIntervalSec      int
+	EventLogFile            string
 }
 
 type MasterServer struct {
@@ -105,6 +106,11 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 	}
 	ms.Topo = topology.NewTopology("topo", seq, uint64(ms.option.VolumeSizeLimitMB)*1024*1024, 5, replicationAsMin)
 	ms.vg = topology.NewDefaultVolumeGrowth()
+	if ms.option.EventLogFile != "" {
+		if err := ms.Topo.Events.Persist(ms.option.EventLogFile); err != nil {
+			glog.Warningf("topology events will not be persisted: %v", err)
+		}
+	}
 	glog.V(0).Infoln("Volume Size Limit is", ms.option.VolumeSizeLimitMB, "MB")
 
 	ms.guard = security.NewGuard(ms.option.WhiteList, signingKey, expiresAfterSec, readSigningKey, readExpiresAfterSec)
@@ -118,6 +124,7 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 		r.HandleFunc("/dir/status", ms.proxyToLeader(ms.guard.WhiteList(ms.dirStatusHandler)))
 		r.HandleFunc("/col/delete", ms.proxyToLeader(ms.guard.WhiteList(ms.collectionDeleteHandler)))
 		r.HandleFunc("/vol/grow", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeGrowHandler)))
+		r.HandleFunc("/vol/lookup", ms.guard.WhiteList(ms.volumeLookupHandler))
 		r.HandleFunc("/vol/status", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeStatusHandler)))
 		r.HandleFunc("/vol/vacuum", ms.proxyToLeader(ms.guard.WhiteList(ms.volumeVacuumHandler)))
 		r.HandleFunc("/submit", ms.guard.WhiteList(ms.submitFromMasterServerHandler))
@@ -133,6 +140,8 @@ func NewMasterServer(r *mux.Router, option *MasterOption, peers []string) *Maste
 
 	ms.startAdminScripts()
 
+	ms.startAlerting()
+
 	return ms
 }
 
@@ -142,6 +151,7 @@ func (ms *MasterServer) SetRaftServer(raftServer *RaftServer) {
 		glog.V(0).Infof("event: %+v", e)
 		if ms.Topo.RaftServer.Leader() != "" {
 			glog.V(0).Infoln("[", ms.Topo.RaftServer.Name(), "]", ms.Topo.RaftServer.Leader(), "becomes leader.")
+			ms.Topo.Events.Add(topology.EventLeaderChanged, "", 0, "", fmt.Sprintf("%v becomes leader", ms.Topo.RaftServer.Leader()))
 		}
 	})
 	ms.Topo.RaftServer.AddEventListener(raft.StateChangeEventType, func(e raft.Event) {
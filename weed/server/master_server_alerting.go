@@ -0,0 +1,130 @@
+package weed_server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/alerting"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func (ms *MasterServer) startAlerting() {
+
+	v := util.GetViper()
+	if !v.GetBool("master.alerting.enabled") {
+		return
+	}
+
+	v.SetDefault("master.alerting.interval_seconds", 60)
+	v.SetDefault("master.alerting.cooldown_minutes", 30)
+	v.SetDefault("master.alerting.disk_usage_percent", 90)
+	v.SetDefault("master.alerting.readonly_minutes", 30)
+	v.SetDefault("master.alerting.replication_lag_minutes", 60)
+
+	disabledRules := make(map[string]bool)
+	for _, rule := range v.GetStringSlice("master.alerting.disabled_rules") {
+		disabledRules[strings.TrimSpace(rule)] = true
+	}
+
+	checker := alerting.NewChecker(alerting.RuleOptions{
+		DiskUsagePercent: v.GetFloat64("master.alerting.disk_usage_percent"),
+		ReadOnlyDuration: time.Duration(v.GetInt("master.alerting.readonly_minutes")) * time.Minute,
+		ReplicaLag:       time.Duration(v.GetInt("master.alerting.replication_lag_minutes")) * time.Minute,
+		VolumeSizeLimit:  uint64(ms.option.VolumeSizeLimitMB) * 1024 * 1024,
+		DisabledRules:    disabledRules,
+	})
+
+	var notifiers []alerting.Notifier
+	if url := v.GetString("master.alerting.webhook.url"); url != "" {
+		notifiers = append(notifiers, alerting.NewWebhookNotifier(url))
+	}
+	if address := v.GetString("master.alerting.email.smtp_address"); address != "" {
+		notifiers = append(notifiers, alerting.NewEmailNotifier(
+			address,
+			v.GetString("master.alerting.email.username"),
+			v.GetString("master.alerting.email.password"),
+			v.GetString("master.alerting.email.from"),
+			v.GetStringSlice("master.alerting.email.to"),
+		))
+	}
+	if len(notifiers) == 0 {
+		glog.Warningf("master.alerting is enabled without any webhook or email configured")
+	}
+
+	engine := alerting.NewEngine(ms.option.Host, time.Duration(v.GetInt("master.alerting.cooldown_minutes"))*time.Minute, notifiers...)
+	interval := time.Duration(v.GetInt("master.alerting.interval_seconds")) * time.Second
+	glog.V(0).Infof("alerting every %v with %d notifiers", interval, len(notifiers))
+
+	go func() {
+		for range time.Tick(interval) {
+			if !ms.Topo.IsLeader() {
+				continue
+			}
+			topologyInfo := ms.Topo.ToTopologyInfo()
+			disks := ms.collectDiskStatuses(topologyInfo)
+			engine.Evaluate(checker.Check(topologyInfo, disks, time.Now()), time.Now())
+		}
+	}()
+}
+
+const (
+	alertingStatusConcurrency = 16
+	alertingStatusTimeout     = 10 * time.Second
+)
+
+// collectDiskStatuses asks the volume servers for their disk statuses in parallel.
+// The servers not responding in time are missing in the result.
+func (ms *MasterServer) collectDiskStatuses(topologyInfo *master_pb.TopologyInfo) map[string][]*volume_server_pb.DiskStatus {
+	var servers []string
+	for _, dc := range topologyInfo.DataCenterInfos {
+		for _, rack := range dc.RackInfos {
+			for _, dn := range rack.DataNodeInfos {
+				servers = append(servers, dn.Id)
+			}
+		}
+	}
+
+	disks := make(map[string][]*volume_server_pb.DiskStatus)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, alertingStatusConcurrency)
+	for _, server := range servers {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(server string) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			if statuses, err := ms.collectDiskStatus(server); err != nil {
+				glog.V(1).Infof("alerting get disk status from %s: %v", server, err)
+			} else {
+				mu.Lock()
+				disks[server] = statuses
+				mu.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+	return disks
+}
+
+func (ms *MasterServer) collectDiskStatus(server string) (statuses []*volume_server_pb.DiskStatus, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertingStatusTimeout)
+	defer cancel()
+	err = operation.WithVolumeServerClient(server, ms.grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+		resp, err := client.VolumeServerStatus(ctx, &volume_server_pb.VolumeServerStatusRequest{})
+		if err != nil {
+			return err
+		}
+		statuses = resp.DiskStatuses
+		return nil
+	})
+	return
+}
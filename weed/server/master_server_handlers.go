@@ -58,6 +58,17 @@ func (ms *MasterServer) dirLookupHandler(w http.ResponseWriter, r *http.Request)
 	writeJsonQuiet(w, r, httpStatus, location)
 }
 
+// volumeLookupHandler looks up all the "volumeId" values together, which can also be file ids.
+// Use POST for many volumes.
+func (ms *MasterServer) volumeLookupHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJsonError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	collection := r.FormValue("collection")
+	writeJsonQuiet(w, r, http.StatusOK, ms.lookupVolumeId(r.Form["volumeId"], collection))
+}
+
 // findVolumeLocation finds the volume location from master topo if it is leader,
 // or from master client if not leader
 func (ms *MasterServer) findVolumeLocation(collection, vid string) operation.LookupResult {
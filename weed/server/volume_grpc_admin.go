@@ -4,13 +4,21 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
 	"github.com/chrislusf/seaweedfs/weed/stats"
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/grace"
 )
 
 func (vs *VolumeServer) DeleteCollection(ctx context.Context, req *volume_server_pb.DeleteCollectionRequest) (*volume_server_pb.DeleteCollectionResponse, error) {
@@ -163,6 +171,8 @@ func (vs *VolumeServer) VolumeServerStatus(ctx context.Context, req *volume_serv
 	}
 
 	resp.MemoryStatus = stats.MemStat()
+	resp.Version = util.Version()
+	resp.TsNs = time.Now().UnixNano()
 
 	return resp, nil
 
@@ -182,19 +192,29 @@ func (vs *VolumeServer) VolumeNeedleStatus(ctx context.Context, req *volume_serv
 	var err error
 	hasVolume := vs.store.HasVolume(volumeId)
 	if !hasVolume {
-		_, hasEcVolume := vs.store.FindEcVolume(volumeId)
+		ecVolume, hasEcVolume := vs.store.FindEcVolume(volumeId)
 		if !hasEcVolume {
 			return nil, fmt.Errorf("volume not found %d", req.VolumeId)
 		}
+		if ecVolume.IsDeleted(n.Id) {
+			return nil, status.Errorf(codes.NotFound, "needle deleted %d", n.Id)
+		}
+		if _, size, findErr := ecVolume.FindNeedleFromEcx(n.Id); findErr == erasure_coding.NotFoundError || findErr == nil && size == types.TombstoneFileSize {
+			return nil, status.Errorf(codes.NotFound, "needle not found %d", n.Id)
+		}
 		count, err = vs.store.ReadEcShardNeedle(volumeId, n)
 	} else {
 		count, err = vs.store.ReadVolumeNeedle(volumeId, n)
+		if err == storage.ErrorNotFound || err == storage.ErrorDeleted {
+			// only the missing or deleted needles are reported as NotFound, so fs.verify can tell them from other failures
+			return nil, status.Errorf(codes.NotFound, "needle %d: %v", n.Id, err)
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
 	if count < 0 {
-		return nil, fmt.Errorf("needle not found %d", n.Id)
+		return nil, status.Errorf(codes.NotFound, "needle not found %d", n.Id)
 	}
 
 	resp.NeedleId = uint64(n.Id)
@@ -202,9 +222,43 @@ func (vs *VolumeServer) VolumeNeedleStatus(ctx context.Context, req *volume_serv
 	resp.Size = n.Size
 	resp.LastModified = n.LastModified
 	resp.Crc = n.Checksum.Value()
+	resp.DataSize = n.DataSize
+	resp.Etag = n.Etag()
+	resp.IsCompressed = n.IsCompressed()
 	if n.HasTtl() {
 		resp.Ttl = n.Ttl.String()
 	}
 	return resp, nil
 
 }
+
+func (vs *VolumeServer) Profile(req *volume_server_pb.ProfileRequest, stream volume_server_pb.VolumeServer_ProfileServer) error {
+
+	glog.V(0).Infof("collecting %s profile for %d seconds", req.ProfileName, req.Seconds)
+
+	return grace.WriteProfile(stream.Context(), profileStreamWriter(func(data []byte) error {
+		return stream.Send(&volume_server_pb.ProfileResponse{Data: data})
+	}), req.ProfileName, int(req.Seconds))
+
+}
+
+func (vs *VolumeServer) VolumeServerMaintenanceStatus(ctx context.Context, req *volume_server_pb.VolumeServerMaintenanceStatusRequest) (*volume_server_pb.VolumeServerMaintenanceStatusResponse, error) {
+
+	resp := &volume_server_pb.VolumeServerMaintenanceStatusResponse{}
+
+	for _, t := range stats.ListMaintenanceTasks() {
+		resp.Tasks = append(resp.Tasks, &volume_server_pb.VolumeServerMaintenanceStatusResponse_Task{
+			Type:           t.Type,
+			VolumeId:       t.VolumeId,
+			Collection:     t.Collection,
+			Phase:          t.Phase(),
+			ProcessedBytes: t.ProcessedBytes(),
+			TotalBytes:     t.TotalBytes(),
+			StartedAtNs:    t.StartTime.UnixNano(),
+			EtaSeconds:     int64(t.Eta().Seconds()),
+		})
+	}
+
+	return resp, nil
+
+}
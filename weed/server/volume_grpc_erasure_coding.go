@@ -15,6 +15,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/pb"
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage"
 	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
@@ -33,6 +34,12 @@ Steps to apply erasure coding to .dat .idx files
 5.   master stores vid -> [14]*DataNode
 6. client checks master. If all 14 slices are ready, delete the original .idx, .idx files
 
+Clients writing archival files can also encode the volume locally, skipping the replicated volume
+1. client call AssignEcVolume on master for a new volume id and the servers to hold the ec shards
+2. client encode the .dat and .idx files into the .ecx and .ec00 ~ .ec13 files
+3. client call VolumeEcShardsReceive to send the .ecx, .vif and the ec shards to each server
+4. client call VolumeEcShardsMount on the servers, which report the new ec files to the master
+
 */
 
 // VolumeEcShardsGenerate generates the .ecx and .ec00 ~ .ec13 files
@@ -50,12 +57,20 @@ func (vs *VolumeServer) VolumeEcShardsGenerate(ctx context.Context, req *volume_
 		return nil, fmt.Errorf("existing collection:%v unexpected input: %v", v.Collection, req.Collection)
 	}
 
+	progress := stats.NewMaintenanceTask("ec.encode", req.VolumeId, req.Collection)
+	defer progress.Done()
+
 	// write .ec00 ~ .ec13 files
-	if err := erasure_coding.WriteEcFiles(baseFileName); err != nil {
+	progress.SetPhase("encode")
+	if err := erasure_coding.WriteEcFiles(baseFileName, func(processed, total int64) {
+		progress.SetTotalBytes(total)
+		progress.SetProcessedBytes(processed)
+	}); err != nil {
 		return nil, fmt.Errorf("WriteEcFiles %s: %v", baseFileName, err)
 	}
 
 	// write .ecx file
+	progress.SetPhase("index")
 	if err := erasure_coding.WriteSortedFileFromIdx(baseFileName, ".ecx"); err != nil {
 		return nil, fmt.Errorf("WriteSortedFileFromIdx %s: %v", baseFileName, err)
 	}
@@ -116,7 +131,7 @@ func (vs *VolumeServer) VolumeEcShardsCopy(ctx context.Context, req *volume_serv
 
 		// copy ec data slices
 		for _, shardId := range req.ShardIds {
-			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, erasure_coding.ToExt(int(shardId)), false, false); err != nil {
+			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, erasure_coding.ToExt(int(shardId)), false, false, nil); err != nil {
 				return err
 			}
 		}
@@ -124,7 +139,7 @@ func (vs *VolumeServer) VolumeEcShardsCopy(ctx context.Context, req *volume_serv
 		if req.CopyEcxFile {
 
 			// copy ecx file
-			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, ".ecx", false, false); err != nil {
+			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, ".ecx", false, false, nil); err != nil {
 				return err
 			}
 			return nil
@@ -132,14 +147,14 @@ func (vs *VolumeServer) VolumeEcShardsCopy(ctx context.Context, req *volume_serv
 
 		if req.CopyEcjFile {
 			// copy ecj file
-			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, ".ecj", true, true); err != nil {
+			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, ".ecj", true, true, nil); err != nil {
 				return err
 			}
 		}
 
 		if req.CopyVifFile {
 			// copy vif file
-			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, ".vif", false, true); err != nil {
+			if err := vs.doCopyFile(client, true, req.Collection, req.VolumeId, math.MaxUint32, math.MaxInt64, baseFileName, ".vif", false, true, nil); err != nil {
 				return err
 			}
 		}
@@ -153,6 +168,116 @@ func (vs *VolumeServer) VolumeEcShardsCopy(ctx context.Context, req *volume_serv
 	return &volume_server_pb.VolumeEcShardsCopyResponse{}, nil
 }
 
+// VolumeEcShardsReceive saves the ec files streamed by a client, which encoded the volume itself.
+// The volume id must be new to this server, and the received files are removed if the stream fails.
+func (vs *VolumeServer) VolumeEcShardsReceive(stream volume_server_pb.VolumeServer_VolumeEcShardsReceiveServer) (err error) {
+
+	var baseFileName, ext string
+	var file *os.File
+	var createdFiles []string
+	closeFile := func() error {
+		if file == nil {
+			return nil
+		}
+		syncErr := file.Sync()
+		closeErr := file.Close()
+		file = nil
+		if syncErr != nil {
+			return fmt.Errorf("sync %s%s: %v", baseFileName, ext, syncErr)
+		}
+		return closeErr
+	}
+	defer func() {
+		closeFile()
+		if err != nil {
+			for _, createdFile := range createdFiles {
+				os.Remove(createdFile)
+			}
+		}
+	}()
+
+	for {
+		req, recvErr := stream.Recv()
+		if recvErr == io.EOF {
+			break
+		}
+		if recvErr != nil {
+			return recvErr
+		}
+		if baseFileName == "" {
+			glog.V(0).Infof("VolumeEcShardsReceive: volume %d collection %s", req.VolumeId, req.Collection)
+			if strings.ContainsAny(req.Collection, "/\\\x00") {
+				return fmt.Errorf("invalid collection %q", req.Collection)
+			}
+			if vs.hasVolumeFiles(req.Collection, needle.VolumeId(req.VolumeId)) {
+				return fmt.Errorf("volume %d already exists", req.VolumeId)
+			}
+			location := vs.store.FindFreeLocation()
+			if location == nil {
+				return fmt.Errorf("no space left")
+			}
+			baseFileName = storage.VolumeFileName(location.Directory, req.Collection, int(req.VolumeId))
+		}
+		if req.Ext != ext {
+			if !isReceivableEcFileExt(req.Ext) {
+				return fmt.Errorf("unexpected ec file %s", req.Ext)
+			}
+			if err = closeFile(); err != nil {
+				return err
+			}
+			ext = req.Ext
+			if file, err = os.OpenFile(baseFileName+ext, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+				return fmt.Errorf("create %s%s: %v", baseFileName, ext, err)
+			}
+			createdFiles = append(createdFiles, baseFileName+ext)
+		}
+		if _, err = file.Write(req.FileContent); err != nil {
+			return fmt.Errorf("write %s%s: %v", baseFileName, ext, err)
+		}
+	}
+
+	if err = closeFile(); err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&volume_server_pb.VolumeEcShardsReceiveResponse{})
+}
+
+// hasVolumeFiles checks the loaded volumes and the files on disk, including the unmounted ec shards
+func (vs *VolumeServer) hasVolumeFiles(collection string, vid needle.VolumeId) bool {
+	if vs.store.HasVolume(vid) {
+		return true
+	}
+	if _, found := vs.store.FindEcVolume(vid); found {
+		return true
+	}
+	exts := []string{".dat", ".idx", ".ecx", ".ecj", ".vif"}
+	for i := 0; i < erasure_coding.TotalShardsCount; i++ {
+		exts = append(exts, erasure_coding.ToExt(i))
+	}
+	for _, location := range vs.store.Locations {
+		baseFileName := storage.VolumeFileName(location.Directory, collection, int(vid))
+		for _, ext := range exts {
+			if util.FileExists(baseFileName + ext) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isReceivableEcFileExt(ext string) bool {
+	if ext == ".ecx" || ext == ".vif" {
+		return true
+	}
+	for i := 0; i < erasure_coding.TotalShardsCount; i++ {
+		if ext == erasure_coding.ToExt(i) {
+			return true
+		}
+	}
+	return false
+}
+
 // VolumeEcShardsDelete local delete the .ecx and some ec data slices if not needed
 // the shard should not be mounted before calling this.
 func (vs *VolumeServer) VolumeEcShardsDelete(ctx context.Context, req *volume_server_pb.VolumeEcShardsDeleteRequest) (*volume_server_pb.VolumeEcShardsDeleteResponse, error) {
@@ -271,7 +396,13 @@ func (vs *VolumeServer) VolumeEcShardRead(req *volume_server_pb.VolumeEcShardRea
 	}
 
 	if req.FileKey != 0 {
-		_, size, _ := ecVolume.FindNeedleFromEcx(types.Uint64ToNeedleId(req.FileKey))
+		needleId := types.Uint64ToNeedleId(req.FileKey)
+		if ecVolume.IsDeleted(needleId) {
+			return stream.Send(&volume_server_pb.VolumeEcShardReadResponse{
+				IsDeleted: true,
+			})
+		}
+		_, size, _ := ecVolume.FindNeedleFromEcx(needleId)
 		if size == types.TombstoneFileSize {
 			return stream.Send(&volume_server_pb.VolumeEcShardReadResponse{
 				IsDeleted: true,
@@ -0,0 +1,167 @@
+package weed_server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/client"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/security"
+	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
+)
+
+// ecTestMaster assigns the volume id and puts all the ec shards on one volume server
+type ecTestMaster struct {
+	master_pb.UnimplementedSeaweedServer
+	volumeId  uint32
+	volumeUrl string
+}
+
+func (m *ecTestMaster) KeepConnected(stream master_pb.Seaweed_KeepConnectedServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return nil
+		}
+	}
+}
+
+func (m *ecTestMaster) locations() (locations []*master_pb.Location) {
+	for i := 0; i < erasure_coding.TotalShardsCount; i++ {
+		locations = append(locations, &master_pb.Location{Url: m.volumeUrl, PublicUrl: m.volumeUrl})
+	}
+	return
+}
+
+func (m *ecTestMaster) AssignEcVolume(ctx context.Context, req *master_pb.AssignEcVolumeRequest) (*master_pb.AssignEcVolumeResponse, error) {
+	return &master_pb.AssignEcVolumeResponse{VolumeId: m.volumeId, ShardLocations: m.locations()}, nil
+}
+
+func (m *ecTestMaster) LookupEcVolume(ctx context.Context, req *master_pb.LookupEcVolumeRequest) (*master_pb.LookupEcVolumeResponse, error) {
+	resp := &master_pb.LookupEcVolumeResponse{VolumeId: req.VolumeId}
+	for shardId, location := range m.locations() {
+		resp.ShardIdLocations = append(resp.ShardIdLocations, &master_pb.LookupEcVolumeResponse_EcShardIdLocation{
+			ShardId:   uint32(shardId),
+			Locations: []*master_pb.Location{location},
+		})
+	}
+	return resp, nil
+}
+
+// serveGrpc listens on a random port, and returns the http address of the server, which is 10000 below the grpc port
+func serveGrpc(t *testing.T, register func(*grpc.Server)) (*grpc.Server, string) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if port <= 10000 {
+		listener.Close()
+		t.Skipf("grpc port %d is too low to derive the http port", port)
+	}
+	grpcServer := grpc.NewServer()
+	register(grpcServer)
+	go grpcServer.Serve(listener)
+	return grpcServer, fmt.Sprintf("localhost:%d", port-10000)
+}
+
+func TestEcWriterRoundTrip(t *testing.T) {
+
+	volumeDir, _ := ioutil.TempDir("", "ec_volume")
+	defer os.RemoveAll(volumeDir)
+	localDir, _ := ioutil.TempDir("", "ec_local")
+	defer os.RemoveAll(localDir)
+
+	vs := &VolumeServer{
+		grpcDialOption: grpc.WithInsecure(),
+		guard:          security.NewGuard(nil, "", 0, "", 0),
+	}
+	volumeGrpcServer, volumeUrl := serveGrpc(t, func(s *grpc.Server) { volume_server_pb.RegisterVolumeServerServer(s, vs) })
+	defer volumeGrpcServer.Stop()
+	master := &ecTestMaster{volumeId: 7, volumeUrl: volumeUrl}
+	masterGrpcServer, masterUrl := serveGrpc(t, func(s *grpc.Server) { master_pb.RegisterSeaweedServer(s, master) })
+	defer masterGrpcServer.Stop()
+
+	vs.store = storage.NewStore(vs.grpcDialOption, 0, "localhost", volumeUrl, []string{volumeDir}, []int{10}, []float32{0}, storage.NeedleMapInMemory, 0, false)
+	vs.store.MasterAddress = masterUrl
+	go func() {
+		for range vs.store.NewEcShardsChan {
+		}
+	}()
+
+	c := client.New(&client.Option{Masters: []string{masterUrl}, Collection: "archive"})
+	writer := c.NewEcWriter(localDir, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	contents := map[string]string{"a.txt": "hello", "b.txt": strings.Repeat("ec ", 1000)}
+	fileIds := make(map[string]string)
+	for name, content := range contents {
+		result, err := writer.Write(ctx, name, []byte(content))
+		if err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		fileIds[name] = result.FileId
+	}
+
+	// the volume id is taken on this server, so the shards are refused, and the local volume is kept
+	blocking := storage.VolumeFileName(volumeDir, "archive", 7) + ".dat"
+	ioutil.WriteFile(blocking, []byte("existing"), 0644)
+	err := writer.Flush(ctx)
+	flushErr, ok := err.(*client.EcFlushError)
+	if !ok || len(flushErr.FileIds) != len(contents) || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("flush to a server with the volume: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(blocking); string(data) != "existing" {
+		t.Errorf("existing volume file changed to %q", data)
+	}
+	if _, statErr := os.Stat(storage.VolumeFileName(localDir, "archive", 7) + ".ec00"); statErr != nil {
+		t.Errorf("local volume removed after failed flush: %v", statErr)
+	}
+
+	os.Remove(blocking)
+	if err = writer.Flush(ctx); err != nil {
+		t.Fatalf("flush again: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(localDir); len(files) != 0 {
+		t.Errorf("%d local files left after flush", len(files))
+	}
+
+	for name, content := range contents {
+		w := httptest.NewRecorder()
+		vs.GetOrHeadHandler(w, httptest.NewRequest("GET", "/"+fileIds[name], nil))
+		if w.Code != http.StatusOK || w.Body.String() != content {
+			t.Errorf("read %s %s: %d %d bytes", name, fileIds[name], w.Code, w.Body.Len())
+		}
+		if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, path.Base(name)) {
+			t.Errorf("read %s: Content-Disposition %q", name, disposition)
+		}
+	}
+
+	// the collection can not lead the received files out of the data dir
+	err = operation.WithVolumeServerClient(volumeUrl, vs.grpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+		stream, err := client.VolumeEcShardsReceive(ctx)
+		if err != nil {
+			return err
+		}
+		stream.Send(&volume_server_pb.VolumeEcShardsReceiveRequest{VolumeId: 8, Collection: "../escaped", Ext: ".ecx", FileContent: []byte("x")})
+		_, err = stream.CloseAndRecv()
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid collection") {
+		t.Errorf("receive with a collection out of the data dir: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package weed_server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/backend"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// extents closer than this are read together, with the data in between thrown away
+const extentGapToMerge = 64 * 1024
+
+// ReadNeedleExtents reads the extents of the needles, and sends one response for each needle.
+// The extents of uncompressed needles on local disks are read from the .dat file directly,
+// and nearby extents are read by one preadv(2).
+func (vs *VolumeServer) ReadNeedleExtents(req *volume_server_pb.ReadNeedleExtentsRequest, stream volume_server_pb.VolumeServer_ReadNeedleExtentsServer) error {
+
+	for i, needleExtents := range req.Needles {
+		resp := &volume_server_pb.ReadNeedleExtentsResponse{
+			NeedleIndex: uint32(i),
+		}
+		data, err := vs.readNeedleExtents(needleExtents)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Data = data
+		}
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (vs *VolumeServer) readNeedleExtents(req *volume_server_pb.NeedleExtents) ([][]byte, error) {
+
+	volumeId := needle.VolumeId(req.VolumeId)
+	cookie := types.Cookie(req.Cookie)
+	n := &needle.Needle{Id: types.NeedleId(req.NeedleId), Cookie: cookie}
+
+	if vs.store.HasVolume(volumeId) {
+		dataFile, dataOffset, err := vs.store.OpenVolumeNeedleData(volumeId, n, 0)
+		if err != nil {
+			return nil, err
+		}
+		if dataFile != nil {
+			defer dataFile.Close()
+			if n.Cookie != cookie {
+				return nil, fmt.Errorf("needle %d cookie %x does not match %x", req.NeedleId, req.Cookie, n.Cookie)
+			}
+			if !n.IsCompressed() && !n.IsChunkedManifest() {
+				return readExtentsFromFile(dataFile, dataOffset, int64(n.DataSize), req.Extents)
+			}
+		}
+		n = &needle.Needle{Id: types.NeedleId(req.NeedleId), Cookie: cookie}
+		if _, err = vs.store.ReadVolumeNeedle(volumeId, n); err != nil {
+			return nil, err
+		}
+	} else if _, found := vs.store.FindEcVolume(volumeId); found {
+		if _, err := vs.store.ReadEcShardNeedle(volumeId, n); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("volume %d not found", req.VolumeId)
+	}
+
+	if n.Cookie != cookie {
+		return nil, fmt.Errorf("needle %d cookie %x does not match %x", req.NeedleId, req.Cookie, n.Cookie)
+	}
+	if n.IsChunkedManifest() {
+		return nil, fmt.Errorf("needle %d is a chunk manifest", req.NeedleId)
+	}
+	data := n.Data
+	if n.IsCompressed() {
+		var err error
+		if data, err = util.DecompressData(data); err != nil {
+			return nil, fmt.Errorf("decompress needle %d: %v", req.NeedleId, err)
+		}
+	}
+
+	var result [][]byte
+	for _, extent := range req.Extents {
+		start, stop := clipExtent(extent, int64(len(data)))
+		result = append(result, data[start:stop])
+	}
+	return result, nil
+}
+
+// readExtentsFromFile reads the extents of the needle data at dataOffset in the file
+func readExtentsFromFile(dataFile *os.File, dataOffset, dataSize int64, extents []*volume_server_pb.Extent) ([][]byte, error) {
+
+	result := make([][]byte, len(extents))
+	order := make([]int, len(extents))
+	for i, extent := range extents {
+		start, stop := clipExtent(extent, dataSize)
+		result[i] = make([]byte, stop-start)
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		startA, _ := clipExtent(extents[order[a]], dataSize)
+		startB, _ := clipExtent(extents[order[b]], dataSize)
+		return startA < startB
+	})
+
+	var scratch []byte
+	var buffers [][]byte
+	var runStart, runStop int64
+	for _, i := range order {
+		start, stop := clipExtent(extents[i], dataSize)
+		if start == stop {
+			continue
+		}
+		if len(buffers) > 0 && start >= runStop && start-runStop <= extentGapToMerge {
+			if gap := start - runStop; gap > 0 {
+				if scratch == nil {
+					scratch = make([]byte, extentGapToMerge)
+				}
+				buffers = append(buffers, scratch[:gap])
+			}
+			buffers = append(buffers, result[i])
+			runStop = stop
+			continue
+		}
+		// far away from, or overlapping with, the previous extents
+		if len(buffers) > 0 {
+			if _, err := backend.ReadVectored(dataFile, buffers, dataOffset+runStart); err != nil {
+				return nil, err
+			}
+		}
+		buffers = [][]byte{result[i]}
+		runStart, runStop = start, stop
+	}
+	if len(buffers) > 0 {
+		if _, err := backend.ReadVectored(dataFile, buffers, dataOffset+runStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func clipExtent(extent *volume_server_pb.Extent, size int64) (start, stop int64) {
+	start, stop = extent.Offset, extent.Offset+extent.Size
+	if start < 0 {
+		start = 0
+	}
+	if start > size {
+		start = size
+	}
+	if stop > size || extent.Size < 0 {
+		stop = size
+	}
+	if stop < start {
+		stop = start
+	}
+	return
+}
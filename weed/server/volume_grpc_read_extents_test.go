@@ -0,0 +1,50 @@
+package weed_server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+)
+
+func TestReadExtentsFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "extents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	data := make([]byte, 300*1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	dataOffset := int64(100)
+	f.Write(make([]byte, dataOffset))
+	f.Write(data)
+
+	extents := []*volume_server_pb.Extent{
+		{Offset: 200 * 1024, Size: 100},   // far away
+		{Offset: 10, Size: 20},            // merged with the next ones
+		{Offset: 1000, Size: 5000},        // gap in between
+		{Offset: 3000, Size: 10},          // overlapping
+		{Offset: 300*1024 - 5, Size: 100}, // clipped at the end
+		{Offset: 400 * 1024, Size: 10},    // after the end
+		{Offset: 290 * 1024, Size: -1},    // to the end
+	}
+	result, err := readExtentsFromFile(f, dataOffset, int64(len(data)), extents)
+	if err != nil {
+		t.Fatalf("read extents: %v", err)
+	}
+	for i, extent := range extents {
+		start, stop := clipExtent(extent, int64(len(data)))
+		if !bytes.Equal(result[i], data[start:stop]) {
+			t.Errorf("extent %d [%d,%d): unexpected data of %d bytes", i, start, stop, len(result[i]))
+		}
+	}
+	if len(result[4]) != 5 || len(result[5]) != 0 || len(result[6]) != 10*1024 {
+		t.Errorf("unexpected clipping: %d %d %d", len(result[4]), len(result[5]), len(result[6]))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -20,6 +21,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/stats"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
 var fileNameEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
@@ -80,14 +82,34 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 	}
 	cookie := n.Cookie
 	var count int
-	if hasVolume {
+	var dataFile *os.File
+	var dataOffset int64
+	if hasVolume && vs.sendFileMinBytes > 0 {
+		dataFile, dataOffset, err = vs.store.OpenVolumeNeedleData(volumeId, n, vs.sendFileMinBytes)
+		if dataFile != nil {
+			// the ext may come from the stored file name, same as resolved for the response below
+			resizeExt := ext
+			if n.NameSize > 0 && filename == "" && ext == "" {
+				resizeExt = filepath.Ext(string(n.Name))
+			}
+			if _, _, _, shouldResize := shouldResizeImages(resizeExt, r); shouldResize || n.IsCompressed() || n.IsChunkedManifest() {
+				// the data needs to be processed
+				dataFile.Close()
+				dataFile = nil
+			}
+		}
+	}
+	if dataFile != nil {
+		defer dataFile.Close()
+		count = int(n.DataSize)
+	} else if err == nil && hasVolume {
 		count, err = vs.store.ReadVolumeNeedle(volumeId, n)
-	} else if hasEcVolume {
+	} else if err == nil && hasEcVolume {
 		count, err = vs.store.ReadEcShardNeedle(volumeId, n)
 	}
 	// glog.V(4).Infoln("read bytes", count, "error", err)
 	if err != nil || count < 0 {
-		glog.V(0).Infof("read %s isNormalVolume %v error: %v", r.URL.Path, hasVolume, err)
+		glog.V(0).Infof("read %s request %s isNormalVolume %v error: %v", r.URL.Path, request_id.Get(r.Context()), hasVolume, err)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -160,6 +182,13 @@ func (vs *VolumeServer) GetOrHeadHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	if dataFile != nil {
+		if e := writeResponseFileContent(filename, mtype, dataFile, dataOffset, int64(n.DataSize), w, r); e != nil {
+			glog.V(2).Infoln("response write error:", e)
+		}
+		return
+	}
+
 	rs := conditionallyResizeImages(bytes.NewReader(n.Data), ext, r)
 
 	if e := writeResponseContent(filename, mtype, rs, w, r); e != nil {
@@ -174,7 +203,7 @@ func (vs *VolumeServer) tryHandleChunkedFile(n *needle.Needle, fileName string,
 
 	chunkManifest, e := operation.LoadChunkManifest(n.Data, n.IsCompressed())
 	if e != nil {
-		glog.V(0).Infof("load chunked manifest (%s) error: %v", r.URL.Path, e)
+		glog.V(0).Infof("load chunked manifest (%s) request %s error: %v", r.URL.Path, request_id.Get(r.Context()), e)
 		return false
 	}
 	if fileName == "" && chunkManifest.Name != "" {
@@ -234,6 +263,30 @@ func shouldResizeImages(ext string, r *http.Request) (width, height int, mode st
 
 func writeResponseContent(filename, mimeType string, rs io.ReadSeeker, w http.ResponseWriter, r *http.Request) error {
 	totalSize, e := rs.Seek(0, 2)
+	writeResponse(filename, mimeType, totalSize, w, r, func(writer io.Writer, offset int64, size int64) error {
+		if _, e = rs.Seek(offset, 0); e != nil {
+			return e
+		}
+		_, e = io.CopyN(writer, rs, size)
+		return e
+	})
+	return nil
+}
+
+// writeResponseFileContent sends the data in the file at dataOffset.
+// Copying from the *os.File lets net/http send the data by sendfile(2) for plain http connections.
+func writeResponseFileContent(filename, mimeType string, f *os.File, dataOffset, dataSize int64, w http.ResponseWriter, r *http.Request) error {
+	writeResponse(filename, mimeType, dataSize, w, r, func(writer io.Writer, offset int64, size int64) error {
+		if _, e := f.Seek(dataOffset+offset, io.SeekStart); e != nil {
+			return e
+		}
+		_, e := io.CopyN(writer, f, size)
+		return e
+	})
+	return nil
+}
+
+func writeResponse(filename, mimeType string, totalSize int64, w http.ResponseWriter, r *http.Request, writeFn func(writer io.Writer, offset int64, size int64) error) {
 	if mimeType == "" {
 		if ext := filepath.Ext(filename); ext != "" {
 			mimeType = mime.TypeByExtension(ext)
@@ -246,17 +299,10 @@ func writeResponseContent(filename, mimeType string, rs io.ReadSeeker, w http.Re
 
 	if r.Method == "HEAD" {
 		w.Header().Set("Content-Length", strconv.FormatInt(totalSize, 10))
-		return nil
+		return
 	}
 
 	adjustHeadersAfterHEAD(w, r, filename)
 
-	processRangeRequest(r, w, totalSize, mimeType, func(writer io.Writer, offset int64, size int64) error {
-		if _, e = rs.Seek(offset, 0); e != nil {
-			return e
-		}
-		_, e = io.CopyN(writer, rs, size)
-		return e
-	})
-	return nil
+	processRangeRequest(r, w, totalSize, mimeType, writeFn)
 }
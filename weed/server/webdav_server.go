@@ -56,7 +56,7 @@ func NewWebDavServer(option *WebDavOption) (ws *WebDavServer, err error) {
 		grpcDialOption: security.LoadClientTLS(util.GetViper(), "grpc.filer"),
 		Handler: &webdav.Handler{
 			FileSystem: fs,
-			LockSystem: webdav.NewMemLS(),
+			LockSystem: newFilerLockSystem(fs.(*WebDavFileSystem)),
 		},
 	}
 
@@ -194,11 +194,13 @@ func (fs *WebDavFileSystem) OpenFile(ctx context.Context, fullFilePath string, f
 		if strings.HasSuffix(fullFilePath, "/") {
 			return nil, os.ErrInvalid
 		}
-		_, err = fs.stat(ctx, fullFilePath)
-		if err == nil {
+		var extended map[string][]byte
+		if existing, _ := filer_pb.GetEntry(fs, util.FullPath(fullFilePath)); existing != nil {
 			if flag&os.O_EXCL != 0 {
 				return nil, os.ErrExist
 			}
+			// keep the dead properties when overwriting the file
+			extended = existing.Extended
 			fs.removeAll(ctx, fullFilePath)
 		}
 
@@ -219,6 +221,7 @@ func (fs *WebDavFileSystem) OpenFile(ctx context.Context, fullFilePath string, f
 						Replication: "000",
 						TtlSec:      0,
 					},
+					Extended: extended,
 				},
 			}); err != nil {
 				return fmt.Errorf("create %s: %v", fullFilePath, err)
@@ -377,7 +380,7 @@ func (f *WebDavFile) Write(buf []byte) (int, error) {
 		return 0, err
 	}
 
-	var fileId, host string
+	var fileId, fileUrl string
 	var auth security.EncodedJwt
 	var collection, replication string
 
@@ -399,7 +402,7 @@ func (f *WebDavFile) Write(buf []byte) (int, error) {
 			return fmt.Errorf("assign volume failure %v: %v", request, resp.Error)
 		}
 
-		fileId, host, auth = resp.FileId, resp.Url, security.EncodedJwt(resp.Auth)
+		fileId, fileUrl, auth = resp.FileId, resp.UploadUrl(resp.Url), security.EncodedJwt(resp.Auth)
 		collection, replication = resp.Collection, resp.Replication
 
 		return nil
@@ -407,7 +410,6 @@ func (f *WebDavFile) Write(buf []byte) (int, error) {
 		return 0, fmt.Errorf("filerGrpcAddress assign volume: %v", err)
 	}
 
-	fileUrl := fmt.Sprintf("http://%s/%s", host, fileId)
 	uploadResult, err := operation.UploadData(fileUrl, f.name, f.fs.option.Cipher, buf, false, "", nil, auth)
 	if err != nil {
 		glog.V(0).Infof("upload data %v to %s: %v", f.name, fileUrl, err)
@@ -506,6 +508,9 @@ func (f *WebDavFile) Readdir(count int) (ret []os.FileInfo, err error) {
 	dir, _ := util.FullPath(f.name).DirAndName()
 
 	err = filer_pb.ReadDirAllEntries(f.fs, util.FullPath(dir), "", func(entry *filer_pb.Entry, isLast bool) error {
+		if string(util.NewFullPath(dir, entry.Name)) == webDavSystemDir {
+			return nil
+		}
 		fi := FileInfo{
 			size:          int64(filer2.TotalSize(entry.GetChunks())),
 			name:          entry.Name,
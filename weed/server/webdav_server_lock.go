@@ -0,0 +1,403 @@
+package weed_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// The webdav locks are kept as entries under webDavLocksDir, so they survive restarts,
+// and are shared by all webdav servers of the same filer.
+// Each lock also takes an entry keyed by its root under webDavLockRootsDir, created exclusively,
+// so only one of the webdav servers locking the same resource at the same time wins.
+// Locks on nested resources are saved first and then checked against the other locks,
+// and the new lock is removed on conflicts.
+// The webdav handler also creates temporary locks for the duration of each request without an "If" header.
+// These request scoped locks are only kept in memory.
+
+const (
+	webDavSystemDir       = "/.webdav"
+	webDavLocksDir        = webDavSystemDir + "/locks"
+	webDavLockRootsDir    = webDavSystemDir + "/roots"
+	webDavLockTokenPrefix = "opaquelocktoken:"
+	webDavLockExtendedKey = "webdav.lock"
+	webDavLockTokenKey    = "webdav.lock.token"
+)
+
+type webDavLock struct {
+	Token     string        `json:"token"`
+	Root      string        `json:"root"`
+	OwnerXML  string        `json:"owner,omitempty"`
+	ZeroDepth bool          `json:"zeroDepth,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	ExpiresNs int64         `json:"expiresNs,omitempty"` // 0 means never
+}
+
+func (l *webDavLock) details() webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      l.Root,
+		Duration:  l.Duration,
+		OwnerXML:  l.OwnerXML,
+		ZeroDepth: l.ZeroDepth,
+	}
+}
+
+func (l *webDavLock) setDuration(now time.Time, duration time.Duration) {
+	l.Duration = duration
+	l.ExpiresNs = 0
+	if duration >= 0 {
+		l.ExpiresNs = now.Add(duration).UnixNano()
+	}
+}
+
+func (l *webDavLock) isExpired(now time.Time) bool {
+	return l.ExpiresNs != 0 && l.ExpiresNs <= now.UnixNano()
+}
+
+func (l *webDavLock) covers(name string) bool {
+	return name == l.Root || !l.ZeroDepth && isWebDavDescendant(name, l.Root)
+}
+
+func (l *webDavLock) conflicts(root string, zeroDepth bool) bool {
+	return l.covers(root) || !zeroDepth && isWebDavDescendant(l.Root, root)
+}
+
+func isWebDavDescendant(name, parent string) bool {
+	if parent == "/" {
+		return name != "/"
+	}
+	return strings.HasPrefix(name, parent+"/")
+}
+
+func webDavLockName(token string) (string, bool) {
+	name := strings.TrimPrefix(token, webDavLockTokenPrefix)
+	if name == token || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+func webDavLockRootName(root string) string {
+	return url.PathEscape(root)
+}
+
+func isRequestScopedLock(details webdav.LockDetails) bool {
+	return details.Duration < 0 && details.OwnerXML == "" && details.ZeroDepth
+}
+
+func slashCleanWebDavName(name string) string {
+	if name == "" || name[0] != '/' {
+		name = "/" + name
+	}
+	return path.Clean(name)
+}
+
+type filerLockSystem struct {
+	fs           filer_pb.FilerClient
+	requestLocks map[string]*webDavLock
+	mu           sync.Mutex
+}
+
+var _ = webdav.LockSystem(&filerLockSystem{})
+
+func newFilerLockSystem(fs filer_pb.FilerClient) *filerLockSystem {
+	return &filerLockSystem{
+		fs:           fs,
+		requestLocks: make(map[string]*webDavLock),
+	}
+}
+
+func (ls *filerLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for _, name := range []string{name0, name1} {
+		if name == "" {
+			continue
+		}
+		confirmed, err := ls.confirm(now, slashCleanWebDavName(name), conditions)
+		if err != nil {
+			return nil, err
+		}
+		if !confirmed {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	return func() {}, nil
+}
+
+func (ls *filerLockSystem) confirm(now time.Time, name string, conditions []webdav.Condition) (bool, error) {
+	for _, c := range conditions {
+		if c.Token == "" {
+			continue
+		}
+		lock, err := ls.findLock(now, c.Token)
+		if err != nil {
+			return false, err
+		}
+		if lock != nil && lock.covers(name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (ls *filerLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	details.Root = slashCleanWebDavName(details.Root)
+
+	lock := &webDavLock{
+		Token:     webDavLockTokenPrefix + uuid.New().String(),
+		Root:      details.Root,
+		OwnerXML:  details.OwnerXML,
+		ZeroDepth: details.ZeroDepth,
+	}
+	lock.setDuration(now, details.Duration)
+
+	if isRequestScopedLock(details) {
+		if err := ls.checkConflicts(now, lock); err != nil {
+			return "", err
+		}
+		ls.requestLocks[lock.Token] = lock
+		return lock.Token, nil
+	}
+
+	if err := ls.reserveRoot(now, lock); err != nil {
+		return "", err
+	}
+	if err := ls.saveLock(lock); err != nil {
+		ls.releaseRoot(lock)
+		return "", err
+	}
+	if err := ls.checkConflicts(now, lock); err != nil {
+		if deleteErr := ls.deleteLock(lock); deleteErr != nil {
+			glog.Warningf("delete conflicting webdav lock %s: %v", lock.Token, deleteErr)
+		}
+		return "", err
+	}
+	return lock.Token, nil
+}
+
+// checkConflicts returns webdav.ErrLocked if any other lock conflicts with the lock
+func (ls *filerLockSystem) checkConflicts(now time.Time, lock *webDavLock) error {
+	locks, err := ls.listLocks(now)
+	if err != nil {
+		return err
+	}
+	for _, other := range locks {
+		if other.Token != lock.Token && other.conflicts(lock.Root, lock.ZeroDepth) {
+			return webdav.ErrLocked
+		}
+	}
+	return nil
+}
+
+// reserveRoot exclusively creates the entry of the lock root, or returns webdav.ErrLocked if the root
+// is taken by another valid lock. The root entries left by expired or removed locks are taken over.
+func (ls *filerLockSystem) reserveRoot(now time.Time, lock *webDavLock) error {
+	name := webDavLockRootName(lock.Root)
+	for retry := 0; ; retry++ {
+		err := ls.saveEntry(webDavLockRootsDir, name, webDavLockTokenKey, []byte(lock.Token), true)
+		if err == nil {
+			return nil
+		}
+		if !strings.Contains(err.Error(), "EEXIST") {
+			return fmt.Errorf("reserve webdav lock root %s: %v", lock.Root, err)
+		}
+		if retry > 0 {
+			return webdav.ErrLocked
+		}
+
+		entry, err := filer_pb.GetEntry(ls.fs, util.NewFullPath(webDavLockRootsDir, name))
+		if err != nil {
+			return fmt.Errorf("read webdav lock root %s: %v", lock.Root, err)
+		}
+		if entry == nil {
+			continue
+		}
+		holderToken := string(entry.Extended[webDavLockTokenKey])
+		holder, err := ls.findLock(now, holderToken)
+		if err != nil {
+			return err
+		}
+		if holder != nil {
+			return webdav.ErrLocked
+		}
+		ls.releaseRoot(&webDavLock{Token: holderToken, Root: lock.Root})
+	}
+}
+
+// releaseRoot removes the entry of the lock root, if it is still held by the lock
+func (ls *filerLockSystem) releaseRoot(lock *webDavLock) {
+	name := webDavLockRootName(lock.Root)
+	entry, err := filer_pb.GetEntry(ls.fs, util.NewFullPath(webDavLockRootsDir, name))
+	if err != nil || entry == nil || string(entry.Extended[webDavLockTokenKey]) != lock.Token {
+		return
+	}
+	if err = filer_pb.Remove(ls.fs, webDavLockRootsDir, name, false, false, false, false); err != nil {
+		glog.Warningf("release webdav lock root %s: %v", lock.Root, err)
+	}
+}
+
+func (ls *filerLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	lock, err := ls.findLock(now, token)
+	if err != nil {
+		return webdav.LockDetails{}, err
+	}
+	if lock == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	lock.setDuration(now, duration)
+	if _, found := ls.requestLocks[token]; !found {
+		if err = ls.saveLock(lock); err != nil {
+			return webdav.LockDetails{}, err
+		}
+	}
+	return lock.details(), nil
+}
+
+func (ls *filerLockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, found := ls.requestLocks[token]; found {
+		delete(ls.requestLocks, token)
+		return nil
+	}
+
+	lock, err := ls.findLock(now, token)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return webdav.ErrNoSuchLock
+	}
+	return ls.deleteLock(lock)
+}
+
+// findLock returns nil if the lock is not found or expired
+func (ls *filerLockSystem) findLock(now time.Time, token string) (*webDavLock, error) {
+	if lock, found := ls.requestLocks[token]; found {
+		return lock, nil
+	}
+	name, ok := webDavLockName(token)
+	if !ok {
+		return nil, nil
+	}
+	entry, err := filer_pb.GetEntry(ls.fs, util.NewFullPath(webDavLocksDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("read webdav lock %s: %v", token, err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	lock, err := decodeWebDavLock(entry)
+	if err != nil {
+		return nil, err
+	}
+	if lock.isExpired(now) {
+		return nil, ls.deleteLock(lock)
+	}
+	return lock, nil
+}
+
+// listLocks returns all locks not expired, and removes the expired ones
+func (ls *filerLockSystem) listLocks(now time.Time) (locks []*webDavLock, err error) {
+	for _, lock := range ls.requestLocks {
+		locks = append(locks, lock)
+	}
+
+	var expired []*webDavLock
+	err = filer_pb.ReadDirAllEntries(ls.fs, webDavLocksDir, "", func(entry *filer_pb.Entry, isLast bool) error {
+		lock, decodeErr := decodeWebDavLock(entry)
+		if decodeErr != nil {
+			glog.Warningf("skip webdav lock %s: %v", entry.Name, decodeErr)
+			return nil
+		}
+		if lock.isExpired(now) {
+			expired = append(expired, lock)
+			return nil
+		}
+		locks = append(locks, lock)
+		return nil
+	})
+	if err != nil && err != filer_pb.ErrNotFound {
+		return nil, fmt.Errorf("list webdav locks: %v", err)
+	}
+
+	for _, lock := range expired {
+		if deleteErr := ls.deleteLock(lock); deleteErr != nil {
+			glog.Warningf("delete expired webdav lock %s: %v", lock.Token, deleteErr)
+		}
+	}
+
+	return locks, nil
+}
+
+func (ls *filerLockSystem) saveLock(lock *webDavLock) error {
+	name, _ := webDavLockName(lock.Token)
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	if err = ls.saveEntry(webDavLocksDir, name, webDavLockExtendedKey, data, false); err != nil {
+		return fmt.Errorf("save webdav lock %s on %s: %v", lock.Token, lock.Root, err)
+	}
+	return nil
+}
+
+func (ls *filerLockSystem) saveEntry(dir, name, key string, data []byte, oExcl bool) error {
+	return ls.fs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+			Directory: dir,
+			Entry: &filer_pb.Entry{
+				Name: name,
+				Attributes: &filer_pb.FuseAttributes{
+					Mtime:    time.Now().Unix(),
+					Crtime:   time.Now().Unix(),
+					FileMode: uint32(0644),
+				},
+				Extended: map[string][]byte{
+					key: data,
+				},
+			},
+			OExcl: oExcl,
+		})
+	})
+}
+
+func (ls *filerLockSystem) deleteLock(lock *webDavLock) error {
+	name, _ := webDavLockName(lock.Token)
+	err := filer_pb.Remove(ls.fs, webDavLocksDir, name, false, false, false, false)
+	ls.releaseRoot(lock)
+	return err
+}
+
+func decodeWebDavLock(entry *filer_pb.Entry) (*webDavLock, error) {
+	data, found := entry.Extended[webDavLockExtendedKey]
+	if !found {
+		return nil, os.ErrInvalid
+	}
+	lock := &webDavLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
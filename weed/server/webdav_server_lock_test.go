@@ -0,0 +1,90 @@
+package weed_server
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/webdav"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/filer2/leveldb2"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+func TestWebDavLockConflicts(t *testing.T) {
+	tests := []struct {
+		lock      webDavLock
+		root      string
+		zeroDepth bool
+		conflicts bool
+	}{
+		{webDavLock{Root: "/a/b"}, "/a/b", true, true},
+		{webDavLock{Root: "/a/b"}, "/a/b/c", true, true},
+		{webDavLock{Root: "/a/b", ZeroDepth: true}, "/a/b/c", true, false},
+		{webDavLock{Root: "/a/b", ZeroDepth: true}, "/a", false, true},
+		{webDavLock{Root: "/a/b", ZeroDepth: true}, "/a", true, false},
+		{webDavLock{Root: "/a/b"}, "/a/bc", false, false},
+		{webDavLock{Root: "/"}, "/a", true, true},
+		{webDavLock{Root: "/a"}, "/", false, true},
+	}
+	for i, test := range tests {
+		if conflicts := test.lock.conflicts(test.root, test.zeroDepth); conflicts != test.conflicts {
+			t.Errorf("case %d: lock on %s zeroDepth %v, new lock on %s zeroDepth %v: conflicts %v, expected %v",
+				i, test.lock.Root, test.lock.ZeroDepth, test.root, test.zeroDepth, conflicts, test.conflicts)
+		}
+	}
+}
+
+func TestWebDavLocksAcrossServers(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "webdav_lock")
+	defer os.RemoveAll(dir)
+	store := &leveldb.LevelDB2Store{}
+	config := viper.New()
+	config.Set("dir", dir)
+	if err := store.Initialize(config, ""); err != nil {
+		t.Fatal(err)
+	}
+	fs := &FilerServer{option: &FilerOption{}, filer: filer2.NewFiler(nil, grpc.WithInsecure(), "", 0, "", "", nil)}
+	fs.filer.SetStore(store)
+	fs.filer.DisableDirectoryCache()
+	grpcServer, filerUrl := serveGrpc(t, func(s *grpc.Server) { filer_pb.RegisterSeaweedFilerServer(s, fs) })
+	defer grpcServer.Stop()
+
+	// two webdav servers of the same filer
+	newLockSystem := func() *filerLockSystem {
+		filerGrpcAddress, _ := pb.ParseServerToGrpcAddress(filerUrl)
+		return newFilerLockSystem(&WebDavFileSystem{option: &WebDavOption{FilerGrpcAddress: filerGrpcAddress, GrpcDialOption: grpc.WithInsecure()}})
+	}
+	a, b := newLockSystem(), newLockSystem()
+	now := time.Now()
+
+	token, err := a.Create(now, webdav.LockDetails{Root: "/docs/a.txt", Duration: time.Minute})
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if _, err = b.Create(now, webdav.LockDetails{Root: "/docs/a.txt", Duration: time.Minute}); err != webdav.ErrLocked {
+		t.Fatalf("lock the same resource on another server: %v", err)
+	}
+	if _, err = b.Create(now, webdav.LockDetails{Root: "/docs", Duration: time.Minute}); err != webdav.ErrLocked {
+		t.Fatalf("lock the parent on another server: %v", err)
+	}
+	if _, err = b.Confirm(now, "/docs/a.txt", "", webdav.Condition{Token: token}); err != nil {
+		t.Fatalf("confirm the lock on another server: %v", err)
+	}
+
+	// the root is released on unlock, and taken over after the lock expires
+	if err = b.Unlock(now, token); err != nil {
+		t.Fatalf("unlock on another server: %v", err)
+	}
+	if _, err = b.Create(now, webdav.LockDetails{Root: "/docs/a.txt", Duration: time.Minute}); err != nil {
+		t.Fatalf("lock the unlocked resource: %v", err)
+	}
+	if _, err = a.Create(now.Add(2*time.Minute), webdav.LockDetails{Root: "/docs/a.txt", Duration: time.Minute}); err != nil {
+		t.Fatalf("lock the resource after the lock expired: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package weed_server
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// the dead properties set by PROPPATCH are kept in the extended attributes of the entry,
+// with the key "webdav.prop.{namespace}local"
+
+const webDavDeadPropPrefix = "webdav.prop."
+
+type webDavDeadProp struct {
+	Space    string `json:"space,omitempty"`
+	Local    string `json:"local"`
+	Lang     string `json:"lang,omitempty"`
+	InnerXML []byte `json:"xml,omitempty"`
+}
+
+var _ = webdav.DeadPropsHolder(&WebDavFile{})
+
+func webDavDeadPropKey(name xml.Name) string {
+	return fmt.Sprintf("%s{%s}%s", webDavDeadPropPrefix, name.Space, name.Local)
+}
+
+func (f *WebDavFile) entryPath() util.FullPath {
+	if f.name != "/" {
+		return util.FullPath(strings.TrimSuffix(f.name, "/"))
+	}
+	return util.FullPath(f.name)
+}
+
+func (f *WebDavFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+
+	glog.V(2).Infof("WebDavFile.DeadProps %v", f.name)
+
+	props := make(map[xml.Name]webdav.Property)
+	if f.entryPath() == "/" {
+		return props, nil
+	}
+
+	entry, err := filer_pb.GetEntry(f.fs, f.entryPath())
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return props, nil
+	}
+
+	for key, data := range entry.Extended {
+		if !strings.HasPrefix(key, webDavDeadPropPrefix) {
+			continue
+		}
+		var p webDavDeadProp
+		if err := json.Unmarshal(data, &p); err != nil {
+			glog.Warningf("skip webdav property %s of %s: %v", key, f.name, err)
+			continue
+		}
+		name := xml.Name{Space: p.Space, Local: p.Local}
+		props[name] = webdav.Property{
+			XMLName:  name,
+			Lang:     p.Lang,
+			InnerXML: p.InnerXML,
+		}
+	}
+
+	return props, nil
+}
+
+func (f *WebDavFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+
+	glog.V(2).Infof("WebDavFile.Patch %v", f.name)
+
+	propstat := webdav.Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			propstat.Props = append(propstat.Props, webdav.Property{XMLName: p.XMLName})
+		}
+	}
+
+	if f.entryPath() == "/" {
+		propstat.Status = http.StatusForbidden
+		return []webdav.Propstat{propstat}, nil
+	}
+
+	entry, err := filer_pb.GetEntry(f.fs, f.entryPath())
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	if entry.Extended == nil {
+		entry.Extended = make(map[string][]byte)
+	}
+
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			key := webDavDeadPropKey(p.XMLName)
+			if patch.Remove {
+				delete(entry.Extended, key)
+				continue
+			}
+			data, err := json.Marshal(&webDavDeadProp{
+				Space:    p.XMLName.Space,
+				Local:    p.XMLName.Local,
+				Lang:     p.Lang,
+				InnerXML: p.InnerXML,
+			})
+			if err != nil {
+				return nil, err
+			}
+			entry.Extended[key] = data
+		}
+	}
+
+	dir, _ := f.entryPath().DirAndName()
+	err = f.fs.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		if _, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		}); err != nil {
+			return fmt.Errorf("update %s: %v", f.name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []webdav.Propstat{propstat}, nil
+}
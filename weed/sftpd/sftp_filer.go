@@ -0,0 +1,272 @@
+package sftpd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security/users"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// sftpHandler serves the requests of one user, with all paths under the home directory of the user
+type sftpHandler struct {
+	server *SftpServer
+	user   *users.User
+}
+
+func newSftpHandlers(server *SftpServer, user *users.User) sftp.Handlers {
+	h := &sftpHandler{
+		server: server,
+		user:   user,
+	}
+	return sftp.Handlers{
+		FileGet:  h,
+		FilePut:  h,
+		FileCmd:  h,
+		FileList: h,
+	}
+}
+
+type FileInfo struct {
+	name        string
+	size        int64
+	mode        os.FileMode
+	modTime     time.Time
+	isDirectory bool
+}
+
+func (fi *FileInfo) Name() string       { return fi.name }
+func (fi *FileInfo) Size() int64        { return fi.size }
+func (fi *FileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *FileInfo) IsDir() bool        { return fi.isDirectory }
+func (fi *FileInfo) Sys() interface{}   { return nil }
+
+func toFileInfo(name string, entry *filer_pb.Entry) *FileInfo {
+	fi := &FileInfo{
+		name:        name,
+		size:        int64(filer2.TotalSize(entry.Chunks)),
+		mode:        os.FileMode(entry.Attributes.FileMode),
+		modTime:     time.Unix(entry.Attributes.Mtime, 0),
+		isDirectory: entry.IsDirectory,
+	}
+	if fi.isDirectory {
+		fi.mode |= os.ModeDir
+	}
+	return fi
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (h *sftpHandler) lookup(fullpath util.FullPath) (*filer_pb.Entry, error) {
+	entry, err := filer_pb.GetEntry(h.server, fullpath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	return entry, nil
+}
+
+func (h *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+
+	fullpath := util.FullPath(h.user.ToFilerPath(r.Filepath))
+	glog.V(2).Infof("sftp %s read %s", h.user.Username, fullpath)
+
+	entry, err := h.lookup(fullpath)
+	if err != nil {
+		return nil, err
+	}
+	if entry.IsDirectory {
+		return nil, fmt.Errorf("%s is a directory", r.Filepath)
+	}
+	if len(entry.Chunks) == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	return filer2.NewChunkReaderAtForEntry(h.server, entry, h.server.chunkCache), nil
+}
+
+func (h *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+
+	if h.user.ReadOnly {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	fullpath := util.FullPath(h.user.ToFilerPath(r.Filepath))
+	flags := r.Pflags()
+	glog.V(2).Infof("sftp %s write %s %+v", h.user.Username, fullpath, flags)
+
+	entry, err := h.lookup(fullpath)
+	if err != nil && err != os.ErrNotExist {
+		return nil, err
+	}
+	if entry != nil && entry.IsDirectory {
+		return nil, fmt.Errorf("%s is a directory", r.Filepath)
+	}
+	if entry != nil && flags.Creat && flags.Excl {
+		return nil, os.ErrExist
+	}
+
+	isNew := entry == nil
+	if isNew {
+		if !flags.Creat {
+			return nil, os.ErrNotExist
+		}
+		now := time.Now().Unix()
+		entry = &filer_pb.Entry{
+			Name: fullpath.Name(),
+			Attributes: &filer_pb.FuseAttributes{
+				Mtime:       now,
+				Crtime:      now,
+				FileMode:    uint32(0644),
+				Uid:         h.user.Uid,
+				Gid:         h.user.Gid,
+				Collection:  h.server.option.Collection,
+				Replication: h.server.option.Replication,
+			},
+		}
+	}
+
+	writer := filer2.NewClientFileWriter(h.server, fullpath, entry, h.server.option.ChunkSizeMB*1024*1024, h.server.uploadOption())
+	if isNew || flags.Trunc {
+		if err = writer.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+func (h *sftpHandler) Filecmd(r *sftp.Request) error {
+
+	if h.user.ReadOnly {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+
+	fullpath := util.FullPath(h.user.ToFilerPath(r.Filepath))
+	dir, name := fullpath.DirAndName()
+	glog.V(2).Infof("sftp %s %s %s", h.user.Username, r.Method, fullpath)
+
+	if string(fullpath) == h.user.HomeDir && r.Method != "Setstat" {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+
+	switch r.Method {
+	case "Setstat":
+		return h.setstat(r, fullpath)
+	case "Rename":
+		target := util.FullPath(h.user.ToFilerPath(r.Target))
+		newDir, newName := target.DirAndName()
+		return h.server.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+			_, err := client.AtomicRenameEntry(context.Background(), &filer_pb.AtomicRenameEntryRequest{
+				OldDirectory: dir,
+				OldName:      name,
+				NewDirectory: newDir,
+				NewName:      newName,
+			})
+			return err
+		})
+	case "Rmdir":
+		entry, err := h.lookup(fullpath)
+		if err != nil {
+			return err
+		}
+		if !entry.IsDirectory {
+			return fmt.Errorf("%s is not a directory", r.Filepath)
+		}
+		return filer_pb.Remove(h.server, dir, name, true, false, false, false)
+	case "Remove":
+		entry, err := h.lookup(fullpath)
+		if err != nil {
+			return err
+		}
+		if entry.IsDirectory {
+			return fmt.Errorf("%s is a directory", r.Filepath)
+		}
+		return filer_pb.Remove(h.server, dir, name, true, false, false, false)
+	case "Mkdir":
+		return filer_pb.Mkdir(h.server, dir, name, func(entry *filer_pb.Entry) {
+			entry.Attributes.Uid = h.user.Uid
+			entry.Attributes.Gid = h.user.Gid
+		})
+	}
+
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *sftpHandler) setstat(r *sftp.Request, fullpath util.FullPath) error {
+	entry, err := h.lookup(fullpath)
+	if err != nil {
+		return err
+	}
+
+	attrs, attrFlags := r.Attributes(), r.AttrFlags()
+	if attrFlags.Size && attrs.Size != filer2.TotalSize(entry.Chunks) {
+		if attrs.Size != 0 {
+			return sftp.ErrSSHFxOpUnsupported
+		}
+		entry.Chunks = nil
+	}
+	if attrFlags.Permissions {
+		entry.Attributes.FileMode = entry.Attributes.FileMode&^uint32(os.ModePerm) | attrs.Mode&uint32(os.ModePerm)
+	}
+	if attrFlags.Acmodtime {
+		entry.Attributes.Mtime = int64(attrs.Mtime)
+	}
+
+	dir, _ := fullpath.DirAndName()
+	return h.server.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		})
+		return err
+	})
+}
+
+func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+
+	fullpath := util.FullPath(h.user.ToFilerPath(r.Filepath))
+	glog.V(2).Infof("sftp %s %s %s", h.user.Username, r.Method, fullpath)
+
+	switch r.Method {
+	case "List":
+		var list listerAt
+		err := filer_pb.ReadDirAllEntries(h.server, fullpath, "", func(entry *filer_pb.Entry, isLast bool) error {
+			list = append(list, toFileInfo(entry.Name, entry))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return list, nil
+	case "Stat":
+		entry, err := h.lookup(fullpath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{toFileInfo(fullpath.Name(), entry)}, nil
+	}
+
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
@@ -0,0 +1,204 @@
+package sftpd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/security/users"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+type SftpServerOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	Collection       string
+	Replication      string
+	DataCenter       string
+	Cipher           bool
+	ChunkSizeMB      int
+	CacheDir         string
+	CacheSizeMB      int64
+	HostKeyFile      string
+	Users            *UserStore
+}
+
+type SftpServer struct {
+	option     *SftpServerOption
+	sshConfig  *ssh.ServerConfig
+	chunkCache *chunk_cache.ChunkCache
+}
+
+var _ = filer_pb.FilerClient(&SftpServer{})
+
+func NewSftpServer(option *SftpServerOption) (*SftpServer, error) {
+
+	s := &SftpServer{
+		option:     option,
+		chunkCache: chunk_cache.NewChunkCache(256, option.CacheDir, option.CacheSizeMB),
+	}
+
+	s.sshConfig = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if _, err := option.Users.CheckPassword(conn.User(), string(password)); err != nil {
+				glog.V(0).Infof("sftp %s from %s: %v", conn.User(), conn.RemoteAddr(), err)
+				return nil, err
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if _, err := option.Users.CheckPublicKey(conn.User(), key); err != nil {
+				glog.V(1).Infof("sftp %s from %s: %v", conn.User(), conn.RemoteAddr(), err)
+				return nil, err
+			}
+			return nil, nil
+		},
+	}
+
+	hostKey, err := loadHostKey(option.HostKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	s.sshConfig.AddHostKey(hostKey)
+
+	return s, nil
+}
+
+func loadHostKey(fileName string) (ssh.Signer, error) {
+	if fileName == "" {
+		glog.Warningf("no ssh host key file is specified, generate a new host key which changes after each restart")
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate host key: %v", err)
+		}
+		return ssh.NewSignerFromKey(privateKey)
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("read host key %s: %v", fileName, err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse host key %s: %v", fileName, err)
+	}
+	return signer, nil
+}
+
+func (s *SftpServer) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, s.option.FilerGrpcAddress, s.option.GrpcDialOption)
+
+}
+
+func (s *SftpServer) AdjustedUrl(hostAndPort string) string {
+	return hostAndPort
+}
+
+func (s *SftpServer) uploadOption() *filer2.ClientUploadOption {
+	return &filer2.ClientUploadOption{
+		Collection:  s.option.Collection,
+		Replication: s.option.Replication,
+		DataCenter:  s.option.DataCenter,
+		Cipher:      s.option.Cipher,
+	}
+}
+
+func (s *SftpServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *SftpServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.sshConfig)
+	if err != nil {
+		glog.V(1).Infof("sftp handshake with %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sshConn.Close()
+
+	user, found := s.option.Users.GetUser(sshConn.User())
+	if !found {
+		return
+	}
+	glog.V(0).Infof("sftp %s logged in from %s", user.Username, sshConn.RemoteAddr())
+
+	if err := s.ensureHomeDir(user); err != nil {
+		glog.Errorf("sftp %s: %v", user.Username, err)
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			glog.V(0).Infof("sftp %s accept channel: %v", user.Username, err)
+			continue
+		}
+		go s.handleChannel(user, channel, channelRequests)
+	}
+
+	glog.V(0).Infof("sftp %s from %s disconnected", user.Username, sshConn.RemoteAddr())
+}
+
+func (s *SftpServer) handleChannel(user *users.User, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		isSftp := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(isSftp, nil)
+		if !isSftp {
+			continue
+		}
+		server := sftp.NewRequestServer(channel, newSftpHandlers(s, user))
+		if err := server.Serve(); err != nil && err != io.EOF {
+			glog.V(0).Infof("sftp %s: %v", user.Username, err)
+		}
+		server.Close()
+		return
+	}
+}
+
+func (s *SftpServer) ensureHomeDir(user *users.User) error {
+	entry, err := filer_pb.GetEntry(s, util.FullPath(user.HomeDir))
+	if err != nil {
+		return fmt.Errorf("lookup home dir %s: %v", user.HomeDir, err)
+	}
+	if entry != nil {
+		return nil
+	}
+	dir, name := util.FullPath(user.HomeDir).DirAndName()
+	return filer_pb.Mkdir(s, dir, name, func(entry *filer_pb.Entry) {
+		entry.Attributes.Uid = user.Uid
+		entry.Attributes.Gid = user.Gid
+	})
+}
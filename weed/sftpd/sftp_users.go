@@ -0,0 +1,64 @@
+package sftpd
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chrislusf/seaweedfs/weed/security/users"
+)
+
+// UserStore adds the parsed public keys of the users, to authenticate the ssh connections
+type UserStore struct {
+	*users.UserStore
+	publicKeys map[string][]ssh.PublicKey
+}
+
+// LoadUserStore reads the users from a json file, in the format of users.LoadUserStore
+func LoadUserStore(fileName string) (*UserStore, error) {
+	store, err := users.LoadUserStore(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return newUserStore(store)
+}
+
+func ParseUserStore(data []byte) (*UserStore, error) {
+	store, err := users.ParseUserStore(data)
+	if err != nil {
+		return nil, err
+	}
+	return newUserStore(store)
+}
+
+func newUserStore(store *users.UserStore) (*UserStore, error) {
+	s := &UserStore{
+		UserStore:  store,
+		publicKeys: make(map[string][]ssh.PublicKey),
+	}
+	for _, user := range store.Users {
+		for _, key := range user.PublicKeys {
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+			if err != nil {
+				return nil, fmt.Errorf("user %s: parse public key %q: %v", user.Username, key, err)
+			}
+			s.publicKeys[user.Username] = append(s.publicKeys[user.Username], publicKey)
+		}
+	}
+	return s, nil
+}
+
+func (store *UserStore) CheckPublicKey(username string, key ssh.PublicKey) (*users.User, error) {
+	user, found := store.GetUser(username)
+	if !found {
+		return nil, fmt.Errorf("unknown public key for %s", username)
+	}
+	marshaled := key.Marshal()
+	for _, publicKey := range store.publicKeys[username] {
+		if bytes.Equal(publicKey.Marshal(), marshaled) {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown public key for %s", username)
+}
@@ -0,0 +1,44 @@
+package sftpd
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestUserStorePublicKeys(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+		key, _ := ssh.NewPublicKey(publicKey)
+		return key
+	}
+	authorized, other := newKey(), newKey()
+
+	store, err := ParseUserStore([]byte(`{"users":[
+		{"username":"partner1","publicKeys":["` + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(authorized))) + `"],"homeDir":"/partners/partner1"},
+		{"username":"partner2","password":"pass","homeDir":"/partners/partner2"}
+	]}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if user, err := store.CheckPublicKey("partner1", authorized); err != nil || user.HomeDir != "/partners/partner1" {
+		t.Errorf("authorized key: %v %v", user, err)
+	}
+	if _, err := store.CheckPublicKey("partner1", other); err == nil {
+		t.Errorf("other key accepted")
+	}
+	if _, err := store.CheckPublicKey("partner2", authorized); err == nil {
+		t.Errorf("key of another user accepted")
+	}
+	if _, err := store.CheckPassword("partner2", "pass"); err != nil {
+		t.Errorf("password: %v", err)
+	}
+
+	if _, err := ParseUserStore([]byte(`{"users":[{"username":"a","publicKeys":["not a key"],"homeDir":"/a"}]}`)); err == nil {
+		t.Errorf("invalid public key accepted")
+	}
+}
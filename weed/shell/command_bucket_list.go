@@ -17,6 +17,11 @@ func init() {
 type commandBucketList struct {
 }
 
+type bucketInfo struct {
+	Name        string `json:"name"`
+	Replication string `json:"replication,omitempty"`
+}
+
 func (c *commandBucketList) Name() string {
 	return "bucket.list"
 }
@@ -45,7 +50,9 @@ func (c *commandBucketList) Do(args []string, commandEnv *CommandEnv, writer io.
 		return fmt.Errorf("read buckets: %v", err)
 	}
 
+	buckets := []bucketInfo{}
 	err = filer_pb.List(commandEnv, filerBucketsPath, "", func(entry *filer_pb.Entry, isLast bool) error {
+		buckets = append(buckets, bucketInfo{Name: entry.Name, Replication: entry.Attributes.Replication})
 		if entry.Attributes.Replication == "" || entry.Attributes.Replication == "000" {
 			fmt.Fprintf(writer, "  %s\n", entry.Name)
 		} else {
@@ -56,6 +63,7 @@ func (c *commandBucketList) Do(args []string, commandEnv *CommandEnv, writer io.
 	if err != nil {
 		return fmt.Errorf("list buckets under %v: %v", filerBucketsPath, err)
 	}
+	commandEnv.setJsonResult(buckets)
 
 	return err
 
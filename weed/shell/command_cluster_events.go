@@ -0,0 +1,121 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandClusterEvents{})
+}
+
+type commandClusterEvents struct {
+}
+
+func (c *commandClusterEvents) Name() string {
+	return "cluster.events"
+}
+
+func (c *commandClusterEvents) Help() string {
+	return `show the history of topology changes recorded by the master
+
+	cluster.events                                  # events in the last hour
+	cluster.events -since=24h -type=server.         # volume servers joined or left in the last day
+	cluster.events -since=2020-09-01T10:00:00 -until=2020-09-01T11:00:00
+	cluster.events -volumeId=123 -since=168h        # where volume 123 has been created, moved, or marked readonly
+	cluster.events -node=192.168.1.2:8080 -limit=100
+
+	-since and -until take either a duration before now, or a local time as 2006-01-02T15:04:05, or an RFC3339 time.
+
+	The event types are
+		server.joined, server.left, leader.changed,
+		volume.created, volume.added, volume.removed, volume.readonly, volume.writable, volume.full,
+		ec.shards.added, ec.shards.removed
+	A volume move shows up as volume.added on the new server and volume.removed on the old one.
+
+	The master keeps the latest events in memory. Start the master with -eventLog=<file>
+	to also keep them across restarts.
+
+`
+}
+
+func (c *commandClusterEvents) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	eventsCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	since := eventsCommand.String("since", "1h", "show events after this time or duration ago")
+	until := eventsCommand.String("until", "", "show events before this time or duration ago, default to now")
+	eventType := eventsCommand.String("type", "", "only show events of this type, or with this type prefix")
+	node := eventsCommand.String("node", "", "only show events of this volume server <host>:<port>")
+	volumeId := eventsCommand.Uint("volumeId", 0, "only show events of this volume id")
+	collection := eventsCommand.String("collection", "", "only show events of this collection")
+	limit := eventsCommand.Uint("limit", 1000, "show at most the latest this many events")
+	if err = eventsCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	sinceTime, err := parseEventTime(*since, now)
+	if err != nil {
+		return fmt.Errorf("parse -since: %v", err)
+	}
+	var untilNs int64
+	if *until != "" {
+		untilTime, err := parseEventTime(*until, now)
+		if err != nil {
+			return fmt.Errorf("parse -until: %v", err)
+		}
+		untilNs = untilTime.UnixNano()
+	}
+
+	var resp *master_pb.TopologyEventsResponse
+	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err = client.TopologyEvents(context.Background(), &master_pb.TopologyEventsRequest{
+			SinceNs:    sinceTime.UnixNano(),
+			UntilNs:    untilNs,
+			Limit:      uint32(*limit),
+			Type:       *eventType,
+			DataNode:   *node,
+			VolumeId:   uint32(*volumeId),
+			Collection: *collection,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, event := range resp.Events {
+		fmt.Fprintf(writer, "%s %-17s", time.Unix(0, event.TsNs).Format("2006-01-02 15:04:05.000"), event.Type)
+		if event.DataNode != "" {
+			fmt.Fprintf(writer, " %s", event.DataNode)
+		}
+		if event.VolumeId != 0 {
+			fmt.Fprintf(writer, " volume %d", event.VolumeId)
+		}
+		if event.Collection != "" {
+			fmt.Fprintf(writer, " collection:%q", event.Collection)
+		}
+		if event.Detail != "" {
+			fmt.Fprintf(writer, " %s", event.Detail)
+		}
+		fmt.Fprintln(writer)
+	}
+	fmt.Fprintf(writer, "%d events\n", len(resp.Events))
+
+	return nil
+}
+
+func parseEventTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,162 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandClusterProfile{})
+}
+
+type commandClusterProfile struct {
+}
+
+func (c *commandClusterProfile) Name() string {
+	return "cluster.profile"
+}
+
+func (c *commandClusterProfile) Help() string {
+	return `collect pprof profiles from a server and save them locally
+
+	cluster.profile -volumeServer=<host>:<port> [-profile=cpu,heap,goroutine] [-seconds=30] [-dir=.]
+	cluster.profile -filer=<host>:<port> -profile=cpu
+	cluster.profile -master=<host>:<port> -profile=heap
+	cluster.profile -profile=goroutine    # profile the current master leader
+
+	The profiles are collected through the server's grpc port, so no debug http port needs to be exposed.
+	Supported profiles are cpu, trace, heap, allocs, goroutine, block, mutex, threadcreate.
+	The cpu profile and the trace are collected for the given seconds, the others are instant snapshots.
+
+	The files are saved as <dir>/<server>.<profile>.<timestamp>.pprof, and can be viewed by
+		go tool pprof <file>
+
+`
+}
+
+func (c *commandClusterProfile) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	profileCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	master := profileCommand.String("master", "", "the master server to profile, default to the current leader")
+	volumeServer := profileCommand.String("volumeServer", "", "the volume server to profile")
+	filer := profileCommand.String("filer", "", "the filer to profile")
+	profiles := profileCommand.String("profile", "cpu,heap,goroutine", "comma separated profile names")
+	seconds := profileCommand.Int("seconds", 30, "seconds to collect the cpu profile or trace")
+	dir := profileCommand.String("dir", ".", "local directory to save the profiles")
+	if err = profileCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	var server string
+	var collect func(profileName string, dst io.Writer) error
+
+	switch {
+	case *volumeServer != "":
+		server = *volumeServer
+		collect = func(profileName string, dst io.Writer) error {
+			return operation.WithVolumeServerClient(server, commandEnv.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+				stream, err := client.Profile(context.Background(), &volume_server_pb.ProfileRequest{ProfileName: profileName, Seconds: uint32(*seconds)})
+				if err != nil {
+					return err
+				}
+				return receiveProfile(dst, func() ([]byte, error) {
+					resp, err := stream.Recv()
+					return resp.GetData(), err
+				})
+			})
+		}
+	case *filer != "":
+		server = *filer
+		collect = func(profileName string, dst io.Writer) error {
+			return pb.WithFilerClient(server, commandEnv.option.GrpcDialOption, func(client filer_pb.SeaweedFilerClient) error {
+				stream, err := client.Profile(context.Background(), &filer_pb.ProfileRequest{ProfileName: profileName, Seconds: uint32(*seconds)})
+				if err != nil {
+					return err
+				}
+				return receiveProfile(dst, func() ([]byte, error) {
+					resp, err := stream.Recv()
+					return resp.GetData(), err
+				})
+			})
+		}
+	default:
+		server = *master
+		withMasterClient := func(fn func(client master_pb.SeaweedClient) error) error {
+			return pb.WithMasterClient(server, commandEnv.option.GrpcDialOption, fn)
+		}
+		if server == "" {
+			server = commandEnv.MasterClient.GetMaster()
+			withMasterClient = commandEnv.MasterClient.WithClient
+		}
+		collect = func(profileName string, dst io.Writer) error {
+			return withMasterClient(func(client master_pb.SeaweedClient) error {
+				stream, err := client.Profile(context.Background(), &master_pb.ProfileRequest{ProfileName: profileName, Seconds: uint32(*seconds)})
+				if err != nil {
+					return err
+				}
+				return receiveProfile(dst, func() ([]byte, error) {
+					resp, err := stream.Recv()
+					return resp.GetData(), err
+				})
+			})
+		}
+	}
+
+	for _, profileName := range strings.Split(*profiles, ",") {
+		profileName = strings.TrimSpace(profileName)
+		if profileName == "" {
+			continue
+		}
+		if profileName == "cpu" || profileName == "trace" {
+			fmt.Fprintf(writer, "collecting %s %s for %d seconds ...\n", server, profileName, *seconds)
+		}
+		fileName := filepath.Join(*dir, fmt.Sprintf("%s.%s.%s.pprof",
+			strings.Replace(server, ":", "_", -1), profileName, time.Now().Format("20060102-150405")))
+		if err = saveProfile(fileName, profileName, collect); err != nil {
+			return fmt.Errorf("collect %s %s: %v", server, profileName, err)
+		}
+		fmt.Fprintf(writer, "saved %s\n", fileName)
+	}
+
+	return nil
+}
+
+func saveProfile(fileName, profileName string, collect func(profileName string, dst io.Writer) error) error {
+	dst, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err = collect(profileName, dst); err != nil {
+		dst.Close()
+		os.Remove(fileName)
+		return err
+	}
+	return dst.Close()
+}
+
+func receiveProfile(dst io.Writer, recv func() ([]byte, error)) error {
+	for {
+		data, err := recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = dst.Write(data); err != nil {
+			return err
+		}
+	}
+}
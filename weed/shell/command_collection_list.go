@@ -30,6 +30,7 @@ func (c *commandCollectionList) Do(args []string, commandEnv *CommandEnv, writer
 		return err
 	}
 
+	commandEnv.setJsonResult(append([]string{}, collections...))
 	for _, c := range collections {
 		fmt.Fprintf(writer, "collection:\"%s\"\n", c)
 	}
@@ -183,7 +183,7 @@ func collectEcNodes(commandEnv *CommandEnv, selectedDataCenter string) (ecNodes
 	// list all possible locations
 	var resp *master_pb.VolumeListResponse
 	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
-		resp, err = client.VolumeList(context.Background(), &master_pb.VolumeListRequest{})
+		resp, err = master_pb.ReadVolumeList(context.Background(), client)
 		return err
 	})
 	if err != nil {
@@ -43,6 +43,9 @@ func (c *commandFsDu) Do(args []string, commandEnv *CommandEnv, writer io.Writer
 	var blockCount, byteCount uint64
 	dir, name := util.FullPath(path).DirAndName()
 	blockCount, byteCount, err = duTraverseDirectory(writer, commandEnv, dir, name)
+	if err == nil {
+		commandEnv.setJsonResult(&duResult{Path: path, BlockCount: blockCount, ByteCount: byteCount})
+	}
 
 	if name == "" && err == nil {
 		fmt.Fprintf(writer, "block:%4d\tbyte:%10d\t%s\n", blockCount, byteCount, dir)
@@ -52,6 +55,12 @@ func (c *commandFsDu) Do(args []string, commandEnv *CommandEnv, writer io.Writer
 
 }
 
+type duResult struct {
+	Path       string `json:"path"`
+	BlockCount uint64 `json:"block_count"`
+	ByteCount  uint64 `json:"byte_count"`
+}
+
 func duTraverseDirectory(writer io.Writer, filerClient filer_pb.FilerClient, dir, name string) (blockCount, byteCount uint64, err error) {
 
 	err = filer_pb.ReadDirAllEntries(filerClient, util.FullPath(dir), name, func(entry *filer_pb.Entry, isLast bool) error {
@@ -20,6 +20,15 @@ func init() {
 type commandFsLs struct {
 }
 
+type lsEntry struct {
+	FullPath    string `json:"full_path"`
+	IsDirectory bool   `json:"is_directory"`
+	Size        uint64 `json:"size"`
+	ChunkCount  int    `json:"chunk_count"`
+	Mode        string `json:"mode"`
+	Mtime       int64  `json:"mtime"`
+}
+
 func (c *commandFsLs) Name() string {
 	return "fs.ls"
 }
@@ -61,6 +70,7 @@ func (c *commandFsLs) Do(args []string, commandEnv *CommandEnv, writer io.Writer
 
 	dir, name := util.FullPath(path).DirAndName()
 	entryCount := 0
+	entries := []lsEntry{}
 
 	err = filer_pb.ReadDirAllEntries(commandEnv, util.FullPath(dir), name, func(entry *filer_pb.Entry, isLast bool) error {
 
@@ -69,6 +79,14 @@ func (c *commandFsLs) Do(args []string, commandEnv *CommandEnv, writer io.Writer
 		}
 
 		entryCount++
+		entries = append(entries, lsEntry{
+			FullPath:    string(util.NewFullPath(dir, entry.Name)),
+			IsDirectory: entry.IsDirectory,
+			Size:        filer2.TotalSize(entry.Chunks),
+			ChunkCount:  len(entry.Chunks),
+			Mode:        os.FileMode(entry.Attributes.FileMode).String(),
+			Mtime:       entry.Attributes.Mtime,
+		})
 
 		if isLongFormat {
 			fileMode := os.FileMode(entry.Attributes.FileMode)
@@ -103,6 +121,10 @@ func (c *commandFsLs) Do(args []string, commandEnv *CommandEnv, writer io.Writer
 		return nil
 	})
 
+	if err == nil {
+		commandEnv.setJsonResult(entries)
+	}
+
 	if isLongFormat && err == nil {
 		fmt.Fprintf(writer, "total %d\n", entryCount)
 	}
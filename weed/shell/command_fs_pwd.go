@@ -22,6 +22,7 @@ func (c *commandFsPwd) Help() string {
 
 func (c *commandFsPwd) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
 
+	commandEnv.setJsonResult(map[string]string{"directory": commandEnv.option.Directory})
 	fmt.Fprintf(writer, "%s\n", commandEnv.option.Directory)
 
 	return nil
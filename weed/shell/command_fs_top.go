@@ -0,0 +1,82 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandFsTop{})
+}
+
+type commandFsTop struct {
+}
+
+func (c *commandFsTop) Name() string {
+	return "fs.top"
+}
+
+func (c *commandFsTop) Help() string {
+	return `show the largest files and directories under a directory
+
+	fs.top /dir                        # the 10 largest files and directories
+	fs.top -n 20 /dir
+	fs.top -maxEntries 1000000 /dir    # only sample the first 1000000 entries
+	fs.top -maxAge 1h /dir             # reuse the result if the filer computed it within 1 hour
+
+	The size of a directory includes all its sub directories.
+	The filer walks the directory tree, which could take a while for large directories.
+`
+}
+
+func (c *commandFsTop) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	topCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	limit := topCommand.Int("n", 10, "show this many files and directories")
+	maxEntries := topCommand.Uint64("maxEntries", 0, "stop after visiting this many entries, 0 means no limit")
+	maxAge := topCommand.Duration("maxAge", 0, "reuse a result computed within this duration")
+	if err = topCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	path, err := commandEnv.parseUrl(findInputDirectory(topCommand.Args()))
+	if err != nil {
+		return err
+	}
+
+	var resp *filer_pb.TopEntriesResponse
+	err = commandEnv.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		resp, err = client.TopEntries(context.Background(), &filer_pb.TopEntriesRequest{
+			Directory:     path,
+			Limit:         uint32(*limit),
+			MaxEntries:    *maxEntries,
+			MaxAgeSeconds: uint32(maxAge.Seconds()),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "%s: %d bytes in %d files, %d directories, computed at %v\n",
+		path, resp.TotalSize, resp.FileCount, resp.DirectoryCount, time.Unix(0, resp.ComputedAtNs).Format(time.RFC3339))
+	if resp.Truncated {
+		fmt.Fprintf(writer, "only the first %d entries are visited\n", *maxEntries)
+	}
+
+	fmt.Fprintf(writer, "\nlargest directories:\n")
+	for _, e := range resp.Directories {
+		fmt.Fprintf(writer, "%16d bytes %10d files  %s  %s\n", e.Size, e.FileCount, time.Unix(e.Mtime, 0).Format("2006-01-02 15:04"), e.FullPath)
+	}
+	fmt.Fprintf(writer, "\nlargest files:\n")
+	for _, e := range resp.Files {
+		fmt.Fprintf(writer, "%16d bytes  %s  %s\n", e.Size, time.Unix(e.Mtime, 0).Format("2006-01-02 15:04"), e.FullPath)
+	}
+
+	return nil
+}
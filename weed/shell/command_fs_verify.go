@@ -0,0 +1,250 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+func init() {
+	Commands = append(Commands, &commandFsVerify{})
+}
+
+type commandFsVerify struct {
+	env               *CommandEnv
+	volumeIdToServers map[uint32][]string
+}
+
+func (c *commandFsVerify) Name() string {
+	return "fs.verify"
+}
+
+func (c *commandFsVerify) Help() string {
+	return `verify that the file chunks referenced by filer entries exist on the volume servers
+
+	fs.verify /                  # verify all files
+	fs.verify -v /path/to/dir    # also print each verified file
+	fs.verify -apply /path/to/dir
+
+	For each chunk, every volume server holding the volume is asked for the needle, and
+	the needle cookie, size, and etag are compared with what the filer entry recorded.
+	Chunks inside chunk manifests are verified too.
+
+	This is the reverse of volume.fsck, which finds data on volume servers that no filer entry refers to.
+
+	With -apply, chunk references that all volume servers of their volume report as not found or deleted
+	are removed from the filer entries. The missing ranges of these files will read as zeros.
+	Chunks of unknown volumes, unreachable servers, other failed checks, or inside chunk manifests are only reported.
+
+`
+}
+
+func (c *commandFsVerify) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	fsVerifyCommand := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	verbose := fsVerifyCommand.Bool("v", false, "print out each verified file")
+	applyFix := fsVerifyCommand.Bool("apply", false, "remove the dangling chunk references from the filer entries")
+	if err = fsVerifyCommand.Parse(args); err != nil {
+		return nil
+	}
+
+	if *applyFix {
+		if err = commandEnv.confirmIsLocked(); err != nil {
+			return
+		}
+	}
+
+	path, parseErr := commandEnv.parseUrl(findInputDirectory(fsVerifyCommand.Args()))
+	if parseErr != nil {
+		return parseErr
+	}
+
+	c.env = commandEnv
+	if err = c.collectVolumeServers(); err != nil {
+		return fmt.Errorf("collect volume locations: %v", err)
+	}
+
+	var chunkCount, problemCount, danglingCount, fixedEntryCount uint64
+
+	err = doTraverseBfsAndSaving(commandEnv, writer, path, false, func(outputChan chan interface{}) {
+		for item := range outputChan {
+			fmt.Fprint(writer, item.(string))
+		}
+	}, func(entry *filer_pb.FullEntry, outputChan chan interface{}) error {
+		if entry.Entry.IsDirectory {
+			return nil
+		}
+		fullPath := util.NewFullPath(entry.Dir, entry.Entry.Name)
+
+		var report strings.Builder
+		var keptChunks []*filer_pb.FileChunk
+		for _, chunk := range entry.Entry.Chunks {
+			atomic.AddUint64(&chunkCount, 1)
+			problems, isDangling := c.verifyChunk(chunk)
+			for _, problem := range problems {
+				atomic.AddUint64(&problemCount, 1)
+				fmt.Fprintf(&report, "%s chunk %s: %s\n", fullPath, chunk.GetFileIdString(), problem)
+			}
+			if isDangling {
+				atomic.AddUint64(&danglingCount, 1)
+				continue
+			}
+			keptChunks = append(keptChunks, chunk)
+
+			if chunk.IsChunkManifest && len(problems) == 0 {
+				dataChunks, _, resolveErr := filer2.ResolveChunkManifest(filer2.LookupFn(commandEnv), []*filer_pb.FileChunk{chunk})
+				if resolveErr != nil {
+					atomic.AddUint64(&problemCount, 1)
+					fmt.Fprintf(&report, "%s chunk %s: %v\n", fullPath, chunk.GetFileIdString(), resolveErr)
+					continue
+				}
+				for _, dataChunk := range dataChunks {
+					atomic.AddUint64(&chunkCount, 1)
+					subProblems, isSubDangling := c.verifyChunk(dataChunk)
+					for _, problem := range subProblems {
+						atomic.AddUint64(&problemCount, 1)
+						fmt.Fprintf(&report, "%s chunk %s in manifest %s: %s\n", fullPath, dataChunk.GetFileIdString(), chunk.GetFileIdString(), problem)
+					}
+					if isSubDangling {
+						atomic.AddUint64(&danglingCount, 1)
+					}
+				}
+			}
+		}
+
+		if *applyFix && len(keptChunks) < len(entry.Entry.Chunks) {
+			entry.Entry.Chunks = keptChunks
+			if updateErr := c.updateEntry(entry); updateErr != nil {
+				fmt.Fprintf(&report, "%s: failed to remove dangling chunks: %v\n", fullPath, updateErr)
+			} else {
+				atomic.AddUint64(&fixedEntryCount, 1)
+				fmt.Fprintf(&report, "%s: removed dangling chunks\n", fullPath)
+			}
+		}
+
+		if *verbose && report.Len() == 0 {
+			fmt.Fprintf(&report, "%s: ok\n", fullPath)
+		}
+		if report.Len() > 0 {
+			outputChan <- report.String()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "verified %d chunks: %d problems, %d dangling chunk references\n", chunkCount, problemCount, danglingCount)
+	if *applyFix {
+		fmt.Fprintf(writer, "removed dangling chunk references from %d entries\n", fixedEntryCount)
+	} else if danglingCount > 0 {
+		fmt.Fprintf(writer, "use \"fs.verify -apply\" to remove the dangling chunk references\n")
+	}
+
+	return nil
+}
+
+func (c *commandFsVerify) collectVolumeServers() error {
+
+	var resp *master_pb.VolumeListResponse
+	err := c.env.MasterClient.WithClient(func(client master_pb.SeaweedClient) (err error) {
+		resp, err = master_pb.ReadVolumeList(context.Background(), client)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.volumeIdToServers = make(map[uint32][]string)
+	eachDataNode(resp.TopologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		for _, vi := range dn.VolumeInfos {
+			c.volumeIdToServers[vi.Id] = append(c.volumeIdToServers[vi.Id], dn.Id)
+		}
+		for _, ecShardInfo := range dn.EcShardInfos {
+			// any server with some of the ec shards can read the needle from the other shards
+			if _, found := c.volumeIdToServers[ecShardInfo.Id]; !found {
+				c.volumeIdToServers[ecShardInfo.Id] = []string{dn.Id}
+			}
+		}
+	})
+	return nil
+}
+
+// verifyChunk checks the chunk on all servers of its volume.
+// The chunk is dangling if all these servers confirm the needle is missing.
+func (c *commandFsVerify) verifyChunk(chunk *filer_pb.FileChunk) (problems []string, isDangling bool) {
+
+	fid, err := needle.ParseFileIdFromString(chunk.GetFileIdString())
+	if err != nil {
+		return []string{fmt.Sprintf("invalid file id: %v", err)}, false
+	}
+
+	servers, found := c.volumeIdToServers[uint32(fid.VolumeId)]
+	if !found {
+		return []string{fmt.Sprintf("volume %d not found", fid.VolumeId)}, false
+	}
+
+	missingCount := 0
+	for _, server := range servers {
+		var resp *volume_server_pb.VolumeNeedleStatusResponse
+		err = operation.WithVolumeServerClient(server, c.env.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) (err error) {
+			resp, err = client.VolumeNeedleStatus(context.Background(), &volume_server_pb.VolumeNeedleStatusRequest{
+				VolumeId: uint32(fid.VolumeId),
+				NeedleId: uint64(fid.Key),
+			})
+			return err
+		})
+		if err != nil {
+			if isNeedleMissing(err) {
+				missingCount++
+				problems = append(problems, fmt.Sprintf("missing on %s", server))
+			} else {
+				problems = append(problems, fmt.Sprintf("unknown on %s: %v", server, err))
+			}
+			continue
+		}
+		if resp.Cookie != uint32(fid.Cookie) {
+			problems = append(problems, fmt.Sprintf("cookie %x on %s, expected %x", resp.Cookie, server, uint32(fid.Cookie)))
+		}
+		// the stored size differs from the recorded size for compressed or encrypted data
+		if !chunk.IsCompressed && !resp.IsCompressed && len(chunk.CipherKey) == 0 && uint64(resp.DataSize) != chunk.Size {
+			problems = append(problems, fmt.Sprintf("size %d on %s, expected %d", resp.DataSize, server, chunk.Size))
+		}
+		// only etags from the volume server are crc based, others are e.g. md5 from s3 clients
+		if len(chunk.ETag) == len(resp.Etag) && chunk.ETag != resp.Etag {
+			problems = append(problems, fmt.Sprintf("etag %s on %s, expected %s", resp.Etag, server, chunk.ETag))
+		}
+	}
+
+	return problems, missingCount == len(servers)
+}
+
+// isNeedleMissing is only true if the volume server has the volume, and reports the needle as not found or deleted.
+// Other errors, e.g. the volume is not on the server or the server is unreachable, leave the chunk state unknown.
+func isNeedleMissing(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+func (c *commandFsVerify) updateEntry(entry *filer_pb.FullEntry) error {
+	return c.env.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: entry.Dir,
+			Entry:     entry.Entry,
+		})
+		return err
+	})
+}
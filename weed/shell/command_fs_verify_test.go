@@ -0,0 +1,27 @@
+package shell
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsNeedleMissing(t *testing.T) {
+	var tests = []struct {
+		err      error
+		expected bool
+	}{
+		{status.Errorf(codes.NotFound, "needle not found %d", 1), true},
+		{status.Errorf(codes.NotFound, "needle %d: already deleted", 1), true},
+		{status.Errorf(codes.Unknown, "volume not found %d", 3), false},
+		{status.Errorf(codes.Unavailable, "connection error: dial tcp: lookup volume1: no such host"), false},
+		{fmt.Errorf("getOrCreateConnection localhost:18080: not found"), false},
+	}
+	for _, tt := range tests {
+		if isNeedleMissing(tt.err) != tt.expected {
+			t.Errorf("isNeedleMissing(%v) should be %v", tt.err, tt.expected)
+		}
+	}
+}
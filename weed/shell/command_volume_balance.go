@@ -74,7 +74,7 @@ func (c *commandVolumeBalance) Do(args []string, commandEnv *CommandEnv, writer
 
 	var resp *master_pb.VolumeListResponse
 	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
-		resp, err = client.VolumeList(context.Background(), &master_pb.VolumeListRequest{})
+		resp, err = master_pb.ReadVolumeList(context.Background(), client)
 		return err
 	})
 	if err != nil {
@@ -58,7 +58,7 @@ func (c *commandVolumeConfigureReplication) Do(args []string, commandEnv *Comman
 
 	var resp *master_pb.VolumeListResponse
 	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
-		resp, err = client.VolumeList(context.Background(), &master_pb.VolumeListRequest{})
+		resp, err = master_pb.ReadVolumeList(context.Background(), client)
 		return err
 	})
 	if err != nil {
@@ -33,13 +33,14 @@ func (c *commandVolumeList) Do(args []string, commandEnv *CommandEnv, writer io.
 
 	var resp *master_pb.VolumeListResponse
 	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
-		resp, err = client.VolumeList(context.Background(), &master_pb.VolumeListRequest{})
+		resp, err = master_pb.ReadVolumeList(context.Background(), client)
 		return err
 	})
 	if err != nil {
 		return err
 	}
 
+	commandEnv.setJsonResult(resp)
 	writeTopologyInfo(writer, resp.TopologyInfo, resp.VolumeSizeLimitMb)
 	return nil
 }
@@ -0,0 +1,82 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
+)
+
+func init() {
+	Commands = append(Commands, &commandVolumeTasks{})
+}
+
+type commandVolumeTasks struct {
+}
+
+func (c *commandVolumeTasks) Name() string {
+	return "volume.tasks"
+}
+
+func (c *commandVolumeTasks) Help() string {
+	return `list in-flight vacuum, volume copy, and erasure coding tasks on all volume servers
+
+	volume.tasks
+
+	For each task, the progress, current phase, and estimated remaining time are shown.
+
+`
+}
+
+func (c *commandVolumeTasks) Do(args []string, commandEnv *CommandEnv, writer io.Writer) (err error) {
+
+	var resp *master_pb.VolumeListResponse
+	err = commandEnv.MasterClient.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err = master_pb.ReadVolumeList(context.Background(), client)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var dataNodes []string
+	eachDataNode(resp.TopologyInfo, func(dc string, rack RackId, dn *master_pb.DataNodeInfo) {
+		dataNodes = append(dataNodes, dn.Id)
+	})
+	sort.Strings(dataNodes)
+
+	taskCount := 0
+	for _, dataNode := range dataNodes {
+		err = operation.WithVolumeServerClient(dataNode, commandEnv.option.GrpcDialOption, func(client volume_server_pb.VolumeServerClient) error {
+			statusResp, statusErr := client.VolumeServerMaintenanceStatus(context.Background(), &volume_server_pb.VolumeServerMaintenanceStatusRequest{})
+			if statusErr != nil {
+				return statusErr
+			}
+			for _, t := range statusResp.Tasks {
+				taskCount++
+				fmt.Fprintf(writer, "%s %s volume %d collection:%q phase:%s", dataNode, t.Type, t.VolumeId, t.Collection, t.Phase)
+				if t.TotalBytes > 0 {
+					fmt.Fprintf(writer, " processed:%d/%d (%.1f%%)", t.ProcessedBytes, t.TotalBytes, float64(t.ProcessedBytes)*100/float64(t.TotalBytes))
+				}
+				fmt.Fprintf(writer, " elapsed:%v", time.Since(time.Unix(0, t.StartedAtNs)).Round(time.Second))
+				if t.EtaSeconds > 0 {
+					fmt.Fprintf(writer, " eta:%v", time.Duration(t.EtaSeconds)*time.Second)
+				}
+				fmt.Fprintln(writer)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(writer, "%s: %v\n", dataNode, err)
+		}
+	}
+
+	fmt.Fprintf(writer, "%d tasks in progress\n", taskCount)
+
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 type ShellOptions struct {
 	Masters        *string
 	GrpcDialOption grpc.DialOption
+	Scripting      bool // use the scripting syntax in the interactive shell
 	// shell transient context
 	FilerHost string
 	FilerPort int64
@@ -30,6 +31,7 @@ type CommandEnv struct {
 	MasterClient *wdclient.MasterClient
 	option       ShellOptions
 	locker       *exclusive_locks.ExclusiveLocker
+	jsonResult   interface{}
 }
 
 type command interface {
@@ -52,6 +54,11 @@ func NewCommandEnv(options ShellOptions) *CommandEnv {
 	return ce
 }
 
+// setJsonResult keeps the structured result of the running command, which --json prints instead of the text output
+func (ce *CommandEnv) setJsonResult(result interface{}) {
+	ce.jsonResult = result
+}
+
 func (ce *CommandEnv) parseUrl(input string) (path string, err error) {
 	if strings.HasPrefix(input, "http") {
 		err = fmt.Errorf("http://<filer>:<port> prefix is not supported any more")
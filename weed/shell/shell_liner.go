@@ -7,6 +7,7 @@ import (
 	"path"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/peterh/liner"
@@ -36,6 +37,11 @@ func RunShell(options ShellOptions) {
 	go commandEnv.MasterClient.KeepConnectedToMaster()
 	commandEnv.MasterClient.WaitUntilConnected()
 
+	if options.Scripting {
+		runScriptingShell(commandEnv)
+		return
+	}
+
 	for {
 		cmd, err := line.Prompt("> ")
 		if err != nil {
@@ -72,24 +78,61 @@ func processEachCmd(reg *regexp.Regexp, cmd string, commandEnv *CommandEnv) bool
 		} else if cmd == "exit" || cmd == "quit" {
 			return true
 		} else {
-			foundCommand := false
-			for _, c := range Commands {
-				if c.Name() == cmd || c.Name() == "fs."+cmd {
-					if err := c.Do(args, commandEnv, os.Stdout); err != nil {
-						fmt.Fprintf(os.Stderr, "error: %v\n", err)
-					}
-					foundCommand = true
-				}
-			}
-			if !foundCommand {
-				fmt.Fprintf(os.Stderr, "unknown command: %v\n", cmd)
-			}
+			runCommand(commandEnv, append([]string{cmd}, args...), os.Stdout, os.Stderr)
 		}
 
 	}
 	return false
 }
 
+// runScriptingShell reads the commands with the scripting syntax, and prompts for more lines until the blocks are closed
+func runScriptingShell(commandEnv *CommandEnv) {
+	runner := NewScriptRunner(commandEnv, os.Stderr)
+	prompt := "> "
+	for {
+		cmd, err := line.Prompt(prompt)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("%v\n", err)
+			}
+			return
+		}
+
+		if strings.TrimSpace(cmd) != "" {
+			line.AppendHistory(cmd)
+		}
+
+		needMore, exit, err := runner.Feed(cmd, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		if exit {
+			return
+		}
+		prompt = "> "
+		if needMore {
+			prompt = ". "
+		}
+	}
+}
+
+// RunShellScript runs the script non-interactively.
+// The args are available to the script as $1, $2, ...
+func RunShellScript(options ShellOptions, script io.Reader, args []string) error {
+
+	commandEnv := NewCommandEnv(options)
+
+	go commandEnv.MasterClient.KeepConnectedToMaster()
+	commandEnv.MasterClient.WaitUntilConnected()
+
+	runner := NewScriptRunner(commandEnv, os.Stderr)
+	for i, arg := range args {
+		runner.SetVariable(strconv.Itoa(i+1), arg)
+	}
+
+	return runner.RunScript(script, os.Stdout)
+}
+
 func printGenericHelp() {
 	msg :=
 		`Type:	"help <command>" for help on <command>
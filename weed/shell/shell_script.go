@@ -0,0 +1,606 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+Scripting in weed shell
+
+	name=value                 # set a variable
+	name=$(volume.list)        # capture the output of a command
+	echo $name ${name}         # variables are expanded in words, except in single quotes
+
+	for vid in 1 2 3           # loop over words, unquoted expansions are split by white space
+		volume.fix.replication -volumeId=$vid
+	end
+
+	if $status != 0            # compare strings, or numbers if both sides are numbers
+		echo "failed: $error"  # operators: == != < <= > >= contains
+	else
+		echo ok
+	end
+
+	volume.list --json         # print the result of the command as a json object
+	exit 1                     # stop the script, a non zero code fails it
+
+Statements are separated by new lines or ";". After each command, $status is 0 on success or 1 on failure,
+and $error is the error message. The scripting syntax applies to script files, and to the interactive shell
+started with -scripting. Otherwise the interactive shell parses the commands as before, where "#", "$" and "\"
+are kept in the args.
+*/
+
+type scriptStatement interface{}
+
+type commandStatement struct {
+	words []string
+}
+
+type assignStatement struct {
+	name  string
+	value string
+}
+
+type forStatement struct {
+	variable string
+	list     []string
+	body     []scriptStatement
+}
+
+type ifStatement struct {
+	condition []string
+	then      []scriptStatement
+	otherwise []scriptStatement
+}
+
+type errExit struct {
+	code int
+}
+
+func (e errExit) Error() string {
+	return fmt.Sprintf("exit %d", e.code)
+}
+
+// ScriptRunner parses and executes shell scripts against a CommandEnv.
+type ScriptRunner struct {
+	commandEnv *CommandEnv
+	errWriter  io.Writer
+
+	pending []string
+	depth   int
+}
+
+func NewScriptRunner(commandEnv *CommandEnv, errWriter io.Writer) *ScriptRunner {
+	return &ScriptRunner{
+		commandEnv: commandEnv,
+		errWriter:  errWriter,
+	}
+}
+
+// SetVariable sets a script variable, e.g. the positional arguments of a script
+func (s *ScriptRunner) SetVariable(name, value string) {
+	s.commandEnv.env[name] = value
+}
+
+// Feed adds one line of the interactive input. Lines are collected until all the for and if blocks are closed,
+// and then executed. needMore tells whether a block is still open.
+func (s *ScriptRunner) Feed(line string, writer io.Writer) (needMore bool, exit bool, err error) {
+	s.pending = append(s.pending, line)
+	for _, statement := range splitStatements(line) {
+		words := splitWords(statement)
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "for", "if":
+			s.depth++
+		case "end":
+			s.depth--
+		}
+	}
+	if s.depth > 0 {
+		return true, false, nil
+	}
+
+	script := strings.Join(s.pending, "\n")
+	s.pending, s.depth = nil, 0
+
+	err = s.Run(script, writer)
+	if _, isExit := err.(errExit); isExit {
+		return false, true, nil
+	}
+	return false, false, err
+}
+
+// RunScript executes all the lines read from reader.
+// It fails if the script exits with a non zero code.
+func (s *ScriptRunner) RunScript(reader io.Reader, writer io.Writer) error {
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	err := s.Run(strings.Join(lines, "\n"), writer)
+	if exit, isExit := err.(errExit); isExit && exit.code == 0 {
+		return nil
+	}
+	return err
+}
+
+func (s *ScriptRunner) Run(script string, writer io.Writer) error {
+	var statements [][]string
+	for _, statement := range splitStatements(script) {
+		if words := splitWords(statement); len(words) > 0 {
+			statements = append(statements, words)
+		}
+	}
+	block, rest, terminator, err := parseBlock(statements)
+	if err != nil {
+		return err
+	}
+	if terminator != "" || len(rest) > 0 {
+		return fmt.Errorf("unexpected %s", terminator)
+	}
+	return s.execBlock(block, writer)
+}
+
+func parseBlock(statements [][]string) (block []scriptStatement, rest [][]string, terminator string, err error) {
+	for len(statements) > 0 {
+		words := statements[0]
+		statements = statements[1:]
+		switch words[0] {
+		case "end", "else":
+			if len(words) > 1 {
+				return nil, nil, "", fmt.Errorf("unexpected words after %s: %v", words[0], words[1:])
+			}
+			return block, statements, words[0], nil
+		case "for":
+			if len(words) < 3 || words[2] != "in" || !isVariableName(words[1]) {
+				return nil, nil, "", fmt.Errorf("usage: for <name> in <words>... ; <statements> ; end")
+			}
+			stmt := &forStatement{variable: words[1], list: words[3:]}
+			var blockEnd string
+			stmt.body, statements, blockEnd, err = parseBlock(statements)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			if blockEnd != "end" {
+				return nil, nil, "", fmt.Errorf("for is not closed by end")
+			}
+			block = append(block, stmt)
+		case "if":
+			if len(words) < 2 {
+				return nil, nil, "", fmt.Errorf("usage: if <condition> ; <statements> ; [else ; <statements> ;] end")
+			}
+			stmt := &ifStatement{condition: words[1:]}
+			var blockEnd string
+			stmt.then, statements, blockEnd, err = parseBlock(statements)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			if blockEnd == "else" {
+				stmt.otherwise, statements, blockEnd, err = parseBlock(statements)
+				if err != nil {
+					return nil, nil, "", err
+				}
+			}
+			if blockEnd != "end" {
+				return nil, nil, "", fmt.Errorf("if is not closed by end")
+			}
+			block = append(block, stmt)
+		default:
+			if name, value, isAssign := parseAssignment(words); isAssign {
+				block = append(block, &assignStatement{name: name, value: value})
+			} else {
+				block = append(block, &commandStatement{words: words})
+			}
+		}
+	}
+	return block, nil, "", nil
+}
+
+func (s *ScriptRunner) execBlock(block []scriptStatement, writer io.Writer) error {
+	for _, statement := range block {
+		if err := s.execStatement(statement, writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScriptRunner) execStatement(statement scriptStatement, writer io.Writer) error {
+	switch stmt := statement.(type) {
+	case *assignStatement:
+		value, err := s.expand(stmt.value)
+		if err != nil {
+			return err
+		}
+		s.commandEnv.env[stmt.name] = value
+	case *forStatement:
+		var items []string
+		for _, word := range stmt.list {
+			value, err := s.expand(word)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(word, "\"") || strings.HasPrefix(word, "'") {
+				items = append(items, value)
+			} else {
+				items = append(items, strings.Fields(value)...)
+			}
+		}
+		for _, item := range items {
+			s.commandEnv.env[stmt.variable] = item
+			if err := s.execBlock(stmt.body, writer); err != nil {
+				return err
+			}
+		}
+	case *ifStatement:
+		var condition []string
+		for _, word := range stmt.condition {
+			value, err := s.expand(word)
+			if err != nil {
+				return err
+			}
+			condition = append(condition, value)
+		}
+		isTrue, err := evaluateCondition(condition)
+		if err != nil {
+			return err
+		}
+		if isTrue {
+			return s.execBlock(stmt.then, writer)
+		}
+		return s.execBlock(stmt.otherwise, writer)
+	case *commandStatement:
+		var args []string
+		for _, word := range stmt.words {
+			value, err := s.expand(word)
+			if err != nil {
+				return err
+			}
+			args = append(args, value)
+		}
+		return s.execCommand(args, writer)
+	}
+	return nil
+}
+
+func (s *ScriptRunner) execCommand(words []string, writer io.Writer) error {
+	cmd, args := strings.ToLower(words[0]), words[1:]
+
+	switch cmd {
+	case "exit", "quit":
+		code := 0
+		if len(args) > 0 {
+			var err error
+			if code, err = strconv.Atoi(args[0]); err != nil {
+				return fmt.Errorf("exit code %s: %v", args[0], err)
+			}
+		}
+		return errExit{code: code}
+	case "help", "?":
+		printHelp(words)
+		return nil
+	case "echo":
+		fmt.Fprintln(writer, strings.Join(args, " "))
+		return nil
+	}
+
+	if err := runCommand(s.commandEnv, words, writer, s.errWriter); err != nil {
+		s.commandEnv.env["status"] = "1"
+		s.commandEnv.env["error"] = err.Error()
+		return nil
+	}
+	s.commandEnv.env["status"] = "0"
+	s.commandEnv.env["error"] = ""
+	return nil
+}
+
+const jsonOutputFlag = "--json"
+
+type jsonCommandOutput struct {
+	Command string      `json:"command"`
+	Args    []string    `json:"args"`
+	Result  interface{} `json:"result,omitempty"`
+	Output  []string    `json:"output,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// runCommand runs one shell command, and prints the error to errWriter.
+// With --json, it prints one json object instead, with the structured result of the command if it has one,
+// or else the lines of its text output, and the error.
+func runCommand(commandEnv *CommandEnv, words []string, writer, errWriter io.Writer) error {
+	cmd := strings.ToLower(words[0])
+	args := []string{}
+	jsonOutput := false
+	for _, arg := range words[1:] {
+		if arg == jsonOutputFlag {
+			jsonOutput = true
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	var found command
+	for _, c := range Commands {
+		if c.Name() == cmd || c.Name() == "fs."+cmd {
+			found = c
+		}
+	}
+
+	out := writer
+	var output bytes.Buffer
+	if jsonOutput {
+		out = &output
+	}
+	commandEnv.jsonResult = nil
+
+	var err error
+	if found == nil {
+		err = fmt.Errorf("unknown command: %v", cmd)
+	} else {
+		cmd = found.Name()
+		err = found.Do(args, commandEnv, out)
+	}
+
+	if !jsonOutput {
+		if err != nil {
+			fmt.Fprintf(errWriter, "error: %v\n", err)
+		}
+		return err
+	}
+
+	result := jsonCommandOutput{
+		Command: cmd,
+		Args:    args,
+		Result:  commandEnv.jsonResult,
+	}
+	if result.Result == nil && output.Len() > 0 {
+		result.Output = strings.Split(strings.TrimRight(output.String(), "\n"), "\n")
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(result); encodeErr != nil {
+		return encodeErr
+	}
+	return err
+}
+
+// expand removes the quotes, and replaces $name, ${name}, and $(commands) outside of single quotes
+func (s *ScriptRunner) expand(word string) (string, error) {
+	var result strings.Builder
+	inDoubleQuote := false
+	for i := 0; i < len(word); i++ {
+		ch := word[i]
+		switch {
+		case ch == '\'' && !inDoubleQuote:
+			end := strings.IndexByte(word[i+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("missing closing ' in %s", word)
+			}
+			result.WriteString(word[i+1 : i+1+end])
+			i += end + 1
+		case ch == '"':
+			inDoubleQuote = !inDoubleQuote
+		case ch == '$' && i+1 < len(word) && word[i+1] == '(':
+			end := findClosingParenthesis(word, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("missing closing ) in %s", word)
+			}
+			var output bytes.Buffer
+			if err := s.Run(word[i+2:end], &output); err != nil {
+				return "", err
+			}
+			result.WriteString(strings.TrimRight(output.String(), "\n"))
+			i = end
+		case ch == '$' && i+1 < len(word) && word[i+1] == '{':
+			end := strings.IndexByte(word[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("missing closing } in %s", word)
+			}
+			result.WriteString(s.commandEnv.env[word[i+2:i+end]])
+			i += end
+		case ch == '$':
+			end := i + 1
+			for end < len(word) && isVariableChar(word[end]) {
+				end++
+			}
+			if end == i+1 {
+				result.WriteByte(ch)
+				continue
+			}
+			result.WriteString(s.commandEnv.env[word[i+1:end]])
+			i = end - 1
+		case ch == '\\' && i+1 < len(word):
+			i++
+			result.WriteByte(word[i])
+		default:
+			result.WriteByte(ch)
+		}
+	}
+	if inDoubleQuote {
+		return "", fmt.Errorf("missing closing \" in %s", word)
+	}
+	return result.String(), nil
+}
+
+func evaluateCondition(condition []string) (bool, error) {
+	if len(condition) > 0 && condition[0] == "!" {
+		isTrue, err := evaluateCondition(condition[1:])
+		return !isTrue, err
+	}
+	switch len(condition) {
+	case 1:
+		value := condition[0]
+		return value != "" && value != "0" && value != "false", nil
+	case 3:
+		left, op, right := condition[0], condition[1], condition[2]
+		if op == "contains" {
+			return strings.Contains(left, right), nil
+		}
+		compared := strings.Compare(left, right)
+		leftNumber, leftErr := strconv.ParseFloat(left, 64)
+		rightNumber, rightErr := strconv.ParseFloat(right, 64)
+		if leftErr == nil && rightErr == nil {
+			switch {
+			case leftNumber < rightNumber:
+				compared = -1
+			case leftNumber > rightNumber:
+				compared = 1
+			default:
+				compared = 0
+			}
+		}
+		switch op {
+		case "==":
+			return compared == 0, nil
+		case "!=":
+			return compared != 0, nil
+		case "<":
+			return compared < 0, nil
+		case "<=":
+			return compared <= 0, nil
+		case ">":
+			return compared > 0, nil
+		case ">=":
+			return compared >= 0, nil
+		}
+		return false, fmt.Errorf("unknown operator %s", op)
+	}
+	return false, fmt.Errorf("condition should be <word> or <word> <operator> <word>: %v", condition)
+}
+
+// splitStatements splits by new lines and ";" outside of quotes and $(...), and removes comments
+func splitStatements(script string) (statements []string) {
+	var current strings.Builder
+	var quote byte
+	depth := 0
+	atWordStart := true
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(' && i > 0 && script[i-1] == '$':
+			depth++
+		case ch == ')' && depth > 0:
+			depth--
+		case ch == '#' && atWordStart && depth == 0:
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			statements = append(statements, current.String())
+			current.Reset()
+			continue
+		case (ch == ';' || ch == '\n') && depth == 0:
+			statements = append(statements, current.String())
+			current.Reset()
+			atWordStart = true
+			continue
+		}
+		atWordStart = ch == ' ' || ch == '\t' || ch == ';' || ch == '\n'
+		current.WriteByte(ch)
+	}
+	return append(statements, current.String())
+}
+
+// splitWords splits by white space outside of quotes and $(...), keeping the quotes
+func splitWords(statement string) (words []string) {
+	var current strings.Builder
+	var quote byte
+	depth := 0
+	for i := 0; i < len(statement); i++ {
+		ch := statement[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(' && i > 0 && statement[i-1] == '$':
+			depth++
+		case ch == ')' && depth > 0:
+			depth--
+		case (ch == ' ' || ch == '\t' || ch == '\r') && depth == 0:
+			if current.Len() > 0 {
+				words = append(words, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteByte(ch)
+	}
+	if current.Len() > 0 {
+		words = append(words, current.String())
+	}
+	return
+}
+
+func parseAssignment(words []string) (name, value string, isAssign bool) {
+	if len(words) != 1 {
+		return
+	}
+	eq := strings.IndexByte(words[0], '=')
+	if eq <= 0 || !isVariableName(words[0][:eq]) {
+		return
+	}
+	return words[0][:eq], words[0][eq+1:], true
+}
+
+func findClosingParenthesis(word string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(word); i++ {
+		ch := word[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isVariableName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isVariableChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isVariableChar(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
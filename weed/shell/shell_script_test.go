@@ -0,0 +1,80 @@
+package shell
+
+import (
+	"bytes"
+	"testing"
+)
+
+func runTestScript(t *testing.T, script string) string {
+	runner := NewScriptRunner(&CommandEnv{env: make(map[string]string)}, &bytes.Buffer{})
+	var output bytes.Buffer
+	if err := runner.Run(script, &output); err != nil {
+		t.Fatalf("run %q: %v", script, err)
+	}
+	return output.String()
+}
+
+func TestScriptVariablesAndCapture(t *testing.T) {
+	output := runTestScript(t, `
+		name=world
+		greeting=$(echo hello $name)  # capture the output
+		echo "$greeting" '$name' ${name}!
+	`)
+	if output != "hello world $name world!\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestScriptLoopsAndConditions(t *testing.T) {
+	output := runTestScript(t, `
+		list="1 5 10"
+		for i in $list 20; if $i >= 5; echo big $i; else; echo small $i; end; end
+		if ! abc contains b
+			echo wrong
+		end
+		unknown.command
+		if $status != 0
+			echo failed
+		end
+	`)
+	if output != "small 1\nbig 5\nbig 10\nbig 20\nfailed\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestScriptJsonOutput(t *testing.T) {
+	output := runTestScript(t, `unknown.command --json`)
+	if output != "{\n  \"command\": \"unknown.command\",\n  \"args\": [],\n  \"error\": \"unknown command: unknown.command\"\n}\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	commandEnv := &CommandEnv{env: make(map[string]string), option: ShellOptions{Directory: "/buckets"}}
+	var pwdOutput, errOutput bytes.Buffer
+	if err := runCommand(commandEnv, []string{"pwd", "--json"}, &pwdOutput, &errOutput); err != nil {
+		t.Fatalf("pwd: %v", err)
+	}
+	if pwdOutput.String() != "{\n  \"command\": \"fs.pwd\",\n  \"args\": [],\n  \"result\": {\n    \"directory\": \"/buckets\"\n  }\n}\n" || errOutput.Len() != 0 {
+		t.Errorf("unexpected output %q %q", pwdOutput.String(), errOutput.String())
+	}
+}
+
+func TestScriptFeedBlocks(t *testing.T) {
+	runner := NewScriptRunner(&CommandEnv{env: make(map[string]string)}, &bytes.Buffer{})
+	var output bytes.Buffer
+	for i, line := range []string{"for x in a b", "echo $x", "end"} {
+		needMore, exit, err := runner.Feed(line, &output)
+		if err != nil || exit {
+			t.Fatalf("feed %q: %v %v", line, exit, err)
+		}
+		if needMore != (i < 2) {
+			t.Errorf("feed %q: needMore %v", line, needMore)
+		}
+	}
+	if output.String() != "a\nb\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+
+	if _, exit, _ := runner.Feed("exit", &output); !exit {
+		t.Errorf("expected exit")
+	}
+}
@@ -0,0 +1,246 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v7/asn1tools"
+	"gopkg.in/jcmturner/gokrb5.v7/crypto"
+	"gopkg.in/jcmturner/gokrb5.v7/iana/asnAppTag"
+	"gopkg.in/jcmturner/gokrb5.v7/iana/keyusage"
+	"gopkg.in/jcmturner/gokrb5.v7/iana/msgtype"
+	"gopkg.in/jcmturner/gokrb5.v7/messages"
+	"gopkg.in/jcmturner/gokrb5.v7/service"
+	"gopkg.in/jcmturner/gokrb5.v7/spnego"
+	"gopkg.in/jcmturner/gokrb5.v7/types"
+)
+
+// The security buffers of session setup are SPNEGO tokens, RFC 4178, carrying NTLM or Kerberos.
+// Raw NTLM messages without SPNEGO are also accepted.
+
+var (
+	spnegoOid  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	ntlmsspOid = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+	krb5Oid    = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	msKrb5Oid  = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+)
+
+const (
+	negStateAcceptCompleted  = 0
+	negStateAcceptIncomplete = 1
+
+	kerberosClockSkew = 5 * time.Minute
+)
+
+// authentication keeps the state of the authentication of one session
+type authentication struct {
+	started   bool
+	mechTypes []asn1.ObjectIdentifier
+	ntlm      *ntlmServer
+
+	user       *User
+	sessionKey []byte
+}
+
+// negotiateToken is the security buffer of the negotiate response, with the mechanisms of the server
+func (s *SmbServer) negotiateToken() []byte {
+	var mechTypes []asn1.ObjectIdentifier
+	if s.option.Keytab != nil {
+		mechTypes = append(mechTypes, msKrb5Oid, krb5Oid)
+	}
+	mechTypes = append(mechTypes, ntlmsspOid)
+	init := spnego.NegTokenInit{MechTypes: mechTypes}
+	token, err := init.Marshal()
+	if err != nil {
+		return nil
+	}
+	oid, _ := asn1.Marshal(spnegoOid)
+	return asn1tools.AddASNAppTag(append(oid, token...), 0)
+}
+
+// authenticate processes one security buffer of session setup.
+// It returns the security buffer of the response, and whether the authentication completes.
+func (s *SmbServer) authenticate(a *authentication, token []byte, remoteAddr net.Addr) (response []byte, done bool, err error) {
+	first := !a.started
+	a.started = true
+
+	// raw ntlm
+	if bytes.HasPrefix(token, ntlmSignature) {
+		response, err = s.ntlmStep(a, token)
+		return response, err == nil && response == nil, err
+	}
+
+	if first {
+		var oid asn1.ObjectIdentifier
+		rest, err := asn1.UnmarshalWithParams(token, &oid, "application,explicit,tag:0")
+		if err != nil || !oid.Equal(spnegoOid) {
+			return nil, false, fmt.Errorf("not a spnego token")
+		}
+		isInit, negToken, err := spnego.UnmarshalNegToken(rest)
+		if err != nil || !isInit {
+			return nil, false, fmt.Errorf("expecting spnego NegTokenInit: %v", err)
+		}
+		init := negToken.(spnego.NegTokenInit)
+		if len(init.MechTypes) == 0 {
+			return nil, false, fmt.Errorf("no spnego mechanism")
+		}
+		a.mechTypes = init.MechTypes
+		preferred := init.MechTypes[0]
+
+		if (preferred.Equal(krb5Oid) || preferred.Equal(msKrb5Oid)) && s.option.Keytab != nil && len(init.MechTokenBytes) > 0 {
+			apRep, err := s.acceptKerberos(a, init.MechTokenBytes, remoteAddr)
+			if err != nil {
+				return nil, false, err
+			}
+			response, err = marshalNegTokenResp(negStateAcceptCompleted, preferred, apRep, nil)
+			return response, err == nil, err
+		}
+
+		if !hasMech(init.MechTypes, ntlmsspOid) {
+			return nil, false, fmt.Errorf("no supported spnego mechanism in %v", init.MechTypes)
+		}
+		var challenge []byte
+		if preferred.Equal(ntlmsspOid) && len(init.MechTokenBytes) > 0 {
+			if challenge, err = s.ntlmStep(a, init.MechTokenBytes); err != nil {
+				return nil, false, err
+			}
+		}
+		// without the optimistic ntlm token, the client sends it in the next round
+		response, err = marshalNegTokenResp(negStateAcceptIncomplete, ntlmsspOid, challenge, nil)
+		return response, false, err
+	}
+
+	isInit, negToken, err := spnego.UnmarshalNegToken(token)
+	if err != nil || isInit || a.mechTypes == nil {
+		return nil, false, fmt.Errorf("expecting spnego NegTokenResp: %v", err)
+	}
+	resp := negToken.(spnego.NegTokenResp)
+	challenge, err := s.ntlmStep(a, resp.ResponseToken)
+	if err != nil {
+		return nil, false, err
+	}
+	if challenge != nil {
+		response, err = marshalNegTokenResp(negStateAcceptIncomplete, nil, challenge, nil)
+		return response, false, err
+	}
+
+	// the mechListMIC protects the mechanism list from downgrading
+	var mechListMic []byte
+	if len(resp.MechListMIC) > 0 {
+		mechList, err := asn1.Marshal(a.mechTypes)
+		if err != nil {
+			return nil, false, err
+		}
+		if subtle.ConstantTimeCompare(resp.MechListMIC, a.ntlm.mic(mechList, true)) != 1 {
+			return nil, false, fmt.Errorf("invalid spnego mechListMIC")
+		}
+		mechListMic = a.ntlm.mic(mechList, false)
+	}
+	response, err = marshalNegTokenResp(negStateAcceptCompleted, nil, nil, mechListMic)
+	return response, err == nil, err
+}
+
+// ntlmStep returns the challenge for the negotiate message, or nil after the authenticate message is verified
+func (s *SmbServer) ntlmStep(a *authentication, token []byte) ([]byte, error) {
+	if a.ntlm == nil {
+		a.ntlm = &ntlmServer{}
+	}
+	if a.ntlm.challenge == nil {
+		return a.ntlm.challengeMessage(token, s.option.ServerName, s.option.Domain)
+	}
+	if err := a.ntlm.authenticate(token, s.option.Users); err != nil {
+		return nil, err
+	}
+	a.user = a.ntlm.user
+	a.sessionKey = a.ntlm.exportedSessionKey
+	return nil, nil
+}
+
+// acceptKerberos verifies the AP-REQ with the keytab, and returns the AP-REP token
+func (s *SmbServer) acceptKerberos(a *authentication, mechToken []byte, remoteAddr net.Addr) ([]byte, error) {
+	var krb5Token spnego.KRB5Token
+	if err := krb5Token.Unmarshal(mechToken); err != nil {
+		return nil, err
+	}
+	if !krb5Token.IsAPReq() {
+		return nil, fmt.Errorf("expecting kerberos AP-REQ")
+	}
+	// verifying decrypts the ticket and the authenticator in place
+	apReq := &krb5Token.APReq
+	var clientAddress types.HostAddress
+	if tcpAddr, ok := remoteAddr.(*net.TCPAddr); ok {
+		clientAddress = types.HostAddressFromNetIP(tcpAddr.IP)
+	}
+	if ok, err := apReq.Verify(s.option.Keytab, kerberosClockSkew, clientAddress); !ok || err != nil {
+		return nil, fmt.Errorf("verify kerberos AP-REQ: %v", err)
+	}
+	if service.GetReplayCache(kerberosClockSkew).IsReplay(apReq.Ticket.SName, apReq.Authenticator) {
+		return nil, fmt.Errorf("kerberos AP-REQ is replayed")
+	}
+
+	principal := apReq.Authenticator.CName.PrincipalNameString() + "@" + apReq.Authenticator.CRealm
+	user, found := s.option.Users.findPrincipal(principal)
+	if !found {
+		return nil, fmt.Errorf("no user for kerberos principal %s", principal)
+	}
+
+	ticketKey := apReq.Ticket.DecryptedEncPart.Key
+	sessionKey := ticketKey.KeyValue
+	if len(apReq.Authenticator.SubKey.KeyValue) > 0 {
+		sessionKey = apReq.Authenticator.SubKey.KeyValue
+	}
+	if len(sessionKey) < 16 {
+		return nil, fmt.Errorf("kerberos session key of %d bytes is too short", len(sessionKey))
+	}
+
+	encPart, err := asn1.Marshal(messages.EncAPRepPart{
+		CTime:          apReq.Authenticator.CTime,
+		Cusec:          apReq.Authenticator.Cusec,
+		SequenceNumber: apReq.Authenticator.SeqNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := crypto.GetEncryptedData(asn1tools.AddASNAppTag(encPart, asnAppTag.EncAPRepPart), ticketKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return nil, err
+	}
+	apRep, err := asn1.Marshal(messages.APRep{
+		PVNO:    5,
+		MsgType: msgtype.KRB_AP_REP,
+		EncPart: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	oid, _ := asn1.Marshal(krb5Token.OID)
+	gssToken := append(oid, 0x02, 0x00)
+	gssToken = append(gssToken, asn1tools.AddASNAppTag(apRep, asnAppTag.APREP)...)
+
+	a.user = user
+	a.sessionKey = sessionKey[:16]
+	return asn1tools.AddASNAppTag(gssToken, 0), nil
+}
+
+func marshalNegTokenResp(state int, supportedMech asn1.ObjectIdentifier, responseToken, mechListMic []byte) ([]byte, error) {
+	resp := spnego.NegTokenResp{
+		NegState:      asn1.Enumerated(state),
+		SupportedMech: supportedMech,
+		ResponseToken: responseToken,
+		MechListMIC:   mechListMic,
+	}
+	return resp.Marshal()
+}
+
+func hasMech(mechTypes []asn1.ObjectIdentifier, mech asn1.ObjectIdentifier) bool {
+	for _, t := range mechTypes {
+		if t.Equal(mech) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"gopkg.in/jcmturner/gokrb5.v7/asn1tools"
+	"gopkg.in/jcmturner/gokrb5.v7/spnego"
+)
+
+// ntlmTestClient computes the NTLMv2 messages as a Windows client
+type ntlmTestClient struct {
+	username, domain, password string
+	negotiate                  []byte
+	exportedSessionKey         []byte
+	flags                      uint32
+}
+
+func (c *ntlmTestClient) negotiateMessage() []byte {
+	c.flags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateSign | ntlmNegotiateNtlm | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSessionsecurity | ntlmNegotiateVersion | ntlmNegotiate128 | ntlmNegotiateKeyExch | ntlmNegotiate56
+	e := &encoder{}
+	e.bytes(ntlmSignature).uint32(ntlmNegotiateMessage).uint32(c.flags).zeros(16).zeros(8)
+	c.negotiate = e.b
+	return c.negotiate
+}
+
+func (c *ntlmTestClient) authenticateMessage(challenge []byte) []byte {
+	serverChallenge := challenge[24:32]
+	targetInfo, _ := ntlmField(challenge, 40)
+	c.flags = binary.LittleEndian.Uint32(challenge[20:24])
+
+	// the target info with the MIC flag before the EOL
+	avPairs := &encoder{}
+	avPairs.bytes(targetInfo[:len(targetInfo)-4]).uint16(msvAvFlags).uint16(4).uint32(msvAvFlagMicPresent).uint16(msvAvEOL).uint16(0)
+	clientChallenge := make([]byte, 8)
+	rand.Read(clientChallenge)
+	temp := &encoder{}
+	temp.uint8(1).uint8(1).zeros(6).uint64(nowFiletime()).bytes(clientChallenge).zeros(4).bytes(avPairs.b).zeros(4)
+
+	ntowf := hmacMd5(ntHash(c.password), encodeUtf16(strings.ToUpper(c.username)+c.domain))
+	ntProof := hmacMd5(ntowf, serverChallenge, temp.b)
+	sessionBaseKey := hmacMd5(ntowf, ntProof)
+	c.exportedSessionKey = make([]byte, 16)
+	rand.Read(c.exportedSessionKey)
+	encryptedSessionKey := make([]byte, 16)
+	cipher, _ := rc4.NewCipher(sessionBaseKey)
+	cipher.XORKeyStream(encryptedSessionKey, c.exportedSessionKey)
+
+	payload := [][]byte{make([]byte, 24), append(ntProof, temp.b...), encodeUtf16(c.domain), encodeUtf16(c.username), encodeUtf16("WS"), encryptedSessionKey}
+	e := &encoder{}
+	e.bytes(ntlmSignature).uint32(ntlmAuthenticateMessage)
+	offset := 88
+	for _, p := range payload {
+		e.uint16(uint16(len(p))).uint16(uint16(len(p))).uint32(uint32(offset))
+		offset += len(p)
+	}
+	e.uint32(c.flags).zeros(8)
+	micAt := e.len()
+	e.zeros(16)
+	for _, p := range payload {
+		e.bytes(p)
+	}
+	copy(e.b[micAt:], hmacMd5(c.exportedSessionKey, c.negotiate, challenge, e.b))
+	return e.b
+}
+
+func newTestServer(t *testing.T) *SmbServer {
+	users, err := ParseUserStore([]byte(`{"users":[{"username":"alice","password":"secret"}]}`))
+	if err != nil {
+		t.Fatalf("users: %v", err)
+	}
+	return &SmbServer{option: &SmbServerOption{Users: users, ServerName: "seaweed", Domain: "WORKGROUP"}}
+}
+
+func TestRawNtlm(t *testing.T) {
+	s := newTestServer(t)
+	for _, c := range []struct {
+		password string
+		ok       bool
+	}{{"secret", true}, {"wrong", false}} {
+		client := &ntlmTestClient{username: "Alice", domain: "WORKGROUP", password: c.password}
+		a := &authentication{}
+		challenge, done, err := s.authenticate(a, client.negotiateMessage(), nil)
+		if err != nil || done || !isNtlmMessage(challenge, ntlmChallengeMessage) {
+			t.Fatalf("negotiate: %v", err)
+		}
+		_, done, err = s.authenticate(a, client.authenticateMessage(challenge), nil)
+		if c.ok != (err == nil && done) {
+			t.Errorf("password %s: done %v, %v", c.password, done, err)
+		}
+		if c.ok && (a.user.Username != "alice" || !bytes.Equal(a.sessionKey, client.exportedSessionKey)) {
+			t.Errorf("session key %x, expected %x", a.sessionKey, client.exportedSessionKey)
+		}
+	}
+}
+
+func TestSpnegoNtlm(t *testing.T) {
+	s := newTestServer(t)
+	client := &ntlmTestClient{username: "alice", domain: "WORKGROUP", password: "secret"}
+	a := &authentication{}
+
+	mechTypes := []asn1.ObjectIdentifier{krb5Oid, ntlmsspOid}
+	init := spnego.NegTokenInit{MechTypes: mechTypes}
+	initToken, _ := init.Marshal()
+	oid, _ := asn1.Marshal(spnegoOid)
+	response, done, err := s.authenticate(a, asn1tools.AddASNAppTag(append(oid, initToken...), 0), nil)
+	if err != nil || done {
+		t.Fatalf("init: %v", err)
+	}
+	resp := parseNegTokenResp(t, response)
+	if !resp.SupportedMech.Equal(ntlmsspOid) || len(resp.ResponseToken) != 0 {
+		t.Fatalf("init response: %+v", resp)
+	}
+
+	// the ntlm negotiate is sent in the second round, since kerberos was preferred
+	token, _ := (&spnego.NegTokenResp{NegState: negStateAcceptIncomplete, ResponseToken: client.negotiateMessage()}).Marshal()
+	response, done, err = s.authenticate(a, token, nil)
+	if err != nil || done {
+		t.Fatalf("negotiate: %v", err)
+	}
+	challenge := parseNegTokenResp(t, response).ResponseToken
+
+	authenticate := client.authenticateMessage(challenge)
+	mechList, _ := asn1.Marshal(mechTypes)
+	clientSide := &ntlmServer{exportedSessionKey: client.exportedSessionKey, flags: client.flags}
+	token, _ = (&spnego.NegTokenResp{NegState: negStateAcceptIncomplete, ResponseToken: authenticate, MechListMIC: clientSide.mic(mechList, true)}).Marshal()
+	response, done, err = s.authenticate(a, token, nil)
+	if err != nil || !done {
+		t.Fatalf("authenticate: %v", err)
+	}
+	resp = parseNegTokenResp(t, response)
+	if resp.NegState != negStateAcceptCompleted || !bytes.Equal(resp.MechListMIC, clientSide.mic(mechList, false)) {
+		t.Errorf("final response: %+v", resp)
+	}
+
+	// a tampered mechanism list is rejected
+	a = &authentication{}
+	s.authenticate(a, asn1tools.AddASNAppTag(append(oid, initToken...), 0), nil)
+	token, _ = (&spnego.NegTokenResp{ResponseToken: client.negotiateMessage()}).Marshal()
+	response, _, _ = s.authenticate(a, token, nil)
+	authenticate = client.authenticateMessage(parseNegTokenResp(t, response).ResponseToken)
+	clientSide.exportedSessionKey = client.exportedSessionKey
+	tampered, _ := asn1.Marshal([]asn1.ObjectIdentifier{ntlmsspOid})
+	token, _ = (&spnego.NegTokenResp{ResponseToken: authenticate, MechListMIC: clientSide.mic(tampered, true)}).Marshal()
+	if _, _, err = s.authenticate(a, token, nil); err == nil {
+		t.Errorf("tampered mechListMIC accepted")
+	}
+}
+
+func parseNegTokenResp(t *testing.T, token []byte) spnego.NegTokenResp {
+	isInit, negToken, err := spnego.UnmarshalNegToken(token)
+	if err != nil || isInit {
+		t.Fatalf("parse NegTokenResp: %v", err)
+	}
+	return negToken.(spnego.NegTokenResp)
+}
+
+func TestAesCmac(t *testing.T) {
+	// RFC 4493 examples
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	message, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	for length, expected := range map[int]string{
+		0:  "bb1d6929e95937287fa37d129b756746",
+		16: "070a16b46b4d4144f79bdd9dd04a287c",
+		40: "dfa66747de9ae63030ca32611497c827",
+		64: "51f0bebf7e3b9d92fc49741779363cfe",
+	} {
+		if actual := hex.EncodeToString(aesCmac(key, message[:length])); actual != expected {
+			t.Errorf("cmac of %d bytes: %s, expected %s", length, actual, expected)
+		}
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	for _, dialect := range []uint16{smb210, smb311} {
+		message := make([]byte, smb2HeaderSize+16)
+		(&smb2Header{command: smb2Echo, messageId: 7}).marshal(message)
+		signMessage(dialect, key, message)
+		if !verifyMessage(dialect, key, message) {
+			t.Errorf("dialect %x: signed message not verified", dialect)
+		}
+		message[smb2HeaderSize] ^= 1
+		if verifyMessage(dialect, key, message) {
+			t.Errorf("dialect %x: changed message verified", dialect)
+		}
+	}
+}
@@ -0,0 +1,621 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const maxCredits = 512
+
+// smbConn is one client connection. The requests of a connection are processed one by one.
+type smbConn struct {
+	server *SmbServer
+	conn   net.Conn
+
+	negotiated         bool
+	dialect            uint16
+	clientGuid         []byte
+	clientSecurityMode uint16
+	clientCapabilities uint32
+	preauthHash        []byte
+
+	sessions map[uint64]*smbSession
+	lastId   uint64
+}
+
+type smbSession struct {
+	id              uint64
+	auth            *authentication
+	user            *User
+	valid           bool
+	signingKey      []byte
+	signingRequired bool
+	preauthHash     []byte
+	trees           map[uint32]*smbTree
+}
+
+type smbTree struct {
+	id       uint32
+	share    *Share
+	root     util.FullPath
+	readOnly bool
+	isPipe   bool
+	files    map[uint64]*smbFile
+}
+
+type smbRequest struct {
+	header  *smb2Header
+	message []byte
+	body    []byte
+	session *smbSession
+	tree    *smbTree
+	// the file id of the previous create, for the related requests of a compound
+	chainFileId []byte
+
+	// after the response is built
+	signWith      *smbSession
+	noResponse    bool
+	updatePreauth *[]byte
+}
+
+func newSmbConn(server *SmbServer, conn net.Conn) *smbConn {
+	return &smbConn{
+		server:   server,
+		conn:     conn,
+		sessions: make(map[uint64]*smbSession),
+	}
+}
+
+func (c *smbConn) serve() {
+	defer func() {
+		c.conn.Close()
+		for _, session := range c.sessions {
+			c.closeSession(session)
+		}
+	}()
+	for {
+		frame, err := readFrame(c.conn)
+		if err != nil {
+			if err != io.EOF {
+				glog.V(1).Infof("smb read from %s: %v", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		var response []byte
+		if bytes.HasPrefix(frame, []byte(smb1ProtocolId)) {
+			response = c.smb1Negotiate(frame)
+		} else {
+			response, err = c.processCompound(frame)
+		}
+		if response == nil || err != nil {
+			glog.V(1).Infof("smb from %s: unexpected message: %v", c.conn.RemoteAddr(), err)
+			return
+		}
+		if len(response) == 0 {
+			// no response for cancel
+			continue
+		}
+		if err = writeFrame(c.conn, response); err != nil {
+			glog.V(1).Infof("smb write to %s: %v", c.conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+func (c *smbConn) newId() uint64 {
+	c.lastId++
+	return c.lastId
+}
+
+// processCompound handles the chained requests in one frame, and returns the chained responses
+func (c *smbConn) processCompound(frame []byte) ([]byte, error) {
+	var responses [][]byte
+	var signers []*smbSession
+	var previous *smbRequest
+	var previousStatus uint32
+	for offset := 0; offset < len(frame); {
+		h, err := parseHeader(frame[offset:])
+		if err != nil {
+			return nil, err
+		}
+		end := len(frame)
+		if h.nextCommand != 0 {
+			end = offset + int(h.nextCommand)
+			if end > len(frame) || h.nextCommand < smb2HeaderSize || h.nextCommand%8 != 0 {
+				return nil, errMalformed
+			}
+		}
+		req := &smbRequest{
+			header:  h,
+			message: frame[offset:end],
+			body:    frame[offset+smb2HeaderSize : end],
+		}
+		offset = end
+
+		var status uint32
+		var body []byte
+		related := h.flags&smb2FlagsRelatedOperations != 0 && previous != nil
+		if related {
+			if h.sessionId == 0xffffffffffffffff {
+				h.sessionId = previous.header.sessionId
+			}
+			if h.treeId == 0xffffffff {
+				h.treeId = previous.header.treeId
+			}
+			req.chainFileId = previous.chainFileId
+		}
+		if related && previousStatus != statusSuccess {
+			status = previousStatus
+		} else {
+			status, body = c.dispatch(req)
+		}
+		previous, previousStatus = req, status
+		if req.noResponse {
+			continue
+		}
+
+		if body == nil {
+			body = errorBody()
+		}
+		credits := h.credits
+		if credits == 0 {
+			credits = 1
+		}
+		if credits > maxCredits {
+			credits = maxCredits
+		}
+		response := make([]byte, smb2HeaderSize, smb2HeaderSize+len(body)+8)
+		(&smb2Header{
+			creditCharge: h.creditCharge,
+			status:       status,
+			command:      h.command,
+			credits:      credits,
+			flags:        smb2FlagsServerToRedir | h.flags&smb2FlagsRelatedOperations,
+			messageId:    h.messageId,
+			treeId:       h.treeId,
+			sessionId:    h.sessionId,
+		}).marshal(response)
+		response = append(response, body...)
+		if req.updatePreauth != nil {
+			*req.updatePreauth = preauthHash(*req.updatePreauth, response)
+		}
+		responses = append(responses, response)
+		signers = append(signers, req.signWith)
+	}
+
+	out := []byte{}
+	for i, response := range responses {
+		if i < len(responses)-1 {
+			for len(response)%8 != 0 {
+				response = append(response, 0)
+			}
+			binary.LittleEndian.PutUint32(response[20:24], uint32(len(response)))
+		}
+		if signers[i] != nil && signers[i].signingKey != nil {
+			signMessage(c.dialect, signers[i].signingKey, response)
+		}
+		out = append(out, response...)
+	}
+	return out, nil
+}
+
+func errorBody() []byte {
+	e := &encoder{}
+	return e.uint16(9).uint8(0).uint8(0).uint32(0).uint8(0).b
+}
+
+func (c *smbConn) dispatch(req *smbRequest) (uint32, []byte) {
+	h := req.header
+	if h.command == smb2Negotiate {
+		return c.negotiate(req)
+	}
+	if !c.negotiated {
+		req.noResponse = true
+		return statusAccessDenied, nil
+	}
+	if h.command == smb2Cancel {
+		// nothing is pending
+		req.noResponse = true
+		return statusSuccess, nil
+	}
+
+	if h.sessionId != 0 {
+		req.session = c.sessions[h.sessionId]
+		if req.session == nil {
+			return statusUserSessionDeleted, nil
+		}
+		if status := c.checkSignature(req); status != statusSuccess {
+			return status, nil
+		}
+	}
+	if h.command == smb2SessionSetup {
+		return c.sessionSetup(req)
+	}
+	if h.command == smb2Echo {
+		return statusSuccess, (&encoder{}).uint16(4).uint16(0).b
+	}
+	if req.session == nil || !req.session.valid {
+		return statusUserSessionDeleted, nil
+	}
+	if h.flags&smb2FlagsSigned != 0 || req.session.signingRequired {
+		req.signWith = req.session
+	}
+
+	switch h.command {
+	case smb2Logoff:
+		c.closeSession(req.session)
+		delete(c.sessions, req.session.id)
+		return statusSuccess, (&encoder{}).uint16(4).uint16(0).b
+	case smb2TreeConnect:
+		return c.treeConnect(req)
+	}
+
+	req.tree = req.session.trees[h.treeId]
+	if req.tree == nil {
+		return statusNetworkNameDeleted, nil
+	}
+	switch h.command {
+	case smb2TreeDisconnect:
+		c.closeTree(req.tree)
+		delete(req.session.trees, req.tree.id)
+		return statusSuccess, (&encoder{}).uint16(4).uint16(0).b
+	case smb2Create:
+		return c.create(req)
+	case smb2Close:
+		return c.close(req)
+	case smb2Flush:
+		return c.flush(req)
+	case smb2Read:
+		return c.read(req)
+	case smb2Write:
+		return c.write(req)
+	case smb2Lock:
+		return c.lock(req)
+	case smb2Ioctl:
+		return c.ioctl(req)
+	case smb2QueryDirectory:
+		return c.queryDirectory(req)
+	case smb2ChangeNotify:
+		return statusNotSupported, nil
+	case smb2QueryInfo:
+		return c.queryInfo(req)
+	case smb2SetInfo:
+		return c.setInfo(req)
+	case smb2OplockBreak:
+		// no oplock is granted
+		return statusInvalidParameter, nil
+	}
+	return statusNotImplemented, nil
+}
+
+// checkSignature verifies the signed requests, and rejects the unsigned ones if signing is required
+func (c *smbConn) checkSignature(req *smbRequest) uint32 {
+	session := req.session
+	if session.signingKey == nil {
+		return statusSuccess
+	}
+	if req.header.flags&smb2FlagsSigned != 0 {
+		if !verifyMessage(c.dialect, session.signingKey, req.message) {
+			glog.V(0).Infof("smb from %s: bad signature of command %d", c.conn.RemoteAddr(), req.header.command)
+			return statusAccessDenied
+		}
+		return statusSuccess
+	}
+	if session.signingRequired && session.valid && req.header.command != smb2SessionSetup {
+		return statusAccessDenied
+	}
+	return statusSuccess
+}
+
+// smb1Negotiate upgrades the SMB1 negotiate of older clients to SMB2
+func (c *smbConn) smb1Negotiate(frame []byte) []byte {
+	if c.negotiated || len(frame) < 35 || frame[4] != 0x72 {
+		return nil
+	}
+	wordCount := int(frame[32])
+	dataStart := 33 + 2*wordCount + 2
+	if dataStart > len(frame) {
+		return nil
+	}
+	var dialect uint16
+	for _, d := range bytes.Split(frame[dataStart:], []byte{0}) {
+		switch string(bytes.TrimPrefix(d, []byte{2})) {
+		case "SMB 2.???":
+			dialect = smb2Wildcard
+		case "SMB 2.002":
+			if dialect == 0 {
+				dialect = smb202
+			}
+		}
+	}
+	if dialect == 0 {
+		return nil
+	}
+	if dialect == smb202 {
+		c.negotiated = true
+		c.dialect = smb202
+	}
+	response := make([]byte, smb2HeaderSize)
+	(&smb2Header{
+		command: smb2Negotiate,
+		credits: 1,
+		flags:   smb2FlagsServerToRedir,
+	}).marshal(response)
+	return append(response, c.negotiateResponse(dialect, nil)...)
+}
+
+func (c *smbConn) negotiate(req *smbRequest) (uint32, []byte) {
+	if c.negotiated {
+		req.noResponse = true
+		return statusAccessDenied, nil
+	}
+	b := req.body
+	if len(b) < 36 {
+		return statusInvalidParameter, nil
+	}
+	dialectCount := int(binary.LittleEndian.Uint16(b[2:4]))
+	if dialectCount == 0 || 36+2*dialectCount > len(b) {
+		return statusInvalidParameter, nil
+	}
+	c.clientSecurityMode = binary.LittleEndian.Uint16(b[4:6])
+	c.clientCapabilities = binary.LittleEndian.Uint32(b[8:12])
+	c.clientGuid = append([]byte(nil), b[12:28]...)
+
+	var dialect uint16
+	for i := 0; i < dialectCount; i++ {
+		d := binary.LittleEndian.Uint16(b[36+2*i:])
+		switch d {
+		case smb202, smb210, smb300, smb302, smb311:
+			if d > dialect {
+				dialect = d
+			}
+		}
+	}
+	if dialect == 0 {
+		return statusNotSupported, nil
+	}
+
+	var contexts []byte
+	if dialect == smb311 {
+		if !hasPreauthSha512(req.message, binary.LittleEndian.Uint32(b[28:32]), int(binary.LittleEndian.Uint16(b[32:34]))) {
+			return statusInvalidParameter, nil
+		}
+		salt := make([]byte, 32)
+		copy(salt, c.server.serverGuid)
+		e := &encoder{}
+		e.uint16(smb2PreauthIntegrityCapabilities).uint16(38).uint32(0)
+		e.uint16(1).uint16(uint16(len(salt))).uint16(smb2HashSha512).bytes(salt)
+		contexts = e.b
+		c.preauthHash = preauthHash(make([]byte, 64), req.message)
+		req.updatePreauth = &c.preauthHash
+	}
+	c.negotiated = true
+	c.dialect = dialect
+	return statusSuccess, c.negotiateResponse(dialect, contexts)
+}
+
+// hasPreauthSha512 checks the negotiate contexts of dialect 3.1.1
+func hasPreauthSha512(message []byte, offset uint32, count int) bool {
+	at := int(offset)
+	for i := 0; i < count; i++ {
+		if at+8 > len(message) {
+			return false
+		}
+		contextType := binary.LittleEndian.Uint16(message[at:])
+		length := int(binary.LittleEndian.Uint16(message[at+2:]))
+		data, err := field(message, at+8, length)
+		if err != nil {
+			return false
+		}
+		if contextType == smb2PreauthIntegrityCapabilities && len(data) >= 4 {
+			algorithms := int(binary.LittleEndian.Uint16(data))
+			for j := 0; j < algorithms && 4+2*j+2 <= len(data); j++ {
+				if binary.LittleEndian.Uint16(data[4+2*j:]) == smb2HashSha512 {
+					return true
+				}
+			}
+		}
+		at = (at + 8 + length + 7) &^ 7
+	}
+	return false
+}
+
+func (c *smbConn) negotiateResponse(dialect uint16, contexts []byte) []byte {
+	securityMode := uint16(smb2NegotiateSigningEnabled)
+	if c.server.option.RequireSigning {
+		securityMode |= smb2NegotiateSigningRequired
+	}
+	var capabilities uint32
+	maxSize := uint32(smb202MaxSize)
+	if dialect != smb202 {
+		capabilities |= smb2GlobalCapLargeMtu
+		maxSize = maxReadSize
+	}
+	token := c.server.negotiateToken()
+	const bufferOffset = smb2HeaderSize + 64
+
+	e := &encoder{}
+	e.uint16(65).uint16(securityMode).uint16(dialect)
+	if contexts != nil {
+		e.uint16(1)
+	} else {
+		e.uint16(0)
+	}
+	e.bytes(c.server.serverGuid).uint32(capabilities)
+	e.uint32(maxSize).uint32(maxSize).uint32(maxSize)
+	e.uint64(nowFiletime()).uint64(c.server.startTime)
+	e.uint16(bufferOffset).uint16(uint16(len(token)))
+	contextOffsetAt := e.len()
+	e.uint32(0)
+	e.bytes(token)
+	if contexts != nil {
+		for (smb2HeaderSize+e.len())%8 != 0 {
+			e.uint8(0)
+		}
+		e.putUint32(contextOffsetAt, uint32(smb2HeaderSize+e.len()))
+		e.bytes(contexts)
+	}
+	return e.b
+}
+
+func (c *smbConn) sessionSetup(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	if b[2]&0x01 != 0 {
+		// binding a session to another channel
+		return statusRequestNotAccepted, nil
+	}
+	securityMode := b[3]
+	token, err := field(req.message, int(binary.LittleEndian.Uint16(b[12:14])), int(binary.LittleEndian.Uint16(b[14:16])))
+	if err != nil {
+		return statusInvalidParameter, nil
+	}
+
+	session := req.session
+	if session == nil {
+		session = &smbSession{
+			id:          c.newId(),
+			auth:        &authentication{},
+			preauthHash: append([]byte(nil), c.preauthHash...),
+			trees:       make(map[uint32]*smbTree),
+		}
+		c.sessions[session.id] = session
+		req.header.sessionId = session.id
+	} else if session.auth == nil {
+		// re-authentication of the session
+		session.auth = &authentication{}
+	}
+	if c.dialect == smb311 {
+		session.preauthHash = preauthHash(session.preauthHash, req.message)
+	}
+
+	response, done, err := c.server.authenticate(session.auth, token, c.conn.RemoteAddr())
+	if err != nil {
+		glog.V(0).Infof("smb session setup from %s: %v", c.conn.RemoteAddr(), err)
+		if !session.valid {
+			delete(c.sessions, session.id)
+		}
+		session.auth = nil
+		return statusLogonFailure, nil
+	}
+
+	e := &encoder{}
+	e.uint16(9).uint16(0).uint16(smb2HeaderSize + 8).uint16(uint16(len(response))).bytes(response)
+	if !done {
+		if c.dialect == smb311 {
+			req.updatePreauth = &session.preauthHash
+		}
+		return statusMoreProcessingRequired, e.b
+	}
+
+	auth := session.auth
+	session.auth = nil
+	if session.valid && session.user != auth.user {
+		glog.V(0).Infof("smb session setup from %s: re-authenticated as another user", c.conn.RemoteAddr())
+		return statusLogonFailure, nil
+	}
+	session.user = auth.user
+	session.valid = true
+	session.signingKey = signingKey(c.dialect, auth.sessionKey, session.preauthHash)
+	session.signingRequired = c.server.option.RequireSigning || securityMode&smb2NegotiateSigningRequired != 0
+	if c.dialect == smb311 || session.signingRequired || req.header.flags&smb2FlagsSigned != 0 {
+		req.signWith = session
+	}
+	glog.V(1).Infof("smb session %d from %s as %s", session.id, c.conn.RemoteAddr(), session.user.Username)
+	return statusSuccess, e.b
+}
+
+func (c *smbConn) treeConnect(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 8 {
+		return statusInvalidParameter, nil
+	}
+	pathBytes, err := field(req.message, int(binary.LittleEndian.Uint16(b[4:6])), int(binary.LittleEndian.Uint16(b[6:8])))
+	if err != nil {
+		return statusInvalidParameter, nil
+	}
+	// \\server\share
+	sharePath := decodeUtf16(pathBytes)
+	name := sharePath[strings.LastIndex(sharePath, `\`)+1:]
+
+	user := req.session.user
+	tree := &smbTree{
+		id:    uint32(c.newId()),
+		files: make(map[uint64]*smbFile),
+	}
+	if strings.EqualFold(name, ipcShareName) {
+		tree.isPipe = true
+	} else {
+		share, found := c.server.findShare(name, user)
+		if !found {
+			return statusBadNetworkName, nil
+		}
+		if status := c.server.prepareShare(share, user); status != statusSuccess {
+			return status, nil
+		}
+		tree.share = share
+		tree.root = util.FullPath(share.Directory)
+		tree.readOnly = share.ReadOnly || user.ReadOnly
+	}
+	req.session.trees[tree.id] = tree
+	req.header.treeId = tree.id
+
+	shareType, maximalAccess := uint8(smb2ShareTypeDisk), uint32(fileAllAccess)
+	if tree.isPipe {
+		shareType = smb2ShareTypePipe
+	} else if tree.readOnly {
+		maximalAccess = fileReadAccess
+	}
+	e := &encoder{}
+	// no client side caching, since the files may also be changed by other clients of the filer
+	e.uint16(16).uint8(shareType).uint8(0).uint32(shareFlagNoCaching).uint32(0).uint32(maximalAccess)
+	return statusSuccess, e.b
+}
+
+// prepareShare checks the share directory, and creates the home directory of the user
+func (s *SmbServer) prepareShare(share *Share, user *User) uint32 {
+	entry, err := s.lookupEntry(util.FullPath(share.Directory))
+	if err == os.ErrNotExist && share.Name == homeShareName {
+		dir, name := util.FullPath(share.Directory).DirAndName()
+		err = filer_pb.Mkdir(s, dir, name, func(entry *filer_pb.Entry) {
+			entry.Attributes.FileMode = uint32(os.ModeDir | 0700)
+			entry.Attributes.Uid = user.Uid
+			entry.Attributes.Gid = user.Gid
+		})
+		if err == nil {
+			return statusSuccess
+		}
+	}
+	if err == os.ErrNotExist || err == nil && !entry.IsDirectory {
+		return statusBadNetworkName
+	}
+	if err != nil {
+		glog.Errorf("smb share %s: %v", share.Directory, err)
+		return statusInternalError
+	}
+	return statusSuccess
+}
+
+func (c *smbConn) closeSession(session *smbSession) {
+	for _, tree := range session.trees {
+		c.closeTree(tree)
+	}
+	session.trees = make(map[uint32]*smbTree)
+}
+
+func (c *smbConn) closeTree(tree *smbTree) {
+	for _, f := range tree.files {
+		c.server.closeFile(f)
+	}
+	tree.files = make(map[uint64]*smbFile)
+}
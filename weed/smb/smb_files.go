@@ -0,0 +1,649 @@
+package smb
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+const (
+	// access masks
+	fileReadData        = 0x00000001
+	fileWriteData       = 0x00000002
+	fileAppendData      = 0x00000004
+	fileWriteEa         = 0x00000010
+	fileWriteAttributes = 0x00000100
+	accessDelete        = 0x00010000
+	accessWriteDac      = 0x00040000
+	accessWriteOwner    = 0x00080000
+	maximumAllowed      = 0x02000000
+	genericAll          = 0x10000000
+	genericWrite        = 0x40000000
+	fileAllAccess       = 0x001f01ff
+	fileReadAccess      = 0x001200a9
+
+	writeAccessMask = fileWriteData | fileAppendData | fileWriteEa | fileWriteAttributes | accessDelete |
+		accessWriteDac | accessWriteOwner | genericAll | genericWrite
+
+	shareFlagNoCaching = 0x00000030
+
+	// file attributes
+	fileAttributeHidden    = 0x00000002
+	fileAttributeDirectory = 0x00000010
+	fileAttributeArchive   = 0x00000020
+
+	// create dispositions
+	fileSupersede   = 0
+	fileOpen        = 1
+	fileCreate      = 2
+	fileOpenIf      = 3
+	fileOverwrite   = 4
+	fileOverwriteIf = 5
+
+	// create options
+	fileDirectoryFile    = 0x00000001
+	fileNonDirectoryFile = 0x00000040
+	fileDeleteOnClose    = 0x00001000
+
+	// create actions
+	fileSuperseded  = 0
+	fileOpened      = 1
+	fileCreated     = 2
+	fileOverwritten = 3
+
+	closeFlagPostQueryAttrib = 0x0001
+	writeFlagWriteThrough    = 0x00000001
+
+	fsctlDfsGetReferrals           = 0x00060194
+	fsctlValidateNegotiateInfo     = 0x00140204
+	fsctlQueryNetworkInterfaceInfo = 0x001401fc
+
+	queryRestartScans = 0x01
+	querySingleEntry  = 0x02
+	queryReopen       = 0x10
+
+	infoFile       = 1
+	infoFilesystem = 2
+	infoSecurity   = 3
+
+	blockSize = 4096
+)
+
+// smbFile is an open file or directory
+type smbFile struct {
+	id            uint64
+	tree          *smbTree
+	path          util.FullPath
+	isDir         bool
+	access        uint32
+	deleteOnClose bool
+	written       bool
+	// the end of file set beyond the written data
+	eof uint64
+
+	// the directory enumeration
+	pattern    string
+	listing    []*dirItem
+	listingPos int
+}
+
+type dirItem struct {
+	name  string
+	entry *filer_pb.Entry
+	path  util.FullPath
+}
+
+func (f *smbFile) fileId() []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint64(b, f.id)
+	binary.LittleEndian.PutUint64(b[8:], f.id)
+	return b
+}
+
+func (c *smbConn) getFile(req *smbRequest, fileId []byte) (*smbFile, uint32) {
+	if len(fileId) < 16 {
+		return nil, statusInvalidParameter
+	}
+	if binary.LittleEndian.Uint64(fileId) == 0xffffffffffffffff && req.chainFileId != nil {
+		fileId = req.chainFileId
+	}
+	f, found := req.tree.files[binary.LittleEndian.Uint64(fileId)]
+	if !found {
+		return nil, statusFileClosed
+	}
+	return f, statusSuccess
+}
+
+// splitName checks the windows path relative to the share, and splits it to names
+func splitName(name string) ([]string, uint32) {
+	name = strings.TrimPrefix(name, `\`)
+	if i := strings.Index(name, ":"); i >= 0 {
+		// only the default data stream
+		if !strings.EqualFold(name[i:], "::$DATA") {
+			return nil, statusObjectNameInvalid
+		}
+		name = name[:i]
+	}
+	var names []string
+	for _, n := range strings.Split(name, `\`) {
+		if n == "" {
+			continue
+		}
+		if n == "." || n == ".." || strings.ContainsAny(n, "/<>\"|?*") {
+			return nil, statusObjectNameInvalid
+		}
+		names = append(names, n)
+	}
+	return names, statusSuccess
+}
+
+func (c *smbConn) create(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 56 {
+		return statusInvalidParameter, nil
+	}
+	desiredAccess := binary.LittleEndian.Uint32(b[24:28])
+	disposition := binary.LittleEndian.Uint32(b[36:40])
+	options := binary.LittleEndian.Uint32(b[40:44])
+	nameBytes, err := field(req.message, int(binary.LittleEndian.Uint16(b[44:46])), int(binary.LittleEndian.Uint16(b[46:48])))
+	if err != nil {
+		return statusInvalidParameter, nil
+	}
+	tree := req.tree
+	if tree.isPipe {
+		// no named pipes, e.g., for share enumeration
+		return statusObjectNameNotFound, nil
+	}
+	names, status := splitName(decodeUtf16(nameBytes))
+	if status != statusSuccess {
+		return status, nil
+	}
+	if tree.readOnly && (desiredAccess&writeAccessMask != 0 || disposition != fileOpen && disposition != fileOpenIf || options&fileDeleteOnClose != 0) {
+		return statusAccessDenied, nil
+	}
+
+	s := c.server
+	p, entry, err := s.resolve(tree.root, names)
+	if err != nil && err != os.ErrNotExist {
+		glog.Errorf("smb create %s: %v", p, err)
+		return statusIoDevice, nil
+	}
+
+	action := uint32(fileOpened)
+	if entry != nil {
+		switch {
+		case disposition == fileCreate:
+			return statusObjectNameCollision, nil
+		case options&fileDirectoryFile != 0 && !entry.IsDirectory:
+			return statusNotADirectory, nil
+		case options&fileNonDirectoryFile != 0 && entry.IsDirectory:
+			return statusFileIsADirectory, nil
+		}
+		switch disposition {
+		case fileSupersede, fileOverwrite, fileOverwriteIf:
+			if entry.IsDirectory {
+				return statusInvalidParameter, nil
+			}
+			if status := s.truncate(p, entry); status != statusSuccess {
+				return status, nil
+			}
+			action = fileOverwritten
+			if disposition == fileSupersede {
+				action = fileSuperseded
+			}
+		}
+	} else {
+		if disposition == fileOpen || disposition == fileOverwrite || len(names) == 0 {
+			if dir, _ := p.DirAndName(); !s.isDirectory(util.FullPath(dir)) {
+				return statusObjectPathNotFound, nil
+			}
+			return statusObjectNameNotFound, nil
+		}
+		if tree.readOnly {
+			return statusAccessDenied, nil
+		}
+		if entry, status = s.createEntry(p, options&fileDirectoryFile != 0, req.session.user); status != statusSuccess {
+			return status, nil
+		}
+		action = fileCreated
+	}
+
+	f := &smbFile{
+		id:            c.newId(),
+		tree:          tree,
+		path:          p,
+		isDir:         entry.IsDirectory,
+		access:        desiredAccess,
+		deleteOnClose: options&fileDeleteOnClose != 0,
+	}
+	if f.deleteOnClose && f.isDir && !s.isEmptyDirectory(p) {
+		return statusDirectoryNotEmpty, nil
+	}
+	tree.files[f.id] = f
+	req.chainFileId = f.fileId()
+
+	info := s.info(f, p.Name(), entry)
+	e := &encoder{}
+	e.uint16(89).uint8(0).uint8(0).uint32(action)
+	info.times(e)
+	e.uint64(info.allocationSize()).uint64(info.size).uint32(info.attributes).uint32(0)
+	e.bytes(f.fileId()).uint32(0).uint32(0)
+	return statusSuccess, e.b
+}
+
+func (s *SmbServer) createEntry(p util.FullPath, isDirectory bool, user *User) (*filer_pb.Entry, uint32) {
+	dir, name := p.DirAndName()
+	if !s.isDirectory(util.FullPath(dir)) {
+		return nil, statusObjectPathNotFound
+	}
+	var err error
+	if isDirectory {
+		err = filer_pb.Mkdir(s, dir, name, func(entry *filer_pb.Entry) {
+			entry.Attributes.FileMode = uint32(os.ModeDir | 0770)
+			entry.Attributes.Uid = user.Uid
+			entry.Attributes.Gid = user.Gid
+		})
+	} else {
+		now := time.Now().Unix()
+		err = s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+			return filer_pb.CreateEntry(client, &filer_pb.CreateEntryRequest{
+				Directory: dir,
+				Entry: &filer_pb.Entry{
+					Name: name,
+					Attributes: &filer_pb.FuseAttributes{
+						Mtime:       now,
+						Crtime:      now,
+						FileMode:    0660,
+						Uid:         user.Uid,
+						Gid:         user.Gid,
+						Collection:  s.option.Collection,
+						Replication: s.option.Replication,
+					},
+				},
+			})
+		})
+	}
+	s.invalidate(p)
+	if err != nil {
+		glog.Errorf("smb create %s: %v", p, err)
+		return nil, statusIoDevice
+	}
+	entry, err := s.lookupEntry(p)
+	if err != nil {
+		glog.Errorf("smb create %s: %v", p, err)
+		return nil, statusIoDevice
+	}
+	return entry, statusSuccess
+}
+
+func (s *SmbServer) isDirectory(p util.FullPath) bool {
+	entry, err := s.lookupEntry(p)
+	return err == nil && entry.IsDirectory
+}
+
+func (s *SmbServer) isEmptyDirectory(p util.FullPath) bool {
+	empty := true
+	err := filer_pb.List(s, string(p), "", func(entry *filer_pb.Entry, isLast bool) error {
+		empty = false
+		return nil
+	}, "", false, 1)
+	return err == nil && empty
+}
+
+// truncate empties the file, since the chunks can not be cut in the middle
+func (s *SmbServer) truncate(p util.FullPath, entry *filer_pb.Entry) uint32 {
+	s.dropWriter(p)
+	entry.Chunks = nil
+	entry.Attributes.FileSize = 0
+	entry.Attributes.Mtime = time.Now().Unix()
+	return s.updateEntry(p, entry)
+}
+
+func (s *SmbServer) updateEntry(p util.FullPath, entry *filer_pb.Entry) uint32 {
+	dir, _ := p.DirAndName()
+	err := s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.UpdateEntry(context.Background(), &filer_pb.UpdateEntryRequest{
+			Directory: dir,
+			Entry:     entry,
+		})
+		return err
+	})
+	s.invalidate(p)
+	if err != nil {
+		glog.Errorf("smb update %s: %v", p, err)
+		return statusIoDevice
+	}
+	return statusSuccess
+}
+
+func (c *smbConn) close(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	f, status := c.getFile(req, b[8:24])
+	if status != statusSuccess {
+		return status, nil
+	}
+	delete(req.tree.files, f.id)
+	if status = c.server.closeFile(f); status != statusSuccess {
+		return status, nil
+	}
+
+	e := &encoder{}
+	flags := binary.LittleEndian.Uint16(b[2:4])
+	e.uint16(60).uint16(flags & closeFlagPostQueryAttrib).uint32(0)
+	if flags&closeFlagPostQueryAttrib != 0 {
+		if entry, err := c.server.lookupEntry(f.path); err == nil {
+			info := c.server.info(f, f.path.Name(), entry)
+			info.times(e)
+			e.uint64(info.allocationSize()).uint64(info.size).uint32(info.attributes)
+			return statusSuccess, e.b
+		}
+	}
+	e.zeros(52)
+	return statusSuccess, e.b
+}
+
+// closeFile saves the written data, and removes the file if it is to delete on close
+func (s *SmbServer) closeFile(f *smbFile) uint32 {
+	if f.deleteOnClose {
+		s.dropWriter(f.path)
+		dir, name := f.path.DirAndName()
+		err := filer_pb.Remove(s, dir, name, true, false, false, false)
+		s.invalidate(f.path)
+		if err != nil {
+			glog.Errorf("smb delete %s: %v", f.path, err)
+			if strings.Contains(err.Error(), "non-empty") {
+				return statusDirectoryNotEmpty
+			}
+			return statusIoDevice
+		}
+		return statusSuccess
+	}
+	if f.written {
+		if err := s.closeWriter(f.path); err != nil {
+			glog.Errorf("smb close %s: %v", f.path, err)
+			return statusIoDevice
+		}
+	}
+	return statusSuccess
+}
+
+func (c *smbConn) flush(req *smbRequest) (uint32, []byte) {
+	if len(req.body) < 24 {
+		return statusInvalidParameter, nil
+	}
+	f, status := c.getFile(req, req.body[8:24])
+	if status != statusSuccess {
+		return status, nil
+	}
+	if err := c.server.flushWriter(f.path); err != nil {
+		glog.Errorf("smb flush %s: %v", f.path, err)
+		return statusIoDevice, nil
+	}
+	return statusSuccess, (&encoder{}).uint16(4).uint16(0).b
+}
+
+func (c *smbConn) read(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 48 {
+		return statusInvalidParameter, nil
+	}
+	length := binary.LittleEndian.Uint32(b[4:8])
+	offset := binary.LittleEndian.Uint64(b[8:16])
+	f, status := c.getFile(req, b[16:32])
+	if status != statusSuccess {
+		return status, nil
+	}
+	if f.isDir {
+		return statusInvalidDeviceRequest, nil
+	}
+	if length > maxReadSize {
+		return statusInvalidParameter, nil
+	}
+
+	s := c.server
+	if err := s.flushWriter(f.path); err != nil {
+		glog.Errorf("smb read %s: %v", f.path, err)
+		return statusIoDevice, nil
+	}
+	entry, err := s.lookupEntry(f.path)
+	if err != nil {
+		return toStatus(err), nil
+	}
+	size := filer2.TotalSize(entry.Chunks)
+	if offset > size || offset == size && length > 0 {
+		return statusEndOfFile, nil
+	}
+	if uint64(length) > size-offset {
+		length = uint32(size - offset)
+	}
+	data := make([]byte, length)
+	reader := filer2.NewChunkReaderAtForEntry(s, entry, s.chunkCache)
+	n, err := reader.ReadAt(data, int64(offset))
+	if err != nil && n < len(data) {
+		glog.Errorf("smb read %s [%d,%d): %v", f.path, offset, offset+uint64(length), err)
+		return statusIoDevice, nil
+	}
+
+	e := &encoder{}
+	e.uint16(17).uint8(smb2HeaderSize + 16).uint8(0).uint32(uint32(n)).uint32(0).uint32(0).bytes(data[:n])
+	return statusSuccess, e.b
+}
+
+func (c *smbConn) write(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 48 {
+		return statusInvalidParameter, nil
+	}
+	length := binary.LittleEndian.Uint32(b[4:8])
+	offset := binary.LittleEndian.Uint64(b[8:16])
+	flags := binary.LittleEndian.Uint32(b[44:48])
+	data, err := field(req.message, int(binary.LittleEndian.Uint16(b[2:4])), int(length))
+	if err != nil {
+		return statusInvalidParameter, nil
+	}
+	f, status := c.getFile(req, b[16:32])
+	if status != statusSuccess {
+		return status, nil
+	}
+	if f.isDir {
+		return statusInvalidDeviceRequest, nil
+	}
+	if req.tree.readOnly {
+		return statusAccessDenied, nil
+	}
+
+	s := c.server
+	if offset == 0xffffffffffffffff {
+		// appending
+		entry, err := s.lookupEntry(f.path)
+		if err != nil {
+			return toStatus(err), nil
+		}
+		offset = s.fileSize(f.path, entry)
+	}
+	f.written = true
+	if status = s.writeAt(f.path, data, offset); status != statusSuccess {
+		return status, nil
+	}
+	if flags&writeFlagWriteThrough != 0 {
+		if err := s.flushWriter(f.path); err != nil {
+			glog.Errorf("smb write %s: %v", f.path, err)
+			return statusIoDevice, nil
+		}
+	}
+
+	e := &encoder{}
+	e.uint16(17).uint16(0).uint32(uint32(len(data))).uint32(0).uint16(0).uint16(0)
+	return statusSuccess, e.b
+}
+
+func (s *SmbServer) writeAt(p util.FullPath, data []byte, offset uint64) uint32 {
+	for {
+		w, err := s.getWriter(p)
+		if err != nil {
+			return toStatus(err)
+		}
+		w.Lock()
+		if w.closed {
+			// the writer was just closed by someone else
+			w.Unlock()
+			continue
+		}
+		_, err = w.writer.WriteAt(data, int64(offset))
+		if end := offset + uint64(len(data)); end > w.size {
+			w.size = end
+		}
+		w.lastWrite = time.Now()
+		w.Unlock()
+		if err != nil {
+			glog.Errorf("smb write %s: %v", p, err)
+			return statusIoDevice
+		}
+		return statusSuccess
+	}
+}
+
+// lock accepts the byte range locks without enforcing them, since the locks are not shared with the other filer clients
+func (c *smbConn) lock(req *smbRequest) (uint32, []byte) {
+	if len(req.body) < 24 {
+		return statusInvalidParameter, nil
+	}
+	if _, status := c.getFile(req, req.body[8:24]); status != statusSuccess {
+		return status, nil
+	}
+	return statusSuccess, (&encoder{}).uint16(4).uint16(0).b
+}
+
+func (c *smbConn) ioctl(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 56 {
+		return statusInvalidParameter, nil
+	}
+	ctlCode := binary.LittleEndian.Uint32(b[4:8])
+	switch ctlCode {
+	case fsctlDfsGetReferrals:
+		return statusFsDriverRequired, nil
+	case fsctlQueryNetworkInterfaceInfo:
+		return statusNotSupported, nil
+	case fsctlValidateNegotiateInfo:
+	default:
+		return statusInvalidDeviceRequest, nil
+	}
+
+	// validate the negotiation was not tampered
+	input, err := field(req.message, int(binary.LittleEndian.Uint32(b[24:28])), int(binary.LittleEndian.Uint32(b[28:32])))
+	if err != nil || len(input) < 24 {
+		return statusInvalidParameter, nil
+	}
+	dialectCount := int(binary.LittleEndian.Uint16(input[22:24]))
+	if 24+2*dialectCount > len(input) {
+		return statusInvalidParameter, nil
+	}
+	var hasDialect bool
+	for i := 0; i < dialectCount; i++ {
+		hasDialect = hasDialect || binary.LittleEndian.Uint16(input[24+2*i:]) == c.dialect
+	}
+	if !hasDialect || binary.LittleEndian.Uint32(input[0:4]) != c.clientCapabilities ||
+		string(input[4:20]) != string(c.clientGuid) || binary.LittleEndian.Uint16(input[20:22]) != c.clientSecurityMode {
+		glog.V(0).Infof("smb from %s: negotiation validation failed", c.conn.RemoteAddr())
+		return statusAccessDenied, nil
+	}
+	securityMode := uint16(smb2NegotiateSigningEnabled)
+	if c.server.option.RequireSigning {
+		securityMode |= smb2NegotiateSigningRequired
+	}
+	var capabilities uint32
+	if c.dialect != smb202 {
+		capabilities = smb2GlobalCapLargeMtu
+	}
+	output := &encoder{}
+	output.uint32(capabilities).bytes(c.server.serverGuid).uint16(securityMode).uint16(c.dialect)
+
+	const outputOffset = smb2HeaderSize + 48
+	e := &encoder{}
+	e.uint16(49).uint16(0).uint32(ctlCode).bytes(b[8:24])
+	e.uint32(outputOffset).uint32(0).uint32(outputOffset).uint32(uint32(output.len()))
+	e.uint32(0).uint32(0).bytes(output.b)
+	return statusSuccess, e.b
+}
+
+func toStatus(err error) uint32 {
+	if err == os.ErrNotExist {
+		return statusObjectNameNotFound
+	}
+	glog.Errorf("smb: %v", err)
+	return statusIoDevice
+}
+
+// smbInfo is the attributes of a file in the smb form
+type smbInfo struct {
+	entry      *filer_pb.Entry
+	name       string
+	size       uint64
+	attributes uint32
+	index      uint64
+}
+
+func (s *SmbServer) fileSize(p util.FullPath, entry *filer_pb.Entry) uint64 {
+	if size, pending := s.pendingSize(p); pending {
+		return size
+	}
+	return filer2.TotalSize(entry.Chunks)
+}
+
+func (s *SmbServer) info(f *smbFile, name string, entry *filer_pb.Entry) *smbInfo {
+	return s.entryInfo(f.path, name, entry, f.eof)
+}
+
+func (s *SmbServer) entryInfo(p util.FullPath, name string, entry *filer_pb.Entry, eof uint64) *smbInfo {
+	info := &smbInfo{
+		entry: entry,
+		name:  name,
+		index: fileIndex(p),
+	}
+	if entry.IsDirectory {
+		info.attributes = fileAttributeDirectory
+	} else {
+		info.attributes = fileAttributeArchive
+		info.size = s.fileSize(p, entry)
+		if eof > info.size {
+			info.size = eof
+		}
+	}
+	if strings.HasPrefix(name, ".") && name != "." && name != ".." {
+		info.attributes |= fileAttributeHidden
+	}
+	return info
+}
+
+// fileIndex is the stable id of the file, derived from the path
+func fileIndex(p util.FullPath) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(p))
+	return h.Sum64()
+}
+
+func (info *smbInfo) allocationSize() uint64 {
+	return (info.size + blockSize - 1) / blockSize * blockSize
+}
+
+// times writes the creation, last access, last write and change times
+func (info *smbInfo) times(e *encoder) {
+	mtime := filetime(info.entry.Attributes.Mtime)
+	crtime := filetime(info.entry.Attributes.Crtime)
+	if crtime == 0 {
+		crtime = mtime
+	}
+	e.uint64(crtime).uint64(mtime).uint64(mtime).uint64(mtime)
+}
@@ -0,0 +1,258 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NTLMv2 as the server, following
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-nlmp
+
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateSign                    = 0x00000010
+	ntlmNegotiateSeal                    = 0x00000020
+	ntlmNegotiateNtlm                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmTargetTypeServer                 = 0x00020000
+	ntlmNegotiateExtendedSessionsecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiateVersion                 = 0x02000000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiateKeyExch                 = 0x40000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmAcceptedClientFlags = ntlmNegotiateUnicode | ntlmNegotiateSign | ntlmNegotiateSeal | ntlmNegotiateNtlm |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionsecurity | ntlmNegotiate128 | ntlmNegotiateKeyExch | ntlmNegotiate56
+
+	// av pairs of the target info
+	msvAvEOL             = 0
+	msvAvNbComputerName  = 1
+	msvAvNbDomainName    = 2
+	msvAvDnsComputerName = 3
+	msvAvDnsDomainName   = 4
+	msvAvFlags           = 6
+	msvAvTimestamp       = 7
+
+	msvAvFlagMicPresent = 0x00000002
+
+	ntlmNegotiateMessage    = 1
+	ntlmChallengeMessage    = 2
+	ntlmAuthenticateMessage = 3
+)
+
+var (
+	ntlmSignature = []byte("NTLMSSP\x00")
+
+	clientSigningMagic = "session key to client-to-server signing key magic constant\x00"
+	serverSigningMagic = "session key to server-to-client signing key magic constant\x00"
+	clientSealingMagic = "session key to client-to-server sealing key magic constant\x00"
+	serverSealingMagic = "session key to server-to-client sealing key magic constant\x00"
+
+	errNtlmLogon = errors.New("ntlm logon failure")
+)
+
+// ntlmServer keeps the state of one NTLM authentication
+type ntlmServer struct {
+	negotiate       []byte
+	challenge       []byte
+	serverChallenge [8]byte
+	flags           uint32
+
+	user               *User
+	exportedSessionKey []byte
+}
+
+func isNtlmMessage(token []byte, messageType uint32) bool {
+	return len(token) >= 12 && bytes.Equal(token[:8], ntlmSignature) && binary.LittleEndian.Uint32(token[8:12]) == messageType
+}
+
+// challengeMessage replies the NEGOTIATE_MESSAGE of the client
+func (n *ntlmServer) challengeMessage(negotiate []byte, serverName, domain string) ([]byte, error) {
+	if !isNtlmMessage(negotiate, ntlmNegotiateMessage) || len(negotiate) < 16 {
+		return nil, fmt.Errorf("not a ntlm negotiate message")
+	}
+	clientFlags := binary.LittleEndian.Uint32(negotiate[12:16])
+	if clientFlags&ntlmNegotiateUnicode == 0 {
+		return nil, fmt.Errorf("ntlm without unicode is not supported")
+	}
+	n.negotiate = negotiate
+	n.flags = clientFlags&ntlmAcceptedClientFlags | ntlmNegotiateTargetInfo | ntlmRequestTarget | ntlmTargetTypeServer | ntlmNegotiateVersion
+	if _, err := rand.Read(n.serverChallenge[:]); err != nil {
+		return nil, err
+	}
+
+	targetName := encodeUtf16(strings.ToUpper(serverName))
+	targetInfo := &encoder{}
+	for _, av := range []struct {
+		id    uint16
+		value []byte
+	}{
+		{msvAvNbDomainName, encodeUtf16(strings.ToUpper(domain))},
+		{msvAvNbComputerName, targetName},
+		{msvAvDnsDomainName, encodeUtf16(strings.ToLower(domain))},
+		{msvAvDnsComputerName, encodeUtf16(strings.ToLower(serverName))},
+	} {
+		targetInfo.uint16(av.id).uint16(uint16(len(av.value))).bytes(av.value)
+	}
+	targetInfo.uint16(msvAvTimestamp).uint16(8).uint64(nowFiletime())
+	targetInfo.uint16(msvAvEOL).uint16(0)
+
+	const headerSize = 56
+	e := &encoder{}
+	e.bytes(ntlmSignature).uint32(ntlmChallengeMessage)
+	e.uint16(uint16(len(targetName))).uint16(uint16(len(targetName))).uint32(headerSize)
+	e.uint32(n.flags)
+	e.bytes(n.serverChallenge[:])
+	e.zeros(8)
+	e.uint16(uint16(targetInfo.len())).uint16(uint16(targetInfo.len())).uint32(uint32(headerSize + len(targetName)))
+	// version 10.0, ntlm revision 15
+	e.uint8(10).uint8(0).uint16(0).zeros(3).uint8(15)
+	e.bytes(targetName).bytes(targetInfo.b)
+	n.challenge = e.b
+	return n.challenge, nil
+}
+
+// authenticate verifies the AUTHENTICATE_MESSAGE of the client, and derives the session key
+func (n *ntlmServer) authenticate(message []byte, users *UserStore) error {
+	if !isNtlmMessage(message, ntlmAuthenticateMessage) || len(message) < 64 || n.challenge == nil {
+		return fmt.Errorf("not a ntlm authenticate message")
+	}
+	ntResponse, err := ntlmField(message, 20)
+	if err != nil {
+		return err
+	}
+	domainName, err := ntlmField(message, 28)
+	if err != nil {
+		return err
+	}
+	userName, err := ntlmField(message, 36)
+	if err != nil {
+		return err
+	}
+	encryptedSessionKey, err := ntlmField(message, 52)
+	if err != nil {
+		return err
+	}
+
+	username, domain := decodeUtf16(userName), decodeUtf16(domainName)
+	user, found := users.findUser(username)
+	// only NTLMv2, the response has the 16 bytes NTProofStr and the client blob of at least 28 bytes
+	if !found || len(ntResponse) < 16+28 {
+		return errNtlmLogon
+	}
+
+	ntowf := hmacMd5(user.ntHash, encodeUtf16(strings.ToUpper(username)+domain))
+	ntProof, blob := ntResponse[:16], ntResponse[16:]
+	if subtle.ConstantTimeCompare(ntProof, hmacMd5(ntowf, n.serverChallenge[:], blob)) != 1 {
+		return errNtlmLogon
+	}
+	sessionBaseKey := hmacMd5(ntowf, ntProof)
+
+	n.exportedSessionKey = sessionBaseKey
+	if n.flags&ntlmNegotiateKeyExch != 0 && len(encryptedSessionKey) == 16 {
+		n.exportedSessionKey = make([]byte, 16)
+		cipher, _ := rc4.NewCipher(sessionBaseKey)
+		cipher.XORKeyStream(n.exportedSessionKey, encryptedSessionKey)
+	}
+
+	// the MIC over the three messages is present if the client says so in the av pairs of the blob
+	if avFlags, ok := findAvPair(blob[28:], msvAvFlags); ok && len(avFlags) == 4 && binary.LittleEndian.Uint32(avFlags)&msvAvFlagMicPresent != 0 {
+		if len(message) < 88 {
+			return errNtlmLogon
+		}
+		zeroed := make([]byte, len(message))
+		copy(zeroed, message)
+		copy(zeroed[72:88], make([]byte, 16))
+		if subtle.ConstantTimeCompare(message[72:88], hmacMd5(n.exportedSessionKey, n.negotiate, n.challenge, zeroed)) != 1 {
+			return errNtlmLogon
+		}
+	}
+
+	n.user = user
+	return nil
+}
+
+// ntlmField reads the length, max length and offset of a payload field
+func ntlmField(message []byte, at int) ([]byte, error) {
+	length := int(binary.LittleEndian.Uint16(message[at:]))
+	offset := int(binary.LittleEndian.Uint32(message[at+4:]))
+	if length == 0 {
+		return nil, nil
+	}
+	if offset+length > len(message) {
+		return nil, errMalformed
+	}
+	return message[offset : offset+length], nil
+}
+
+func findAvPair(avPairs []byte, id uint16) ([]byte, bool) {
+	for len(avPairs) >= 4 {
+		avId := binary.LittleEndian.Uint16(avPairs)
+		length := int(binary.LittleEndian.Uint16(avPairs[2:]))
+		if avId == msvAvEOL || 4+length > len(avPairs) {
+			break
+		}
+		if avId == id {
+			return avPairs[4 : 4+length], true
+		}
+		avPairs = avPairs[4+length:]
+	}
+	return nil, false
+}
+
+func hmacMd5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func md5Sum(data ...[]byte) []byte {
+	h := md5.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// sealingKey follows SEALKEY of ms-nlmp, with extended session security
+func (n *ntlmServer) sealingKey(magic string) []byte {
+	key := n.exportedSessionKey
+	switch {
+	case n.flags&ntlmNegotiate128 != 0:
+	case n.flags&ntlmNegotiate56 != 0:
+		key = key[:7]
+	default:
+		key = key[:5]
+	}
+	return md5Sum(key, []byte(magic))
+}
+
+// mic computes the GSS_GetMIC signature of the message with the sequence number 0,
+// used for the mechListMIC of spnego
+func (n *ntlmServer) mic(message []byte, fromClient bool) []byte {
+	signMagic, sealMagic := serverSigningMagic, serverSealingMagic
+	if fromClient {
+		signMagic, sealMagic = clientSigningMagic, clientSealingMagic
+	}
+	seq := []byte{0, 0, 0, 0}
+	checksum := hmacMd5(md5Sum(n.exportedSessionKey, []byte(signMagic)), seq, message)[:8]
+	if n.flags&ntlmNegotiateKeyExch != 0 {
+		cipher, _ := rc4.NewCipher(n.sealingKey(sealMagic))
+		cipher.XORKeyStream(checksum, checksum)
+	}
+	e := &encoder{}
+	e.uint32(1).bytes(checksum).bytes(seq)
+	return e.b
+}
@@ -0,0 +1,299 @@
+package smb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf16"
+)
+
+// SMB 2 and 3 over direct tcp, following
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-smb2
+
+const (
+	smb2ProtocolId = "\xfeSMB"
+	smb1ProtocolId = "\xffSMB"
+	smb2HeaderSize = 64
+	maxMessageSize = 8*1024*1024 + 1024
+
+	// dialects
+	smb202       = 0x0202
+	smb210       = 0x0210
+	smb300       = 0x0300
+	smb302       = 0x0302
+	smb311       = 0x0311
+	smb2Wildcard = 0x02ff
+
+	// commands
+	smb2Negotiate      = 0x00
+	smb2SessionSetup   = 0x01
+	smb2Logoff         = 0x02
+	smb2TreeConnect    = 0x03
+	smb2TreeDisconnect = 0x04
+	smb2Create         = 0x05
+	smb2Close          = 0x06
+	smb2Flush          = 0x07
+	smb2Read           = 0x08
+	smb2Write          = 0x09
+	smb2Lock           = 0x0a
+	smb2Ioctl          = 0x0b
+	smb2Cancel         = 0x0c
+	smb2Echo           = 0x0d
+	smb2QueryDirectory = 0x0e
+	smb2ChangeNotify   = 0x0f
+	smb2QueryInfo      = 0x10
+	smb2SetInfo        = 0x11
+	smb2OplockBreak    = 0x12
+
+	// header flags
+	smb2FlagsServerToRedir     = 0x00000001
+	smb2FlagsAsyncCommand      = 0x00000002
+	smb2FlagsRelatedOperations = 0x00000004
+	smb2FlagsSigned            = 0x00000008
+
+	// security modes
+	smb2NegotiateSigningEnabled  = 0x0001
+	smb2NegotiateSigningRequired = 0x0002
+
+	// capabilities
+	smb2GlobalCapLargeMtu = 0x00000004
+
+	// negotiate contexts
+	smb2PreauthIntegrityCapabilities = 0x0001
+	smb2HashSha512                   = 0x0001
+
+	// session flags
+	smb2SessionFlagIsGuest = 0x0001
+
+	// share types
+	smb2ShareTypeDisk = 0x01
+	smb2ShareTypePipe = 0x02
+
+	maxTransactSize = 1024 * 1024
+	maxReadSize     = 1024 * 1024
+	maxWriteSize    = 1024 * 1024
+	smb202MaxSize   = 64 * 1024
+)
+
+// NT status codes
+const (
+	statusSuccess                = 0x00000000
+	statusPending                = 0x00000103
+	statusBufferOverflow         = 0x80000005
+	statusNoMoreFiles            = 0x80000006
+	statusNotImplemented         = 0xc0000002
+	statusInvalidInfoClass       = 0xc0000003
+	statusInfoLengthMismatch     = 0xc0000004
+	statusInvalidParameter       = 0xc000000d
+	statusNoSuchFile             = 0xc000000f
+	statusInvalidDeviceRequest   = 0xc0000010
+	statusEndOfFile              = 0xc0000011
+	statusMoreProcessingRequired = 0xc0000016
+	statusAccessDenied           = 0xc0000022
+	statusBufferTooSmall         = 0xc0000023
+	statusObjectNameInvalid      = 0xc0000033
+	statusObjectNameNotFound     = 0xc0000034
+	statusObjectNameCollision    = 0xc0000035
+	statusObjectPathNotFound     = 0xc000003a
+	statusLogonFailure           = 0xc000006d
+	statusFileIsADirectory       = 0xc00000ba
+	statusNotSupported           = 0xc00000bb
+	statusNetworkNameDeleted     = 0xc00000c9
+	statusBadNetworkName         = 0xc00000cc
+	statusInternalError          = 0xc00000e5
+	statusDirectoryNotEmpty      = 0xc0000101
+	statusNotADirectory          = 0xc0000103
+	statusFileClosed             = 0xc0000128
+	statusUserSessionDeleted     = 0xc0000203
+	statusNotFound               = 0xc0000225
+	statusRequestNotAccepted     = 0xc00000d0
+	statusDeletePending          = 0xc0000056
+	statusIoDevice               = 0xc0000185
+	statusFsDriverRequired       = 0xc000019c
+)
+
+var errMalformed = errors.New("malformed message")
+
+type smb2Header struct {
+	creditCharge uint16
+	status       uint32
+	command      uint16
+	credits      uint16
+	flags        uint32
+	nextCommand  uint32
+	messageId    uint64
+	asyncId      uint64
+	treeId       uint32
+	sessionId    uint64
+	signature    [16]byte
+}
+
+func parseHeader(b []byte) (*smb2Header, error) {
+	if len(b) < smb2HeaderSize || string(b[0:4]) != smb2ProtocolId || binary.LittleEndian.Uint16(b[4:6]) != smb2HeaderSize {
+		return nil, errMalformed
+	}
+	h := &smb2Header{
+		creditCharge: binary.LittleEndian.Uint16(b[6:8]),
+		status:       binary.LittleEndian.Uint32(b[8:12]),
+		command:      binary.LittleEndian.Uint16(b[12:14]),
+		credits:      binary.LittleEndian.Uint16(b[14:16]),
+		flags:        binary.LittleEndian.Uint32(b[16:20]),
+		nextCommand:  binary.LittleEndian.Uint32(b[20:24]),
+		messageId:    binary.LittleEndian.Uint64(b[24:32]),
+		sessionId:    binary.LittleEndian.Uint64(b[40:48]),
+	}
+	if h.flags&smb2FlagsAsyncCommand != 0 {
+		h.asyncId = binary.LittleEndian.Uint64(b[32:40])
+	} else {
+		h.treeId = binary.LittleEndian.Uint32(b[36:40])
+	}
+	copy(h.signature[:], b[48:64])
+	return h, nil
+}
+
+func (h *smb2Header) marshal(b []byte) {
+	copy(b[0:4], smb2ProtocolId)
+	binary.LittleEndian.PutUint16(b[4:6], smb2HeaderSize)
+	binary.LittleEndian.PutUint16(b[6:8], h.creditCharge)
+	binary.LittleEndian.PutUint32(b[8:12], h.status)
+	binary.LittleEndian.PutUint16(b[12:14], h.command)
+	binary.LittleEndian.PutUint16(b[14:16], h.credits)
+	binary.LittleEndian.PutUint32(b[16:20], h.flags)
+	binary.LittleEndian.PutUint32(b[20:24], h.nextCommand)
+	binary.LittleEndian.PutUint64(b[24:32], h.messageId)
+	if h.flags&smb2FlagsAsyncCommand != 0 {
+		binary.LittleEndian.PutUint64(b[32:40], h.asyncId)
+	} else {
+		binary.LittleEndian.PutUint32(b[32:36], 0)
+		binary.LittleEndian.PutUint32(b[36:40], h.treeId)
+	}
+	binary.LittleEndian.PutUint64(b[40:48], h.sessionId)
+	copy(b[48:64], h.signature[:])
+}
+
+// readFrame reads one message with the 4 bytes direct tcp transport header
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errMalformed
+	}
+	length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+	if length > maxMessageSize {
+		return nil, errMalformed
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func writeFrame(w io.Writer, message []byte) error {
+	frame := make([]byte, 4+len(message))
+	frame[1], frame[2], frame[3] = byte(len(message)>>16), byte(len(message)>>8), byte(len(message))
+	copy(frame[4:], message)
+	_, err := w.Write(frame)
+	return err
+}
+
+// field reads a variable length field of the message, located by its offset from the header start
+func field(message []byte, offset, length int) ([]byte, error) {
+	if length == 0 {
+		return nil, nil
+	}
+	if offset < 0 || length < 0 || offset+length > len(message) {
+		return nil, errMalformed
+	}
+	return message[offset : offset+length], nil
+}
+
+// encoder appends the little endian fields of a message body
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) uint8(v uint8) *encoder {
+	e.b = append(e.b, v)
+	return e
+}
+
+func (e *encoder) uint16(v uint16) *encoder {
+	e.b = append(e.b, byte(v), byte(v>>8))
+	return e
+}
+
+func (e *encoder) uint32(v uint32) *encoder {
+	e.b = append(e.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	return e
+}
+
+func (e *encoder) uint64(v uint64) *encoder {
+	e.uint32(uint32(v))
+	return e.uint32(uint32(v >> 32))
+}
+
+func (e *encoder) bytes(v []byte) *encoder {
+	e.b = append(e.b, v...)
+	return e
+}
+
+func (e *encoder) zeros(n int) *encoder {
+	for i := 0; i < n; i++ {
+		e.b = append(e.b, 0)
+	}
+	return e
+}
+
+// align pads to the multiple of n, counting from the start of the body
+func (e *encoder) align(n int) *encoder {
+	for len(e.b)%n != 0 {
+		e.b = append(e.b, 0)
+	}
+	return e
+}
+
+func (e *encoder) putUint32(at int, v uint32) {
+	binary.LittleEndian.PutUint32(e.b[at:], v)
+}
+
+func (e *encoder) len() int {
+	return len(e.b)
+}
+
+func encodeUtf16(s string) []byte {
+	codes := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(codes))
+	for i, c := range codes {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func decodeUtf16(b []byte) string {
+	codes := make([]uint16, len(b)/2)
+	for i := range codes {
+		codes[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(codes))
+}
+
+// filetime is the number of 100ns intervals since 1601
+func filetime(unixSeconds int64) uint64 {
+	if unixSeconds <= 0 {
+		return 0
+	}
+	return uint64(unixSeconds+11644473600) * 10000000
+}
+
+func fromFiletime(t uint64) int64 {
+	return int64(t/10000000) - 11644473600
+}
+
+func nowFiletime() uint64 {
+	now := time.Now()
+	return uint64(now.UnixNano()/100) + 11644473600*10000000
+}
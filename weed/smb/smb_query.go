@@ -0,0 +1,596 @@
+package smb
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// information classes
+const (
+	fileDirectoryInformation       = 0x01
+	fileFullDirectoryInformation   = 0x02
+	fileBothDirectoryInformation   = 0x03
+	fileBasicInformation           = 0x04
+	fileStandardInformation        = 0x05
+	fileInternalInformation        = 0x06
+	fileEaInformation              = 0x07
+	fileAccessInformation          = 0x08
+	fileRenameInformation          = 0x0a
+	fileNamesInformation           = 0x0c
+	fileDispositionInformation     = 0x0d
+	filePositionInformation        = 0x0e
+	fileModeInformation            = 0x10
+	fileAlignmentInformation       = 0x11
+	fileAllInformation             = 0x12
+	fileAllocationInformation      = 0x13
+	fileEndOfFileInformation       = 0x14
+	fileStreamInformation          = 0x16
+	fileNetworkOpenInformation     = 0x22
+	fileAttributeTagInformation    = 0x23
+	fileIdBothDirectoryInformation = 0x25
+	fileIdFullDirectoryInformation = 0x26
+	fileDispositionInformationEx   = 0x40
+	fileFsVolumeInformation        = 0x01
+	fileFsSizeInformation          = 0x03
+	fileFsDeviceInformation        = 0x04
+	fileFsAttributeInformation     = 0x05
+	fileFsFullSizeInformation      = 0x07
+	fileFsSectorSizeInformation    = 0x0b
+	fileCaseSensitiveSearch        = 0x00000001
+	fileCasePreservedNames         = 0x00000002
+	fileUnicodeOnDisk              = 0x00000004
+	fileDeviceDisk                 = 0x00000007
+	ownerSecurityInformation       = 0x00000001
+	groupSecurityInformation       = 0x00000002
+	daclSecurityInformation        = 0x00000004
+	sectorsPerAllocationUnit       = 8
+	bytesPerSector                 = blockSize / sectorsPerAllocationUnit
+	unlimitedSize                  = 1 << 40
+)
+
+func (c *smbConn) queryDirectory(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 32 {
+		return statusInvalidParameter, nil
+	}
+	infoClass, flags := b[2], b[3]
+	f, status := c.getFile(req, b[8:24])
+	if status != statusSuccess {
+		return status, nil
+	}
+	if !f.isDir {
+		return statusInvalidParameter, nil
+	}
+	patternBytes, err := field(req.message, int(binary.LittleEndian.Uint16(b[24:26])), int(binary.LittleEndian.Uint16(b[26:28])))
+	if err != nil {
+		return statusInvalidParameter, nil
+	}
+	outputLength := int(binary.LittleEndian.Uint32(b[28:32]))
+	switch infoClass {
+	case fileDirectoryInformation, fileFullDirectoryInformation, fileBothDirectoryInformation,
+		fileNamesInformation, fileIdBothDirectoryInformation, fileIdFullDirectoryInformation:
+	default:
+		return statusInvalidInfoClass, nil
+	}
+
+	s := c.server
+	if f.listing == nil || flags&(queryRestartScans|queryReopen) != 0 {
+		pattern := decodeUtf16(patternBytes)
+		if pattern == "" {
+			pattern = "*"
+		}
+		f.pattern, f.listingPos = pattern, 0
+		if f.listing, status = s.listDirectory(f.path, pattern); status != statusSuccess {
+			f.listing = nil
+			return status, nil
+		}
+		if len(f.listing) == 0 {
+			return statusNoSuchFile, nil
+		}
+	}
+	if f.listingPos >= len(f.listing) {
+		return statusNoMoreFiles, nil
+	}
+
+	out := &encoder{}
+	lastEntryAt := -1
+	for ; f.listingPos < len(f.listing); f.listingPos++ {
+		item := f.listing[f.listingPos]
+		e := &encoder{}
+		encodeDirectoryInfo(e, infoClass, s.entryInfo(item.path, item.name, item.entry, 0))
+		// the entries are 8 bytes aligned, and chained by the next entry offset
+		padded := (out.len() + 7) &^ 7
+		if padded+e.len() > outputLength {
+			if lastEntryAt < 0 {
+				return statusBufferOverflow, nil
+			}
+			break
+		}
+		if lastEntryAt >= 0 {
+			out.zeros(padded - out.len())
+			out.putUint32(lastEntryAt, uint32(padded-lastEntryAt))
+		}
+		lastEntryAt = out.len()
+		out.bytes(e.b)
+		if flags&querySingleEntry != 0 {
+			f.listingPos++
+			break
+		}
+	}
+
+	e := &encoder{}
+	e.uint16(9).uint16(smb2HeaderSize + 8).uint32(uint32(out.len())).bytes(out.b)
+	return statusSuccess, e.b
+}
+
+// listDirectory lists the matching entries, with "." and ".."
+func (s *SmbServer) listDirectory(dir util.FullPath, pattern string) ([]*dirItem, uint32) {
+	entries, err := s.listEntries(dir)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	direntry, err := s.lookupEntry(dir)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	var items []*dirItem
+	for _, name := range []string{".", ".."} {
+		if matchPattern(pattern, name) {
+			items = append(items, &dirItem{name: name, entry: direntry, path: dir})
+		}
+	}
+	for _, entry := range entries {
+		if matchPattern(pattern, entry.Name) {
+			items = append(items, &dirItem{name: entry.Name, entry: entry, path: dir.Child(entry.Name)})
+		}
+	}
+	return items, statusSuccess
+}
+
+func encodeDirectoryInfo(e *encoder, infoClass uint8, info *smbInfo) {
+	name := encodeUtf16(info.name)
+	e.uint32(0).uint32(0)
+	if infoClass == fileNamesInformation {
+		e.uint32(uint32(len(name))).bytes(name)
+		return
+	}
+	info.times(e)
+	e.uint64(info.size).uint64(info.allocationSize()).uint32(info.attributes).uint32(uint32(len(name)))
+	switch infoClass {
+	case fileFullDirectoryInformation:
+		e.uint32(0)
+	case fileIdFullDirectoryInformation:
+		e.uint32(0).uint32(0).uint64(info.index)
+	case fileBothDirectoryInformation:
+		e.uint32(0).uint8(0).uint8(0).zeros(24)
+	case fileIdBothDirectoryInformation:
+		e.uint32(0).uint8(0).uint8(0).zeros(24).uint16(0).uint64(info.index)
+	}
+	e.bytes(name)
+}
+
+// matchPattern matches the name with the windows wildcards case insensitively
+func matchPattern(pattern, name string) bool {
+	if pattern == "*" || pattern == "*.*" {
+		return true
+	}
+	// the DOS_STAR, DOS_QM and DOS_DOT
+	pattern = strings.NewReplacer("<", "*", ">", "?", `"`, ".").Replace(pattern)
+	return matchWildcard(strings.ToLower(pattern), strings.ToLower(name))
+}
+
+func matchWildcard(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchWildcard(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[size:]
+		default:
+			if name == "" || pattern[0] != name[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return name == ""
+}
+
+func (c *smbConn) queryInfo(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 40 {
+		return statusInvalidParameter, nil
+	}
+	infoType, infoClass := b[2], b[3]
+	outputLength := int(binary.LittleEndian.Uint32(b[4:8]))
+	additionalInformation := binary.LittleEndian.Uint32(b[16:20])
+	f, status := c.getFile(req, b[24:40])
+	if status != statusSuccess {
+		return status, nil
+	}
+
+	s := c.server
+	out := &encoder{}
+	switch infoType {
+	case infoFile:
+		status = s.queryFileInfo(out, f, infoClass)
+	case infoFilesystem:
+		status = s.queryFsInfo(out, f, infoClass)
+	case infoSecurity:
+		encodeSecurityDescriptor(out, additionalInformation, f.isDir)
+		if out.len() > outputLength {
+			return statusBufferTooSmall, (&encoder{}).uint16(9).uint8(0).uint8(0).uint32(4).uint32(uint32(out.len())).b
+		}
+	default:
+		status = statusNotSupported
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	if out.len() > outputLength {
+		status = statusBufferOverflow
+		out.b = out.b[:outputLength]
+	}
+
+	e := &encoder{}
+	e.uint16(9).uint16(smb2HeaderSize + 8).uint32(uint32(out.len())).bytes(out.b)
+	return status, e.b
+}
+
+func (s *SmbServer) queryFileInfo(out *encoder, f *smbFile, infoClass uint8) uint32 {
+	if err := s.flushWriter(f.path); err != nil {
+		glog.Errorf("smb query %s: %v", f.path, err)
+		return statusIoDevice
+	}
+	entry, err := s.lookupEntry(f.path)
+	if err != nil {
+		return toStatus(err)
+	}
+	info := s.info(f, f.path.Name(), entry)
+
+	basic := func() {
+		info.times(out)
+		out.uint32(info.attributes).uint32(0)
+	}
+	standard := func() {
+		var isDir uint8
+		if f.isDir {
+			isDir = 1
+		}
+		var deletePending uint8
+		if f.deleteOnClose {
+			deletePending = 1
+		}
+		out.uint64(info.allocationSize()).uint64(info.size).uint32(1).uint8(deletePending).uint8(isDir).uint16(0)
+	}
+	switch infoClass {
+	case fileBasicInformation:
+		basic()
+	case fileStandardInformation:
+		standard()
+	case fileInternalInformation:
+		out.uint64(info.index)
+	case fileEaInformation:
+		out.uint32(0)
+	case fileAccessInformation:
+		out.uint32(f.access)
+	case filePositionInformation:
+		out.uint64(0)
+	case fileModeInformation, fileAlignmentInformation:
+		out.uint32(0)
+	case fileAllInformation:
+		basic()
+		standard()
+		out.uint64(info.index).uint32(0).uint32(f.access).uint64(0).uint32(0).uint32(0)
+		name := encodeUtf16(f.windowsPath())
+		out.uint32(uint32(len(name))).bytes(name)
+	case fileStreamInformation:
+		if !f.isDir {
+			name := encodeUtf16("::$DATA")
+			out.uint32(0).uint32(uint32(len(name))).uint64(info.size).uint64(info.allocationSize()).bytes(name)
+		}
+	case fileNetworkOpenInformation:
+		info.times(out)
+		out.uint64(info.allocationSize()).uint64(info.size).uint32(info.attributes).uint32(0)
+	case fileAttributeTagInformation:
+		out.uint32(info.attributes).uint32(0)
+	default:
+		return statusNotSupported
+	}
+	return statusSuccess
+}
+
+// windowsPath is the path of the file in the share, as "\dir\name"
+func (f *smbFile) windowsPath() string {
+	rel := strings.TrimPrefix(string(f.path), string(f.tree.root))
+	if rel == "" {
+		return `\`
+	}
+	return strings.ReplaceAll(rel, "/", `\`)
+}
+
+func (s *SmbServer) queryFsInfo(out *encoder, f *smbFile, infoClass uint8) uint32 {
+	switch infoClass {
+	case fileFsVolumeInformation:
+		label := encodeUtf16(f.tree.share.Name)
+		out.uint64(s.startTime).uint32(uint32(fileIndex(f.tree.root))).uint32(uint32(len(label))).uint8(0).uint8(0).bytes(label)
+	case fileFsSizeInformation, fileFsFullSizeInformation:
+		total, free, err := s.fsSize()
+		if err != nil {
+			glog.Errorf("smb statistics: %v", err)
+			return statusIoDevice
+		}
+		out.uint64(total / blockSize).uint64(free / blockSize)
+		if infoClass == fileFsFullSizeInformation {
+			out.uint64(free / blockSize)
+		}
+		out.uint32(sectorsPerAllocationUnit).uint32(bytesPerSector)
+	case fileFsDeviceInformation:
+		out.uint32(fileDeviceDisk).uint32(0)
+	case fileFsAttributeInformation:
+		attributes := uint32(fileCasePreservedNames | fileUnicodeOnDisk)
+		if !s.option.CaseInsensitive {
+			attributes |= fileCaseSensitiveSearch
+		}
+		name := encodeUtf16("NTFS")
+		out.uint32(attributes).uint32(255).uint32(uint32(len(name))).bytes(name)
+	case fileFsSectorSizeInformation:
+		out.uint32(bytesPerSector).uint32(blockSize).uint32(blockSize).uint32(blockSize).uint32(0).uint32(0).uint32(0)
+	default:
+		return statusNotSupported
+	}
+	return statusSuccess
+}
+
+func (s *SmbServer) fsSize() (total, free uint64, err error) {
+	var stats *filer_pb.StatisticsResponse
+	err = s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		stats, err = client.Statistics(context.Background(), &filer_pb.StatisticsRequest{
+			Collection:  s.option.Collection,
+			Replication: s.option.Replication,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	total = stats.TotalSize
+	if total == 0 {
+		total = stats.UsedSize + unlimitedSize
+	}
+	if total > stats.UsedSize {
+		free = total - stats.UsedSize
+	}
+	return total, free, nil
+}
+
+// encodeSecurityDescriptor encodes a self relative security descriptor, with full control to everyone.
+// The permissions are checked by the shares and the users instead.
+func encodeSecurityDescriptor(e *encoder, additionalInformation uint32, isDir bool) {
+	everyone := []byte{1, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+	var owner, group, dacl uint32
+	at := uint32(20)
+	if additionalInformation&ownerSecurityInformation != 0 {
+		owner, at = at, at+uint32(len(everyone))
+	}
+	if additionalInformation&groupSecurityInformation != 0 {
+		group, at = at, at+uint32(len(everyone))
+	}
+	control := uint16(0x8000) // self relative
+	if additionalInformation&daclSecurityInformation != 0 {
+		dacl = at
+		control |= 0x0004 // dacl present
+	}
+	e.uint8(1).uint8(0).uint16(control).uint32(owner).uint32(group).uint32(0).uint32(dacl)
+	if owner != 0 {
+		e.bytes(everyone)
+	}
+	if group != 0 {
+		e.bytes(everyone)
+	}
+	if dacl != 0 {
+		var inherit uint8
+		if isDir {
+			inherit = 0x03 // object and container inherit
+		}
+		aceSize := 8 + len(everyone)
+		e.uint8(2).uint8(0).uint16(uint16(8 + aceSize)).uint16(1).uint16(0)
+		e.uint8(0).uint8(inherit).uint16(uint16(aceSize)).uint32(fileAllAccess).bytes(everyone)
+	}
+}
+
+func (c *smbConn) setInfo(req *smbRequest) (uint32, []byte) {
+	b := req.body
+	if len(b) < 32 {
+		return statusInvalidParameter, nil
+	}
+	infoType, infoClass := b[2], b[3]
+	buffer, err := field(req.message, int(binary.LittleEndian.Uint16(b[8:10])), int(binary.LittleEndian.Uint32(b[4:8])))
+	if err != nil {
+		return statusInvalidParameter, nil
+	}
+	f, status := c.getFile(req, b[16:32])
+	if status != statusSuccess {
+		return status, nil
+	}
+	if req.tree.readOnly {
+		return statusAccessDenied, nil
+	}
+	if infoType != infoFile {
+		return statusNotSupported, nil
+	}
+
+	s := c.server
+	switch infoClass {
+	case fileBasicInformation:
+		if len(buffer) < 36 {
+			return statusInfoLengthMismatch, nil
+		}
+		status = s.setTimes(f, binary.LittleEndian.Uint64(buffer[0:8]), binary.LittleEndian.Uint64(buffer[16:24]))
+	case fileRenameInformation:
+		if len(buffer) < 20 {
+			return statusInfoLengthMismatch, nil
+		}
+		nameBytes, err := field(buffer, 20, int(binary.LittleEndian.Uint32(buffer[16:20])))
+		if err != nil {
+			return statusInvalidParameter, nil
+		}
+		status = c.rename(req, f, decodeUtf16(nameBytes), buffer[0] != 0)
+	case fileDispositionInformation, fileDispositionInformationEx:
+		if len(buffer) < 1 {
+			return statusInfoLengthMismatch, nil
+		}
+		deletePending := buffer[0]&0x01 != 0
+		if deletePending && f.isDir && !s.isEmptyDirectory(f.path) {
+			return statusDirectoryNotEmpty, nil
+		}
+		f.deleteOnClose = deletePending
+	case fileAllocationInformation:
+		// the storage is allocated when written
+	case fileEndOfFileInformation:
+		if len(buffer) < 8 {
+			return statusInfoLengthMismatch, nil
+		}
+		status = s.setEndOfFile(f, binary.LittleEndian.Uint64(buffer))
+	default:
+		return statusNotSupported, nil
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	return statusSuccess, (&encoder{}).uint16(2).b
+}
+
+// setTimes changes the creation and the last write time, where 0 and -1 mean not to change
+func (s *SmbServer) setTimes(f *smbFile, creationTime, lastWriteTime uint64) uint32 {
+	if (creationTime == 0 || creationTime == 0xffffffffffffffff) && (lastWriteTime == 0 || lastWriteTime == 0xffffffffffffffff) {
+		return statusSuccess
+	}
+	if err := s.closeWriter(f.path); err != nil {
+		glog.Errorf("smb set times %s: %v", f.path, err)
+		return statusIoDevice
+	}
+	entry, err := s.lookupEntry(f.path)
+	if err != nil {
+		return toStatus(err)
+	}
+	if creationTime != 0 && creationTime != 0xffffffffffffffff {
+		entry.Attributes.Crtime = fromFiletime(creationTime)
+	}
+	if lastWriteTime != 0 && lastWriteTime != 0xffffffffffffffff {
+		entry.Attributes.Mtime = fromFiletime(lastWriteTime)
+	}
+	return s.updateEntry(f.path, entry)
+}
+
+// setEndOfFile truncates the file to 0, or extends it. The chunks can not be cut in the middle.
+func (s *SmbServer) setEndOfFile(f *smbFile, eof uint64) uint32 {
+	if f.isDir {
+		return statusFileIsADirectory
+	}
+	if err := s.closeWriter(f.path); err != nil {
+		glog.Errorf("smb set end of file %s: %v", f.path, err)
+		return statusIoDevice
+	}
+	entry, err := s.lookupEntry(f.path)
+	if err != nil {
+		return toStatus(err)
+	}
+	size := s.fileSize(f.path, entry)
+	switch {
+	case eof == 0:
+		f.eof = 0
+		if size == 0 {
+			return statusSuccess
+		}
+		return s.truncate(f.path, entry)
+	case eof >= size:
+		// the end of file is reported, until the data is written
+		f.eof = eof
+		return statusSuccess
+	}
+	return statusNotSupported
+}
+
+func (c *smbConn) rename(req *smbRequest, f *smbFile, newName string, replaceIfExists bool) uint32 {
+	names, status := splitName(newName)
+	if status != statusSuccess || len(names) == 0 {
+		return statusObjectNameInvalid
+	}
+	s := c.server
+	newPath, existing, err := s.resolve(f.tree.root, names)
+	if err != nil && err != os.ErrNotExist {
+		glog.Errorf("smb rename %s: %v", newPath, err)
+		return statusIoDevice
+	}
+	if existing != nil && strings.EqualFold(string(newPath), string(f.path)) {
+		// the same file, possibly changing the case of the name
+		dir, _ := newPath.DirAndName()
+		newPath = util.FullPath(dir).Child(names[len(names)-1])
+		if newPath == f.path {
+			return statusSuccess
+		}
+	} else if existing != nil {
+		if !replaceIfExists {
+			return statusObjectNameCollision
+		}
+		if existing.IsDirectory {
+			return statusAccessDenied
+		}
+		s.dropWriter(newPath)
+		dir, name := newPath.DirAndName()
+		if err = filer_pb.Remove(s, dir, name, true, false, false, false); err != nil {
+			glog.Errorf("smb rename %s: %v", newPath, err)
+			return statusIoDevice
+		}
+	}
+	newDir, newBase := newPath.DirAndName()
+	if !s.isDirectory(util.FullPath(newDir)) {
+		return statusObjectPathNotFound
+	}
+
+	if err = s.closeWriter(f.path); err != nil {
+		glog.Errorf("smb rename %s: %v", f.path, err)
+		return statusIoDevice
+	}
+	oldDir, oldBase := f.path.DirAndName()
+	err = s.WithFilerClient(func(client filer_pb.SeaweedFilerClient) error {
+		_, err := client.AtomicRenameEntry(context.Background(), &filer_pb.AtomicRenameEntryRequest{
+			OldDirectory: oldDir,
+			OldName:      oldBase,
+			NewDirectory: newDir,
+			NewName:      newBase,
+		})
+		return err
+	})
+	s.invalidate(f.path)
+	s.invalidate(newPath)
+	if err != nil {
+		glog.Errorf("smb rename %s => %s: %v", f.path, newPath, err)
+		return statusIoDevice
+	}
+	f.path = newPath
+	return statusSuccess
+}
@@ -0,0 +1,40 @@
+package smb
+
+import (
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"*", "a.txt", true},
+		{"*.txt", "A.TXT", true},
+		{"*.txt", "a.txt.bak", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"Desktop.ini", "desktop.ini", true},
+		{"<.doc", "report.doc", true},
+		{"rep>rt\"doc", "report.doc", true},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b", "xxaxxbxx", false},
+		{"?", "é", true},
+	} {
+		if actual := matchPattern(c.pattern, c.name); actual != c.expected {
+			t.Errorf("match %q with %q: %v", c.pattern, c.name, actual)
+		}
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	names, status := splitName(`\dir\sub\file.txt::$DATA`)
+	if status != statusSuccess || len(names) != 3 || names[2] != "file.txt" {
+		t.Errorf("split: %v %x", names, status)
+	}
+	for _, name := range []string{`a\..\b`, `a:stream`, `a\b*`, `a/b`} {
+		if _, status := splitName(name); status != statusObjectNameInvalid {
+			t.Errorf("split %q: %x", name, status)
+		}
+	}
+}
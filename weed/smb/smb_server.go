@@ -0,0 +1,397 @@
+package smb
+
+import (
+	"crypto/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"gopkg.in/jcmturner/gokrb5.v7/keytab"
+
+	"github.com/chrislusf/seaweedfs/weed/filer2"
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/pb/filer_pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/chunk_cache"
+)
+
+const (
+	homeShareName = "home"
+	ipcShareName  = "ipc$"
+)
+
+type SmbServerOption struct {
+	FilerGrpcAddress string
+	GrpcDialOption   grpc.DialOption
+	Collection       string
+	Replication      string
+	DataCenter       string
+	Cipher           bool
+	ChunkSizeMB      int
+	CacheDir         string
+	CacheSizeMB      int64
+	Shares           []*Share
+	Users            *UserStore
+	Keytab           *keytab.Keytab
+	ServerName       string
+	Domain           string
+	// resolve the names case insensitively, as Windows clients expect
+	CaseInsensitive bool
+	RequireSigning  bool
+	DirCacheTTL     time.Duration
+}
+
+type SmbServer struct {
+	option     *SmbServerOption
+	serverGuid []byte
+	startTime  uint64
+	chunkCache *chunk_cache.ChunkCache
+
+	dirCache     map[util.FullPath]*cachedListing
+	dirCacheLock sync.Mutex
+
+	writers     map[util.FullPath]*pendingWriter
+	writersLock sync.Mutex
+}
+
+type cachedListing struct {
+	entries []*filer_pb.Entry
+	expires time.Time
+}
+
+// pendingWriter keeps the writes of a file until it is flushed or closed, or until the file is idle for a while
+type pendingWriter struct {
+	writer    *filer2.ClientFileWriter
+	size      uint64
+	lastWrite time.Time
+	closed    bool
+	sync.Mutex
+}
+
+const pendingWriterIdleFlush = 5 * time.Second
+
+var _ = filer_pb.FilerClient(&SmbServer{})
+
+func NewSmbServer(option *SmbServerOption) *SmbServer {
+	serverGuid := make([]byte, 16)
+	rand.Read(serverGuid)
+	if option.ServerName == "" {
+		option.ServerName, _ = os.Hostname()
+	}
+	if i := strings.Index(option.ServerName, "."); i > 0 {
+		option.ServerName = option.ServerName[:i]
+	}
+	if option.Domain == "" {
+		option.Domain = "WORKGROUP"
+	}
+	s := &SmbServer{
+		option:     option,
+		serverGuid: serverGuid,
+		startTime:  nowFiletime(),
+		chunkCache: chunk_cache.NewChunkCache(256, option.CacheDir, option.CacheSizeMB),
+		dirCache:   make(map[util.FullPath]*cachedListing),
+		writers:    make(map[util.FullPath]*pendingWriter),
+	}
+	go s.loopFlushIdleWriters()
+	return s
+}
+
+func (s *SmbServer) WithFilerClient(fn func(filer_pb.SeaweedFilerClient) error) error {
+
+	return pb.WithCachedGrpcClient(func(grpcConnection *grpc.ClientConn) error {
+		client := filer_pb.NewSeaweedFilerClient(grpcConnection)
+		return fn(client)
+	}, s.option.FilerGrpcAddress, s.option.GrpcDialOption)
+
+}
+
+func (s *SmbServer) AdjustedUrl(hostAndPort string) string {
+	return hostAndPort
+}
+
+func (s *SmbServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go newSmbConn(s, conn).serve()
+	}
+}
+
+func (s *SmbServer) uploadOption() *filer2.ClientUploadOption {
+	return &filer2.ClientUploadOption{
+		Collection:  s.option.Collection,
+		Replication: s.option.Replication,
+		DataCenter:  s.option.DataCenter,
+		Cipher:      s.option.Cipher,
+	}
+}
+
+// findShare returns the share and its directory for the user
+func (s *SmbServer) findShare(name string, user *User) (share *Share, found bool) {
+	if strings.EqualFold(name, homeShareName) {
+		if user.HomeDir == "" {
+			return nil, false
+		}
+		return &Share{Name: homeShareName, Directory: user.HomeDir}, true
+	}
+	for _, share := range s.option.Shares {
+		if strings.EqualFold(share.Name, name) {
+			return share, true
+		}
+	}
+	return nil, false
+}
+
+// lookupEntry returns os.ErrNotExist if the entry is not found
+func (s *SmbServer) lookupEntry(p util.FullPath) (*filer_pb.Entry, error) {
+	if p == "/" {
+		return &filer_pb.Entry{
+			Name:        "/",
+			IsDirectory: true,
+			Attributes: &filer_pb.FuseAttributes{
+				FileMode: uint32(os.ModeDir | 0777),
+				Mtime:    s.startTimeUnix(),
+				Crtime:   s.startTimeUnix(),
+			},
+		}, nil
+	}
+	entry, err := filer_pb.GetEntry(s, p)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, os.ErrNotExist
+	}
+	if entry.Attributes == nil {
+		entry.Attributes = &filer_pb.FuseAttributes{}
+	}
+	return entry, nil
+}
+
+func (s *SmbServer) startTimeUnix() int64 {
+	return fromFiletime(s.startTime)
+}
+
+// resolve finds the existing path of the names under the share directory.
+// If the names are case insensitive, the path of each missing name is resolved by the parent directory listing.
+// For a missing path, the returned path is resolved as far as possible, with the remaining names as given.
+func (s *SmbServer) resolve(root util.FullPath, names []string) (util.FullPath, *filer_pb.Entry, error) {
+	p := root
+	for _, name := range names {
+		p = p.Child(name)
+	}
+	entry, err := s.lookupEntry(p)
+	if err != os.ErrNotExist || !s.option.CaseInsensitive || len(names) == 0 {
+		return p, entry, err
+	}
+
+	p = root
+	for i, name := range names {
+		entries, err := s.listEntries(p)
+		if err == os.ErrNotExist {
+			return joinNames(p, names[i:]), nil, os.ErrNotExist
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		var found *filer_pb.Entry
+		for _, e := range entries {
+			if e.Name == name {
+				found = e
+				break
+			}
+			if found == nil && strings.EqualFold(e.Name, name) {
+				found = e
+			}
+		}
+		if found == nil {
+			return joinNames(p, names[i:]), nil, os.ErrNotExist
+		}
+		p = p.Child(found.Name)
+		if i == len(names)-1 {
+			// the listing may be cached, so read the latest entry
+			entry, err = s.lookupEntry(p)
+			return p, entry, err
+		}
+		if !found.IsDirectory {
+			return joinNames(p, names[i+1:]), nil, os.ErrNotExist
+		}
+	}
+	return p, nil, os.ErrNotExist
+}
+
+func joinNames(p util.FullPath, names []string) util.FullPath {
+	for _, name := range names {
+		p = p.Child(name)
+	}
+	return p
+}
+
+// listEntries returns os.ErrNotExist if the directory is not found
+func (s *SmbServer) listEntries(dir util.FullPath) ([]*filer_pb.Entry, error) {
+	now := time.Now()
+	s.dirCacheLock.Lock()
+	cached, found := s.dirCache[dir]
+	s.dirCacheLock.Unlock()
+	if found && now.Before(cached.expires) {
+		return cached.entries, nil
+	}
+
+	if dir != "/" {
+		entry, err := s.lookupEntry(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !entry.IsDirectory {
+			return nil, os.ErrNotExist
+		}
+	}
+	var entries []*filer_pb.Entry
+	err := filer_pb.ReadDirAllEntries(s, dir, "", func(entry *filer_pb.Entry, isLast bool) error {
+		if entry.Attributes == nil {
+			entry.Attributes = &filer_pb.FuseAttributes{}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.option.DirCacheTTL > 0 {
+		s.dirCacheLock.Lock()
+		if len(s.dirCache) > 10000 {
+			s.dirCache = make(map[util.FullPath]*cachedListing)
+		}
+		s.dirCache[dir] = &cachedListing{entries: entries, expires: now.Add(s.option.DirCacheTTL)}
+		s.dirCacheLock.Unlock()
+	}
+	return entries, nil
+}
+
+// invalidate forgets the cached listings of the entry and its parent directory
+func (s *SmbServer) invalidate(p util.FullPath) {
+	dir, _ := p.DirAndName()
+	s.dirCacheLock.Lock()
+	delete(s.dirCache, p)
+	delete(s.dirCache, util.FullPath(dir))
+	s.dirCacheLock.Unlock()
+}
+
+func (s *SmbServer) getWriter(p util.FullPath) (*pendingWriter, error) {
+	s.writersLock.Lock()
+	defer s.writersLock.Unlock()
+	if w, found := s.writers[p]; found && !w.closed {
+		return w, nil
+	}
+	entry, err := s.lookupEntry(p)
+	if err != nil {
+		return nil, err
+	}
+	// the writer changes the chunks of the entry
+	entry = proto.Clone(entry).(*filer_pb.Entry)
+	w := &pendingWriter{
+		writer: filer2.NewClientFileWriter(s, p, entry, s.option.ChunkSizeMB*1024*1024, s.uploadOption()),
+		size:   filer2.TotalSize(entry.Chunks),
+	}
+	s.writers[p] = w
+	return w, nil
+}
+
+func (s *SmbServer) findWriter(p util.FullPath) *pendingWriter {
+	s.writersLock.Lock()
+	defer s.writersLock.Unlock()
+	return s.writers[p]
+}
+
+func (s *SmbServer) pendingSize(p util.FullPath) (uint64, bool) {
+	w := s.findWriter(p)
+	if w == nil {
+		return 0, false
+	}
+	w.Lock()
+	defer w.Unlock()
+	return w.size, !w.closed
+}
+
+// flushWriter saves the pending writes of the file to the filer
+func (s *SmbServer) flushWriter(p util.FullPath) error {
+	w := s.findWriter(p)
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return nil
+	}
+	err := w.writer.Flush()
+	s.invalidate(p)
+	return err
+}
+
+// closeWriter saves the pending writes, and forgets the writer
+func (s *SmbServer) closeWriter(p util.FullPath) error {
+	w := s.findWriter(p)
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	var err error
+	if !w.closed {
+		err = w.writer.Close()
+		w.closed = true
+		s.invalidate(p)
+	}
+	w.Unlock()
+	s.forgetWriter(p, w)
+	return err
+}
+
+// dropWriter discards the pending writes of a removed file
+func (s *SmbServer) dropWriter(p util.FullPath) {
+	w := s.findWriter(p)
+	if w == nil {
+		return
+	}
+	w.Lock()
+	w.closed = true
+	w.Unlock()
+	s.forgetWriter(p, w)
+}
+
+func (s *SmbServer) forgetWriter(p util.FullPath, w *pendingWriter) {
+	s.writersLock.Lock()
+	if s.writers[p] == w {
+		delete(s.writers, p)
+	}
+	s.writersLock.Unlock()
+}
+
+func (s *SmbServer) loopFlushIdleWriters() {
+	for range time.Tick(time.Second) {
+		var idle []util.FullPath
+		now := time.Now()
+		s.writersLock.Lock()
+		for p, w := range s.writers {
+			w.Lock()
+			if now.Sub(w.lastWrite) > pendingWriterIdleFlush {
+				idle = append(idle, p)
+			}
+			w.Unlock()
+		}
+		s.writersLock.Unlock()
+		for _, p := range idle {
+			if err := s.closeWriter(p); err != nil {
+				glog.Errorf("smb flush %s: %v", p, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package smb
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// kdf is the SP800-108 counter mode key derivation with HMAC-SHA256, for 128 bits keys
+func kdf(key []byte, label, context string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write([]byte(label))
+	h.Write([]byte{0})
+	h.Write([]byte(context))
+	h.Write([]byte{0, 0, 0, 128})
+	return h.Sum(nil)[:16]
+}
+
+// signingKey derives the key to sign the messages of the session
+func signingKey(dialect uint16, sessionKey []byte, preauthHash []byte) []byte {
+	switch {
+	case dialect >= smb311:
+		return kdf(sessionKey, "SMBSigningKey\x00", string(preauthHash))
+	case dialect >= smb300:
+		return kdf(sessionKey, "SMB2AESCMAC\x00", "SmbSign\x00")
+	}
+	return sessionKey
+}
+
+// signature computes the signature of a message, whose signature field is zeroed
+func signature(dialect uint16, key []byte, message []byte) []byte {
+	if dialect >= smb300 {
+		return aesCmac(key, message)
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(message)
+	return h.Sum(nil)[:16]
+}
+
+func signMessage(dialect uint16, key []byte, message []byte) {
+	binary.LittleEndian.PutUint32(message[16:20], binary.LittleEndian.Uint32(message[16:20])|smb2FlagsSigned)
+	for i := 48; i < 64; i++ {
+		message[i] = 0
+	}
+	copy(message[48:64], signature(dialect, key, message))
+}
+
+func verifyMessage(dialect uint16, key []byte, message []byte) bool {
+	expected := make([]byte, 16)
+	copy(expected, message[48:64])
+	unsigned := make([]byte, len(message))
+	copy(unsigned, message)
+	for i := 48; i < 64; i++ {
+		unsigned[i] = 0
+	}
+	return subtle.ConstantTimeCompare(expected, signature(dialect, key, unsigned)) == 1
+}
+
+// aesCmac is AES-128-CMAC of RFC 4493
+func aesCmac(key []byte, message []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	var l, k1, k2 [16]byte
+	block.Encrypt(l[:], l[:])
+	shiftLeft(k1[:], l[:])
+	if l[0]&0x80 != 0 {
+		k1[15] ^= 0x87
+	}
+	shiftLeft(k2[:], k1[:])
+	if k1[0]&0x80 != 0 {
+		k2[15] ^= 0x87
+	}
+
+	n := (len(message) + 15) / 16
+	complete := n > 0 && len(message)%16 == 0
+	if n == 0 {
+		n = 1
+	}
+	var last [16]byte
+	if complete {
+		for i := 0; i < 16; i++ {
+			last[i] = message[16*(n-1)+i] ^ k1[i]
+		}
+	} else {
+		rest := message[16*(n-1):]
+		copy(last[:], rest)
+		last[len(rest)] = 0x80
+		for i := 0; i < 16; i++ {
+			last[i] ^= k2[i]
+		}
+	}
+
+	var x [16]byte
+	for i := 0; i < n-1; i++ {
+		for j := 0; j < 16; j++ {
+			x[j] ^= message[16*i+j]
+		}
+		block.Encrypt(x[:], x[:])
+	}
+	for j := 0; j < 16; j++ {
+		x[j] ^= last[j]
+	}
+	block.Encrypt(x[:], x[:])
+	return x[:]
+}
+
+func shiftLeft(dst, src []byte) {
+	var carry byte
+	for i := len(src) - 1; i >= 0; i-- {
+		dst[i] = src[i]<<1 | carry
+		carry = src[i] >> 7
+	}
+}
+
+// preauthHash chains the messages of the negotiation and the session setup, for dialect 3.1.1
+func preauthHash(previous []byte, message []byte) []byte {
+	h := sha512.New()
+	h.Write(previous)
+	h.Write(message)
+	return h.Sum(nil)
+}
@@ -0,0 +1,162 @@
+package smb
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/md4"
+)
+
+// User is one smb user. NTLM needs the NT hash of the password, so the password is kept as plain text or as the NT hash.
+// Kerberos users are mapped by their principals, or by the username if no principal matches.
+type User struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password,omitempty"`
+	NtHash     string   `json:"ntHash,omitempty"` // hex of md4(utf16le(password))
+	Principals []string `json:"principals,omitempty"`
+	// the "home" share, if not empty
+	HomeDir  string `json:"homeDir,omitempty"`
+	Uid      uint32 `json:"uid"`
+	Gid      uint32 `json:"gid"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	ntHash   []byte
+}
+
+type UserStore struct {
+	Users      []*User `json:"users"`
+	users      map[string]*User
+	principals map[string]*User
+}
+
+// LoadUserStore reads the users from a json file, e.g.
+//
+//	{
+//	  "users": [
+//	    {
+//	      "username": "alice",
+//	      "ntHash": "8846f7eaee8fb117ad06bdd830b7586c",
+//	      "principals": ["alice@EXAMPLE.COM"],
+//	      "homeDir": "/home/alice",
+//	      "uid": 1000,
+//	      "gid": 1000
+//	    }
+//	  ]
+//	}
+func LoadUserStore(fileName string) (*UserStore, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %v", fileName, err)
+	}
+	return ParseUserStore(data)
+}
+
+func ParseUserStore(data []byte) (*UserStore, error) {
+	store := &UserStore{}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("parse users: %v", err)
+	}
+	store.users = make(map[string]*User)
+	store.principals = make(map[string]*User)
+	for _, user := range store.Users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("user without username")
+		}
+		// windows user names are case insensitive
+		key := strings.ToLower(user.Username)
+		if _, found := store.users[key]; found {
+			return nil, fmt.Errorf("duplicated user %s", user.Username)
+		}
+		switch {
+		case user.NtHash != "":
+			hash, err := hex.DecodeString(user.NtHash)
+			if err != nil || len(hash) != 16 {
+				return nil, fmt.Errorf("user %s: ntHash should be 32 hex digits", user.Username)
+			}
+			user.ntHash = hash
+		case user.Password != "":
+			user.ntHash = ntHash(user.Password)
+		}
+		if user.HomeDir != "" {
+			if !strings.HasPrefix(user.HomeDir, "/") {
+				return nil, fmt.Errorf("user %s: homeDir should be an absolute path", user.Username)
+			}
+			user.HomeDir = path.Clean(user.HomeDir)
+		}
+		store.users[key] = user
+		for _, principal := range user.Principals {
+			if _, found := store.principals[strings.ToLower(principal)]; found {
+				return nil, fmt.Errorf("duplicated principal %s", principal)
+			}
+			store.principals[strings.ToLower(principal)] = user
+		}
+	}
+	return store, nil
+}
+
+func ntHash(password string) []byte {
+	h := md4.New()
+	h.Write(encodeUtf16(password))
+	return h.Sum(nil)
+}
+
+// findUser finds the user of NTLM, which may also be given as "user@domain"
+func (store *UserStore) findUser(username string) (*User, bool) {
+	if i := strings.Index(username, "@"); i > 0 {
+		username = username[:i]
+	}
+	user, found := store.users[strings.ToLower(username)]
+	if !found || user.ntHash == nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// findPrincipal maps a kerberos principal "name@REALM" to the user
+func (store *UserStore) findPrincipal(principal string) (*User, bool) {
+	if user, found := store.principals[strings.ToLower(principal)]; found {
+		return user, true
+	}
+	name := principal
+	if i := strings.LastIndex(principal, "@"); i > 0 {
+		name = principal[:i]
+	}
+	user, found := store.users[strings.ToLower(name)]
+	return user, found
+}
+
+// Share is a directory on the filer shared to all the users
+type Share struct {
+	Name      string
+	Directory string
+	ReadOnly  bool
+}
+
+// ParseShares parses the shares as "name:/dir[:ro],name2:/dir2"
+func ParseShares(value string) ([]*Share, error) {
+	var shares []*Share
+	names := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !strings.HasPrefix(parts[1], "/") || len(parts) == 3 && parts[2] != "ro" {
+			return nil, fmt.Errorf("invalid share %q, expecting name:/dir or name:/dir:ro", item)
+		}
+		name := strings.ToLower(parts[0])
+		if names[name] || name == homeShareName || name == ipcShareName {
+			return nil, fmt.Errorf("duplicated or reserved share name %s", parts[0])
+		}
+		names[name] = true
+		shares = append(shares, &Share{
+			Name:      parts[0],
+			Directory: path.Clean(parts[1]),
+			ReadOnly:  len(parts) == 3,
+		})
+	}
+	return shares, nil
+}
@@ -0,0 +1,52 @@
+package smb
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestUserStore(t *testing.T) {
+	store, err := ParseUserStore([]byte(`{"users":[
+		{"username":"Alice","password":"password","principals":["alice.admin@EXAMPLE.COM"],"homeDir":"/home/alice/"},
+		{"username":"bob","ntHash":"8846F7EAEE8FB117AD06BDD830B7586C"},
+		{"username":"carol"}
+	]}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	alice, found := store.findUser("alice@workgroup")
+	if !found || hex.EncodeToString(alice.ntHash) != "8846f7eaee8fb117ad06bdd830b7586c" || alice.HomeDir != "/home/alice" {
+		t.Errorf("alice: %+v", alice)
+	}
+	if bob, found := store.findUser("BOB"); !found || hex.EncodeToString(bob.ntHash) != "8846f7eaee8fb117ad06bdd830b7586c" {
+		t.Errorf("bob: %+v", bob)
+	}
+	if _, found := store.findUser("carol"); found {
+		t.Errorf("user without password can use ntlm")
+	}
+	if user, found := store.findPrincipal("alice.admin@example.com"); !found || user != alice {
+		t.Errorf("principal of alice: %+v", user)
+	}
+	if user, found := store.findPrincipal("carol@EXAMPLE.COM"); !found || user.Username != "carol" {
+		t.Errorf("principal of carol: %+v", user)
+	}
+
+	if _, err := ParseUserStore([]byte(`{"users":[{"username":"a","ntHash":"1234"}]}`)); err == nil {
+		t.Errorf("short ntHash accepted")
+	}
+}
+
+func TestParseShares(t *testing.T) {
+	shares, err := ParseShares("data:/buckets/data/,Archive:/archive:ro")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(shares) != 2 || shares[0].Directory != "/buckets/data" || shares[0].ReadOnly || shares[1].Name != "Archive" || !shares[1].ReadOnly {
+		t.Errorf("shares: %+v %+v", shares[0], shares[1])
+	}
+	for _, value := range []string{"data", "data:relative", "home:/home", "a:/a,A:/b", "a:/a:rw"} {
+		if _, err := ParseShares(value); err == nil {
+			t.Errorf("invalid shares %q accepted", value)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package stats
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MaintenanceTask tracks the progress of one long running operation on a volume,
+// e.g. vacuum, volume copy, or erasure coding.
+// All methods are safe to call on a nil task.
+type MaintenanceTask struct {
+	Type       string
+	VolumeId   uint32
+	Collection string
+	StartTime  time.Time
+
+	processedBytes int64
+	totalBytes     int64
+	phase          atomic.Value
+
+	processedGauge prometheus.Gauge
+	totalGauge     prometheus.Gauge
+	etaGauge       prometheus.Gauge
+}
+
+var (
+	maintenanceTasks     = make(map[*MaintenanceTask]struct{})
+	maintenanceTasksLock sync.Mutex
+)
+
+func NewMaintenanceTask(taskType string, volumeId uint32, collection string) *MaintenanceTask {
+	volume := strconv.FormatUint(uint64(volumeId), 10)
+	t := &MaintenanceTask{
+		Type:           taskType,
+		VolumeId:       volumeId,
+		Collection:     collection,
+		StartTime:      time.Now(),
+		processedGauge: VolumeServerMaintenanceProcessedBytesGauge.WithLabelValues(taskType, collection, volume),
+		totalGauge:     VolumeServerMaintenanceTotalBytesGauge.WithLabelValues(taskType, collection, volume),
+		etaGauge:       VolumeServerMaintenanceEtaGauge.WithLabelValues(taskType, collection, volume),
+	}
+	t.phase.Store("")
+
+	maintenanceTasksLock.Lock()
+	maintenanceTasks[t] = struct{}{}
+	maintenanceTasksLock.Unlock()
+
+	return t
+}
+
+// ListMaintenanceTasks returns the in-flight tasks, oldest first
+func ListMaintenanceTasks() (tasks []*MaintenanceTask) {
+	maintenanceTasksLock.Lock()
+	for t := range maintenanceTasks {
+		tasks = append(tasks, t)
+	}
+	maintenanceTasksLock.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].StartTime.Before(tasks[j].StartTime)
+	})
+	return
+}
+
+func (t *MaintenanceTask) SetPhase(phase string) {
+	if t == nil {
+		return
+	}
+	t.phase.Store(phase)
+}
+
+func (t *MaintenanceTask) Phase() string {
+	if t == nil {
+		return ""
+	}
+	return t.phase.Load().(string)
+}
+
+func (t *MaintenanceTask) SetTotalBytes(totalBytes int64) {
+	if t == nil {
+		return
+	}
+	atomic.StoreInt64(&t.totalBytes, totalBytes)
+	t.totalGauge.Set(float64(totalBytes))
+	t.updateEta()
+}
+
+func (t *MaintenanceTask) AddProcessedBytes(delta int64) {
+	if t == nil {
+		return
+	}
+	t.processedGauge.Set(float64(atomic.AddInt64(&t.processedBytes, delta)))
+	t.updateEta()
+}
+
+func (t *MaintenanceTask) SetProcessedBytes(processedBytes int64) {
+	if t == nil {
+		return
+	}
+	atomic.StoreInt64(&t.processedBytes, processedBytes)
+	t.processedGauge.Set(float64(processedBytes))
+	t.updateEta()
+}
+
+func (t *MaintenanceTask) ProcessedBytes() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&t.processedBytes)
+}
+
+func (t *MaintenanceTask) TotalBytes() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&t.totalBytes)
+}
+
+// Eta estimates the remaining time by the average speed so far.
+// It is 0 if not enough progress has been made to tell.
+func (t *MaintenanceTask) Eta() time.Duration {
+	processed, total := t.ProcessedBytes(), t.TotalBytes()
+	if t == nil || processed <= 0 || total <= processed {
+		return 0
+	}
+	elapsed := time.Since(t.StartTime)
+	return time.Duration(float64(elapsed) * float64(total-processed) / float64(processed))
+}
+
+func (t *MaintenanceTask) updateEta() {
+	t.etaGauge.Set(t.Eta().Seconds())
+}
+
+// Done removes the task from the in-flight list and its metrics
+func (t *MaintenanceTask) Done() {
+	if t == nil {
+		return
+	}
+
+	maintenanceTasksLock.Lock()
+	delete(maintenanceTasks, t)
+	maintenanceTasksLock.Unlock()
+
+	volume := strconv.FormatUint(uint64(t.VolumeId), 10)
+	VolumeServerMaintenanceProcessedBytesGauge.DeleteLabelValues(t.Type, t.Collection, volume)
+	VolumeServerMaintenanceTotalBytesGauge.DeleteLabelValues(t.Type, t.Collection, volume)
+	VolumeServerMaintenanceEtaGauge.DeleteLabelValues(t.Type, t.Collection, volume)
+}
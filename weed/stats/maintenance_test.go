@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceTaskProgress(t *testing.T) {
+
+	task := NewMaintenanceTask("vacuum", 7, "")
+	task.StartTime = time.Now().Add(-10 * time.Second)
+	task.SetPhase("compact")
+	task.SetTotalBytes(1000)
+	task.AddProcessedBytes(200)
+	task.AddProcessedBytes(50)
+
+	if task.ProcessedBytes() != 250 {
+		t.Errorf("processed bytes %d, expected 250", task.ProcessedBytes())
+	}
+	if eta := task.Eta(); eta < 29*time.Second || eta > 31*time.Second {
+		t.Errorf("eta %v, expected about 30s", eta)
+	}
+
+	tasks := ListMaintenanceTasks()
+	if len(tasks) != 1 || tasks[0] != task || tasks[0].Phase() != "compact" {
+		t.Errorf("unexpected tasks %+v", tasks)
+	}
+
+	task.Done()
+	if len(ListMaintenanceTasks()) != 0 {
+		t.Errorf("task is not removed after done")
+	}
+
+	var nilTask *MaintenanceTask
+	nilTask.AddProcessedBytes(1)
+	nilTask.Done()
+	if nilTask.Eta() != 0 {
+		t.Errorf("nil task should have no eta")
+	}
+}
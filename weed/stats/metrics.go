@@ -90,6 +90,30 @@ var (
 			Name:      "total_disk_size",
 			Help:      "Actual disk size used by volumes.",
 		}, []string{"collection", "type"})
+
+	VolumeServerMaintenanceProcessedBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "maintenance_processed_bytes",
+			Help:      "Bytes processed by in-flight vacuum, volume copy, and erasure coding tasks.",
+		}, []string{"type", "collection", "volume"})
+
+	VolumeServerMaintenanceTotalBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "maintenance_total_bytes",
+			Help:      "Bytes to process by in-flight vacuum, volume copy, and erasure coding tasks.",
+		}, []string{"type", "collection", "volume"})
+
+	VolumeServerMaintenanceEtaGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "SeaweedFS",
+			Subsystem: "volumeServer",
+			Name:      "maintenance_eta_seconds",
+			Help:      "Estimated seconds to finish in-flight vacuum, volume copy, and erasure coding tasks.",
+		}, []string{"type", "collection", "volume"})
 )
 
 func init() {
@@ -105,6 +129,9 @@ func init() {
 	VolumeServerGather.MustRegister(VolumeServerVolumeCounter)
 	VolumeServerGather.MustRegister(VolumeServerMaxVolumeCounter)
 	VolumeServerGather.MustRegister(VolumeServerDiskSizeGauge)
+	VolumeServerGather.MustRegister(VolumeServerMaintenanceProcessedBytesGauge)
+	VolumeServerGather.MustRegister(VolumeServerMaintenanceTotalBytesGauge)
+	VolumeServerGather.MustRegister(VolumeServerMaintenanceEtaGauge)
 
 }
 
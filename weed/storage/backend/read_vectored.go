@@ -0,0 +1,20 @@
+// +build !linux
+
+package backend
+
+import (
+	"os"
+)
+
+// ReadVectored fills the buffers in turn with the file data from the offset
+func ReadVectored(file *os.File, buffers [][]byte, offset int64) (total int, err error) {
+	for _, buf := range buffers {
+		n, err := file.ReadAt(buf, offset)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		offset += int64(n)
+	}
+	return total, nil
+}
@@ -0,0 +1,61 @@
+// +build linux
+
+package backend
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// at most IOV_MAX buffers for one preadv(2)
+const maxIovecs = 1024
+
+// ReadVectored fills the buffers in turn with the file data from the offset, by preadv(2)
+func ReadVectored(file *os.File, buffers [][]byte, offset int64) (total int, err error) {
+	rawConn, err := file.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	buffers = append([][]byte(nil), buffers...)
+	for len(buffers) > 0 {
+		iovs := buffers
+		if len(iovs) > maxIovecs {
+			iovs = iovs[:maxIovecs]
+		}
+		var n int
+		var readErr error
+		if err = rawConn.Read(func(fd uintptr) bool {
+			n, readErr = unix.Preadv(int(fd), iovs, offset)
+			return true
+		}); err != nil {
+			return total, err
+		}
+		if readErr == unix.EINTR {
+			continue
+		}
+		if readErr != nil {
+			return total, readErr
+		}
+		if n == 0 {
+			return total, io.ErrUnexpectedEOF
+		}
+		total += n
+		offset += int64(n)
+		buffers = skipBytes(buffers, n)
+	}
+	return total, nil
+}
+
+// skipBytes drops the first n bytes of the buffers
+func skipBytes(buffers [][]byte, n int) [][]byte {
+	for len(buffers) > 0 && n >= len(buffers[0]) {
+		n -= len(buffers[0])
+		buffers = buffers[1:]
+	}
+	if len(buffers) > 0 {
+		buffers[0] = buffers[0][n:]
+	}
+	return buffers
+}
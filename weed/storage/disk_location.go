@@ -57,7 +57,7 @@ func parseCollectionVolumeId(base string) (collection string, vid needle.VolumeI
 	return collection, vol, err
 }
 
-func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind NeedleMapType) bool {
+func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind NeedleMapType, lazyLoadIndex bool) bool {
 	name := fileInfo.Name()
 	if !fileInfo.IsDir() && strings.HasSuffix(name, ".idx") {
 		vid, collection, err := l.volumeIdFromPath(fileInfo)
@@ -75,7 +75,7 @@ func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind Ne
 			return true
 		}
 
-		v, e := NewVolume(l.Directory, collection, vid, needleMapKind, nil, nil, 0, 0)
+		v, e := newVolume(l.Directory, collection, vid, needleMapKind, nil, nil, 0, 0, lazyLoadIndex)
 		if e != nil {
 			glog.V(0).Infof("new volume %s error %s", name, e)
 			return false
@@ -91,42 +91,6 @@ func (l *DiskLocation) loadExistingVolume(fileInfo os.FileInfo, needleMapKind Ne
 	return false
 }
 
-func (l *DiskLocation) concurrentLoadingVolumes(needleMapKind NeedleMapType, concurrency int) {
-
-	task_queue := make(chan os.FileInfo, 10*concurrency)
-	go func() {
-		if dirs, err := ioutil.ReadDir(l.Directory); err == nil {
-			for _, dir := range dirs {
-				task_queue <- dir
-			}
-		}
-		close(task_queue)
-	}()
-
-	var wg sync.WaitGroup
-	for workerNum := 0; workerNum < concurrency; workerNum++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for dir := range task_queue {
-				_ = l.loadExistingVolume(dir, needleMapKind)
-			}
-		}()
-	}
-	wg.Wait()
-
-}
-
-func (l *DiskLocation) loadExistingVolumes(needleMapKind NeedleMapType) {
-
-	l.concurrentLoadingVolumes(needleMapKind, 10)
-	glog.V(0).Infof("Store started on dir: %s with %d volumes max %d", l.Directory, len(l.volumes), l.MaxVolumeCount)
-
-	l.loadAllEcShards()
-	glog.V(0).Infof("Store started on dir: %s with %d ec shards", l.Directory, len(l.ecVolumes))
-
-}
-
 func (l *DiskLocation) DeleteCollectionFromDiskLocation(collection string) (e error) {
 
 	l.volumesLock.Lock()
@@ -189,7 +153,7 @@ func (l *DiskLocation) deleteVolumeById(vid needle.VolumeId) (found bool, e erro
 
 func (l *DiskLocation) LoadVolume(vid needle.VolumeId, needleMapKind NeedleMapType) bool {
 	if fileInfo, found := l.LocateVolume(vid); found {
-		return l.loadExistingVolume(fileInfo, needleMapKind)
+		return l.loadExistingVolume(fileInfo, needleMapKind, false)
 	}
 	return false
 }
@@ -54,8 +54,9 @@ func WriteSortedFileFromIdx(baseFileName string, ext string) (e error) {
 }
 
 // WriteEcFiles generates .ec00 ~ .ec13 files
-func WriteEcFiles(baseFileName string) error {
-	return generateEcFiles(baseFileName, 256*1024, ErasureCodingLargeBlockSize, ErasureCodingSmallBlockSize)
+// progressFn, if not nil, is called with the total .dat file size and the bytes encoded so far
+func WriteEcFiles(baseFileName string, progressFn func(processed, total int64)) error {
+	return generateEcFiles(baseFileName, 256*1024, ErasureCodingLargeBlockSize, ErasureCodingSmallBlockSize, progressFn)
 }
 
 func RebuildEcFiles(baseFileName string) ([]uint32, error) {
@@ -66,7 +67,7 @@ func ToExt(ecIndex int) string {
 	return fmt.Sprintf(".ec%02d", ecIndex)
 }
 
-func generateEcFiles(baseFileName string, bufferSize int, largeBlockSize int64, smallBlockSize int64) error {
+func generateEcFiles(baseFileName string, bufferSize int, largeBlockSize int64, smallBlockSize int64, progressFn func(processed, total int64)) error {
 	file, err := os.OpenFile(baseFileName+".dat", os.O_RDONLY, 0)
 	if err != nil {
 		return fmt.Errorf("failed to open dat file: %v", err)
@@ -79,7 +80,7 @@ func generateEcFiles(baseFileName string, bufferSize int, largeBlockSize int64,
 	}
 
 	glog.V(0).Infof("encodeDatFile %s.dat size:%d", baseFileName, fi.Size())
-	err = encodeDatFile(fi.Size(), err, baseFileName, bufferSize, largeBlockSize, file, smallBlockSize)
+	err = encodeDatFile(fi.Size(), err, baseFileName, bufferSize, largeBlockSize, file, smallBlockSize, progressFn)
 	if err != nil {
 		return fmt.Errorf("encodeDatFile: %v", err)
 	}
@@ -117,7 +118,7 @@ func generateMissingEcFiles(baseFileName string, bufferSize int, largeBlockSize
 	return
 }
 
-func encodeData(file *os.File, enc reedsolomon.Encoder, startOffset, blockSize int64, buffers [][]byte, outputs []*os.File) error {
+func encodeData(file *os.File, enc reedsolomon.Encoder, startOffset, blockSize int64, buffers [][]byte, outputs []*os.File, progressFn func(processed int64)) error {
 
 	bufferSize := int64(len(buffers[0]))
 	batchCount := blockSize / bufferSize
@@ -130,6 +131,9 @@ func encodeData(file *os.File, enc reedsolomon.Encoder, startOffset, blockSize i
 		if err != nil {
 			return err
 		}
+		if progressFn != nil {
+			progressFn(bufferSize * DataShardsCount * (b + 1))
+		}
 	}
 
 	return nil
@@ -191,9 +195,20 @@ func encodeDataOneBatch(file *os.File, enc reedsolomon.Encoder, startOffset, blo
 	return nil
 }
 
-func encodeDatFile(remainingSize int64, err error, baseFileName string, bufferSize int, largeBlockSize int64, file *os.File, smallBlockSize int64) error {
+func encodeDatFile(remainingSize int64, err error, baseFileName string, bufferSize int, largeBlockSize int64, file *os.File, smallBlockSize int64, progressFn func(processed, total int64)) error {
 
 	var processedSize int64
+	totalSize := remainingSize
+	reportProgress := func(blockProcessed int64) {
+		if progressFn == nil {
+			return
+		}
+		processed := processedSize + blockProcessed
+		if processed > totalSize {
+			processed = totalSize
+		}
+		progressFn(processed, totalSize)
+	}
 
 	enc, err := reedsolomon.New(DataShardsCount, ParityShardsCount)
 	if err != nil {
@@ -212,7 +227,7 @@ func encodeDatFile(remainingSize int64, err error, baseFileName string, bufferSi
 	}
 
 	for remainingSize > largeBlockSize*DataShardsCount {
-		err = encodeData(file, enc, processedSize, largeBlockSize, buffers, outputs)
+		err = encodeData(file, enc, processedSize, largeBlockSize, buffers, outputs, reportProgress)
 		if err != nil {
 			return fmt.Errorf("failed to encode large chunk data: %v", err)
 		}
@@ -220,7 +235,7 @@ func encodeDatFile(remainingSize int64, err error, baseFileName string, bufferSi
 		processedSize += largeBlockSize * DataShardsCount
 	}
 	for remainingSize > 0 {
-		encodeData(file, enc, processedSize, smallBlockSize, buffers, outputs)
+		err = encodeData(file, enc, processedSize, smallBlockSize, buffers, outputs, reportProgress)
 		if err != nil {
 			return fmt.Errorf("failed to encode small chunk data: %v", err)
 		}
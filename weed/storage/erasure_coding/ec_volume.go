@@ -14,6 +14,7 @@ import (
 	"github.com/chrislusf/seaweedfs/weed/pb/volume_server_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/idx"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
 	"github.com/chrislusf/seaweedfs/weed/storage/types"
 )
 
@@ -35,10 +36,11 @@ type EcVolume struct {
 	Version                   needle.Version
 	ecjFile                   *os.File
 	ecjFileAccessLock         sync.Mutex
+	tombstones                *needle_map.Tombstones // the needles deleted in the .ecj file
 }
 
 func NewEcVolume(dir string, collection string, vid needle.VolumeId) (ev *EcVolume, err error) {
-	ev = &EcVolume{dir: dir, Collection: collection, VolumeId: vid}
+	ev = &EcVolume{dir: dir, Collection: collection, VolumeId: vid, tombstones: needle_map.NewTombstones()}
 
 	baseFileName := EcShardFileName(collection, dir, int(vid))
 
@@ -57,6 +59,9 @@ func NewEcVolume(dir string, collection string, vid needle.VolumeId) (ev *EcVolu
 	if ev.ecjFile, err = os.OpenFile(baseFileName+".ecj", os.O_RDWR|os.O_CREATE, 0644); err != nil {
 		return nil, fmt.Errorf("cannot open ec volume journal %s.ecj: %v", baseFileName, err)
 	}
+	if err = ev.loadTombstones(); err != nil {
+		return nil, fmt.Errorf("cannot read ec volume journal %s.ecj: %v", baseFileName, err)
+	}
 
 	// read volume info
 	ev.Version = needle.Version3
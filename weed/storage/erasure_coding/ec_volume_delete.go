@@ -45,9 +45,30 @@ func (ev *EcVolume) DeleteNeedleFromEcx(needleId types.NeedleId) (err error) {
 
 	ev.ecjFileAccessLock.Unlock()
 
+	ev.tombstones.Add(needleId)
+
 	return
 }
 
+// IsDeleted tells whether the needle is deleted in the .ecj file, without reading the .ecx file.
+// The needles deleted before the .ecx file is rebuilt are only marked in the .ecx file.
+func (ev *EcVolume) IsDeleted(needleId types.NeedleId) bool {
+	return ev.tombstones.Has(needleId)
+}
+
+func (ev *EcVolume) loadTombstones() error {
+	buf := make([]byte, types.NeedleIdSize)
+	for offset := int64(0); ; offset += types.NeedleIdSize {
+		if _, err := ev.ecjFile.ReadAt(buf, offset); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		ev.tombstones.Add(types.BytesToNeedleId(buf))
+	}
+}
+
 func RebuildEcxFile(baseFileName string) error {
 
 	if !util.FileExists(baseFileName + ".ecj") {
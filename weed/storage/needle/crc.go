@@ -2,12 +2,12 @@ package needle
 
 import (
 	"fmt"
-
-	"github.com/klauspost/crc32"
+	"hash/crc32"
 
 	"github.com/chrislusf/seaweedfs/weed/util"
 )
 
+// the standard library computes Castagnoli with the SSE4.2 or ARMv8 CRC instructions
 var table = crc32.MakeTable(crc32.Castagnoli)
 
 type CRC uint32
@@ -24,6 +24,12 @@ func (c CRC) Value() uint32 {
 	return uint32(c>>15|c<<17) + 0xa282ead8
 }
 
+// CRCFromValue is the reverse of Value()
+func CRCFromValue(v uint32) CRC {
+	x := v - 0xa282ead8
+	return CRC(x<<15 | x>>17)
+}
+
 func (n *Needle) Etag() string {
 	bits := make([]byte, 4)
 	util.Uint32toBytes(bits, uint32(n.Checksum))
@@ -0,0 +1,27 @@
+package needle
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCRCFromValue(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.Read(data)
+	crc := NewCRC(data)
+	if CRCFromValue(crc.Value()) != crc {
+		t.Errorf("crc %x from value %x is %x", crc, crc.Value(), CRCFromValue(crc.Value()))
+	}
+	if NewCRC(data[:100]).Update(data[100:]) != crc {
+		t.Errorf("updated crc differs")
+	}
+}
+
+func BenchmarkCRC(b *testing.B) {
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		NewCRC(data)
+	}
+}
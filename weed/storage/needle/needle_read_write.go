@@ -203,6 +203,48 @@ func (n *Needle) ReadData(r backend.BackendStorageFile, offset int64, size uint3
 	return n.ReadBytes(bytes, offset, size, version)
 }
 
+// ReadNeedleMeta hydrates the needle from the file except its data, and returns the offset of the data in the file.
+// The data can then be sent from the file directly, but the checksum is not verified.
+func (n *Needle) ReadNeedleMeta(r backend.BackendStorageFile, offset int64, size uint32, version Version) (dataOffset int64, err error) {
+	bytes := make([]byte, NeedleHeaderSize+4)
+	if _, err = r.ReadAt(bytes, offset); err != nil {
+		return 0, err
+	}
+	n.ParseNeedleHeader(bytes)
+	if n.Size != size {
+		return 0, fmt.Errorf("entry not found: offset %d found id %d size %d, expected size %d", offset, n.Id, n.Size, size)
+	}
+	dataOffset = offset + NeedleHeaderSize
+	n.DataSize = size
+	if version == Version2 || version == Version3 {
+		n.DataSize = util.BytesToUint32(bytes[NeedleHeaderSize:])
+		dataOffset += 4
+		if 4+int64(n.DataSize) > int64(size) {
+			return 0, fmt.Errorf("index out of range %d", 1)
+		}
+	}
+
+	// the fields after the data, the checksum, and the timestamp
+	nonDataSize := offset + NeedleHeaderSize + int64(size) - dataOffset - int64(n.DataSize)
+	tail := make([]byte, nonDataSize+NeedleChecksumSize)
+	if version == Version3 {
+		tail = make([]byte, nonDataSize+NeedleChecksumSize+TimestampSize)
+	}
+	if _, err = r.ReadAt(tail, dataOffset+int64(n.DataSize)); err != nil {
+		return 0, err
+	}
+	if version == Version2 || version == Version3 {
+		if err = n.readNeedleDataVersion2NonData(tail[:nonDataSize]); err != nil {
+			return 0, err
+		}
+	}
+	n.Checksum = CRCFromValue(util.BytesToUint32(tail[nonDataSize : nonDataSize+NeedleChecksumSize]))
+	if version == Version3 {
+		n.AppendAtNs = util.BytesToUint64(tail[nonDataSize+NeedleChecksumSize:])
+	}
+	return dataOffset, nil
+}
+
 func (n *Needle) ParseNeedleHeader(bytes []byte) {
 	n.Cookie = BytesToCookie(bytes[0:CookieSize])
 	n.Id = BytesToNeedleId(bytes[CookieSize : CookieSize+NeedleIdSize])
@@ -219,6 +261,14 @@ func (n *Needle) readNeedleDataVersion2(bytes []byte) (err error) {
 		}
 		n.Data = bytes[index : index+int(n.DataSize)]
 		index = index + int(n.DataSize)
+	}
+	return n.readNeedleDataVersion2NonData(bytes[index:])
+}
+
+// readNeedleDataVersion2NonData reads the fields after the data
+func (n *Needle) readNeedleDataVersion2NonData(bytes []byte) (err error) {
+	index, lenBytes := 0, len(bytes)
+	if index < lenBytes {
 		n.Flags = bytes[index]
 		index = index + 1
 	}
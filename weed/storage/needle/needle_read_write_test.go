@@ -63,3 +63,58 @@ func TestAppend(t *testing.T) {
 		t.Errorf("Fail to Append Needle.")
 	}
 }
+
+func TestReadNeedleMeta(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", ".dat")
+	if err != nil {
+		t.Fatalf("Fail TempFile. %v", err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+	datBackend := backend.NewDiskFile(tempFile)
+
+	for _, version := range []Version{Version2, Version3} {
+		n := &Needle{
+			Cookie:       types.Cookie(0x1234),
+			Id:           types.NeedleId(0x5678),
+			Data:         []byte("some data to send from the file"),
+			Name:         []byte("a.txt"),
+			Mime:         []byte("text/plain"),
+			Pairs:        []byte(`{"a":"b"}`),
+			LastModified: 1600000000,
+		}
+		n.NameSize, n.MimeSize, n.PairsSize = uint8(len(n.Name)), uint8(len(n.Mime)), uint16(len(n.Pairs))
+		n.SetHasName()
+		n.SetHasMime()
+		n.SetHasPairs()
+		n.SetHasLastModifiedDate()
+		n.AppendAtNs = 1600000000123456789
+		n.Checksum = NewCRC(n.Data)
+		offset, _, _, err := n.Append(datBackend, version)
+		size := n.Size
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+
+		read := new(Needle)
+		if err = read.ReadData(datBackend, int64(offset), size, version); err != nil {
+			t.Fatalf("read data: %v", err)
+		}
+		meta := new(Needle)
+		dataOffset, err := meta.ReadNeedleMeta(datBackend, int64(offset), size, version)
+		if err != nil {
+			t.Fatalf("read meta: %v", err)
+		}
+		data := make([]byte, meta.DataSize)
+		if _, err = tempFile.ReadAt(data, dataOffset); err != nil || string(data) != string(read.Data) {
+			t.Errorf("version %d: data at %d: %q %v", version, dataOffset, data, err)
+		}
+		meta.Data = read.Data
+		if meta.String() != read.String() || meta.Flags != read.Flags || meta.Checksum != read.Checksum ||
+			meta.LastModified != read.LastModified || string(meta.Pairs) != string(read.Pairs) || meta.AppendAtNs != read.AppendAtNs {
+			t.Errorf("version %d: meta %+v, expected %+v", version, meta, read)
+		}
+	}
+}
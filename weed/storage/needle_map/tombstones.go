@@ -0,0 +1,101 @@
+package needle_map
+
+import (
+	"sort"
+	"sync"
+
+	. "github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+// the recent ids are merged into the sorted ids when there are more than this, or 1/8 of the sorted ids
+const tombstonesToMerge = 1024
+
+// Tombstones is the set of deleted needle ids of one volume,
+// so the needle maps on disk can tell a needle is deleted without reading the disk.
+// Unlike a bloom filter, it has no false positives, and the ids can be removed if the needles are written again.
+// Each id takes 8 bytes in a sorted slice, and the recent ids are kept in a small map.
+type Tombstones struct {
+	sync.RWMutex
+	sorted []NeedleId
+	recent map[NeedleId]struct{}
+}
+
+func NewTombstones() *Tombstones {
+	return &Tombstones{
+		recent: make(map[NeedleId]struct{}),
+	}
+}
+
+func (t *Tombstones) Add(key NeedleId) {
+	t.Lock()
+	defer t.Unlock()
+	if t.findSorted(key) >= 0 {
+		return
+	}
+	t.recent[key] = struct{}{}
+	if len(t.recent) > tombstonesToMerge && len(t.recent) > len(t.sorted)/8 {
+		t.merge()
+	}
+}
+
+// Remove forgets the id, after the needle is written again
+func (t *Tombstones) Remove(key NeedleId) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.recent, key)
+	if i := t.findSorted(key); i >= 0 {
+		t.sorted = append(t.sorted[:i], t.sorted[i+1:]...)
+	}
+}
+
+func (t *Tombstones) Has(key NeedleId) bool {
+	t.RLock()
+	defer t.RUnlock()
+	if _, found := t.recent[key]; found {
+		return true
+	}
+	return t.findSorted(key) >= 0
+}
+
+func (t *Tombstones) Len() int {
+	t.RLock()
+	defer t.RUnlock()
+	return len(t.sorted) + len(t.recent)
+}
+
+func (t *Tombstones) findSorted(key NeedleId) int {
+	i := sort.Search(len(t.sorted), func(i int) bool {
+		return t.sorted[i] >= key
+	})
+	if i < len(t.sorted) && t.sorted[i] == key {
+		return i
+	}
+	return -1
+}
+
+func (t *Tombstones) merge() {
+	recent := make([]NeedleId, 0, len(t.recent))
+	for key := range t.recent {
+		recent = append(recent, key)
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i] < recent[j]
+	})
+
+	merged := make([]NeedleId, 0, len(t.sorted)+len(recent))
+	i, j := 0, 0
+	for i < len(t.sorted) && j < len(recent) {
+		if t.sorted[i] < recent[j] {
+			merged = append(merged, t.sorted[i])
+			i++
+		} else {
+			merged = append(merged, recent[j])
+			j++
+		}
+	}
+	merged = append(merged, t.sorted[i:]...)
+	merged = append(merged, recent[j:]...)
+
+	t.sorted = merged
+	t.recent = make(map[NeedleId]struct{})
+}
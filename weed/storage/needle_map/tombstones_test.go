@@ -0,0 +1,38 @@
+package needle_map
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+func TestTombstones(t *testing.T) {
+	tombstones := NewTombstones()
+	deleted := make(map[NeedleId]bool)
+
+	for i := 0; i < 20000; i++ {
+		key := NeedleId(rand.Int63n(30000))
+		if rand.Intn(4) == 0 {
+			tombstones.Remove(key)
+			delete(deleted, key)
+		} else {
+			tombstones.Add(key)
+			deleted[key] = true
+		}
+	}
+
+	for key := NeedleId(0); key < 30000; key++ {
+		if tombstones.Has(key) != deleted[key] {
+			t.Fatalf("key %d: has %v, expected %v", key, tombstones.Has(key), deleted[key])
+		}
+	}
+	if tombstones.Len() != len(deleted) {
+		t.Errorf("len %d, expected %d", tombstones.Len(), len(deleted))
+	}
+	for i := 1; i < len(tombstones.sorted); i++ {
+		if tombstones.sorted[i-1] >= tombstones.sorted[i] {
+			t.Fatalf("sorted ids out of order at %d: %d, %d", i, tombstones.sorted[i-1], tombstones.sorted[i])
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
+	. "github.com/chrislusf/seaweedfs/weed/storage/types"
+)
+
+var errLazyNeedleMapClosed = errors.New("needle map is closed before loading")
+
+// lazyNeedleMap loads the needle map on its first read or write,
+// so a volume server with many volumes can start serving before all the indexes are loaded.
+// The counters are zero until it is loaded.
+// The index file is owned by the loaded needle map, and closed here if the map is never loaded.
+type lazyNeedleMap struct {
+	sync.Mutex
+	indexFile     *os.File
+	indexFileName string
+	load          func() (NeedleMapper, error)
+	loaded        int32
+	nm            NeedleMapper
+	err           error
+}
+
+func newLazyNeedleMap(indexFile *os.File, load func() (NeedleMapper, error)) *lazyNeedleMap {
+	return &lazyNeedleMap{indexFile: indexFile, indexFileName: indexFile.Name(), load: load}
+}
+
+func (m *lazyNeedleMap) isLoaded() bool {
+	return atomic.LoadInt32(&m.loaded) == 1
+}
+
+func (m *lazyNeedleMap) get() (NeedleMapper, error) {
+	if m.isLoaded() {
+		return m.nm, m.err
+	}
+	m.Lock()
+	defer m.Unlock()
+	if !m.isLoaded() {
+		glog.V(1).Infof("loading index %s", m.indexFileName)
+		if m.nm, m.err = m.load(); m.err != nil {
+			glog.Errorf("load index %s: %v", m.indexFileName, m.err)
+			m.nm = nil
+		}
+		atomic.StoreInt32(&m.loaded, 1)
+	}
+	return m.nm, m.err
+}
+
+// loadedNeedleMap returns the needle map if it is loaded without errors, without loading it
+func (m *lazyNeedleMap) loadedNeedleMap() NeedleMapper {
+	if m.isLoaded() && m.err == nil {
+		return m.nm
+	}
+	return nil
+}
+
+func (m *lazyNeedleMap) Put(key NeedleId, offset Offset, size uint32) error {
+	nm, err := m.get()
+	if err != nil {
+		return err
+	}
+	return nm.Put(key, offset, size)
+}
+
+func (m *lazyNeedleMap) Get(key NeedleId) (element *needle_map.NeedleValue, ok bool) {
+	nm, err := m.get()
+	if err != nil {
+		return nil, false
+	}
+	return nm.Get(key)
+}
+
+func (m *lazyNeedleMap) Delete(key NeedleId, offset Offset) error {
+	nm, err := m.get()
+	if err != nil {
+		return err
+	}
+	return nm.Delete(key, offset)
+}
+
+func (m *lazyNeedleMap) Close() {
+	m.Lock()
+	defer m.Unlock()
+	if !m.isLoaded() {
+		m.closeUnloaded()
+		return
+	}
+	if m.nm != nil {
+		m.nm.Close()
+	}
+}
+
+// closeUnloaded closes the index file without loading it, and fails the later reads and writes
+func (m *lazyNeedleMap) closeUnloaded() {
+	if err := m.indexFile.Close(); err != nil {
+		glog.V(0).Infof("close index %s: %v", m.indexFileName, err)
+	}
+	m.err = errLazyNeedleMapClosed
+	atomic.StoreInt32(&m.loaded, 1)
+}
+
+func (m *lazyNeedleMap) Destroy() error {
+	m.Lock()
+	if !m.isLoaded() {
+		m.closeUnloaded()
+	}
+	nm, err := m.nm, m.err
+	m.Unlock()
+	if err != nil {
+		if err == errLazyNeedleMapClosed {
+			return os.Remove(m.indexFileName)
+		}
+		return err
+	}
+	return nm.Destroy()
+}
+
+func (m *lazyNeedleMap) ContentSize() uint64 {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.ContentSize()
+	}
+	return 0
+}
+
+func (m *lazyNeedleMap) DeletedSize() uint64 {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.DeletedSize()
+	}
+	return 0
+}
+
+func (m *lazyNeedleMap) FileCount() int {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.FileCount()
+	}
+	return 0
+}
+
+func (m *lazyNeedleMap) DeletedCount() int {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.DeletedCount()
+	}
+	return 0
+}
+
+func (m *lazyNeedleMap) MaxFileKey() NeedleId {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.MaxFileKey()
+	}
+	return 0
+}
+
+func (m *lazyNeedleMap) IndexFileSize() uint64 {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.IndexFileSize()
+	}
+	if stat, err := os.Stat(m.indexFileName); err == nil {
+		return uint64(stat.Size())
+	}
+	return 0
+}
+
+func (m *lazyNeedleMap) Sync() error {
+	if nm := m.loadedNeedleMap(); nm != nil {
+		return nm.Sync()
+	}
+	return nil
+}
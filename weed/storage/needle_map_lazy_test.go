@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
+)
+
+func TestLazyLoadIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	v, err := NewVolume(dir, "", 1, NeedleMapInMemory, &super_block.ReplicaPlacement{}, &needle.TTL{}, 0, 0)
+	if err != nil {
+		t.Fatalf("volume creation: %v", err)
+	}
+	fileCount := 100
+	infos := make([]*needleInfo, fileCount+1)
+	for i := 1; i <= fileCount; i++ {
+		doSomeWritesDeletes(i, v, t, infos)
+	}
+	expectedFileCount, expectedMaxFileKey := v.FileCount(), v.MaxFileKey()
+	v.Close()
+
+	v, err = newVolume(dir, "", 1, NeedleMapInMemory, nil, nil, 0, 0, true)
+	if err != nil {
+		t.Fatalf("volume reloading: %v", err)
+	}
+	defer v.Close()
+	v.location = &DiskLocation{}
+	if v.isIndexLoaded() || v.FileCount() != 0 {
+		t.Fatalf("index loaded before access")
+	}
+	if !v.ToVolumeInformationMessage().ReadOnly {
+		t.Errorf("volume with unloaded index should be reported readonly")
+	}
+
+	for i := 1; i <= fileCount; i++ {
+		n := newEmptyNeedle(uint64(i))
+		size, err := v.readNeedle(n)
+		if infos[i-1].size == 0 {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("read file %d: %v", i, err)
+		}
+		if infos[i-1].size != uint32(size) {
+			t.Fatalf("read file %d size mismatch expected %d found %d", i, infos[i-1].size, size)
+		}
+	}
+
+	if !v.isIndexLoaded() {
+		t.Fatalf("index not loaded after access")
+	}
+	if v.FileCount() != expectedFileCount || v.MaxFileKey() != expectedMaxFileKey {
+		t.Errorf("file count %d max key %d, expected %d and %d", v.FileCount(), v.MaxFileKey(), expectedFileCount, expectedMaxFileKey)
+	}
+	if v.ToVolumeInformationMessage().ReadOnly {
+		t.Errorf("volume with loaded index should be writable")
+	}
+}
+
+func TestLazyNeedleMapClosedBeforeLoading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		t.Fatalf("temp dir creation: %v", err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	for _, destroy := range []bool{false, true} {
+		indexFile, err := os.OpenFile(filepath.Join(dir, "1.idx"), os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatalf("open index: %v", err)
+		}
+		loads := 0
+		m := newLazyNeedleMap(indexFile, func() (NeedleMapper, error) {
+			loads++
+			return nil, fmt.Errorf("should not load")
+		})
+		if destroy {
+			err = m.Destroy()
+		} else {
+			m.Close()
+		}
+		if _, statErr := indexFile.Stat(); statErr == nil || loads != 0 {
+			t.Errorf("destroy %v: index file is not closed, or loaded %d times", destroy, loads)
+		}
+		if _, statErr := os.Stat(indexFile.Name()); destroy != os.IsNotExist(statErr) || err != nil {
+			t.Errorf("destroy %v: stat index %v, destroy error %v", destroy, statErr, err)
+		}
+		if _, found := m.Get(1); found {
+			t.Errorf("destroy %v: read from a closed needle map", destroy)
+		}
+	}
+}
@@ -22,10 +22,11 @@ type LevelDbNeedleMap struct {
 	baseNeedleMapper
 	dbFileName string
 	db         *leveldb.DB
+	tombstones *needle_map.Tombstones // the deleted needles are not looked up in leveldb
 }
 
 func NewLevelDbNeedleMap(dbFileName string, indexFile *os.File, opts *opt.Options) (m *LevelDbNeedleMap, err error) {
-	m = &LevelDbNeedleMap{dbFileName: dbFileName}
+	m = &LevelDbNeedleMap{dbFileName: dbFileName, tombstones: needle_map.NewTombstones()}
 	m.indexFile = indexFile
 	if !isLevelDbFresh(dbFileName, indexFile) {
 		glog.V(1).Infof("Start to Generate %s from %s", dbFileName, indexFile.Name())
@@ -43,7 +44,7 @@ func NewLevelDbNeedleMap(dbFileName string, indexFile *os.File, opts *opt.Option
 		}
 	}
 	glog.V(1).Infof("Loading %s...", indexFile.Name())
-	mm, indexLoadError := newNeedleMapMetricFromIndexFile(indexFile)
+	mm, indexLoadError := newNeedleMapMetricFromIndexFile(indexFile, m.tombstones)
 	if indexLoadError != nil {
 		return nil, indexLoadError
 	}
@@ -85,6 +86,9 @@ func generateLevelDbFile(dbFileName string, indexFile *os.File) error {
 }
 
 func (m *LevelDbNeedleMap) Get(key NeedleId) (element *needle_map.NeedleValue, ok bool) {
+	if m.tombstones.Has(key) {
+		return nil, false
+	}
 	bytes := make([]byte, NeedleIdSize)
 	NeedleIdToBytes(bytes[0:NeedleIdSize], key)
 	data, err := m.db.Get(bytes, nil)
@@ -106,6 +110,7 @@ func (m *LevelDbNeedleMap) Put(key NeedleId, offset Offset, size uint32) error {
 	if err := m.appendToIndexFile(key, offset, size); err != nil {
 		return fmt.Errorf("cannot write to indexfile %s: %v", m.indexFile.Name(), err)
 	}
+	m.tombstones.Remove(key)
 	return levelDbWrite(m.db, key, offset, size)
 }
 
@@ -132,6 +137,7 @@ func (m *LevelDbNeedleMap) Delete(key NeedleId, offset Offset) error {
 	if err := m.appendToIndexFile(key, offset, TombstoneFileSize); err != nil {
 		return err
 	}
+	m.tombstones.Add(key)
 	return levelDbDelete(m.db, key)
 }
 
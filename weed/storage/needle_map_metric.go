@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 
 	"github.com/chrislusf/seaweedfs/weed/storage/idx"
+	"github.com/chrislusf/seaweedfs/weed/storage/needle_map"
 	. "github.com/chrislusf/seaweedfs/weed/storage/types"
 	"github.com/willf/bloom"
 )
@@ -91,7 +92,8 @@ func (mm *mapMetric) MaybeSetMaxFileKey(key NeedleId) {
 	}
 }
 
-func newNeedleMapMetricFromIndexFile(r *os.File) (mm *mapMetric, err error) {
+// newNeedleMapMetricFromIndexFile counts the files in the index file, and adds the deleted ones to the tombstones if not nil
+func newNeedleMapMetricFromIndexFile(r *os.File, tombstones *needle_map.Tombstones) (mm *mapMetric, err error) {
 	mm = &mapMetric{}
 	var bf *bloom.BloomFilter
 	buf := make([]byte, NeedleIdSize)
@@ -108,6 +110,10 @@ func newNeedleMapMetricFromIndexFile(r *os.File) (mm *mapMetric, err error) {
 		if !bf.Test(buf) {
 			mm.FileCounter++
 			bf.Add(buf)
+			// the last entry of the needle is a deletion
+			if tombstones != nil && size == TombstoneFileSize {
+				tombstones.Add(key)
+			}
 		} else {
 			// deleted file
 			mm.DeletionCounter++
@@ -14,10 +14,11 @@ type SortedFileNeedleMap struct {
 	baseFileName string
 	dbFile       *os.File
 	dbFileSize   int64
+	tombstones   *needle_map.Tombstones // the deleted needles are not searched in the .sdx file
 }
 
 func NewSortedFileNeedleMap(baseFileName string, indexFile *os.File) (m *SortedFileNeedleMap, err error) {
-	m = &SortedFileNeedleMap{baseFileName: baseFileName}
+	m = &SortedFileNeedleMap{baseFileName: baseFileName, tombstones: needle_map.NewTombstones()}
 	m.indexFile = indexFile
 	fileName := baseFileName + ".sdx"
 	if !isSortedFileFresh(fileName, indexFile) {
@@ -33,7 +34,7 @@ func NewSortedFileNeedleMap(baseFileName string, indexFile *os.File) (m *SortedF
 	dbStat, _ := m.dbFile.Stat()
 	m.dbFileSize = dbStat.Size()
 	glog.V(1).Infof("Loading %s...", indexFile.Name())
-	mm, indexLoadError := newNeedleMapMetricFromIndexFile(indexFile)
+	mm, indexLoadError := newNeedleMapMetricFromIndexFile(indexFile, m.tombstones)
 	if indexLoadError != nil {
 		return nil, indexLoadError
 	}
@@ -59,6 +60,9 @@ func isSortedFileFresh(dbFileName string, indexFile *os.File) bool {
 }
 
 func (m *SortedFileNeedleMap) Get(key NeedleId) (element *needle_map.NeedleValue, ok bool) {
+	if m.tombstones.Has(key) {
+		return nil, false
+	}
 	offset, size, err := erasure_coding.SearchNeedleFromSortedIndex(m.dbFile, m.dbFileSize, key, nil)
 	ok = err == nil
 	return &needle_map.NeedleValue{Key: key, Offset: offset, Size: size}, ok
@@ -71,6 +75,10 @@ func (m *SortedFileNeedleMap) Put(key NeedleId, offset Offset, size uint32) erro
 
 func (m *SortedFileNeedleMap) Delete(key NeedleId, offset Offset) error {
 
+	if m.tombstones.Has(key) {
+		return nil
+	}
+
 	_, size, err := erasure_coding.SearchNeedleFromSortedIndex(m.dbFile, m.dbFileSize, key, nil)
 
 	if err != nil {
@@ -89,6 +97,9 @@ func (m *SortedFileNeedleMap) Delete(key NeedleId, offset Offset) error {
 		return err
 	}
 	_, _, err = erasure_coding.SearchNeedleFromSortedIndex(m.dbFile, m.dbFileSize, key, erasure_coding.MarkNeedleDeleted)
+	if err == nil {
+		m.tombstones.Add(key)
+	}
 
 	return err
 }
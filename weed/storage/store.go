@@ -2,9 +2,13 @@ package storage
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
 
@@ -49,15 +53,20 @@ func (s *Store) String() (str string) {
 	return
 }
 
-func NewStore(grpcDialOption grpc.DialOption, port int, ip, publicUrl string, dirnames []string, maxVolumeCounts []int, minFreeSpacePercents []float32, needleMapKind NeedleMapType) (s *Store) {
+// NewStore loads the existing volumes with loadConcurrency workers, or 10 workers per directory if it is 0.
+// With lazyLoadIndex, the volume indexes are loaded on first access or in the background.
+func NewStore(grpcDialOption grpc.DialOption, port int, ip, publicUrl string, dirnames []string, maxVolumeCounts []int, minFreeSpacePercents []float32, needleMapKind NeedleMapType, loadConcurrency int, lazyLoadIndex bool) (s *Store) {
 	s = &Store{grpcDialOption: grpcDialOption, Port: port, Ip: ip, PublicUrl: publicUrl, NeedleMapType: needleMapKind}
 	s.Locations = make([]*DiskLocation, 0)
 	for i := 0; i < len(dirnames); i++ {
 		location := NewDiskLocation(util.ResolvePath(dirnames[i]), maxVolumeCounts[i], minFreeSpacePercents[i])
-		location.loadExistingVolumes(needleMapKind)
 		s.Locations = append(s.Locations, location)
 		stats.VolumeServerMaxVolumeCounter.Add(float64(maxVolumeCounts[i]))
 	}
+	if loadConcurrency <= 0 {
+		loadConcurrency = 10 * len(s.Locations)
+	}
+	s.loadExistingVolumes(needleMapKind, loadConcurrency, lazyLoadIndex)
 	s.NewVolumesChan = make(chan master_pb.VolumeShortInformationMessage, 3)
 	s.DeletedVolumesChan = make(chan master_pb.VolumeShortInformationMessage, 3)
 
@@ -66,6 +75,100 @@ func NewStore(grpcDialOption grpc.DialOption, port int, ip, publicUrl string, di
 
 	return
 }
+
+type volumeLoadingTask struct {
+	location *DiskLocation
+	fileInfo os.FileInfo
+}
+
+// loadExistingVolumes loads the volumes of all directories with one worker pool,
+// interleaving the directories so all disks are busy.
+func (s *Store) loadExistingVolumes(needleMapKind NeedleMapType, concurrency int, lazyLoadIndex bool) {
+	var fileInfosList [][]os.FileInfo
+	for _, location := range s.Locations {
+		fileInfos, err := ioutil.ReadDir(location.Directory)
+		if err != nil {
+			glog.Warningf("read dir %s: %v", location.Directory, err)
+		}
+		fileInfosList = append(fileInfosList, fileInfos)
+	}
+
+	taskQueue := make(chan volumeLoadingTask, 10*concurrency)
+	go func() {
+		for i, found := 0, true; found; i++ {
+			found = false
+			for j, fileInfos := range fileInfosList {
+				if i < len(fileInfos) {
+					found = true
+					taskQueue <- volumeLoadingTask{location: s.Locations[j], fileInfo: fileInfos[i]}
+				}
+			}
+		}
+		close(taskQueue)
+	}()
+
+	var wg sync.WaitGroup
+	for workerNum := 0; workerNum < concurrency; workerNum++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range taskQueue {
+				_ = task.location.loadExistingVolume(task.fileInfo, needleMapKind, lazyLoadIndex)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, location := range s.Locations {
+		wg.Add(1)
+		go func(location *DiskLocation) {
+			defer wg.Done()
+			glog.V(0).Infof("Store started on dir: %s with %d volumes max %d", location.Directory, location.VolumesLen(), location.MaxVolumeCount)
+			location.loadAllEcShards()
+			glog.V(0).Infof("Store started on dir: %s with %d ec shards", location.Directory, location.EcVolumesLen())
+		}(location)
+	}
+	wg.Wait()
+
+	if lazyLoadIndex {
+		go s.loadLazyIndexes(concurrency)
+	}
+}
+
+// loadLazyIndexes loads the indexes not accessed yet in the background,
+// the volumes become writable on the master with the next heartbeat.
+func (s *Store) loadLazyIndexes(concurrency int) {
+	start := time.Now()
+	volumeQueue := make(chan *Volume, concurrency)
+	go func() {
+		for _, location := range s.Locations {
+			location.volumesLock.RLock()
+			volumes := make([]*Volume, 0, len(location.volumes))
+			for _, v := range location.volumes {
+				volumes = append(volumes, v)
+			}
+			location.volumesLock.RUnlock()
+			for _, v := range volumes {
+				volumeQueue <- v
+			}
+		}
+		close(volumeQueue)
+	}()
+
+	var wg sync.WaitGroup
+	for workerNum := 0; workerNum < concurrency; workerNum++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range volumeQueue {
+				v.loadLazyIndex()
+			}
+		}()
+	}
+	wg.Wait()
+	glog.V(0).Infof("loaded volume indexes in %v", time.Since(start))
+}
+
 func (s *Store) AddVolume(volumeId needle.VolumeId, collection string, needleMapKind NeedleMapType, replicaPlacement string, ttlString string, preallocate int64, MemoryMapMaxSizeMb uint32) error {
 	rt, e := super_block.NewReplicaPlacementFromString(replicaPlacement)
 	if e != nil {
@@ -289,6 +392,15 @@ func (s *Store) ReadVolumeNeedle(i needle.VolumeId, n *needle.Needle) (int, erro
 	}
 	return 0, fmt.Errorf("volume %d not found", i)
 }
+
+// OpenVolumeNeedleData reads the needle except its data, and opens the .dat file to read the data at dataOffset.
+// The file is nil if the needle should be read by ReadVolumeNeedle.
+func (s *Store) OpenVolumeNeedleData(i needle.VolumeId, n *needle.Needle, minSize uint32) (dataFile *os.File, dataOffset int64, err error) {
+	if v := s.findVolume(i); v != nil {
+		return v.openNeedleData(n, minSize)
+	}
+	return nil, 0, fmt.Errorf("volume %d not found", i)
+}
 func (s *Store) GetVolume(i needle.VolumeId) *Volume {
 	return s.findVolume(i)
 }
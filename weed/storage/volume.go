@@ -42,17 +42,25 @@ type Volume struct {
 
 	isCompacting bool
 
+	lazyLoadIndex bool // only when loading the existing volumes at startup
+
 	volumeInfo *volume_server_pb.VolumeInfo
 	location   *DiskLocation
 }
 
 func NewVolume(dirname string, collection string, id needle.VolumeId, needleMapKind NeedleMapType, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, preallocate int64, memoryMapMaxSizeMb uint32) (v *Volume, e error) {
+	return newVolume(dirname, collection, id, needleMapKind, replicaPlacement, ttl, preallocate, memoryMapMaxSizeMb, false)
+}
+
+func newVolume(dirname string, collection string, id needle.VolumeId, needleMapKind NeedleMapType, replicaPlacement *super_block.ReplicaPlacement, ttl *needle.TTL, preallocate int64, memoryMapMaxSizeMb uint32, lazyLoadIndex bool) (v *Volume, e error) {
 	// if replicaPlacement is nil, the superblock will be loaded from disk
 	v = &Volume{dir: dirname, Collection: collection, Id: id, MemoryMapMaxSizeMb: memoryMapMaxSizeMb,
 		asyncRequestsChan: make(chan *needle.AsyncRequest, 128)}
 	v.SuperBlock = super_block.SuperBlock{ReplicaPlacement: replicaPlacement, Ttl: ttl}
 	v.needleMapKind = needleMapKind
+	v.lazyLoadIndex = lazyLoadIndex
 	e = v.load(true, true, needleMapKind, preallocate)
+	v.lazyLoadIndex = false
 	v.startWorker()
 	return
 }
@@ -221,7 +229,7 @@ func (v *Volume) ToVolumeInformationMessage() *master_pb.VolumeInformationMessag
 		FileCount:        v.FileCount(),
 		DeleteCount:      v.DeletedCount(),
 		DeletedByteCount: v.DeletedSize(),
-		ReadOnly:         v.IsReadOnly(),
+		ReadOnly:         v.IsReadOnly() || !v.isIndexLoaded(),
 		ReplicaPlacement: uint32(v.ReplicaPlacement.Byte()),
 		Version:          uint32(v.Version()),
 		Ttl:              v.Ttl.ToUint32(),
@@ -244,6 +252,23 @@ func (v *Volume) RemoteStorageNameKey() (storageName, storageKey string) {
 	return v.volumeInfo.GetFiles()[0].BackendName(), v.volumeInfo.GetFiles()[0].GetKey()
 }
 
+// isIndexLoaded is false until the lazily loaded index is accessed, the master sees the volume as readonly till then
+func (v *Volume) isIndexLoaded() bool {
+	if m, ok := v.nm.(*lazyNeedleMap); ok {
+		return m.loadedNeedleMap() != nil
+	}
+	return true
+}
+
+// loadLazyIndex loads the index if it is loaded lazily and not accessed yet
+func (v *Volume) loadLazyIndex() {
+	v.dataFileAccessLock.RLock()
+	defer v.dataFileAccessLock.RUnlock()
+	if m, ok := v.nm.(*lazyNeedleMap); ok {
+		m.get()
+	}
+}
+
 func (v *Volume) IsReadOnly() bool {
 	return v.noWriteOrDelete || v.noWriteCanDelete || v.location.isDiskSpaceLow
 }
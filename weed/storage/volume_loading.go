@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
@@ -94,48 +95,13 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 			glog.V(0).Infof("volumeDataIntegrityChecking failed %v", err)
 		}
 
-		if v.noWriteOrDelete || v.noWriteCanDelete {
-			if v.nm, err = NewSortedFileNeedleMap(fileName, indexFile); err != nil {
-				glog.V(0).Infof("loading sorted db %s error: %v", fileName+".sdx", err)
-			}
+		isReadOnly := v.noWriteOrDelete || v.noWriteCanDelete
+		if v.lazyLoadIndex {
+			v.nm = newLazyNeedleMap(indexFile, func() (NeedleMapper, error) {
+				return v.loadNeedleMap(indexFile, isReadOnly, needleMapKind)
+			})
 		} else {
-			switch needleMapKind {
-			case NeedleMapInMemory:
-				glog.V(0).Infoln("loading index", fileName+".idx", "to memory")
-				if v.nm, err = LoadCompactNeedleMap(indexFile); err != nil {
-					glog.V(0).Infof("loading index %s to memory error: %v", fileName+".idx", err)
-				}
-			case NeedleMapLevelDb:
-				glog.V(0).Infoln("loading leveldb", fileName+".ldb")
-				opts := &opt.Options{
-					BlockCacheCapacity:            2 * 1024 * 1024, // default value is 8MiB
-					WriteBuffer:                   1 * 1024 * 1024, // default value is 4MiB
-					CompactionTableSizeMultiplier: 10,              // default value is 1
-				}
-				if v.nm, err = NewLevelDbNeedleMap(fileName+".ldb", indexFile, opts); err != nil {
-					glog.V(0).Infof("loading leveldb %s error: %v", fileName+".ldb", err)
-				}
-			case NeedleMapLevelDbMedium:
-				glog.V(0).Infoln("loading leveldb medium", fileName+".ldb")
-				opts := &opt.Options{
-					BlockCacheCapacity:            4 * 1024 * 1024, // default value is 8MiB
-					WriteBuffer:                   2 * 1024 * 1024, // default value is 4MiB
-					CompactionTableSizeMultiplier: 10,              // default value is 1
-				}
-				if v.nm, err = NewLevelDbNeedleMap(fileName+".ldb", indexFile, opts); err != nil {
-					glog.V(0).Infof("loading leveldb %s error: %v", fileName+".ldb", err)
-				}
-			case NeedleMapLevelDbLarge:
-				glog.V(0).Infoln("loading leveldb large", fileName+".ldb")
-				opts := &opt.Options{
-					BlockCacheCapacity:            8 * 1024 * 1024, // default value is 8MiB
-					WriteBuffer:                   4 * 1024 * 1024, // default value is 4MiB
-					CompactionTableSizeMultiplier: 10,              // default value is 1
-				}
-				if v.nm, err = NewLevelDbNeedleMap(fileName+".ldb", indexFile, opts); err != nil {
-					glog.V(0).Infof("loading leveldb %s error: %v", fileName+".ldb", err)
-				}
-			}
+			v.nm, err = v.loadNeedleMap(indexFile, isReadOnly, needleMapKind)
 		}
 	}
 
@@ -148,3 +114,54 @@ func (v *Volume) load(alsoLoadIndex bool, createDatIfMissing bool, needleMapKind
 
 	return err
 }
+
+func (v *Volume) loadNeedleMap(indexFile *os.File, isReadOnly bool, needleMapKind NeedleMapType) (nm NeedleMapper, err error) {
+	fileName := v.FileName()
+	if isReadOnly {
+		if nm, err = NewSortedFileNeedleMap(fileName, indexFile); err != nil {
+			glog.V(0).Infof("loading sorted db %s error: %v", fileName+".sdx", err)
+		}
+		return
+	}
+	switch needleMapKind {
+	case NeedleMapInMemory:
+		glog.V(0).Infoln("loading index", fileName+".idx", "to memory")
+		if nm, err = LoadCompactNeedleMap(indexFile); err != nil {
+			glog.V(0).Infof("loading index %s to memory error: %v", fileName+".idx", err)
+		}
+	case NeedleMapLevelDb:
+		glog.V(0).Infoln("loading leveldb", fileName+".ldb")
+		opts := &opt.Options{
+			BlockCacheCapacity:            2 * 1024 * 1024,           // default value is 8MiB
+			WriteBuffer:                   1 * 1024 * 1024,           // default value is 4MiB
+			CompactionTableSizeMultiplier: 10,                        // default value is 1
+			Filter:                        filter.NewBloomFilter(10), // skip the tables without the key
+		}
+		if nm, err = NewLevelDbNeedleMap(fileName+".ldb", indexFile, opts); err != nil {
+			glog.V(0).Infof("loading leveldb %s error: %v", fileName+".ldb", err)
+		}
+	case NeedleMapLevelDbMedium:
+		glog.V(0).Infoln("loading leveldb medium", fileName+".ldb")
+		opts := &opt.Options{
+			BlockCacheCapacity:            4 * 1024 * 1024,           // default value is 8MiB
+			WriteBuffer:                   2 * 1024 * 1024,           // default value is 4MiB
+			CompactionTableSizeMultiplier: 10,                        // default value is 1
+			Filter:                        filter.NewBloomFilter(10), // skip the tables without the key
+		}
+		if nm, err = NewLevelDbNeedleMap(fileName+".ldb", indexFile, opts); err != nil {
+			glog.V(0).Infof("loading leveldb %s error: %v", fileName+".ldb", err)
+		}
+	case NeedleMapLevelDbLarge:
+		glog.V(0).Infoln("loading leveldb large", fileName+".ldb")
+		opts := &opt.Options{
+			BlockCacheCapacity:            8 * 1024 * 1024,           // default value is 8MiB
+			WriteBuffer:                   4 * 1024 * 1024,           // default value is 4MiB
+			CompactionTableSizeMultiplier: 10,                        // default value is 1
+			Filter:                        filter.NewBloomFilter(10), // skip the tables without the key
+		}
+		if nm, err = NewLevelDbNeedleMap(fileName+".ldb", indexFile, opts); err != nil {
+			glog.V(0).Infof("loading leveldb %s error: %v", fileName+".ldb", err)
+		}
+	}
+	return
+}
@@ -16,6 +16,7 @@ import (
 )
 
 var ErrorNotFound = errors.New("not found")
+var ErrorDeleted = errors.New("already deleted")
 
 // isFileUnchanged checks whether this needle to write is same as last one.
 // It requires serialized access in the same volume.
@@ -261,7 +262,7 @@ func (v *Volume) readNeedle(n *needle.Needle) (int, error) {
 		return -1, ErrorNotFound
 	}
 	if nv.Size == TombstoneFileSize {
-		return -1, errors.New("already deleted")
+		return -1, ErrorDeleted
 	}
 	if nv.Size == 0 {
 		return 0, nil
@@ -270,21 +271,56 @@ func (v *Volume) readNeedle(n *needle.Needle) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	bytesRead := len(n.Data)
+	if isExpiredNeedle(n) {
+		return -1, ErrorNotFound
+	}
+	return len(n.Data), nil
+}
+
+func isExpiredNeedle(n *needle.Needle) bool {
 	if !n.HasTtl() {
-		return bytesRead, nil
+		return false
 	}
 	ttlMinutes := n.Ttl.Minutes()
 	if ttlMinutes == 0 {
-		return bytesRead, nil
+		return false
 	}
 	if !n.HasLastModifiedDate() {
-		return bytesRead, nil
+		return false
+	}
+	return uint64(time.Now().Unix()) >= n.LastModified+uint64(ttlMinutes*60)
+}
+
+// openNeedleData reads the needle except its data, and opens the .dat file to read the data at dataOffset.
+// The data can be sent from the file without copying, e.g. by sendfile(2), but its checksum is not verified.
+// The file has its own file offset, and is still readable if the volume is compacted meanwhile.
+// For needles smaller than minSize, or a volume not on the local disk, the returned file is nil.
+func (v *Volume) openNeedleData(n *needle.Needle, minSize uint32) (dataFile *os.File, dataOffset int64, err error) {
+	v.dataFileAccessLock.RLock()
+	defer v.dataFileAccessLock.RUnlock()
+
+	diskFile, isDiskFile := v.DataBackend.(*backend.DiskFile)
+	nv, ok := v.nm.Get(n.Id)
+	if !ok || nv.Offset.IsZero() {
+		return nil, 0, ErrorNotFound
+	}
+	if nv.Size == TombstoneFileSize {
+		return nil, 0, ErrorDeleted
+	}
+	if nv.Size < minSize || !isDiskFile {
+		return nil, 0, nil
+	}
+	dataOffset, err = n.ReadNeedleMeta(v.DataBackend, nv.Offset.ToAcutalOffset(), nv.Size, v.Version())
+	if err != nil {
+		return nil, 0, err
+	}
+	if isExpiredNeedle(n) {
+		return nil, 0, ErrorNotFound
 	}
-	if uint64(time.Now().Unix()) < n.LastModified+uint64(ttlMinutes*60) {
-		return bytesRead, nil
+	if dataFile, err = os.Open(diskFile.Name()); err != nil {
+		return nil, 0, err
 	}
-	return -1, ErrorNotFound
+	return dataFile, dataOffset, nil
 }
 
 func (v *Volume) startWorker() {
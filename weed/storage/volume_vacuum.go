@@ -59,7 +59,12 @@ func (v *Volume) Compact(preallocate int64, compactionBytePerSecond int64) error
 	if err := v.nm.Sync(); err != nil {
 		glog.V(0).Infof("compact fail to sync volume idx %d", v.Id)
 	}
-	return v.copyDataAndGenerateIndexFile(filePath+".cpd", filePath+".cpx", preallocate, compactionBytePerSecond)
+
+	progress := stats.NewMaintenanceTask("vacuum", uint32(v.Id), v.Collection)
+	defer progress.Done()
+	progress.SetPhase("compact")
+
+	return v.copyDataAndGenerateIndexFile(filePath+".cpd", filePath+".cpx", preallocate, compactionBytePerSecond, progress)
 }
 
 // compact a volume based on deletions in .idx files
@@ -85,7 +90,12 @@ func (v *Volume) Compact2(preallocate int64, compactionBytePerSecond int64) erro
 	if err := v.nm.Sync(); err != nil {
 		glog.V(0).Infof("compact2 fail to sync volume idx %d: %v", v.Id, err)
 	}
-	return copyDataBasedOnIndexFile(filePath+".dat", filePath+".idx", filePath+".cpd", filePath+".cpx", v.SuperBlock, v.Version(), preallocate, compactionBytePerSecond)
+
+	progress := stats.NewMaintenanceTask("vacuum", uint32(v.Id), v.Collection)
+	defer progress.Done()
+	progress.SetPhase("compact")
+
+	return copyDataBasedOnIndexFile(filePath+".dat", filePath+".idx", filePath+".cpd", filePath+".cpx", v.SuperBlock, v.Version(), preallocate, compactionBytePerSecond, progress)
 }
 
 func (v *Volume) CommitCompact() error {
@@ -99,6 +109,10 @@ func (v *Volume) CommitCompact() error {
 		v.isCompacting = false
 	}()
 
+	progress := stats.NewMaintenanceTask("vacuum", uint32(v.Id), v.Collection)
+	defer progress.Done()
+	progress.SetPhase("commit")
+
 	v.dataFileAccessLock.Lock()
 	defer v.dataFileAccessLock.Unlock()
 
@@ -315,6 +329,7 @@ type VolumeFileScanner4Vacuum struct {
 	newOffset      int64
 	now            uint64
 	writeThrottler *util.WriteThrottler
+	progress       *stats.MaintenanceTask
 }
 
 func (scanner *VolumeFileScanner4Vacuum) VisitSuperBlock(superBlock super_block.SuperBlock) error {
@@ -330,6 +345,7 @@ func (scanner *VolumeFileScanner4Vacuum) ReadNeedleBody() bool {
 }
 
 func (scanner *VolumeFileScanner4Vacuum) VisitNeedle(n *needle.Needle, offset int64, needleHeader, needleBody []byte) error {
+	scanner.progress.SetProcessedBytes(offset)
 	if n.HasTtl() && scanner.now >= n.LastModified+uint64(scanner.v.Ttl.Minutes()*60) {
 		return nil
 	}
@@ -350,7 +366,7 @@ func (scanner *VolumeFileScanner4Vacuum) VisitNeedle(n *needle.Needle, offset in
 	return nil
 }
 
-func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, preallocate int64, compactionBytePerSecond int64) (err error) {
+func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, preallocate int64, compactionBytePerSecond int64, progress *stats.MaintenanceTask) (err error) {
 	var (
 		dst backend.BackendStorageFile
 	)
@@ -368,6 +384,10 @@ func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, prealloca
 		nm:             nm,
 		dstBackend:     dst,
 		writeThrottler: util.NewWriteThrottler(compactionBytePerSecond),
+		progress:       progress,
+	}
+	if datSize, _, err := v.DataBackend.GetStat(); err == nil {
+		progress.SetTotalBytes(datSize)
 	}
 	err = ScanVolumeFile(v.dir, v.Collection, v.Id, v.needleMapKind, scanner)
 	if err != nil {
@@ -378,7 +398,7 @@ func (v *Volume) copyDataAndGenerateIndexFile(dstName, idxName string, prealloca
 	return
 }
 
-func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName string, sb super_block.SuperBlock, version needle.Version, preallocate int64, compactionBytePerSecond int64) (err error) {
+func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName string, sb super_block.SuperBlock, version needle.Version, preallocate int64, compactionBytePerSecond int64, progress *stats.MaintenanceTask) (err error) {
 	var (
 		srcDatBackend, dstDatBackend backend.BackendStorageFile
 		dataFile                     *os.File
@@ -395,6 +415,14 @@ func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName str
 	if err = oldNm.LoadFromIdx(srcIdxName); err != nil {
 		return
 	}
+	var totalSize int64
+	oldNm.AscendingVisit(func(value needle_map.NeedleValue) error {
+		if !value.Offset.IsZero() && value.Size != TombstoneFileSize {
+			totalSize += int64(value.Size)
+		}
+		return nil
+	})
+	progress.SetTotalBytes(totalSize)
 	if dataFile, err = os.Open(srcDatName); err != nil {
 		return err
 	}
@@ -416,6 +444,7 @@ func copyDataBasedOnIndexFile(srcDatName, srcIdxName, dstDatName, datIdxName str
 		if offset.IsZero() || size == TombstoneFileSize {
 			return nil
 		}
+		progress.AddProcessedBytes(int64(size))
 
 		n := new(needle.Needle)
 		err := n.ReadData(srcDatBackend, offset.ToAcutalOffset(), size, version)
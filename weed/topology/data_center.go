@@ -42,7 +42,17 @@ func (dc *DataCenter) ToMap() interface{} {
 }
 
 func (dc *DataCenter) ToDataCenterInfo() *master_pb.DataCenterInfo {
-	m := &master_pb.DataCenterInfo{
+	m := dc.toDataCenterSummary()
+	for _, c := range dc.Children() {
+		rack := c.(*Rack)
+		m.RackInfos = append(m.RackInfos, rack.ToRackInfo())
+	}
+	return m
+}
+
+// toDataCenterSummary is the data center info without the racks
+func (dc *DataCenter) toDataCenterSummary() *master_pb.DataCenterInfo {
+	return &master_pb.DataCenterInfo{
 		Id:                string(dc.Id()),
 		VolumeCount:       uint64(dc.GetVolumeCount()),
 		MaxVolumeCount:    uint64(dc.GetMaxVolumeCount()),
@@ -50,9 +60,4 @@ func (dc *DataCenter) ToDataCenterInfo() *master_pb.DataCenterInfo {
 		ActiveVolumeCount: uint64(dc.GetActiveVolumeCount()),
 		RemoteVolumeCount: uint64(dc.GetRemoteVolumeCount()),
 	}
-	for _, c := range dc.Children() {
-		rack := c.(*Rack)
-		m.RackInfos = append(m.RackInfos, rack.ToRackInfo())
-	}
-	return m
 }
@@ -61,7 +61,17 @@ func (r *Rack) ToMap() interface{} {
 }
 
 func (r *Rack) ToRackInfo() *master_pb.RackInfo {
-	m := &master_pb.RackInfo{
+	m := r.toRackSummary()
+	for _, c := range r.Children() {
+		dn := c.(*DataNode)
+		m.DataNodeInfos = append(m.DataNodeInfos, dn.ToDataNodeInfo())
+	}
+	return m
+}
+
+// toRackSummary is the rack info without the data nodes
+func (r *Rack) toRackSummary() *master_pb.RackInfo {
+	return &master_pb.RackInfo{
 		Id:                string(r.Id()),
 		VolumeCount:       uint64(r.GetVolumeCount()),
 		MaxVolumeCount:    uint64(r.GetMaxVolumeCount()),
@@ -69,9 +79,4 @@ func (r *Rack) ToRackInfo() *master_pb.RackInfo {
 		ActiveVolumeCount: uint64(r.GetActiveVolumeCount()),
 		RemoteVolumeCount: uint64(r.GetRemoteVolumeCount()),
 	}
-	for _, c := range r.Children() {
-		dn := c.(*DataNode)
-		m.DataNodeInfos = append(m.DataNodeInfos, dn.ToDataNodeInfo())
-	}
-	return m
 }
@@ -8,20 +8,94 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/operation"
 	"github.com/chrislusf/seaweedfs/weed/security"
 	"github.com/chrislusf/seaweedfs/weed/storage"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
+	"github.com/chrislusf/seaweedfs/weed/storage/types"
 	"github.com/chrislusf/seaweedfs/weed/util"
+	"github.com/chrislusf/seaweedfs/weed/util/request_id"
 )
 
+// the write acknowledgment levels, set by the "ack" form value of the upload
+const (
+	WriteAckOne    = "one"    // return after the local write, the replicas are written in the background
+	WriteAckQuorum = "quorum" // return after a majority of the copies are written
+	WriteAckAll    = "all"    // return after all the copies are written, the default
+)
+
+// pendingReplications orders the replications of the same needle, since with the "one" or "quorum" acks,
+// some replicas are still written in the background after the upload returns. The later writes and deletes
+// of the needle are only sent to the replicas after them, so a late write can not bring back a deleted needle.
+// This only orders the requests entering through this volume server.
+var pendingReplications = &replicationQueue{last: make(map[replicationKey]chan struct{})}
+
+type replicationKey struct {
+	volumeId needle.VolumeId
+	needleId types.NeedleId
+}
+
+type replicationQueue struct {
+	sync.Mutex
+	last map[replicationKey]chan struct{}
+}
+
+// enqueue returns after the earlier replications of the needle are finished on all replicas.
+// The returned done() is called after this replication is finished on all replicas.
+func (q *replicationQueue) enqueue(volumeId needle.VolumeId, needleId types.NeedleId) (done func()) {
+	key := replicationKey{volumeId, needleId}
+	current := make(chan struct{})
+	q.Lock()
+	previous := q.last[key]
+	q.last[key] = current
+	q.Unlock()
+
+	if previous != nil {
+		<-previous
+	}
+
+	return func() {
+		q.Lock()
+		if q.last[key] == current {
+			delete(q.last, key)
+		}
+		q.Unlock()
+		close(current)
+	}
+}
+
+// requiredWriteAcks is the number of copies to write before returning
+func requiredWriteAcks(ack string, copyCount int) (int, error) {
+	switch ack {
+	case WriteAckOne:
+		return 1, nil
+	case WriteAckQuorum:
+		return copyCount/2 + 1, nil
+	case "", WriteAckAll:
+		return copyCount, nil
+	}
+	return 0, fmt.Errorf("unknown write ack %q, expecting %s, %s or %s", ack, WriteAckOne, WriteAckQuorum, WriteAckAll)
+}
+
+// ValidateWriteAck checks whether ack is one of the write acknowledgment levels
+func ValidateWriteAck(ack string) error {
+	_, err := requiredWriteAcks(ack, 1)
+	return err
+}
+
 func ReplicatedWrite(masterNode string, s *storage.Store, volumeId needle.VolumeId, n *needle.Needle, r *http.Request) (isUnchanged bool, err error) {
 
 	//check JWT
 	jwt := security.GetJwt(r)
 
+	ack := r.FormValue("ack")
+	if err = ValidateWriteAck(ack); err != nil {
+		return
+	}
+
 	// check whether this is a replicated write request
 	var remoteLocations []operation.Location
 	if r.FormValue("type") != "replicate" {
@@ -39,6 +113,7 @@ func ReplicatedWrite(masterNode string, s *storage.Store, volumeId needle.Volume
 		fsync = true
 	}
 
+	localCopies := 0
 	if s.GetVolume(volumeId) != nil {
 		isUnchanged, err = s.WriteVolumeNeedle(volumeId, n, fsync)
 		if err != nil {
@@ -46,14 +121,18 @@ func ReplicatedWrite(masterNode string, s *storage.Store, volumeId needle.Volume
 			glog.V(0).Infoln(err)
 			return
 		}
+		localCopies = 1
 	}
 
 	if len(remoteLocations) > 0 { //send to other replica locations
-		if err = distributedOperation(remoteLocations, s, func(location operation.Location) error {
+		requiredAcks, _ := requiredWriteAcks(ack, localCopies+len(remoteLocations))
+		path, requestId := r.URL.Path, r.Header.Get(request_id.Header)
+		done := pendingReplications.enqueue(volumeId, n.Id)
+		if err = acknowledgedOperation(remoteLocations, requiredAcks-localCopies, done, func(location operation.Location) error {
 			u := url.URL{
 				Scheme: "http",
 				Host:   location.Url,
-				Path:   r.URL.Path,
+				Path:   path,
 			}
 			q := url.Values{
 				"type": {"replicate"},
@@ -78,6 +157,9 @@ func ReplicatedWrite(masterNode string, s *storage.Store, volumeId needle.Volume
 					pairMap[needle.PairNamePrefix+k] = v
 				}
 			}
+			if requestId != "" {
+				pairMap[request_id.Header] = requestId
+			}
 
 			// volume server do not know about encryption
 			_, err := operation.UploadData(u.String(), string(n.Name), false, n.Data, n.IsCompressed(), string(n.Mime), pairMap, jwt)
@@ -113,11 +195,13 @@ func ReplicatedDelete(masterNode string, store *storage.Store,
 	}
 
 	if len(remoteLocations) > 0 { //send to other replica locations
+		done := pendingReplications.enqueue(volumeId, n.Id)
 		if err = distributedOperation(remoteLocations, store, func(location operation.Location) error {
 			return util.Delete("http://"+location.Url+r.URL.Path+"?type=replicate", string(jwt))
 		}); err != nil {
 			size = 0
 		}
+		done()
 	}
 	return
 }
@@ -159,6 +243,48 @@ func distributedOperation(locations []operation.Location, store *storage.Store,
 	return ret.Error()
 }
 
+// acknowledgedOperation runs the operation on all locations, and returns after it succeeds on requiredAcks of them,
+// or it can not succeed on enough of them. The remaining operations go on in the background,
+// and done() is called after the operations on all locations are finished.
+func acknowledgedOperation(locations []operation.Location, requiredAcks int, done func(), op func(location operation.Location) error) error {
+	if requiredAcks >= len(locations) {
+		defer done()
+		return distributedOperation(locations, nil, op)
+	}
+	results := make(chan RemoteResult, len(locations))
+	var wg sync.WaitGroup
+	for _, location := range locations {
+		wg.Add(1)
+		go func(location operation.Location) {
+			defer wg.Done()
+			err := op(location)
+			if err != nil {
+				glog.V(0).Infof("write to replica %s: %v", location.Url, err)
+			}
+			results <- RemoteResult{location.Url, err}
+		}(location)
+	}
+	go func() {
+		wg.Wait()
+		done()
+	}()
+	ret := DistributedOperationResult(make(map[string]error))
+	acks, failures := 0, 0
+	for acks < requiredAcks && failures <= len(locations)-requiredAcks {
+		result := <-results
+		if result.Error != nil {
+			ret[result.Host] = result.Error
+			failures++
+		} else {
+			acks++
+		}
+	}
+	if acks < requiredAcks {
+		return ret.Error()
+	}
+	return nil
+}
+
 func getWritableRemoteReplications(s *storage.Store, volumeId needle.VolumeId, masterNode string) (
 	remoteLocations []operation.Location, err error) {
 
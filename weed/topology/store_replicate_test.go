@@ -0,0 +1,110 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/operation"
+)
+
+func TestRequiredWriteAcks(t *testing.T) {
+	tests := []struct {
+		ack      string
+		copies   int
+		expected int
+	}{
+		{"", 3, 3},
+		{WriteAckAll, 3, 3},
+		{WriteAckQuorum, 3, 2},
+		{WriteAckQuorum, 2, 2},
+		{WriteAckQuorum, 4, 3},
+		{WriteAckOne, 3, 1},
+	}
+	for _, test := range tests {
+		if acks, err := requiredWriteAcks(test.ack, test.copies); err != nil || acks != test.expected {
+			t.Errorf("ack %q of %d copies: %d %v, expected %d", test.ack, test.copies, acks, err, test.expected)
+		}
+	}
+	if _, err := requiredWriteAcks("two", 3); err == nil {
+		t.Errorf("unknown ack should fail")
+	}
+}
+
+func TestAcknowledgedOperation(t *testing.T) {
+	locations := []operation.Location{{Url: "a"}, {Url: "b"}, {Url: "c"}}
+
+	// returns after the fast replica, without waiting for the slow ones
+	start := time.Now()
+	finished := make(chan struct{})
+	err := acknowledgedOperation(locations, 1, func() { close(finished) }, func(location operation.Location) error {
+		if location.Url != "a" {
+			time.Sleep(time.Second)
+		}
+		return nil
+	})
+	if err != nil || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("one ack: %v after %v", err, time.Since(start))
+	}
+	select {
+	case <-finished:
+		t.Errorf("done before the slow replicas are written")
+	default:
+	}
+	<-finished
+	if time.Since(start) < time.Second {
+		t.Errorf("done after %v, before the slow replicas are written", time.Since(start))
+	}
+
+	// fails once the required acks are impossible
+	err = acknowledgedOperation(locations, 2, func() {}, func(location operation.Location) error {
+		if location.Url == "a" {
+			time.Sleep(time.Second)
+			return nil
+		}
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Errorf("two acks with two failures should fail")
+	}
+
+	// one failure is fine with two acks required
+	err = acknowledgedOperation(locations, 2, func() {}, func(location operation.Location) error {
+		if location.Url == "b" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("two acks with one failure: %v", err)
+	}
+}
+
+func TestReplicationQueue(t *testing.T) {
+	q := &replicationQueue{last: make(map[replicationKey]chan struct{})}
+
+	writeDone := q.enqueue(1, 2)
+	otherDone := q.enqueue(1, 3)
+	otherDone()
+
+	// the delete of the same needle waits for the write still replicating in the background
+	deleted := make(chan struct{})
+	go func() {
+		deleteDone := q.enqueue(1, 2)
+		deleteDone()
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+		t.Fatalf("delete replicated before the earlier write is finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	writeDone()
+	<-deleted
+
+	q.Lock()
+	defer q.Unlock()
+	if len(q.last) != 0 {
+		t.Errorf("%d replications left in the queue", len(q.last))
+	}
+}
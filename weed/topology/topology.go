@@ -37,6 +37,8 @@ type Topology struct {
 	Configuration *Configuration
 
 	RaftServer raft.Server
+
+	Events *EventLog
 }
 
 func NewTopology(id string, seq sequence.Sequencer, volumeSizeLimit uint64, pulse int, replicationAsMin bool) *Topology {
@@ -57,6 +59,8 @@ func NewTopology(id string, seq sequence.Sequencer, volumeSizeLimit uint64, puls
 
 	t.Configuration = &Configuration{}
 
+	t.Events = NewEventLog(DefaultEventLogSize)
+
 	return t
 }
 
@@ -216,13 +220,20 @@ func (t *Topology) SyncDataNodeRegistration(volumes []*master_pb.VolumeInformati
 	newVolumes, deletedVolumes, changedVolumes = dn.UpdateVolumes(volumeInfos)
 	for _, v := range newVolumes {
 		t.RegisterVolumeLayout(v, dn)
+		t.Events.Add(EventVolumeAdded, dn.Url(), uint32(v.Id), v.Collection, "")
 	}
 	for _, v := range deletedVolumes {
 		t.UnRegisterVolumeLayout(v, dn)
+		t.Events.Add(EventVolumeRemoved, dn.Url(), uint32(v.Id), v.Collection, "")
 	}
 	for _, v := range changedVolumes {
 		vl := t.GetVolumeLayout(v.Collection, v.ReplicaPlacement, v.Ttl)
 		vl.ensureCorrectWritables(&v)
+		if v.ReadOnly {
+			t.Events.Add(EventVolumeReadOnly, dn.Url(), uint32(v.Id), v.Collection, "")
+		} else {
+			t.Events.Add(EventVolumeWritable, dn.Url(), uint32(v.Id), v.Collection, "")
+		}
 	}
 	return
 }
@@ -249,9 +260,11 @@ func (t *Topology) IncrementalSyncDataNodeRegistration(newVolumes, deletedVolume
 
 	for _, vi := range newVis {
 		t.RegisterVolumeLayout(vi, dn)
+		t.Events.Add(EventVolumeAdded, dn.Url(), uint32(vi.Id), vi.Collection, "")
 	}
 	for _, vi := range oldVis {
 		t.UnRegisterVolumeLayout(vi, dn)
+		t.Events.Add(EventVolumeRemoved, dn.Url(), uint32(vi.Id), vi.Collection, "")
 	}
 
 	return
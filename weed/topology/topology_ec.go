@@ -1,6 +1,9 @@
 package topology
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/chrislusf/seaweedfs/weed/glog"
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
@@ -26,9 +29,11 @@ func (t *Topology) SyncDataNodeEcShards(shardInfos []*master_pb.VolumeEcShardInf
 	newShards, deletedShards = dn.UpdateEcShards(shards)
 	for _, v := range newShards {
 		t.RegisterEcShards(v, dn)
+		t.Events.Add(EventEcShardsAdded, dn.Url(), uint32(v.VolumeId), v.Collection, fmt.Sprintf("shards %v", v.ShardBits.ShardIds()))
 	}
 	for _, v := range deletedShards {
 		t.UnRegisterEcShards(v, dn)
+		t.Events.Add(EventEcShardsRemoved, dn.Url(), uint32(v.VolumeId), v.Collection, fmt.Sprintf("shards %v", v.ShardBits.ShardIds()))
 	}
 	return
 }
@@ -55,9 +60,11 @@ func (t *Topology) IncrementalSyncDataNodeEcShards(newEcShards, deletedEcShards
 
 	for _, v := range newShards {
 		t.RegisterEcShards(v, dn)
+		t.Events.Add(EventEcShardsAdded, dn.Url(), uint32(v.VolumeId), v.Collection, fmt.Sprintf("shards %v", v.ShardBits.ShardIds()))
 	}
 	for _, v := range deletedShards {
 		t.UnRegisterEcShards(v, dn)
+		t.Events.Add(EventEcShardsRemoved, dn.Url(), uint32(v.VolumeId), v.Collection, fmt.Sprintf("shards %v", v.ShardBits.ShardIds()))
 	}
 	return
 }
@@ -171,3 +178,55 @@ func (t *Topology) DeleteEcCollection(collection string) {
 
 	return
 }
+
+// PickForEcShards picks the data nodes for the shards of a new ec volume, indexed by the shard id.
+// The shards are spread over the racks first, then over the data nodes with the most free space.
+func (t *Topology) PickForEcShards() (dataNodes []*DataNode, err error) {
+	var racks [][]*DataNode
+	for _, dc := range t.Children() {
+		for _, r := range dc.Children() {
+			var rackNodes []*DataNode
+			for _, n := range r.Children() {
+				if n.FreeSpace() > 0 {
+					rackNodes = append(rackNodes, n.(*DataNode))
+				}
+			}
+			sort.Slice(rackNodes, func(i, j int) bool {
+				return rackNodes[i].FreeSpace() > rackNodes[j].FreeSpace()
+			})
+			if len(rackNodes) > 0 {
+				racks = append(racks, rackNodes)
+			}
+		}
+	}
+	sort.Slice(racks, func(i, j int) bool {
+		return len(racks[i]) > len(racks[j])
+	})
+
+	// take the data nodes from each rack in turn
+	var candidates []*DataNode
+	freeShardSlots := make(map[*DataNode]int64)
+	for i := 0; len(racks) > 0 && i < len(racks[0]); i++ {
+		for _, rackNodes := range racks {
+			if i < len(rackNodes) {
+				candidates = append(candidates, rackNodes[i])
+				freeShardSlots[rackNodes[i]] = rackNodes[i].FreeSpace() * erasure_coding.DataShardsCount
+			}
+		}
+	}
+
+	for len(dataNodes) < erasure_coding.TotalShardsCount {
+		picked := false
+		for _, dn := range candidates {
+			if len(dataNodes) < erasure_coding.TotalShardsCount && freeShardSlots[dn] > 0 {
+				freeShardSlots[dn]--
+				dataNodes = append(dataNodes, dn)
+				picked = true
+			}
+		}
+		if !picked {
+			return nil, fmt.Errorf("no free space for %d ec shards", erasure_coding.TotalShardsCount)
+		}
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package topology
 
 import (
+	"fmt"
 	"google.golang.org/grpc"
 	"math/rand"
 	"time"
@@ -50,6 +51,7 @@ func (t *Topology) SetVolumeCapacityFull(volumeInfo storage.VolumeInfo) bool {
 			dn.UpAdjustActiveVolumeCountDelta(-1)
 		}
 	}
+	t.Events.Add(EventVolumeFull, "", uint32(volumeInfo.Id), volumeInfo.Collection, fmt.Sprintf("size %d", volumeInfo.Size))
 	return true
 }
 func (t *Topology) UnRegisterDataNode(dn *DataNode) {
@@ -65,4 +67,5 @@ func (t *Topology) UnRegisterDataNode(dn *DataNode) {
 	if dn.Parent() != nil {
 		dn.Parent().UnlinkChildNode(dn.Id())
 	}
+	t.Events.Add(EventServerLeft, dn.Url(), 0, "", "")
 }
@@ -0,0 +1,169 @@
+package topology
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+)
+
+const (
+	EventServerJoined    = "server.joined"
+	EventServerLeft      = "server.left"
+	EventVolumeCreated   = "volume.created"
+	EventVolumeAdded     = "volume.added"
+	EventVolumeRemoved   = "volume.removed"
+	EventVolumeReadOnly  = "volume.readonly"
+	EventVolumeWritable  = "volume.writable"
+	EventVolumeFull      = "volume.full"
+	EventEcShardsAdded   = "ec.shards.added"
+	EventEcShardsRemoved = "ec.shards.removed"
+	EventLeaderChanged   = "leader.changed"
+
+	DefaultEventLogSize = 10000
+)
+
+// TopologyEvent is one change of the cluster topology observed by the master
+type TopologyEvent struct {
+	TsNs       int64  `json:"tsNs"`
+	Type       string `json:"type"`
+	DataNode   string `json:"dataNode,omitempty"`
+	VolumeId   uint32 `json:"volumeId,omitempty"`
+	Collection string `json:"collection,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// EventLog keeps the most recent topology events in a ring buffer,
+// and optionally appends every event to a local file as json lines,
+// so the history survives master restarts.
+type EventLog struct {
+	sync.RWMutex
+	events []TopologyEvent
+	next   int
+	full   bool
+
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewEventLog(size int) *EventLog {
+	if size <= 0 {
+		size = DefaultEventLogSize
+	}
+	return &EventLog{
+		events: make([]TopologyEvent, size),
+	}
+}
+
+// Persist loads the previous events from the file, and appends new events to it.
+func (l *EventLog) Persist(fileName string) error {
+	if f, err := os.Open(fileName); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var event TopologyEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				glog.V(1).Infof("skip bad topology event in %s: %v", fileName, err)
+				continue
+			}
+			l.add(event)
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open topology event log %s: %v", fileName, err)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	l.file = f
+	l.encoder = json.NewEncoder(f)
+	return nil
+}
+
+func (l *EventLog) Add(eventType string, dataNode string, volumeId uint32, collection string, detail string) {
+	if l == nil {
+		return
+	}
+	event := TopologyEvent{
+		TsNs:       time.Now().UnixNano(),
+		Type:       eventType,
+		DataNode:   dataNode,
+		VolumeId:   volumeId,
+		Collection: collection,
+		Detail:     detail,
+	}
+	l.add(event)
+}
+
+func (l *EventLog) add(event TopologyEvent) {
+	l.Lock()
+	defer l.Unlock()
+	l.events[l.next] = event
+	l.next++
+	if l.next == len(l.events) {
+		l.next = 0
+		l.full = true
+	}
+	if l.encoder != nil {
+		if err := l.encoder.Encode(&event); err != nil {
+			glog.Warningf("write topology event log: %v", err)
+		}
+	}
+}
+
+// Query returns the events within [sinceNs, untilNs] that match the filter, oldest first.
+// A zero untilNs means no upper bound. If limit is positive, only the latest limit events are returned.
+func (l *EventLog) Query(sinceNs, untilNs int64, filter func(event *TopologyEvent) bool, limit int) (events []TopologyEvent) {
+	if l == nil {
+		return nil
+	}
+	l.RLock()
+	defer l.RUnlock()
+
+	// walk from the newest event backwards
+	count := l.next
+	if l.full {
+		count = len(l.events)
+	}
+	for i := 0; i < count; i++ {
+		index := l.next - 1 - i
+		if index < 0 {
+			index += len(l.events)
+		}
+		event := &l.events[index]
+		if event.TsNs < sinceNs {
+			break
+		}
+		if untilNs > 0 && event.TsNs > untilNs {
+			continue
+		}
+		if filter != nil && !filter(event) {
+			continue
+		}
+		events = append(events, *event)
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+	}
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return
+}
+
+func (l *EventLog) Close() {
+	l.Lock()
+	defer l.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+		l.encoder = nil
+	}
+}
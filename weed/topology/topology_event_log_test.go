@@ -0,0 +1,70 @@
+package topology
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEventLogRingBuffer(t *testing.T) {
+	l := NewEventLog(3)
+	for i := 1; i <= 5; i++ {
+		l.Add(EventVolumeAdded, "dn1", uint32(i), "", "")
+	}
+
+	events := l.Query(0, 0, nil, 0)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.VolumeId != uint32(i+3) {
+			t.Errorf("event %d: expected volume %d, got %d", i, i+3, event.VolumeId)
+		}
+	}
+
+	events = l.Query(0, 0, nil, 2)
+	if len(events) != 2 || events[0].VolumeId != 4 || events[1].VolumeId != 5 {
+		t.Errorf("expected the latest 2 events, got %+v", events)
+	}
+
+	events = l.Query(0, 0, func(event *TopologyEvent) bool { return event.VolumeId == 4 }, 0)
+	if len(events) != 1 {
+		t.Errorf("expected 1 filtered event, got %d", len(events))
+	}
+
+	if events = l.Query(events[0].TsNs+1, 0, nil, 0); len(events) > 1 {
+		t.Errorf("expected at most 1 event after volume 4, got %d", len(events))
+	}
+}
+
+func TestEventLogPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "topology_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "events.log")
+
+	l := NewEventLog(10)
+	if err = l.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	l.Add(EventServerJoined, "dn1", 0, "", "dc dc1 rack rack1")
+	l.Add(EventVolumeReadOnly, "dn1", 7, "c1", "")
+	l.Close()
+
+	reloaded := NewEventLog(10)
+	if err = reloaded.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	events := reloaded.Query(0, 0, nil, 0)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 reloaded events, got %d", len(events))
+	}
+	if events[1].Type != EventVolumeReadOnly || events[1].VolumeId != 7 || events[1].Collection != "c1" {
+		t.Errorf("unexpected reloaded event %+v", events[1])
+	}
+}
@@ -79,7 +79,52 @@ func (t *Topology) ToVolumeLocations() (volumeLocations []*master_pb.VolumeLocat
 }
 
 func (t *Topology) ToTopologyInfo() *master_pb.TopologyInfo {
-	m := &master_pb.TopologyInfo{
+	m := t.toTopologySummary()
+	for _, c := range t.Children() {
+		dc := c.(*DataCenter)
+		m.DataCenterInfos = append(m.DataCenterInfos, dc.ToDataCenterInfo())
+	}
+	return m
+}
+
+// StreamTopologyInfo sends the topology without the data centers first,
+// then each data center, rack and data node in a topology of only its parents,
+// so a large topology is not built into one message.
+func (t *Topology) StreamTopologyInfo(fn func(*master_pb.TopologyInfo) error) error {
+	if err := fn(t.toTopologySummary()); err != nil {
+		return err
+	}
+	for _, c := range t.Children() {
+		dc := c.(*DataCenter)
+		if err := fn(&master_pb.TopologyInfo{DataCenterInfos: []*master_pb.DataCenterInfo{dc.toDataCenterSummary()}}); err != nil {
+			return err
+		}
+		for _, r := range dc.Children() {
+			rack := r.(*Rack)
+			rackInfo := rack.toRackSummary()
+			dcInfo := dc.toDataCenterSummary()
+			dcInfo.RackInfos = []*master_pb.RackInfo{rackInfo}
+			if err := fn(&master_pb.TopologyInfo{DataCenterInfos: []*master_pb.DataCenterInfo{dcInfo}}); err != nil {
+				return err
+			}
+			for _, n := range rack.Children() {
+				dn := n.(*DataNode)
+				rackInfo = rack.toRackSummary()
+				rackInfo.DataNodeInfos = []*master_pb.DataNodeInfo{dn.ToDataNodeInfo()}
+				dcInfo = dc.toDataCenterSummary()
+				dcInfo.RackInfos = []*master_pb.RackInfo{rackInfo}
+				if err := fn(&master_pb.TopologyInfo{DataCenterInfos: []*master_pb.DataCenterInfo{dcInfo}}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// toTopologySummary is the topology info without the data centers
+func (t *Topology) toTopologySummary() *master_pb.TopologyInfo {
+	return &master_pb.TopologyInfo{
 		Id:                string(t.Id()),
 		VolumeCount:       uint64(t.GetVolumeCount()),
 		MaxVolumeCount:    uint64(t.GetMaxVolumeCount()),
@@ -87,9 +132,4 @@ func (t *Topology) ToTopologyInfo() *master_pb.TopologyInfo {
 		ActiveVolumeCount: uint64(t.GetActiveVolumeCount()),
 		RemoteVolumeCount: uint64(t.GetRemoteVolumeCount()),
 	}
-	for _, c := range t.Children() {
-		dc := c.(*DataCenter)
-		m.DataCenterInfos = append(m.DataCenterInfos, dc.ToDataCenterInfo())
-	}
-	return m
 }
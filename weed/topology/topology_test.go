@@ -1,9 +1,16 @@
 package topology
 
 import (
+	"context"
+	"io"
+	"reflect"
+
+	"google.golang.org/grpc"
+
 	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
 	"github.com/chrislusf/seaweedfs/weed/sequence"
 	"github.com/chrislusf/seaweedfs/weed/storage"
+	"github.com/chrislusf/seaweedfs/weed/storage/erasure_coding"
 	"github.com/chrislusf/seaweedfs/weed/storage/needle"
 	"github.com/chrislusf/seaweedfs/weed/storage/super_block"
 
@@ -174,3 +181,90 @@ func TestAddRemoveVolume(t *testing.T) {
 	}
 
 }
+
+type volumeListStream struct {
+	grpc.ClientStream
+	parts []*master_pb.VolumeListResponse
+}
+
+func (s *volumeListStream) Recv() (*master_pb.VolumeListResponse, error) {
+	if len(s.parts) == 0 {
+		return nil, io.EOF
+	}
+	part := s.parts[0]
+	s.parts = s.parts[1:]
+	return part, nil
+}
+
+type volumeListClient struct {
+	master_pb.SeaweedClient
+	stream *volumeListStream
+}
+
+func (c *volumeListClient) VolumeListStream(ctx context.Context, in *master_pb.VolumeListRequest, opts ...grpc.CallOption) (master_pb.Seaweed_VolumeListStreamClient, error) {
+	return c.stream, nil
+}
+
+func TestStreamTopologyInfo(t *testing.T) {
+	topo := setup(topologyLayout)
+
+	stream := &volumeListStream{}
+	topo.StreamTopologyInfo(func(topologyInfo *master_pb.TopologyInfo) error {
+		stream.parts = append(stream.parts, &master_pb.VolumeListResponse{TopologyInfo: topologyInfo, VolumeSizeLimitMb: 30})
+		return nil
+	})
+	resp, err := master_pb.ReadVolumeList(context.Background(), &volumeListClient{stream: stream})
+	if err != nil {
+		t.Fatalf("read volume list: %v", err)
+	}
+	if resp.VolumeSizeLimitMb != 30 {
+		t.Errorf("volume size limit %d", resp.VolumeSizeLimitMb)
+	}
+
+	volumeCounts := func(topologyInfo *master_pb.TopologyInfo) map[string]int {
+		counts := make(map[string]int)
+		for _, dc := range topologyInfo.DataCenterInfos {
+			for _, rack := range dc.RackInfos {
+				for _, dn := range rack.DataNodeInfos {
+					counts[dc.Id+"/"+rack.Id+"/"+dn.Id] += len(dn.VolumeInfos)
+				}
+			}
+		}
+		return counts
+	}
+	expected, merged := volumeCounts(topo.ToTopologyInfo()), volumeCounts(resp.TopologyInfo)
+	if !reflect.DeepEqual(expected, merged) {
+		t.Errorf("merged topology %v, expected %v", merged, expected)
+	}
+	if resp.TopologyInfo.ActiveVolumeCount != uint64(topo.GetActiveVolumeCount()) {
+		t.Errorf("active volume count %d, expected %d", resp.TopologyInfo.ActiveVolumeCount, topo.GetActiveVolumeCount())
+	}
+}
+
+func TestPickForEcShards(t *testing.T) {
+	topo := setup(topologyLayout)
+	dataNodes, err := topo.PickForEcShards()
+	if err != nil {
+		t.Fatalf("pick for ec shards: %v", err)
+	}
+	if len(dataNodes) != erasure_coding.TotalShardsCount {
+		t.Fatalf("picked %d data nodes for ec shards", len(dataNodes))
+	}
+	shardCounts := make(map[NodeId]int)
+	racks := make(map[*Rack]bool)
+	for _, dn := range dataNodes {
+		shardCounts[dn.Id()]++
+		racks[dn.GetRack()] = true
+	}
+	if shardCounts["server111"] > 0 {
+		t.Errorf("picked server111 without free space")
+	}
+	if len(racks) != 3 {
+		t.Errorf("ec shards spread to %d racks", len(racks))
+	}
+	for server, count := range shardCounts {
+		if count > 3 {
+			t.Errorf("%s picked for %d ec shards", server, count)
+		}
+	}
+}
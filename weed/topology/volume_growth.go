@@ -221,6 +221,7 @@ func (vg *VolumeGrowth) grow(grpcDialOption grpc.DialOption, topo *Topology, vid
 			}
 			server.AddOrUpdateVolume(vi)
 			topo.RegisterVolumeLayout(vi, server)
+			topo.Events.Add(EventVolumeCreated, server.Url(), uint32(vid), option.Collection, fmt.Sprintf("replication %s ttl %s", option.ReplicaPlacement, option.Ttl))
 			glog.V(0).Infoln("Created Volume", vid, "on", server.NodeImpl.String())
 		} else {
 			glog.V(0).Infoln("Failed to assign volume", vid, "to", servers, "error", err)
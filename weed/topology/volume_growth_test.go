@@ -98,9 +98,10 @@ func setup(topologyLayout string) *Topology {
 				for _, v := range serverMap["volumes"].([]interface{}) {
 					m := v.(map[string]interface{})
 					vi := storage.VolumeInfo{
-						Id:      needle.VolumeId(int64(m["id"].(float64))),
-						Size:    uint64(m["size"].(float64)),
-						Version: needle.CurrentVersion}
+						Id:               needle.VolumeId(int64(m["id"].(float64))),
+						Size:             uint64(m["size"].(float64)),
+						Version:          needle.CurrentVersion,
+						ReplicaPlacement: &super_block.ReplicaPlacement{}}
 					server.AddOrUpdateVolume(vi)
 				}
 				server.UpAdjustMaxVolumeCountDelta(int64(serverMap["limit"].(float64)))
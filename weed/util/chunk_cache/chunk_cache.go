@@ -116,6 +116,27 @@ func (c *ChunkCache) doSetChunk(fileId string, data []byte) {
 
 }
 
+func (c *ChunkCache) DeleteChunk(fileId string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	glog.V(4).Infof("DeleteChunk %s\n", fileId)
+
+	c.memCache.DeleteChunk(fileId)
+
+	fid, err := needle.ParseFileIdFromString(fileId)
+	if err != nil {
+		glog.Errorf("failed to parse file id %s", fileId)
+		return
+	}
+	for _, diskCache := range c.diskCaches {
+		diskCache.deleteChunk(fid.Key)
+	}
+}
+
 func (c *ChunkCache) Shutdown() {
 	if c == nil {
 		return
@@ -34,3 +34,7 @@ func (c *ChunkCacheInMemory) GetChunk(fileId string) []byte {
 func (c *ChunkCacheInMemory) SetChunk(fileId string, data []byte) {
 	c.cache.Set(fileId, data, time.Hour)
 }
+
+func (c *ChunkCacheInMemory) DeleteChunk(fileId string) {
+	c.cache.Delete(fileId)
+}
@@ -143,3 +143,11 @@ func (v *ChunkCacheVolume) WriteNeedle(key types.NeedleId, data []byte) error {
 
 	return nil
 }
+
+func (v *ChunkCacheVolume) DeleteNeedle(key types.NeedleId) error {
+	nv, ok := v.nm.Get(key)
+	if !ok {
+		return nil
+	}
+	return v.nm.Delete(key, nv.Offset)
+}
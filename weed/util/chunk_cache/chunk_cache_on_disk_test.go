@@ -57,3 +57,45 @@ func TestOnDisk(t *testing.T) {
 	cache.Shutdown()
 
 }
+
+func TestDeleteChunk(t *testing.T) {
+
+	tmpDir, _ := ioutil.TempDir("", "c")
+	defer os.RemoveAll(tmpDir)
+
+	cache := NewChunkCache(1000, tmpDir, 32)
+
+	small, large := make([]byte, 1024), make([]byte, 2*1024*1024)
+	rand.Read(small)
+	rand.Read(large)
+	cache.SetChunk("1,1aabbccdd", small)
+	cache.SetChunk("1,2aabbccdd", large)
+	cache.SetChunk("1,3aabbccdd", small)
+
+	cache.DeleteChunk("1,1aabbccdd")
+	cache.DeleteChunk("1,2aabbccdd")
+	cache.DeleteChunk("1,4aabbccdd")
+
+	if data := cache.GetChunk("1,1aabbccdd", 1); data != nil {
+		t.Errorf("deleted small chunk is still cached")
+	}
+	if data := cache.GetChunk("1,2aabbccdd", 1); data != nil {
+		t.Errorf("deleted large chunk is still cached")
+	}
+	if data := cache.GetChunk("1,3aabbccdd", 1); bytes.Compare(data, small) != 0 {
+		t.Errorf("failed to read the chunk not deleted")
+	}
+
+	cache.Shutdown()
+
+	cache = NewChunkCache(1000, tmpDir, 32)
+	if data := cache.GetChunk("1,1aabbccdd", 1); data != nil {
+		t.Errorf("deleted chunk is cached after reloading")
+	}
+	cache.SetChunk("1,1aabbccdd", small)
+	if data := cache.GetChunk("1,1aabbccdd", 1); bytes.Compare(data, small) != 0 {
+		t.Errorf("failed to cache the deleted chunk again")
+	}
+	cache.Shutdown()
+
+}
@@ -82,6 +82,14 @@ func (c *OnDiskCacheLayer) getChunk(needleId types.NeedleId) (data []byte) {
 
 }
 
+func (c *OnDiskCacheLayer) deleteChunk(needleId types.NeedleId) {
+	for _, diskCache := range c.diskCaches {
+		if err := diskCache.DeleteNeedle(needleId); err != nil {
+			glog.Errorf("failed to delete %v from cache file %s: %v", needleId, diskCache.fileName, err)
+		}
+	}
+}
+
 func (c *OnDiskCacheLayer) shutdown() {
 
 	for _, diskCache := range c.diskCaches {
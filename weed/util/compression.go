@@ -2,19 +2,34 @@ package util
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
+	"encoding/binary"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"strings"
+	"sync"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/klauspost/compress"
+	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zstd"
 )
 
+// a gzip writer allocates about 1MB, more than compressing a small file takes
+var (
+	gzipWriterPool = sync.Pool{
+		New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+			return w
+		},
+	}
+	gzipReaderPool sync.Pool
+)
+
 func GzipData(input []byte) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	w, _ := gzip.NewWriterLevel(buf, flate.BestSpeed)
+	w := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(w)
+	w.Reset(buf)
 	if _, err := w.Write(input); err != nil {
 		glog.V(2).Infoln("error compressing data:", err)
 		return nil, err
@@ -26,6 +41,15 @@ func GzipData(input []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// IsCompressibleData estimates from a sample whether the data is worth compressing, much faster than compressing it
+func IsCompressibleData(data []byte) bool {
+	sample := data
+	if len(sample) > 32*1024 {
+		sample = sample[:32*1024]
+	}
+	return compress.Estimate(sample) > 0.1
+}
+
 var zstdEncoder, _ = zstd.NewWriter(nil)
 
 func ZstdData(input []byte) ([]byte, error) {
@@ -43,14 +67,29 @@ func DecompressData(input []byte) ([]byte, error) {
 }
 
 func ungzipData(input []byte) ([]byte, error) {
-	buf := bytes.NewBuffer(input)
-	r, _ := gzip.NewReader(buf)
-	defer r.Close()
-	output, err := ioutil.ReadAll(r)
+	var r *gzip.Reader
+	var err error
+	if pooled := gzipReaderPool.Get(); pooled != nil {
+		r = pooled.(*gzip.Reader)
+		err = r.Reset(bytes.NewReader(input))
+	} else {
+		r, err = gzip.NewReader(bytes.NewReader(input))
+	}
 	if err != nil {
 		glog.V(2).Infoln("error uncompressing data:", err)
+		return nil, err
+	}
+	defer gzipReaderPool.Put(r)
+
+	// the last 4 bytes are the uncompressed size, unless there are multiple gzip members
+	var output bytes.Buffer
+	if size := int(binary.LittleEndian.Uint32(input[len(input)-4:])); size < 64*len(input) {
+		output.Grow(size + bytes.MinRead)
+	}
+	if _, err = io.Copy(&output, r); err != nil {
+		glog.V(2).Infoln("error uncompressing data:", err)
 	}
-	return output, err
+	return output.Bytes(), err
 }
 
 var decoder, _ = zstd.NewReader(nil)
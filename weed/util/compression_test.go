@@ -1,6 +1,8 @@
 package util
 
 import (
+	"bytes"
+	"math/rand"
 	"testing"
 
 	"golang.org/x/tools/godoc/util"
@@ -19,3 +21,68 @@ func TestIsGzippable(t *testing.T) {
 
 	t.Logf("compressed size %d\n", len(compressed))
 }
+
+func TestGzipRoundTrip(t *testing.T) {
+	for _, data := range [][]byte{{}, []byte("hello"), compressibleData(100 * 1024)} {
+		compressed, err := GzipData(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := DecompressData(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, decompressed) {
+			t.Errorf("decompressed %d bytes, expected %d", len(decompressed), len(data))
+		}
+	}
+}
+
+func TestIsCompressibleData(t *testing.T) {
+	random := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	if IsCompressibleData(random) {
+		t.Errorf("random data is not compressible")
+	}
+	if !IsCompressibleData(compressibleData(64 * 1024)) {
+		t.Errorf("text is compressible")
+	}
+}
+
+func compressibleData(size int) []byte {
+	words := []string{"hello ", "world ", "seaweed ", "volume ", "{\"needle\":1} "}
+	random := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[random.Intn(len(words))])
+	}
+	return buf.Bytes()[:size]
+}
+
+func BenchmarkGzipData(b *testing.B) {
+	data := compressibleData(64 * 1024)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GzipData(data)
+	}
+}
+
+func BenchmarkDecompressData(b *testing.B) {
+	data := compressibleData(64 * 1024)
+	compressed, _ := GzipData(data)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		DecompressData(compressed)
+	}
+}
+
+func BenchmarkIsCompressibleData(b *testing.B) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		IsCompressibleData(data)
+	}
+}
@@ -0,0 +1,106 @@
+package delta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// GetManifest reads the manifest of the file from the filer
+func GetManifest(fileUrl string, blockSize int64) (*Manifest, error) {
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("delta", "manifest")
+	if blockSize > 0 {
+		q.Set("blockSize", strconv.FormatInt(blockSize, 10))
+	}
+	u.RawQuery = q.Encode()
+
+	data, err := util.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parse manifest of %s: %v", fileUrl, err)
+	}
+	if m.BlockSize < MinBlockSize || m.BlockSize > MaxBlockSize || int64(len(m.Blocks)) != (m.Size+m.BlockSize-1)/m.BlockSize {
+		return nil, fmt.Errorf("invalid manifest of %s: size %d, block size %d, %d blocks", fileUrl, m.Size, m.BlockSize, len(m.Blocks))
+	}
+	return m, nil
+}
+
+// Fetch updates the local file to the file on the filer, downloading only the blocks changed from the local file.
+// It returns the number of downloaded bytes, excluding the manifest.
+func Fetch(fileUrl string, localPath string, blockSize int64) (fetched int64, err error) {
+	m, err := GetManifest(fileUrl, blockSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var offsets []int64
+	local, err := os.Open(localPath)
+	if err == nil {
+		defer local.Close()
+		stat, statErr := local.Stat()
+		if statErr != nil {
+			return 0, statErr
+		}
+		if offsets, err = m.Match(local, stat.Size()); err != nil {
+			return 0, err
+		}
+	} else if os.IsNotExist(err) {
+		offsets = make([]int64, len(m.Blocks))
+		for i := range offsets {
+			offsets[i] = -1
+		}
+	} else {
+		return 0, err
+	}
+
+	tmpPath := localPath + ".delta"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	fetched, err = m.Patch(dst, local, offsets, func(offset, size int64) (io.ReadCloser, error) {
+		return fetchRange(fileUrl, offset, size)
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fetched, err
+	}
+	return fetched, os.Rename(tmpPath, localPath)
+}
+
+func fetchRange(fileUrl string, offset, size int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", fileUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+	resp, err := util.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// the filer may reply the single range with 200 and the Content-Range header
+	contentRange := resp.Header.Get("Content-Range")
+	if resp.StatusCode >= 300 || !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-%d/", offset, offset+size-1)) {
+		util.CloseResponse(resp)
+		return nil, fmt.Errorf("%s: %s, Content-Range %q", fileUrl, resp.Status, contentRange)
+	}
+	return resp.Body, nil
+}
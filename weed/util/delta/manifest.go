@@ -0,0 +1,265 @@
+package delta
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// A zsync style delta download of a large file, which changes a little between the versions:
+// the server publishes the manifest of the file, i.e., the checksums of its fixed size blocks,
+// and the client finds the blocks in its old copy with the rolling checksum,
+// and downloads only the other blocks with range requests.
+
+const (
+	DefaultBlockSize = 1024 * 1024
+	MinBlockSize     = 4 * 1024
+	MaxBlockSize     = 64 * 1024 * 1024
+)
+
+type Manifest struct {
+	Etag      string  `json:"etag,omitempty"`
+	Size      int64   `json:"size"`
+	BlockSize int64   `json:"blockSize"`
+	Blocks    []Block `json:"blocks"`
+}
+
+// Block has the checksums of one block. The last block may be shorter than the block size.
+type Block struct {
+	Weak uint32 `json:"weak"`
+	Md5  string `json:"md5"`
+}
+
+func (m *Manifest) blockLength(i int) int64 {
+	start := int64(i) * m.BlockSize
+	if start+m.BlockSize > m.Size {
+		return m.Size - start
+	}
+	return m.BlockSize
+}
+
+// ManifestWriter computes the manifest of the content written to it
+type ManifestWriter struct {
+	manifest *Manifest
+	block    []byte
+}
+
+func NewManifestWriter(blockSize int64) *ManifestWriter {
+	return &ManifestWriter{
+		manifest: &Manifest{BlockSize: blockSize, Blocks: []Block{}},
+		block:    make([]byte, 0, blockSize),
+	}
+}
+
+func (mw *ManifestWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		x := copy(mw.block[len(mw.block):cap(mw.block)], p)
+		mw.block = mw.block[:len(mw.block)+x]
+		if len(mw.block) == cap(mw.block) {
+			mw.addBlock()
+		}
+		p = p[x:]
+		n += x
+	}
+	return n, nil
+}
+
+func (mw *ManifestWriter) addBlock() {
+	mw.manifest.Blocks = append(mw.manifest.Blocks, newBlock(mw.block))
+	mw.manifest.Size += int64(len(mw.block))
+	mw.block = mw.block[:0]
+}
+
+// Manifest returns the manifest of all the written content
+func (mw *ManifestWriter) Manifest() *Manifest {
+	if len(mw.block) > 0 {
+		mw.addBlock()
+	}
+	return mw.manifest
+}
+
+func NewManifest(r io.Reader, blockSize int64) (*Manifest, error) {
+	mw := NewManifestWriter(blockSize)
+	if _, err := io.Copy(mw, r); err != nil {
+		return nil, err
+	}
+	return mw.Manifest(), nil
+}
+
+func newBlock(data []byte) Block {
+	return Block{
+		Weak: newRollingChecksum(data).value(),
+		Md5:  md5Hex(data),
+	}
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// rollingChecksum is the rsync weak checksum, which can be moved forward by one byte
+type rollingChecksum struct {
+	a, b uint32
+	size uint32
+}
+
+func newRollingChecksum(data []byte) *rollingChecksum {
+	c := &rollingChecksum{size: uint32(len(data))}
+	for i, x := range data {
+		c.a += uint32(x)
+		c.b += uint32(len(data)-i) * uint32(x)
+	}
+	return c
+}
+
+func (c *rollingChecksum) roll(out, in byte) {
+	c.a += uint32(in) - uint32(out)
+	c.b += c.a - c.size*uint32(out)
+}
+
+func (c *rollingChecksum) value() uint32 {
+	return c.a&0xffff | c.b<<16
+}
+
+// Match finds the blocks in the local file, and returns the offset of each block in the local file, or -1 if not found.
+func (m *Manifest) Match(local io.ReaderAt, localSize int64) ([]int64, error) {
+	offsets := make([]int64, len(m.Blocks))
+	weakIndex := make(map[uint32][]int)
+	for i, block := range m.Blocks {
+		offsets[i] = -1
+		if m.blockLength(i) == m.BlockSize {
+			weakIndex[block.Weak] = append(weakIndex[block.Weak], i)
+		}
+	}
+
+	window := make([]byte, m.BlockSize)
+	ordered := make([]byte, m.BlockSize)
+	var checksum *rollingChecksum
+	reader := bufio.NewReaderSize(io.NewSectionReader(local, 0, localSize), 1024*1024)
+	var pos int64
+	head, filled := 0, 0
+	for {
+		if filled < len(window) {
+			n, err := io.ReadFull(reader, window[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read local file: %v", err)
+			}
+			head, checksum = 0, newRollingChecksum(window)
+		}
+
+		if candidates, found := weakIndex[checksum.value()]; found {
+			copy(ordered, window[head:])
+			copy(ordered[len(window)-head:], window[:head])
+			strong, matched := md5Hex(ordered), false
+			for _, i := range candidates {
+				if m.Blocks[i].Md5 == strong {
+					if offsets[i] < 0 {
+						offsets[i] = pos
+					}
+					matched = true
+				}
+			}
+			if matched {
+				pos += m.BlockSize
+				filled = 0
+				continue
+			}
+		}
+
+		in, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read local file: %v", err)
+		}
+		checksum.roll(window[head], in)
+		window[head] = in
+		head = (head + 1) % len(window)
+		pos++
+	}
+
+	// the shorter last block is only looked for at the same offset, or at the end of the local file
+	if last := len(m.Blocks) - 1; last >= 0 && m.blockLength(last) < m.BlockSize {
+		length := m.blockLength(last)
+		for _, offset := range []int64{int64(last) * m.BlockSize, localSize - length} {
+			if offset < 0 || offset+length > localSize {
+				continue
+			}
+			data := make([]byte, length)
+			if _, err := local.ReadAt(data, offset); err != nil && err != io.EOF {
+				return nil, fmt.Errorf("read local file: %v", err)
+			}
+			if md5Hex(data) == m.Blocks[last].Md5 {
+				offsets[last] = offset
+				break
+			}
+		}
+	}
+
+	return offsets, nil
+}
+
+// FetchFunc reads the range of the new content
+type FetchFunc func(offset, size int64) (io.ReadCloser, error)
+
+// Patch writes the new content, copying the matched blocks from the local file, and fetching the other blocks.
+// The fetched blocks are verified against the manifest. It returns the number of fetched bytes.
+func (m *Manifest) Patch(w io.Writer, local io.ReaderAt, offsets []int64, fetchFn FetchFunc) (fetched int64, err error) {
+	buf := make([]byte, m.BlockSize)
+	for i := 0; i < len(m.Blocks); {
+		if offsets[i] >= 0 {
+			data := buf[:m.blockLength(i)]
+			if _, err = local.ReadAt(data, offsets[i]); err != nil && err != io.EOF {
+				return fetched, fmt.Errorf("read local file: %v", err)
+			}
+			if _, err = w.Write(data); err != nil {
+				return fetched, err
+			}
+			i++
+			continue
+		}
+
+		// fetch the consecutive missing blocks in one range
+		stop := i
+		for stop < len(m.Blocks) && offsets[stop] < 0 {
+			stop++
+		}
+		size := int64(stop-i-1)*m.BlockSize + m.blockLength(stop-1)
+		if err = m.fetchBlocks(w, i, stop, size, buf, fetchFn); err != nil {
+			return fetched, err
+		}
+		fetched += size
+		i = stop
+	}
+	return fetched, nil
+}
+
+func (m *Manifest) fetchBlocks(w io.Writer, start, stop int, size int64, buf []byte, fetchFn FetchFunc) error {
+	offset := int64(start) * m.BlockSize
+	reader, err := fetchFn(offset, size)
+	if err != nil {
+		return fmt.Errorf("fetch [%d,%d): %v", offset, offset+size, err)
+	}
+	defer reader.Close()
+	for i := start; i < stop; i++ {
+		data := buf[:m.blockLength(i)]
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("fetch block %d: %v", i, err)
+		}
+		if md5Hex(data) != m.Blocks[i].Md5 {
+			return fmt.Errorf("fetched block %d does not match the manifest, the file may have changed", i)
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package delta
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestRollingChecksum(t *testing.T) {
+	data := make([]byte, 100)
+	rand.Read(data)
+	checksum := newRollingChecksum(data[:16])
+	for i := 16; i < len(data); i++ {
+		checksum.roll(data[i-16], data[i])
+		if expected := newRollingChecksum(data[i-15 : i+1]).value(); checksum.value() != expected {
+			t.Fatalf("rolled checksum %x at %d, expected %x", checksum.value(), i, expected)
+		}
+	}
+}
+
+func TestMatchAndPatch(t *testing.T) {
+	blockSize := int64(MinBlockSize)
+	content := make([]byte, 10*blockSize+100)
+	rand.Read(content)
+
+	// the old copy has some bytes inserted at the front, one block changed, and misses the last block
+	old := append([]byte("inserted"), content[:10*blockSize]...)
+	copy(old[8+3*blockSize:], []byte("changed"))
+
+	manifest, err := NewManifest(bytes.NewReader(content), blockSize)
+	if err != nil {
+		t.Fatalf("new manifest: %v", err)
+	}
+	if manifest.Size != int64(len(content)) || len(manifest.Blocks) != 11 {
+		t.Fatalf("unexpected manifest size %d with %d blocks", manifest.Size, len(manifest.Blocks))
+	}
+
+	offsets, err := manifest.Match(bytes.NewReader(old), int64(len(old)))
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+	for i, offset := range offsets {
+		expected := 8 + int64(i)*blockSize
+		if i == 3 || i == 10 {
+			expected = -1
+		}
+		if offset != expected {
+			t.Errorf("block %d matched at %d, expected %d", i, offset, expected)
+		}
+	}
+
+	var patched bytes.Buffer
+	fetched, err := manifest.Patch(&patched, bytes.NewReader(old), offsets, func(offset, size int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content[offset : offset+size])), nil
+	})
+	if err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if !bytes.Equal(patched.Bytes(), content) {
+		t.Fatalf("patched content differs")
+	}
+	if fetched != blockSize+100 {
+		t.Errorf("fetched %d bytes", fetched)
+	}
+
+	// a changed file fails the verification
+	_, err = manifest.Patch(ioutil.Discard, bytes.NewReader(old), offsets, func(offset, size int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(make([]byte, size))), nil
+	})
+	if err == nil {
+		t.Errorf("expected verification error")
+	}
+}
@@ -1,9 +1,14 @@
 package grace
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"runtime/trace"
+	"time"
 
 	"github.com/chrislusf/seaweedfs/weed/glog"
 )
@@ -32,3 +37,47 @@ func SetupProfiling(cpuProfile, memProfile string) {
 	}
 
 }
+
+// WriteProfile writes the named profile to w.
+// The cpu profile and the execution trace are collected for the given seconds,
+// while the other runtime profiles, e.g. heap and goroutine, are snapshots.
+// Cancelling ctx stops the collection early.
+func WriteProfile(ctx context.Context, w io.Writer, profileName string, seconds int) error {
+	if seconds <= 0 {
+		seconds = 30
+	}
+	duration := time.Duration(seconds) * time.Second
+	switch profileName {
+	case "cpu", "profile":
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return fmt.Errorf("start cpu profile: %v", err)
+		}
+		sleepWithContext(ctx, duration)
+		pprof.StopCPUProfile()
+		return nil
+	case "trace":
+		if err := trace.Start(w); err != nil {
+			return fmt.Errorf("start trace: %v", err)
+		}
+		sleepWithContext(ctx, duration)
+		trace.Stop()
+		return nil
+	}
+	p := pprof.Lookup(profileName)
+	if p == nil {
+		return fmt.Errorf("unknown profile %s", profileName)
+	}
+	if profileName == "heap" {
+		runtime.GC()
+	}
+	return p.WriteTo(w, 0)
+}
+
+func sleepWithContext(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP/2 over TLS is negotiated by net/http itself, once a server is started with a certificate.
+// h2c is HTTP/2 over cleartext, for the internal hops without TLS.
+// Many small requests are multiplexed over a few connections, without the head-of-line blocking of HTTP/1.1.
+
+// NewH2cHandler lets the handler also accept h2c, either with prior knowledge or by "Upgrade: h2c".
+// HTTP/1.1 requests are served as before.
+// It should be the outermost handler, since the prior knowledge preface is only recognized without any headers.
+func NewH2cHandler(handler http.Handler) http.Handler {
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// NewH2cTransport speaks h2c with prior knowledge, so all the servers must accept h2c.
+func NewH2cTransport() http.RoundTripper {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+}
+
+// SetClientTransport changes how the shared http client, used to read from the volume servers, sends the requests
+func SetClientTransport(transport http.RoundTripper) {
+	client.Transport = transport
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var hedgedReadDelay int64
+
+// SetHedgedReadDelay lets the reads from replicated volumes also ask the next replica
+// when the current one has not responded within the delay, to cut the latency of occasionally slow disks.
+// 0 disables the hedged reads.
+func SetHedgedReadDelay(delay time.Duration) {
+	atomic.StoreInt64(&hedgedReadDelay, int64(delay))
+}
+
+type replicaResponse struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// cancelOnClose releases the context of the winning request after its body is read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// getFromReplicas sends the GET to the first replica, and to one more replica each time the hedged read delay
+// passes without a response, or a replica fails. The first successful response is returned, and the other
+// requests are cancelled.
+func getFromReplicas(fileUrls []string, header http.Header) (*http.Response, error) {
+	delay := time.Duration(atomic.LoadInt64(&hedgedReadDelay))
+	if len(fileUrls) == 1 || delay <= 0 {
+		req, err := http.NewRequest("GET", fileUrls[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header
+		return client.Do(req)
+	}
+
+	responses := make(chan replicaResponse, len(fileUrls))
+	cancels := make([]context.CancelFunc, 0, len(fileUrls))
+	startNext := func() {
+		index := len(cancels)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		req, err := http.NewRequest("GET", fileUrls[index], nil)
+		if err != nil {
+			responses <- replicaResponse{index: index, err: err}
+			return
+		}
+		req = req.WithContext(ctx)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		go func() {
+			resp, err := client.Do(req)
+			responses <- replicaResponse{index: index, resp: resp, err: err}
+		}()
+	}
+
+	startNext()
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if len(cancels) < len(fileUrls) {
+				startNext()
+				pending++
+				timer.Reset(delay)
+			}
+		case r := <-responses:
+			pending--
+			if r.err == nil && r.resp.StatusCode < 400 {
+				for i, cancel := range cancels {
+					if i != r.index {
+						cancel()
+					}
+				}
+				go closeLateResponses(responses, pending)
+				r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancels[r.index]}
+				return r.resp, nil
+			}
+			if r.err != nil {
+				lastErr = r.err
+			} else {
+				lastErr = fmt.Errorf("%s: %s", fileUrls[r.index], r.resp.Status)
+				CloseResponse(r.resp)
+			}
+			cancels[r.index]()
+			if len(cancels) < len(fileUrls) {
+				startNext()
+				pending++
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+func closeLateResponses(responses chan replicaResponse, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-responses; r.resp != nil {
+			r.resp.Body.Close()
+		}
+	}
+}
+
+// getAllFromReplicas reads the whole content as Get does, from any of the replicas
+func getAllFromReplicas(fileUrls []string) ([]byte, error) {
+	r, err := getFromReplicas(fileUrls, make(http.Header))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if r.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s: %s", fileUrls[0], r.Status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadFromReplicas(t *testing.T) {
+	defer SetHedgedReadDelay(0)
+
+	var slowCancelled int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			atomic.StoreInt32(&slowCancelled, 1)
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failed.Close()
+
+	read := func(urls ...string) (string, time.Duration, error) {
+		start := time.Now()
+		data, err := getAllFromReplicas(urls)
+		return string(data), time.Since(start), err
+	}
+
+	// without hedging, only the first replica is read
+	if data, _, err := read(slow.URL, fast.URL); err != nil || data != "slow" {
+		t.Errorf("read without hedging: %q %v", data, err)
+	}
+
+	SetHedgedReadDelay(50 * time.Millisecond)
+	data, elapsed, err := read(slow.URL, fast.URL)
+	if err != nil || data != "fast" || elapsed > 500*time.Millisecond {
+		t.Errorf("hedged read: %q after %v: %v", data, elapsed, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&slowCancelled) != 1 {
+		t.Errorf("the slow read is not cancelled")
+	}
+
+	// a failed replica is skipped without waiting for the delay
+	SetHedgedReadDelay(time.Minute)
+	if data, elapsed, err := read(failed.URL, fast.URL); err != nil || data != "fast" || elapsed > 500*time.Millisecond {
+		t.Errorf("read after a failed replica: %q after %v: %v", data, elapsed, err)
+	}
+	if _, _, err := read(failed.URL, failed.URL); err == nil {
+		t.Errorf("read from failed replicas should fail")
+	}
+}
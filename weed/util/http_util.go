@@ -2,7 +2,6 @@ package util
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +11,8 @@ import (
 	"net/url"
 	"strings"
 
+	kgzip "github.com/klauspost/compress/gzip"
+
 	"github.com/chrislusf/seaweedfs/weed/glog"
 )
 
@@ -190,40 +191,42 @@ func NormalizeUrl(url string) string {
 }
 
 func ReadUrl(fileUrl string, cipherKey []byte, isContentCompressed bool, isFullChunk bool, offset int64, size int, buf []byte) (int64, error) {
+	return ReadUrlFromReplicas([]string{fileUrl}, cipherKey, isContentCompressed, isFullChunk, offset, size, buf)
+}
+
+// ReadUrlFromReplicas reads as ReadUrl, from any of the replicas of the file, see SetHedgedReadDelay
+func ReadUrlFromReplicas(fileUrls []string, cipherKey []byte, isContentCompressed bool, isFullChunk bool, offset int64, size int, buf []byte) (int64, error) {
 
 	if cipherKey != nil {
 		var n int
-		err := readEncryptedUrl(fileUrl, cipherKey, isContentCompressed, isFullChunk, offset, size, func(data []byte) {
+		err := readEncryptedUrl(fileUrls, cipherKey, isContentCompressed, isFullChunk, offset, size, func(data []byte) {
 			n = copy(buf, data)
 		})
 		return int64(n), err
 	}
 
-	req, err := http.NewRequest("GET", fileUrl, nil)
-	if err != nil {
-		return 0, err
-	}
+	header := make(http.Header)
 	if !isFullChunk {
-		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1))
+		header.Add("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1))
 	} else {
-		req.Header.Set("Accept-Encoding", "gzip")
+		header.Set("Accept-Encoding", "gzip")
 	}
 
-	r, err := client.Do(req)
+	r, err := getFromReplicas(fileUrls, header)
 	if err != nil {
 		return 0, err
 	}
 
 	defer r.Body.Close()
 	if r.StatusCode >= 400 {
-		return 0, fmt.Errorf("%s: %s", fileUrl, r.Status)
+		return 0, fmt.Errorf("%s: %s", fileUrls[0], r.Status)
 	}
 
 	var reader io.ReadCloser
 	contentEncoding := r.Header.Get("Content-Encoding")
 	switch contentEncoding {
 	case "gzip":
-		reader, err = gzip.NewReader(r.Body)
+		reader, err = kgzip.NewReader(r.Body)
 		defer reader.Close()
 	default:
 		reader = r.Body
@@ -259,27 +262,28 @@ func ReadUrl(fileUrl string, cipherKey []byte, isContentCompressed bool, isFullC
 }
 
 func ReadUrlAsStream(fileUrl string, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) error {
+	return ReadUrlAsStreamFromReplicas([]string{fileUrl}, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
+}
 
-	if cipherKey != nil {
-		return readEncryptedUrl(fileUrl, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
-	}
+// ReadUrlAsStreamFromReplicas reads as ReadUrlAsStream, from any of the replicas of the file, see SetHedgedReadDelay
+func ReadUrlAsStreamFromReplicas(fileUrls []string, cipherKey []byte, isContentGzipped bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) error {
 
-	req, err := http.NewRequest("GET", fileUrl, nil)
-	if err != nil {
-		return err
+	if cipherKey != nil {
+		return readEncryptedUrl(fileUrls, cipherKey, isContentGzipped, isFullChunk, offset, size, fn)
 	}
 
+	header := make(http.Header)
 	if !isFullChunk {
-		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1))
+		header.Add("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(size)-1))
 	}
 
-	r, err := client.Do(req)
+	r, err := getFromReplicas(fileUrls, header)
 	if err != nil {
 		return err
 	}
 	defer CloseResponse(r)
 	if r.StatusCode >= 400 {
-		return fmt.Errorf("%s: %s", fileUrl, r.Status)
+		return fmt.Errorf("%s: %s", fileUrls[0], r.Status)
 	}
 
 	var (
@@ -300,8 +304,9 @@ func ReadUrlAsStream(fileUrl string, cipherKey []byte, isContentGzipped bool, is
 
 }
 
-func readEncryptedUrl(fileUrl string, cipherKey []byte, isContentCompressed bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) error {
-	encryptedData, err := Get(fileUrl)
+func readEncryptedUrl(fileUrls []string, cipherKey []byte, isContentCompressed bool, isFullChunk bool, offset int64, size int, fn func(data []byte)) error {
+	fileUrl := fileUrls[0]
+	encryptedData, err := getAllFromReplicas(fileUrls)
 	if err != nil {
 		return fmt.Errorf("fetch %s: %v", fileUrl, err)
 	}
@@ -0,0 +1,52 @@
+package request_id
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Header carries the request id between http clients and servers
+	Header = "X-Request-ID"
+	// AmzHeader is the header name s3 clients expect the request id in
+	AmzHeader = "x-amz-request-id"
+	// MetadataKey carries the request id in grpc metadata, which requires lower case keys
+	MetadataKey = "x-request-id"
+)
+
+type requestIdKey struct{}
+
+func New() string {
+	return uuid.New().String()
+}
+
+// Set returns a copy of ctx carrying the request id
+func Set(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// Get returns the request id carried by ctx, or "" if none
+func Get(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// Middleware reuses the request id sent by the client, or generates one if this is the first hop.
+// The id is put into the request context and the request headers, so it is passed on to
+// internal requests that copy the headers, and is returned to the client as a response header.
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if id == "" {
+			id = New()
+			r.Header.Set(Header, id)
+		}
+		w.Header().Set(Header, id)
+		h.ServeHTTP(w, r.WithContext(Set(r.Context(), id)))
+	})
+}
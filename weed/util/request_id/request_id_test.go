@@ -0,0 +1,36 @@
+package request_id
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = Get(r.Context())
+		if r.Header.Get(Header) != seen {
+			t.Errorf("request header %q, context %q", r.Header.Get(Header), seen)
+		}
+	}))
+
+	// first hop generates the id
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if seen == "" {
+		t.Fatalf("no request id generated")
+	}
+	if w.Header().Get(Header) != seen {
+		t.Errorf("response header %q, expected %q", w.Header().Get(Header), seen)
+	}
+
+	// later hops reuse the id
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(Header, "abc")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if seen != "abc" || w.Header().Get(Header) != "abc" {
+		t.Errorf("expected request id abc, got %q and %q", seen, w.Header().Get(Header))
+	}
+}
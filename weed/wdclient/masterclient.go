@@ -2,7 +2,10 @@ package wdclient
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc"
@@ -128,3 +131,97 @@ func (mc *MasterClient) WithClient(fn func(client master_pb.SeaweedClient) error
 		return fn(client)
 	})
 }
+
+// LookupVolumeIds returns the locations of the volumes.
+// The volumes not known yet are looked up from the master in one request, and cached together.
+// The volumes not found are left out of the result.
+func (mc *MasterClient) LookupVolumeIds(vids []string) (map[string][]Location, error) {
+	result := make(map[string][]Location)
+	seen := make(map[string]bool)
+	var unknownVids []string
+	for _, vid := range vids {
+		if seen[vid] {
+			continue
+		}
+		seen[vid] = true
+		id, err := strconv.ParseUint(vid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unknown volume id %s", vid)
+		}
+		if locations, found := mc.GetLocations(uint32(id)); found && len(locations) > 0 {
+			result[vid] = locations
+		} else {
+			unknownVids = append(unknownVids, vid)
+		}
+	}
+	if len(unknownVids) == 0 {
+		return result, nil
+	}
+
+	err := mc.WithClient(func(client master_pb.SeaweedClient) error {
+		resp, err := master_pb.LookupVolumes(context.Background(), client, &master_pb.LookupVolumeRequest{
+			VolumeIds: unknownVids,
+		})
+		if err != nil {
+			return err
+		}
+		for _, vidLocations := range resp.VolumeIdLocations {
+			id, err := strconv.ParseUint(vidLocations.VolumeId, 10, 32)
+			if err != nil || vidLocations.Error != "" {
+				continue
+			}
+			for _, loc := range vidLocations.Locations {
+				location := Location{Url: loc.Url, PublicUrl: loc.PublicUrl}
+				mc.addLocation(uint32(id), location)
+				result[vidLocations.VolumeId] = append(result[vidLocations.VolumeId], location)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// LookupFileIds returns the urls of the files, after looking up all their volumes together
+func (mc *MasterClient) LookupFileIds(fileIds []string) (map[string]string, error) {
+	if err := mc.lookupFileIdVolumes(fileIds); err != nil {
+		return nil, err
+	}
+	fileId2Url := make(map[string]string)
+	for _, fileId := range fileIds {
+		fileUrl, err := mc.LookupFileId(fileId)
+		if err != nil {
+			return nil, err
+		}
+		fileId2Url[fileId] = fileUrl
+	}
+	return fileId2Url, nil
+}
+
+// LookupFileIdsReplicas returns the urls of all the replicas of the files, after looking up all their volumes together
+func (mc *MasterClient) LookupFileIdsReplicas(fileIds []string) (map[string][]string, error) {
+	if err := mc.lookupFileIdVolumes(fileIds); err != nil {
+		return nil, err
+	}
+	fileId2Urls := make(map[string][]string)
+	for _, fileId := range fileIds {
+		fileUrls, err := mc.LookupFileIdReplicas(fileId)
+		if err != nil {
+			return nil, err
+		}
+		fileId2Urls[fileId] = fileUrls
+	}
+	return fileId2Urls, nil
+}
+
+func (mc *MasterClient) lookupFileIdVolumes(fileIds []string) error {
+	var vids []string
+	for _, fileId := range fileIds {
+		commaIndex := strings.Index(fileId, ",")
+		if commaIndex <= 0 {
+			return fmt.Errorf("invalid fileId %s", fileId)
+		}
+		vids = append(vids, fileId[:commaIndex])
+	}
+	_, err := mc.LookupVolumeIds(vids)
+	return err
+}
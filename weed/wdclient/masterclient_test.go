@@ -0,0 +1,99 @@
+package wdclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/chrislusf/seaweedfs/weed/pb/master_pb"
+)
+
+func TestLookupCachedVolumeIds(t *testing.T) {
+	mc := NewMasterClient(nil, "test", "", 0, nil)
+	mc.addLocation(3, Location{Url: "a:8080"})
+	mc.addLocation(3, Location{Url: "b:8080"})
+	mc.addLocation(5, Location{Url: "b:8080"})
+
+	// all known volumes do not need the master
+	result, err := mc.LookupVolumeIds([]string{"3", "5", "3"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(result) != 2 || len(result["3"]) != 2 || len(result["5"]) != 1 {
+		t.Fatalf("unexpected locations: %+v", result)
+	}
+
+	fileId2Url, err := mc.LookupFileIds([]string{"5,0132", "3,01ab"})
+	if err != nil {
+		t.Fatalf("lookup file ids: %v", err)
+	}
+	if fileId2Url["5,0132"] != "http://b:8080/5,0132" {
+		t.Fatalf("unexpected url %s", fileId2Url["5,0132"])
+	}
+
+	if _, err = mc.LookupVolumeIds([]string{"x"}); err == nil {
+		t.Fatalf("invalid volume id is looked up")
+	}
+}
+
+type lookupTestMaster struct {
+	master_pb.UnimplementedSeaweedServer
+	requested [][]string
+}
+
+func (m *lookupTestMaster) LookupVolume(ctx context.Context, req *master_pb.LookupVolumeRequest) (*master_pb.LookupVolumeResponse, error) {
+	m.requested = append(m.requested, req.VolumeIds)
+	resp := &master_pb.LookupVolumeResponse{}
+	for _, vid := range req.VolumeIds {
+		if vid == "9" {
+			resp.VolumeIdLocations = append(resp.VolumeIdLocations, &master_pb.LookupVolumeResponse_VolumeIdLocation{VolumeId: vid, Error: "volume id 9 not found"})
+			continue
+		}
+		resp.VolumeIdLocations = append(resp.VolumeIdLocations, &master_pb.LookupVolumeResponse_VolumeIdLocation{
+			VolumeId:  vid,
+			Locations: []*master_pb.Location{{Url: "c:8080", PublicUrl: "c:8080"}},
+		})
+	}
+	return resp, nil
+}
+
+func TestLookupUnknownVolumeIds(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if port <= 10000 {
+		listener.Close()
+		t.Skipf("grpc port %d is too low to derive the http port", port)
+	}
+	master := &lookupTestMaster{}
+	grpcServer := grpc.NewServer()
+	master_pb.RegisterSeaweedServer(grpcServer, master)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	mc := NewMasterClient(grpc.WithInsecure(), "test", "", 0, nil)
+	mc.currentMaster = fmt.Sprintf("localhost:%d", port-10000)
+	mc.addLocation(3, Location{Url: "a:8080"})
+
+	// the unknown volumes are looked up once, in one request
+	result, err := mc.LookupVolumeIds([]string{"7", "3", "7", "9", "7"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(master.requested) != 1 || len(master.requested[0]) != 2 {
+		t.Fatalf("requested from the master: %v", master.requested)
+	}
+	if len(result) != 2 || len(result["7"]) != 1 || len(result["3"]) != 1 {
+		t.Fatalf("unexpected locations: %+v", result)
+	}
+
+	// the found volumes are cached
+	if _, err = mc.LookupVolumeIds([]string{"7", "3"}); err != nil || len(master.requested) != 1 {
+		t.Fatalf("lookup cached volumes: %v, requested %v", err, master.requested)
+	}
+}
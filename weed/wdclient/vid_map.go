@@ -66,6 +66,40 @@ func (vc *vidMap) LookupFileId(fileId string) (fullUrl string, err error) {
 	return "http://" + serverUrl + "/" + fileId, nil
 }
 
+// LookupFileIdReplicas returns the urls of all the replicas of the file, starting from the one LookupFileId would pick,
+// with the volume servers failed recently at the end
+func (vc *vidMap) LookupFileIdReplicas(fileId string) (fullUrls []string, err error) {
+	parts := strings.Split(fileId, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("Invalid fileId " + fileId)
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		glog.V(1).Infof("Unknown volume id %s", parts[0])
+		return nil, err
+	}
+
+	locations, _ := vc.GetLocations(uint32(id))
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("volume %d not found", id)
+	}
+	index, err := vc.getLocationIndex(len(locations))
+	if err != nil {
+		return nil, fmt.Errorf("volume %d: %v", id, err)
+	}
+
+	var failedUrls []string
+	for i := 0; i < len(locations); i++ {
+		loc := locations[(index+i)%len(locations)]
+		if isVolumeServerAvailable(loc.Url) {
+			fullUrls = append(fullUrls, "http://"+loc.Url+"/"+fileId)
+		} else {
+			failedUrls = append(failedUrls, "http://"+loc.Url+"/"+fileId)
+		}
+	}
+	return append(fullUrls, failedUrls...), nil
+}
+
 func (vc *vidMap) LookupVolumeServer(fileId string) (volumeServer string, err error) {
 	parts := strings.Split(fileId, ",")
 	if len(parts) != 2 {
@@ -113,6 +147,14 @@ func (vc *vidMap) GetRandomLocation(vid uint32) (serverUrl string, err error) {
 		return "", fmt.Errorf("volume %d: %v", vid, err)
 	}
 
+	// skip the volume servers failed recently, unless all of them failed
+	for i := 0; i < len(locations); i++ {
+		loc := locations[(index+i)%len(locations)]
+		if isVolumeServerAvailable(loc.Url) {
+			return loc.Url, nil
+		}
+	}
+
 	return locations[index].Url, nil
 }
 
@@ -74,3 +74,23 @@ func BenchmarkLocationIndex(b *testing.B) {
 		}
 	})
 }
+
+func TestLookupFileIdReplicas(t *testing.T) {
+	vm := newVidMap()
+	vm.addLocation(3, Location{Url: "a:8080"})
+	vm.addLocation(3, Location{Url: "b:8080"})
+
+	for i := 0; i < 2; i++ {
+		fileUrls, err := vm.LookupFileIdReplicas("3,01637037d6")
+		if err != nil || len(fileUrls) != 2 || fileUrls[0] == fileUrls[1] {
+			t.Fatalf("replicas: %v %v", fileUrls, err)
+		}
+		if fileUrl, _ := vm.LookupFileId("3,01637037d6"); fileUrl != fileUrls[1] {
+			t.Errorf("LookupFileId %s after %v", fileUrl, fileUrls)
+		}
+	}
+
+	if _, err := vm.LookupFileIdReplicas("4,01637037d6"); err == nil {
+		t.Errorf("lookup of an unknown volume should fail")
+	}
+}
@@ -0,0 +1,223 @@
+package wdclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chrislusf/seaweedfs/weed/glog"
+	"github.com/chrislusf/seaweedfs/weed/pb"
+	"github.com/chrislusf/seaweedfs/weed/util"
+)
+
+// The volume server pool keeps the connections to the volume servers.
+// The http connections are limited per volume server, and the gRPC calls are spread over a few connections per volume server.
+// After BreakerFailures failures in a row, a volume server is skipped for BreakerDuration,
+// and then one request probes whether the volume server is back.
+
+type PoolOption struct {
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int // 0 means no limit
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	GrpcConnsPerHost    int
+	BreakerFailures     int // 0 disables the circuit breaking
+	BreakerDuration     time.Duration
+	H2c                 bool // the volume servers run with -h2c
+}
+
+type VolumeServerPool struct {
+	option    PoolOption
+	transport http.RoundTripper
+
+	breakers     map[string]*hostBreaker
+	breakersLock sync.Mutex
+
+	grpcConns     map[string][]*grpc.ClientConn
+	grpcConnsLock sync.Mutex
+	grpcCursor    uint32
+}
+
+type hostBreaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var volumeServerPool *VolumeServerPool
+
+// ConfigureVolumeServerPool lets the shared http client read from the volume servers with the pool,
+// and the locations of the volumes skip the volume servers failed recently.
+func ConfigureVolumeServerPool(option PoolOption) *VolumeServerPool {
+	p := NewVolumeServerPool(option)
+	util.SetClientTransport(p)
+	volumeServerPool = p
+	return p
+}
+
+func NewVolumeServerPool(option PoolOption) *VolumeServerPool {
+	if option.GrpcConnsPerHost <= 0 {
+		option.GrpcConnsPerHost = 1
+	}
+	p := &VolumeServerPool{
+		option:    option,
+		breakers:  make(map[string]*hostBreaker),
+		grpcConns: make(map[string][]*grpc.ClientConn),
+	}
+	if option.H2c {
+		// the requests are multiplexed over one connection per volume server
+		p.transport = util.NewH2cTransport()
+	} else {
+		p.transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: option.KeepAlive,
+			}).DialContext,
+			MaxIdleConnsPerHost:   option.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       option.MaxConnsPerHost,
+			IdleConnTimeout:       option.IdleConnTimeout,
+			ExpectContinueTimeout: time.Second,
+		}
+	}
+	return p
+}
+
+func (p *VolumeServerPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := p.allow(host); err != nil {
+		return nil, err
+	}
+	resp, err := p.transport.RoundTrip(req)
+	if req.Context().Err() != nil {
+		// canceled by the caller, not a failure of the volume server
+		p.forgetProbe(host)
+		return resp, err
+	}
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		p.record(host, fmt.Errorf("%s", resp.Status))
+	} else {
+		p.record(host, err)
+	}
+	return resp, err
+}
+
+// WithGrpcClient calls fn with one of the gRPC connections to the address of the volume server
+func (p *VolumeServerPool) WithGrpcClient(address string, grpcDialOption grpc.DialOption, fn func(*grpc.ClientConn) error) error {
+	if err := p.allow(address); err != nil {
+		return err
+	}
+	grpcConnection, err := p.getGrpcConnection(address, grpcDialOption)
+	if err != nil {
+		p.record(address, err)
+		return err
+	}
+	err = fn(grpcConnection)
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		p.record(address, err)
+	default:
+		p.record(address, nil)
+	}
+	return err
+}
+
+func (p *VolumeServerPool) getGrpcConnection(address string, grpcDialOption grpc.DialOption) (*grpc.ClientConn, error) {
+	p.grpcConnsLock.Lock()
+	defer p.grpcConnsLock.Unlock()
+
+	conns := p.grpcConns[address]
+	if len(conns) < p.option.GrpcConnsPerHost {
+		grpcConnection, err := pb.GrpcDial(context.Background(), address, grpcDialOption)
+		if err != nil {
+			return nil, fmt.Errorf("fail to dial %s: %v", address, err)
+		}
+		p.grpcConns[address] = append(conns, grpcConnection)
+		return grpcConnection, nil
+	}
+	return conns[atomic.AddUint32(&p.grpcCursor, 1)%uint32(len(conns))], nil
+}
+
+// IsAvailable tells whether requests to the volume server can be sent now
+func (p *VolumeServerPool) IsAvailable(host string) bool {
+	if p.option.BreakerFailures <= 0 {
+		return true
+	}
+	p.breakersLock.Lock()
+	defer p.breakersLock.Unlock()
+	b, found := p.breakers[host]
+	return !found || b.failures < p.option.BreakerFailures || (!b.probing && !time.Now().Before(b.openUntil))
+}
+
+func (p *VolumeServerPool) allow(host string) error {
+	if p.option.BreakerFailures <= 0 {
+		return nil
+	}
+	p.breakersLock.Lock()
+	defer p.breakersLock.Unlock()
+	b, found := p.breakers[host]
+	if !found || b.failures < p.option.BreakerFailures {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return fmt.Errorf("volume server %s is skipped after %d failures", host, b.failures)
+	}
+	b.probing = true
+	return nil
+}
+
+func (p *VolumeServerPool) record(host string, err error) {
+	if p.option.BreakerFailures <= 0 {
+		return
+	}
+	p.breakersLock.Lock()
+	defer p.breakersLock.Unlock()
+	if err == nil {
+		delete(p.breakers, host)
+		return
+	}
+	b, found := p.breakers[host]
+	if !found {
+		b = &hostBreaker{}
+		p.breakers[host] = b
+	}
+	b.failures++
+	b.probing = false
+	if b.failures >= p.option.BreakerFailures {
+		if b.failures == p.option.BreakerFailures {
+			glog.V(0).Infof("skip volume server %s for %v after %d failures: %v", host, p.option.BreakerDuration, b.failures, err)
+		}
+		b.openUntil = time.Now().Add(p.option.BreakerDuration)
+	}
+}
+
+func (p *VolumeServerPool) forgetProbe(host string) {
+	p.breakersLock.Lock()
+	defer p.breakersLock.Unlock()
+	if b, found := p.breakers[host]; found {
+		b.probing = false
+	}
+}
+
+func isVolumeServerAvailable(host string) bool {
+	if volumeServerPool == nil {
+		return true
+	}
+	return volumeServerPool.IsAvailable(host)
+}
+
+// WithVolumeServerGrpcClient uses the configured pool, or the cached gRPC connection of the address
+func WithVolumeServerGrpcClient(address string, grpcDialOption grpc.DialOption, fn func(*grpc.ClientConn) error) error {
+	if volumeServerPool == nil {
+		return pb.WithCachedGrpcClient(fn, address, grpcDialOption)
+	}
+	return volumeServerPool.WithGrpcClient(address, grpcDialOption, fn)
+}
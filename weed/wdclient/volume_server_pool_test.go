@@ -0,0 +1,50 @@
+package wdclient
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVolumeServerBreaker(t *testing.T) {
+	p := NewVolumeServerPool(PoolOption{BreakerFailures: 3, BreakerDuration: 50 * time.Millisecond})
+	host := "localhost:8080"
+
+	for i := 0; i < 3; i++ {
+		if err := p.allow(host); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+		p.record(host, fmt.Errorf("failed"))
+	}
+	if p.IsAvailable(host) || p.allow(host) == nil {
+		t.Fatalf("failed volume server is not skipped")
+	}
+
+	// only one request probes the volume server
+	time.Sleep(60 * time.Millisecond)
+	if err := p.allow(host); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if p.allow(host) == nil {
+		t.Fatalf("two probes at the same time")
+	}
+	p.record(host, nil)
+	if !p.IsAvailable(host) || p.allow(host) != nil {
+		t.Fatalf("recovered volume server is skipped")
+	}
+}
+
+func TestSkipFailedLocation(t *testing.T) {
+	defer func(p *VolumeServerPool) { volumeServerPool = p }(volumeServerPool)
+	volumeServerPool = NewVolumeServerPool(PoolOption{BreakerFailures: 1, BreakerDuration: time.Minute})
+	volumeServerPool.record("a:8080", fmt.Errorf("failed"))
+
+	vm := newVidMap()
+	vm.addLocation(1, Location{Url: "a:8080"})
+	vm.addLocation(1, Location{Url: "b:8080"})
+	for i := 0; i < 4; i++ {
+		if url, _ := vm.GetRandomLocation(1); url != "b:8080" {
+			t.Fatalf("got failed location %s", url)
+		}
+	}
+}